@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/seed"
+	"exampleserver/internal/stats"
+	"exampleserver/internal/store"
+	"exampleserver/internal/version"
+	"exampleserver/pkg/config"
+)
+
+// printVersion prints the build metadata of the binary
+func printVersion(args []string) error {
+	flags := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print as JSON")
+	flags.Parse(args)
+
+	info := version.Get()
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(info)
+	}
+	fmt.Printf("exampleserver %s (commit %s, built %s, %s)\n", info.Version, info.Commit, info.BuildDate, info.GoVersion)
+	return nil
+}
+
+// checkConfig loads the configuration from the environment and .env file
+// and reports any problems, exiting non-zero if it is invalid
+func checkConfig(args []string) error {
+	flags := flag.NewFlagSet("config check", flag.ExitOnError)
+	flags.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	problems := cfg.Validate()
+	if _, err := stats.ParseAlertRules(cfg.StatsAlertRules); err != nil {
+		problems = errors.Join(problems, fmt.Errorf("STATS_ALERTS is invalid: %w", err))
+	}
+	if _, err := auth.NewTokenEncryption(cfg.JWTEncryptionAlg, cfg.JWTEncryptionKey); err != nil {
+		problems = errors.Join(problems, fmt.Errorf("JWT_ENCRYPTION_ALG or JWT_ENCRYPTION_KEY is invalid: %w", err))
+	}
+	for _, warning := range cfg.Warnings() {
+		fmt.Println("Warning:", warning)
+	}
+	if problems != nil {
+		return fmt.Errorf("invalid configuration:\n%w", problems)
+	}
+	fmt.Println("Configuration OK")
+	return nil
+}
+
+// generateToken mints a JWT for a user in the configured store, signed with
+// JWT_SECRET, for testing against a running server
+func generateToken(args []string) error {
+	flags := flag.NewFlagSet("token generate", flag.ExitOnError)
+	username := flags.String("username", "", "user to issue the token for (required)")
+	flags.Parse(args)
+	if *username == "" {
+		flags.Usage()
+		return errors.New("-username is required")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if cfg.StoreDriver == "memory" {
+		return errors.New("the memory store is empty outside the server; set STORE_DRIVER to sqlite or postgres")
+	}
+	st, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	user, err := st.Users.GetByUsername(context.Background(), *username)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", *username, err)
+	}
+	if user.Disabled {
+		return fmt.Errorf("user %s is disabled", *username)
+	}
+	encryption, err := auth.NewTokenEncryption(cfg.JWTEncryptionAlg, cfg.JWTEncryptionKey)
+	if err != nil {
+		return err
+	}
+	token, err := auth.NewJWTService(cfg.JWTSecret).WithEncryption(encryption).GenerateToken(user.ID, user.Username, user.Roles, user.SessionVersion)
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
+
+// createAPIKey prints a new random API key and the API_KEYS entry that
+// enables it
+func createAPIKey(args []string) error {
+	flags := flag.NewFlagSet("apikey create", flag.ExitOnError)
+	name := flags.String("name", "api-key", "subject the key authenticates as")
+	flags.Parse(args)
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	key := base64.RawURLEncoding.EncodeToString(b)
+
+	fmt.Println(key)
+	fmt.Fprintf(os.Stderr, "Add %s=%s to the comma separated API_KEYS, and its roles to API_KEY_ROLES (e.g. %s=admin), and restart the server\n", *name, key, *name)
+	fmt.Fprintf(os.Stderr, "Its usage is reported under key ID %s\n", auth.KeyID(key))
+	return nil
+}
+
+// seedStores fills the configured store with fake users and customers, so
+// a new development database or a load test has data to work against
+func seedStores(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	users := flags.Int("users", 10, "number of users to add")
+	customers := flags.Int("customers", 100, "number of customers to add")
+	password := flags.String("password", "", "password of every seeded user (required with -users)")
+	seedValue := flags.Int64("seed", 0, "seed of the fake data, to reproduce it; 0 picks one")
+	flags.Parse(args)
+	if *users > 0 && *password == "" {
+		flags.Usage()
+		return errors.New("-password is required to seed users")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if cfg.StoreDriver == "memory" {
+		return errors.New("the memory store is empty outside the server; set STORE_DRIVER to sqlite or postgres")
+	}
+	st, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	passwords := auth.NewPasswordHasher(cfg.PasswordHash, auth.Argon2Params{
+		Memory:  uint32(cfg.Argon2Memory),
+		Time:    uint32(cfg.Argon2Time),
+		Threads: uint8(cfg.Argon2Parallelism),
+	})
+	result, err := seed.Run(context.Background(), st, passwords, seed.Options{
+		Users:     *users,
+		Customers: *customers,
+		Password:  *password,
+		Seed:      *seedValue,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added %d users and %d customers\n", result.Users, result.Customers)
+	if result.Skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d that clashed with existing usernames or emails\n", result.Skipped)
+	}
+	fmt.Fprintf(os.Stderr, "Run again with -seed %d to reproduce this data\n", result.Seed)
+	return nil
+}
+
+// runMigrations applies, reverts or lists the migrations of the configured
+// sqlite or postgres store
+func runMigrations(args []string) error {
+	if len(args) == 0 || (args[0] != "up" && args[0] != "down" && args[0] != "status") {
+		return errors.New("usage: server migrate up|down|status")
+	}
+	direction := args[0]
+	flags := flag.NewFlagSet("migrate "+direction, flag.ExitOnError)
+	steps := 0
+	switch direction {
+	case "up":
+		flags.IntVar(&steps, "steps", 0, "number of migrations to apply; 0 applies all pending")
+	case "down":
+		flags.IntVar(&steps, "steps", 1, "number of migrations to revert, newest first")
+	}
+	flags.Parse(args[1:])
+	if steps < 0 || (direction == "down" && steps == 0) {
+		flags.Usage()
+		return errors.New("-steps must be a positive number")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if cfg.StoreDriver == "memory" {
+		return errors.New("the memory store has no schema; set STORE_DRIVER to sqlite or postgres")
+	}
+	ctx := context.Background()
+	migrator, err := store.NewMigrator(ctx, storeConfig(cfg))
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch direction {
+	case "up":
+		applied, err := migrator.Up(ctx, steps)
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+		return err
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(reverted) == 0 {
+			fmt.Println("No migrations to revert")
+		}
+		return err
+	}
+
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range status {
+		name := m.Name
+		if name == "" {
+			name = "(applied by a newer binary)"
+		}
+		applied := "pending"
+		if m.AppliedAt != nil {
+			applied = "applied " + m.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Printf("%04d  %-32s %s\n", m.Version, name, applied)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// healthcheck requests /healthz from the server on this host and fails
+// unless it answers 200, for Docker HEALTHCHECK and exec probes in images
+// without curl
+func healthcheck(args []string) error {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	flags := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	url := flags.String("url", "http://127.0.0.1:"+port+"/healthz", "endpoint to probe")
+	timeout := flags.Duration("timeout", 3*time.Second, "time to wait for a response")
+	flags.Parse(args)
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get(*url)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check failed: %s returned %s", *url, resp.Status)
+	}
+	return nil
+}
@@ -1,40 +1,62 @@
 package main
 
 import (
-	"log"
+	"fmt"
+	"os"
 
 	"exampleserver/internal/server"
-	"exampleserver/internal/services"
-	"exampleserver/internal/stats"
-	"exampleserver/pkg/config"
-	"exampleserver/pkg/logger"
 )
 
-func main() {
-	// Load configuration first
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatal(err)
-	}
+const usage = `Usage: server [command]
 
-	// Initialize shared logger
-	if err := logger.Initialize("logger.yaml"); err != nil {
-		log.Fatal(err)
-	}
+Commands:
+  serve            Run the HTTP server (default)
+  version          Print build information
+  healthcheck      Probe the local server's /healthz, exiting 0 if healthy
+  config check     Validate the configuration and exit
+  token generate   Mint a JWT for an existing user
+  apikey create    Generate a new API key
+  seed             Fill the store with fake users and customers
+  migrate up       Apply pending database migrations
+  migrate down     Revert the latest database migration
+  migrate status   List the database migrations and whether each is applied
 
-	// Log startup information
-	logger.Info("Starting server...")
+Run "server <command> -h" for the flags of a command.
+`
 
-	// Create service manager
-	serviceManager := services.NewManager()
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
 
-	// Create and add stats service
-	statsService := stats.NewStatsService(cfg.StatsInterval, logger.Default())
-	serviceManager.AddService(statsService)
+	var err error
+	switch command := args[0]; {
+	case command == "serve":
+		err = serve(args[1:])
+	case command == "version":
+		err = printVersion(args[1:])
+	case command == "healthcheck" || command == "-healthcheck":
+		err = healthcheck(args[1:])
+	case command == "config" && len(args) > 1 && args[1] == "check":
+		err = checkConfig(args[2:])
+	case command == "token" && len(args) > 1 && args[1] == "generate":
+		err = generateToken(args[2:])
+	case command == "apikey" && len(args) > 1 && args[1] == "create":
+		err = createAPIKey(args[2:])
+	case command == "seed":
+		err = seedStores(args[1:])
+	case command == "migrate":
+		err = runMigrations(args[1:])
+	case command == "help" || command == "-h" || command == "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
 
-	// Create and start server
-	srv := server.New(cfg, logger.Default())
-	if err := srv.Start(); err != nil {
-		logger.Fatal("Server error: %v", err)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(server.ExitCode(err))
 	}
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"syscall"
+
+	"exampleserver/internal/server"
+	"exampleserver/internal/services"
+	"exampleserver/internal/store"
+	"exampleserver/internal/version"
+	"exampleserver/pkg/config"
+	"exampleserver/pkg/logger"
+)
+
+// serve runs the HTTP server until it is signalled to stop
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	loggerConfig := flags.String("logger-config", "logger.yaml", "path of the logger configuration")
+	flags.Parse(args)
+
+	// Load configuration first
+	cfg, err := config.Load()
+	if err != nil {
+		return &server.ExitError{Reason: server.ExitConfig, Err: err}
+	}
+
+	// Initialize shared logger
+	if err := logger.Initialize(*loggerConfig); err != nil {
+		return &server.ExitError{Reason: server.ExitConfig, Err: err}
+	}
+	defer logger.Close()
+	logger.SetBuildInfo(version.Get())
+
+	// Log startup information
+	logger.Info("Starting server...")
+
+	// Open the storage backend
+	st, err := openStore(cfg)
+	if err != nil {
+		logger.Fatal("Store error: %v", err)
+	}
+	defer st.Close()
+
+	// Create service manager; the server registers its own services
+	serviceManager := services.NewManager(logger.Default())
+
+	// Create and start server. Start has logged why it stopped; the error
+	// sets the exit code.
+	srv, err := server.New(cfg, logger.Default(), serviceManager, st)
+	if err != nil {
+		server.LogConfigError(logger.Default(), err)
+		return err
+	}
+	err = srv.Start()
+	if errors.Is(err, server.ErrRestart) && cfg.ShutdownRestart != "exit" {
+		return restart(st)
+	}
+	return err
+}
+
+// restart replaces the process with a fresh copy of the server, keeping its
+// PID, arguments and environment, once the old one has shut down. If that
+// fails the process exits with ExitCodeRestart, for a supervisor to start
+// it again.
+func restart(st *store.Store) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return &server.ExitError{Reason: server.ExitRestart, Err: err}
+	}
+	logger.Info("Restarting %s", executable)
+	st.Close()
+	logger.Close()
+	if err := syscall.Exec(executable, os.Args, os.Environ()); err != nil {
+		return &server.ExitError{Reason: server.ExitRestart, Err: fmt.Errorf("restarting %s: %w", executable, err)}
+	}
+	return nil
+}
+
+// openStore opens the configured storage backend, applying migrations
+// unless STORE_AUTO_MIGRATE is off
+func openStore(cfg *config.Config) (*store.Store, error) {
+	return store.Open(context.Background(), storeConfig(cfg))
+}
+
+func storeConfig(cfg *config.Config) store.Config {
+	return store.Config{
+		Driver:           cfg.StoreDriver,
+		DSN:              cfg.StoreDSN,
+		MaxOpenConns:     cfg.StoreMaxOpenConns,
+		MaxIdleConns:     cfg.StoreMaxIdleConns,
+		ConnMaxLifetime:  cfg.StoreConnMaxLifetime,
+		ManualMigrations: !cfg.StoreAutoMigrate,
+	}
+}
@@ -1,7 +1,11 @@
 package auth
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"net/http"
+	"strings"
 )
 
 // Authenticator defines the interface for different auth strategies
@@ -30,16 +34,50 @@ func (c *Chain) Authenticate(r *http.Request) (*Claims, error) {
 	return nil, lastErr
 }
 
+// Validated wraps an authenticator with a check run on every credential it
+// accepts, such as rejecting tokens of disabled users
+func Validated(authenticator Authenticator, validate func(r *http.Request, claims *Claims) error) Authenticator {
+	return &validatedAuthenticator{authenticator: authenticator, validate: validate}
+}
+
+type validatedAuthenticator struct {
+	authenticator Authenticator
+	validate      func(r *http.Request, claims *Claims) error
+}
+
+func (v *validatedAuthenticator) Authenticate(r *http.Request) (*Claims, error) {
+	claims, err := v.authenticator.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.validate(r, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// devAPIKey is the development key accepted in dev mode when no keys are
+// configured
+const devAPIKey = "gtest"
+
 // APIKeyAuthenticator implements simple API key authentication
 type APIKeyAuthenticator struct {
-	validKeys map[string]string // map[apiKey]subject
+	validKeys map[string]string   // map[apiKey]subject
+	roles     map[string][]string // map[subject]roles
+	tenants   map[string][]string // map[subject]tenants
 }
 
-func NewAPIKeyAuthenticator(keys map[string]string) *APIKeyAuthenticator {
-	if keys == nil {
-		keys = map[string]string{"gtest": "test-user"} // default test key
+// NewAPIKeyAuthenticator accepts the given keys, mapped to the subject they
+// authenticate as, granting each subject the roles and tenants it has in
+// roles and tenants and none otherwise. Without keys no key is accepted,
+// unless devMode is on, when the "gtest" development key is accepted as an
+// admin.
+func NewAPIKeyAuthenticator(keys map[string]string, roles, tenants map[string][]string, devMode bool) *APIKeyAuthenticator {
+	if len(keys) == 0 && devMode {
+		keys = map[string]string{devAPIKey: "test-user"}
+		roles = map[string][]string{"test-user": {RoleAdmin}}
 	}
-	return &APIKeyAuthenticator{validKeys: keys}
+	return &APIKeyAuthenticator{validKeys: keys, roles: roles, tenants: tenants}
 }
 
 func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Claims, error) {
@@ -57,10 +95,51 @@ func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Claims, error) {
 		return &Claims{
 			Subject:  subject,
 			Type:     "api-key",
+			KeyID:    KeyID(key),
 			UserID:   subject,
 			Username: subject,
+			Roles:    append([]string(nil), a.roles[subject]...),
+			Tenants:  append([]string(nil), a.tenants[subject]...),
 		}, nil
 	}
 
 	return nil, ErrInvalidCredentials
 }
+
+// Keys returns the subjects of the accepted keys by key ID
+func (a *APIKeyAuthenticator) Keys() map[string]string {
+	keys := make(map[string]string, len(a.validKeys))
+	for key, subject := range a.validKeys {
+		keys[KeyID(key)] = subject
+	}
+	return keys
+}
+
+// KeyID identifies an API key in usage reports without revealing it
+func KeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// SCIMAuthenticator accepts the bearer token an identity provider
+// provisions users with. The token is only accepted on SCIM paths and grants
+// nothing but RoleSCIM.
+type SCIMAuthenticator struct {
+	token string
+}
+
+// NewSCIMAuthenticator accepts token; an empty token disables it
+func NewSCIMAuthenticator(token string) *SCIMAuthenticator {
+	return &SCIMAuthenticator{token: token}
+}
+
+func (a *SCIMAuthenticator) Authenticate(r *http.Request) (*Claims, error) {
+	token := extractBearerToken(r)
+	if a.token == "" || token == "" || !strings.HasPrefix(r.URL.Path, "/scim/") {
+		return nil, ErrNoCredentials
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return &Claims{Subject: "scim", Type: "scim", Username: "scim", Roles: []string{RoleSCIM}}, nil
+}
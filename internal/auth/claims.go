@@ -2,10 +2,45 @@ package auth
 
 import "github.com/golang-jwt/jwt/v5"
 
+const (
+	// RoleAdmin grants access to the user management endpoints
+	RoleAdmin = "admin"
+	// RoleSCIM grants access to the SCIM provisioning endpoints
+	RoleSCIM = "scim"
+)
+
 type Claims struct {
-	Subject  string `json:"sub"`
-	UserID   string `json:"user_id,omitempty"`
-	Username string `json:"username,omitempty"`
-	Type     string `json:"type"`
+	Subject  string   `json:"sub"`
+	UserID   string   `json:"user_id,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	// Tenants are the tenants the caller may act for in policy decisions
+	Tenants []string `json:"tenants,omitempty"`
+	// SessionVersion must match the user's current version for the token to
+	// be accepted; bumping it revokes the user's sessions
+	SessionVersion int    `json:"sv,omitempty"`
+	Type           string `json:"type"`
+	// KeyID identifies the API key of api-key claims
+	KeyID string `json:"key_id,omitempty"`
 	jwt.RegisteredClaims
 }
+
+// InTenant reports whether the claims may act for tenant
+func (c *Claims) InTenant(tenant string) bool {
+	for _, t := range c.Tenants {
+		if t == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the claims grant role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
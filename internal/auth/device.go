@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewDeviceToken returns a random long-lived device token and the hash to
+// store for it
+func NewDeviceToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashDeviceToken(token), nil
+}
+
+// HashDeviceToken returns the stored hash of a device token. The token is
+// random, so an unsalted fast hash is enough to keep a leaked store from
+// yielding usable tokens.
+func HashDeviceToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
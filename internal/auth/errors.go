@@ -7,4 +7,7 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrInvalidToken       = errors.New("invalid token")
 	ErrExpiredToken       = errors.New("expired token")
+	ErrRevokedSession     = errors.New("session revoked")
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrExpiredLink        = errors.New("link expired")
 )
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+// tokenKeySizes are the supported JWE key management algorithms with the
+// size of their key in bytes, the one table of them NewTokenEncryption and
+// so config check go by. Content is always encrypted with A256GCM.
+var tokenKeySizes = map[string]int{
+	"dir":       32,
+	"A128KW":    16,
+	"A192KW":    24,
+	"A256KW":    32,
+	"A128GCMKW": 16,
+	"A192GCMKW": 24,
+	"A256GCMKW": 32,
+}
+
+// TokenEncryption wraps signed tokens in JWE, so their claims can't be read
+// by clients or intermediaries. A nil TokenEncryption leaves tokens signed
+// only.
+type TokenEncryption struct {
+	algorithm jose.KeyAlgorithm
+	key       []byte
+	encrypter jose.Encrypter
+}
+
+// NewTokenEncryption encrypts tokens with algorithm, a key management
+// algorithm such as dir or A256KW, under key, base64 encoded. It returns nil
+// when algorithm is empty.
+func NewTokenEncryption(algorithm, key string) (*TokenEncryption, error) {
+	if algorithm == "" {
+		return nil, nil
+	}
+	size, ok := tokenKeySizes[algorithm]
+	if !ok {
+		algorithms := make([]string, 0, len(tokenKeySizes))
+		for name := range tokenKeySizes {
+			algorithms = append(algorithms, name)
+		}
+		sort.Strings(algorithms)
+		return nil, fmt.Errorf("unsupported token encryption algorithm %q, use %s", algorithm, strings.Join(algorithms, ", "))
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(raw) != size {
+		return nil, fmt.Errorf("token encryption key for %s must be %d bytes, base64 encoded", algorithm, size)
+	}
+
+	e := &TokenEncryption{algorithm: jose.KeyAlgorithm(algorithm), key: raw}
+	e.encrypter, err = jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: e.algorithm, Key: raw},
+		(&jose.EncrypterOptions{}).WithContentType("JWT"))
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// seal encrypts a signed token into a JWE compact serialization
+func (e *TokenEncryption) seal(signed string) (string, error) {
+	if e == nil {
+		return signed, nil
+	}
+	obj, err := e.encrypter.Encrypt([]byte(signed))
+	if err != nil {
+		return "", fmt.Errorf("encrypting token: %w", err)
+	}
+	return obj.CompactSerialize()
+}
+
+// open returns the signed token inside an encrypted one. Tokens that are
+// only signed, such as those issued before encryption was enabled, are
+// returned unchanged; they are still checked for a valid signature.
+func (e *TokenEncryption) open(token string) (string, error) {
+	if e == nil || strings.Count(token, ".") != 4 {
+		return token, nil
+	}
+	obj, err := jose.ParseEncrypted(token)
+	if err != nil {
+		return "", err
+	}
+	if obj.Header.Algorithm != string(e.algorithm) {
+		return "", fmt.Errorf("unexpected token encryption algorithm %q", obj.Header.Algorithm)
+	}
+	signed, err := obj.Decrypt(e.key)
+	if err != nil {
+		return "", err
+	}
+	return string(signed), nil
+}
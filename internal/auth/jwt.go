@@ -9,8 +9,16 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenTTL is how long issued tokens are valid
+const TokenTTL = 24 * time.Hour
+
+// SessionCookie is the cookie the login page stores the token in, for the
+// server-rendered pages
+const SessionCookie = "session"
+
 type JWTService struct {
-	secret []byte
+	secret     []byte
+	encryption *TokenEncryption
 }
 
 func NewJWTService(secret []byte) *JWTService {
@@ -19,24 +27,43 @@ func NewJWTService(secret []byte) *JWTService {
 	}
 }
 
-func (s *JWTService) GenerateToken(userID, username string) (string, error) {
+// WithEncryption makes the service issue tokens encrypted with encryption
+// and accept them; nil leaves tokens signed only
+func (s *JWTService) WithEncryption(encryption *TokenEncryption) *JWTService {
+	s.encryption = encryption
+	return s
+}
+
+// GenerateToken issues a token valid for TokenTTL. sessionVersion is
+// checked against the user's current version by the session validator.
+func (s *JWTService) GenerateToken(userID, username string, roles []string, sessionVersion int) (string, error) {
 	claims := Claims{
-		Subject:  userID,
-		UserID:   userID,
-		Username: username,
-		Type:     "jwt",
+		Subject:        userID,
+		UserID:         userID,
+		Username:       username,
+		Roles:          roles,
+		SessionVersion: sessionVersion,
+		Type:           "jwt",
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secret)
+	signed, err := token.SignedString(s.secret)
+	if err != nil {
+		return "", err
+	}
+	return s.encryption.seal(signed)
 }
 
 func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
+	tokenString, err := s.encryption.open(tokenString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -57,8 +84,10 @@ func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 
 // JWTAuthenticator implements JWT-based authentication
 type JWTAuthenticator struct {
-	secret []byte
-	issuer string
+	secret     []byte
+	issuer     string
+	encryption *TokenEncryption
+	cookie     string
 }
 
 func NewJWTAuthenticator(secret []byte, issuer string) *JWTAuthenticator {
@@ -68,11 +97,36 @@ func NewJWTAuthenticator(secret []byte, issuer string) *JWTAuthenticator {
 	}
 }
 
+// WithEncryption makes the authenticator decrypt tokens encrypted with
+// encryption
+func (a *JWTAuthenticator) WithEncryption(encryption *TokenEncryption) *JWTAuthenticator {
+	a.encryption = encryption
+	return a
+}
+
+// FromCookie makes the authenticator read the token from the named cookie
+// instead of the Authorization header. Browsers send cookies with requests
+// other sites make, so only routes that change nothing should accept them.
+func (a *JWTAuthenticator) FromCookie(name string) *JWTAuthenticator {
+	a.cookie = name
+	return a
+}
+
 func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Claims, error) {
 	tokenString := extractBearerToken(r)
+	if a.cookie != "" {
+		tokenString = ""
+		if cookie, err := r.Cookie(a.cookie); err == nil {
+			tokenString = cookie.Value
+		}
+	}
 	if tokenString == "" {
 		return nil, ErrNoCredentials
 	}
+	tokenString, err := a.encryption.open(tokenString)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
 
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
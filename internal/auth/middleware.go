@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 
+	"exampleserver/pkg/httperr"
 	"exampleserver/pkg/logger"
 )
 
@@ -32,7 +33,7 @@ func (m *Middleware) RequireAuth(next http.Handler) http.Handler {
 		claims, err := m.authenticator.Authenticate(r)
 		if err != nil {
 			m.logger.Error("Authentication failed: %v", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			httperr.Write(w, r, http.StatusUnauthorized, "Missing or invalid credentials")
 			return
 		}
 
@@ -42,6 +43,34 @@ func (m *Middleware) RequireAuth(next http.Handler) http.Handler {
 	})
 }
 
+// OptionalAuth adds the claims of authenticated requests to the context
+// and passes the rest through as anonymous, for pages that show more to
+// signed in users. Invalid credentials are treated as none.
+func (m *Middleware) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := m.authenticator.Authenticate(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireRole allows requests whose claims grant role and answers 403 to
+// the rest. It must run after RequireAuth.
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := GetClaims(r.Context())
+		if !ok || !claims.HasRole(role) {
+			httperr.Writef(w, r, http.StatusForbidden, "The %s role is required", role)
+			return
+		}
+		next(w, r)
+	}
+}
+
 // GetClaims retrieves claims from the request context
 func GetClaims(ctx context.Context) (*Claims, bool) {
 	claims, ok := ctx.Value(ClaimsContextKey).(*Claims)
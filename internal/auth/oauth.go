@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// oauthRequestTimeout bounds each request to a provider
+const oauthRequestTimeout = 10 * time.Second
+
+// OAuthIdentity is the account a user logged in with at an OAuth2
+// provider
+type OAuthIdentity struct {
+	// Subject is the provider's stable ID of the account
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// OAuthProvider runs the authorization code flow of a social login
+// provider and looks up who logged in
+type OAuthProvider struct {
+	Name     string
+	config   oauth2.Config
+	identify func(ctx context.Context, client *http.Client) (OAuthIdentity, error)
+}
+
+// AuthCodeURL is the provider's login page, which redirects back to the
+// callback with a code and state. verifier is the PKCE code verifier that
+// must be passed to Exchange.
+func (p *OAuthProvider) AuthCodeURL(state, verifier string) string {
+	return p.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange trades the code from the callback for an access token and
+// returns the identity it belongs to
+func (p *OAuthProvider) Exchange(ctx context.Context, code, verifier string) (OAuthIdentity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Timeout: oauthRequestTimeout})
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return OAuthIdentity{}, fmt.Errorf("exchanging code: %w", err)
+	}
+	return p.identify(ctx, p.config.Client(ctx, token))
+}
+
+// GitHubProvider logs in with GitHub. redirectURL is the callback
+// registered for the OAuth app.
+func GitHubProvider(clientID, clientSecret, redirectURL string) *OAuthProvider {
+	return &OAuthProvider{
+		Name: "github",
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     endpoints.GitHub,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"read:user", "user:email"},
+		},
+		identify: githubIdentity("https://api.github.com"),
+	}
+}
+
+// githubIdentity identifies a GitHub user by ID, with their primary email
+func githubIdentity(apiURL string) func(ctx context.Context, client *http.Client) (OAuthIdentity, error) {
+	return func(ctx context.Context, client *http.Client) (OAuthIdentity, error) {
+		var user struct {
+			ID int64 `json:"id"`
+		}
+		if err := getJSON(ctx, client, apiURL+"/user", &user); err != nil {
+			return OAuthIdentity{}, err
+		}
+		if user.ID == 0 {
+			return OAuthIdentity{}, fmt.Errorf("GitHub user has no ID")
+		}
+		var emails []struct {
+			Email    string `json:"email"`
+			Primary  bool   `json:"primary"`
+			Verified bool   `json:"verified"`
+		}
+		if err := getJSON(ctx, client, apiURL+"/user/emails", &emails); err != nil {
+			return OAuthIdentity{}, err
+		}
+
+		identity := OAuthIdentity{Subject: strconv.FormatInt(user.ID, 10)}
+		for _, email := range emails {
+			if email.Primary {
+				identity.Email = email.Email
+				identity.EmailVerified = email.Verified
+			}
+		}
+		return identity, nil
+	}
+}
+
+// GoogleProvider logs in with Google. redirectURL is the callback
+// registered for the OAuth client.
+func GoogleProvider(clientID, clientSecret, redirectURL string) *OAuthProvider {
+	return &OAuthProvider{
+		Name: "google",
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     endpoints.Google,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"openid", "email"},
+		},
+		identify: googleIdentity("https://openidconnect.googleapis.com/v1/userinfo"),
+	}
+}
+
+// googleIdentity identifies a Google user by the OpenID Connect subject
+func googleIdentity(userInfoURL string) func(ctx context.Context, client *http.Client) (OAuthIdentity, error) {
+	return func(ctx context.Context, client *http.Client) (OAuthIdentity, error) {
+		var info struct {
+			Subject       string `json:"sub"`
+			Email         string `json:"email"`
+			EmailVerified bool   `json:"email_verified"`
+		}
+		if err := getJSON(ctx, client, userInfoURL, &info); err != nil {
+			return OAuthIdentity{}, err
+		}
+		if info.Subject == "" {
+			return OAuthIdentity{}, fmt.Errorf("userinfo has no subject")
+		}
+		return OAuthIdentity{Subject: info.Subject, Email: info.Email, EmailVerified: info.EmailVerified}, nil
+	}
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
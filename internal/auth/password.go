@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password accepted for an account
+const MinPasswordLength = 8
+
+// Password hashing algorithms
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Argon2Params tunes Argon2id hashing. Memory is in KiB.
+type Argon2Params struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// PasswordHasher hashes passwords with the configured algorithm and checks
+// them against hashes of either algorithm, so existing bcrypt hashes keep
+// working after switching to Argon2id
+type PasswordHasher struct {
+	algorithm string
+	argon2    Argon2Params
+}
+
+// NewPasswordHasher hashes new passwords with algorithm, Bcrypt or Argon2id
+func NewPasswordHasher(algorithm string, params Argon2Params) *PasswordHasher {
+	return &PasswordHasher{algorithm: algorithm, argon2: params}
+}
+
+// Hash returns the hash of password for storage
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.algorithm != Argon2id {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.argon2.Time, h.argon2.Memory, h.argon2.Threads, argon2KeyLength)
+	return encodeArgon2(h.argon2, salt, key), nil
+}
+
+// Check reports whether password matches hash
+func (h *PasswordHasher) Check(hash, password string) bool {
+	if !strings.HasPrefix(hash, "$"+Argon2id+"$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return false
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or
+// weaker parameters than the configured ones, so it should be replaced the
+// next time the password is known
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	if h.algorithm != Argon2id {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost < bcrypt.DefaultCost
+	}
+	params, _, _, err := decodeArgon2(hash)
+	return err != nil || params != h.argon2
+}
+
+// encodeArgon2 formats an Argon2id hash in the PHC string format,
+// $argon2id$v=19$m=65536,t=3,p=4$salt$key
+func encodeArgon2(params Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version,
+		params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return params, nil, nil, fmt.Errorf("not an argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil ||
+		params.Time == 0 || params.Threads == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2 key")
+	}
+	return params, salt, key, nil
+}
+
+// RandomPassword returns a random password suitable for a one-time reset
+func RandomPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
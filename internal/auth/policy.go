@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gorilla/mux"
+)
+
+// TenantHeader names the tenant a request acts for in policy decisions. It
+// can only pick one of the caller's own tenants.
+const TenantHeader = "X-Tenant-ID"
+
+// opaTimeout bounds a decision request to the OPA sidecar
+const opaTimeout = 2 * time.Second
+
+// PolicyInput is what a policy decides on
+type PolicyInput struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Route is the path template the request matched, e.g.
+	// /api/customers/{id}
+	Route  string  `json:"route"`
+	Claims *Claims `json:"claims"`
+	// Tenant is the tenant the request acts for: the one named by
+	// TenantHeader, or the caller's only tenant without the header, and
+	// empty otherwise
+	Tenant string `json:"tenant"`
+}
+
+// Authorizer decides whether a request may proceed. Errors deny the
+// request.
+type Authorizer interface {
+	Authorize(ctx context.Context, input PolicyInput) (bool, error)
+}
+
+// Authorize asks authorizer about every request and answers 403 to the ones
+// it denies, and to requests naming a tenant in TenantHeader that the
+// caller isn't in. It must run after RequireAuth; a nil authorizer allows
+// everything.
+func Authorize(authorizer Authorizer) func(http.Handler) http.Handler {
+	return authorize(authorizer, false)
+}
+
+// AuthorizeSignedIn is Authorize for routes that don't require signing in,
+// after OptionalAuth: it lets anonymous requests through and asks
+// authorizer about the others
+func AuthorizeSignedIn(authorizer Authorizer) func(http.Handler) http.Handler {
+	return authorize(authorizer, true)
+}
+
+func authorize(authorizer Authorizer, anonymous bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if authorizer == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := GetClaims(r.Context())
+			if claims == nil && anonymous {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tenant, ok := requestTenant(r, claims)
+			if !ok {
+				httperr.Write(w, r, http.StatusForbidden, "You are not a member of the tenant in X-Tenant-ID")
+				return
+			}
+			input := PolicyInput{Method: r.Method, Path: r.URL.Path, Claims: claims, Tenant: tenant}
+			if route := mux.CurrentRoute(r); route != nil {
+				input.Route, _ = route.GetPathTemplate()
+			}
+
+			allowed, err := authorizer.Authorize(r.Context(), input)
+			if err != nil {
+				logger.ErrorCtx(r.Context(), "Policy decision failed: %v", err)
+				httperr.Write(w, r, http.StatusServiceUnavailable, "Authorization policy is unavailable")
+				return
+			}
+			if !allowed {
+				httperr.Write(w, r, http.StatusForbidden, "Access denied by policy")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Allowed asks authorizer whether the caller of r may make a request for
+// method on path, matching the route template, as Authorize would ask for a
+// request of its own. Handlers serving several operations in one request,
+// such as GraphQL, check each with it. A nil authorizer allows everything.
+func Allowed(r *http.Request, authorizer Authorizer, method, path, route string) (bool, error) {
+	if authorizer == nil {
+		return true, nil
+	}
+	claims, _ := GetClaims(r.Context())
+	tenant, ok := requestTenant(r, claims)
+	if !ok {
+		return false, nil
+	}
+	return authorizer.Authorize(r.Context(), PolicyInput{Method: method, Path: path, Route: route, Claims: claims, Tenant: tenant})
+}
+
+// requestTenant returns the tenant a request acts for, taken from the
+// claims: TenantHeader can only narrow it to one of the caller's tenants
+func requestTenant(r *http.Request, claims *Claims) (string, bool) {
+	tenant := r.Header.Get(TenantHeader)
+	if claims == nil {
+		return "", tenant == ""
+	}
+	if tenant != "" {
+		return tenant, claims.InTenant(tenant)
+	}
+	if len(claims.Tenants) == 1 {
+		return claims.Tenants[0], true
+	}
+	return "", true
+}
+
+// CasbinAuthorizer decides with embedded Casbin policies. The model's
+// request is either (sub, obj, act) or (sub, dom, obj, act), where sub is
+// the caller's subject or one of its roles, dom the tenant, obj the request
+// path and act the method; a request is allowed when any of its subjects
+// is.
+type CasbinAuthorizer struct {
+	enforcer *casbin.Enforcer
+	domains  bool
+}
+
+// NewCasbinAuthorizer loads the model and policy files
+func NewCasbinAuthorizer(modelPath, policyPath string) (*CasbinAuthorizer, error) {
+	enforcer, err := casbin.NewEnforcer(modelPath, policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading casbin policy: %w", err)
+	}
+	request, ok := enforcer.GetModel()["r"]["r"]
+	if !ok || len(request.Tokens) < 3 || len(request.Tokens) > 4 {
+		return nil, fmt.Errorf("casbin model request must be sub, obj, act or sub, dom, obj, act")
+	}
+	return &CasbinAuthorizer{enforcer: enforcer, domains: len(request.Tokens) == 4}, nil
+}
+
+func (a *CasbinAuthorizer) Authorize(ctx context.Context, input PolicyInput) (bool, error) {
+	if input.Claims == nil {
+		return false, nil
+	}
+	for _, subject := range append([]string{input.Claims.Subject}, input.Claims.Roles...) {
+		request := []interface{}{subject, input.Path, input.Method}
+		if a.domains {
+			request = []interface{}{subject, input.Tenant, input.Path, input.Method}
+		}
+		allowed, err := a.enforcer.Enforce(request...)
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+	return false, nil
+}
+
+// OPAAuthorizer asks an Open Policy Agent sidecar, posting the PolicyInput
+// as the input of a boolean decision such as
+// http://localhost:8181/v1/data/exampleserver/allow
+type OPAAuthorizer struct {
+	url    string
+	client *http.Client
+}
+
+func NewOPAAuthorizer(decisionURL string) *OPAAuthorizer {
+	return &OPAAuthorizer{url: decisionURL, client: &http.Client{Timeout: opaTimeout}}
+}
+
+func (a *OPAAuthorizer) Authorize(ctx context.Context, input PolicyInput) (bool, error) {
+	body, err := json.Marshal(map[string]PolicyInput{"input": input})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("OPA returned %s", resp.Status)
+	}
+
+	// An undefined decision has no result and denies the request
+	var decision struct {
+		Result *bool `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return false, fmt.Errorf("decoding OPA decision: %w", err)
+	}
+	return decision.Result != nil && *decision.Result, nil
+}
@@ -0,0 +1,88 @@
+// Package cache stores encoded responses in memory or Redis
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Cache is a byte cache with per-entry TTLs. Keys are grouped by prefix so
+// related entries can be purged together.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration)
+	// Purge removes every key starting with prefix
+	Purge(ctx context.Context, prefix string)
+}
+
+// Config selects and sizes the cache backend
+type Config struct {
+	Driver   string // memory, redis or none
+	Size     int    // maximum entries for the memory backend
+	RedisURL string
+}
+
+// Open returns the configured cache wrapped with hit and miss counters, or
+// nil when caching is disabled
+func Open(cfg Config) (*Metered, error) {
+	var backend Cache
+	switch cfg.Driver {
+	case "none":
+		return nil, nil
+	case "", "memory":
+		backend = NewMemory(cfg.Size)
+	case "redis":
+		r, err := NewRedis(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		backend = r
+	default:
+		return nil, fmt.Errorf("unknown cache driver %q: must be memory, redis or none", cfg.Driver)
+	}
+	return &Metered{Cache: backend}, nil
+}
+
+// Metered counts hits, misses and purges of the wrapped cache and reports
+// them as a stats collector
+type Metered struct {
+	Cache
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	purges atomic.Uint64
+}
+
+func (m *Metered) Get(ctx context.Context, key string) ([]byte, bool) {
+	value, ok := m.Cache.Get(ctx, key)
+	if ok {
+		m.hits.Add(1)
+	} else {
+		m.misses.Add(1)
+	}
+	return value, ok
+}
+
+func (m *Metered) Purge(ctx context.Context, prefix string) {
+	m.purges.Add(1)
+	m.Cache.Purge(ctx, prefix)
+}
+
+// Collect reports the counters, plus the entry count for backends that
+// know it
+func (m *Metered) Collect(ctx context.Context) (map[string]float64, error) {
+	hits, misses := m.hits.Load(), m.misses.Load()
+	metrics := map[string]float64{
+		"hits":   float64(hits),
+		"misses": float64(misses),
+		"purges": float64(m.purges.Load()),
+	}
+	if total := hits + misses; total > 0 {
+		metrics["hit_ratio"] = float64(hits) / float64(total)
+	}
+	if sized, ok := m.Cache.(interface{ Len() int }); ok {
+		metrics["entries"] = float64(sized.Len())
+	}
+	return metrics, nil
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process LRU cache. Expired entries are dropped when read
+// or when they reach the back of the list.
+type Memory struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func NewMemory(size int) *Memory {
+	if size < 1 {
+		size = 1000
+	}
+	return &Memory{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		m.remove(elem)
+		return nil, false
+	}
+	m.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expires := time.Now().Add(ttl)
+	if elem, ok := m.entries[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		entry.value = value
+		entry.expires = expires
+		m.order.MoveToFront(elem)
+		return
+	}
+
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, value: value, expires: expires})
+	for m.order.Len() > m.size {
+		m.remove(m.order.Back())
+	}
+}
+
+func (m *Memory) Purge(ctx context.Context, prefix string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, elem := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			m.remove(elem)
+		}
+	}
+}
+
+// Len returns the number of entries, including expired ones not yet dropped
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// remove drops an entry. The caller must hold m.mu.
+func (m *Memory) remove(elem *list.Element) {
+	m.order.Remove(elem)
+	delete(m.entries, elem.Value.(*memoryEntry).key)
+}
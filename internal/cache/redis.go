@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a cache shared between server instances
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the server at url, e.g. redis://localhost:6379/0
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	return &Redis{client: redis.NewClient(opts)}, nil
+}
+
+// Get treats errors as misses so an unavailable Redis only costs performance
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool) {
+	value, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	r.client.Set(ctx, key, value, ttl)
+}
+
+func (r *Redis) Purge(ctx context.Context, prefix string) {
+	iter := r.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if len(keys) > 0 {
+		r.client.Del(ctx, keys...)
+	}
+}
+
+// Close releases the connection pool
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,143 @@
+// Package events is the in-process event bus: components publish events by
+// type and the handlers subscribed to matching types run on the worker
+// pool, so publishing never waits for them.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"exampleserver/internal/services"
+	"exampleserver/pkg/logger"
+)
+
+const (
+	handlerRetries = 3
+	handlerTimeout = 30 * time.Second
+)
+
+// Event is a published event. Types are dotted names, such as
+// webhook.github.push.
+type Event struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Source string          `json:"source,omitempty"`
+	Time   time.Time       `json:"time"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Handler processes an event. A failed event is retried, so handlers
+// should be idempotent, using the event ID to ignore repeats.
+type Handler func(ctx context.Context, event Event) error
+
+type subscription struct {
+	pattern string
+	handler Handler
+}
+
+// Bus delivers published events to the subscribed handlers
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions []subscription
+
+	workers *services.WorkerPool
+
+	published atomic.Uint64
+	handled   atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+
+	logger logger.LoggerInterface
+}
+
+func NewBus(workers *services.WorkerPool, logger logger.LoggerInterface) *Bus {
+	return &Bus{workers: workers, logger: logger}
+}
+
+// Subscribe runs handler for every event whose type matches pattern: the
+// type itself, a prefix ending in ".*" such as webhook.github.*, or "*" for
+// every event
+func (b *Bus) Subscribe(pattern string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions = append(b.subscriptions, subscription{pattern: pattern, handler: handler})
+}
+
+// Patterns returns the subscribed patterns, sorted
+func (b *Bus) Patterns() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	patterns := make([]string, 0, len(b.subscriptions))
+	for _, sub := range b.subscriptions {
+		patterns = append(patterns, sub.pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// Publish queues the event for every matching handler. It fails when the
+// event couldn't be queued for every handler, in which case the caller may
+// publish it again.
+func (b *Bus) Publish(event Event) error {
+	b.mu.RLock()
+	var handlers []Handler
+	for _, sub := range b.subscriptions {
+		if matches(sub.pattern, event.Type) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.RUnlock()
+
+	b.published.Add(1)
+	if len(handlers) == 0 {
+		b.logger.Debug("[Events] No handlers for %s event %s", event.Type, event.ID)
+		return nil
+	}
+
+	var queueErr error
+	for _, handler := range handlers {
+		handler := handler
+		err := b.workers.Enqueue(services.Task{
+			Name:    "event " + event.Type + " " + event.ID,
+			Retries: handlerRetries,
+			Timeout: handlerTimeout,
+			Run: func(ctx context.Context) error {
+				if err := handler(ctx, event); err != nil {
+					b.failed.Add(1)
+					return err
+				}
+				b.handled.Add(1)
+				return nil
+			},
+		})
+		if err != nil {
+			b.dropped.Add(1)
+			queueErr = fmt.Errorf("failed to queue %s event %s: %w", event.Type, event.ID, err)
+		}
+	}
+	return queueErr
+}
+
+// Collect reports the event counters for the stats service
+func (b *Bus) Collect(ctx context.Context) (map[string]float64, error) {
+	return map[string]float64{
+		"published": float64(b.published.Load()),
+		"handled":   float64(b.handled.Load()),
+		"failed":    float64(b.failed.Load()),
+		"dropped":   float64(b.dropped.Load()),
+	}, nil
+}
+
+func matches(pattern, eventType string) bool {
+	if pattern == "*" || pattern == eventType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(pattern, "*")
+	return ok && strings.HasSuffix(prefix, ".") && strings.HasPrefix(eventType, prefix)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"exampleserver/internal/stats"
+	"exampleserver/pkg/httperr"
+
+	"github.com/gorilla/mux"
+)
+
+// APIKeySummary is an API key's owner and request totals over the last 30
+// days
+type APIKeySummary struct {
+	KeyID        string     `json:"key_id"`
+	Subject      string     `json:"subject"`
+	Requests     uint64     `json:"requests"`
+	ClientErrors uint64     `json:"client_errors"`
+	ServerErrors uint64     `json:"server_errors"`
+	ErrorRate    float64    `json:"error_rate"`
+	LastUsed     *time.Time `json:"last_used,omitempty"`
+}
+
+// APIKeysResponse lists the API keys, busiest first
+type APIKeysResponse struct {
+	Keys []APIKeySummary `json:"keys"`
+}
+
+// APIKeyUsage is an API key's owner and daily usage over the last 30 days
+type APIKeyUsage struct {
+	Subject string `json:"subject"`
+	stats.KeyUsage
+}
+
+// APIKeys reports the usage of the accepted API keys
+type APIKeys struct {
+	keys  map[string]string // key ID -> subject
+	usage *stats.KeyUsageTracker
+}
+
+// NewAPIKeys reports on keys, the subjects of the API keys by key ID
+func NewAPIKeys(keys map[string]string, usage *stats.KeyUsageTracker) *APIKeys {
+	return &APIKeys{keys: keys, usage: usage}
+}
+
+// List returns every API key with its totals, so the owners of busy or
+// failing keys can be identified
+func (a *APIKeys) List(w http.ResponseWriter, r *http.Request) {
+	keys := make([]APIKeySummary, 0, len(a.keys))
+	for keyID, subject := range a.keys {
+		usage := a.usage.Usage(keyID)
+		keys = append(keys, APIKeySummary{
+			KeyID:        keyID,
+			Subject:      subject,
+			Requests:     usage.Requests,
+			ClientErrors: usage.ClientErrors,
+			ServerErrors: usage.ServerErrors,
+			ErrorRate:    usage.ErrorRate,
+			LastUsed:     usage.LastUsed,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Requests != keys[j].Requests {
+			return keys[i].Requests > keys[j].Requests
+		}
+		if keys[i].Subject != keys[j].Subject {
+			return keys[i].Subject < keys[j].Subject
+		}
+		return keys[i].KeyID < keys[j].KeyID
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(APIKeysResponse{Keys: keys})
+}
+
+// Usage returns the daily rollups of one API key
+func (a *APIKeys) Usage(w http.ResponseWriter, r *http.Request) {
+	keyID := mux.Vars(r)["id"]
+	subject, ok := a.keys[keyID]
+	if !ok {
+		httperr.Write(w, r, http.StatusNotFound, "API key not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(APIKeyUsage{Subject: subject, KeyUsage: a.usage.Usage(keyID)})
+}
@@ -2,56 +2,190 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"exampleserver/internal/auth"
+	"exampleserver/internal/stats"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+)
+
+var (
+	loginsTotal  = stats.NewCounter("logins")
+	loginsFailed = stats.NewCounter("logins_failed")
 )
 
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// RememberMe also issues a device token, exchanged for access tokens
+	// with POST /api/login/device once they expire
+	RememberMe bool `json:"remember_me,omitempty"`
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token       string `json:"token"`
+	DeviceToken string `json:"device_token,omitempty"`
+}
+
+// PasswordChangeRequest is the request body for setting a new password
+type PasswordChangeRequest struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password"`
 }
 
 type Auth struct {
 	jwtService *auth.JWTService
+	users      store.UserRepository
+	passwords  *auth.PasswordHasher
+	devices    *Devices
 }
 
-func NewAuth(jwtService *auth.JWTService) *Auth {
+func NewAuth(jwtService *auth.JWTService, users store.UserRepository, passwords *auth.PasswordHasher, devices *Devices) *Auth {
 	return &Auth{
 		jwtService: jwtService,
+		users:      users,
+		passwords:  passwords,
+		devices:    devices,
 	}
 }
 
 func (a *Auth) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-
-	// TODO: Implement actual authentication logic here
-	// For now, we'll just check if username and password are not empty
 	if req.Username == "" || req.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		loginsFailed.Inc()
+		httperr.Write(w, r, http.StatusBadRequest, "Username and password are required")
 		return
 	}
 
-	// In a real application, you would validate credentials here
-	// For now, we'll just generate a token with the username
-	token, err := a.jwtService.GenerateToken("user-123", req.Username)
+	user, ok := a.authenticate(w, r, req.Username, req.Password)
+	if !ok {
+		return
+	}
+	if user.MustResetPassword {
+		loginsFailed.Inc()
+		httperr.Write(w, r, http.StatusForbidden, "Password reset required. Set a new password with POST /api/password")
+		return
+	}
+	user = a.rehash(r, user, req.Password)
+
+	token, err := a.jwtService.GenerateToken(user.ID, user.Username, user.Roles, user.SessionVersion)
 	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		httperr.Write(w, r, http.StatusInternalServerError, "Error generating token")
 		return
 	}
 
 	response := LoginResponse{
 		Token: token,
 	}
+	if req.RememberMe {
+		if response.DeviceToken, err = a.devices.remember(r, user); err != nil {
+			logger.ErrorCtx(r.Context(), "Device store error: %v", err)
+			httperr.Write(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+	}
+
+	loginsTotal.Inc()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// ChangePassword sets a new password for a user who knows the current one.
+// After a forced reset nobody does, and the new password is chosen on the
+// page of the reset link instead. Existing sessions are revoked.
+func (a *Auth) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req PasswordChangeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.NewPassword) < auth.MinPasswordLength {
+		httperr.Write(w, r, http.StatusBadRequest, "New password is too short")
+		return
+	}
+
+	user, ok := a.authenticate(w, r, req.Username, req.Password)
+	if !ok {
+		return
+	}
+	hash, err := a.passwords.Hash(req.NewPassword)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Password hashing error: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	user.PasswordHash = hash
+	user.MustResetPassword = false
+	user.SessionVersion++
+	if _, err := a.users.Update(r.Context(), user); err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate checks a username and password, writing the error response
+// and returning false if they don't belong to an enabled user
+func (a *Auth) authenticate(w http.ResponseWriter, r *http.Request, username, password string) (store.User, bool) {
+	user, status, message, err := a.verify(r, username, password)
+	if err != nil {
+		writeUserError(w, r, err)
+		return store.User{}, false
+	}
+	if status != 0 {
+		httperr.Write(w, r, status, message)
+		return store.User{}, false
+	}
+	return user, true
+}
+
+// verify checks a username and password, returning the status and message
+// to refuse them with if they don't belong to an enabled user, and an error
+// if the user store failed
+func (a *Auth) verify(r *http.Request, username, password string) (store.User, int, string, error) {
+	user, err := a.users.GetByUsername(r.Context(), username)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return store.User{}, 0, "", err
+	}
+	if err != nil || !a.passwords.Check(user.PasswordHash, password) {
+		loginsFailed.Inc()
+		return store.User{}, http.StatusUnauthorized, "Invalid username or password", nil
+	}
+	if user.Disabled {
+		loginsFailed.Inc()
+		return store.User{}, http.StatusForbidden, "Account is disabled", nil
+	}
+	return user, 0, "", nil
+}
+
+// rehash replaces a password hash made with another algorithm or weaker
+// parameters than configured, now that the password is known. Only the hash
+// is written, and only if it hasn't changed since the login read it, so a
+// concurrent password change or admin update isn't overwritten. Failing to
+// does not fail the login; the hash is replaced on a later one.
+func (a *Auth) rehash(r *http.Request, user store.User, password string) store.User {
+	if !a.passwords.NeedsRehash(user.PasswordHash) {
+		return user
+	}
+	hash, err := a.passwords.Hash(password)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Password hashing error: %v", err)
+		return user
+	}
+	if err := a.users.ReplacePasswordHash(r.Context(), user.ID, user.PasswordHash, hash); err != nil {
+		logger.WarnCtx(r.Context(), "Failed to upgrade password hash of user %s: %v", user.Username, err)
+		return user
+	}
+	user.PasswordHash = hash
+	return user
+}
@@ -1,31 +1,92 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"exampleserver/internal/auth"
+	"exampleserver/internal/queue"
+	"exampleserver/internal/store"
+	"exampleserver/internal/tasks"
+	"exampleserver/pkg/httperr"
 	"exampleserver/pkg/logger"
+	"exampleserver/pkg/render"
+
+	"github.com/gorilla/mux"
 )
 
-type Customer struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+type CustomersResponse struct {
+	XMLName   xml.Name         `json:"-" xml:"customers"`
+	Customers []store.Customer `json:"customers" xml:"customer"`
 }
 
-type CustomersResponse struct {
-	Customers []Customer `json:"customers"`
+// HistoryResponse lists a customer's changes, oldest first
+type HistoryResponse struct {
+	XMLName xml.Name       `json:"-" xml:"changes"`
+	Changes []store.Change `json:"changes" xml:"change"`
 }
 
-type Customers struct{}
+// SearchResponse lists customers matching a search, best first
+type SearchResponse struct {
+	XMLName xml.Name             `json:"-" xml:"search"`
+	Query   string               `json:"query" xml:"query,attr"`
+	Results []store.SearchResult `json:"results" xml:"result"`
+}
 
-func NewCustomers() *Customers {
-	return &Customers{}
+// CustomerRequest is the request body for creating or replacing a customer
+type CustomerRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// CustomerPatch is the request body for partially updating a customer
+type CustomerPatch struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
+}
+
+// CustomerImportRequest is the request body for a bulk import
+type CustomerImportRequest struct {
+	Customers []CustomerRequest `json:"customers"`
+}
+
+// CustomerImportResult is the result of a finished import task
+type CustomerImportResult struct {
+	Created int                   `json:"created"`
+	Failed  []CustomerImportError `json:"failed"`
+}
+
+// CustomerImportError explains why a row of an import was skipped
+type CustomerImportError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// CustomerImportTask is the task type of bulk imports
+const CustomerImportTask = "customer-import"
+
+// maxImportRows bounds the size of a single import
+const maxImportRows = 10000
+
+// Customers serves the customer endpoints. Writes record their domain
+// events in the store's outbox, which the outbox relay delivers.
+type Customers struct {
+	repo  store.CustomerRepository
+	tasks *tasks.Tracker
+}
+
+func NewCustomers(repo store.CustomerRepository, tracker *tasks.Tracker) *Customers {
+	return &Customers{repo: repo, tasks: tracker}
 }
 
 func (c *Customers) List(w http.ResponseWriter, r *http.Request) {
-	logger.WithFields(map[string]interface{}{
+	logger.Ctx(r.Context()).WithFields(map[string]interface{}{
 		"handler": "customers",
 		"method":  "List",
 	}).Debug("Listing customers")
@@ -38,16 +99,441 @@ func (c *Customers) List(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("No claims found in request context")
 	}
 
-	// TODO: Implement actual customer fetching logic
-	customers := []Customer{
-		{ID: "1", Name: "John Doe"},
-		{ID: "2", Name: "Jane Smith"},
+	// Without a limit every customer is listed
+	limit, offset := 0, 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid limit. Must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid offset. Must be zero or more")
+			return
+		}
+		offset = n
+	}
+
+	customers, err := c.repo.List(r.Context())
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	total := len(customers)
+	page := customers[min(offset, total):]
+	if limit > 0 && len(page) > limit {
+		page = page[:limit]
 	}
 
 	response := CustomersResponse{
-		Customers: customers,
+		Customers: page,
+	}
+
+	writeWithETag(w, r, http.StatusOK, render.WithLinks(response, customersDocument(r, page, total, limit, offset)), "")
+}
+
+// customersDocument describes a page of customers for the response
+// envelopes, with links to the other pages when the list is paged
+func customersDocument(r *http.Request, page []store.Customer, total, limit, offset int) render.Document {
+	doc := render.Document{
+		Type:       "customers",
+		Collection: make([]render.Resource, len(page)),
+		Links:      map[string]string{"self": r.URL.RequestURI()},
+		Meta:       map[string]interface{}{"total": total},
+	}
+	for i, customer := range page {
+		doc.Collection[i] = customerResource(customer)
+	}
+	if limit == 0 {
+		return doc
+	}
+
+	pageLink := func(offset int) string {
+		query := r.URL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return r.URL.Path + "?" + query.Encode()
+	}
+	doc.Links["first"] = pageLink(0)
+	doc.Links["last"] = pageLink(max(total-1, 0) / limit * limit)
+	if offset > 0 {
+		doc.Links["prev"] = pageLink(max(offset-limit, 0))
+	}
+	if offset+limit < total {
+		doc.Links["next"] = pageLink(offset + limit)
+	}
+	doc.Meta["limit"] = limit
+	doc.Meta["offset"] = offset
+	return doc
+}
+
+// customerResource describes a customer for the response envelopes
+func customerResource(customer store.Customer) render.Resource {
+	self := "/api/customers/" + customer.ID
+	return render.Resource{
+		Type:       "customers",
+		ID:         customer.ID,
+		Attributes: customer,
+		Links:      map[string]string{"self": self},
+		Related:    map[string]string{"history": self + "/history"},
+	}
+}
+
+// Search returns customers ranked by how well they match the q parameter
+func (c *Customers) Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		httperr.Write(w, r, http.StatusBadRequest, "Query parameter q is required")
+		return
+	}
+
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid limit. Must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	results, err := c.repo.Search(r.Context(), query, limit)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	render.Write(w, r, http.StatusOK, SearchResponse{
+		Query:   query,
+		Results: results,
+	})
+}
+
+// Get returns a single customer
+func (c *Customers) Get(w http.ResponseWriter, r *http.Request) {
+	customer, err := c.repo.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	writeCustomer(w, r, http.StatusOK, customer)
+}
+
+// Create adds a new customer
+func (c *Customers) Create(w http.ResponseWriter, r *http.Request) {
+	var req CustomerRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if msg := validateCustomer(req.Name, req.Email); msg != "" {
+		httperr.Write(w, r, http.StatusBadRequest, msg)
+		return
+	}
+
+	customer, err := c.repo.Create(withActor(r), store.Customer{
+		Name:  strings.TrimSpace(req.Name),
+		Email: strings.TrimSpace(req.Email),
+	})
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/customers/"+customer.ID)
+	writeCustomer(w, r, http.StatusCreated, customer)
+}
+
+// CreateMessage creates a customer from a queue message with the body
+// Create takes. Messages that fail validation or conflict with an existing
+// email are dead-lettered without retrying.
+func (c *Customers) CreateMessage(ctx context.Context, msg queue.Message) error {
+	var req CustomerRequest
+	if err := json.Unmarshal(msg.Body, &req); err != nil {
+		return queue.Permanent(fmt.Errorf("invalid message body: %w", err))
+	}
+	if msg := validateCustomer(req.Name, req.Email); msg != "" {
+		return queue.Permanent(errors.New(msg))
+	}
+
+	_, err := c.repo.Create(store.WithActor(ctx, "queue:"+msg.Subject), store.Customer{
+		Name:  strings.TrimSpace(req.Name),
+		Email: strings.TrimSpace(req.Email),
+	})
+	if errors.Is(err, store.ErrConflict) {
+		return queue.Permanent(err)
+	}
+	return err
+}
+
+// Import creates customers in bulk as a background task. Rows that fail
+// validation or conflict with an existing email are reported in the task
+// result rather than failing the import.
+func (c *Customers) Import(w http.ResponseWriter, r *http.Request) {
+	var req CustomerImportRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if len(req.Customers) == 0 || len(req.Customers) > maxImportRows {
+		httperr.Writef(w, r, http.StatusBadRequest, "Import between 1 and %d customers", maxImportRows)
+		return
+	}
+
+	actor := caller(r)
+	task, err := c.tasks.Submit(CustomerImportTask, actor, 0, func(ctx context.Context, progress *tasks.Progress) (interface{}, error) {
+		ctx = store.WithActor(ctx, actor)
+		result := CustomerImportResult{Failed: []CustomerImportError{}}
+		for i, row := range req.Customers {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if msg := validateCustomer(row.Name, row.Email); msg != "" {
+				result.Failed = append(result.Failed, CustomerImportError{Index: i, Error: msg})
+			} else if _, err := c.repo.Create(ctx, store.Customer{
+				Name:  strings.TrimSpace(row.Name),
+				Email: strings.TrimSpace(row.Email),
+			}); errors.Is(err, store.ErrConflict) {
+				result.Failed = append(result.Failed, CustomerImportError{Index: i, Error: "A customer with this email already exists"})
+			} else if err != nil {
+				return nil, err
+			} else {
+				result.Created++
+			}
+			progress.Set(i+1, len(req.Customers))
+		}
+		progress.SetLocation("/api/customers")
+		return result, nil
+	})
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Failed to queue customer import: %v", err)
+		httperr.Write(w, r, http.StatusServiceUnavailable, "Too many background tasks, try again later")
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeAccepted(w, task)
+}
+
+// Update replaces a customer
+func (c *Customers) Update(w http.ResponseWriter, r *http.Request) {
+	var req CustomerRequest
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := validateCustomer(req.Name, req.Email); msg != "" {
+		httperr.Write(w, r, http.StatusBadRequest, msg)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	version, ok := c.checkPrecondition(w, r, id, nil)
+	if !ok {
+		return
+	}
+
+	c.save(w, r, store.Customer{
+		ID:      id,
+		Name:    strings.TrimSpace(req.Name),
+		Email:   strings.TrimSpace(req.Email),
+		Version: version,
+	})
+}
+
+// Patch updates the provided fields of a customer
+func (c *Customers) Patch(w http.ResponseWriter, r *http.Request) {
+	var req CustomerPatch
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var existing store.Customer
+	version, ok := c.checkPrecondition(w, r, mux.Vars(r)["id"], &existing)
+	if !ok {
+		return
+	}
+	name, email := existing.Name, existing.Email
+	if req.Name != nil {
+		name = *req.Name
+	}
+	if req.Email != nil {
+		email = *req.Email
+	}
+	if msg := validateCustomer(name, email); msg != "" {
+		httperr.Write(w, r, http.StatusBadRequest, msg)
+		return
+	}
+
+	existing.Name = strings.TrimSpace(name)
+	existing.Email = strings.TrimSpace(email)
+	existing.Version = version
+	c.save(w, r, existing)
+}
+
+// Delete removes a customer
+func (c *Customers) Delete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	version, ok := c.checkPrecondition(w, r, id, nil)
+	if !ok {
+		return
+	}
+
+	if err := c.repo.Delete(withActor(r), id, version); err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Restore undoes the deletion of a customer
+func (c *Customers) Restore(w http.ResponseWriter, r *http.Request) {
+	customer, err := c.repo.Restore(withActor(r), mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	writeCustomer(w, r, http.StatusOK, customer)
+}
+
+// History returns the changes made to a customer, including deleted ones
+func (c *Customers) History(w http.ResponseWriter, r *http.Request) {
+	changes, err := c.repo.History(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	render.Write(w, r, http.StatusOK, HistoryResponse{
+		Changes: changes,
+	})
+}
+
+// save stores an updated customer and writes the result
+func (c *Customers) save(w http.ResponseWriter, r *http.Request, customer store.Customer) {
+	customer, err := c.repo.Update(withActor(r), customer)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	writeCustomer(w, r, http.StatusOK, customer)
+}
+
+// checkPrecondition loads the customer and enforces If-Match, answering 412
+// when the client's copy is stale. It writes the error response and returns
+// false if the request must not proceed. The customer is stored in current
+// when non-nil. The version returned is the one the write must be
+// conditional on, so a change made since this check fails it too: that of
+// the customer matching If-Match, or 0 without a specific ETag.
+func (c *Customers) checkPrecondition(w http.ResponseWriter, r *http.Request, id string, current *store.Customer) (int, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" && current == nil {
+		return 0, true
+	}
+
+	customer, err := c.repo.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return 0, false
+	}
+	if ifMatch != "" && !etagMatches(ifMatch, customerETag(customer), true) {
+		httperr.Write(w, r, http.StatusPreconditionFailed, "Customer has been modified since it was retrieved")
+		return 0, false
+	}
+	if current != nil {
+		*current = customer
+	}
+	if ifMatch == "" || strings.TrimSpace(ifMatch) == "*" {
+		return 0, true
+	}
+	return customer.Version, true
+}
+
+func validateCustomer(name, email string) string {
+	if strings.TrimSpace(name) == "" {
+		return "Name is required"
+	}
+	if len(name) > 200 {
+		return "Name must be at most 200 characters"
+	}
+	if email = strings.TrimSpace(email); email != "" && !validEmail(email) {
+		return "Invalid email address"
+	}
+	return ""
+}
+
+// validEmail does a loose sanity check of an email address
+func validEmail(email string) bool {
+	at := strings.Index(email, "@")
+	return at >= 1 && at < len(email)-1 && !strings.ContainsAny(email, " \r\n")
+}
+
+func writeCustomer(w http.ResponseWriter, r *http.Request, status int, customer store.Customer) {
+	writeWithETag(w, r, status, customerBody(customer), customerETag(customer))
+}
+
+// customerETag is the weak ETag of the customer's current version, so a tag
+// read in one format can be sent with If-Match in another. If-Match compares
+// it weakly, which is enough as the write is conditional on the version.
+func customerETag(customer store.Customer) string {
+	return versionETag(customer.ID, customer.Version)
+}
+
+// customerBody is the response body of a single customer
+func customerBody(customer store.Customer) render.Hypermedia {
+	resource := customerResource(customer)
+	return render.WithLinks(customer, render.Document{Resource: &resource})
+}
+
+// withActor returns the request context carrying the authenticated caller
+// for the customer's change history
+func withActor(r *http.Request) context.Context {
+	actor := caller(r)
+	if actor == "" {
+		return r.Context()
+	}
+	return store.WithActor(r.Context(), actor)
+}
+
+// writeStoreError maps repository errors to HTTP responses
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		httperr.Write(w, r, http.StatusNotFound, "Customer not found")
+	case errors.Is(err, store.ErrConflict):
+		httperr.Write(w, r, http.StatusConflict, "A customer with this email already exists")
+	case errors.Is(err, store.ErrModified):
+		httperr.Write(w, r, http.StatusPreconditionFailed, "Customer has been modified since it was retrieved")
+	default:
+		logger.ErrorCtx(r.Context(), "Customer store error: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// decodeJSON decodes a request body, rejecting unknown fields
+func decodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// decodeBody reads a request body in JSON, MessagePack or, for types with
+// a protobuf schema, protobuf, answering with a problem when it can't
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := render.Decode(r, v)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, render.ErrUnsupportedMediaType):
+		httperr.Write(w, r, http.StatusUnsupportedMediaType, "Unsupported request body media type")
+	default:
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+	}
+	return false
 }
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+	"exampleserver/pkg/render"
+
+	"github.com/gorilla/mux"
+)
+
+// maxDeviceName bounds the User-Agent stored as a device's name
+const maxDeviceName = 200
+
+// DeviceLoginRequest exchanges a device token for an access token
+type DeviceLoginRequest struct {
+	DeviceToken string `json:"device_token"`
+}
+
+// DevicesResponse lists the remembered devices of the caller
+type DevicesResponse struct {
+	XMLName xml.Name       `json:"-" xml:"devices"`
+	Devices []store.Device `json:"devices" xml:"device"`
+}
+
+// Devices issues remembered-device tokens at login, exchanges them for
+// access tokens and lets users list and revoke their devices
+type Devices struct {
+	jwtService *auth.JWTService
+	users      store.UserRepository
+	repo       store.DeviceRepository
+	ttl        time.Duration
+}
+
+// NewDevices remembers devices for ttl after login
+func NewDevices(jwtService *auth.JWTService, users store.UserRepository, repo store.DeviceRepository, ttl time.Duration) *Devices {
+	return &Devices{jwtService: jwtService, users: users, repo: repo, ttl: ttl}
+}
+
+// remember stores a new device of user for the login request and returns
+// its token
+func (d *Devices) remember(r *http.Request, user store.User) (string, error) {
+	token, hash, err := auth.NewDeviceToken()
+	if err != nil {
+		return "", err
+	}
+	name := r.UserAgent()
+	if len(name) > maxDeviceName {
+		name = name[:maxDeviceName]
+	}
+	_, err = d.repo.Create(r.Context(), store.Device{
+		UserID:         user.ID,
+		Name:           name,
+		IP:             remoteIP(r),
+		TokenHash:      hash,
+		SessionVersion: user.SessionVersion,
+		ExpiresAt:      time.Now().Add(d.ttl),
+	})
+	return token, err
+}
+
+// Login issues an access token for a device token from a login with
+// remember_me set. Tokens of expired devices, and of users who have since
+// been disabled, had their sessions revoked or must reset their password,
+// are rejected and the device is forgotten.
+func (d *Devices) Login(w http.ResponseWriter, r *http.Request) {
+	var req DeviceLoginRequest
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.DeviceToken == "" {
+		httperr.Write(w, r, http.StatusBadRequest, "device_token is required")
+		return
+	}
+
+	device, err := d.repo.GetByTokenHash(r.Context(), auth.HashDeviceToken(req.DeviceToken))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeDeviceError(w, r, err)
+		return
+	}
+	if err != nil {
+		loginsFailed.Inc()
+		httperr.Write(w, r, http.StatusUnauthorized, "Invalid or expired device token")
+		return
+	}
+	user, err := d.users.Get(r.Context(), device.UserID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeDeviceError(w, r, err)
+		return
+	}
+	if err != nil || user.Disabled || user.MustResetPassword ||
+		user.SessionVersion != device.SessionVersion || time.Now().After(device.ExpiresAt) {
+		if err := d.repo.Delete(r.Context(), device.UserID, device.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			logger.ErrorCtx(r.Context(), "Device store error: %v", err)
+		}
+		loginsFailed.Inc()
+		httperr.Write(w, r, http.StatusUnauthorized, "Invalid or expired device token")
+		return
+	}
+
+	token, err := d.jwtService.GenerateToken(user.ID, user.Username, user.Roles, user.SessionVersion)
+	if err != nil {
+		httperr.Write(w, r, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+	if err := d.repo.Touch(r.Context(), device.ID, remoteIP(r), time.Now()); err != nil {
+		logger.WarnCtx(r.Context(), "Failed to record use of device %s: %v", device.ID, err)
+	}
+
+	loginsTotal.Inc()
+	render.Write(w, r, http.StatusOK, LoginResponse{Token: token})
+}
+
+// List returns the caller's remembered devices
+func (d *Devices) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerUserID(w, r)
+	if !ok {
+		return
+	}
+	devices, err := d.repo.ListByUser(r.Context(), userID)
+	if err != nil {
+		writeDeviceError(w, r, err)
+		return
+	}
+	render.Write(w, r, http.StatusOK, DevicesResponse{Devices: devices})
+}
+
+// Delete forgets one of the caller's devices, so its token no longer works
+func (d *Devices) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := d.repo.Delete(r.Context(), userID, mux.Vars(r)["id"]); err != nil {
+		writeDeviceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// callerUserID returns the user the request is authenticated as, writing a
+// 403 for credentials that don't belong to a user account, such as API keys
+func callerUserID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	claims, ok := auth.GetClaims(r.Context())
+	if !ok || claims.UserID == "" || claims.Type == "api-key" {
+		httperr.Write(w, r, http.StatusForbidden, "Only user accounts have devices")
+		return "", false
+	}
+	return claims.UserID, true
+}
+
+// remoteIP returns the address of the client without its port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeDeviceError maps device repository errors to HTTP responses
+func writeDeviceError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		httperr.Write(w, r, http.StatusNotFound, "Device not found")
+		return
+	}
+	logger.ErrorCtx(r.Context(), "Device store error: %v", err)
+	httperr.Write(w, r, http.StatusInternalServerError, "Internal server error")
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// DrainStatus reports the progress of draining the server
+type DrainStatus struct {
+	Draining bool `json:"draining"`
+	// InFlight counts requests still being served, excluding this one
+	InFlight int64 `json:"in_flight"`
+	// OpenConnections counts client connections not yet closed
+	OpenConnections int `json:"open_connections"`
+}
+
+// Drainer takes the server out of rotation ahead of a shutdown
+type Drainer interface {
+	Drain() DrainStatus
+	Resume() DrainStatus
+	DrainStatus() DrainStatus
+}
+
+type Drain struct {
+	drainer Drainer
+}
+
+func NewDrain(drainer Drainer) *Drain {
+	return &Drain{
+		drainer: drainer,
+	}
+}
+
+// Start fails the readiness probe and stops keeping connections alive, so
+// the load balancer stops routing here while in-flight requests finish
+func (d *Drain) Start(w http.ResponseWriter, r *http.Request) {
+	writeDrainStatus(w, d.drainer.Drain())
+}
+
+// Status reports how many requests and connections remain
+func (d *Drain) Status(w http.ResponseWriter, r *http.Request) {
+	writeDrainStatus(w, d.drainer.DrainStatus())
+}
+
+// Stop cancels a drain, putting the server back into rotation
+func (d *Drain) Stop(w http.ResponseWriter, r *http.Request) {
+	writeDrainStatus(w, d.drainer.Resume())
+}
+
+func writeDrainStatus(w http.ResponseWriter, status DrainStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
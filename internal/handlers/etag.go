@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"exampleserver/pkg/render"
+)
+
+// writeWithETag writes v in the media type negotiated for r with etag,
+// answering 304 when the client's If-None-Match already matches. An empty
+// etag is a strong one computed from the encoding, so each representation
+// has its own; resources with a version pass a weak one made from it, see
+// versionETag, to have the same ETag in every format.
+func writeWithETag(w http.ResponseWriter, r *http.Request, status int, v interface{}, etag string) {
+	body, enc, err := render.Marshal(r, v)
+	if !render.WriteError(w, r, err) {
+		return
+	}
+	if etag == "" {
+		etag = computeETag(body)
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Accept")
+	if status == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		etagMatches(r.Header.Get("If-None-Match"), etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", enc.MediaType())
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// versionETag is the ETag of version of the resource id, the same whatever
+// format the resource is encoded in. It is weak, as the representations
+// differ byte for byte.
+func versionETag(id string, version int) string {
+	return "W/" + computeETag([]byte(id+":"+strconv.Itoa(version)))
+}
+
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether header, an If-Match or If-None-Match value,
+// matches etag, by weak comparison or by strong comparison, which weak tags
+// never match
+func etagMatches(header, etag string, weak bool) bool {
+	opaque := strings.TrimPrefix(etag, "W/")
+	if !weak && opaque != etag {
+		return strings.TrimSpace(header) == "*"
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == opaque {
+			return true
+		}
+	}
+	return false
+}
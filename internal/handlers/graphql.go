@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+const graphQLSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	customers: [Customer!]!
+	customer(id: ID!): Customer
+	users: [User!]!
+	user(id: ID!): User
+}
+
+type Mutation {
+	createCustomer(input: CustomerInput!): Customer!
+	updateCustomer(id: ID!, input: CustomerInput!): Customer!
+	deleteCustomer(id: ID!): Boolean!
+}
+
+input CustomerInput {
+	name: String!
+	email: String
+}
+
+type Customer {
+	id: ID!
+	name: String!
+	email: String
+	createdAt: String!
+	updatedAt: String!
+}
+
+type User {
+	id: ID!
+	username: String!
+	email: String
+	roles: [String!]!
+	tenants: [String!]!
+	disabled: Boolean!
+	createdAt: String!
+	updatedAt: String!
+}
+`
+
+// GraphQLRequest is the request body for a GraphQL query
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLResponse is the result of a GraphQL query
+type GraphQLResponse struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []interface{}   `json:"errors,omitempty"`
+}
+
+// GraphQL serves customer queries and mutations, and user queries, from the
+// same repositories as the REST endpoints. Each field is checked like the
+// REST request it stands for: by the authorization policy, and for users by
+// the admin role.
+type GraphQL struct {
+	schema *graphql.Schema
+}
+
+func NewGraphQL(repo store.CustomerRepository, users store.UserRepository, authorizer auth.Authorizer) *GraphQL {
+	resolver := &graphQLResolver{repo: repo, users: users, authorizer: authorizer}
+	return &GraphQL{
+		schema: graphql.MustParseSchema(graphQLSchema, resolver),
+	}
+}
+
+// graphQLRequestKey holds the HTTP request in the context of resolvers
+type graphQLRequestKey struct{}
+
+// Query executes a GraphQL request
+func (g *GraphQL) Query(w http.ResponseWriter, r *http.Request) {
+	var req GraphQLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Query == "" {
+		httperr.Write(w, r, http.StatusBadRequest, "Request body must be a JSON object with a query")
+		return
+	}
+
+	ctx := context.WithValue(withActor(r), graphQLRequestKey{}, r)
+	response := g.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+type graphQLResolver struct {
+	repo       store.CustomerRepository
+	users      store.UserRepository
+	authorizer auth.Authorizer
+}
+
+// allow checks a field like the REST request for method on route would be:
+// the caller must have role, unless it is empty, and the policy must allow
+// the request
+func (r *graphQLResolver) allow(ctx context.Context, role, method, route, id string) error {
+	req, _ := ctx.Value(graphQLRequestKey{}).(*http.Request)
+	if req == nil {
+		return errors.New("Access denied by policy")
+	}
+	if role != "" {
+		if claims, ok := auth.GetClaims(ctx); !ok || !claims.HasRole(role) {
+			return fmt.Errorf("The %s role is required", role)
+		}
+	}
+	allowed, err := auth.Allowed(req, r.authorizer, method, strings.Replace(route, "{id}", id, 1), route)
+	if err != nil {
+		logger.ErrorCtx(ctx, "Policy decision failed: %v", err)
+		return errors.New("Authorization policy is unavailable")
+	}
+	if !allowed {
+		return errors.New("Access denied by policy")
+	}
+	return nil
+}
+
+type customerResolver struct {
+	customer store.Customer
+}
+
+func (c *customerResolver) ID() graphql.ID {
+	return graphql.ID(c.customer.ID)
+}
+
+func (c *customerResolver) Name() string {
+	return c.customer.Name
+}
+
+func (c *customerResolver) Email() *string {
+	if c.customer.Email == "" {
+		return nil
+	}
+	return &c.customer.Email
+}
+
+func (c *customerResolver) CreatedAt() string {
+	return c.customer.CreatedAt.Format(time.RFC3339Nano)
+}
+
+func (c *customerResolver) UpdatedAt() string {
+	return c.customer.UpdatedAt.Format(time.RFC3339Nano)
+}
+
+type customerInput struct {
+	Name  string
+	Email *string
+}
+
+// customer returns the validated, trimmed customer described by the input
+func (in customerInput) customer(id string) (store.Customer, error) {
+	var email string
+	if in.Email != nil {
+		email = *in.Email
+	}
+	if msg := validateCustomer(in.Name, email); msg != "" {
+		return store.Customer{}, errors.New(msg)
+	}
+	return store.Customer{
+		ID:    id,
+		Name:  strings.TrimSpace(in.Name),
+		Email: strings.TrimSpace(email),
+	}, nil
+}
+
+func (r *graphQLResolver) Customers(ctx context.Context) ([]*customerResolver, error) {
+	if err := r.allow(ctx, "", http.MethodGet, "/api/customers", ""); err != nil {
+		return nil, err
+	}
+	customers, err := r.repo.List(ctx)
+	if err != nil {
+		return nil, graphQLStoreError(ctx, err)
+	}
+	resolvers := make([]*customerResolver, len(customers))
+	for i, customer := range customers {
+		resolvers[i] = &customerResolver{customer: customer}
+	}
+	return resolvers, nil
+}
+
+func (r *graphQLResolver) Customer(ctx context.Context, args struct{ ID graphql.ID }) (*customerResolver, error) {
+	if err := r.allow(ctx, "", http.MethodGet, "/api/customers/{id}", string(args.ID)); err != nil {
+		return nil, err
+	}
+	customer, err := r.repo.Get(ctx, string(args.ID))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphQLStoreError(ctx, err)
+	}
+	return &customerResolver{customer: customer}, nil
+}
+
+func (r *graphQLResolver) CreateCustomer(ctx context.Context, args struct{ Input customerInput }) (*customerResolver, error) {
+	if err := r.allow(ctx, "", http.MethodPost, "/api/customers", ""); err != nil {
+		return nil, err
+	}
+	customer, err := args.Input.customer("")
+	if err != nil {
+		return nil, err
+	}
+	customer, err = r.repo.Create(ctx, customer)
+	if err != nil {
+		return nil, graphQLStoreError(ctx, err)
+	}
+	return &customerResolver{customer: customer}, nil
+}
+
+func (r *graphQLResolver) UpdateCustomer(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input customerInput
+}) (*customerResolver, error) {
+	if err := r.allow(ctx, "", http.MethodPut, "/api/customers/{id}", string(args.ID)); err != nil {
+		return nil, err
+	}
+	customer, err := args.Input.customer(string(args.ID))
+	if err != nil {
+		return nil, err
+	}
+	customer, err = r.repo.Update(ctx, customer)
+	if err != nil {
+		return nil, graphQLStoreError(ctx, err)
+	}
+	return &customerResolver{customer: customer}, nil
+}
+
+func (r *graphQLResolver) DeleteCustomer(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	if err := r.allow(ctx, "", http.MethodDelete, "/api/customers/{id}", string(args.ID)); err != nil {
+		return false, err
+	}
+	if err := r.repo.Delete(ctx, string(args.ID), 0); err != nil {
+		return false, graphQLStoreError(ctx, err)
+	}
+	return true, nil
+}
+
+type userResolver struct {
+	user store.User
+}
+
+func (u *userResolver) ID() graphql.ID {
+	return graphql.ID(u.user.ID)
+}
+
+func (u *userResolver) Username() string {
+	return u.user.Username
+}
+
+func (u *userResolver) Email() *string {
+	if u.user.Email == "" {
+		return nil
+	}
+	return &u.user.Email
+}
+
+func (u *userResolver) Roles() []string {
+	return append([]string{}, u.user.Roles...)
+}
+
+func (u *userResolver) Tenants() []string {
+	return append([]string{}, u.user.Tenants...)
+}
+
+func (u *userResolver) Disabled() bool {
+	return u.user.Disabled
+}
+
+func (u *userResolver) CreatedAt() string {
+	return u.user.CreatedAt.Format(time.RFC3339Nano)
+}
+
+func (u *userResolver) UpdatedAt() string {
+	return u.user.UpdatedAt.Format(time.RFC3339Nano)
+}
+
+func (r *graphQLResolver) Users(ctx context.Context) ([]*userResolver, error) {
+	if err := r.allow(ctx, auth.RoleAdmin, http.MethodGet, "/api/admin/users", ""); err != nil {
+		return nil, err
+	}
+	users, err := r.users.List(ctx)
+	if err != nil {
+		logger.ErrorCtx(ctx, "User store error: %v", err)
+		return nil, errors.New("Internal server error")
+	}
+	resolvers := make([]*userResolver, len(users))
+	for i, user := range users {
+		resolvers[i] = &userResolver{user: user}
+	}
+	return resolvers, nil
+}
+
+func (r *graphQLResolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	if err := r.allow(ctx, auth.RoleAdmin, http.MethodGet, "/api/admin/users/{id}", string(args.ID)); err != nil {
+		return nil, err
+	}
+	user, err := r.users.Get(ctx, string(args.ID))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.ErrorCtx(ctx, "User store error: %v", err)
+		return nil, errors.New("Internal server error")
+	}
+	return &userResolver{user: user}, nil
+}
+
+// graphQLStoreError maps repository errors to messages safe to return to
+// clients
+func graphQLStoreError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return errors.New("Customer not found")
+	case errors.Is(err, store.ErrConflict):
+		return errors.New("A customer with this email already exists")
+	default:
+		logger.ErrorCtx(ctx, "Customer store error: %v", err)
+		return errors.New("Internal server error")
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"exampleserver/internal/version"
+)
+
+// HealthResponse reports that the process is up
+type HealthResponse struct {
+	Status string `json:"status"`
+	Uptime string `json:"uptime"`
+	Reason string `json:"reason,omitempty"` // why the server isn't ready
+}
+
+// Health serves the probe endpoints used by container orchestrators and
+// load balancers
+type Health struct {
+	ready func() error
+}
+
+// NewHealth returns the probe handlers. ready returns an error while the
+// server shouldn't receive traffic.
+func NewHealth(ready func() error) *Health {
+	return &Health{
+		ready: ready,
+	}
+}
+
+// Live reports that the server is running and able to answer requests
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(HealthResponse{
+		Status: "ok",
+		Uptime: version.Uptime().Round(time.Second).String(),
+	})
+}
+
+// Ready reports whether the server should receive traffic, answering 503
+// while it is draining
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	response := HealthResponse{
+		Status: "ok",
+		Uptime: version.Uptime().Round(time.Second).String(),
+	}
+	status := http.StatusOK
+	if err := h.ready(); err != nil {
+		response.Status = "unavailable"
+		response.Reason = err.Error()
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
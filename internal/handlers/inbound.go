@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"exampleserver/internal/store"
+	"exampleserver/internal/webhooks"
+	"exampleserver/pkg/httperr"
+
+	"github.com/gorilla/mux"
+)
+
+// maxInboundBody caps the size of inbound webhook bodies
+const maxInboundBody = 1 << 20
+
+// InboundReceipt acknowledges an inbound webhook
+type InboundReceipt struct {
+	ID        string `json:"id"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+}
+
+// InboundEventsResponse lists received webhook events, newest first
+type InboundEventsResponse struct {
+	Events []store.InboundEvent `json:"events"`
+}
+
+type Inbound struct {
+	receiver *webhooks.Receiver
+	repo     store.InboundRepository
+}
+
+func NewInbound(receiver *webhooks.Receiver, repo store.InboundRepository) *Inbound {
+	return &Inbound{
+		receiver: receiver,
+		repo:     repo,
+	}
+}
+
+// Receive accepts a signed webhook from a registered source. A new event
+// is answered with 202, a repeat of one already handled with 200, and one
+// that couldn't be published with 503 so the sender tries again.
+func (h *Inbound) Receive(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength > maxInboundBody {
+		httperr.Writef(w, r, http.StatusRequestEntityTooLarge, "Request body is larger than %d bytes", maxInboundBody)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInboundBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httperr.Writef(w, r, http.StatusRequestEntityTooLarge, "Request body is larger than %d bytes", maxInboundBody)
+			return
+		}
+		httperr.Write(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	receipt, err := h.receiver.Receive(r.Context(), mux.Vars(r)["source"], r.Header, body)
+	switch {
+	case errors.Is(err, webhooks.ErrUnknownSource):
+		httperr.Write(w, r, http.StatusNotFound, "Webhook source not found")
+		return
+	case errors.Is(err, webhooks.ErrInvalidSignature), errors.Is(err, webhooks.ErrStaleTimestamp):
+		httperr.Write(w, r, http.StatusUnauthorized, "Invalid webhook signature or timestamp")
+		return
+	case errors.Is(err, webhooks.ErrMissingDelivery):
+		httperr.Write(w, r, http.StatusBadRequest, "Webhook has no delivery ID")
+		return
+	case err != nil && receipt.Event.ID != "":
+		w.Header().Set("Retry-After", "30")
+		httperr.Write(w, r, http.StatusServiceUnavailable, "Webhook recorded but not dispatched, try again later")
+		return
+	case err != nil:
+		httperr.Write(w, r, http.StatusInternalServerError, "Failed to record webhook")
+		return
+	}
+
+	status := http.StatusAccepted
+	if receipt.Duplicate {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(InboundReceipt{
+		ID:        receipt.Event.ID,
+		Duplicate: receipt.Duplicate,
+	})
+}
+
+// List returns received webhook events, of one source when source is set
+func (h *Inbound) List(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if _, err := fmt.Sscanf(value, "%d", &limit); err != nil || limit < 1 {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid limit. Must be a positive number")
+			return
+		}
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	inbound, err := h.repo.List(r.Context(), r.URL.Query().Get("source"), limit)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	if inbound == nil {
+		inbound = []store.InboundEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(InboundEventsResponse{
+		Events: inbound,
+	})
+}
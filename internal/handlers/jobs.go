@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"exampleserver/internal/services"
+)
+
+// JobsResponse lists the scheduled jobs
+type JobsResponse struct {
+	Jobs []services.JobStatus `json:"jobs"`
+}
+
+type Jobs struct {
+	scheduler *services.Scheduler
+}
+
+func NewJobs(scheduler *services.Scheduler) *Jobs {
+	return &Jobs{
+		scheduler: scheduler,
+	}
+}
+
+// List returns every scheduled job with its next run and recent results
+func (j *Jobs) List(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(JobsResponse{
+		Jobs: j.scheduler.Jobs(),
+	})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/logarchive"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+)
+
+// LogDownloadScope is the scope of signed log download links
+const LogDownloadScope = "logs:download"
+
+// LogDownloadPath serves the log downloads that links point to
+const LogDownloadPath = "/api/downloads/logs"
+
+const (
+	defaultLinkExpiry = 15 * time.Minute
+	maxLinkExpiry     = 24 * time.Hour
+)
+
+// LogDownloadRequest is the time range of the log to link to and how many
+// seconds the link is valid, 900 by default
+type LogDownloadRequest struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	ExpiresIn int       `json:"expires_in,omitempty"`
+}
+
+// SignedLink is a URL, relative to the server, that needs no other
+// credentials until it expires
+type SignedLink struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LogDownloads mints signed links to time ranges of the log and serves
+// them, so an export can be handed to someone without an API key
+type LogDownloads struct {
+	logFile string
+	signer  *auth.URLSigner
+}
+
+func NewLogDownloads(logFile string, signer *auth.URLSigner) *LogDownloads {
+	return &LogDownloads{logFile: logFile, signer: signer}
+}
+
+// Link returns a signed link to download the requested range
+func (l *LogDownloads) Link(w http.ResponseWriter, r *http.Request) {
+	var req LogDownloadRequest
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.From.IsZero() || req.To.IsZero() || !req.From.Before(req.To) {
+		httperr.Write(w, r, http.StatusBadRequest, "from and to are required and from must be before to")
+		return
+	}
+	expiresIn := time.Duration(req.ExpiresIn) * time.Second
+	if req.ExpiresIn == 0 {
+		expiresIn = defaultLinkExpiry
+	}
+	if expiresIn <= 0 || expiresIn > maxLinkExpiry {
+		httperr.Writef(w, r, http.StatusBadRequest, "expires_in must be between 1 and %d seconds", int(maxLinkExpiry.Seconds()))
+		return
+	}
+
+	expires := time.Now().Add(expiresIn).Truncate(time.Second)
+	query := url.Values{
+		"from": {req.From.UTC().Format(time.RFC3339)},
+		"to":   {req.To.UTC().Format(time.RFC3339)},
+	}
+	logger.InfoCtx(r.Context(), "%s created a log download link for %s to %s", caller(r), query.Get("from"), query.Get("to"))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(SignedLink{
+		URL:       l.signer.Sign(LogDownloadPath, query, LogDownloadScope, expires),
+		ExpiresAt: expires.UTC(),
+	})
+}
+
+// Download streams the range of a signed link as gzipped NDJSON. It must be
+// wrapped with auth.RequireSignedURL.
+func (l *LogDownloads) Download(w http.ResponseWriter, r *http.Request) {
+	from, errFrom := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+	to, errTo := time.Parse(time.RFC3339, r.URL.Query().Get("to"))
+	if errFrom != nil || errTo != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "from and to are required and from must be before to")
+		return
+	}
+
+	name := "logs-" + from.Format("20060102T150405Z") + "-" + to.Format("20060102T150405Z") + ".ndjson.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if _, err := logarchive.WriteExport(r.Context(), w, l.logFile, from, to, func(done, total int) {}); err != nil {
+		// The status has been sent; the truncated gzip stream tells the
+		// client the download failed
+		logger.ErrorCtx(r.Context(), "Log download failed: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"exampleserver/internal/logarchive"
+	"exampleserver/internal/tasks"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+)
+
+// LogErasureTask is the task type of log erasures
+const LogErasureTask = "log-erasure"
+
+// LogErasureRequest lists the identifiers, such as email addresses or user
+// IDs, to redact from the log
+type LogErasureRequest struct {
+	Identifiers []string `json:"identifiers"`
+}
+
+// LogErasureResult is the result of a log erasure task
+type LogErasureResult struct {
+	logger.ErasureReport
+	// Remaining lists the copies of the log the erasure can't reach: the
+	// backups and exports in the log archive bucket, which have to be erased
+	// there
+	Remaining []string `json:"remaining"`
+}
+
+// LogErasures redacts identifiers from the log files as background tasks,
+// for erasure requests under data protection law
+type LogErasures struct {
+	archive *logarchive.Exporter // nil without a log archive bucket
+	tasks   *tasks.Tracker
+}
+
+func NewLogErasures(archive *logarchive.Exporter, tracker *tasks.Tracker) *LogErasures {
+	return &LogErasures{archive: archive, tasks: tracker}
+}
+
+// Start queues the erasure. The task's result is a LogErasureResult; the
+// identifiers themselves are never logged.
+func (l *LogErasures) Start(w http.ResponseWriter, r *http.Request) {
+	var req LogErasureRequest
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	valid := len(req.Identifiers) > 0
+	for _, identifier := range req.Identifiers {
+		valid = valid && len(strings.TrimSpace(identifier)) >= logger.MinErasureIdentifier
+	}
+	if !valid {
+		httperr.Writef(w, r, http.StatusBadRequest, "identifiers are required and must each be at least %d characters", logger.MinErasureIdentifier)
+		return
+	}
+
+	task, err := l.tasks.Submit(LogErasureTask, caller(r), 0, func(ctx context.Context, progress *tasks.Progress) (interface{}, error) {
+		report, err := logger.Erase(req.Identifiers, progress.Set)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Log erasure redacted %d entries in %d files", report.Entries, len(report.Files))
+
+		result := LogErasureResult{ErasureReport: report, Remaining: []string{}}
+		if l.archive != nil {
+			if result.Remaining, err = l.archive.Objects(ctx); err != nil {
+				return nil, fmt.Errorf("the log files were erased, but listing the archived copies failed: %w", err)
+			}
+		}
+		return result, nil
+	})
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Failed to queue log erasure: %v", err)
+		httperr.Write(w, r, http.StatusServiceUnavailable, "Too many background tasks, try again later")
+		return
+	}
+
+	writeAccepted(w, task)
+}
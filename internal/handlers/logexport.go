@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"exampleserver/internal/logarchive"
+	"exampleserver/internal/tasks"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+)
+
+// LogExportTask is the task type of log exports
+const LogExportTask = "log-export"
+
+// LogExportRequest is the time range of the log to export
+type LogExportRequest struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// LogExports starts exports of the log to object storage as background
+// tasks
+type LogExports struct {
+	exporter *logarchive.Exporter
+	tasks    *tasks.Tracker
+}
+
+func NewLogExports(exporter *logarchive.Exporter, tracker *tasks.Tracker) *LogExports {
+	return &LogExports{exporter: exporter, tasks: tracker}
+}
+
+// Start queues an export of the requested range. The task's result is a
+// logarchive.ExportResult.
+func (l *LogExports) Start(w http.ResponseWriter, r *http.Request) {
+	var req LogExportRequest
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.From.IsZero() || req.To.IsZero() || !req.From.Before(req.To) {
+		httperr.Write(w, r, http.StatusBadRequest, "from and to are required and from must be before to")
+		return
+	}
+
+	task, err := l.tasks.Submit(LogExportTask, caller(r), 0, func(ctx context.Context, progress *tasks.Progress) (interface{}, error) {
+		return l.exporter.Export(ctx, req.From, req.To, progress.Set)
+	})
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Failed to queue log export: %v", err)
+		httperr.Write(w, r, http.StatusServiceUnavailable, "Too many background tasks, try again later")
+		return
+	}
+
+	writeAccepted(w, task)
+}
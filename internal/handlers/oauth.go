@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/oauth2"
+)
+
+// oauthFlowTimeout bounds how long a user has to log in at the provider
+const oauthFlowTimeout = 10 * time.Minute
+
+// errNoVerifiedEmail rejects provider accounts that can't be matched to a
+// username
+var errNoVerifiedEmail = errors.New("no usable verified email")
+
+// errUnlinkedUser rejects provider accounts whose email names an existing
+// user they aren't linked to
+var errUnlinkedUser = errors.New("email belongs to an unlinked user")
+
+// IdentityLinkRequest is the request body for linking a provider account
+// to a user
+type IdentityLinkRequest struct {
+	Provider string `json:"provider"`
+	// Subject is the provider's ID of the account, logged when its first
+	// login was refused
+	Subject string `json:"subject"`
+}
+
+// OAuth serves social logins: it sends users to the provider, then finds
+// the local user linked to the account that logged in, creating one for a
+// new email, and issues a JWT token
+type OAuth struct {
+	providers  map[string]*auth.OAuthProvider
+	jwtService *auth.JWTService
+	users      store.UserRepository
+	identities store.IdentityRepository
+	successURL string
+	secure     bool
+}
+
+// NewOAuth logs in with providers. Tokens are returned as a LoginResponse,
+// or in the fragment of a redirect to successURL when it is set. secure
+// marks the flow cookie for HTTPS only.
+func NewOAuth(providers []*auth.OAuthProvider, jwtService *auth.JWTService, users store.UserRepository, identities store.IdentityRepository, successURL string, secure bool) *OAuth {
+	o := &OAuth{
+		providers:  make(map[string]*auth.OAuthProvider, len(providers)),
+		jwtService: jwtService,
+		users:      users,
+		identities: identities,
+		successURL: successURL,
+		secure:     secure,
+	}
+	for _, provider := range providers {
+		o.providers[provider.Name] = provider
+	}
+	return o
+}
+
+// Login redirects to the provider's login page. The state and PKCE
+// verifier are kept in a cookie that the callback checks, so a callback
+// can't be replayed in another browser.
+func (o *OAuth) Login(w http.ResponseWriter, r *http.Request) {
+	provider, ok := o.provider(w, r)
+	if !ok {
+		return
+	}
+	state, err := randomState()
+	if err != nil {
+		httperr.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	http.SetCookie(w, o.cookie(provider, state+"."+verifier, int(oauthFlowTimeout.Seconds())))
+	http.Redirect(w, r, provider.AuthCodeURL(state, verifier), http.StatusFound)
+}
+
+// Callback completes a login when the provider redirects back with a code
+func (o *OAuth) Callback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := o.provider(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	cookie, err := r.Cookie(o.cookie(provider, "", 0).Name)
+	http.SetCookie(w, o.cookie(provider, "", -1))
+	var state, verifier string
+	if err == nil {
+		state, verifier, _ = strings.Cut(cookie.Value, ".")
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+		loginsFailed.Inc()
+		httperr.Write(w, r, http.StatusBadRequest, "Login expired or was started in another browser. Please try again")
+		return
+	}
+	if query.Get("error") != "" || query.Get("code") == "" {
+		loginsFailed.Inc()
+		httperr.Write(w, r, http.StatusUnauthorized, "Login was cancelled or denied by the provider")
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), verifier)
+	if err != nil {
+		logger.WarnCtx(r.Context(), "%s login failed: %v", provider.Name, err)
+		loginsFailed.Inc()
+		httperr.Write(w, r, http.StatusBadGateway, "Login provider could not be reached or rejected the login")
+		return
+	}
+	user, err := o.user(r.Context(), provider.Name, identity)
+	switch {
+	case errors.Is(err, errNoVerifiedEmail):
+		loginsFailed.Inc()
+		httperr.Write(w, r, http.StatusForbidden, "The provider account needs a verified email address usable as a username")
+		return
+	case errors.Is(err, errUnlinkedUser):
+		loginsFailed.Inc()
+		httperr.Write(w, r, http.StatusConflict, "A user with this email already exists. Ask an admin to link the provider account to it")
+		return
+	case err != nil:
+		writeUserError(w, r, err)
+		return
+	case user.Disabled:
+		loginsFailed.Inc()
+		httperr.Write(w, r, http.StatusForbidden, "Account is disabled")
+		return
+	}
+
+	token, err := o.jwtService.GenerateToken(user.ID, user.Username, user.Roles, user.SessionVersion)
+	if err != nil {
+		httperr.Write(w, r, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+	loginsTotal.Inc()
+	if o.successURL != "" {
+		http.Redirect(w, r, o.successURL+"#token="+url.QueryEscape(token), http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LoginResponse{Token: token})
+}
+
+// user returns the user linked to identity. An unlinked identity gets a new
+// user named by its verified email, and is refused with errUnlinkedUser if
+// that user already exists: linking it would hand the user to whoever
+// controls the email at the provider, so only an admin can, with Link.
+func (o *OAuth) user(ctx context.Context, provider string, identity auth.OAuthIdentity) (store.User, error) {
+	linked, err := o.identities.Get(ctx, provider, identity.Subject)
+	if err == nil {
+		return o.users.Get(ctx, linked.UserID)
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return store.User{}, err
+	}
+
+	if !identity.EmailVerified || !validUsername.MatchString(identity.Email) {
+		return store.User{}, errNoVerifiedEmail
+	}
+	// Without a password hash the user can only log in through the
+	// provider, until an admin resets the password
+	user, err := o.users.Create(ctx, store.User{Username: identity.Email, Roles: []string{}})
+	if errors.Is(err, store.ErrConflict) {
+		if linked, err := o.identities.Get(ctx, provider, identity.Subject); err == nil {
+			// Created and linked by a concurrent login
+			return o.users.Get(ctx, linked.UserID)
+		}
+		logger.WarnCtx(ctx, "Refused the first %s login of %s (subject %s): user %s exists and isn't linked to it", provider, identity.Email, identity.Subject, identity.Email)
+		return store.User{}, errUnlinkedUser
+	}
+	if err != nil {
+		return store.User{}, err
+	}
+	logger.InfoCtx(ctx, "Created user %s for a %s login", user.Username, provider)
+	_, err = o.identities.Create(ctx, store.Identity{Provider: provider, Subject: identity.Subject, UserID: user.ID})
+	if errors.Is(err, store.ErrConflict) {
+		// Linked by a concurrent login
+		return o.user(ctx, provider, identity)
+	}
+	return user, err
+}
+
+// Link links a provider account to the user in the path, so its logins
+// sign in as that user. Admins use it to confirm that an account refused on
+// its first login belongs to the existing user with its email.
+func (o *OAuth) Link(w http.ResponseWriter, r *http.Request) {
+	var req IdentityLinkRequest
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if _, ok := o.providers[req.Provider]; !ok || strings.TrimSpace(req.Subject) == "" {
+		httperr.Write(w, r, http.StatusBadRequest, "provider must be a configured login provider and subject must be set")
+		return
+	}
+	user, err := o.users.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	identity, err := o.identities.Create(r.Context(), store.Identity{Provider: req.Provider, Subject: strings.TrimSpace(req.Subject), UserID: user.ID})
+	if errors.Is(err, store.ErrConflict) {
+		httperr.Write(w, r, http.StatusConflict, "The provider account is already linked")
+		return
+	}
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	logger.Ctx(r.Context()).WithFields(map[string]interface{}{
+		"audit": true, "actor": caller(r), "user": user.Username, "provider": identity.Provider, "subject": identity.Subject,
+	}).Warn("%s linked the %s account %s to user %s", caller(r), identity.Provider, identity.Subject, user.Username)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(identity)
+}
+
+// provider returns the provider named in the path, writing a 404 for ones
+// that aren't configured
+func (o *OAuth) provider(w http.ResponseWriter, r *http.Request) (*auth.OAuthProvider, bool) {
+	provider, ok := o.providers[mux.Vars(r)["provider"]]
+	if !ok {
+		httperr.Write(w, r, http.StatusNotFound, "Unknown login provider")
+	}
+	return provider, ok
+}
+
+// cookie carries the state of a login through the provider; a negative
+// maxAge deletes it
+func (o *OAuth) cookie(provider *auth.OAuthProvider, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     "oauth_" + provider.Name,
+		Value:    value,
+		Path:     "/api/auth/" + provider.Name,
+		MaxAge:   maxAge,
+		Secure:   o.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
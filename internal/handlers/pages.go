@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/pages"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/i18n"
+	"exampleserver/pkg/logger"
+)
+
+// HomePage is the data of the home page
+type HomePage struct {
+	Features []string
+}
+
+// LoginPage is the data of the login page
+type LoginPage struct {
+	Username string
+	// Error says why the last attempt failed, empty before the first
+	Error string
+}
+
+// PasswordResetPage is the data of the page of a password reset link
+type PasswordResetPage struct {
+	Username string
+	// Action is the link, which the form posts back to
+	Action string
+	// Error says why the last attempt failed, empty before the first
+	Error string
+}
+
+// Pages serves the server-rendered HTML pages
+type Pages struct {
+	renderer *pages.Renderer
+	features []string
+	auth     *Auth
+}
+
+func NewPages(renderer *pages.Renderer, features []string, auth *Auth) *Pages {
+	return &Pages{renderer: renderer, features: features, auth: auth}
+}
+
+// Home renders the home page with the enabled features
+func (p *Pages) Home(w http.ResponseWriter, r *http.Request) {
+	p.render(w, r, http.StatusOK, "home", HomePage{Features: p.features})
+}
+
+// Account renders the claims of the signed in user
+func (p *Pages) Account(w http.ResponseWriter, r *http.Request) {
+	p.render(w, r, http.StatusOK, "account", nil)
+}
+
+// Login renders the login form
+func (p *Pages) Login(w http.ResponseWriter, r *http.Request) {
+	p.render(w, r, http.StatusOK, "login", LoginPage{})
+}
+
+// SignIn checks the username and password posted by the login form and
+// stores a token for them in the session cookie, which the pages accept
+// like a bearer token, then redirects to the account page. Failures render
+// the form again with the reason.
+func (p *Pages) SignIn(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		httperr.Write(w, r, http.StatusForbidden, "Cross-site form submissions are not accepted")
+		return
+	}
+	username, password := r.PostFormValue("username"), r.PostFormValue("password")
+	failed := func(status int, message string) {
+		p.render(w, r, status, "login", LoginPage{Username: username, Error: i18n.Translate(i18n.Locale(r), message)})
+	}
+	if username == "" || password == "" {
+		loginsFailed.Inc()
+		failed(http.StatusBadRequest, "Username and password are required")
+		return
+	}
+
+	user, status, message, err := p.auth.verify(r, username, password)
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	if status != 0 {
+		failed(status, message)
+		return
+	}
+	if user.MustResetPassword {
+		loginsFailed.Inc()
+		failed(http.StatusForbidden, "Password reset required. Set a new password with POST /api/password")
+		return
+	}
+	user = p.auth.rehash(r, user, password)
+
+	token, err := p.auth.jwtService.GenerateToken(user.ID, user.Username, user.Roles, user.SessionVersion)
+	if err != nil {
+		httperr.Write(w, r, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+	loginsTotal.Inc()
+	http.SetCookie(w, sessionCookie(token, int(auth.TokenTTL.Seconds())))
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// SignOut deletes the session cookie and redirects to the home page
+func (p *Pages) SignOut(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		httperr.Write(w, r, http.StatusForbidden, "Cross-site form submissions are not accepted")
+		return
+	}
+	http.SetCookie(w, sessionCookie("", -1))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// PasswordReset renders the form to choose a new password on, for the link
+// of a forced reset
+func (p *Pages) PasswordReset(w http.ResponseWriter, r *http.Request) {
+	user, ok := p.resetUser(w, r)
+	if !ok {
+		return
+	}
+	p.render(w, r, http.StatusOK, "reset-password", PasswordResetPage{Username: user.Username, Action: r.URL.RequestURI()})
+}
+
+// SetPassword sets the password posted by the form of a reset link, ending
+// the forced reset and, as the password hash changes, the link, then
+// redirects to the login page. The user's sessions are revoked.
+func (p *Pages) SetPassword(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		httperr.Write(w, r, http.StatusForbidden, "Cross-site form submissions are not accepted")
+		return
+	}
+	user, ok := p.resetUser(w, r)
+	if !ok {
+		return
+	}
+	password := r.PostFormValue("password")
+	failed := func(message string) {
+		p.render(w, r, http.StatusBadRequest, "reset-password", PasswordResetPage{
+			Username: user.Username,
+			Action:   r.URL.RequestURI(),
+			Error:    i18n.Translate(i18n.Locale(r), message),
+		})
+	}
+	if len(password) < auth.MinPasswordLength {
+		failed("New password is too short")
+		return
+	}
+	if password != r.PostFormValue("confirm") {
+		failed("The passwords don't match")
+		return
+	}
+
+	hash, err := p.auth.passwords.Hash(password)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Password hashing error: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	// Only while the hash is still the one the link was issued for, so two
+	// posts of the form can't both set a password
+	if err := p.auth.users.ReplacePasswordHash(r.Context(), user.ID, user.PasswordHash, hash); errors.Is(err, store.ErrNotFound) {
+		httperr.Write(w, r, http.StatusForbidden, "This link has already been used")
+		return
+	} else if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	user.PasswordHash = hash
+	user.MustResetPassword = false
+	user.SessionVersion++
+	if _, err := p.auth.users.Update(r.Context(), user); err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// resetUser loads the enabled user a password reset link was signed for,
+// refusing links whose password hash has changed since they were issued
+func (p *Pages) resetUser(w http.ResponseWriter, r *http.Request) (store.User, bool) {
+	query := r.URL.Query()
+	user, err := p.auth.users.Get(r.Context(), query.Get("user"))
+	if errors.Is(err, store.ErrNotFound) || err == nil && !user.MustResetPassword ||
+		err == nil && subtle.ConstantTimeCompare([]byte(passwordResetKey(user.PasswordHash)), []byte(query.Get("key"))) != 1 {
+		httperr.Write(w, r, http.StatusForbidden, "This link has already been used")
+		return store.User{}, false
+	}
+	if err != nil {
+		writeUserError(w, r, err)
+		return store.User{}, false
+	}
+	if user.Disabled {
+		httperr.Write(w, r, http.StatusForbidden, "Account is disabled")
+		return store.User{}, false
+	}
+	return user, true
+}
+
+func (p *Pages) render(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
+	if err := p.renderer.Render(w, r, status, name, data); err != nil {
+		logger.ErrorCtx(r.Context(), "Page rendering failed: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// sessionCookie holds the token of a page login; a negative maxAge deletes
+// it. It is never sent with requests other sites make but top-level
+// navigations, which only the pages, changing nothing, accept it for.
+// Browsers keep Secure cookies from http://localhost too.
+func sessionCookie(token string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     auth.SessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// sameOrigin reports whether a form was posted from this server, by the
+// Origin header browsers send with form posts; requests without one, from
+// clients other than browsers, are let through
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
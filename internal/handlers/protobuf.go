@@ -0,0 +1,47 @@
+package handlers
+
+import "exampleserver/pkg/protobuf"
+
+// Protobuf encodings of the handler types that have one, following the
+// messages of pkg/protobuf/exampleserver.proto
+
+// MarshalProtobuf encodes the list as a CustomerList
+func (c CustomersResponse) MarshalProtobuf(e *protobuf.Encoder) {
+	for _, customer := range c.Customers {
+		e.Message(1, customer)
+	}
+}
+
+// UnmarshalProtobuf decodes a CustomerRequest
+func (c *CustomerRequest) UnmarshalProtobuf(data []byte) error {
+	return protobuf.Fields(data, func(f protobuf.Field) error {
+		switch f.Number {
+		case 1:
+			c.Name = f.String()
+		case 2:
+			c.Email = f.String()
+		}
+		return nil
+	})
+}
+
+// UnmarshalProtobuf decodes a CustomerImportRequest
+func (c *CustomerImportRequest) UnmarshalProtobuf(data []byte) error {
+	return protobuf.Fields(data, func(f protobuf.Field) error {
+		if f.Number != 1 {
+			return nil
+		}
+		var row CustomerRequest
+		if err := f.Message(&row); err != nil {
+			return err
+		}
+		c.Customers = append(c.Customers, row)
+		return nil
+	})
+}
+
+// MarshalProtobuf encodes the sample as a StatsSample
+func (s StatsSample) MarshalProtobuf(e *protobuf.Encoder) {
+	e.Time(1, s.Timestamp)
+	e.DoubleMap(2, s.Metrics)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"exampleserver/internal/openapi"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Path string `json:"path"`
+	// Methods is empty for routes matching any method
+	Methods []string `json:"methods"`
+	Summary string   `json:"summary,omitempty"`
+	// Auth is "required" when the caller must authenticate, otherwise
+	// "none"; Role is required on top of authentication
+	Auth string `json:"auth"`
+	Role string `json:"role,omitempty"`
+	// Middleware applied to this route only, outermost first
+	Middleware []string `json:"middleware"`
+	// Documented routes are in /openapi.json
+	Documented bool `json:"documented"`
+}
+
+// RoutesResponse lists the router's routes in the order they are matched
+type RoutesResponse struct {
+	// Middleware applied to every request, outermost first
+	Middleware []string    `json:"middleware"`
+	Routes     []RouteInfo `json:"routes"`
+}
+
+type Routes struct {
+	router     *mux.Router
+	api        *openapi.Registry
+	middleware []string
+}
+
+// NewRoutes describes the routes of router, with the details of those
+// registered with api
+func NewRoutes(router *mux.Router, api *openapi.Registry, middleware []string) *Routes {
+	return &Routes{
+		router:     router,
+		api:        api,
+		middleware: middleware,
+	}
+}
+
+// List walks the router and returns every route with its methods, the
+// middleware applied and the authentication it requires
+func (h *Routes) List(w http.ResponseWriter, r *http.Request) {
+	operations := map[string]openapi.Operation{}
+	for _, op := range h.api.Operations() {
+		operations[op.Method+" "+op.Path] = op
+	}
+
+	routes := []RouteInfo{}
+	h.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		info := RouteInfo{Path: path, Methods: methods, Auth: "none", Middleware: []string{}}
+		if methods == nil {
+			info.Methods = []string{}
+		}
+		method := ""
+		if len(methods) > 0 {
+			method = methods[0]
+		}
+		info.Documented = h.api.Documented(method, path)
+		if op, ok := operations[method+" "+path]; ok {
+			info.Summary = op.Summary
+			if !op.Public {
+				info.Auth = "required"
+				info.Middleware = append(info.Middleware, "authenticate", "authorize")
+			}
+			if op.Role != "" {
+				info.Role = op.Role
+				info.Middleware = append(info.Middleware, "require-role")
+			}
+		}
+		routes = append(routes, info)
+		return nil
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RoutesResponse{
+		Middleware: h.middleware,
+		Routes:     routes,
+	})
+}
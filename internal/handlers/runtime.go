@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+
+	"exampleserver/internal/store"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+)
+
+// RuntimeSettings are the Go runtime's scheduler and GC settings
+type RuntimeSettings struct {
+	GOMAXPROCS int `json:"gomaxprocs"`
+	NumCPU     int `json:"num_cpu"`
+	// GOGC is the GC target percentage, -1 when the GC is off
+	GOGC int `json:"gogc"`
+	// MemoryLimit is the soft memory limit in bytes, 0 for none
+	MemoryLimit int64 `json:"memory_limit"`
+}
+
+// RuntimeSettingsUpdate changes the settings given
+type RuntimeSettingsUpdate struct {
+	GOMAXPROCS  *int   `json:"gomaxprocs,omitempty"`
+	GOGC        *int   `json:"gogc,omitempty"`
+	MemoryLimit *int64 `json:"memory_limit,omitempty"`
+}
+
+// Runtime views and changes the runtime settings of the running server, for
+// emergency tuning during incidents. Changes last until the server
+// restarts.
+type Runtime struct {
+	audit store.AuditRepository
+	mu    sync.Mutex
+}
+
+func NewRuntime(audit store.AuditRepository) *Runtime {
+	return &Runtime{audit: audit}
+}
+
+// Get returns the current settings
+func (h *Runtime) Get(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runtimeSettings())
+}
+
+// Update applies the settings given and records every change in the audit
+// log
+func (h *Runtime) Update(w http.ResponseWriter, r *http.Request) {
+	var update RuntimeSettingsUpdate
+	if err := decodeJSON(r, &update); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	switch {
+	case update.GOMAXPROCS != nil && *update.GOMAXPROCS < 1:
+		httperr.Write(w, r, http.StatusBadRequest, "gomaxprocs must be at least 1")
+		return
+	case update.GOGC != nil && *update.GOGC < -1:
+		httperr.Write(w, r, http.StatusBadRequest, "gogc must be -1 to turn the GC off, or a percentage")
+		return
+	case update.MemoryLimit != nil && *update.MemoryLimit < 0:
+		httperr.Write(w, r, http.StatusBadRequest, "memory_limit must be a number of bytes, or 0 for none")
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	before := runtimeSettings()
+	if update.GOMAXPROCS != nil {
+		runtime.GOMAXPROCS(*update.GOMAXPROCS)
+		h.record(r, "gomaxprocs", before.GOMAXPROCS, *update.GOMAXPROCS)
+	}
+	if update.GOGC != nil {
+		debug.SetGCPercent(*update.GOGC)
+		h.record(r, "gogc", before.GOGC, *update.GOGC)
+	}
+	if update.MemoryLimit != nil {
+		limit := *update.MemoryLimit
+		if limit == 0 {
+			limit = math.MaxInt64
+		}
+		debug.SetMemoryLimit(limit)
+		h.record(r, "memory_limit", before.MemoryLimit, *update.MemoryLimit)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runtimeSettings())
+}
+
+// record records a change of a runtime setting with who made it in the audit
+// log and, at WARN with audit=true for plugins to route, the log
+func (h *Runtime) record(r *http.Request, setting string, from, to interface{}) {
+	details, _ := json.Marshal(map[string]interface{}{"from": from, "to": to})
+	if _, err := h.audit.Record(r.Context(), store.AuditEntry{Actor: caller(r), Action: "runtime", Target: setting, Details: details}); err != nil {
+		logger.ErrorCtx(r.Context(), "Failed to record the change of runtime setting %s in the audit log: %v", setting, err)
+	}
+	logger.Ctx(r.Context()).WithFields(map[string]interface{}{
+		"audit": true, "actor": caller(r), "setting": setting, "from": from, "to": to,
+	}).Warn("Runtime setting %s changed from %v to %v by %s", setting, from, to, caller(r))
+}
+
+func runtimeSettings() RuntimeSettings {
+	sample := []metrics.Sample{{Name: "/gc/gogc:percent"}}
+	metrics.Read(sample)
+	gogc := -1
+	if sample[0].Value.Kind() == metrics.KindUint64 {
+		gogc = int(sample[0].Value.Uint64())
+	}
+
+	// A negative limit reads the limit without changing it
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		limit = 0
+	}
+	return RuntimeSettings{
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		NumCPU:      runtime.NumCPU(),
+		GOGC:        gogc,
+		MemoryLimit: limit,
+	}
+}
@@ -0,0 +1,797 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/i18n"
+	"exampleserver/pkg/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// SCIM schema URNs (RFC 7643, RFC 7644)
+const (
+	scimUserSchema    = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema   = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema    = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema   = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema  = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimContentType   = "application/scim+json"
+	scimDefaultCount  = 100
+	scimMaxCount      = 1000
+	scimUsersLocation = "/scim/v2/Users/"
+	scimGroupLocation = "/scim/v2/Groups/"
+)
+
+// scimFilter matches the only filters identity providers send before
+// provisioning: an attribute compared for equality with a string
+var scimFilter = regexp.MustCompile(`(?i)^\s*(\w+)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// scimMemberFilter matches a patch path selecting a single group member
+var scimMemberFilter = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+("(?:[^"\\]|\\.)*")\s*\]$`)
+
+// errSCIMBadRequest carries the detail of a 400 response from a change
+type errSCIMBadRequest string
+
+func (e errSCIMBadRequest) Error() string { return string(e) }
+
+// SCIMUser is the SCIM representation of a user. Password is only read.
+type SCIMUser struct {
+	Schemas  []string     `json:"schemas"`
+	ID       string       `json:"id,omitempty"`
+	UserName string       `json:"userName"`
+	Password string       `json:"password,omitempty"`
+	Active   *bool        `json:"active,omitempty"`
+	Groups   []SCIMMember `json:"groups,omitempty"`
+	Meta     *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// SCIMGroup is the SCIM representation of a role and the users that have it
+type SCIMGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []SCIMMember `json:"members"`
+	Meta        *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// SCIMMember references a user in a group, or a group of a user
+type SCIMMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+// SCIMMeta describes a resource
+type SCIMMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+}
+
+// SCIMListResponse is a page of users or groups
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// SCIMPatch is the request body of a PATCH
+type SCIMPatch struct {
+	Schemas    []string        `json:"schemas"`
+	Operations []SCIMOperation `json:"Operations"`
+}
+
+// SCIMOperation is a single change of a PATCH. Value is an attribute value,
+// or an object of attributes when Path is empty.
+type SCIMOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SCIMError is the error response of the SCIM endpoints
+type SCIMError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// SCIM serves the SCIM 2.0 provisioning endpoints identity providers such
+// as Okta and Azure AD use to create, update and deprovision users. Groups
+// are the users' roles: a group's members are the users with that role.
+// The reserved roles are not groups, so a provider can't grant them.
+type SCIM struct {
+	users     store.UserRepository
+	passwords *auth.PasswordHasher
+}
+
+func NewSCIM(users store.UserRepository, passwords *auth.PasswordHasher) *SCIM {
+	return &SCIM{users: users, passwords: passwords}
+}
+
+// ServiceProviderConfig describes the supported SCIM features
+func (s *SCIM) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	unsupported := map[string]bool{"supported": false}
+	writeSCIM(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{scimConfigSchema},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": map[string]bool{"supported": true},
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []map[string]interface{}{{
+			"type": "oauthbearertoken", "name": "Bearer token", "primary": true,
+			"description": "The token configured as SCIM_TOKEN",
+		}},
+	})
+}
+
+// ListUsers returns a page of users, optionally filtered by userName
+func (s *SCIM) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.users.List(r.Context())
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "User not found")
+		return
+	}
+	attribute, value, ok := scimFilterValue(w, r)
+	if !ok {
+		return
+	}
+
+	resources := make([]SCIMUser, 0, len(users))
+	for _, user := range users {
+		if attribute == "" || (attribute == "username" && strings.EqualFold(user.Username, value)) {
+			resources = append(resources, scimUser(user))
+		}
+	}
+	writeSCIMList(w, r, resources)
+}
+
+// GetUser returns a single user
+func (s *SCIM) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := s.users.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "User not found")
+		return
+	}
+	writeSCIM(w, http.StatusOK, scimUser(user))
+}
+
+// CreateUser provisions a user. Users without a password can only log in
+// through social login until an admin resets their password.
+func (s *SCIM) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req SCIMUser
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeSCIMError(w, r, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+	user := store.User{Roles: []string{}}
+	if err := s.apply(&user, req); err != nil {
+		writeSCIMStoreError(w, r, err, "User not found")
+		return
+	}
+	user, err := s.users.Create(r.Context(), user)
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "User not found")
+		return
+	}
+	logger.InfoCtx(r.Context(), "SCIM provisioned user %s", user.Username)
+
+	w.Header().Set("Location", scimUsersLocation+user.ID)
+	writeSCIM(w, http.StatusCreated, scimUser(user))
+}
+
+// ReplaceUser sets a user's userName, active state and, when given,
+// password. Groups are changed through the Groups endpoints.
+func (s *SCIM) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	var req SCIMUser
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeSCIMError(w, r, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+	if req.Active == nil {
+		active := true
+		req.Active = &active
+	}
+	s.modifyUser(w, r, func(user *store.User) error {
+		return s.apply(user, req)
+	})
+}
+
+// PatchUser applies add and replace operations to userName, active and
+// password
+func (s *SCIM) PatchUser(w http.ResponseWriter, r *http.Request) {
+	patch, ok := decodeSCIMPatch(w, r)
+	if !ok {
+		return
+	}
+	s.modifyUser(w, r, func(user *store.User) error {
+		for _, op := range patch.Operations {
+			if !strings.EqualFold(op.Op, "add") && !strings.EqualFold(op.Op, "replace") {
+				return errSCIMBadRequest("Only add and replace operations are supported for users")
+			}
+			attributes := map[string]json.RawMessage{}
+			if op.Path == "" {
+				if err := json.Unmarshal(op.Value, &attributes); err != nil {
+					return errSCIMBadRequest("Invalid request body")
+				}
+			} else {
+				attributes[op.Path] = op.Value
+			}
+
+			var req SCIMUser
+			for path, value := range attributes {
+				var err error
+				switch strings.ToLower(path) {
+				case "username":
+					err = json.Unmarshal(value, &req.UserName)
+				case "password":
+					err = json.Unmarshal(value, &req.Password)
+				case "active":
+					var active bool
+					active, err = scimBool(value)
+					req.Active = &active
+				default:
+					// Attributes the user store doesn't keep, such as name
+					// and emails, are accepted and dropped
+					continue
+				}
+				if err != nil {
+					return errSCIMBadRequest("Invalid request body")
+				}
+			}
+			if req.UserName == "" {
+				req.UserName = user.Username
+			}
+			if err := s.apply(user, req); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteUser deprovisions a user, removing it with its devices and linked
+// identities
+func (s *SCIM) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := s.users.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeSCIMStoreError(w, r, err, "User not found")
+		return
+	}
+	logger.InfoCtx(r.Context(), "SCIM deprovisioned user %s", mux.Vars(r)["id"])
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apply copies the attributes of req to user. Deactivating a user revokes
+// its sessions.
+func (s *SCIM) apply(user *store.User, req SCIMUser) error {
+	username := strings.TrimSpace(req.UserName)
+	if !validUsername.MatchString(username) {
+		return errSCIMBadRequest("Username must be 1 to 100 letters, digits or . _ @ -")
+	}
+	user.Username = username
+	if req.Active != nil {
+		if !*req.Active && !user.Disabled {
+			user.SessionVersion++
+		}
+		user.Disabled = !*req.Active
+	}
+	if req.Password != "" {
+		if len(req.Password) < auth.MinPasswordLength {
+			return errSCIMBadRequest("Password is too short")
+		}
+		hash, err := s.passwords.Hash(req.Password)
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = hash
+		user.MustResetPassword = false
+		user.SessionVersion++
+	}
+	return nil
+}
+
+// modifyUser loads the user named in the path, applies change and stores
+// the result
+func (s *SCIM) modifyUser(w http.ResponseWriter, r *http.Request, change func(user *store.User) error) {
+	user, err := s.users.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "User not found")
+		return
+	}
+	if err := change(&user); err != nil {
+		writeSCIMStoreError(w, r, err, "User not found")
+		return
+	}
+	user, err = s.users.Update(r.Context(), user)
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "User not found")
+		return
+	}
+	writeSCIM(w, http.StatusOK, scimUser(user))
+}
+
+// ListGroups returns a page of the roles that have members, optionally
+// filtered by displayName
+func (s *SCIM) ListGroups(w http.ResponseWriter, r *http.Request) {
+	users, err := s.users.List(r.Context())
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "Group not found")
+		return
+	}
+	attribute, value, ok := scimFilterValue(w, r)
+	if !ok {
+		return
+	}
+
+	members := scimGroupMembers(users)
+	roles := make([]string, 0, len(members))
+	for role := range members {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	if attribute != "" {
+		roles = []string{}
+		if role := groupRole(value); attribute == "displayname" && members[role] != nil {
+			roles = append(roles, role)
+		}
+	}
+
+	resources := make([]SCIMGroup, 0, len(roles))
+	for _, role := range roles {
+		resources = append(resources, scimGroup(role, members[role]))
+	}
+	writeSCIMList(w, r, resources)
+}
+
+// GetGroup returns a role with its members. Every valid role name is a
+// group, empty until it is assigned.
+func (s *SCIM) GetGroup(w http.ResponseWriter, r *http.Request) {
+	role, ok := s.groupRole(w, r)
+	if !ok {
+		return
+	}
+	users, err := s.users.List(r.Context())
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "Group not found")
+		return
+	}
+	writeSCIM(w, http.StatusOK, scimGroup(role, scimGroupMembers(users)[role]))
+}
+
+// CreateGroup assigns the role named by displayName to the members
+func (s *SCIM) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req SCIMGroup
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeSCIMError(w, r, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+	role := groupRole(req.DisplayName)
+	if !validRole.MatchString(role) {
+		writeSCIMError(w, r, http.StatusBadRequest, "invalidValue", "Group names are 1 to 50 letters, digits, spaces, _ or -")
+		return
+	}
+	if scimReservedRole(role) {
+		writeSCIMError(w, r, http.StatusBadRequest, "invalidValue", "Groups can't be named admin or scim, which are reserved roles")
+		return
+	}
+	users, err := s.users.List(r.Context())
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "Group not found")
+		return
+	}
+	if scimGroupMembers(users)[role] != nil {
+		writeSCIMError(w, r, http.StatusConflict, "uniqueness", "Group already exists")
+		return
+	}
+
+	members, err := s.setMembers(r, role, nil, memberIDs(req.Members))
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "Group not found")
+		return
+	}
+	w.Header().Set("Location", scimGroupLocation+role)
+	writeSCIM(w, http.StatusCreated, scimGroup(role, members))
+}
+
+// ReplaceGroup sets the members of a role
+func (s *SCIM) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	role, ok := s.groupRole(w, r)
+	if !ok {
+		return
+	}
+	var req SCIMGroup
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeSCIMError(w, r, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+	if req.DisplayName != "" && groupRole(req.DisplayName) != role {
+		writeSCIMError(w, r, http.StatusBadRequest, "mutability", "Groups can't be renamed")
+		return
+	}
+	users, err := s.users.List(r.Context())
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "Group not found")
+		return
+	}
+	members, err := s.setMembers(r, role, scimGroupMembers(users)[role], memberIDs(req.Members))
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "Group not found")
+		return
+	}
+	writeSCIM(w, http.StatusOK, scimGroup(role, members))
+}
+
+// PatchGroup adds, removes or replaces members of a role
+func (s *SCIM) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	role, ok := s.groupRole(w, r)
+	if !ok {
+		return
+	}
+	patch, ok := decodeSCIMPatch(w, r)
+	if !ok {
+		return
+	}
+	users, err := s.users.List(r.Context())
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "Group not found")
+		return
+	}
+	current := scimGroupMembers(users)[role]
+	ids := map[string]bool{}
+	for _, user := range current {
+		ids[user.ID] = true
+	}
+
+	for _, op := range patch.Operations {
+		path := strings.TrimSpace(op.Path)
+		var values []SCIMMember
+		if match := scimMemberFilter.FindStringSubmatch(path); match != nil {
+			id, _ := strconv.Unquote(match[1])
+			values = []SCIMMember{{Value: id}}
+			path = "members"
+		} else if strings.EqualFold(path, "members") && len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				writeSCIMError(w, r, http.StatusBadRequest, "invalidValue", "Invalid request body")
+				return
+			}
+		} else if path == "" && len(op.Value) > 0 {
+			// Okta sends the group's attributes as the value of a replace
+			var group SCIMGroup
+			if err := json.Unmarshal(op.Value, &group); err != nil {
+				writeSCIMError(w, r, http.StatusBadRequest, "invalidValue", "Invalid request body")
+				return
+			}
+			if group.DisplayName != "" && groupRole(group.DisplayName) != role {
+				writeSCIMError(w, r, http.StatusBadRequest, "mutability", "Groups can't be renamed")
+				return
+			}
+			if group.Members == nil {
+				continue
+			}
+			values, path = group.Members, "members"
+		}
+		if !strings.EqualFold(path, "members") {
+			writeSCIMError(w, r, http.StatusBadRequest, "invalidPath", "Only the members of a group can be patched")
+			return
+		}
+
+		switch strings.ToLower(op.Op) {
+		case "add":
+			for _, member := range values {
+				ids[member.Value] = true
+			}
+		case "remove":
+			if len(values) == 0 {
+				ids = map[string]bool{}
+			}
+			for _, member := range values {
+				delete(ids, member.Value)
+			}
+		case "replace":
+			ids = map[string]bool{}
+			for _, member := range values {
+				ids[member.Value] = true
+			}
+		default:
+			writeSCIMError(w, r, http.StatusBadRequest, "invalidSyntax", "Unknown patch operation")
+			return
+		}
+	}
+
+	wanted := make([]string, 0, len(ids))
+	for id := range ids {
+		wanted = append(wanted, id)
+	}
+	members, err := s.setMembers(r, role, current, wanted)
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "Group not found")
+		return
+	}
+	writeSCIM(w, http.StatusOK, scimGroup(role, members))
+}
+
+// DeleteGroup removes a role from all its members
+func (s *SCIM) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	role, ok := s.groupRole(w, r)
+	if !ok {
+		return
+	}
+	users, err := s.users.List(r.Context())
+	if err != nil {
+		writeSCIMStoreError(w, r, err, "Group not found")
+		return
+	}
+	current := scimGroupMembers(users)[role]
+	if current == nil {
+		writeSCIMError(w, r, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	if _, err := s.setMembers(r, role, current, nil); err != nil {
+		writeSCIMStoreError(w, r, err, "Group not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setMembers gives role to the users in ids and takes it from the other
+// current members, returning the new members. Unknown IDs fail with
+// a bad request before any user is changed.
+func (s *SCIM) setMembers(r *http.Request, role string, current []store.User, ids []string) ([]store.User, error) {
+	ctx := r.Context()
+	wanted := make(map[string]store.User, len(ids))
+	for _, id := range ids {
+		user, err := s.users.Get(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, errSCIMBadRequest("Group members must be existing users")
+		}
+		if err != nil {
+			return nil, err
+		}
+		wanted[id] = user
+	}
+
+	for _, user := range current {
+		if _, ok := wanted[user.ID]; ok {
+			continue
+		}
+		user.Roles = withoutRole(user.Roles, role)
+		if _, err := s.users.Update(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	members := make([]store.User, 0, len(wanted))
+	for _, user := range wanted {
+		if !hasRole(user.Roles, role) {
+			user.Roles = append(user.Roles, role)
+			updated, err := s.users.Update(ctx, user)
+			if err != nil {
+				return nil, err
+			}
+			user = updated
+		}
+		members = append(members, user)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Username < members[j].Username })
+	return members, nil
+}
+
+// groupRole returns the role named by the group ID in the path, writing a
+// 404 for IDs that can't be roles or are reserved ones
+func (s *SCIM) groupRole(w http.ResponseWriter, r *http.Request) (string, bool) {
+	role := mux.Vars(r)["id"]
+	if !validRole.MatchString(role) || scimReservedRole(role) {
+		writeSCIMError(w, r, http.StatusNotFound, "", "Group not found")
+		return "", false
+	}
+	return role, true
+}
+
+// groupRole maps a group's display name to a role name: lowercase, with
+// spaces as dashes
+func groupRole(displayName string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(displayName)), " ", "-")
+}
+
+// scimReservedRole reports whether role is one SCIM must not grant or
+// take away: admin, or the role of the SCIM token itself
+func scimReservedRole(role string) bool {
+	return role == auth.RoleAdmin || role == auth.RoleSCIM
+}
+
+// scimGroupMembers maps each assigned role but the reserved ones to the
+// users that have it
+func scimGroupMembers(users []store.User) map[string][]store.User {
+	members := map[string][]store.User{}
+	for _, user := range users {
+		for _, role := range user.Roles {
+			if scimReservedRole(role) {
+				continue
+			}
+			members[role] = append(members[role], user)
+		}
+	}
+	return members
+}
+
+func scimUser(user store.User) SCIMUser {
+	active := !user.Disabled
+	groups := make([]SCIMMember, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		if scimReservedRole(role) {
+			continue
+		}
+		groups = append(groups, SCIMMember{Value: role, Display: role})
+	}
+	return SCIMUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       user.ID,
+		UserName: user.Username,
+		Active:   &active,
+		Groups:   groups,
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      &user.CreatedAt,
+			LastModified: &user.UpdatedAt,
+			Location:     scimUsersLocation + user.ID,
+		},
+	}
+}
+
+func scimGroup(role string, users []store.User) SCIMGroup {
+	members := make([]SCIMMember, 0, len(users))
+	for _, user := range users {
+		members = append(members, SCIMMember{Value: user.ID, Display: user.Username})
+	}
+	return SCIMGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          role,
+		DisplayName: role,
+		Members:     members,
+		Meta:        &SCIMMeta{ResourceType: "Group", Location: scimGroupLocation + role},
+	}
+}
+
+func memberIDs(members []SCIMMember) []string {
+	ids := make([]string, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.Value)
+	}
+	return ids
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutRole(roles []string, role string) []string {
+	kept := make([]string, 0, len(roles))
+	for _, r := range roles {
+		if r != role {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// scimBool reads a boolean that Azure AD sends as the string "True" or
+// "False"
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+// scimFilterValue returns the lowercased attribute and value of the
+// request's eq filter, if any, writing a 400 for other filters
+func scimFilterValue(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	filter := r.URL.Query().Get("filter")
+	if filter == "" {
+		return "", "", true
+	}
+	match := scimFilter.FindStringSubmatch(filter)
+	var value string
+	var err error
+	if match != nil {
+		value, err = strconv.Unquote(match[2])
+	}
+	if match == nil || err != nil {
+		writeSCIMError(w, r, http.StatusBadRequest, "invalidFilter", `Only filters of the form attribute eq "value" are supported`)
+		return "", "", false
+	}
+	return strings.ToLower(match[1]), value, true
+}
+
+func decodeSCIMPatch(w http.ResponseWriter, r *http.Request) (SCIMPatch, bool) {
+	var patch SCIMPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || len(patch.Operations) == 0 {
+		writeSCIMError(w, r, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return SCIMPatch{}, false
+	}
+	return patch, true
+}
+
+// writeSCIMList writes the page of resources selected by the startIndex
+// (1-based) and count parameters
+func writeSCIMList[T any](w http.ResponseWriter, r *http.Request, resources []T) {
+	start, err := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	if err != nil || start < 1 {
+		start = 1
+	}
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil {
+		count = scimDefaultCount
+	}
+	count = min(max(count, 0), scimMaxCount)
+
+	page := resources[min(start-1, len(resources)):]
+	page = page[:min(count, len(page))]
+	writeSCIM(w, http.StatusOK, SCIMListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(resources),
+		StartIndex:   start,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+}
+
+func writeSCIM(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeSCIMError writes a SCIM error, translating detail like httperr
+func writeSCIMError(w http.ResponseWriter, r *http.Request, status int, scimType, detail string) {
+	lang := i18n.Locale(r)
+	w.Header().Set("Content-Language", lang.String())
+	w.Header().Add("Vary", "Accept-Language")
+	writeSCIM(w, status, SCIMError{
+		Schemas:  []string{scimErrorSchema},
+		Status:   strconv.Itoa(status),
+		SCIMType: scimType,
+		Detail:   i18n.Translate(lang, detail),
+	})
+}
+
+// writeSCIMStoreError maps patch and user repository errors to SCIM errors.
+// notFound is the detail for ErrNotFound.
+func writeSCIMStoreError(w http.ResponseWriter, r *http.Request, err error, notFound string) {
+	var badRequest errSCIMBadRequest
+	switch {
+	case errors.As(err, &badRequest):
+		writeSCIMError(w, r, http.StatusBadRequest, "invalidValue", string(badRequest))
+	case errors.Is(err, store.ErrNotFound):
+		writeSCIMError(w, r, http.StatusNotFound, "", notFound)
+	case errors.Is(err, store.ErrConflict):
+		writeSCIMError(w, r, http.StatusConflict, "uniqueness", "Username is already taken")
+	default:
+		logger.ErrorCtx(r.Context(), "SCIM user store error: %v", err)
+		writeSCIMError(w, r, http.StatusInternalServerError, "", "Internal server error")
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/seed"
+	"exampleserver/internal/store"
+	"exampleserver/internal/tasks"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+)
+
+// SeedTask is the task type of seeding the stores with fake data
+const SeedTask = "seed"
+
+// maxSeedRecords caps the users and customers of one seed request
+const maxSeedRecords = 10000
+
+// SeedRequest says how many fake users and customers to add. Seed makes the
+// data reproducible; leave it out for a random one.
+type SeedRequest struct {
+	Users     int    `json:"users"`
+	Customers int    `json:"customers"`
+	Password  string `json:"password,omitempty"`
+	Seed      int64  `json:"seed,omitempty"`
+}
+
+// Seed fills the stores with fake data for development and load tests
+type Seed struct {
+	store     *store.Store
+	passwords *auth.PasswordHasher
+	tasks     *tasks.Tracker
+}
+
+func NewSeed(st *store.Store, passwords *auth.PasswordHasher, tracker *tasks.Tracker) *Seed {
+	return &Seed{
+		store:     st,
+		passwords: passwords,
+		tasks:     tracker,
+	}
+}
+
+// Start queues the seeding. The task's result is a seed.Result; seeded
+// users sign in with the request's password.
+func (s *Seed) Start(w http.ResponseWriter, r *http.Request) {
+	var req SeedRequest
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Users < 0 || req.Customers < 0 || req.Users+req.Customers == 0 || req.Users+req.Customers > maxSeedRecords {
+		httperr.Writef(w, r, http.StatusBadRequest, "Seed between 1 and %d users and customers", maxSeedRecords)
+		return
+	}
+	if req.Users > 0 && len(req.Password) < auth.MinPasswordLength {
+		httperr.Write(w, r, http.StatusBadRequest, "Password is too short")
+		return
+	}
+
+	task, err := s.tasks.Submit(SeedTask, caller(r), 0, func(ctx context.Context, progress *tasks.Progress) (interface{}, error) {
+		result, err := seed.Run(ctx, s.store, s.passwords, seed.Options{
+			Users:     req.Users,
+			Customers: req.Customers,
+			Password:  req.Password,
+			Seed:      req.Seed,
+			Progress:  progress.Set,
+		})
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Seeded %d users and %d customers (seed %d)", result.Users, result.Customers, result.Seed)
+		return result, nil
+	})
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Failed to queue seeding: %v", err)
+		httperr.Write(w, r, http.StatusServiceUnavailable, "Too many background tasks, try again later")
+		return
+	}
+
+	writeAccepted(w, task)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"exampleserver/internal/health"
+	"exampleserver/internal/services"
+	"exampleserver/pkg/httperr"
+
+	"github.com/gorilla/mux"
+)
+
+// serviceControlTimeout bounds how long a stop or restart request waits for
+// the service to shut down
+const serviceControlTimeout = 30 * time.Second
+
+// ServicesResponse lists the managed background services and the health of
+// the server's dependencies
+type ServicesResponse struct {
+	Services     []services.Status `json:"services"`
+	Dependencies []health.Result   `json:"dependencies"`
+}
+
+type Services struct {
+	manager *services.Manager
+	health  *health.Checker
+}
+
+func NewServices(manager *services.Manager, health *health.Checker) *Services {
+	return &Services{
+		manager: manager,
+		health:  health,
+	}
+}
+
+// List returns the state, last error and restart count of every service,
+// and the last check of every dependency
+func (s *Services) List(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ServicesResponse{
+		Services:     s.manager.Status(),
+		Dependencies: s.health.Results(),
+	})
+}
+
+// Control stops, starts or restarts a single service
+func (s *Services) Control(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	ctx, cancel := context.WithTimeout(r.Context(), serviceControlTimeout)
+	defer cancel()
+
+	var err error
+	switch mux.Vars(r)["action"] {
+	case "start":
+		err = s.manager.StartService(name)
+	case "stop":
+		err = s.manager.StopService(ctx, name)
+	case "restart":
+		err = s.manager.RestartService(ctx, name)
+	default:
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid action. Must be one of: start, stop, restart")
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrServiceNotFound):
+		httperr.Write(w, r, http.StatusNotFound, "Service not found")
+		return
+	case errors.Is(err, services.ErrServiceRunning), errors.Is(err, services.ErrServiceNotRunning):
+		httperr.Write(w, r, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		httperr.Write(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, status := range s.manager.Status() {
+		if status.Name == name {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(status)
+			return
+		}
+	}
+}
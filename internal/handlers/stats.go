@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"exampleserver/internal/stats"
+	"exampleserver/internal/version"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/protobuf"
+	"exampleserver/pkg/render"
+)
+
+// ErrorsResponse lists the routes with the most errors over a window
+type ErrorsResponse struct {
+	Window string              `json:"window"`
+	Routes []stats.RouteErrors `json:"routes"`
+}
+
+// SLOResponse lists the routes' service level objectives
+type SLOResponse struct {
+	SLOs []stats.SLOStatus `json:"slos"`
+}
+
+// StatsSettings is the request and response body of the settings endpoint
+type StatsSettings struct {
+	Interval   string          `json:"interval,omitempty"`
+	Collectors map[string]bool `json:"collectors,omitempty"`
+}
+
+// RouteLatency is the request latency of a route over the last interval, in
+// milliseconds
+type RouteLatency struct {
+	Route string  `json:"route"`
+	Count uint64  `json:"count"`
+	Mean  float64 `json:"mean_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// StatsResponse is the latest stats sample with per-route latencies
+type StatsResponse struct {
+	StatsSample
+	Uptime  string         `json:"uptime"`
+	Build   version.Info   `json:"build"`
+	Latency []RouteLatency `json:"latency"`
+}
+
+// StatsSample is the JSON representation of a single stats sample
+type StatsSample struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Metrics   map[string]float64 `json:"metrics"`
+}
+
+type Stats struct {
+	service   *stats.StatsService
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewStats(service *stats.StatsService) *Stats {
+	return &Stats{
+		service: service,
+		closing: make(chan struct{}),
+	}
+}
+
+// CloseStreams ends every open stream with a shutdown event so it doesn't
+// hold up a graceful shutdown
+func (s *Stats) CloseStreams() {
+	s.closeOnce.Do(func() { close(s.closing) })
+}
+
+// Stream delivers every new stats sample as a server-sent event until the
+// client goes away or CloseStreams is called. Clients accepting MessagePack
+// or protobuf get the samples one after another in that encoding instead,
+// protobuf messages each preceded by its length.
+func (s *Stats) Stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httperr.Write(w, r, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	samples := s.service.Subscribe()
+	defer s.service.Unsubscribe(samples)
+
+	var binary render.Encoder
+	if enc, err := render.Negotiate(r); err == nil {
+		switch enc.(type) {
+		case render.MessagePack, render.Protobuf:
+			binary = enc
+		}
+	}
+
+	if binary != nil {
+		w.Header().Set("Content-Type", binary.MediaType())
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			// Tell the client to reconnect, which reaches another
+			// instance or this one after its restart. Binary streams
+			// just end.
+			if binary == nil {
+				fmt.Fprint(w, "retry: 1000\nevent: shutdown\ndata: {}\n\n")
+				flusher.Flush()
+			}
+			return
+		case sample, ok := <-samples:
+			if !ok {
+				return
+			}
+			message := StatsSample{
+				Timestamp: sample.Timestamp,
+				Metrics:   sample.Values(),
+			}
+			switch binary.(type) {
+			case nil:
+				data, err := json.Marshal(message)
+				if err != nil {
+					return
+				}
+				fmt.Fprintf(w, "event: stats\ndata: %s\n\n", data)
+			case render.Protobuf:
+				if protobuf.WriteDelimited(w, message) != nil {
+					return
+				}
+			default:
+				if binary.Encode(w, message) != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Errors returns per-route 4xx/5xx counts, worst offenders first
+func (s *Stats) Errors(w http.ResponseWriter, r *http.Request) {
+	window := 5 * time.Minute
+	if value := r.URL.Query().Get("window"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid window. Use a duration such as 5m or 1h")
+			return
+		}
+		window = d
+	}
+
+	limit := 10
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if _, err := fmt.Sscanf(value, "%d", &limit); err != nil || limit < 1 {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid limit. Must be a positive number")
+			return
+		}
+	}
+
+	routes := s.service.Requests().Errors(window)
+	if len(routes) > limit {
+		routes = routes[:limit]
+	}
+	if routes == nil {
+		routes = []stats.RouteErrors{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ErrorsResponse{
+		Window: window.String(),
+		Routes: routes,
+	})
+}
+
+// Diff compares the latest sample with one taken the duration given by
+// against earlier, 15 minutes by default
+func (s *Stats) Diff(w http.ResponseWriter, r *http.Request) {
+	against := 15 * time.Minute
+	if value := r.URL.Query().Get("against"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid against. Use a duration such as 15m or 1h")
+			return
+		}
+		against = d
+	}
+
+	diff, kept, ok := s.service.Diff(against)
+	if !ok {
+		httperr.Writef(w, r, http.StatusNotFound, "No stats sample is that old yet; samples go back %s", kept.Round(time.Second))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// SLO reports the error budgets and burn rates of the routes with an SLO
+func (s *Stats) SLO(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SLOResponse{SLOs: s.service.SLOs().Status()})
+}
+
+// GetSettings returns the current collection interval and collector states
+func (s *Stats) GetSettings(w http.ResponseWriter, r *http.Request) {
+	s.writeSettings(w)
+}
+
+// UpdateSettings changes the collection interval and enabled collectors
+// without restarting the service
+func (s *Stats) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	var req StatsSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validate everything before applying anything
+	var interval time.Duration
+	if req.Interval != "" {
+		d, err := time.ParseDuration(req.Interval)
+		if err != nil || d < time.Second {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid interval. Use a duration of at least 1s")
+			return
+		}
+		interval = d
+	}
+	current := s.service.Settings().Collectors
+	for name := range req.Collectors {
+		if _, ok := current[name]; !ok {
+			httperr.Writef(w, r, http.StatusBadRequest, "Unknown collector: %s", name)
+			return
+		}
+	}
+
+	if interval > 0 {
+		s.service.SetInterval(interval)
+	}
+	for name, enabled := range req.Collectors {
+		s.service.SetCollectorEnabled(name, enabled)
+	}
+
+	s.writeSettings(w)
+}
+
+func (s *Stats) writeSettings(w http.ResponseWriter) {
+	settings := s.service.Settings()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StatsSettings{
+		Interval:   settings.Interval.String(),
+		Collectors: settings.Collectors,
+	})
+}
+
+// Get returns the most recent stats sample
+func (s *Stats) Get(w http.ResponseWriter, r *http.Request) {
+	sample, ok := s.service.Latest()
+	if !ok {
+		httperr.Write(w, r, http.StatusServiceUnavailable, "No stats collected yet")
+		return
+	}
+
+	latency := make([]RouteLatency, 0, len(sample.Latency))
+	for route, summary := range sample.Latency {
+		latency = append(latency, RouteLatency{
+			Route: route,
+			Count: summary.Count,
+			Mean:  milliseconds(summary.Mean),
+			P50:   milliseconds(summary.P50),
+			P90:   milliseconds(summary.P90),
+			P99:   milliseconds(summary.P99),
+			Max:   milliseconds(summary.Max),
+		})
+	}
+	sort.Slice(latency, func(i, j int) bool { return latency[i].Route < latency[j].Route })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StatsResponse{
+		StatsSample: StatsSample{
+			Timestamp: sample.Timestamp,
+			Metrics:   sample.Values(),
+		},
+		Uptime:  sample.Uptime.Round(time.Second).String(),
+		Build:   sample.Build,
+		Latency: latency,
+	})
+}
+
+// Prometheus exposes the most recent sample in the Prometheus text format
+func (s *Stats) Prometheus(w http.ResponseWriter, r *http.Request) {
+	sample, ok := s.service.Latest()
+	if !ok {
+		httperr.Write(w, r, http.StatusServiceUnavailable, "No stats collected yet")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	stats.WritePrometheus(w, sample)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
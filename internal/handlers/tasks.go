@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/tasks"
+	"exampleserver/pkg/httperr"
+
+	"github.com/gorilla/mux"
+)
+
+// TasksResponse lists background tasks, newest first
+type TasksResponse struct {
+	Tasks []tasks.Task `json:"tasks"`
+}
+
+// Tasks reports the status of background tasks started by other endpoints
+type Tasks struct {
+	tracker *tasks.Tracker
+}
+
+func NewTasks(tracker *tasks.Tracker) *Tasks {
+	return &Tasks{
+		tracker: tracker,
+	}
+}
+
+// List returns the caller's tasks, or every task for admins
+func (t *Tasks) List(w http.ResponseWriter, r *http.Request) {
+	owner := caller(r)
+	if isAdmin(r) {
+		owner = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TasksResponse{
+		Tasks: t.tracker.List(owner),
+	})
+}
+
+// Get returns the progress, result or error of a task. Tasks started by
+// someone else are only visible to admins.
+func (t *Tasks) Get(w http.ResponseWriter, r *http.Request) {
+	task, err := t.tracker.Get(mux.Vars(r)["id"])
+	if errors.Is(err, tasks.ErrTaskNotFound) || (err == nil && task.Owner != caller(r) && !isAdmin(r)) {
+		httperr.Write(w, r, http.StatusNotFound, "Task not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// writeAccepted answers 202 with the status of a task just submitted, pointing
+// the client to where it can poll for the outcome
+func writeAccepted(w http.ResponseWriter, task tasks.Task) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/tasks/"+task.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(task)
+}
+
+// caller names the authenticated user, or "" for anonymous requests
+func caller(r *http.Request) string {
+	claims, ok := auth.GetClaims(r.Context())
+	if !ok {
+		return ""
+	}
+	if claims.Username != "" {
+		return claims.Username
+	}
+	return claims.Subject
+}
+
+func isAdmin(r *http.Request) bool {
+	claims, ok := auth.GetClaims(r.Context())
+	return ok && claims.HasRole(auth.RoleAdmin)
+}
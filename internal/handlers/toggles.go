@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"exampleserver/internal/store"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+)
+
+// ToggleSettings are the switches admins flip on a running server. They
+// are kept in the store, so they survive restarts.
+type ToggleSettings struct {
+	// Maintenance answers 503 to everything but probes, metrics, logins
+	// and the admin API
+	Maintenance  bool `json:"maintenance"`
+	DebugLogging bool `json:"debug_logging"`
+	// RateLimitMultiplier scales the rate limits of ROUTE_CONFIG, 0.5
+	// halving them and 2 doubling them
+	RateLimitMultiplier float64 `json:"rate_limit_multiplier"`
+	// MirrorPercent is the percentage of requests copied to MIRROR_URL, or
+	// 0 without a mirror upstream
+	MirrorPercent int `json:"mirror_percent"`
+}
+
+// ToggleSettingsUpdate changes the toggles given
+type ToggleSettingsUpdate struct {
+	Maintenance         *bool    `json:"maintenance,omitempty"`
+	DebugLogging        *bool    `json:"debug_logging,omitempty"`
+	RateLimitMultiplier *float64 `json:"rate_limit_multiplier,omitempty"`
+	MirrorPercent       *int     `json:"mirror_percent,omitempty"`
+}
+
+// Toggler applies, persists and audits toggle changes
+type Toggler interface {
+	Toggles() ToggleSettings
+	// SetToggles applies update on behalf of actor, returning the toggles
+	// as they are afterwards
+	SetToggles(ctx context.Context, update ToggleSettingsUpdate, actor string) (ToggleSettings, error)
+	// Mirroring reports whether there is a mirror upstream
+	Mirroring() bool
+}
+
+// maxRateLimitMultiplier caps how far the rate limits can be raised
+const maxRateLimitMultiplier = 100
+
+type Toggles struct {
+	toggler Toggler
+}
+
+func NewToggles(toggler Toggler) *Toggles {
+	return &Toggles{
+		toggler: toggler,
+	}
+}
+
+// Get returns the current toggles
+func (t *Toggles) Get(w http.ResponseWriter, r *http.Request) {
+	writeToggles(w, t.toggler.Toggles())
+}
+
+// Update changes the toggles given. Each change is stored, so it outlasts
+// a restart, and recorded in the audit log.
+func (t *Toggles) Update(w http.ResponseWriter, r *http.Request) {
+	var update ToggleSettingsUpdate
+	if err := decodeJSON(r, &update); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	switch {
+	case update.RateLimitMultiplier != nil && (*update.RateLimitMultiplier <= 0 || *update.RateLimitMultiplier > maxRateLimitMultiplier):
+		httperr.Writef(w, r, http.StatusBadRequest, "rate_limit_multiplier must be above 0 and at most %d", maxRateLimitMultiplier)
+		return
+	case update.MirrorPercent != nil && (*update.MirrorPercent < 0 || *update.MirrorPercent > 100):
+		httperr.Write(w, r, http.StatusBadRequest, "mirror_percent must be from 0 to 100")
+		return
+	case update.MirrorPercent != nil && !t.toggler.Mirroring():
+		httperr.Write(w, r, http.StatusConflict, "Traffic mirroring is off; set MIRROR_URL to turn it on")
+		return
+	}
+
+	toggles, err := t.toggler.SetToggles(r.Context(), update, caller(r))
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Failed to save toggles: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "Error saving toggles")
+		return
+	}
+	writeToggles(w, toggles)
+}
+
+func writeToggles(w http.ResponseWriter, toggles ToggleSettings) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toggles)
+}
+
+// AuditLogResponse lists audit log entries, newest first
+type AuditLogResponse struct {
+	Entries []store.AuditEntry `json:"entries"`
+}
+
+type AuditLog struct {
+	repo store.AuditRepository
+}
+
+func NewAuditLog(repo store.AuditRepository) *AuditLog {
+	return &AuditLog{
+		repo: repo,
+	}
+}
+
+// List returns the latest audit entries, of one target with ?target=
+func (a *AuditLog) List(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if _, err := fmt.Sscanf(value, "%d", &limit); err != nil || limit < 1 {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid limit. Must be a positive number")
+			return
+		}
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	entries, err := a.repo.List(r.Context(), r.URL.Query().Get("target"), limit)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	if entries == nil {
+		entries = []store.AuditEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditLogResponse{
+		Entries: entries,
+	})
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"runtime/trace"
+	"strconv"
+	"sync"
+	"time"
+
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+)
+
+// defaultTraceDuration is how long a trace runs when the request doesn't
+// say
+const defaultTraceDuration = 10 * time.Second
+
+// TraceRequest starts an execution trace
+type TraceRequest struct {
+	// Seconds the trace runs for unless stopped, capped by
+	// TRACE_MAX_DURATION (default 10)
+	Seconds int `json:"seconds,omitempty"`
+}
+
+// TraceStatus describes the running or last execution trace
+type TraceStatus struct {
+	Running   bool       `json:"running"`
+	StartedBy string     `json:"started_by,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// EndsAt is when a running trace stops by itself
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+	// Bytes is the size of a finished trace
+	Bytes int `json:"bytes"`
+	// SizeLimited is set when the trace stopped on reaching the maximum size
+	SizeLimited bool `json:"size_limited,omitempty"`
+}
+
+// Trace captures runtime execution traces for `go tool trace`. One trace
+// runs at a time, for at most maxDuration and until it reaches maxSize
+// bytes, and the last one is kept in memory for download.
+type Trace struct {
+	maxDuration time.Duration
+	maxSize     int64
+
+	mu     sync.Mutex
+	buf    *traceBuffer
+	timer  *time.Timer
+	status TraceStatus
+}
+
+func NewTrace(maxDuration time.Duration, maxSize int64) *Trace {
+	return &Trace{maxDuration: maxDuration, maxSize: maxSize}
+}
+
+// traceBuffer holds a trace in memory, calling full once it reaches max
+// bytes. The runtime keeps writing what it has buffered until the trace is
+// stopped, so it may end up a little larger.
+type traceBuffer struct {
+	bytes.Buffer
+	max  int64
+	full func()
+	once sync.Once
+}
+
+func (b *traceBuffer) Write(p []byte) (int, error) {
+	n, err := b.Buffer.Write(p)
+	if int64(b.Len()) >= b.max {
+		// Stopping waits for the runtime's writes, this one included
+		b.once.Do(func() { go b.full() })
+	}
+	return n, err
+}
+
+// Start begins a trace, replacing the last one
+func (t *Trace) Start(w http.ResponseWriter, r *http.Request) {
+	var req TraceRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil || req.Seconds < 0 {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	duration := defaultTraceDuration
+	if req.Seconds > 0 {
+		duration = time.Duration(req.Seconds) * time.Second
+	}
+	if duration > t.maxDuration {
+		duration = t.maxDuration
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status.Running {
+		httperr.Write(w, r, http.StatusConflict, "A trace is already running")
+		return
+	}
+	buf := &traceBuffer{max: t.maxSize}
+	buf.full = func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.buf == buf && t.status.Running {
+			t.timer.Stop()
+			t.status.SizeLimited = true
+			logger.Warn("Execution trace reached %d bytes, stopping it early", buf.max)
+			t.stop()
+		}
+	}
+	if err := trace.Start(buf); err != nil {
+		// Another tracer, such as net/http/pprof, owns the runtime's trace
+		httperr.Writef(w, r, http.StatusConflict, "Could not start a trace: %v", err)
+		return
+	}
+
+	now := time.Now()
+	ends := now.Add(duration)
+	t.buf = buf
+	t.status = TraceStatus{Running: true, StartedBy: caller(r), StartedAt: &now, EndsAt: &ends}
+	t.timer = time.AfterFunc(duration, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		// A trace stopped early may have been replaced since
+		if t.buf == buf {
+			t.stop()
+		}
+	})
+	logger.InfoCtx(r.Context(), "Execution trace started by %s for %s", t.status.StartedBy, duration)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(t.status)
+}
+
+// Stop ends the running trace early
+func (t *Trace) Stop(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.status.Running {
+		httperr.Write(w, r, http.StatusConflict, "No trace is running")
+		return
+	}
+	t.timer.Stop()
+	t.stop()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.status)
+}
+
+// stop ends the trace; t.mu must be held
+func (t *Trace) stop() {
+	if !t.status.Running {
+		return
+	}
+	trace.Stop()
+	now := time.Now()
+	t.status.Running = false
+	t.status.EndsAt = nil
+	t.status.StoppedAt = &now
+	t.status.Bytes = t.buf.Len()
+	logger.Info("Execution trace stopped: %d bytes", t.status.Bytes)
+}
+
+// Status reports the running or last trace
+func (t *Trace) Status(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	status := t.status
+	t.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// Download returns the last finished trace, for `go tool trace`
+func (t *Trace) Download(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	running, buf, started := t.status.Running, t.buf, t.status.StartedAt
+	t.mu.Unlock()
+	switch {
+	case running:
+		httperr.Write(w, r, http.StatusConflict, "The trace is still running")
+		return
+	case buf == nil:
+		httperr.Write(w, r, http.StatusNotFound, "No trace has been captured")
+		return
+	}
+
+	// A finished trace isn't written to again, so it can be sent unlocked
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="trace-`+started.UTC().Format("20060102-150405")+`.out"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
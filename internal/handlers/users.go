@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+	"exampleserver/pkg/mail"
+	"exampleserver/pkg/render"
+
+	"github.com/gorilla/mux"
+)
+
+// UsersResponse lists the user accounts
+type UsersResponse struct {
+	XMLName xml.Name     `json:"-" xml:"users"`
+	Users   []store.User `json:"users" xml:"user"`
+}
+
+// UserRequest is the request body for creating a user
+type UserRequest struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Email    string   `json:"email,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	Tenants  []string `json:"tenants,omitempty"`
+}
+
+// UserPatch is the request body for disabling a user, changing its roles or
+// tenants or setting its email address
+type UserPatch struct {
+	Disabled *bool     `json:"disabled,omitempty"`
+	Email    *string   `json:"email,omitempty"`
+	Roles    *[]string `json:"roles,omitempty"`
+	Tenants  *[]string `json:"tenants,omitempty"`
+}
+
+// PasswordResetResponse carries the link of a forced reset, on which the
+// user chooses a new password, and when it expires. Emailed reports whether
+// it was also queued for the user by email.
+type PasswordResetResponse struct {
+	Link    string    `json:"link"`
+	Expires time.Time `json:"expires"`
+	Emailed bool      `json:"emailed"`
+}
+
+// PasswordResetScope is the scope password reset links are signed for
+const PasswordResetScope = "password-reset"
+
+// passwordResetLinkTTL is how long a password reset link is valid
+const passwordResetLinkTTL = 24 * time.Hour
+
+var (
+	validUsername = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,100}$`)
+	validRole     = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+)
+
+// Users serves the admin endpoints managing user accounts
+type Users struct {
+	repo      store.UserRepository
+	passwords *auth.PasswordHasher
+	mailer    *mail.Mailer // nil when email isn't configured
+	links     *auth.URLSigner
+	publicURL string
+}
+
+// NewUsers signs password reset links with links, as links to the password
+// reset page under publicURL
+func NewUsers(repo store.UserRepository, passwords *auth.PasswordHasher, mailer *mail.Mailer, links *auth.URLSigner, publicURL string) *Users {
+	return &Users{repo: repo, passwords: passwords, mailer: mailer, links: links, publicURL: publicURL}
+}
+
+// List returns every user
+func (u *Users) List(w http.ResponseWriter, r *http.Request) {
+	users, err := u.repo.List(r.Context())
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+
+	render.Write(w, r, http.StatusOK, UsersResponse{
+		Users: users,
+	})
+}
+
+// Get returns a single user
+func (u *Users) Get(w http.ResponseWriter, r *http.Request) {
+	user, err := u.repo.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	writeUser(w, r, http.StatusOK, user)
+}
+
+// Create adds a user with the given password and roles
+func (u *Users) Create(w http.ResponseWriter, r *http.Request) {
+	var req UserRequest
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if !validUsername.MatchString(req.Username) {
+		httperr.Write(w, r, http.StatusBadRequest, "Username must be 1 to 100 letters, digits or . _ @ -")
+		return
+	}
+	if len(req.Password) < auth.MinPasswordLength {
+		httperr.Write(w, r, http.StatusBadRequest, "Password is too short")
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email != "" && !validEmail(req.Email) {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+	if role, ok := invalidRole(req.Roles); ok {
+		httperr.Writef(w, r, http.StatusBadRequest, invalidRoleMessage, role)
+		return
+	}
+	if tenant, ok := invalidRole(req.Tenants); ok {
+		httperr.Writef(w, r, http.StatusBadRequest, invalidTenantMessage, tenant)
+		return
+	}
+
+	hash, err := u.passwords.Hash(req.Password)
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	roles := req.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	user, err := u.repo.Create(r.Context(), store.User{
+		Username:     req.Username,
+		Email:        req.Email,
+		Roles:        roles,
+		Tenants:      req.Tenants,
+		PasswordHash: hash,
+	})
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/admin/users/"+user.ID)
+	writeUser(w, r, http.StatusCreated, user)
+}
+
+// Update disables or enables a user, replaces its roles or tenants or sets
+// its email address. Disabling a user also revokes its sessions.
+func (u *Users) Update(w http.ResponseWriter, r *http.Request) {
+	var req UserPatch
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Roles != nil {
+		if role, ok := invalidRole(*req.Roles); ok {
+			httperr.Writef(w, r, http.StatusBadRequest, invalidRoleMessage, role)
+			return
+		}
+	}
+	if req.Tenants != nil {
+		if tenant, ok := invalidRole(*req.Tenants); ok {
+			httperr.Writef(w, r, http.StatusBadRequest, invalidTenantMessage, tenant)
+			return
+		}
+	}
+	if req.Email != nil {
+		*req.Email = strings.TrimSpace(*req.Email)
+		if *req.Email != "" && !validEmail(*req.Email) {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid email address")
+			return
+		}
+	}
+
+	u.modify(w, r, func(user *store.User) (interface{}, error) {
+		if req.Disabled != nil {
+			if *req.Disabled && !user.Disabled {
+				user.SessionVersion++
+			}
+			user.Disabled = *req.Disabled
+		}
+		if req.Roles != nil {
+			user.Roles = append([]string{}, *req.Roles...)
+		}
+		if req.Tenants != nil {
+			user.Tenants = append([]string{}, *req.Tenants...)
+		}
+		if req.Email != nil {
+			user.Email = *req.Email
+		}
+		return nil, nil
+	})
+}
+
+// ResetPassword replaces a user's password with a random one nobody is
+// told, so the user can't log in again until choosing a new one on the page
+// of the reset link returned. The user's sessions are revoked. When email is
+// configured and the user has an address, the link is also mailed to the
+// user. It works once, until it expires, as it names the password hash it
+// was issued for: it never works if storing the reset fails.
+func (u *Users) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	u.modify(w, r, func(user *store.User) (interface{}, error) {
+		password, err := auth.RandomPassword()
+		if err != nil {
+			return nil, err
+		}
+		if user.PasswordHash, err = u.passwords.Hash(password); err != nil {
+			return nil, err
+		}
+		user.MustResetPassword = true
+		user.SessionVersion++
+
+		expires := time.Now().Add(passwordResetLinkTTL).Truncate(time.Second)
+		response := PasswordResetResponse{
+			Link: u.publicURL + u.links.Sign("/reset-password", url.Values{
+				"user": {user.ID},
+				"key":  {passwordResetKey(user.PasswordHash)},
+			}, PasswordResetScope, expires),
+			Expires: expires,
+		}
+		if u.mailer != nil && user.Email != "" {
+			// A failure is logged by the mailer; the admin still has the
+			// link to pass on
+			response.Emailed = u.mailer.QueueTemplate([]string{user.Email}, "password-reset", map[string]interface{}{
+				"Username": user.Username,
+				"Link":     response.Link,
+				"Expires":  expires,
+			}) == nil
+		}
+		return response, nil
+	})
+}
+
+// passwordResetKey names the password hash a reset link was issued for, so
+// setting a password with the link, which replaces the hash, ends it
+func passwordResetKey(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// RevokeSessions invalidates every token issued to the user
+func (u *Users) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	user, err := u.repo.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	user.SessionVersion++
+	if _, err := u.repo.Update(r.Context(), user); err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// modify loads the user named in the path, applies change and stores the
+// result. The response is the value returned by change, or the updated user
+// when that is nil.
+func (u *Users) modify(w http.ResponseWriter, r *http.Request, change func(user *store.User) (interface{}, error)) {
+	user, err := u.repo.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	response, err := change(&user)
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	user, err = u.repo.Update(r.Context(), user)
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+
+	if response == nil {
+		response = user
+	}
+	render.Write(w, r, http.StatusOK, response)
+}
+
+const (
+	invalidRoleMessage   = "Invalid role %s. Roles are 1 to 50 lowercase letters, digits, _ or -"
+	invalidTenantMessage = "Invalid tenant %s. Tenants are 1 to 50 lowercase letters, digits, _ or -"
+)
+
+// invalidRole returns the first malformed role or tenant, if any
+func invalidRole(roles []string) (string, bool) {
+	for _, role := range roles {
+		if !validRole.MatchString(role) {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+func writeUser(w http.ResponseWriter, r *http.Request, status int, user store.User) {
+	render.Write(w, r, status, user)
+}
+
+// writeUserError maps user repository errors to HTTP responses
+func writeUserError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		httperr.Write(w, r, http.StatusNotFound, "User not found")
+	case errors.Is(err, store.ErrConflict):
+		httperr.Write(w, r, http.StatusConflict, "Username is already taken")
+	default:
+		logger.ErrorCtx(r.Context(), "User store error: %v", err)
+		httperr.Write(w, r, http.StatusInternalServerError, "Internal server error")
+	}
+}
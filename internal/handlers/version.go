@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"exampleserver/internal/version"
+)
+
+// VersionResponse identifies the deployed build and what it has enabled
+type VersionResponse struct {
+	version.Info
+	Features []string `json:"features"`
+}
+
+type Version struct {
+	features []string
+}
+
+func NewVersion(features []string) *Version {
+	return &Version{
+		features: features,
+	}
+}
+
+// Get returns the build info and enabled features
+func (v *Version) Get(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VersionResponse{
+		Info:     version.Get(),
+		Features: v.features,
+	})
+}
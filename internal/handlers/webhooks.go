@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"exampleserver/internal/webhooks"
+	"exampleserver/pkg/httperr"
+
+	"github.com/gorilla/mux"
+)
+
+// WebhookRequest is the request body for registering a webhook
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"` // generated when omitted
+}
+
+// WebhooksResponse lists the registered webhooks
+type WebhooksResponse struct {
+	Webhooks []webhooks.Subscription `json:"webhooks"`
+}
+
+// DeliveriesResponse lists recent delivery attempts, most recent first
+type DeliveriesResponse struct {
+	Deliveries []webhooks.Delivery `json:"deliveries"`
+}
+
+type Webhooks struct {
+	dispatcher *webhooks.Dispatcher
+}
+
+func NewWebhooks(dispatcher *webhooks.Dispatcher) *Webhooks {
+	return &Webhooks{
+		dispatcher: dispatcher,
+	}
+}
+
+// Create registers a webhook. The response is the only time the secret is
+// returned.
+func (h *Webhooks) Create(w http.ResponseWriter, r *http.Request) {
+	var req WebhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	sub, err := h.dispatcher.Subscribe(r.Context(), webhooks.Subscription{
+		URL:    req.URL,
+		Events: req.Events,
+		Secret: req.Secret,
+	})
+	if errors.Is(err, webhooks.ErrInvalidSubscription) {
+		httperr.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		httperr.Write(w, r, http.StatusInternalServerError, "Failed to register webhook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/webhooks/"+sub.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// List returns the registered webhooks without their secrets
+func (h *Webhooks) List(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(WebhooksResponse{
+		Webhooks: h.dispatcher.Subscriptions(),
+	})
+}
+
+// Delete removes a webhook
+func (h *Webhooks) Delete(w http.ResponseWriter, r *http.Request) {
+	err := h.dispatcher.Unsubscribe(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, webhooks.ErrSubscriptionNotFound) {
+		httperr.Write(w, r, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		httperr.Write(w, r, http.StatusInternalServerError, "Failed to remove webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries returns the delivery log of a webhook
+func (h *Webhooks) Deliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.dispatcher.Deliveries(mux.Vars(r)["id"])
+	if errors.Is(err, webhooks.ErrSubscriptionNotFound) {
+		httperr.Write(w, r, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DeliveriesResponse{
+		Deliveries: deliveries,
+	})
+}
@@ -0,0 +1,219 @@
+// Package health checks the dependencies of the server, such as its
+// database, on a schedule so readiness can reflect them
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"exampleserver/pkg/logger"
+)
+
+// Check probes a dependency
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+	// Timeout bounds each run, the checker's default when zero
+	Timeout time.Duration
+	// Critical dependencies fail readiness while they are unhealthy
+	Critical bool
+}
+
+// Result is the outcome of a dependency's last check
+type Result struct {
+	Name      string    `json:"name"`
+	Critical  bool      `json:"critical"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	Latency   string    `json:"latency"`
+	CheckedAt time.Time `json:"checked_at"`
+	// FailingSince is when the dependency became unhealthy
+	FailingSince *time.Time `json:"failing_since,omitempty"`
+}
+
+// Checker is a service running every check each interval, all at once
+type Checker struct {
+	interval time.Duration
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	checks  []Check
+	results map[string]Result
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	logger logger.LoggerInterface
+}
+
+// NewChecker creates a checker running checks every interval, giving those
+// without a timeout of their own timeout long
+func NewChecker(interval, timeout time.Duration, logger logger.LoggerInterface) *Checker {
+	return &Checker{
+		interval: interval,
+		timeout:  timeout,
+		results:  make(map[string]Result),
+		logger:   logger,
+	}
+}
+
+// Register adds a check, replacing any of the same name. Checks registered
+// while the checker runs are first run on the next interval.
+func (c *Checker) Register(check Check) {
+	if check.Timeout <= 0 {
+		check.Timeout = c.timeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, existing := range c.checks {
+		if existing.Name == check.Name {
+			c.checks[i] = check
+			delete(c.results, check.Name)
+			return
+		}
+	}
+	c.checks = append(c.checks, check)
+}
+
+// Name identifies the service to the service manager
+func (c *Checker) Name() string {
+	return "health"
+}
+
+// Start runs the checks right away and then every interval until ctx is
+// cancelled or Stop is called
+func (c *Checker) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer close(done)
+
+	c.mu.Lock()
+	c.cancel = cancel
+	c.done = done
+	c.mu.Unlock()
+	defer cancel()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.runChecks(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop ends the checks, keeping the last results
+func (c *Checker) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	c.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runChecks runs every check concurrently and records the results, logging
+// dependencies becoming unhealthy and recovering
+func (c *Checker) runChecks(ctx context.Context) {
+	c.mu.Lock()
+	checks := append([]Check(nil), c.checks...)
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, check.Timeout)
+			defer cancel()
+			start := time.Now()
+			err := check.Run(checkCtx)
+			if ctx.Err() != nil {
+				return
+			}
+			c.record(check, err, start, time.Since(start))
+		}(check)
+	}
+	wg.Wait()
+}
+
+func (c *Checker) record(check Check, err error, start time.Time, latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, checked := c.results[check.Name]
+	result := Result{
+		Name:      check.Name,
+		Critical:  check.Critical,
+		Healthy:   err == nil,
+		Latency:   latency.Round(time.Millisecond).String(),
+		CheckedAt: start,
+	}
+	switch {
+	case err == nil:
+		if checked && !previous.Healthy {
+			c.logger.Info("[Health] Dependency %s recovered", check.Name)
+		}
+	default:
+		result.Error = err.Error()
+		result.FailingSince = &start
+		if checked && !previous.Healthy {
+			result.FailingSince = previous.FailingSince
+		} else if check.Critical {
+			c.logger.Error("[Health] Critical dependency %s is unhealthy: %v", check.Name, err)
+		} else {
+			c.logger.Warn("[Health] Dependency %s is unhealthy: %v", check.Name, err)
+		}
+	}
+	c.results[check.Name] = result
+}
+
+// Results returns the last result of every check, by name. Checks that
+// haven't run yet are left out.
+func (c *Checker) Results() []Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := make([]Result, 0, len(c.results))
+	for _, result := range c.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// Ready returns an error while a critical dependency is unhealthy or hasn't
+// been checked yet
+func (c *Checker) Ready() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, check := range c.checks {
+		if !check.Critical {
+			continue
+		}
+		result, ok := c.results[check.Name]
+		switch {
+		case !ok:
+			return fmt.Errorf("dependency %s not checked yet", check.Name)
+		case !result.Healthy:
+			return fmt.Errorf("dependency %s is unhealthy: %s", check.Name, result.Error)
+		}
+	}
+	return nil
+}
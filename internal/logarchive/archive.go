@@ -0,0 +1,166 @@
+// Package logarchive moves rotated log backups off the host into object
+// storage once they are old enough that they are unlikely to be read locally,
+// and exports time ranges of the log there on request
+package logarchive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"exampleserver/internal/services"
+)
+
+// backupTimeFormat is the timestamp lumberjack puts in backup file names
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// BlobStore stores objects under keys in a bucket. S3 and GCS implement it.
+type BlobStore interface {
+	// Upload streams body to the bucket under key. It may read body more
+	// than once, seeking back to the start.
+	Upload(ctx context.Context, key string, body io.ReadSeeker) error
+	// List returns the keys of the objects under prefix, sorted
+	List(ctx context.Context, prefix string) ([]string, error)
+	// URL names the object stored under key, such as s3://bucket/key
+	URL(key string) string
+	// Check verifies that the bucket exists and the credentials are
+	// accepted
+	Check(ctx context.Context) error
+}
+
+// Backup is a rotated log file
+type Backup struct {
+	Path      string
+	RotatedAt time.Time
+}
+
+// Archiver uploads the backups of a log file and removes local copies
+type Archiver struct {
+	logFile string
+	prefix  string
+	after   time.Duration
+	store   BlobStore
+}
+
+// NewArchiver archives backups of logFile rotated longer ago than after,
+// storing them under prefix
+func NewArchiver(logFile, prefix string, after time.Duration, store BlobStore) *Archiver {
+	return &Archiver{
+		logFile: logFile,
+		prefix:  prefix,
+		after:   after,
+		store:   store,
+	}
+}
+
+// Backups lists the rotated backups of the log file, oldest first. The
+// active log file is never included.
+func (a *Archiver) Backups() ([]Backup, error) {
+	dir := filepath.Dir(a.logFile)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		rotated, ok := rotatedAt(a.logFile, entry.Name())
+		if !ok {
+			continue
+		}
+		backups = append(backups, Backup{
+			Path:      filepath.Join(dir, entry.Name()),
+			RotatedAt: rotated,
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].RotatedAt.Before(backups[j].RotatedAt)
+	})
+	return backups, nil
+}
+
+// Run archives every backup old enough, deleting each local copy once it
+// has been uploaded. It is run by the scheduler and reports how many
+// backups were archived.
+func (a *Archiver) Run(ctx context.Context) error {
+	backups, err := a.Backups()
+	if err != nil {
+		return fmt.Errorf("listing log backups: %w", err)
+	}
+
+	cutoff := time.Now().Add(-a.after)
+	archived, bytes := 0, 0
+	for _, backup := range backups {
+		if backup.RotatedAt.After(cutoff) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		size, err := a.upload(ctx, backup)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(backup.Path); err != nil {
+			return fmt.Errorf("removing archived %s: %w", backup.Path, err)
+		}
+		archived++
+		bytes += int(size)
+	}
+
+	services.ReportJob(ctx, "archived %d of %d backups (%d bytes)", archived, len(backups), bytes)
+	return nil
+}
+
+// upload streams a backup to the bucket and returns its size
+func (a *Archiver) upload(ctx context.Context, backup Backup) (int64, error) {
+	file, err := os.Open(backup.Path)
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %w", backup.Path, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %w", backup.Path, err)
+	}
+	if err := a.store.Upload(ctx, archiveKey(a.prefix, backup), file); err != nil {
+		return 0, fmt.Errorf("archiving %s: %w", backup.Path, err)
+	}
+	return info.Size(), nil
+}
+
+// archiveKey is where a backup is archived:
+// <prefix>/<yyyy>/<mm>/<dd>/<file name>
+func archiveKey(prefix string, backup Backup) string {
+	return path.Join(prefix, backup.RotatedAt.Format("2006/01/02"), filepath.Base(backup.Path))
+}
+
+// rotatedAt parses the rotation time out of the name of a backup of
+// logFile, such as app-2006-01-02T15-04-05.000.log.gz
+func rotatedAt(logFile, name string) (time.Time, bool) {
+	ext := filepath.Ext(logFile)
+	stamp, ok := strings.CutPrefix(strings.TrimSuffix(name, ".gz"), strings.TrimSuffix(filepath.Base(logFile), ext)+"-")
+	if !ok || !strings.HasSuffix(stamp, ext) {
+		return time.Time{}, false
+	}
+	rotated, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, ext))
+	return rotated, err == nil
+}
+
+// size returns the length of body, leaving it at the start
+func size(body io.ReadSeeker) (int64, error) {
+	n, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	_, err = body.Seek(0, io.SeekStart)
+	return n, err
+}
@@ -0,0 +1,173 @@
+package logarchive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"exampleserver/pkg/logger"
+)
+
+// exportTimeFormat names the bounds of an export in its key
+const exportTimeFormat = "20060102T150405Z"
+
+// ExportResult describes an export written to the blob store
+type ExportResult struct {
+	URL     string `json:"url"`
+	Entries int    `json:"entries"`
+	Bytes   int    `json:"bytes"`
+	// Archived lists the backups already moved to the bucket by the
+	// archiver that may hold entries of the range. Their entries aren't in
+	// the export.
+	Archived []string `json:"archived"`
+}
+
+// Exporter writes time ranges of a log, including its rotated backups still
+// on the host, to a blob store as gzipped NDJSON for compliance archiving.
+// Backups the archiver has already moved to the blob store aren't read
+// again; the result lists them.
+type Exporter struct {
+	logFile string
+	prefix  string
+	store   BlobStore
+}
+
+// NewExporter exports entries of logFile under prefix/exports/
+func NewExporter(logFile, prefix string, store BlobStore) *Exporter {
+	return &Exporter{
+		logFile: logFile,
+		prefix:  prefix,
+		store:   store,
+	}
+}
+
+// Export writes the entries logged between from and to, one JSON object per
+// line, to <prefix>/exports/<from>-<to>.ndjson.gz. The export is written to
+// a temporary file and streamed from there, so its size isn't bounded by
+// memory. progress is called with the steps done out of the total: one per
+// log file read and the upload.
+func (e *Exporter) Export(ctx context.Context, from, to time.Time, progress func(done, total int)) (ExportResult, error) {
+	archived, err := e.archived(ctx, from, to)
+	if err != nil {
+		return ExportResult{}, fmt.Errorf("listing archived backups: %w", err)
+	}
+
+	file, err := os.CreateTemp("", "log-export-*.ndjson.gz")
+	if err != nil {
+		return ExportResult{}, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	total := 1
+	entries, err := WriteExport(ctx, file, e.logFile, from, to, func(done, files int) {
+		total = files + 1
+		progress(done, total)
+	})
+	if err != nil {
+		return ExportResult{}, err
+	}
+	n, err := size(file)
+	if err != nil {
+		return ExportResult{}, err
+	}
+
+	key := path.Join(e.prefix, "exports", from.UTC().Format(exportTimeFormat)+"-"+to.UTC().Format(exportTimeFormat)+".ndjson.gz")
+	if err := e.store.Upload(ctx, key, file); err != nil {
+		return ExportResult{}, err
+	}
+	progress(total, total)
+	return ExportResult{URL: e.store.URL(key), Entries: entries, Bytes: int(n), Archived: archived}, nil
+}
+
+// archived returns the URLs of the archived backups that may hold entries
+// logged between from and to: those rotated since from, up to the first
+// rotated after to
+func (e *Exporter) archived(ctx context.Context, from, to time.Time) ([]string, error) {
+	keys, err := e.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, key := range keys {
+		if rotated, ok := rotatedAt(e.logFile, path.Base(key)); ok && !rotated.Before(from) {
+			backups = append(backups, Backup{Path: key, RotatedAt: rotated})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].RotatedAt.Before(backups[j].RotatedAt)
+	})
+
+	urls := []string{}
+	for _, backup := range backups {
+		urls = append(urls, e.store.URL(backup.Path))
+		if backup.RotatedAt.After(to) {
+			break
+		}
+	}
+	return urls, nil
+}
+
+// Objects returns the URLs of every archived backup and export in the blob
+// store
+func (e *Exporter) Objects(ctx context.Context) ([]string, error) {
+	keys, err := e.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, len(keys))
+	for i, key := range keys {
+		urls[i] = e.store.URL(key)
+	}
+	return urls, nil
+}
+
+// list returns the keys under the prefix
+func (e *Exporter) list(ctx context.Context) ([]string, error) {
+	prefix := e.prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+	return e.store.List(ctx, prefix)
+}
+
+// WriteExport writes the entries of logFile and its rotated backups logged
+// between from and to to w as gzipped NDJSON, returning how many were
+// written. progress is called after each log file read.
+func WriteExport(ctx context.Context, w io.Writer, logFile string, from, to time.Time, progress func(done, total int)) (int, error) {
+	files, err := logger.LogFiles(logFile, from)
+	if err != nil {
+		return 0, err
+	}
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	entries := 0
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return entries, err
+		}
+		var encErr error
+		err := logger.ScanLogFile(file, func(entry logger.LogEntry) {
+			if encErr != nil || entry.Timestamp.Before(from) || entry.Timestamp.After(to) {
+				return
+			}
+			encErr = enc.Encode(entry)
+			entries++
+		})
+		if err == nil {
+			err = encErr
+		}
+		if err != nil {
+			return entries, fmt.Errorf("exporting %s: %w", path.Base(file), err)
+		}
+		progress(i+1, len(files))
+	}
+	return entries, gz.Close()
+}
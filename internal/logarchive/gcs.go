@@ -0,0 +1,155 @@
+package logarchive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// GCSConfig locates a Google Cloud Storage bucket. Credentials come from
+// CredentialsFile when set, otherwise from Application Default Credentials.
+type GCSConfig struct {
+	Bucket          string
+	CredentialsFile string
+}
+
+const (
+	gcsUploadURL = "https://storage.googleapis.com/upload/storage/v1/b/"
+	gcsBucketURL = "https://storage.googleapis.com/storage/v1/b/"
+	gcsScope     = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// GCS uploads objects to a Cloud Storage bucket with the JSON API
+type GCS struct {
+	config GCSConfig
+	client *http.Client
+}
+
+// NewGCS finds credentials for writing to the bucket
+func NewGCS(ctx context.Context, config GCSConfig) (*GCS, error) {
+	var creds *google.Credentials
+	var err error
+	if config.CredentialsFile != "" {
+		var data []byte
+		if data, err = os.ReadFile(config.CredentialsFile); err != nil {
+			return nil, fmt.Errorf("reading gcs credentials: %w", err)
+		}
+		creds, err = google.CredentialsFromJSON(ctx, data, gcsScope)
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, gcsScope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("finding gcs credentials: %w", err)
+	}
+
+	// The token source refreshes on its own schedule, so it must not be tied
+	// to ctx
+	client := oauth2.NewClient(context.Background(), creds.TokenSource)
+	client.Timeout = 5 * time.Minute
+	return &GCS{config: config, client: client}, nil
+}
+
+// Upload streams body to the bucket under key
+func (g *GCS) Upload(ctx context.Context, key string, body io.ReadSeeker) error {
+	length, err := size(body)
+	if err != nil {
+		return err
+	}
+	target := gcsUploadURL + url.PathEscape(g.config.Bucket) + "/o?uploadType=media&name=" + url.QueryEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("gcs upload %s: %s: %s", key, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// Check fetches the bucket's metadata
+func (g *GCS) Check(ctx context.Context) error {
+	target := gcsBucketURL + url.PathEscape(g.config.Bucket) + "?fields=name"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("gcs get bucket %s: %s: %s", g.config.Bucket, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// List pages through the names of the objects under prefix
+func (g *GCS) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+		if token != "" {
+			query.Set("pageToken", token)
+		}
+		target := gcsBucketURL + url.PathEscape(g.config.Bucket) + "/o?" + query.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := g.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			resp.Body.Close()
+			return nil, fmt.Errorf("gcs list %s: %s: %s", prefix, resp.Status, strings.TrimSpace(string(detail)))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("gcs list %s: %w", prefix, err)
+		}
+		for _, item := range page.Items {
+			names = append(names, item.Name)
+		}
+		if page.NextPageToken == "" {
+			return names, nil
+		}
+		token = page.NextPageToken
+	}
+}
+
+// URL names the object under key as gs://bucket/key
+func (g *GCS) URL(key string) string {
+	return "gs://" + g.config.Bucket + "/" + key
+}
@@ -0,0 +1,181 @@
+package logarchive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"exampleserver/pkg/sigv4"
+)
+
+// S3Config locates a bucket and the credentials to write to it. Endpoint
+// is only needed for S3 compatible stores such as MinIO, which are
+// addressed path style.
+type S3Config struct {
+	Bucket       string
+	Region       string
+	Endpoint     string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// S3 uploads objects to an S3 bucket, signing requests with AWS Signature
+// Version 4
+type S3 struct {
+	config S3Config
+	client *http.Client
+}
+
+func NewS3(config S3Config) *S3 {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &S3{
+		config: config,
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Upload puts body in the bucket under key. body is read twice: once to
+// hash it for the signature, then to send it.
+func (s *S3) Upload(ctx context.Context, key string, body io.ReadSeeker) error {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return err
+	}
+	length, err := size(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Type", "application/octet-stream")
+	s.signer().Sign(req, hex.EncodeToString(hash.Sum(nil)), time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 put %s: %s: %s", key, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// Check asks for the bucket with HeadBucket
+func (s *S3) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.objectURL(""), nil)
+	if err != nil {
+		return err
+	}
+	s.signer().Sign(req, sigv4.Hash(nil), time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3 head bucket %s: %s", s.config.Bucket, resp.Status)
+	}
+	return nil
+}
+
+// List pages through the keys under prefix with ListObjectsV2
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(""), nil)
+		if err != nil {
+			return nil, err
+		}
+		// Signature Version 4 wants the query sorted and spaces as %20
+		req.URL.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+		s.signer().Sign(req, sigv4.Hash(nil), time.Now().UTC())
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			resp.Body.Close()
+			return nil, fmt.Errorf("s3 list %s: %s: %s", prefix, resp.Status, strings.TrimSpace(string(detail)))
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list %s: %w", prefix, err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// URL names the object under key as s3://bucket/key
+func (s *S3) URL(key string) string {
+	return "s3://" + s.config.Bucket + "/" + key
+}
+
+func (s *S3) objectURL(key string) string {
+	if s.config.Endpoint != "" {
+		return strings.TrimSuffix(s.config.Endpoint, "/") + "/" + s.config.Bucket + "/" + escapePath(key)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.config.Bucket, s.config.Region, escapePath(key))
+}
+
+func (s *S3) signer() sigv4.Signer {
+	return sigv4.Signer{
+		Service:      "s3",
+		Region:       s.config.Region,
+		AccessKey:    s.config.AccessKey,
+		SecretKey:    s.config.SecretKey,
+		SessionToken: s.config.SessionToken,
+	}
+}
+
+// escapePath percent-encodes an object key the way Signature Version 4
+// expects: everything but unreserved characters and the slashes
+func escapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
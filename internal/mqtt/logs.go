@@ -0,0 +1,52 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+
+	"exampleserver/pkg/logger"
+)
+
+// LogPlugin publishes log entries as JSON to <prefix>/logs/<level>. Entries
+// are published without waiting for the broker and dropped while the bridge
+// is disconnected, so a broker outage never slows logging down.
+type LogPlugin struct {
+	bridge *Bridge
+	prefix string
+	filter logger.LogFilter
+}
+
+// NewLogPlugin returns a plugin publishing the entries of the given levels
+// through bridge
+func NewLogPlugin(bridge *Bridge, prefix string, levels []string) *LogPlugin {
+	return &LogPlugin{bridge: bridge, prefix: prefix, filter: logger.LogFilter{Levels: levels}}
+}
+
+func (p *LogPlugin) Initialize() error {
+	return p.filter.Compile()
+}
+
+func (p *LogPlugin) Close() error {
+	return nil
+}
+
+// ShouldHandle selects the entries of the plugin's levels, leaving out the
+// bridge's own so a failing broker can't feed back into itself
+func (p *LogPlugin) ShouldHandle(entry logger.LogEntry) bool {
+	return !strings.HasPrefix(entry.Message, "[MQTT]") && p.filter.Matches(entry)
+}
+
+func (p *LogPlugin) Handle(entry logger.LogEntry) error {
+	b := p.bridge
+	if !b.client.IsConnectionOpen() {
+		b.dropped.Add(1)
+		return nil
+	}
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	b.client.Publish(p.prefix+"/logs/"+strings.ToLower(entry.Level), b.qos, false, payload)
+	b.published.Add(1)
+	return nil
+}
@@ -0,0 +1,313 @@
+// Package mqtt bridges the server to an MQTT broker, for deployments where
+// devices report over MQTT rather than HTTP: it subscribes to topics for
+// handlers and publishes domain events and log entries
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"exampleserver/pkg/logger"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// maxReconnectInterval caps the backoff between reconnection attempts
+	maxReconnectInterval = time.Minute
+	// disconnectQuiesce is how long a disconnect waits for work in flight,
+	// in milliseconds
+	disconnectQuiesce = 250
+)
+
+// Config configures the connection to the broker
+type Config struct {
+	// Broker is the broker URL, tcp://, ssl:// (or tls://), ws:// or wss://
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// CAFile verifies the broker's certificate instead of the system roots
+	CAFile string
+	// CertFile and KeyFile authenticate the client to the broker
+	CertFile, KeyFile string
+	// QoS is the quality of service of subscriptions and publishes
+	QoS byte
+}
+
+// Handler processes a message received on a subscribed topic. Errors are
+// logged and counted; the message isn't redelivered.
+type Handler func(ctx context.Context, topic string, payload []byte) error
+
+// Bridge is a service holding the connection to the broker. The client
+// reconnects with backoff when the connection drops, subscribing again
+// once it is back.
+type Bridge struct {
+	client paho.Client
+	broker string
+	qos    byte
+
+	mu            sync.Mutex
+	subscriptions map[string]Handler
+	ctx           context.Context // cancelled when the service stops
+	cancel        context.CancelFunc
+	done          chan struct{}
+
+	received  atomic.Uint64
+	failed    atomic.Uint64
+	published atomic.Uint64
+	dropped   atomic.Uint64
+
+	logger logger.LoggerInterface
+}
+
+// NewBridge creates a bridge to the broker. It fails when the TLS files
+// can't be loaded.
+func NewBridge(config Config, logger logger.LoggerInterface) (*Bridge, error) {
+	tlsConfig, err := tlsConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bridge{
+		broker:        config.Broker,
+		qos:           config.QoS,
+		subscriptions: make(map[string]Handler),
+		ctx:           context.Background(),
+		logger:        logger,
+	}
+	opts := paho.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetTLSConfig(tlsConfig).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(maxReconnectInterval).
+		SetOrderMatters(false).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logger.Warn("[MQTT] Connection to %s lost, reconnecting: %v", config.Broker, err)
+		})
+	b.client = paho.NewClient(opts)
+	return b, nil
+}
+
+// tlsConfig returns the TLS settings of the connection, nil for the
+// defaults
+func tlsConfig(config Config) (*tls.Config, error) {
+	if config.CAFile == "" && config.CertFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", config.CAFile)
+		}
+	}
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Handle subscribes handler to a topic filter, which may use the + and #
+// wildcards, replacing any handler of the same filter. Filters handled
+// while connected are subscribed on the next connection.
+func (b *Bridge) Handle(filter string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions[filter] = handler
+}
+
+// Topics returns the subscribed topic filters, sorted
+func (b *Bridge) Topics() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	topics := make([]string, 0, len(b.subscriptions))
+	for topic := range b.subscriptions {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Name identifies the service to the service manager
+func (b *Bridge) Name() string {
+	return "mqtt"
+}
+
+// Start connects to the broker, retrying until it is reachable, and keeps
+// the connection until ctx is cancelled or Stop is called
+func (b *Bridge) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer close(done)
+
+	b.mu.Lock()
+	b.ctx = ctx
+	b.cancel = cancel
+	b.done = done
+	b.mu.Unlock()
+	defer cancel()
+
+	// Once connected the client reconnects on its own; until then, retry
+	// with backoff
+	for delay := time.Second; ; delay = min(2*delay, maxReconnectInterval) {
+		token := b.client.Connect()
+		select {
+		case <-token.Done():
+		case <-ctx.Done():
+			b.client.Disconnect(disconnectQuiesce)
+			return ctx.Err()
+		}
+		if token.Error() == nil {
+			break
+		}
+		b.logger.Warn("[MQTT] Failed to connect to %s, retrying in %s: %v", b.broker, delay, token.Error())
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	<-ctx.Done()
+	b.client.Disconnect(disconnectQuiesce)
+	return ctx.Err()
+}
+
+// Stop disconnects from the broker
+func (b *Bridge) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	cancel, done := b.cancel, b.done
+	b.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// onConnect subscribes to every topic filter, as subscriptions don't
+// survive a new connection with a clean session
+func (b *Bridge) onConnect(client paho.Client) {
+	b.logger.Info("[MQTT] Connected, subscribing to %v", b.Topics())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for filter, handler := range b.subscriptions {
+		handler := handler
+		token := client.Subscribe(filter, b.qos, func(_ paho.Client, msg paho.Message) {
+			b.dispatch(handler, msg)
+		})
+		go func(filter string) {
+			if token.Wait(); token.Error() != nil {
+				b.logger.Error("[MQTT] Failed to subscribe to %s: %v", filter, token.Error())
+			}
+		}(filter)
+	}
+}
+
+// dispatch hands a message to its handler, turning a panic into an error
+func (b *Bridge) dispatch(handler Handler, msg paho.Message) {
+	b.received.Add(1)
+	b.mu.Lock()
+	ctx := b.ctx
+	b.mu.Unlock()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("handler panic: %v", r)
+			}
+		}()
+		return handler(ctx, msg.Topic(), msg.Payload())
+	}()
+	if err != nil {
+		b.failed.Add(1)
+		b.logger.Error("[MQTT] Failed to handle message on %s: %v", msg.Topic(), err)
+	}
+}
+
+// Publish sends a message and waits for the broker to acknowledge it, as
+// far as the QoS asks for. It fails right away while disconnected.
+func (b *Bridge) Publish(ctx context.Context, topic string, payload []byte) error {
+	if !b.client.IsConnectionOpen() {
+		return errors.New("not connected to the MQTT broker")
+	}
+	token := b.client.Publish(topic, b.qos, false, payload)
+	select {
+	case <-token.Done():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+	b.published.Add(1)
+	return nil
+}
+
+// Check reports whether the bridge is connected, for the health checker
+func (b *Bridge) Check(ctx context.Context) error {
+	if !b.client.IsConnectionOpen() {
+		return errors.New("not connected")
+	}
+	return nil
+}
+
+// Collect reports the message counters for the stats service
+func (b *Bridge) Collect(ctx context.Context) (map[string]float64, error) {
+	connected := 0.0
+	if b.client.IsConnectionOpen() {
+		connected = 1
+	}
+	return map[string]float64{
+		"connected":    connected,
+		"received":     float64(b.received.Load()),
+		"failed":       float64(b.failed.Load()),
+		"published":    float64(b.published.Load()),
+		"logs_dropped": float64(b.dropped.Load()),
+	}, nil
+}
+
+// LogMessages is a handler logging the messages it is handed, for topics
+// subscribed to by configuration without a handler of their own
+func LogMessages(logger logger.LoggerInterface) Handler {
+	return func(ctx context.Context, topic string, payload []byte) error {
+		logger.WithFields(map[string]interface{}{"topic": topic, "bytes": len(payload)}).
+			Info("[MQTT] Message on %s: %s", topic, truncate(payload, 200))
+		return nil
+	}
+}
+
+func truncate(payload []byte, n int) string {
+	if len(payload) <= n {
+		return string(payload)
+	}
+	return string(payload[:n]) + "..."
+}
@@ -0,0 +1,320 @@
+// Package openapi builds the OpenAPI document from the routes as they are
+// registered, so the docs can't drift from the router
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/render"
+
+	"github.com/gorilla/mux"
+)
+
+// Operation describes a single method on a path
+type Operation struct {
+	Method  string
+	Path    string
+	Summary string
+	Tags    []string
+	Params  []Param
+	// Request is a value of the request body type, nil for no body
+	Request interface{}
+	// NegotiatedRequest bodies can also be sent in the other media types
+	// render.Decode reads
+	NegotiatedRequest bool
+	// Responses maps status codes to their descriptions
+	Responses map[int]Response
+	// Public operations skip authentication
+	Public bool
+	// Role is required of the caller on top of authentication
+	Role string
+	// Hidden operations are served but left out of the document, such as
+	// those the logger documents itself. An empty Method matches any.
+	Hidden bool
+}
+
+// Param is a query or path parameter. Path parameters are added
+// automatically from the route template.
+type Param struct {
+	Name        string
+	In          string // query, header or path
+	Description string
+	Type        string // defaults to string
+	Required    bool
+}
+
+// Response describes a response. Body is a value of the response type;
+// error statuses without a body are documented as problem details.
+type Response struct {
+	Description string
+	Body        interface{}
+	ContentType string // defaults to application/json
+	// Negotiated bodies are also offered in every media type registered
+	// with the render package
+	Negotiated bool
+}
+
+// Info is the document's info object
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+	Server      string // optional server URL
+}
+
+// Registry registers routes on a router and records them for the document
+type Registry struct {
+	mu         sync.Mutex
+	router     *mux.Router
+	protect    func(http.Handler) http.Handler
+	role       func(role string, next http.Handler) http.Handler
+	middleware []func(op Operation, next http.Handler) http.Handler
+	operations []Operation
+	schemas    map[string]interface{}
+	extraPaths map[string]interface{}
+}
+
+// NewRegistry creates a registry adding routes to router. protect wraps the
+// handlers of non-public operations, and role those of operations requiring
+// a role.
+func NewRegistry(router *mux.Router, protect func(http.Handler) http.Handler, role func(role string, next http.Handler) http.Handler) *Registry {
+	return &Registry{
+		router:     router,
+		protect:    protect,
+		role:       role,
+		schemas:    make(map[string]interface{}),
+		extraPaths: make(map[string]interface{}),
+	}
+}
+
+// Use wraps the handlers of operations registered afterwards with
+// middleware, which runs after authentication and the role check
+func (r *Registry) Use(middleware func(op Operation, next http.Handler) http.Handler) {
+	r.middleware = append(r.middleware, middleware)
+}
+
+// Handle registers handler for the operation's method and path
+func (r *Registry) Handle(op Operation, handler http.HandlerFunc) {
+	var h http.Handler = handler
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](op, h)
+	}
+	if op.Role != "" {
+		h = r.role(op.Role, h)
+	}
+	if !op.Public {
+		h = r.protect(h)
+	}
+	route := r.router.Handle(op.Path, h)
+	if op.Method != "" {
+		route.Methods(op.Method)
+	}
+
+	r.mu.Lock()
+	r.operations = append(r.operations, op)
+	r.mu.Unlock()
+}
+
+// Operations lists the operations registered, in order
+func (r *Registry) Operations() []Operation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Operation(nil), r.operations...)
+}
+
+// Documented reports whether the document describes method on path,
+// including the paths merged with Merge
+func (r *Registry) Documented(method, path string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, op := range r.operations {
+		if op.Method == method && op.Path == path && !op.Hidden {
+			return true
+		}
+	}
+	item, _ := r.extraPaths[path].(map[string]interface{})
+	_, ok := item[strings.ToLower(method)]
+	return ok
+}
+
+// Merge adds paths and component schemas documented elsewhere, such as
+// logger.GetSwagger()
+func (r *Registry) Merge(paths map[string]interface{}, schemas map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for path, def := range paths {
+		r.extraPaths[path] = def
+	}
+	for name, schema := range schemas {
+		r.schemas[name] = schema
+	}
+}
+
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// Document builds the OpenAPI 3 document
+func (r *Registry) Document(info Info) map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	problem := r.schemaFor(reflect.TypeOf(httperr.Problem{}))
+
+	paths := make(map[string]interface{}, len(r.extraPaths))
+	for path, def := range r.extraPaths {
+		paths[path] = def
+	}
+	for _, op := range r.operations {
+		if op.Hidden {
+			continue
+		}
+		path := pathParam.ReplaceAllString(op.Path, "{$1}")
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(op.Method)] = r.operation(op, problem)
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": r.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth":   map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKeyHeader": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"apiKeyQuery":  map[string]interface{}{"type": "apiKey", "in": "query", "name": "API-KEY"},
+			},
+		},
+	}
+	if info.Server != "" {
+		doc["servers"] = []map[string]interface{}{{"url": info.Server}}
+	}
+	return doc
+}
+
+func (r *Registry) operation(op Operation, problem map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{
+		"summary": op.Summary,
+	}
+	if len(op.Tags) > 0 {
+		out["tags"] = op.Tags
+	}
+	if op.Role != "" {
+		out["x-required-role"] = op.Role
+	}
+
+	var params []map[string]interface{}
+	for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		params = append(params, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true,
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, p := range op.Params {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		param := map[string]interface{}{
+			"name": p.Name, "in": p.In, "required": p.Required || p.In == "path",
+			"schema": map[string]interface{}{"type": typ},
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	if op.Request != nil {
+		schema := r.schemaFor(reflect.TypeOf(op.Request))
+		content := map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		}
+		if op.NegotiatedRequest {
+			for _, mediaType := range render.DecodeTypes(op.Request) {
+				content[mediaType] = map[string]interface{}{"schema": schema}
+			}
+		}
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  content,
+		}
+	}
+
+	responses := map[string]interface{}{}
+	for status, resp := range op.Responses {
+		responses[strconv.Itoa(status)] = r.response(status, resp, problem)
+	}
+	if !op.Public {
+		out["security"] = []map[string]interface{}{
+			{"bearerAuth": []string{}},
+			{"apiKeyHeader": []string{}},
+			{"apiKeyQuery": []string{}},
+		}
+		if _, ok := responses["401"]; !ok {
+			responses["401"] = r.response(http.StatusUnauthorized, Response{Description: "Missing or invalid credentials"}, problem)
+		}
+	}
+	out["responses"] = responses
+	return out
+}
+
+func (r *Registry) response(status int, resp Response, problem map[string]interface{}) map[string]interface{} {
+	description := resp.Description
+	if description == "" {
+		description = http.StatusText(status)
+	}
+	out := map[string]interface{}{"description": description}
+
+	switch {
+	case resp.Body != nil:
+		contentType := resp.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		schema := r.schemaFor(reflect.TypeOf(resp.Body))
+		content := map[string]interface{}{
+			contentType: map[string]interface{}{"schema": schema},
+		}
+		if resp.Negotiated {
+			for _, mediaType := range render.MediaTypesFor(resp.Body) {
+				content[mediaType] = map[string]interface{}{"schema": schema}
+			}
+		}
+		out["content"] = content
+	case status >= 400:
+		out["content"] = map[string]interface{}{
+			httperr.ContentType: map[string]interface{}{"schema": problem},
+		}
+	}
+	return out
+}
+
+// Handler serves the document as JSON
+func (r *Registry) Handler(info Info) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		// The document only changes with a deploy
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(r.Document(info))
+	}
+}
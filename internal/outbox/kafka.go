@@ -0,0 +1,54 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"exampleserver/internal/store"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaSink publishes outbox events to a Kafka topic. Messages are keyed by
+// the event key, so the events of one customer stay in order on a single
+// partition.
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (s *KafkaSink) Name() string {
+	return "kafka"
+}
+
+// Send writes the event as the same JSON envelope webhooks receive and
+// waits for every in-sync replica to acknowledge it
+func (s *KafkaSink) Send(ctx context.Context, event store.OutboxEvent) error {
+	value, err := json.Marshal(webhookEvent(event))
+	if err != nil {
+		return err
+	}
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.Key),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "event-type", Value: []byte(event.Type)},
+			{Key: "event-id", Value: []byte(event.ID)},
+		},
+	})
+}
+
+// Close flushes and closes the producer
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
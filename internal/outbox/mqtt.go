@@ -0,0 +1,38 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"exampleserver/internal/store"
+)
+
+// MQTTPublisher publishes to an MQTT broker, waiting for it to acknowledge
+// the message
+type MQTTPublisher interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+}
+
+// MQTTSink publishes outbox events to <prefix>/events/<event type>, so
+// subscribers can pick the events they want by topic
+type MQTTSink struct {
+	publisher MQTTPublisher
+	prefix    string
+}
+
+func NewMQTTSink(publisher MQTTPublisher, prefix string) *MQTTSink {
+	return &MQTTSink{publisher: publisher, prefix: prefix}
+}
+
+func (s *MQTTSink) Name() string {
+	return "mqtt"
+}
+
+// Send publishes the event as the same JSON envelope webhooks receive
+func (s *MQTTSink) Send(ctx context.Context, event store.OutboxEvent) error {
+	payload, err := json.Marshal(webhookEvent(event))
+	if err != nil {
+		return err
+	}
+	return s.publisher.Publish(ctx, s.prefix+"/events/"+event.Type, payload)
+}
@@ -0,0 +1,279 @@
+// Package outbox delivers the domain events recorded in the store's outbox
+// to webhooks and message brokers
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"exampleserver/internal/store"
+	"exampleserver/internal/webhooks"
+	"exampleserver/pkg/logger"
+)
+
+const (
+	// batchSize is the number of events delivered per poll
+	batchSize = 100
+	// maxBackoff caps the delay between attempts to deliver an event
+	maxBackoff = 5 * time.Minute
+	// defaultMaxAttempts is how often an event is attempted before it is
+	// given up on, about an hour of retries
+	defaultMaxAttempts = 20
+)
+
+// Sink receives outbox events. Send must return an error unless the event
+// has been durably handed over; it is then sent again later, so a sink can
+// see an event more than once.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, event store.OutboxEvent) error
+}
+
+// Forgetter is implemented by sinks that keep state about events being
+// retried, to drop it once the relay has given up on an event
+type Forgetter interface {
+	Forget(eventID string)
+}
+
+// Relay is a service polling the outbox and delivering pending events to
+// every sink. An event is marked delivered once all sinks have accepted it;
+// otherwise it is retried with exponential backoff, and given up on after
+// maxAttempts attempts so it no longer holds back the later events of its
+// key.
+type Relay struct {
+	outbox      store.Outbox
+	sinks       []Sink
+	interval    time.Duration
+	maxAttempts int
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	dead      atomic.Uint64
+
+	logger logger.LoggerInterface
+}
+
+func NewRelay(outbox store.Outbox, interval time.Duration, maxAttempts int, logger logger.LoggerInterface, sinks ...Sink) *Relay {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if maxAttempts < 1 {
+		maxAttempts = defaultMaxAttempts
+	}
+	return &Relay{
+		outbox:      outbox,
+		sinks:       sinks,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		logger:      logger,
+	}
+}
+
+// Name identifies the service to the service manager
+func (r *Relay) Name() string {
+	return "outbox"
+}
+
+// Start delivers pending events every interval until ctx is cancelled or
+// Stop is called
+func (r *Relay) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer close(done)
+
+	r.mu.Lock()
+	r.cancel = cancel
+	r.done = done
+	r.mu.Unlock()
+	defer cancel()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			r.Flush(ctx)
+		}
+	}
+}
+
+// Stop ends the polling loop. Undelivered events stay in the outbox for the
+// next start.
+func (r *Relay) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close releases sinks holding connections, such as Kafka producers. Call
+// it once the service manager has stopped the relay.
+func (r *Relay) Close() error {
+	var closeErr error
+	for _, sink := range r.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				closeErr = err
+			}
+		}
+	}
+	return closeErr
+}
+
+// Flush delivers the events that are currently due and returns how many were
+// delivered
+func (r *Relay) Flush(ctx context.Context) int {
+	events, err := r.outbox.Pending(ctx, batchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Error("[Outbox] Failed to load pending events: %v", err)
+		}
+		return 0
+	}
+
+	delivered := 0
+	for _, event := range events {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := r.send(ctx, event); err != nil {
+			r.failed.Add(1)
+			if event.Attempts+1 >= r.maxAttempts {
+				r.giveUp(ctx, event, err)
+				continue
+			}
+			retryAt := time.Now().Add(backoff(event.Attempts))
+			r.logger.Error("[Outbox] Failed to deliver event %s (%s), attempt %d, retrying at %s: %v",
+				event.ID, event.Type, event.Attempts+1, retryAt.Format(time.RFC3339), err)
+			if err := r.outbox.MarkFailed(ctx, event.ID, err.Error(), retryAt); err != nil {
+				r.logger.Error("[Outbox] Failed to record failure of event %s: %v", event.ID, err)
+			}
+			continue
+		}
+		if err := r.outbox.MarkDelivered(ctx, event.ID); err != nil {
+			// The event will be sent again on the next poll
+			r.logger.Error("[Outbox] Failed to mark event %s delivered: %v", event.ID, err)
+			continue
+		}
+		r.delivered.Add(1)
+		delivered++
+	}
+	return delivered
+}
+
+// giveUp marks an event failed for good after its last attempt
+func (r *Relay) giveUp(ctx context.Context, event store.OutboxEvent, err error) {
+	r.dead.Add(1)
+	r.logger.Error("[Outbox] Giving up on event %s (%s) after %d attempts: %v",
+		event.ID, event.Type, event.Attempts+1, err)
+	if err := r.outbox.MarkDead(ctx, event.ID, err.Error()); err != nil {
+		r.logger.Error("[Outbox] Failed to record failure of event %s: %v", event.ID, err)
+	}
+	for _, sink := range r.sinks {
+		if forgetter, ok := sink.(Forgetter); ok {
+			forgetter.Forget(event.ID)
+		}
+	}
+}
+
+// send hands the event to every sink, stopping at the first failure
+func (r *Relay) send(ctx context.Context, event store.OutboxEvent) error {
+	for _, sink := range r.sinks {
+		if err := sink.Send(ctx, event); err != nil {
+			return fmt.Errorf("%s: %w", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Collect reports the delivery counters for the stats service
+func (r *Relay) Collect(ctx context.Context) (map[string]float64, error) {
+	return map[string]float64{
+		"delivered": float64(r.delivered.Load()),
+		"failed":    float64(r.failed.Load()),
+		"dead":      float64(r.dead.Load()),
+	}, nil
+}
+
+// Purge removes events delivered, or given up on, longer ago than
+// retention. It is run by the scheduler.
+func (r *Relay) Purge(ctx context.Context, retention time.Duration) error {
+	n, err := r.outbox.Purge(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		r.logger.Info("[Outbox] Purged %d delivered or failed events", n)
+	}
+	return nil
+}
+
+// backoff returns the delay before retrying an event that has already been
+// attempted the given number of times
+func backoff(attempts int) time.Duration {
+	if attempts > 8 {
+		return maxBackoff
+	}
+	delay := time.Second << attempts
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
+
+// webhookSink delivers outbox events to webhook subscriptions
+type webhookSink struct {
+	dispatcher *webhooks.Dispatcher
+}
+
+// NewWebhookSink returns a sink delivering events to webhook subscriptions.
+// The outbox event ID is used as the webhook event ID. Send returns once
+// every matching subscription has accepted the event, so it is only marked
+// delivered, and the next event of its key only sent, after that.
+func NewWebhookSink(dispatcher *webhooks.Dispatcher) Sink {
+	return &webhookSink{dispatcher: dispatcher}
+}
+
+func (s *webhookSink) Name() string {
+	return "webhooks"
+}
+
+func (s *webhookSink) Send(ctx context.Context, event store.OutboxEvent) error {
+	return s.dispatcher.Deliver(ctx, webhookEvent(event), event.Attempts+1)
+}
+
+func (s *webhookSink) Forget(eventID string) {
+	s.dispatcher.Forget(eventID)
+}
+
+// webhookEvent wraps an outbox event in the envelope sent to subscribers
+func webhookEvent(event store.OutboxEvent) webhooks.Event {
+	return webhooks.Event{
+		ID:   event.ID,
+		Type: event.Type,
+		Time: event.CreatedAt,
+		Data: json.RawMessage(event.Payload),
+	}
+}
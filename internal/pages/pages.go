@@ -0,0 +1,205 @@
+// Package pages renders server-side HTML pages with html/template. Every
+// page is executed inside a shared layout and can use the shared partials;
+// the templates are embedded in the binary, and a directory of files can
+// replace or add to them without rebuilding.
+package pages
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/version"
+	"exampleserver/pkg/requestid"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+// View is the data every page is executed with
+type View struct {
+	Title string
+	Path  string
+	// User holds the claims of an authenticated request, nil for anonymous
+	// visitors
+	User      *auth.Claims
+	RequestID string
+	Version   version.Info
+	Now       time.Time
+	// Data is the page's own data
+	Data interface{}
+}
+
+// SignedIn reports whether the request was authenticated
+func (v View) SignedIn() bool {
+	return v.User != nil
+}
+
+// Renderer executes pages by name: templates/pages/<name>.html, which
+// defines "title" and "content", inside templates/layout.html with the
+// templates in templates/partials
+type Renderer struct {
+	pages map[string]*template.Template
+}
+
+// funcs are available to every template
+var funcs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"date":  func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+	"hasRole": func(claims *auth.Claims, role string) bool {
+		return claims != nil && claims.HasRole(role)
+	},
+}
+
+// NewRenderer parses the embedded templates, with the files in dir, when
+// given, replacing embedded files of the same path or adding pages and
+// partials. dir is laid out like the embedded templates: layout.html,
+// partials/*.html and pages/*.html.
+func NewRenderer(dir string) (*Renderer, error) {
+	base, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+	files := overlay{base: base}
+	if dir != "" {
+		files.override = os.DirFS(dir)
+	}
+
+	layout := template.New("layout.html").Funcs(funcs)
+	if err := parse(layout, files, "layout.html"); err != nil {
+		return nil, err
+	}
+	partials, err := files.glob("partials/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if err := parse(layout, files, partials...); err != nil {
+		return nil, err
+	}
+
+	names, err := files.glob("pages/*.html")
+	if err != nil {
+		return nil, err
+	}
+	r := &Renderer{pages: make(map[string]*template.Template, len(names))}
+	for _, name := range names {
+		page, err := layout.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if err := parse(page, files, name); err != nil {
+			return nil, err
+		}
+		r.pages[strings.TrimSuffix(path.Base(name), ".html")] = page
+	}
+	return r, nil
+}
+
+// parse adds the named files to t, failing with the file's name
+func parse(t *template.Template, files overlay, names ...string) error {
+	for _, name := range names {
+		data, err := files.read(name)
+		if err != nil {
+			return err
+		}
+		// A template redefined through New loses its functions, so the
+		// layout is parsed into the root template itself
+		tmpl := t
+		if name != t.Name() {
+			tmpl = t.New(name)
+		}
+		if _, err := tmpl.Parse(string(data)); err != nil {
+			return fmt.Errorf("page template %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Has reports whether a page of that name exists
+func (r *Renderer) Has(name string) bool {
+	_, ok := r.pages[name]
+	return ok
+}
+
+// Render executes the named page into w with status. The page is rendered
+// to a buffer first, so on an error nothing has been written and the
+// caller can still respond with an error.
+func (r *Renderer) Render(w http.ResponseWriter, req *http.Request, status int, name string, data interface{}) error {
+	page, ok := r.pages[name]
+	if !ok {
+		return fmt.Errorf("no page %q", name)
+	}
+	claims, _ := auth.GetClaims(req.Context())
+	view := View{
+		Path:      req.URL.Path,
+		User:      claims,
+		RequestID: requestid.FromContext(req.Context()),
+		Version:   version.Get(),
+		Now:       time.Now(),
+		Data:      data,
+	}
+	var title bytes.Buffer
+	if err := page.ExecuteTemplate(&title, "title", view); err != nil {
+		return fmt.Errorf("page %s: %w", name, err)
+	}
+	view.Title = strings.TrimSpace(title.String())
+
+	var buf bytes.Buffer
+	if err := page.ExecuteTemplate(&buf, "layout.html", view); err != nil {
+		return fmt.Errorf("page %s: %w", name, err)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Pages can show who is signed in, so shared caches mustn't keep them
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+	return nil
+}
+
+// overlay reads files from override when they exist there, and from base
+// otherwise
+type overlay struct {
+	base     fs.FS
+	override fs.FS // nil without a template directory
+}
+
+func (o overlay) read(name string) ([]byte, error) {
+	if o.override != nil {
+		if data, err := fs.ReadFile(o.override, name); err == nil {
+			return data, nil
+		}
+	}
+	return fs.ReadFile(o.base, name)
+}
+
+// glob returns the names matching pattern in either file system, sorted
+func (o overlay) glob(pattern string) ([]string, error) {
+	names, err := fs.Glob(o.base, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if o.override != nil {
+		extra, err := fs.Glob(o.override, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range extra {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
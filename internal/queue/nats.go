@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsAckWait is how long JetStream waits for a message to be settled
+// before redelivering it, covering the longest wait between retries
+const natsAckWait = 2 * maxRetryDelay
+
+// NATS consumes from NATS JetStream. The subjects must be captured by a
+// stream, and so must their dead letter subjects for messages to be
+// dead-lettered.
+type NATS struct {
+	url        string
+	maxPending int
+
+	mu   sync.Mutex
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+// NewNATS returns a broker connecting to the NATS servers at url, a comma
+// separated list, with at most maxPending messages unacknowledged at once
+func NewNATS(url string, maxPending int) *NATS {
+	return &NATS{url: url, maxPending: maxPending}
+}
+
+func (n *NATS) Name() string {
+	return "nats"
+}
+
+// Consume subscribes to each subject with a durable consumer per subject
+// shared by the queue group. The client reconnects on its own; Consume
+// returns once it gives up. The connection stays open after Consume returns
+// so messages still being handled can be settled, until the next Consume
+// or Close.
+func (n *NATS) Consume(ctx context.Context, subjects []string, group string, deliver func(Delivery)) error {
+	closed := make(chan struct{})
+	conn, err := nats.Connect(n.url,
+		nats.Name(group),
+		nats.ClosedHandler(func(*nats.Conn) { close(closed) }),
+	)
+	if err != nil {
+		return err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	n.mu.Lock()
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	n.conn, n.js = conn, js
+	n.mu.Unlock()
+
+	for _, subject := range subjects {
+		subscription := subject
+		sub, err := js.QueueSubscribe(subject, group, func(msg *nats.Msg) {
+			deliver(Delivery{
+				Message: Message{
+					Subject: msg.Subject,
+					Body:    msg.Data,
+					Headers: natsHeaders(msg.Header),
+				},
+				Subscription: subscription,
+				Ack:          func() error { return msg.Ack() },
+				Nack:         func() error { return msg.Nak() },
+				InProgress:   func() error { return msg.InProgress() },
+			})
+		},
+			nats.Durable(durableName(group, subject)),
+			nats.ManualAck(),
+			nats.AckWait(natsAckWait),
+			nats.MaxAckPending(n.maxPending),
+		)
+		if err != nil {
+			return err
+		}
+		// Unsubscribing would delete the durable consumer, so only drain
+		// the messages already received
+		defer sub.Drain()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-closed:
+		if err := conn.LastError(); err != nil {
+			return err
+		}
+		return errors.New("connection closed")
+	}
+}
+
+// Publish sends a message to JetStream and waits for the stream to store
+// it
+func (n *NATS) Publish(ctx context.Context, subject string, body []byte, headers map[string]string) error {
+	n.mu.Lock()
+	js := n.js
+	n.mu.Unlock()
+	if js == nil {
+		return errors.New("not connected")
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = body
+	for k, v := range headers {
+		msg.Header.Set(k, v)
+	}
+	_, err := js.PublishMsg(msg, nats.Context(ctx))
+	return err
+}
+
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	return nil
+}
+
+func natsHeaders(header nats.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for k := range header {
+		headers[k] = header.Get(k)
+	}
+	return headers
+}
+
+// durableName names the consumer of a subject, which mustn't contain the
+// dots and wildcards subjects do
+func durableName(group, subject string) string {
+	return group + "_" + strings.NewReplacer(".", "_", "*", "any", ">", "all").Replace(subject)
+}
@@ -0,0 +1,354 @@
+// Package queue consumes messages from a message broker, NATS JetStream or
+// RabbitMQ, and dispatches them to the handlers registered for their
+// subjects
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"exampleserver/pkg/logger"
+)
+
+const (
+	// dlqSuffix is appended to a subject to name its dead letter queue
+	dlqSuffix = ".dlq"
+	// maxRetryDelay caps the delay between attempts to handle a message
+	maxRetryDelay = time.Minute
+)
+
+// Message is a message received from the broker
+type Message struct {
+	Subject string
+	Body    []byte
+	Headers map[string]string
+	// Attempt counts the attempts to handle the message, from 1
+	Attempt int
+}
+
+// Handler processes a message. Returning an error retries the message,
+// unless the error is wrapped with Permanent.
+type Handler func(ctx context.Context, msg Message) error
+
+// permanentError marks a message that no retry can handle
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps a handler error to dead-letter the message right away,
+// such as when its body can't be decoded
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Delivery is a message received from a broker along with how to settle it
+type Delivery struct {
+	Message
+	// Subscription is the subject subscribed to, which differs from the
+	// message's subject for NATS wildcards
+	Subscription string
+	// Ack removes the message from the queue
+	Ack func() error
+	// Nack returns the message to the queue for redelivery
+	Nack func() error
+	// InProgress tells the broker the message is still being handled, so
+	// it isn't redelivered while retries wait. Brokers without
+	// acknowledgement deadlines leave it nil.
+	InProgress func() error
+}
+
+// Broker is a connection to a message broker
+type Broker interface {
+	Name() string
+	// Consume delivers the messages of the subjects to deliver until ctx is
+	// cancelled, returning nil, or the connection fails. Consumers sharing a
+	// group share the messages between them.
+	Consume(ctx context.Context, subjects []string, group string, deliver func(Delivery)) error
+	// Publish sends a message, waiting for the broker to accept it
+	Publish(ctx context.Context, subject string, body []byte, headers map[string]string) error
+	Close() error
+}
+
+// Config configures a consumer
+type Config struct {
+	Group string
+	// Concurrency is the number of messages handled at once
+	Concurrency int
+	// MaxAttempts is the number of attempts to handle a message before it
+	// is dead-lettered
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry, doubling for each
+	// retry after it
+	RetryDelay time.Duration
+}
+
+// Consumer is a service receiving messages from a broker and handing them
+// to handlers. A message is acknowledged once its handler succeeds. Failed
+// messages are retried with exponential backoff and, after the last
+// attempt, published to the subject's dead letter queue, <subject>.dlq.
+type Consumer struct {
+	broker Broker
+	config Config
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	received     atomic.Uint64
+	acked        atomic.Uint64
+	retried      atomic.Uint64
+	deadLettered atomic.Uint64
+
+	logger logger.LoggerInterface
+}
+
+func NewConsumer(broker Broker, config Config, logger logger.LoggerInterface) *Consumer {
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &Consumer{
+		broker:   broker,
+		config:   config,
+		handlers: make(map[string]Handler),
+		logger:   logger,
+	}
+}
+
+// Handle registers the handler of a subject, replacing any registered
+// before. Handlers must be registered before the consumer starts.
+func (c *Consumer) Handle(subject string, handler Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[subject] = handler
+}
+
+// Subjects returns the subjects with a handler, sorted
+func (c *Consumer) Subjects() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	subjects := make([]string, 0, len(c.handlers))
+	for subject := range c.handlers {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// Name identifies the service to the service manager
+func (c *Consumer) Name() string {
+	return "queue"
+}
+
+// Start consumes messages until ctx is cancelled or Stop is called. A lost
+// connection returns an error, for the service manager to restart the
+// consumer.
+func (c *Consumer) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer close(done)
+
+	c.mu.Lock()
+	c.cancel = cancel
+	c.done = done
+	c.mu.Unlock()
+	defer cancel()
+
+	subjects := c.Subjects()
+	if len(subjects) == 0 {
+		c.logger.Warn("[Queue] No message handlers registered, not consuming from %s", c.broker.Name())
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	// Deliveries are handed to a fixed set of workers, so the broker stops
+	// delivering while all of them are busy
+	deliveries := make(chan Delivery)
+	var wg sync.WaitGroup
+	for i := 0; i < c.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case d := <-deliveries:
+					c.process(ctx, d)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	c.logger.Info("[Queue] Consuming %v from %s as %s", subjects, c.broker.Name(), c.config.Group)
+	err := c.broker.Consume(ctx, subjects, c.config.Group, func(d Delivery) {
+		// Brokers can still deliver messages received before Consume
+		// returned
+		if ctx.Err() != nil {
+			c.requeue(d)
+			return
+		}
+		select {
+		case deliveries <- d:
+		case <-ctx.Done():
+			c.requeue(d)
+		}
+	})
+	stopped := ctx.Err()
+
+	// Messages waiting to be retried go back to the queue
+	cancel()
+	wg.Wait()
+	if stopped != nil {
+		return stopped
+	}
+	return fmt.Errorf("consuming from %s: %w", c.broker.Name(), err)
+}
+
+// Stop ends consuming. Messages being retried are returned to the queue.
+func (c *Consumer) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	c.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the broker connection. Call it once the service manager has
+// stopped the consumer.
+func (c *Consumer) Close() error {
+	return c.broker.Close()
+}
+
+// process handles a delivery, retrying until it succeeds or runs out of
+// attempts, and settles it with the broker
+func (c *Consumer) process(ctx context.Context, d Delivery) {
+	c.received.Add(1)
+	c.mu.Lock()
+	handler := c.handlers[d.Subscription]
+	c.mu.Unlock()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		d.Attempt = attempt
+		if err = c.handle(ctx, handler, d.Message); err == nil {
+			if err := d.Ack(); err != nil {
+				c.logger.Error("[Queue] Failed to acknowledge message on %s: %v", d.Subject, err)
+				return
+			}
+			c.acked.Add(1)
+			return
+		}
+		if ctx.Err() != nil {
+			c.requeue(d)
+			return
+		}
+		if errors.As(err, new(permanentError)) || attempt >= c.config.MaxAttempts {
+			break
+		}
+
+		c.retried.Add(1)
+		delay := retryDelay(c.config.RetryDelay, attempt)
+		c.logger.Warn("[Queue] Failed to handle message on %s, attempt %d of %d, retrying in %s: %v",
+			d.Subject, attempt, c.config.MaxAttempts, delay, err)
+		if d.InProgress != nil {
+			if err := d.InProgress(); err != nil {
+				c.logger.Warn("[Queue] Failed to extend the acknowledgement deadline of a message on %s: %v", d.Subject, err)
+			}
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			c.requeue(d)
+			return
+		}
+	}
+
+	c.deadLetter(ctx, d, err)
+}
+
+// handle runs the handler, turning a panic into an error
+func (c *Consumer) handle(ctx context.Context, handler Handler, msg Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return handler(ctx, msg)
+}
+
+// deadLetter publishes a message that couldn't be handled to the dead letter
+// queue of its subject, with the error and attempts in its headers, and
+// acknowledges it. If the dead letter queue can't take it, the message is
+// returned to the queue.
+func (c *Consumer) deadLetter(ctx context.Context, d Delivery, cause error) {
+	headers := make(map[string]string, len(d.Headers)+3)
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers["x-error"] = cause.Error()
+	headers["x-attempts"] = fmt.Sprint(d.Attempt)
+	headers["x-subject"] = d.Subject
+
+	dlq := d.Subject + dlqSuffix
+	if err := c.broker.Publish(ctx, dlq, d.Body, headers); err != nil {
+		c.logger.Error("[Queue] Failed to dead-letter message on %s to %s, returning it to the queue: %v (handler error: %v)",
+			d.Subject, dlq, err, cause)
+		c.requeue(d)
+		return
+	}
+	c.deadLettered.Add(1)
+	c.logger.Error("[Queue] Dead-lettered message on %s to %s after %d attempts: %v", d.Subject, dlq, d.Attempt, cause)
+	if err := d.Ack(); err != nil {
+		c.logger.Error("[Queue] Failed to acknowledge dead-lettered message on %s: %v", d.Subject, err)
+	}
+}
+
+func (c *Consumer) requeue(d Delivery) {
+	if err := d.Nack(); err != nil {
+		c.logger.Error("[Queue] Failed to return message on %s to the queue: %v", d.Subject, err)
+	}
+}
+
+// Collect reports the consumer counters for the stats service
+func (c *Consumer) Collect(ctx context.Context) (map[string]float64, error) {
+	return map[string]float64{
+		"received":      float64(c.received.Load()),
+		"acked":         float64(c.acked.Load()),
+		"retried":       float64(c.retried.Load()),
+		"dead_lettered": float64(c.deadLettered.Load()),
+	}, nil
+}
+
+// retryDelay returns the delay before retrying a message that has failed
+// the given number of attempts
+func retryDelay(base time.Duration, attempts int) time.Duration {
+	if attempts > 16 {
+		return maxRetryDelay
+	}
+	delay := base << (attempts - 1)
+	if delay > maxRetryDelay || delay < 0 {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RabbitMQ consumes from RabbitMQ queues named after the subjects. The
+// queues and their dead letter queues are declared durable if they don't
+// exist; existing queues must be durable too.
+type RabbitMQ struct {
+	url      string
+	prefetch int
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	publish *amqp.Channel // in confirm mode, for dead letters
+}
+
+// NewRabbitMQ returns a broker connecting to the AMQP url, with at most
+// prefetch messages unacknowledged at once
+func NewRabbitMQ(url string, prefetch int) *RabbitMQ {
+	return &RabbitMQ{url: url, prefetch: prefetch}
+}
+
+func (r *RabbitMQ) Name() string {
+	return "rabbitmq"
+}
+
+// Consume consumes every subject's queue on one channel, tagging each
+// consumer with the group. Instances consuming the same queues share the
+// messages between them. A lost connection ends Consume for the consumer
+// to be restarted, as the client doesn't reconnect on its own. The
+// connection stays open after Consume returns so messages still being
+// handled can be settled, until the next Consume or Close.
+func (r *RabbitMQ) Consume(ctx context.Context, subjects []string, group string, deliver func(Delivery)) error {
+	props := amqp.NewConnectionProperties()
+	props.SetClientConnectionName(group)
+	conn, err := amqp.DialConfig(r.url, amqp.Config{Properties: props})
+	if err != nil {
+		return err
+	}
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	ch, publish, err := r.channels(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	r.mu.Lock()
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.conn, r.publish = conn, publish
+	r.mu.Unlock()
+
+	for _, subject := range subjects {
+		for _, queue := range []string{subject, subject + dlqSuffix} {
+			if _, err := ch.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+				return fmt.Errorf("declaring queue %s: %w", queue, err)
+			}
+		}
+		deliveries, err := ch.Consume(subject, group+"."+subject, false, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("consuming queue %s: %w", subject, err)
+		}
+		// The client closes deliveries when the consumer is cancelled or
+		// the channel closes
+		go func(subject string) {
+			for d := range deliveries {
+				deliver(Delivery{
+					Message: Message{
+						Subject: subject,
+						Body:    d.Body,
+						Headers: amqpHeaders(d.Headers),
+					},
+					Subscription: subject,
+					Ack:          func() error { return d.Ack(false) },
+					Nack:         func() error { return d.Nack(false, true) },
+				})
+			}
+		}(subject)
+	}
+
+	select {
+	case <-ctx.Done():
+		// Stop deliveries; those already received are settled or returned
+		// to the queue by the consumer
+		for _, subject := range subjects {
+			ch.Cancel(group+"."+subject, false)
+		}
+		return nil
+	case err := <-closed:
+		if err != nil {
+			return err
+		}
+		return errors.New("connection closed")
+	}
+}
+
+// channels opens the channel consuming, limited to the prefetch, and the
+// channel publishing, waiting for the broker to confirm what it takes
+func (r *RabbitMQ) channels(conn *amqp.Connection) (consume, publish *amqp.Channel, err error) {
+	if consume, err = conn.Channel(); err != nil {
+		return nil, nil, err
+	}
+	if err := consume.Qos(r.prefetch, 0, false); err != nil {
+		return nil, nil, err
+	}
+	if publish, err = conn.Channel(); err != nil {
+		return nil, nil, err
+	}
+	if err := publish.Confirm(false); err != nil {
+		return nil, nil, err
+	}
+	return consume, publish, nil
+}
+
+// Publish sends a persistent message to the queue named subject and waits
+// for the broker to confirm it
+func (r *RabbitMQ) Publish(ctx context.Context, subject string, body []byte, headers map[string]string) error {
+	r.mu.Lock()
+	ch := r.publish
+	r.mu.Unlock()
+	if ch == nil {
+		return errors.New("not connected")
+	}
+
+	table := make(amqp.Table, len(headers))
+	for k, v := range headers {
+		table[k] = v
+	}
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", subject, false, false, amqp.Publishing{
+		Headers:      table,
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+	if err != nil {
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errors.New("broker rejected the message")
+	}
+	return nil
+}
+
+func (r *RabbitMQ) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil || r.conn.IsClosed() {
+		return nil
+	}
+	return r.conn.Close()
+}
+
+func amqpHeaders(table amqp.Table) map[string]string {
+	headers := make(map[string]string, len(table))
+	for k, v := range table {
+		headers[k] = fmt.Sprint(v)
+	}
+	return headers
+}
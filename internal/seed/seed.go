@@ -0,0 +1,167 @@
+// Package seed fills the user and customer stores with made-up but
+// plausible people, so a fresh development database or a load test has
+// data to work against
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/store"
+)
+
+// actor is recorded as the author of seeded customers in their history
+const actor = "seed"
+
+// maxAttempts bounds the tries at a unique username or email before a
+// record is skipped
+const maxAttempts = 5
+
+var firstNames = []string{
+	"Ada", "Alan", "Amara", "Beatriz", "Bjorn", "Chen", "Chloe", "Dmitri", "Elena", "Emeka",
+	"Farah", "Grace", "Hana", "Hugo", "Ingrid", "Isaac", "Jamal", "Julia", "Kenji", "Lena",
+	"Liam", "Lucia", "Mateo", "Maya", "Nadia", "Noah", "Olga", "Omar", "Priya", "Rafael",
+	"Rosa", "Samir", "Sofia", "Tariq", "Tessa", "Umar", "Valentina", "Wei", "Yara", "Zoe",
+}
+
+var lastNames = []string{
+	"Andersen", "Bauer", "Costa", "Dubois", "Eriksson", "Fernandes", "Garcia", "Hoffmann", "Ito", "Jensen",
+	"Kowalski", "Larsen", "Moreau", "Nakamura", "Novak", "Okafor", "Petrov", "Quinn", "Rossi", "Schmidt",
+	"Silva", "Tanaka", "Umarov", "Varga", "Walsh", "Xu", "Yilmaz", "Zhang", "Murphy", "Kim",
+}
+
+// Domains reserved for documentation (RFC 2606), so seeded addresses never
+// reach a real mailbox
+var domains = []string{"example.com", "example.net", "example.org"}
+
+// Options says how much to seed
+type Options struct {
+	Users     int
+	Customers int
+	// Password of every seeded user
+	Password string
+	// Seed makes the data reproducible; 0 picks one at random, reported in
+	// the result
+	Seed int64
+	// Progress, when set, is told how many records were seeded so far
+	Progress func(done, total int)
+}
+
+// Result counts what was seeded. Skipped records kept clashing with
+// existing usernames or emails.
+type Result struct {
+	Users     int   `json:"users"`
+	Customers int   `json:"customers"`
+	Skipped   int   `json:"skipped"`
+	Seed      int64 `json:"seed"`
+}
+
+// Run adds opts.Users users and opts.Customers customers to st. Users get
+// no roles, or now and then the support role, never admin.
+func Run(ctx context.Context, st *store.Store, passwords *auth.PasswordHasher, opts Options) (Result, error) {
+	if opts.Users < 0 || opts.Customers < 0 {
+		return Result{}, errors.New("the number of users and customers must not be negative")
+	}
+	if opts.Users > 0 && len(opts.Password) < auth.MinPasswordLength {
+		return Result{}, fmt.Errorf("the password of seeded users must have at least %d characters", auth.MinPasswordLength)
+	}
+	if opts.Seed == 0 {
+		opts.Seed = rand.Int63()
+	}
+	result := Result{Seed: opts.Seed}
+	random := rand.New(rand.NewSource(opts.Seed))
+	total, done := opts.Users+opts.Customers, 0
+	progress := func() {
+		done++
+		if opts.Progress != nil {
+			opts.Progress(done, total)
+		}
+	}
+
+	// Every user has the same password, so it is hashed once
+	var hash string
+	if opts.Users > 0 {
+		var err error
+		if hash, err = passwords.Hash(opts.Password); err != nil {
+			return result, err
+		}
+	}
+	for i := 0; i < opts.Users; i++ {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		first, last := pick(random, firstNames), pick(random, lastNames)
+		roles := []string{}
+		if random.Intn(10) == 0 {
+			roles = append(roles, "support")
+		}
+		created := false
+		for attempt := 0; attempt < maxAttempts && !created; attempt++ {
+			username := strings.ToLower(first + "." + last + suffix(random, attempt))
+			_, err := st.Users.Create(ctx, store.User{
+				Username:     username,
+				Email:        username + "@" + pick(random, domains),
+				Roles:        roles,
+				PasswordHash: hash,
+			})
+			switch {
+			case err == nil:
+				created = true
+			case !errors.Is(err, store.ErrConflict):
+				return result, fmt.Errorf("user %s: %w", username, err)
+			}
+		}
+		if created {
+			result.Users++
+		} else {
+			result.Skipped++
+		}
+		progress()
+	}
+
+	ctx = store.WithActor(ctx, actor)
+	for i := 0; i < opts.Customers; i++ {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		first, last := pick(random, firstNames), pick(random, lastNames)
+		created := false
+		for attempt := 0; attempt < maxAttempts && !created; attempt++ {
+			email := strings.ToLower(first + "." + last + suffix(random, attempt) + "@" + pick(random, domains))
+			_, err := st.Customers.Create(ctx, store.Customer{
+				Name:  first + " " + last,
+				Email: email,
+			})
+			switch {
+			case err == nil:
+				created = true
+			case !errors.Is(err, store.ErrConflict):
+				return result, fmt.Errorf("customer %s: %w", email, err)
+			}
+		}
+		if created {
+			result.Customers++
+		} else {
+			result.Skipped++
+		}
+		progress()
+	}
+	return result, nil
+}
+
+func pick(random *rand.Rand, from []string) string {
+	return from[random.Intn(len(from))]
+}
+
+// suffix tells apart people of the same name. The first attempt has none
+// unless a coin toss says otherwise; retries after a clash always do.
+func suffix(random *rand.Rand, attempt int) string {
+	if attempt == 0 && random.Intn(2) == 0 {
+		return ""
+	}
+	return fmt.Sprint(random.Intn(9000) + 100)
+}
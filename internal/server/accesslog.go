@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"exampleserver/internal/auth"
+	"exampleserver/pkg/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// setupAccessLog adds the route and the caller's claims to access log
+// entries. The access log wraps the router, so the route is looked up again
+// and the caller authenticated again, as trackKeyUsage does.
+func (s *Server) setupAccessLog(authenticator auth.Authenticator) {
+	access := logger.Access()
+	if !access.Enabled() {
+		return
+	}
+	access.AddHook(func(r *http.Request, fields map[string]interface{}) {
+		var match mux.RouteMatch
+		if s.router.Match(r, &match) && match.Route != nil {
+			if tmpl, err := match.Route.GetPathTemplate(); err == nil {
+				fields["route"] = tmpl
+			}
+		}
+	})
+	access.SetClaims(func(r *http.Request) map[string]interface{} {
+		claims, err := authenticator.Authenticate(r)
+		if err != nil {
+			return nil
+		}
+		// The claims' JSON names, e.g. sub and roles, are the ones
+		// access_log.claims lists
+		data, err := json.Marshal(claims)
+		if err != nil {
+			return nil
+		}
+		var fields map[string]interface{}
+		json.Unmarshal(data, &fields)
+		return fields
+	})
+}
+
+// accessLog writes an access log entry for every request next serves. It
+// runs inside requestid.Middleware so entries carry the request ID.
+func (s *Server) accessLog(next http.Handler) http.Handler {
+	return logger.Access().Middleware(next)
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"exampleserver/pkg/httperr"
+)
+
+const (
+	batchPath = "/api/batch"
+	// maxBatchBody caps the size of a batch, all its bodies included
+	maxBatchBody = 4 << 20
+)
+
+// batchKey marks the context of the requests of a batch, which run within
+// the batch's own concurrency slot and have already passed load shedding
+type batchKey struct{}
+
+// inBatch reports whether r is a request of a batch
+func inBatch(r *http.Request) bool {
+	return r.Context().Value(batchKey{}) != nil
+}
+
+// batchHeaders are copied from a batch to each of its requests, so they
+// run with the caller's credentials and preferences. Requests can't set
+// the credentials themselves.
+var batchHeaders = []string{"Authorization", "X-API-Key", "Cookie", "Accept-Language", "User-Agent", "X-Forwarded-For"}
+
+// BatchRequest is one request of a batch. Path includes the query, and
+// body is sent as JSON unless headers set another Content-Type.
+type BatchRequest struct {
+	ID      string            `json:"id,omitempty"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchBody is the request body of POST /api/batch
+type BatchBody struct {
+	Requests []BatchRequest `json:"requests"`
+}
+
+// BatchResponse is the response to one request of a batch. JSON bodies
+// are embedded as they are, anything else as a string.
+type BatchResponse struct {
+	ID      string            `json:"id,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResult lists the responses in the order of the requests
+type BatchResult struct {
+	Responses []BatchResponse `json:"responses"`
+}
+
+// batch runs each request of a batch through the router in turn, with the
+// middleware, authentication and authorization of a request of its own,
+// and answers with all their responses
+func (s *Server) batch(w http.ResponseWriter, r *http.Request) {
+	var req BatchBody
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Requests) == 0 || len(req.Requests) > s.config.BatchMaxRequests {
+		httperr.Writef(w, r, http.StatusBadRequest, "A batch holds between 1 and %d requests", s.config.BatchMaxRequests)
+		return
+	}
+
+	subRequests := make([]*http.Request, len(req.Requests))
+	for i, item := range req.Requests {
+		sub, problem := s.batchRequest(r, item)
+		if problem != "" {
+			httperr.Writef(w, r, http.StatusBadRequest, problem, i)
+			return
+		}
+		subRequests[i] = sub
+	}
+
+	result := BatchResult{Responses: make([]BatchResponse, len(subRequests))}
+	for i, sub := range subRequests {
+		if r.Context().Err() != nil {
+			return
+		}
+		rec := newBufferedResponse()
+		s.router.ServeHTTP(rec, sub)
+		result.Responses[i] = rec.batchResponse(req.Requests[i].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// batchRequest builds the request for an item of a batch, or returns the
+// problem with it as a format for the item's index
+func (s *Server) batchRequest(r *http.Request, item BatchRequest) (*http.Request, string) {
+	method := strings.ToUpper(item.Method)
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return nil, "Batch request %d has an unsupported method"
+	}
+	target, err := url.ParseRequestURI(item.Path)
+	if err != nil || target.Host != "" || !strings.HasPrefix(target.Path, "/") {
+		return nil, "Batch request %d must have a path such as /api/customers"
+	}
+	if target.Path == batchPath {
+		return nil, "Batch request %d can't be another batch"
+	}
+
+	var body []byte
+	if len(item.Body) > 0 && string(item.Body) != "null" {
+		body = item.Body
+	}
+	ctx := context.WithValue(r.Context(), batchKey{}, true)
+	sub, err := http.NewRequestWithContext(ctx, method, target.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, "Batch request %d must have a path such as /api/customers"
+	}
+	for name, value := range item.Headers {
+		sub.Header.Set(name, value)
+	}
+	for _, name := range batchHeaders {
+		sub.Header.Del(name)
+		if values := r.Header.Values(name); len(values) > 0 {
+			sub.Header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	if body != nil && sub.Header.Get("Content-Type") == "" {
+		sub.Header.Set("Content-Type", "application/json")
+	}
+	sub.RemoteAddr = r.RemoteAddr
+	sub.Host = r.Host
+	sub.TLS = r.TLS
+	return sub, ""
+}
+
+// bufferedResponse holds a response in memory
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status = status
+		b.wroteHeader = true
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) batchResponse(id string) BatchResponse {
+	resp := BatchResponse{ID: id, Status: b.status, Headers: make(map[string]string, len(b.header))}
+	for name, values := range b.header {
+		resp.Headers[name] = strings.Join(values, ", ")
+	}
+	if b.body.Len() == 0 {
+		return resp
+	}
+	contentType := b.header.Get("Content-Type")
+	if strings.Contains(contentType, "json") && json.Valid(b.body.Bytes()) {
+		resp.Body = json.RawMessage(b.body.Bytes())
+	} else {
+		resp.Body, _ = json.Marshal(b.body.String())
+	}
+	return resp
+}
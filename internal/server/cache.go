@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"exampleserver/internal/auth"
+)
+
+// defaultVary is assumed for URLs whose responses haven't been seen yet
+var defaultVary = []string{"Accept"}
+
+// cachedResponse is the cached form of a GET response
+type cachedResponse struct {
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	Stored time.Time   `json:"stored"`
+}
+
+// cached serves successful GET responses from the response cache, for the
+// max-age or s-maxage of their Cache-Control header or else ttl. Responses
+// marked no-store, no-cache or private aren't stored, and a response is
+// stored per caller, tenant and value of the request headers its Vary
+// header names, so one caller is never served another's response. Entries
+// are keyed under namespace so writes can invalidate them.
+func (s *Server) cached(namespace string, ttl time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	if s.cache == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Conditional requests go to the handler, which does the ETag
+		// comparison, and no-store requests bypass the cache
+		requested := cacheControl(r.Header.Get("Cache-Control"))
+		if r.Method != http.MethodGet || r.Header.Get("If-None-Match") != "" || requested.has("no-store") {
+			next(w, r)
+			return
+		}
+		// ROUTE_CONFIG can change the lifetime or turn the cache off
+		ttl := ttl
+		if override, ok := r.Context().Value(cacheTTLKey{}).(time.Duration); ok {
+			if override == 0 {
+				next(w, r)
+				return
+			}
+			ttl = override
+		}
+		base := namespace + ":" + r.URL.RequestURI()
+
+		// The Vary of the last response for the URL picks the variant. It
+		// is read past the hit and miss counters so each request counts
+		// once.
+		vary := defaultVary
+		if data, ok := s.cache.Cache.Get(r.Context(), base+"\nvary"); ok {
+			var names []string
+			if json.Unmarshal(data, &names) == nil {
+				vary = names
+			}
+		}
+
+		// no-cache and max-age=0 ask for a fresh response, which is stored
+		maxAge, hasMaxAge := requested.seconds("max-age")
+		if !requested.has("no-cache") && !(hasMaxAge && maxAge == 0) {
+			if data, ok := s.cache.Get(r.Context(), variantKey(base, vary, r)); ok {
+				var cached cachedResponse
+				if err := json.Unmarshal(data, &cached); err == nil {
+					for name, values := range cached.Header {
+						w.Header()[name] = values
+					}
+					w.Header().Set("Age", strconv.Itoa(int(time.Since(cached.Stored).Seconds())))
+					w.Header().Set("X-Cache", "HIT")
+					w.Write(cached.Body)
+					return
+				}
+			}
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		rec := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		if rec.status != http.StatusOK {
+			return
+		}
+
+		header := rec.header.Clone()
+		control := cacheControl(header.Get("Cache-Control"))
+		if control.has("no-store") || control.has("no-cache") || control.has("private") {
+			return
+		}
+		expires := ttl
+		if maxAge, ok := control.seconds("s-maxage"); ok {
+			expires = maxAge
+		} else if maxAge, ok := control.seconds("max-age"); ok {
+			expires = maxAge
+		}
+		vary = varyHeaders(header)
+		if expires <= 0 || (len(vary) == 1 && vary[0] == "*") {
+			return
+		}
+
+		header.Del("X-Cache")
+		header.Del("X-Request-Id")
+		data, err := json.Marshal(cachedResponse{Header: header, Body: rec.body.Bytes(), Stored: time.Now()})
+		if err != nil {
+			return
+		}
+		if names, err := json.Marshal(vary); err == nil {
+			s.cache.Set(r.Context(), base+"\nvary", names, expires)
+		}
+		s.cache.Set(r.Context(), variantKey(base, vary, r), data, expires)
+	}
+}
+
+// variantKey extends base with the caller, the tenant the request acts for
+// and the request's values of the vary headers. Anonymous requests to
+// public routes share their variants.
+func variantKey(base string, vary []string, r *http.Request) string {
+	var key strings.Builder
+	key.WriteString(base)
+	if claims, ok := auth.GetClaims(r.Context()); ok {
+		key.WriteString("\nprincipal=" + claims.Type + ":" + claims.Subject)
+		key.WriteString("\ntenant=" + r.Header.Get(auth.TenantHeader))
+	}
+	for _, name := range vary {
+		key.WriteString("\n" + name + "=" + strings.Join(r.Header.Values(name), ","))
+	}
+	return key.String()
+}
+
+// varyHeaders lists the canonical header names of the Vary headers once,
+// in order
+func varyHeaders(header http.Header) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// cacheDirectives are the directives of a Cache-Control header with their
+// values, empty for directives without one
+type cacheDirectives map[string]string
+
+func cacheControl(header string) cacheDirectives {
+	directives := cacheDirectives{}
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+func (d cacheDirectives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// seconds returns the duration of a directive such as max-age
+func (d cacheDirectives) seconds(name string) (time.Duration, bool) {
+	value, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// invalidates purges namespace from the response cache after a write
+// handler succeeds
+func (s *Server) invalidates(namespace string, next http.HandlerFunc) http.HandlerFunc {
+	if s.cache == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		if rec.status < 400 {
+			s.cache.Purge(r.Context(), namespace+":")
+		}
+	}
+}
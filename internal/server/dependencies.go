@@ -0,0 +1,21 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	"exampleserver/internal/health"
+)
+
+// AddHealthCheck registers a check of a dependency, run every
+// HEALTH_CHECK_INTERVAL within its HEALTH_CHECK_TIMEOUTS entry or
+// HEALTH_CHECK_TIMEOUT. Dependencies named in HEALTH_CRITICAL fail readiness
+// while unhealthy. Applications can add their own before Start.
+func (s *Server) AddHealthCheck(name string, check func(ctx context.Context) error) {
+	s.health.Register(health.Check{
+		Name:     name,
+		Run:      check,
+		Timeout:  s.depTimeouts[name],
+		Critical: slices.Contains(s.config.HealthCritical, name),
+	})
+}
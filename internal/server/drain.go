@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+
+	"exampleserver/internal/handlers"
+)
+
+var errDraining = errors.New("server is draining")
+
+// Drain fails readiness and disables keep-alives: idle connections are
+// closed and busy ones are closed after their current response, so clients
+// reconnect through the load balancer to another instance
+func (s *Server) Drain() handlers.DrainStatus {
+	if !s.draining.Swap(true) {
+		s.logger.Info("Draining: readiness failing, keep-alives disabled")
+		s.server.SetKeepAlivesEnabled(false)
+	}
+	return s.DrainStatus()
+}
+
+// Resume undoes Drain
+func (s *Server) Resume() handlers.DrainStatus {
+	if s.draining.Swap(false) {
+		s.logger.Info("Drain cancelled: accepting traffic again")
+		s.server.SetKeepAlivesEnabled(true)
+	}
+	return s.DrainStatus()
+}
+
+// DrainStatus reports the requests and connections still open. The request
+// asking is not counted.
+func (s *Server) DrainStatus() handlers.DrainStatus {
+	inFlight := s.inFlight.Load() - 1
+	if inFlight < 0 {
+		inFlight = 0
+	}
+	return handlers.DrainStatus{
+		Draining:        s.draining.Load(),
+		InFlight:        inFlight,
+		OpenConnections: s.conns.Open(),
+	}
+}
+
+// ready reports whether the server should receive traffic
+func (s *Server) ready() error {
+	if s.draining.Load() {
+		return errDraining
+	}
+	if s.lowMemory.Load() {
+		return errLowMemory
+	}
+	if err := s.services.Running(s.config.ServicesCritical...); err != nil {
+		return err
+	}
+	return s.health.Ready()
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"exampleserver/internal/version"
+	"exampleserver/pkg/logger"
+)
+
+// ExitReason says why the server stopped
+type ExitReason string
+
+const (
+	// ExitSignal is a stop asked for by a signal, or by cancelling the
+	// context given to Serve
+	ExitSignal ExitReason = "signal"
+	// ExitListener is the listener failing to open or to accept connections
+	ExitListener ExitReason = "listener"
+	// ExitConfig is a configuration error the server can't start with
+	ExitConfig ExitReason = "config"
+	// ExitServices is the background services failing to start
+	ExitServices ExitReason = "services"
+	// ExitRestart is a restart the server asked for itself, such as the
+	// memory watchdog's restart action
+	ExitRestart ExitReason = "restart"
+)
+
+// Exit codes of the serve command, from sysexits.h where one fits, so
+// supervisors can tell a crash from a clean stop
+const (
+	ExitCodeOK          = 0  // stopped by a signal and shut down cleanly
+	ExitCodeError       = 1  // any other failure, including an unclean shutdown or services failing to start
+	ExitCodeUnavailable = 69 // EX_UNAVAILABLE: the listener failed
+	ExitCodeRestart     = 75 // EX_TEMPFAIL: start the server again
+	ExitCodeConfig      = 78 // EX_CONFIG: fix the configuration first
+)
+
+// ExitError is returned by Start and Serve when the server stops for any
+// reason other than a clean stop by a signal
+type ExitError struct {
+	Reason ExitReason
+	Err    error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Code is the process exit code for the error
+func (e *ExitError) Code() int {
+	switch e.Reason {
+	case ExitListener:
+		return ExitCodeUnavailable
+	case ExitRestart:
+		return ExitCodeRestart
+	case ExitConfig:
+		return ExitCodeConfig
+	}
+	return ExitCodeError
+}
+
+// ExitCode is the process exit code for an error returned by Start: 0 for
+// nil, the code of an ExitError, and 1 for anything else
+func ExitCode(err error) int {
+	var exitErr *ExitError
+	switch {
+	case err == nil:
+		return ExitCodeOK
+	case errors.As(err, &exitErr):
+		return exitErr.Code()
+	}
+	return ExitCodeError
+}
+
+// signalCause is the cause of the context Start cancels on a signal
+type signalCause struct {
+	signal os.Signal
+}
+
+func (c signalCause) Error() string {
+	return "received " + c.signal.String()
+}
+
+// exitSummary is what Serve logs as it returns
+type exitSummary struct {
+	reason          ExitReason
+	signal          os.Signal // nil unless stopped by a signal
+	inFlight        int64     // requests in flight when shutdown began
+	shutdownStarted time.Time // zero if there was no graceful shutdown
+	err             error
+}
+
+// logExit logs the summary of why and how the server stopped, with the
+// requests and connections the shutdown left behind
+func (s *Server) logExit(summary exitSummary) {
+	var err error
+	if summary.err != nil {
+		err = &ExitError{Reason: summary.reason, Err: summary.err}
+	}
+	fields := map[string]interface{}{
+		"shutdown":             true,
+		"reason":               string(summary.reason),
+		"exit_code":            ExitCode(err),
+		"uptime":               version.Uptime().Round(time.Second).String(),
+		"in_flight":            summary.inFlight,
+		"outstanding_requests": s.inFlight.Load(),
+		"open_connections":     s.conns.Open(),
+	}
+	if summary.signal != nil {
+		fields["signal"] = summary.signal.String()
+	}
+	if !summary.shutdownStarted.IsZero() {
+		fields["shutdown_duration"] = time.Since(summary.shutdownStarted).Round(time.Millisecond).String()
+	}
+	if err == nil {
+		s.logger.WithFields(fields).Info("Server stopped (%s)", summary.reason)
+		return
+	}
+	fields["error"] = err.Error()
+	if summary.reason == ExitRestart {
+		// Asked for, so not a failure
+		s.logger.WithFields(fields).Warn("Server stopped (%s): %v", summary.reason, err)
+		return
+	}
+	s.logger.WithFields(fields).Error("Server stopped (%s): %v", summary.reason, err)
+}
+
+// configError is a configuration error the server can't start with, for
+// New to return
+func configError(format string, args ...interface{}) error {
+	return &ExitError{Reason: ExitConfig, Err: fmt.Errorf(format, args...)}
+}
+
+// LogConfigError logs an error returned by New, with the exit code it sets
+func LogConfigError(log logger.LoggerInterface, err error) {
+	log.WithFields(map[string]interface{}{
+		"reason":    string(ExitConfig),
+		"exit_code": ExitCode(err),
+	}).Error("%v", err)
+}
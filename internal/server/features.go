@@ -0,0 +1,86 @@
+package server
+
+import (
+	"strings"
+
+	"exampleserver/internal/version"
+	"exampleserver/pkg/logger"
+)
+
+// features lists the optional subsystems enabled by the configuration
+func (s *Server) features() []string {
+	features := []string{"store:" + s.config.StoreDriver}
+	if s.cache != nil {
+		features = append(features, "cache:"+s.config.CacheDriver)
+	}
+	features = append(features, "outbox:webhooks")
+	if len(s.config.OutboxKafkaBrokers) > 0 {
+		features = append(features, "outbox:kafka")
+	}
+	if s.mqtt != nil && s.config.MQTTPublishEvents {
+		features = append(features, "outbox:mqtt")
+	}
+	if s.mqtt != nil {
+		features = append(features, "mqtt")
+	}
+	if s.queue != nil {
+		features = append(features, "queue:"+s.config.QueueDriver)
+	}
+	if s.mailer != nil {
+		features = append(features, "mail:"+s.config.MailDriver)
+	}
+	if len(s.inbound.Sources()) > 0 {
+		features = append(features, "inbound-webhooks")
+	}
+	if s.config.ResponseEnvelope != "none" {
+		features = append(features, "envelope:"+s.config.ResponseEnvelope)
+	}
+	if s.authorizer != nil {
+		features = append(features, "authz:"+s.config.AuthzPolicy)
+	}
+	if s.config.SCIMToken != "" {
+		features = append(features, "scim")
+	}
+	if s.config.SeedAPI {
+		features = append(features, "seed-api")
+	}
+	for _, provider := range s.oauthProviders() {
+		features = append(features, "oauth:"+provider.Name)
+	}
+	if s.mirror != nil {
+		features = append(features, "mirror")
+	}
+	if s.config.ShedMaxInFlight > 0 || s.config.ShedMaxLatency > 0 {
+		features = append(features, "load-shedding")
+	}
+	if s.limiter != nil {
+		features = append(features, "concurrency-limits")
+	}
+	if logger.Access().Enabled() {
+		features = append(features, "access-log")
+	}
+	if s.config.DatadogEnabled {
+		features = append(features, "datadog")
+	}
+	if s.config.StatsPushURL != "" {
+		features = append(features, "stats-push")
+	}
+	if s.config.StatsAlertRules != "" {
+		features = append(features, "stats-alerts")
+	}
+	if s.config.GoroutineGrowthIntervals > 0 {
+		features = append(features, "goroutine-watchdog")
+	}
+	if s.config.MemoryRSSLimit > 0 || s.config.MemoryHeapLimit > 0 {
+		features = append(features, "memory-watchdog")
+	}
+	return features
+}
+
+// logBuildInfo logs the build and enabled features at startup so the
+// deployed version can be read off the logs
+func (s *Server) logBuildInfo() {
+	info := version.Get()
+	s.logger.Info("Version %s (commit %s, built %s, %s), features: %s",
+		info.Version, info.Commit, info.BuildDate, info.GoVersion, strings.Join(s.features(), ", "))
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/requestid"
+)
+
+const (
+	idempotencyHeader  = "Idempotency-Key"
+	maxIdempotencyKey  = 255
+	maxIdempotencyBody = 1 << 20
+)
+
+// idempotencyCache stores responses to requests carrying an Idempotency-Key
+// so retries replay the original response instead of repeating the write
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[[32]byte]*idempotentResponse
+}
+
+type idempotentResponse struct {
+	fingerprint [32]byte // method, path and body of the original request
+	complete    bool
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     ttl,
+		entries: make(map[[32]byte]*idempotentResponse),
+	}
+}
+
+// idempotent wraps a write handler. Keys are scoped to the caller's
+// credentials; a key reused with a different request is rejected, and a
+// retry while the original is still running gets a 409.
+func (c *idempotencyCache) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			httperr.Write(w, r, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotencyBody+1))
+		if err != nil || len(body) > maxIdempotencyBody {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		id := sha256.Sum256([]byte(r.Header.Get("Authorization") + "\x00" + r.Header.Get("X-API-Key") + "\x00" +
+			r.URL.Query().Get("API-KEY") + "\x00" + key))
+		fingerprint := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\x00"), body...))
+
+		c.mu.Lock()
+		entry, ok := c.entries[id]
+		if ok && entry.complete && time.Now().After(entry.expires) {
+			ok = false
+		}
+		if ok {
+			c.mu.Unlock()
+			switch {
+			case entry.fingerprint != fingerprint:
+				httperr.Write(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			case !entry.complete:
+				httperr.Write(w, r, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+			default:
+				replay(w, entry)
+			}
+			return
+		}
+		entry = &idempotentResponse{fingerprint: fingerprint}
+		c.entries[id] = entry
+		c.mu.Unlock()
+
+		rec := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if rec.status >= 500 {
+			// Let the client retry server errors
+			delete(c.entries, id)
+			return
+		}
+		entry.complete = true
+		entry.status = rec.status
+		entry.header = rec.header
+		if entry.header == nil {
+			entry.header = w.Header().Clone()
+		}
+		entry.body = rec.body.Bytes()
+		entry.expires = time.Now().Add(c.ttl)
+	}
+}
+
+// sweep drops expired responses
+func (c *idempotencyCache) sweep(ctx context.Context) error {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.entries {
+		if entry.complete && now.After(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+	return nil
+}
+
+func replay(w http.ResponseWriter, entry *idempotentResponse) {
+	for name, values := range entry.header {
+		if name == http.CanonicalHeaderKey(requestid.Header) {
+			continue
+		}
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
+
+// responseCapture records the status, headers and body written by a handler
+// while passing them through
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.header == nil {
+		c.status = status
+		c.header = c.ResponseWriter.Header().Clone()
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.header == nil {
+		c.WriteHeader(http.StatusOK)
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"exampleserver/internal/stats"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/logger"
+)
+
+// keyUsageFlushInterval is how often the API key usage recorded is added to
+// the store; a crash loses at most this much
+const keyUsageFlushInterval = time.Minute
+
+// keyUsageSaver is a service keeping the API key usage tracker's counts in
+// the store, so the 30 days reported survive restarts. It loads the counts
+// saved by earlier runs when it starts, adds those recorded since to the
+// store every minute and once more when it stops.
+type keyUsageSaver struct {
+	tracker *stats.KeyUsageTracker
+	repo    store.KeyUsageRepository
+	logger  logger.LoggerInterface
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newKeyUsageSaver(tracker *stats.KeyUsageTracker, repo store.KeyUsageRepository, logger logger.LoggerInterface) *keyUsageSaver {
+	return &keyUsageSaver{tracker: tracker, repo: repo, logger: logger}
+}
+
+// Name identifies the service to the service manager
+func (k *keyUsageSaver) Name() string {
+	return "key-usage"
+}
+
+func (k *keyUsageSaver) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer close(done)
+
+	k.mu.Lock()
+	k.cancel = cancel
+	k.done = done
+	k.mu.Unlock()
+	defer cancel()
+
+	// Added to what was recorded meanwhile, so requests served before the
+	// counts are loaded aren't lost
+	saved, err := k.repo.List(ctx, k.tracker.Oldest())
+	if err != nil {
+		k.logger.Error("Failed to load the API key usage, reporting only usage from now on: %v", err)
+	}
+	counts := make([]stats.KeyUsageCount, len(saved))
+	for i, u := range saved {
+		counts[i] = stats.KeyUsageCount{KeyID: u.KeyID, Date: u.Date, Route: u.Route, LastUsed: u.LastUsed}
+		counts[i].Requests, counts[i].ClientErrors, counts[i].ServerErrors = u.Requests, u.ClientErrors, u.ServerErrors
+	}
+	k.tracker.Load(counts)
+
+	ticker := time.NewTicker(keyUsageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := k.flush(ctx); err != nil {
+				k.logger.Error("Failed to save the API key usage, retrying in %s: %v", keyUsageFlushInterval, err)
+			}
+		}
+	}
+}
+
+// Stop ends the periodic flushes, then saves what was recorded since the
+// last one
+func (k *keyUsageSaver) Stop(ctx context.Context) error {
+	k.mu.Lock()
+	cancel, done := k.cancel, k.done
+	k.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return k.flush(ctx)
+}
+
+// flush adds the counts recorded since the last flush to the store and
+// deletes the days no longer reported. Counts that fail to be added are
+// kept for the next flush.
+func (k *keyUsageSaver) flush(ctx context.Context) error {
+	counts := k.tracker.Unsaved()
+	usage := make([]store.KeyUsage, len(counts))
+	for i, c := range counts {
+		usage[i] = store.KeyUsage{
+			KeyID:        c.KeyID,
+			Date:         c.Date,
+			Route:        c.Route,
+			Requests:     c.Requests,
+			ClientErrors: c.ClientErrors,
+			ServerErrors: c.ServerErrors,
+			LastUsed:     c.LastUsed,
+		}
+	}
+	if err := k.repo.Add(ctx, usage); err != nil {
+		k.tracker.Restore(counts)
+		return err
+	}
+	return k.repo.Prune(ctx, k.tracker.Oldest())
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"exampleserver/internal/stats"
+	"exampleserver/pkg/httperr"
+)
+
+var requestsLimited = stats.NewCounter("requests_limited")
+
+// routeLimit bounds the concurrent requests to paths under prefix
+type routeLimit struct {
+	prefix string
+	slots  chan struct{}
+}
+
+// concurrencyLimiter bounds the requests running at once, overall and per
+// route group. Requests over a limit queue for a slot for up to timeout and
+// are then answered 503.
+type concurrencyLimiter struct {
+	global  chan struct{} // nil when unlimited
+	routes  []routeLimit  // longest prefix first
+	timeout time.Duration
+}
+
+func newConcurrencyLimiter(global int, routes map[string]int, timeout time.Duration) *concurrencyLimiter {
+	l := &concurrencyLimiter{timeout: timeout}
+	if global > 0 {
+		l.global = make(chan struct{}, global)
+	}
+	for prefix, limit := range routes {
+		l.routes = append(l.routes, routeLimit{prefix: prefix, slots: make(chan struct{}, limit)})
+	}
+	sort.Slice(l.routes, func(i, j int) bool { return len(l.routes[i].prefix) > len(l.routes[j].prefix) })
+	return l
+}
+
+// middleware takes the slot of the request's route group, then a global
+// slot. Health and admin endpoints only count against route limits, so they
+// stay responsive when the server is busy. The requests of a batch run in
+// the slots the batch holds, so they only take the slot of a route group
+// the batch isn't in.
+func (l *concurrencyLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), l.timeout)
+		defer cancel()
+
+		for _, route := range l.routes {
+			if strings.HasPrefix(r.URL.Path, route.prefix) {
+				if inBatch(r) && strings.HasPrefix(batchPath, route.prefix) {
+					break
+				}
+				if !l.acquire(ctx, w, r, route.slots) {
+					return
+				}
+				defer func() { <-route.slots }()
+				break
+			}
+		}
+		if l.global != nil && !priority(r.URL.Path, nil) && !inBatch(r) {
+			if !l.acquire(ctx, w, r, l.global) {
+				return
+			}
+			defer func() { <-l.global }()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire waits for a slot until ctx is done, answering 503 when the wait
+// timed out. Nothing is written when the client has gone away.
+func (l *concurrencyLimiter) acquire(ctx context.Context, w http.ResponseWriter, r *http.Request, slots chan struct{}) bool {
+	// A free slot is taken even when the timeout is zero
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+	}
+	if r.Context().Err() == nil {
+		requestsLimited.Inc()
+		w.Header().Set("Retry-After", "1")
+		httperr.Write(w, r, http.StatusServiceUnavailable, "Too many concurrent requests, retry later")
+	}
+	return false
+}
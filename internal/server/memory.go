@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+
+	"exampleserver/internal/stats"
+)
+
+var errLowMemory = errors.New("memory is over its limit")
+
+// ErrRestart is returned by Start after a graceful shutdown the server asked
+// for itself, for the caller to start it again
+var ErrRestart = errors.New("server restart requested")
+
+// memoryActions are the memory watchdog's protective actions named by
+// MEMORY_ACTIONS
+func (s *Server) memoryActions() []stats.MemoryAction {
+	var actions []stats.MemoryAction
+	for _, name := range s.config.MemoryActions {
+		action := stats.MemoryAction{Name: name}
+		switch name {
+		case "gc":
+			// FreeOSMemory collects garbage and returns what it can to the OS
+			action.Run = func() error {
+				debug.FreeOSMemory()
+				return nil
+			}
+		case "drop-caches":
+			// A Redis cache doesn't hold memory of this process
+			action.Run = func() error {
+				if s.cache != nil && s.config.CacheDriver == "memory" {
+					s.cache.Purge(context.Background(), "")
+				}
+				debug.FreeOSMemory()
+				return nil
+			}
+		case "unready":
+			action.Run = func() error {
+				s.lowMemory.Store(true)
+				return nil
+			}
+			action.Undo = func() { s.lowMemory.Store(false) }
+		case "restart":
+			action.Run = func() error {
+				s.Restart()
+				return nil
+			}
+		default:
+			s.logger.Error("Unknown memory watchdog action %q", name)
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// Restart shuts the server down gracefully and has Start return ErrRestart
+func (s *Server) Restart() {
+	select {
+	case s.restart <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+	"exampleserver/pkg/requestid"
+
+	"github.com/gorilla/mux"
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.wroteHeader = true
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// trackRequests records the outcome of every request against its route
+// template and any SLO of the route in the stats service, and counts the
+// requests in flight
+func (s *Server) trackRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		route, duration := routeName(r), time.Since(start)
+		s.statsService.Requests().Record(route, rec.status, duration)
+		s.statsService.SLOs().Record(route, rec.status, duration)
+	})
+}
+
+// trackKeyUsage records requests made with an API key accepted by keys
+// against the key in the stats service
+func (s *Server) trackKeyUsage(keys auth.Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := keys.Authenticate(r)
+			if err != nil || claims.KeyID == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			s.statsService.KeyUsage().Record(claims.KeyID, routeName(r), rec.status)
+		})
+	}
+}
+
+// routeName names the request's route by method and path template, falling
+// back to the path for unmatched requests
+func routeName(r *http.Request) string {
+	route := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			route = tmpl
+		}
+	}
+	return r.Method + " " + route
+}
+
+// recoverPanics turns a panicking handler into a 500 response and logs the
+// panic at ERROR with its stack, for error reporting plugins to pick up.
+// http.ErrAbortHandler is re-panicked so net/http aborts the response as the
+// handler intended.
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(p)
+			}
+
+			// Reported with the request's fields from logRequestContext
+			fields := logger.PanicFields(p, debug.Stack())
+			fields["user_agent"] = r.UserAgent()
+			logger.Ctx(r.Context()).WithFields(fields).Error("Handler for %s %s panicked: %v", r.Method, r.URL.Path, p)
+
+			// Too late for a problem response once the handler has started one
+			if !rec.wroteHeader {
+				httperr.Write(rec, r, http.StatusInternalServerError, "Internal server error")
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// traceParent matches a W3C traceparent header: version, trace ID, parent
+// span ID and flags
+var traceParent = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// logRequestContext puts a logger in the request context that tags entries
+// with the request ID, method and path, plus the trace ID when the caller
+// sent a traceparent header, for handlers to log through logger.Ctx
+func (s *Server) logRequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields := map[string]interface{}{
+			"request_id":  requestid.FromContext(r.Context()),
+			"http_method": r.Method,
+			"path":        r.URL.Path,
+		}
+		if m := traceParent.FindStringSubmatch(r.Header.Get("traceparent")); m != nil {
+			fields["trace_id"] = m[1]
+			fields["span_id"] = m[2]
+		}
+		ctx := logger.NewContext(r.Context(), s.logger.WithFields(fields))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"exampleserver/internal/stats"
+	"exampleserver/pkg/logger"
+)
+
+const (
+	// mirrorHeader marks mirrored requests so the upstream can tell them
+	// from real traffic
+	mirrorHeader = "X-Mirrored-Request"
+	// maxMirrorBody is the largest request body mirrored; requests with
+	// larger bodies are served but not mirrored
+	maxMirrorBody = 1 << 20
+	// maxMirrorsInFlight bounds the mirrored requests waiting on a slow
+	// upstream; beyond it requests are dropped rather than queued
+	maxMirrorsInFlight = 64
+)
+
+// hopHeaders apply to a single connection and aren't mirrored
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// credentialHeaders carry the caller's credentials, which the mirror isn't
+// trusted with
+var credentialHeaders = []string{"Authorization", "X-API-Key", "Cookie"}
+
+// credentialParams are query parameters carrying credentials
+var credentialParams = []string{"API-KEY"}
+
+// mirror duplicates a percentage of requests to a secondary upstream in the
+// background and ignores its responses, for validating a new version of a
+// service against real traffic. Copies are sent without the caller's
+// credentials, and only GET and HEAD requests are copied unless writes is
+// set, so the mirror can't act for callers or change shared data.
+type mirror struct {
+	target   *url.URL
+	writes   bool
+	percent  atomic.Int64
+	client   *http.Client
+	inFlight chan struct{}
+	logger   logger.LoggerInterface
+
+	sent    *stats.Counter
+	failed  *stats.Counter
+	dropped *stats.Counter
+}
+
+func newMirror(target *url.URL, percent int, timeout time.Duration, writes bool, logger logger.LoggerInterface) *mirror {
+	m := &mirror{
+		target:   target,
+		writes:   writes,
+		client:   &http.Client{Timeout: timeout},
+		inFlight: make(chan struct{}, maxMirrorsInFlight),
+		logger:   logger,
+		sent:     stats.NewCounter("mirror_requests"),
+		failed:   stats.NewCounter("mirror_failures"),
+		dropped:  stats.NewCounter("mirror_dropped"),
+	}
+	m.percent.Store(int64(percent))
+	return m
+}
+
+// middleware mirrors the sampled requests. The body is buffered so both the
+// handler and the upstream get all of it; the request is served the same
+// whether or not mirroring succeeds.
+func (m *mirror) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		read := r.Method == http.MethodGet || r.Method == http.MethodHead
+		if (!read && !m.writes) || rand.Int63n(100) >= m.percent.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, maxMirrorBody+1))
+			if err != nil || len(body) > maxMirrorBody {
+				// Serve the request with the part already read put back
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+				m.dropped.Inc()
+				next.ServeHTTP(w, r)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		select {
+		case m.inFlight <- struct{}{}:
+			go func(req *http.Request) {
+				defer func() { <-m.inFlight }()
+				m.send(req, body)
+			}(r.Clone(context.Background()))
+		default:
+			m.dropped.Inc()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// send replays r with body to the upstream and discards the response
+func (m *mirror) send(r *http.Request, body []byte) {
+	target := *m.target
+	target.Path = strings.TrimSuffix(m.target.Path, "/") + r.URL.Path
+	target.RawPath = ""
+	query := r.URL.Query()
+	for _, param := range credentialParams {
+		query.Del(param)
+	}
+	target.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		m.failed.Inc()
+		return
+	}
+	req.Header = r.Header.Clone()
+	for _, header := range append(hopHeaders, credentialHeaders...) {
+		req.Header.Del(header)
+	}
+	req.Header.Set(mirrorHeader, "true")
+
+	m.sent.Inc()
+	resp, err := m.client.Do(req)
+	if err != nil {
+		m.failed.Inc()
+		m.logger.Debug("Mirroring %s %s failed: %v", r.Method, r.URL.Path, err)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		m.failed.Inc()
+		m.logger.Debug("Mirror answered %s %s with %s", r.Method, r.URL.Path, resp.Status)
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/openapi"
+	"exampleserver/internal/stats"
+	"exampleserver/pkg/config"
+	"exampleserver/pkg/httperr"
+)
+
+var requestsRateLimited = stats.NewCounter("requests_rate_limited")
+
+// rateLimitSweepInterval is how often idle callers' buckets are dropped
+const rateLimitSweepInterval = time.Minute
+
+// cacheTTLKey holds the response cache lifetime of a route overriding
+// CACHE_TTL, see cached
+type cacheTTLKey struct{}
+
+// routeOverrides applies the ROUTE_CONFIG overrides matching each operation
+// as it is registered
+func (s *Server) routeOverrides(overrides []config.RouteOverride) func(op openapi.Operation, next http.Handler) http.Handler {
+	return func(op openapi.Operation, next http.Handler) http.Handler {
+		override, ok := matchOverride(overrides, op.Method, op.Path)
+		if !ok {
+			return next
+		}
+		if slo := override.SLO; slo != nil {
+			s.statsService.SLOs().Track(op.Method+" "+op.Path, stats.SLO{
+				Availability:  slo.Availability,
+				LatencyTarget: slo.LatencyTarget,
+				Latency:       slo.Latency,
+				Window:        slo.Window,
+			})
+		}
+		h := next
+		if override.CacheTTL != nil {
+			ttl := *override.CacheTTL
+			inner := h
+			h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inner.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), cacheTTLKey{}, ttl)))
+			})
+		}
+		if len(override.Roles) > 0 {
+			if op.Public {
+				s.logger.Warn("ROUTE_CONFIG roles for %s %s are ignored: the route is public", op.Method, op.Path)
+			} else {
+				for i := len(override.Roles) - 1; i >= 0; i-- {
+					h = auth.RequireRole(override.Roles[i], h.ServeHTTP)
+				}
+			}
+		}
+		if override.Timeout > 0 {
+			h = withTimeout(override.Timeout, h)
+		}
+		if override.MaxBodyBytes > 0 {
+			h = limitBody(override.MaxBodyBytes, h)
+		}
+		if override.RateLimit > 0 {
+			limiter := newRateLimiter(override.RateLimit, override.Burst)
+			limiter.scale = s.rateLimitMultiplier
+			h = limiter.middleware(h)
+		}
+		return h
+	}
+}
+
+// matchOverride merges the overrides for method on the route template path,
+// the more specific ones last: a matching path beats any prefix, and a
+// longer prefix a shorter one
+func matchOverride(overrides []config.RouteOverride, method, path string) (config.RouteOverride, bool) {
+	var matched []config.RouteOverride
+	for _, o := range overrides {
+		if o.Path != path && (o.Prefix == "" || !strings.HasPrefix(path, o.Prefix)) {
+			continue
+		}
+		if len(o.Methods) > 0 && !slices.Contains(o.Methods, method) {
+			continue
+		}
+		matched = append(matched, o)
+	}
+	if len(matched) == 0 {
+		return config.RouteOverride{}, false
+	}
+	specificity := func(o config.RouteOverride) int {
+		if o.Path != "" {
+			return math.MaxInt
+		}
+		return len(o.Prefix)
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return specificity(matched[i]) < specificity(matched[j]) })
+
+	var merged config.RouteOverride
+	for _, o := range matched {
+		if o.Timeout > 0 {
+			merged.Timeout = o.Timeout
+		}
+		if o.MaxBodyBytes > 0 {
+			merged.MaxBodyBytes = o.MaxBodyBytes
+		}
+		if o.RateLimit > 0 {
+			merged.RateLimit, merged.Burst = o.RateLimit, o.Burst
+		}
+		if len(o.Roles) > 0 {
+			merged.Roles = o.Roles
+		}
+		if o.CacheTTL != nil {
+			merged.CacheTTL = o.CacheTTL
+		}
+		if o.SLO != nil {
+			merged.SLO = o.SLO
+		}
+	}
+	return merged, true
+}
+
+// withTimeout cancels the request's context after timeout and moves the
+// write deadline to match, so a route can run for longer or shorter than
+// the server's write timeout
+func withTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// limitBody answers 413 to requests declaring a larger body than max, and
+// stops reading bodies that turn out larger
+func limitBody(max int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > max {
+			httperr.Writef(w, r, http.StatusRequestEntityTooLarge, "Request body is larger than %d bytes", max)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimiter allows each caller perSecond requests a second on average, in
+// bursts of up to burst, and answers 429 to the rest
+type rateLimiter struct {
+	perSecond float64
+	burst     float64
+	// scale multiplies the rate and burst when set, see ToggleSettings
+	scale func() float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a limiter. A burst below one defaults to perSecond
+// rounded up.
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Ceil(perSecond))
+	}
+	return &rateLimiter{perSecond: perSecond, burst: float64(burst), buckets: map[string]*tokenBucket{}, swept: time.Now()}
+}
+
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := l.take(caller(r), time.Now()); wait > 0 {
+			requestsRateLimited.Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			httperr.Write(w, r, http.StatusTooManyRequests, "Rate limit exceeded, retry later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// take spends one of key's tokens, or returns how long until one is
+// available
+func (l *rateLimiter) take(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	perSecond, burst := l.perSecond, l.burst
+	if l.scale != nil {
+		factor := l.scale()
+		perSecond, burst = perSecond*factor, math.Max(1, burst*factor)
+	}
+
+	// Buckets that have filled up again are the same as new ones
+	if now.Sub(l.swept) > rateLimitSweepInterval {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*perSecond >= burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// caller identifies the client of a request for rate limiting: its API key
+// or the subject of its token, or its address when it has no credentials
+func caller(r *http.Request) string {
+	if claims, ok := auth.GetClaims(r.Context()); ok {
+		if claims.KeyID != "" {
+			return "key:" + claims.KeyID
+		}
+		return claims.Type + ":" + claims.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,37 +1,759 @@
 package server
 
 import (
+	"context"
 	"net/http"
+	"strings"
+	"time"
 
 	"exampleserver/internal/auth"
 	"exampleserver/internal/handlers"
+	"exampleserver/internal/openapi"
+	"exampleserver/internal/queue"
+	"exampleserver/internal/services"
+	"exampleserver/internal/stats"
+	"exampleserver/internal/store"
+	"exampleserver/internal/tasks"
+	"exampleserver/internal/version"
+	"exampleserver/internal/webhooks"
+	"exampleserver/pkg/httperr"
 	"exampleserver/pkg/logger"
+
+	"github.com/gorilla/mux"
 )
 
 func (s *Server) setupRoutes() {
 	// Create JWT service for token generation
-	jwtService := auth.NewJWTService(s.config.JWTSecret)
+	jwtService := auth.NewJWTService(s.config.JWTSecret).WithEncryption(s.tokens)
+
+	// Signed links grant access to a single resource without credentials
+	urlSecret := s.config.SignedURLSecret
+	if len(urlSecret) == 0 {
+		urlSecret = s.config.JWTSecret
+	}
+	urlSigner := auth.NewURLSigner(urlSecret)
 
 	// Create authenticators and middleware
-	jwtAuth := auth.NewJWTAuthenticator(s.config.JWTSecret, "")
-	apiAuth := auth.NewAPIKeyAuthenticator(nil)
-	authChain := auth.NewChain(apiAuth, jwtAuth)
+	jwtAuth := auth.Validated(auth.NewJWTAuthenticator(s.config.JWTSecret, "").WithEncryption(s.tokens), s.validateSession)
+	apiAuth := auth.NewAPIKeyAuthenticator(s.config.APIKeys, s.config.APIKeyRoles, s.config.APIKeyTenants, s.config.DevMode)
+	authChain := auth.NewChain(apiAuth, auth.NewSCIMAuthenticator(s.config.SCIMToken), jwtAuth)
+	s.setupAccessLog(authChain)
 	authMiddleware := auth.NewMiddleware(authChain, s.logger)
+	authorize := auth.Authorize(s.authorizer)
+	protect := func(next http.Handler) http.Handler {
+		return authMiddleware.RequireAuth(authorize(next))
+	}
 
 	// Create handlers
-	authHandler := handlers.NewAuth(jwtService)
-	customersHandler := handlers.NewCustomers()
+	devicesHandler := handlers.NewDevices(jwtService, s.store.Users, s.store.Devices, s.config.DeviceTokenTTL)
+	authHandler := handlers.NewAuth(jwtService, s.store.Users, s.passwords, devicesHandler)
+	oauthHandler := handlers.NewOAuth(s.oauthProviders(), jwtService, s.store.Users, s.store.Identities,
+		s.config.OAuthSuccessURL, strings.HasPrefix(s.config.OAuthRedirectBaseURL, "https://"))
+	usersHandler := handlers.NewUsers(s.store.Users, s.passwords, s.mailer, urlSigner, s.config.PublicURL)
+	scimHandler := handlers.NewSCIM(s.store.Users, s.passwords)
+	apiKeysHandler := handlers.NewAPIKeys(apiAuth.Keys(), s.statsService.KeyUsage())
+	customersHandler := handlers.NewCustomers(s.store.Customers, s.tasks)
+	// Customers can be created from queue messages as well as requests
+	if s.queue != nil {
+		s.queue.Handle("customers.create", func(ctx context.Context, msg queue.Message) error {
+			err := customersHandler.CreateMessage(ctx, msg)
+			if err == nil && s.cache != nil {
+				s.cache.Purge(ctx, "customers:")
+			}
+			return err
+		})
+	}
+	tasksHandler := handlers.NewTasks(s.tasks)
+	statsHandler := handlers.NewStats(s.statsService)
+	s.closeStreams = append(s.closeStreams, statsHandler.CloseStreams)
+	servicesHandler := handlers.NewServices(s.services, s.health)
+	jobsHandler := handlers.NewJobs(s.scheduler)
+	webhooksHandler := handlers.NewWebhooks(s.webhooks)
+	inboundHandler := handlers.NewInbound(s.inbound, s.store.Inbound)
+	graphqlHandler := handlers.NewGraphQL(s.store.Customers, s.store.Users, s.authorizer)
+	versionHandler := handlers.NewVersion(s.features())
+	healthHandler := handlers.NewHealth(s.ready)
+	drainHandler := handlers.NewDrain(s)
+	traceHandler := handlers.NewTrace(s.config.TraceMaxDuration, int64(s.config.TraceMaxSize)<<20)
+	runtimeHandler := handlers.NewRuntime(s.store.Audit)
+	togglesHandler := handlers.NewToggles(s)
+	auditHandler := handlers.NewAuditLog(s.store.Audit)
+	logExportsHandler := handlers.NewLogExports(s.logExporter, s.tasks)
+	logErasuresHandler := handlers.NewLogErasures(s.logExporter, s.tasks)
+	seedHandler := handlers.NewSeed(s.store, s.passwords, s.tasks)
+	logDownloadsHandler := handlers.NewLogDownloads(s.logger.GetLogFile(), urlSigner)
 	loggerHandler := logger.NewHTTPHandler(logger.Default())
+	loggerHandler.SetDecryptAccess(func(r *http.Request) bool {
+		claims, err := authChain.Authenticate(r)
+		return err == nil && claims.HasRole(auth.RoleAdmin)
+	})
+
+	// Refuse all but priority requests in maintenance mode, then shed
+	// low-priority requests under overload before they are counted
+	s.use("maintenance", s.inMaintenance)
+	if s.config.ShedMaxInFlight > 0 || s.config.ShedMaxLatency > 0 {
+		s.use("shed-load", s.shedLoad)
+	}
+
+	// Record per-route request outcomes, including panics recovered as 500s,
+	// give handlers a logger tagged with the request, bound concurrent
+	// requests, copy requests to the mirror upstream and log a sample of
+	// bodies when body logging is on
+	s.use("track-requests", s.trackRequests)
+	s.use("track-key-usage", s.trackKeyUsage(apiAuth))
+	s.use("request-logger", s.logRequestContext)
+	if s.limiter != nil {
+		s.use("concurrency-limit", s.limiter.middleware)
+	}
+	if s.mirror != nil {
+		s.use("mirror", s.mirror.middleware)
+	}
+	s.use("body-logging", logger.Bodies().Middleware)
+	s.use("recover-panics", s.recoverPanics)
+
+	// Unmatched routes get problem responses too
+	s.router.NotFoundHandler = http.HandlerFunc(httperr.NotFound)
+	s.router.MethodNotAllowedHandler = http.HandlerFunc(httperr.MethodNotAllowed)
 
 	// Static file server for public directory
 	fs := http.FileServer(http.Dir("public"))
 	s.router.PathPrefix("/public/").Handler(http.StripPrefix("/public/", fs))
 
-	// API routes
-	s.router.HandleFunc("/api/login", authHandler.Login).Methods("POST")
-	s.router.Handle("/api/customers", authMiddleware.RequireAuth(http.HandlerFunc(customersHandler.List))).Methods("GET")
-	s.router.HandleFunc("/api/loggersettings/debug", loggerHandler.SetDebug).Methods("POST")
-	s.router.HandleFunc("/api/logging/log", loggerHandler.GetLogs).Methods("GET", "POST")
-	s.router.HandleFunc("/api/logs", loggerHandler.PutWebook)
+	// Server-rendered pages show more to signed in visitors but don't
+	// require signing in; the policy decides for signed in visitors. On top
+	// of the API's credentials they accept the session cookie the login page
+	// sets, which the API doesn't, as browsers send it cross-site.
+	sessionAuth := auth.Validated(auth.NewJWTAuthenticator(s.config.JWTSecret, "").WithEncryption(s.tokens).FromCookie(auth.SessionCookie), s.validateSession)
+	pagesMiddleware := auth.NewMiddleware(auth.NewChain(authChain, sessionAuth), s.logger)
+	pagesHandler := handlers.NewPages(s.pages, s.features(), authHandler)
+	page := func(handler http.HandlerFunc) http.Handler {
+		return pagesMiddleware.OptionalAuth(auth.AuthorizeSignedIn(s.authorizer)(handler))
+	}
+	s.router.Handle("/", page(pagesHandler.Home)).Methods("GET", "HEAD")
+	s.router.Handle("/account", page(pagesHandler.Account)).Methods("GET", "HEAD")
+	s.router.Handle("/login", page(pagesHandler.Login)).Methods("GET", "HEAD")
+	s.router.HandleFunc("/login", pagesHandler.SignIn).Methods("POST")
+	s.router.HandleFunc("/logout", pagesHandler.SignOut).Methods("POST")
+	// Password reset links need no other credentials
+	s.router.HandleFunc("/reset-password", auth.RequireSignedURL(urlSigner, handlers.PasswordResetScope, pagesHandler.PasswordReset)).Methods("GET", "HEAD")
+	s.router.HandleFunc("/reset-password", auth.RequireSignedURL(urlSigner, handlers.PasswordResetScope, pagesHandler.SetPassword)).Methods("POST")
+
+	// API routes are registered with the OpenAPI registry, which applies
+	// authentication and the authorization policy to everything not marked
+	// public and documents each operation
+	api := openapi.NewRegistry(s.router, protect, func(role string, next http.Handler) http.Handler {
+		return auth.RequireRole(role, next.ServeHTTP)
+	})
+	api.Use(s.routeOverrides(s.overrides))
+	ifNoneMatch := openapi.Param{Name: "If-None-Match", In: "header", Description: "ETag of a cached copy; 304 if unchanged"}
+	idempotencyKey := openapi.Param{Name: "Idempotency-Key", In: "header", Description: "Retries with the same key replay the original response"}
+	ifMatch := openapi.Param{Name: "If-Match", In: "header", Description: "ETag the change is based on; 412 if the customer has changed"}
+
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/login", Summary: "Login to get JWT token", Tags: []string{"Authentication"},
+		Params:    []openapi.Param{idempotencyKey},
+		Request:   handlers.LoginRequest{},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.LoginResponse{}}, http.StatusBadRequest: {}},
+		Public:    true,
+	}, s.idempotency.idempotent(authHandler.Login))
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/password", Summary: "Change a password, given the current one", Tags: []string{"Authentication"},
+		Request: handlers.PasswordChangeRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusNoContent: {Description: "Password changed; existing sessions are revoked"}, http.StatusBadRequest: {},
+			http.StatusUnauthorized: {}, http.StatusForbidden: {Description: "Account is disabled"},
+		},
+		Public: true,
+	}, authHandler.ChangePassword)
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/login/device", Summary: "Exchange a device token from a remembered login for a JWT token", Tags: []string{"Authentication"},
+		Request: handlers.DeviceLoginRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: handlers.LoginResponse{}}, http.StatusBadRequest: {},
+			http.StatusUnauthorized: {Description: "Unknown, expired or revoked device token"},
+		},
+		Public: true,
+	}, devicesHandler.Login)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/me/devices", Summary: "List the devices remembered for the current user", Tags: []string{"Authentication"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: handlers.DevicesResponse{}, Negotiated: true}, http.StatusForbidden: {Description: "Not authenticated as a user"},
+		},
+	}, devicesHandler.List)
+	api.Handle(openapi.Operation{
+		Method: "DELETE", Path: "/api/me/devices/{id}", Summary: "Revoke a remembered device", Tags: []string{"Authentication"},
+		Responses: map[int]openapi.Response{
+			http.StatusNoContent: {Description: "Device revoked"}, http.StatusForbidden: {Description: "Not authenticated as a user"}, http.StatusNotFound: {},
+		},
+	}, devicesHandler.Delete)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/auth/{provider}/login", Summary: "Start a social login at a provider (github or google)", Tags: []string{"Authentication"},
+		Responses: map[int]openapi.Response{
+			http.StatusFound: {Description: "Redirect to the provider's login page"}, http.StatusNotFound: {Description: "Provider not configured"},
+		},
+		Public: true,
+	}, oauthHandler.Login)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/auth/{provider}/callback", Summary: "Complete a social login and issue a JWT token", Tags: []string{"Authentication"},
+		Params: []openapi.Param{
+			{Name: "code", In: "query", Description: "Authorization code from the provider"},
+			{Name: "state", In: "query", Description: "State from the login redirect"},
+		},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: handlers.LoginResponse{}}, http.StatusFound: {Description: "Redirect to OAUTH_SUCCESS_URL with the token in the fragment"},
+			http.StatusBadRequest: {Description: "Missing or mismatched state"}, http.StatusUnauthorized: {Description: "Login cancelled or denied"},
+			http.StatusForbidden: {Description: "No verified email, or account is disabled"}, http.StatusNotFound: {Description: "Provider not configured"},
+			http.StatusConflict: {Description: "A user with the account's email exists and must be linked by an admin"}, http.StatusBadGateway: {Description: "Provider error"},
+		},
+		Public: true,
+	}, oauthHandler.Callback)
+
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/customers", Summary: "List customers", Tags: []string{"Customers"},
+		Params: []openapi.Param{
+			{Name: "limit", In: "query", Description: "Customers per page, up to 100; every customer when omitted"},
+			{Name: "offset", In: "query", Description: "Customers to skip"},
+			ifNoneMatch,
+		},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.CustomersResponse{}, Negotiated: true}, http.StatusNotModified: {}},
+	}, s.cached("customers", s.config.CacheTTL, customersHandler.List))
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/customers", Summary: "Create a customer", Tags: []string{"Customers"},
+		Params:            []openapi.Param{idempotencyKey},
+		Request:           handlers.CustomerRequest{},
+		NegotiatedRequest: true,
+		Responses: map[int]openapi.Response{
+			http.StatusCreated: {Body: store.Customer{}, Negotiated: true}, http.StatusBadRequest: {}, http.StatusConflict: {Description: "Email already in use"},
+			http.StatusUnsupportedMediaType: {},
+		},
+	}, s.invalidates("customers", s.idempotency.idempotent(customersHandler.Create)))
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/customers/import", Summary: "Create customers in bulk as a background task", Tags: []string{"Customers"},
+		Request:           handlers.CustomerImportRequest{},
+		NegotiatedRequest: true,
+		Responses: map[int]openapi.Response{
+			http.StatusAccepted: {Body: tasks.Task{}, Description: "Import queued; poll the task for a CustomerImportResult"}, http.StatusBadRequest: {},
+			http.StatusUnsupportedMediaType: {}, http.StatusServiceUnavailable: {Description: "Worker queue full"},
+		},
+	}, customersHandler.Import)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/customers/search", Summary: "Full-text search of customers", Tags: []string{"Customers"},
+		Params: []openapi.Param{
+			{Name: "q", In: "query", Required: true, Description: "Words to match against the start of words in name and email"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of results, 1 to 100 (default 20)"},
+		},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.SearchResponse{}, Negotiated: true}, http.StatusBadRequest: {}},
+	}, s.cached("customers", s.config.CacheTTL, customersHandler.Search))
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/customers/{id}", Summary: "Get a customer", Tags: []string{"Customers"},
+		Params:    []openapi.Param{ifNoneMatch},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: store.Customer{}, Negotiated: true}, http.StatusNotModified: {}, http.StatusNotFound: {}},
+	}, s.cached("customers", s.config.CacheTTL, customersHandler.Get))
+	api.Handle(openapi.Operation{
+		Method: "PUT", Path: "/api/customers/{id}", Summary: "Replace a customer", Tags: []string{"Customers"},
+		Params:  []openapi.Param{ifMatch},
+		Request: handlers.CustomerRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: store.Customer{}, Negotiated: true}, http.StatusBadRequest: {}, http.StatusNotFound: {}, http.StatusConflict: {Description: "Email already in use"},
+			http.StatusPreconditionFailed: {},
+		},
+	}, s.invalidates("customers", customersHandler.Update))
+	api.Handle(openapi.Operation{
+		Method: "PATCH", Path: "/api/customers/{id}", Summary: "Update fields of a customer", Tags: []string{"Customers"},
+		Params:  []openapi.Param{ifMatch},
+		Request: handlers.CustomerPatch{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: store.Customer{}, Negotiated: true}, http.StatusBadRequest: {}, http.StatusNotFound: {}, http.StatusConflict: {Description: "Email already in use"},
+			http.StatusPreconditionFailed: {},
+		},
+	}, s.invalidates("customers", customersHandler.Patch))
+	api.Handle(openapi.Operation{
+		Method: "DELETE", Path: "/api/customers/{id}", Summary: "Delete a customer", Tags: []string{"Customers"},
+		Params:    []openapi.Param{ifMatch},
+		Responses: map[int]openapi.Response{http.StatusNoContent: {Description: "Customer deleted"}, http.StatusNotFound: {}, http.StatusPreconditionFailed: {}},
+	}, s.invalidates("customers", customersHandler.Delete))
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/customers/{id}/restore", Summary: "Restore a deleted customer", Tags: []string{"Customers"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: store.Customer{}, Negotiated: true}, http.StatusNotFound: {Description: "No deleted customer with this ID"}, http.StatusConflict: {Description: "Email now in use by another customer"},
+		},
+	}, s.invalidates("customers", customersHandler.Restore))
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/customers/{id}/history", Summary: "Changes made to a customer", Tags: []string{"Customers"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.HistoryResponse{}, Negotiated: true}, http.StatusNotFound: {}},
+	}, s.cached("customers", s.config.CacheTTL, customersHandler.History))
+
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/tasks", Summary: "Background tasks started by the caller", Tags: []string{"Tasks"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.TasksResponse{}}},
+	}, tasksHandler.List)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/tasks/{id}", Summary: "Progress, result or error of a background task", Tags: []string{"Tasks"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: tasks.Task{}}, http.StatusNotFound: {}},
+	}, tasksHandler.Get)
+
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/stats", Summary: "Latest stats sample with per-route latency", Tags: []string{"Stats"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.StatsResponse{}}, http.StatusServiceUnavailable: {Description: "No stats collected yet"}},
+	}, statsHandler.Get)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/stats/errors", Summary: "Routes with the most error responses", Tags: []string{"Stats"},
+		Params: []openapi.Param{
+			{Name: "window", In: "query", Description: "Duration to look back over, such as 5m or 1h"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of routes"},
+		},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.ErrorsResponse{}}, http.StatusBadRequest: {}},
+	}, statsHandler.Errors)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/stats/diff", Summary: "Change in runtime stats since an earlier sample", Tags: []string{"Stats"},
+		Params: []openapi.Param{
+			{Name: "against", In: "query", Description: "How long ago the sample compared against was taken, such as 15m or 1h"},
+		},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: stats.StatsDiff{}}, http.StatusBadRequest: {},
+			http.StatusNotFound: {Description: "No sample is that old yet"},
+		},
+	}, statsHandler.Diff)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/stats/slo", Summary: "Error budgets and burn rates of the routes' SLOs", Tags: []string{"Stats"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.SLOResponse{}}},
+	}, statsHandler.SLO)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/stats/settings", Summary: "Stats interval and collector states", Tags: []string{"Stats"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.StatsSettings{}}},
+	}, statsHandler.GetSettings)
+	api.Handle(openapi.Operation{
+		Method: "PUT", Path: "/api/stats/settings", Summary: "Change the stats interval or enabled collectors", Tags: []string{"Stats"},
+		Request:   handlers.StatsSettings{},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.StatsSettings{}}, http.StatusBadRequest: {}},
+	}, statsHandler.UpdateSettings)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/stats/stream", Summary: "Live stats samples as server-sent events, or a MessagePack or protobuf stream", Tags: []string{"Stats"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.StatsSample{}, ContentType: "text/event-stream"}},
+	}, statsHandler.Stream)
+
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/services", Summary: "Background service states", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.ServicesResponse{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, servicesHandler.List)
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/admin/services/{name}/{action}", Summary: "Start, stop or restart a service", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: services.Status{}}, http.StatusBadRequest: {}, http.StatusForbidden: {}, http.StatusNotFound: {}, http.StatusConflict: {Description: "Service already in the requested state"},
+		},
+		Role: auth.RoleAdmin,
+	}, servicesHandler.Control)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/jobs", Summary: "Scheduled jobs and recent results", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.JobsResponse{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, jobsHandler.List)
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/admin/drain", Summary: "Fail readiness and close keep-alive connections ahead of a shutdown", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.DrainStatus{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, drainHandler.Start)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/drain", Summary: "Requests and connections remaining while draining", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.DrainStatus{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, drainHandler.Status)
+	api.Handle(openapi.Operation{
+		Method: "DELETE", Path: "/api/admin/drain", Summary: "Cancel draining and accept traffic again", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.DrainStatus{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, drainHandler.Stop)
+
+	// User management and log exports need the admin role on top of
+	// authentication
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/users", Summary: "List users", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.UsersResponse{}, Negotiated: true}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, usersHandler.List)
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/admin/users", Summary: "Create a user", Tags: []string{"Admin"},
+		Request: handlers.UserRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusCreated: {Body: store.User{}, Negotiated: true}, http.StatusBadRequest: {}, http.StatusForbidden: {}, http.StatusConflict: {Description: "Username already taken"},
+		},
+		Role: auth.RoleAdmin,
+	}, usersHandler.Create)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/users/{id}", Summary: "Get a user", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: store.User{}, Negotiated: true}, http.StatusForbidden: {}, http.StatusNotFound: {}},
+		Role:      auth.RoleAdmin,
+	}, usersHandler.Get)
+	api.Handle(openapi.Operation{
+		Method: "PATCH", Path: "/api/admin/users/{id}", Summary: "Disable a user or assign its roles and tenants", Tags: []string{"Admin"},
+		Request:   handlers.UserPatch{},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: store.User{}, Negotiated: true}, http.StatusBadRequest: {}, http.StatusForbidden: {}, http.StatusNotFound: {}},
+		Role:      auth.RoleAdmin,
+	}, usersHandler.Update)
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/admin/users/{id}/reset-password", Summary: "Force a password reset, returning a link to choose a new password", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.PasswordResetResponse{}}, http.StatusForbidden: {}, http.StatusNotFound: {}},
+		Role:      auth.RoleAdmin,
+	}, usersHandler.ResetPassword)
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/admin/users/{id}/revoke-sessions", Summary: "Revoke every session of a user", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusNoContent: {Description: "Sessions revoked"}, http.StatusForbidden: {}, http.StatusNotFound: {}},
+		Role:      auth.RoleAdmin,
+	}, usersHandler.RevokeSessions)
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/admin/users/{id}/identities", Summary: "Link a social login account to a user", Tags: []string{"Admin"},
+		Request: handlers.IdentityLinkRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusCreated: {Body: store.Identity{}}, http.StatusBadRequest: {}, http.StatusForbidden: {}, http.StatusNotFound: {},
+			http.StatusConflict: {Description: "Provider account already linked"},
+		},
+		Role: auth.RoleAdmin,
+	}, oauthHandler.Link)
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/admin/trace", Summary: "Start a runtime execution trace", Tags: []string{"Admin"},
+		Request: handlers.TraceRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusAccepted: {Body: handlers.TraceStatus{}}, http.StatusBadRequest: {}, http.StatusForbidden: {},
+			http.StatusConflict: {Description: "A trace is already running"},
+		},
+		Role: auth.RoleAdmin,
+	}, traceHandler.Start)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/trace", Summary: "State of the running or last execution trace", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.TraceStatus{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, traceHandler.Status)
+	api.Handle(openapi.Operation{
+		Method: "DELETE", Path: "/api/admin/trace", Summary: "Stop the running execution trace", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: handlers.TraceStatus{}}, http.StatusForbidden: {}, http.StatusConflict: {Description: "No trace is running"},
+		},
+		Role: auth.RoleAdmin,
+	}, traceHandler.Stop)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/trace/download", Summary: "Download the last execution trace for go tool trace", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Description: "Execution trace", ContentType: "application/octet-stream"}, http.StatusForbidden: {},
+			http.StatusNotFound: {Description: "No trace has been captured"}, http.StatusConflict: {Description: "The trace is still running"},
+		},
+		Role: auth.RoleAdmin,
+	}, traceHandler.Download)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/runtime", Summary: "Current GOMAXPROCS, GOGC and memory limit", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.RuntimeSettings{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, runtimeHandler.Get)
+	api.Handle(openapi.Operation{
+		Method: "PATCH", Path: "/api/admin/runtime", Summary: "Change GOMAXPROCS, GOGC or the memory limit until restart", Tags: []string{"Admin"},
+		Request:   handlers.RuntimeSettingsUpdate{},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.RuntimeSettings{}}, http.StatusBadRequest: {}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, runtimeHandler.Update)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/toggles", Summary: "Current maintenance mode, debug logging, rate-limit multiplier and mirror percentage", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.ToggleSettings{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, togglesHandler.Get)
+	api.Handle(openapi.Operation{
+		Method: "PATCH", Path: "/api/admin/toggles", Summary: "Change runtime toggles, kept across restarts", Tags: []string{"Admin"},
+		Request: handlers.ToggleSettingsUpdate{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Body: handlers.ToggleSettings{}}, http.StatusBadRequest: {}, http.StatusForbidden: {},
+			http.StatusConflict: {Description: "mirror_percent was given without a mirror upstream"},
+		},
+		Role: auth.RoleAdmin,
+	}, togglesHandler.Update)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/audit", Summary: "Latest audit log entries, newest first", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.AuditLogResponse{}}, http.StatusBadRequest: {}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, auditHandler.List)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/apikeys", Summary: "List the API keys with their usage over the last 30 days", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.APIKeysResponse{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, apiKeysHandler.List)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/apikeys/{id}/usage", Summary: "Daily request counts, endpoints and error rates of an API key", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.APIKeyUsage{}}, http.StatusForbidden: {}, http.StatusNotFound: {}},
+		Role:      auth.RoleAdmin,
+	}, apiKeysHandler.Usage)
+	if s.logExporter != nil {
+		api.Handle(openapi.Operation{
+			Method: "POST", Path: "/api/admin/logs/export", Summary: "Export a time range of the log to the archive bucket as a background task", Tags: []string{"Admin"},
+			Request: handlers.LogExportRequest{},
+			Responses: map[int]openapi.Response{
+				http.StatusAccepted: {Body: tasks.Task{}, Description: "Export queued; poll the task for a logarchive.ExportResult"}, http.StatusBadRequest: {},
+				http.StatusForbidden: {}, http.StatusServiceUnavailable: {Description: "Worker queue full"},
+			},
+			Role: auth.RoleAdmin,
+		}, logExportsHandler.Start)
+	}
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/admin/logs/erase", Summary: "Redact identifiers such as email addresses from the log files as a background task", Tags: []string{"Admin"},
+		Request: handlers.LogErasureRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusAccepted: {Body: tasks.Task{}, Description: "Erasure queued; poll the task for a handlers.LogErasureResult"}, http.StatusBadRequest: {},
+			http.StatusForbidden: {}, http.StatusServiceUnavailable: {Description: "Worker queue full"},
+		},
+		Role: auth.RoleAdmin,
+	}, logErasuresHandler.Start)
+	if s.config.SeedAPI {
+		api.Handle(openapi.Operation{
+			Method: "POST", Path: "/api/admin/seed", Summary: "Fill the user and customer stores with fake data as a background task", Tags: []string{"Admin"},
+			Request: handlers.SeedRequest{},
+			Responses: map[int]openapi.Response{
+				http.StatusAccepted: {Body: tasks.Task{}, Description: "Seeding queued; poll the task for a seed.Result"}, http.StatusBadRequest: {},
+				http.StatusForbidden: {}, http.StatusServiceUnavailable: {Description: "Worker queue full"},
+			},
+			Role: auth.RoleAdmin,
+		}, seedHandler.Start)
+	}
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/admin/logs/download-link", Summary: "Create a signed, expiring link to download a time range of the log", Tags: []string{"Admin"},
+		Request: handlers.LogDownloadRequest{},
+		Responses: map[int]openapi.Response{
+			http.StatusCreated: {Body: handlers.SignedLink{}}, http.StatusBadRequest: {}, http.StatusForbidden: {},
+		},
+		Role: auth.RoleAdmin,
+	}, logDownloadsHandler.Link)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/loggersettings/bodies", Summary: "Get the sampled request and response body logging settings", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: logger.BodyLoggingSettings{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, loggerHandler.GetBodyLogging)
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/loggersettings/bodies", Summary: "Turn body logging on or off or change its sample rate, size cap or routes", Tags: []string{"Admin"},
+		Request:   logger.BodyLoggingUpdate{},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: logger.BodyLoggingSettings{}}, http.StatusBadRequest: {}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, loggerHandler.SetBodyLogging)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: handlers.LogDownloadPath, Summary: "Download a time range of the log as gzipped NDJSON through a signed link", Tags: []string{"Admin"},
+		Params: []openapi.Param{
+			{Name: "from", In: "query", Required: true}, {Name: "to", In: "query", Required: true},
+			{Name: "scope", In: "query", Required: true}, {Name: "expires", In: "query", Type: "integer", Required: true},
+			{Name: "signature", In: "query", Required: true, Description: "Signature of the link; the other parameters can't be changed"},
+		},
+		Responses: map[int]openapi.Response{
+			http.StatusOK: {Description: "Gzipped NDJSON log entries"}, http.StatusBadRequest: {},
+			http.StatusForbidden: {Description: "Invalid, tampered or expired link"},
+		},
+		Public: true,
+	}, auth.RequireSignedURL(urlSigner, handlers.LogDownloadScope, logDownloadsHandler.Download))
+
+	// SCIM provisioning is enabled by SCIM_TOKEN, the bearer token the
+	// identity provider authenticates with
+	if s.config.SCIMToken != "" {
+		scimUser := openapi.Response{Body: handlers.SCIMUser{}, ContentType: "application/scim+json"}
+		scimGroup := openapi.Response{Body: handlers.SCIMGroup{}, ContentType: "application/scim+json"}
+		scimList := openapi.Response{Body: handlers.SCIMListResponse{}, ContentType: "application/scim+json"}
+		scimError := openapi.Response{Body: handlers.SCIMError{}, ContentType: "application/scim+json"}
+		filter := openapi.Param{Name: "filter", In: "query", Description: `An eq filter such as userName eq "jane@example.com"`}
+		page := []openapi.Param{
+			filter,
+			{Name: "startIndex", In: "query", Type: "integer", Description: "1-based index of the first result"},
+			{Name: "count", In: "query", Type: "integer", Description: "Results per page (default 100, at most 1000)"},
+		}
+		api.Handle(openapi.Operation{
+			Method: "GET", Path: "/scim/v2/ServiceProviderConfig", Summary: "Supported SCIM features", Tags: []string{"SCIM"},
+			Responses: map[int]openapi.Response{http.StatusOK: {Description: "Service provider configuration"}, http.StatusForbidden: {}},
+			Role:      auth.RoleSCIM,
+		}, scimHandler.ServiceProviderConfig)
+		api.Handle(openapi.Operation{
+			Method: "GET", Path: "/scim/v2/Users", Summary: "List or find users", Tags: []string{"SCIM"}, Params: page,
+			Responses: map[int]openapi.Response{http.StatusOK: scimList, http.StatusBadRequest: scimError, http.StatusForbidden: {}},
+			Role:      auth.RoleSCIM,
+		}, scimHandler.ListUsers)
+		api.Handle(openapi.Operation{
+			Method: "POST", Path: "/scim/v2/Users", Summary: "Provision a user", Tags: []string{"SCIM"},
+			Request: handlers.SCIMUser{},
+			Responses: map[int]openapi.Response{
+				http.StatusCreated: scimUser, http.StatusBadRequest: scimError, http.StatusForbidden: {}, http.StatusConflict: scimError,
+			},
+			Role: auth.RoleSCIM,
+		}, scimHandler.CreateUser)
+		api.Handle(openapi.Operation{
+			Method: "GET", Path: "/scim/v2/Users/{id}", Summary: "Get a user", Tags: []string{"SCIM"},
+			Responses: map[int]openapi.Response{http.StatusOK: scimUser, http.StatusForbidden: {}, http.StatusNotFound: scimError},
+			Role:      auth.RoleSCIM,
+		}, scimHandler.GetUser)
+		api.Handle(openapi.Operation{
+			Method: "PUT", Path: "/scim/v2/Users/{id}", Summary: "Replace a user's username, active state or password", Tags: []string{"SCIM"},
+			Request: handlers.SCIMUser{},
+			Responses: map[int]openapi.Response{
+				http.StatusOK: scimUser, http.StatusBadRequest: scimError, http.StatusForbidden: {}, http.StatusNotFound: scimError, http.StatusConflict: scimError,
+			},
+			Role: auth.RoleSCIM,
+		}, scimHandler.ReplaceUser)
+		api.Handle(openapi.Operation{
+			Method: "PATCH", Path: "/scim/v2/Users/{id}", Summary: "Activate or deactivate a user, or change its username or password", Tags: []string{"SCIM"},
+			Request: handlers.SCIMPatch{},
+			Responses: map[int]openapi.Response{
+				http.StatusOK: scimUser, http.StatusBadRequest: scimError, http.StatusForbidden: {}, http.StatusNotFound: scimError, http.StatusConflict: scimError,
+			},
+			Role: auth.RoleSCIM,
+		}, scimHandler.PatchUser)
+		api.Handle(openapi.Operation{
+			Method: "DELETE", Path: "/scim/v2/Users/{id}", Summary: "Deprovision a user", Tags: []string{"SCIM"},
+			Responses: map[int]openapi.Response{
+				http.StatusNoContent: {Description: "User deleted with its devices and linked identities"}, http.StatusForbidden: {}, http.StatusNotFound: scimError,
+			},
+			Role: auth.RoleSCIM,
+		}, scimHandler.DeleteUser)
+		api.Handle(openapi.Operation{
+			Method: "GET", Path: "/scim/v2/Groups", Summary: "List or find groups, the roles assigned to users", Tags: []string{"SCIM"}, Params: page,
+			Responses: map[int]openapi.Response{http.StatusOK: scimList, http.StatusBadRequest: scimError, http.StatusForbidden: {}},
+			Role:      auth.RoleSCIM,
+		}, scimHandler.ListGroups)
+		api.Handle(openapi.Operation{
+			Method: "POST", Path: "/scim/v2/Groups", Summary: "Assign a role to its members", Tags: []string{"SCIM"},
+			Request: handlers.SCIMGroup{},
+			Responses: map[int]openapi.Response{
+				http.StatusCreated: scimGroup, http.StatusBadRequest: scimError, http.StatusForbidden: {}, http.StatusConflict: scimError,
+			},
+			Role: auth.RoleSCIM,
+		}, scimHandler.CreateGroup)
+		api.Handle(openapi.Operation{
+			Method: "GET", Path: "/scim/v2/Groups/{id}", Summary: "Get a group and its members", Tags: []string{"SCIM"},
+			Responses: map[int]openapi.Response{http.StatusOK: scimGroup, http.StatusForbidden: {}, http.StatusNotFound: scimError},
+			Role:      auth.RoleSCIM,
+		}, scimHandler.GetGroup)
+		api.Handle(openapi.Operation{
+			Method: "PUT", Path: "/scim/v2/Groups/{id}", Summary: "Replace the members of a group", Tags: []string{"SCIM"},
+			Request:   handlers.SCIMGroup{},
+			Responses: map[int]openapi.Response{http.StatusOK: scimGroup, http.StatusBadRequest: scimError, http.StatusForbidden: {}, http.StatusNotFound: scimError},
+			Role:      auth.RoleSCIM,
+		}, scimHandler.ReplaceGroup)
+		api.Handle(openapi.Operation{
+			Method: "PATCH", Path: "/scim/v2/Groups/{id}", Summary: "Add, remove or replace members of a group", Tags: []string{"SCIM"},
+			Request:   handlers.SCIMPatch{},
+			Responses: map[int]openapi.Response{http.StatusOK: scimGroup, http.StatusBadRequest: scimError, http.StatusForbidden: {}, http.StatusNotFound: scimError},
+			Role:      auth.RoleSCIM,
+		}, scimHandler.PatchGroup)
+		api.Handle(openapi.Operation{
+			Method: "DELETE", Path: "/scim/v2/Groups/{id}", Summary: "Remove a role from all its members", Tags: []string{"SCIM"},
+			Responses: map[int]openapi.Response{http.StatusNoContent: {Description: "Role removed"}, http.StatusForbidden: {}, http.StatusNotFound: scimError},
+			Role:      auth.RoleSCIM,
+		}, scimHandler.DeleteGroup)
+	}
+
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/graphql", Summary: "Query and modify customers, and query users, with GraphQL", Tags: []string{"GraphQL"},
+		Request:   handlers.GraphQLRequest{},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.GraphQLResponse{}}, http.StatusBadRequest: {}},
+	}, s.invalidates("customers", graphqlHandler.Query))
+
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: batchPath, Summary: "Run several requests in one round trip", Tags: []string{"Batch"},
+		Request:   BatchBody{},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: BatchResult{}}, http.StatusBadRequest: {}},
+	}, s.batch)
+
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/webhooks", Summary: "Register a webhook for domain events", Tags: []string{"Webhooks"},
+		Request:   handlers.WebhookRequest{},
+		Responses: map[int]openapi.Response{http.StatusCreated: {Body: webhooks.Subscription{}}, http.StatusBadRequest: {}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, webhooksHandler.Create)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/webhooks", Summary: "List webhooks", Tags: []string{"Webhooks"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.WebhooksResponse{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, webhooksHandler.List)
+	api.Handle(openapi.Operation{
+		Method: "DELETE", Path: "/api/webhooks/{id}", Summary: "Delete a webhook", Tags: []string{"Webhooks"},
+		Responses: map[int]openapi.Response{http.StatusNoContent: {Description: "Webhook deleted"}, http.StatusForbidden: {}, http.StatusNotFound: {}},
+		Role:      auth.RoleAdmin,
+	}, webhooksHandler.Delete)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/webhooks/{id}/deliveries", Summary: "Recent delivery attempts of a webhook", Tags: []string{"Webhooks"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.DeliveriesResponse{}}, http.StatusForbidden: {}, http.StatusNotFound: {}},
+		Role:      auth.RoleAdmin,
+	}, webhooksHandler.Deliveries)
+	api.Handle(openapi.Operation{
+		Method: "POST", Path: "/api/webhooks/inbound/{source}", Summary: "Receive a signed webhook from a registered source", Tags: []string{"Webhooks"},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                    {Body: handlers.InboundReceipt{}, Description: "Repeat of a received webhook"},
+			http.StatusAccepted:              {Body: handlers.InboundReceipt{}},
+			http.StatusUnauthorized:          {},
+			http.StatusNotFound:              {},
+			http.StatusRequestEntityTooLarge: {},
+			http.StatusServiceUnavailable:    {Description: "Recorded but not dispatched; send again"},
+		},
+		Public: true,
+	}, inboundHandler.Receive)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/webhooks/inbound", Summary: "Received webhook events, newest first", Tags: []string{"Webhooks"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.InboundEventsResponse{}}, http.StatusBadRequest: {}},
+		Role:      auth.RoleAdmin,
+	}, inboundHandler.List)
+
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/healthz", Summary: "Liveness probe", Tags: []string{"Health"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.HealthResponse{}}},
+		Public:    true,
+	}, healthHandler.Live)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/readyz", Summary: "Readiness probe; fails while draining or a critical service or dependency is down", Tags: []string{"Health"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.HealthResponse{}}, http.StatusServiceUnavailable: {Body: handlers.HealthResponse{}}},
+		Public:    true,
+	}, healthHandler.Ready)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/version", Summary: "Build info and enabled features", Tags: []string{"Stats"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.VersionResponse{}}},
+		Public:    true,
+	}, versionHandler.Get)
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/metrics", Summary: "Latest stats sample in Prometheus text format", Tags: []string{"Stats"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: "", ContentType: "text/plain"}, http.StatusServiceUnavailable: {Description: "No stats collected yet"}},
+		Public:    true,
+	}, statsHandler.Prometheus)
+
+	// The logger package documents its own endpoints
+	loggerSwagger := logger.GetSwagger()
+	loggerSchemas, _ := loggerSwagger.Components["schemas"].(map[string]interface{})
+	api.Merge(loggerSwagger.Paths, loggerSchemas)
+
+	info := openapi.Info{
+		Title:       "Example Server API",
+		Version:     version.Version,
+		Description: "API documentation for the Example Server",
+	}
+	if s.config.SwaggerHost != "" {
+		info.Server = "http://" + s.config.SwaggerHost
+	}
+	api.Handle(openapi.Operation{Method: "GET", Path: "/openapi.json", Public: true, Hidden: true}, s.cached("openapi", time.Hour, api.Handler(info)))
+
+	api.Handle(openapi.Operation{Method: "POST", Path: "/api/loggersettings/debug", Public: true, Hidden: true}, loggerHandler.SetDebug)
+	api.Handle(openapi.Operation{Method: "GET", Path: "/api/logging/log", Public: true, Hidden: true}, loggerHandler.GetLogs)
+	api.Handle(openapi.Operation{Method: "POST", Path: "/api/logging/log", Public: true, Hidden: true}, loggerHandler.GetLogs)
+	api.Handle(openapi.Operation{Method: "GET", Path: "/api/logging/summary", Hidden: true}, loggerHandler.GetSummary)
+	api.Handle(openapi.Operation{Method: "GET", Path: "/api/logging/plugins", Hidden: true}, loggerHandler.GetPlugins)
+
+	// The route listing walks the router when asked, so it covers every route
+	routesHandler := handlers.NewRoutes(s.router, api, s.requestMiddleware())
+	api.Handle(openapi.Operation{
+		Method: "GET", Path: "/api/admin/routes", Summary: "Registered routes with their methods, middleware and auth requirements", Tags: []string{"Admin"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Body: handlers.RoutesResponse{}}, http.StatusForbidden: {}},
+		Role:      auth.RoleAdmin,
+	}, routesHandler.List)
+}
+
+// use adds middleware to the router, recording its name for the route
+// listing
+func (s *Server) use(name string, middleware mux.MiddlewareFunc) {
+	s.middleware = append(s.middleware, name)
+	s.router.Use(middleware)
+}
 
+// requestMiddleware names the middleware every request passes through,
+// outermost first: the handler chain of the HTTP server, then the router's
+func (s *Server) requestMiddleware() []string {
+	middleware := []string{"request-id"}
+	if logger.Access().Enabled() {
+		middleware = append(middleware, "access-log")
+	}
+	return append(middleware, s.middleware...)
 }
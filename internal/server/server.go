@@ -2,18 +2,39 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"exampleserver/internal/auth"
+	"exampleserver/internal/cache"
+	"exampleserver/internal/events"
+	"exampleserver/internal/handlers"
+	"exampleserver/internal/health"
+	"exampleserver/internal/logarchive"
+	"exampleserver/internal/mqtt"
+	"exampleserver/internal/outbox"
+	"exampleserver/internal/pages"
+	"exampleserver/internal/queue"
+	"exampleserver/internal/services"
 	"exampleserver/internal/stats"
+	"exampleserver/internal/store"
+	"exampleserver/internal/tasks"
+	"exampleserver/internal/webhooks"
 	"exampleserver/pkg/config"
+	"exampleserver/pkg/i18n"
 	"exampleserver/pkg/logger"
+	"exampleserver/pkg/mail"
+	"exampleserver/pkg/render"
+	"exampleserver/pkg/requestid"
 
 	"github.com/gorilla/mux"
 )
@@ -22,93 +43,582 @@ type Server struct {
 	config       *config.Config
 	router       *mux.Router
 	server       *http.Server
+	services     *services.Manager
+	scheduler    *services.Scheduler
+	workers      *services.WorkerPool
 	statsService *stats.StatsService
+	store        *store.Store
+	webhooks     *webhooks.Dispatcher
+	events       *events.Bus
+	inbound      *webhooks.Receiver
+	outbox       *outbox.Relay
+	queue        *queue.Consumer // nil without a queue driver
+	mqtt         *mqtt.Bridge    // nil without an MQTT broker
+	mailer       *mail.Mailer    // nil when MAIL_DRIVER is none
+	pages        *pages.Renderer
+	tasks        *tasks.Tracker
+	logExporter  *logarchive.Exporter // nil without a log archive bucket
+	health       *health.Checker
+	depTimeouts  map[string]time.Duration // HEALTH_CHECK_TIMEOUTS, see AddHealthCheck
+	idempotency  *idempotencyCache
+	cache        *cache.Metered // nil when caching is disabled
+	conns        *stats.ConnTracker
+	passwords    *auth.PasswordHasher
+	tokens       *auth.TokenEncryption  // nil when tokens are signed only
+	authorizer   auth.Authorizer        // nil without an authorization policy
+	mirror       *mirror                // nil without a mirror upstream
+	limiter      *concurrencyLimiter    // nil without concurrency limits
+	overrides    []config.RouteOverride // from ROUTE_CONFIG
+	closeStreams []func()               // end long-lived streams at shutdown
+	middleware   []string               // names of the router's middleware, in order
+	draining     atomic.Bool
+	shedding     atomic.Bool
+	lowMemory    atomic.Bool   // readiness fails while set
+	maintenance  atomic.Bool   // see ToggleSettings
+	rateScale    atomic.Uint64 // bits of the rate limit multiplier
+	togglesMu    sync.Mutex    // serializes toggle changes
+	restart      chan struct{} // asks Start to shut down for a restart
+	inFlight     atomic.Int64
 	logger       logger.LoggerInterface
 }
 
-func New(cfg *config.Config, logger logger.LoggerInterface) *Server {
+// New sets up the server and registers its services with serviceManager.
+// A configuration it can't start with is returned as an *ExitError with
+// ExitConfig.
+func New(cfg *config.Config, logger logger.LoggerInterface, serviceManager *services.Manager, st *store.Store) (*Server, error) {
 	s := &Server{
 		config:       cfg,
 		router:       mux.NewRouter(),
+		services:     serviceManager,
+		scheduler:    services.NewScheduler(logger),
+		workers:      services.NewWorkerPool("workers", cfg.Workers, cfg.WorkerQueue, logger),
 		statsService: stats.NewStatsService(cfg.StatsInterval, logger),
+		store:        st,
+		restart:      make(chan struct{}, 1),
 		logger:       logger,
 	}
+	serviceManager.SetReadyTimeout(cfg.ServicesReadyTimeout)
+	s.webhooks = webhooks.NewDispatcher(st.Webhooks, cfg.WebhookAllowPrivate, logger)
+	serviceManager.AddService(s.statsService)
+	serviceManager.AddService(s.scheduler)
+	serviceManager.AddService(s.workers)
+	serviceManager.AddService(newKeyUsageSaver(s.statsService.KeyUsage(), st.KeyUsage, logger))
+	s.statsService.RegisterCollector("workers", s.workers)
+	s.events = events.NewBus(s.workers, logger)
+	s.statsService.RegisterCollector("events", s.events)
 
+	// Bridge to the MQTT broker devices report to, logging the messages of
+	// the configured topics until applications handle them
+	if cfg.MQTTBroker != "" {
+		bridge, err := mqtt.NewBridge(mqtt.Config{
+			Broker:   cfg.MQTTBroker,
+			ClientID: cfg.MQTTClientID,
+			Username: cfg.MQTTUsername,
+			Password: cfg.MQTTPassword,
+			CAFile:   cfg.MQTTTLSCA,
+			CertFile: cfg.MQTTTLSCert,
+			KeyFile:  cfg.MQTTTLSKey,
+			QoS:      byte(cfg.MQTTQoS),
+		}, logger)
+		if err != nil {
+			return nil, configError("MQTT: %v", err)
+		}
+		s.mqtt = bridge
+		for _, topic := range cfg.MQTTSubscribe {
+			bridge.Handle(topic, mqtt.LogMessages(logger))
+		}
+		serviceManager.AddService(bridge)
+		s.statsService.RegisterCollector("mqtt", bridge)
+		if len(cfg.MQTTLogLevels) > 0 {
+			if err := logger.AddPlugin(mqtt.NewLogPlugin(bridge, cfg.MQTTTopicPrefix, cfg.MQTTLogLevels)); err != nil {
+				logger.Error("Log entries are not published to MQTT: %v", err)
+			}
+		}
+	}
+
+	// Deliver the events recorded with customer writes, dropping them once
+	// they have been delivered for the retention period
+	sinks := []outbox.Sink{outbox.NewWebhookSink(s.webhooks)}
+	if len(cfg.OutboxKafkaBrokers) > 0 {
+		sinks = append(sinks, outbox.NewKafkaSink(cfg.OutboxKafkaBrokers, cfg.OutboxKafkaTopic))
+	}
+	if s.mqtt != nil && cfg.MQTTPublishEvents {
+		sinks = append(sinks, outbox.NewMQTTSink(s.mqtt, cfg.MQTTTopicPrefix))
+	}
+	s.outbox = outbox.NewRelay(st.Outbox, cfg.OutboxInterval, cfg.OutboxMaxAttempts, logger, sinks...)
+	serviceManager.AddService(s.outbox)
+	s.statsService.RegisterCollector("outbox", s.outbox)
+	s.scheduler.AddJob(services.Job{
+		Name:     "outbox-purge",
+		Schedule: "@hourly",
+		Run: func(ctx context.Context) error {
+			return s.outbox.Purge(ctx, cfg.OutboxRetention)
+		},
+	})
+
+	// Verify and record the webhooks of the configured sources, publishing
+	// them on the event bus
+	inboundSources, err := cfg.InboundWebhookSources()
+	if err != nil {
+		return nil, configError("Inbound webhooks: %v", err)
+	}
+	sources := make([]webhooks.Source, len(inboundSources))
+	for i, source := range inboundSources {
+		sources[i] = webhooks.Source{Name: source.Name, Scheme: source.Scheme, Secret: source.Secret}
+	}
+	s.inbound = webhooks.NewReceiver(sources, cfg.InboundWebhookTolerance, st.Inbound, s.events, logger)
+	s.statsService.RegisterCollector("inbound_webhooks", s.inbound)
+	s.scheduler.AddJob(services.Job{
+		Name:     "inbound-webhooks-purge",
+		Schedule: "@hourly",
+		Run: func(ctx context.Context) error {
+			return s.inbound.Purge(ctx, cfg.InboundWebhookRetention)
+		},
+	})
+
+	// Consume messages from the queue broker, dead-lettering those that
+	// fail every attempt
+	if broker := newQueueBroker(cfg); broker != nil {
+		s.queue = queue.NewConsumer(broker, queue.Config{
+			Group:       cfg.QueueGroup,
+			Concurrency: cfg.QueueConcurrency,
+			MaxAttempts: cfg.QueueMaxAttempts,
+			RetryDelay:  cfg.QueueRetryDelay,
+		}, logger)
+		serviceManager.AddService(s.queue)
+		s.statsService.RegisterCollector("queue", s.queue)
+	}
+
+	// Send email on the worker pool, retrying deliveries that fail
+	if sender := newMailSender(cfg); sender != nil {
+		templates, err := mail.LoadTemplates(cfg.MailTemplateDir)
+		if err != nil {
+			return nil, configError("Mail templates: %v", err)
+		}
+		s.mailer = mail.NewMailer(sender, cfg.MailFrom, templates, func(name string, run func(ctx context.Context) error) error {
+			return s.workers.Enqueue(services.Task{Name: name, Run: run, Retries: 2, Timeout: 30 * time.Second})
+		}, logger)
+		s.statsService.RegisterCollector("mail", s.mailer)
+	}
+
+	// Render HTML pages from the embedded templates, or those replacing
+	// them
+	renderer, err := pages.NewRenderer(cfg.PagesTemplateDir)
+	if err != nil {
+		return nil, configError("Page templates: %v", err)
+	}
+	s.pages = renderer
+
+	// Check the dependencies for readiness and the admin services endpoint
+	timeouts, err := cfg.DependencyTimeouts()
+	if err != nil {
+		return nil, configError("Health checks: %v", err)
+	}
+	s.depTimeouts = timeouts
+	s.health = health.NewChecker(cfg.HealthCheckInterval, cfg.HealthCheckTimeout, logger)
+	serviceManager.AddService(s.health)
+	if cfg.StoreDriver != "memory" {
+		s.AddHealthCheck("database", st.Ping)
+	}
+	s.AddHealthCheck("webhooks", s.webhooks.CheckReachable)
+	if s.mqtt != nil {
+		s.AddHealthCheck("mqtt", s.mqtt.Check)
+	}
+
+	// Count service failures in the application metrics
+	serviceErrors := stats.NewCounter("service_errors")
+	serviceManager.OnError(func(name string, err error) {
+		serviceErrors.Inc()
+	})
+
+	// Register stats alert rules
+	rules, err := stats.ParseAlertRules(cfg.StatsAlertRules)
+	if err != nil {
+		logger.Error("Invalid stats alert rules: %v", err)
+	}
+	for _, rule := range rules {
+		s.statsService.AddAlertRule(rule)
+	}
+	if s.mailer != nil && len(cfg.MailAlertTo) > 0 {
+		host, _ := os.Hostname()
+		s.statsService.OnAlert(func(alert stats.Alert) {
+			s.mailer.QueueTemplate(cfg.MailAlertTo, "alert", map[string]interface{}{
+				"Name":    alert.Name,
+				"Level":   alert.Level,
+				"Message": alert.Message,
+				"Firing":  alert.Firing,
+				"Time":    alert.Time,
+				"Host":    host,
+			})
+		})
+	}
+
+	s.statsService.WatchGoroutines(cfg.GoroutineGrowthIntervals, cfg.GoroutineDumpDir)
+	if cfg.StatsPushURL != "" {
+		serviceManager.AddService(stats.NewPusher(s.statsService, cfg.StatsPushURL, cfg.StatsPushJob, cfg.StatsPushInstance, logger), s.statsService.Name())
+	}
+
+	// Cache read responses, counting hits and misses in the stats
+	responseCache, err := cache.Open(cache.Config{
+		Driver:   cfg.CacheDriver,
+		Size:     cfg.CacheSize,
+		RedisURL: cfg.CacheRedisURL,
+	})
+	if err != nil {
+		logger.Error("Response cache disabled: %v", err)
+	}
+	if responseCache != nil {
+		s.cache = responseCache
+		s.statsService.RegisterCollector("cache", responseCache)
+	}
+
+	// Replay responses to retried writes, dropping them once they expire
+	s.idempotency = newIdempotencyCache(cfg.IdempotencyTTL)
+	s.scheduler.AddJob(services.Job{
+		Name:     "idempotency-sweep",
+		Schedule: "@every 1m",
+		Run:      s.idempotency.sweep,
+	})
+
+	// Track long requests running on the worker pool, forgetting them once
+	// clients have had time to collect the outcome
+	s.tasks = tasks.NewTracker(s.workers, cfg.TaskRetention)
+	s.tasks.OnFinish(func(task tasks.Task) {
+		if (task.Type == handlers.CustomerImportTask || task.Type == handlers.SeedTask) && s.cache != nil {
+			s.cache.Purge(context.Background(), "customers:")
+		}
+	})
+	s.scheduler.AddJob(services.Job{
+		Name:     "tasks-sweep",
+		Schedule: "@every 5m",
+		Run:      s.tasks.Sweep,
+	})
+
+	// Housekeeping beyond lumberjack's rotation: move old log backups to
+	// object storage and forget request stats of routes no longer served.
+	// The same bucket takes log exports.
+	if store, err := newBlobStore(cfg); err != nil {
+		logger.Error("Log archiving and export are disabled: %v", err)
+	} else if store != nil {
+		s.logExporter = logarchive.NewExporter(logger.GetLogFile(), cfg.LogArchivePrefix, store)
+		s.AddHealthCheck("object-storage", store.Check)
+		archiver := logarchive.NewArchiver(logger.GetLogFile(), cfg.LogArchivePrefix, cfg.LogArchiveAfter, store)
+		s.scheduler.AddJob(services.Job{
+			Name:     "log-archive",
+			Schedule: "@hourly",
+			Timeout:  30 * time.Minute,
+			Run:      archiver.Run,
+		})
+	}
+	s.scheduler.AddJob(services.Job{
+		Name:     "devices-sweep",
+		Schedule: "@hourly",
+		Run: func(ctx context.Context) error {
+			n, err := st.Devices.DeleteExpired(ctx, time.Now())
+			services.ReportJob(ctx, "removed %d expired devices", n)
+			return err
+		},
+	})
+	s.scheduler.AddJob(services.Job{
+		Name:     "stats-vacuum",
+		Schedule: "@hourly",
+		Run: func(ctx context.Context) error {
+			services.ReportJob(ctx, "removed %d idle routes", s.statsService.Requests().Vacuum())
+			return nil
+		},
+	})
+
+	if err := i18n.SetDefault(cfg.DefaultLanguage); err != nil {
+		logger.Error("Error messages default to English: %v", err)
+	}
+	if err := render.SetEnvelope(cfg.ResponseEnvelope); err != nil {
+		logger.Error("Resources are sent as plain JSON: %v", err)
+	}
+
+	s.passwords = auth.NewPasswordHasher(cfg.PasswordHash, auth.Argon2Params{
+		Memory:  uint32(cfg.Argon2Memory),
+		Time:    uint32(cfg.Argon2Time),
+		Threads: uint8(cfg.Argon2Parallelism),
+	})
+	if s.tokens, err = auth.NewTokenEncryption(cfg.JWTEncryptionAlg, cfg.JWTEncryptionKey); err != nil {
+		return nil, configError("JWT encryption: %v", err)
+	}
+	switch cfg.AuthzPolicy {
+	case "casbin":
+		authorizer, err := auth.NewCasbinAuthorizer(cfg.CasbinModel, cfg.CasbinPolicy)
+		if err != nil {
+			return nil, configError("Authorization policy: %v", err)
+		}
+		s.authorizer = authorizer
+	case "opa":
+		s.authorizer = auth.NewOPAAuthorizer(cfg.OPAURL)
+	}
+	if cfg.MirrorURL != "" {
+		target, err := url.Parse(cfg.MirrorURL)
+		if err != nil || target.Host == "" {
+			return nil, configError("MIRROR_URL %q is not a valid URL", cfg.MirrorURL)
+		}
+		s.mirror = newMirror(target, cfg.MirrorPercent, cfg.MirrorTimeout, cfg.MirrorWrites, logger)
+	}
+	routeLimits, err := cfg.RouteConcurrencyLimits()
+	if err != nil {
+		return nil, configError("Concurrency limits: %v", err)
+	}
+	if cfg.ConcurrencyLimit > 0 || len(routeLimits) > 0 {
+		s.limiter = newConcurrencyLimiter(cfg.ConcurrencyLimit, routeLimits, cfg.ConcurrencyQueueTimeout)
+	}
+	s.statsService.WatchMemory(uint64(cfg.MemoryRSSLimit)<<20, uint64(cfg.MemoryHeapLimit)<<20, s.memoryActions())
+	if s.overrides, err = cfg.RouteOverrides(); err != nil {
+		return nil, configError("Route config: %v", err)
+	}
+	if err := s.bootstrapAdmin(context.Background()); err != nil {
+		logger.Error("Failed to create admin user: %v", err)
+	}
+
+	s.loadToggles(context.Background())
+	if err := s.webhooks.Load(context.Background()); err != nil {
+		logger.Error("Failed to load webhook subscriptions: %v", err)
+	}
 	s.setupRoutes()
 
 	s.server = &http.Server{
 		Addr:         ":" + cfg.Port,
-		Handler:      s.router,
+		Handler:      requestid.Middleware(s.accessLog(s.router)),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
-	return s
+	// Track descriptors and connection states in the stats samples
+	s.conns = stats.NewConnTracker()
+	s.server.ConnState = s.conns.ConnState
+	s.statsService.RegisterCollector("http", s.conns)
+	s.statsService.RegisterCollector("process", stats.NewProcessCollector())
+	if plugins, ok := logger.(stats.Collector); ok {
+		s.statsService.RegisterCollector("log_plugins", plugins)
+	}
+
+	return s, nil
+}
+
+// Scheduler returns the job scheduler so applications can register their
+// own recurring jobs
+func (s *Server) Scheduler() *services.Scheduler {
+	return s.scheduler
+}
+
+// Queue returns the message queue consumer so applications can register
+// handlers for their own subjects before the server starts. It is nil when
+// QUEUE_DRIVER is none.
+func (s *Server) Queue() *queue.Consumer {
+	return s.queue
+}
+
+// MQTT returns the MQTT bridge so applications can handle topics and
+// publish messages. It is nil without MQTT_BROKER.
+func (s *Server) MQTT() *mqtt.Bridge {
+	return s.mqtt
+}
+
+// Mail returns the mailer so applications can send their own notifications.
+// It is nil when MAIL_DRIVER is none.
+func (s *Server) Mail() *mail.Mailer {
+	return s.mailer
+}
+
+// Pages returns the page renderer so applications can serve pages of their
+// own, such as those added in PAGES_TEMPLATE_DIR
+func (s *Server) Pages() *pages.Renderer {
+	return s.pages
 }
 
+// Events returns the event bus so applications can subscribe to events,
+// such as received webhooks
+func (s *Server) Events() *events.Bus {
+	return s.events
+}
+
+// Workers returns the worker pool for queueing background tasks
+func (s *Server) Workers() *services.WorkerPool {
+	return s.workers
+}
+
+// Start runs the server on the configured port until it is signalled to
+// stop. It returns nil after a clean stop, or an *ExitError saying why it
+// stopped otherwise; ExitCode maps either to the process exit code.
 func (s *Server) Start() error {
-	// Check if port is already in use
-	addr := ":" + s.config.Port
-	if ln, err := net.Listen("tcp", addr); err != nil {
-		return fmt.Errorf("port %s is not available: %w", s.config.Port, err)
-	} else {
-		ln.Close()
+	ln, err := net.Listen("tcp", ":"+s.config.Port)
+	if err != nil {
+		return s.exitEarly(nil, ExitListener, fmt.Errorf("port %s is not available: %w", s.config.Port, err))
 	}
 
+	// Listen for syscall signals for process to interrupt/quit, keeping the
+	// signal as the cause of the shutdown
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	go func() {
+		select {
+		case sig := <-signals:
+			cancel(signalCause{signal: sig})
+		case <-ctx.Done():
+		}
+	}()
+	return s.Serve(ctx, ln)
+}
+
+// Serve runs the background services and serves HTTP requests on ln until
+// ctx is done, then shuts down in the configured order and logs a
+// summary of why it stopped. Tests and applications embedding the server
+// use it to listen where they choose.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
 	// Create a root context for the server
 	rootCtx, rootCancel := context.WithCancel(context.Background())
 	defer rootCancel()
 
-	// WaitGroup to track all goroutines
-	var wg sync.WaitGroup
+	s.logBuildInfo()
 
-	// Start stats service
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := s.statsService.Start(rootCtx); err != nil && err != context.Canceled {
-			s.logger.Error("Stats service error: %v", err)
+	// Readiness would never pass with a misspelt critical service
+	for _, name := range s.config.ServicesCritical {
+		if err := s.services.Running(name); errors.Is(err, services.ErrServiceNotFound) {
+			return s.exitEarly(ln, ExitConfig, fmt.Errorf("SERVICES_CRITICAL: %w", err))
 		}
-	}()
+	}
+	// and a misspelt service in the shutdown order would never be stopped
+	// ahead of the rest
+	for _, step := range s.config.ShutdownOrder {
+		if step == "http" || step == "services" {
+			continue
+		}
+		if err := s.services.Running(step); errors.Is(err, services.ErrServiceNotFound) {
+			return s.exitEarly(ln, ExitConfig, fmt.Errorf("SHUTDOWN_ORDER: %w", err))
+		}
+	}
 
-	// Listen for syscall signals for process to interrupt/quit
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	// Start background services, stopping those started if one fails
+	if err := s.services.Start(rootCtx); err != nil {
+		rootCancel()
+		s.services.Wait()
+		return s.exitEarly(ln, ExitServices, fmt.Errorf("failed to start services: %w", err))
+	}
 
 	// Start the server in a goroutine
 	serverError := make(chan error, 1)
 	go func() {
-		s.logger.Info("Server starting on port %s", s.config.Port)
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.logger.Info("Server starting on %s", ln.Addr())
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
 			serverError <- err
 		}
 	}()
 
 	// Wait for shutdown signal or server error
-	var shutdownErr error
+	var summary exitSummary
 	select {
 	case err := <-serverError:
-		shutdownErr = fmt.Errorf("server error: %w", err)
-		rootCancel() // Cancel all goroutines
-	case <-sig:
-		s.logger.Info("Shutdown signal received")
+		summary = exitSummary{reason: ExitListener, inFlight: s.inFlight.Load(), err: fmt.Errorf("server error: %w", err)}
 		rootCancel() // Cancel all goroutines
+	case <-ctx.Done():
+		summary = exitSummary{reason: ExitSignal, inFlight: s.inFlight.Load(), shutdownStarted: time.Now()}
+		if cause, ok := context.Cause(ctx).(signalCause); ok {
+			summary.signal = cause.signal
+			s.logger.Info("Shutdown signal received: %s", cause.signal)
+		} else {
+			s.logger.Info("Shutdown signal received")
+		}
+		summary.err = s.shutdown()
+		rootCancel() // Cancel anything still running
+	case <-s.restart:
+		s.logger.Warn("Restarting the server")
+		summary = exitSummary{reason: ExitRestart, inFlight: s.inFlight.Load(), shutdownStarted: time.Now()}
+		summary.err = errors.Join(ErrRestart, s.shutdown())
+		rootCancel()
+	}
 
-		// Shutdown signal with grace period of 30 seconds
-		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer shutdownCancel()
-
-		// Trigger graceful shutdown
-		if err := s.server.Shutdown(shutdownCtx); err != nil {
-			shutdownErr = fmt.Errorf("error during shutdown: %w", err)
+	// Wait for all services to finish
+	s.logger.Info("Waiting for all services to finish...")
+	s.services.Wait()
+	s.logger.Info("All services finished")
+	if err := s.outbox.Close(); err != nil {
+		s.logger.Error("Error closing outbox sinks: %v", err)
+	}
+	if s.queue != nil {
+		if err := s.queue.Close(); err != nil {
+			s.logger.Error("Error closing queue connection: %v", err)
 		}
 	}
 
-	// Wait for all goroutines to finish
-	s.logger.Info("Waiting for all goroutines to finish...")
-	wg.Wait()
-	s.logger.Info("All goroutines finished")
+	s.logExit(summary)
+	if summary.err != nil {
+		return &ExitError{Reason: summary.reason, Err: summary.err}
+	}
+	return nil
+}
+
+// exitEarly closes ln, if any, and logs the summary of a stop before the
+// server started serving, returning its *ExitError
+func (s *Server) exitEarly(ln net.Listener, reason ExitReason, err error) error {
+	if ln != nil {
+		ln.Close()
+	}
+	s.logExit(exitSummary{reason: reason, err: err})
+	return &ExitError{Reason: reason, Err: err}
+}
+
+// newQueueBroker returns the broker to consume messages from, or nil when
+// none is configured
+func newQueueBroker(cfg *config.Config) queue.Broker {
+	switch cfg.QueueDriver {
+	case "nats":
+		return queue.NewNATS(cfg.QueueURL, cfg.QueueConcurrency)
+	case "rabbitmq":
+		return queue.NewRabbitMQ(cfg.QueueURL, cfg.QueueConcurrency)
+	}
+	return nil
+}
+
+// newMailSender returns the sender of the configured mail driver, or nil
+// when email is disabled
+func newMailSender(cfg *config.Config) mail.Sender {
+	switch cfg.MailDriver {
+	case "smtp":
+		return mail.NewSMTP(mail.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			TLS:      cfg.SMTPTLS,
+		})
+	case "ses":
+		return mail.NewSES(mail.SESConfig{
+			Region:       cfg.MailSESRegion,
+			Endpoint:     cfg.MailSESEndpoint,
+			AccessKey:    cfg.MailSESAccessKey,
+			SecretKey:    cfg.MailSESSecretKey,
+			SessionToken: cfg.MailSESToken,
+		})
+	}
+	return nil
+}
 
-	return shutdownErr
+// newBlobStore opens the log archive bucket, or returns nil when none is
+// configured
+func newBlobStore(cfg *config.Config) (logarchive.BlobStore, error) {
+	if cfg.LogArchiveBucket == "" {
+		return nil, nil
+	}
+	if cfg.LogArchiveStore == "gcs" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return logarchive.NewGCS(ctx, logarchive.GCSConfig{Bucket: cfg.LogArchiveBucket, CredentialsFile: cfg.LogArchiveGCSCredentials})
+	}
+	return logarchive.NewS3(logarchive.S3Config{
+		Bucket:       cfg.LogArchiveBucket,
+		Region:       cfg.LogArchiveRegion,
+		Endpoint:     cfg.LogArchiveEndpoint,
+		AccessKey:    cfg.LogArchiveAccessKey,
+		SecretKey:    cfg.LogArchiveSecretKey,
+		SessionToken: cfg.LogArchiveToken,
+	}), nil
 }
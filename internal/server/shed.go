@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"exampleserver/internal/stats"
+	"exampleserver/pkg/httperr"
+)
+
+// priorityPaths are served however overloaded the server is, so probes,
+// metrics scrapes and operators keep working
+var priorityPaths = []string{"/healthz", "/readyz", "/metrics", "/api/version", "/api/admin/", "/api/loggersettings/"}
+
+var requestsShed = stats.NewCounter("requests_shed")
+
+// shedLoad answers 503 with Retry-After to low-priority requests while the
+// server is overloaded: when more requests than SHED_MAX_IN_FLIGHT are in
+// flight or the p99 latency of the previous stats interval is above
+// SHED_MAX_LATENCY. It runs before trackRequests, so shed requests count
+// neither as in flight nor towards the latency that triggers shedding. The
+// requests of a batch aren't shed, as the batch itself got through.
+func (s *Server) shedLoad(next http.Handler) http.Handler {
+	retryAfter := strconv.Itoa(int(s.config.ShedRetryAfter.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reason := s.overloaded()
+		if s.shedding.Swap(reason != "") != (reason != "") {
+			if reason != "" {
+				s.logger.Warn("Shedding low-priority requests: %s", reason)
+			} else {
+				s.logger.Info("No longer shedding requests")
+			}
+		}
+		if reason == "" || priority(r.URL.Path, s.config.ShedExemptPaths) || inBatch(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestsShed.Inc()
+		w.Header().Set("Retry-After", retryAfter)
+		httperr.Write(w, r, http.StatusServiceUnavailable, "Server is overloaded, retry later")
+	})
+}
+
+// overloaded describes the threshold exceeded, or is empty when there is
+// none
+func (s *Server) overloaded() string {
+	if max := int64(s.config.ShedMaxInFlight); max > 0 {
+		if inFlight := s.inFlight.Load(); inFlight >= max {
+			return fmt.Sprintf("%d requests in flight", inFlight)
+		}
+	}
+	if max := s.config.ShedMaxLatency; max > 0 {
+		if p99 := s.statsService.Requests().Latency(stats.AllRoutes).P99; p99 > max {
+			return fmt.Sprintf("p99 latency of %v", p99)
+		}
+	}
+	return ""
+}
+
+func priority(path string, exempt []string) bool {
+	for _, prefix := range priorityPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	for _, prefix := range exempt {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"exampleserver/internal/services"
+)
+
+// shutdown stops the server in the configured order. Readiness fails for
+// the drain delay first, so load balancers stop routing here before the
+// listener closes; the steps of SHUTDOWN_ORDER then share the grace period.
+func (s *Server) shutdown() error {
+	if delay := s.config.ShutdownDrainDelay; delay > 0 {
+		s.Drain()
+		s.logger.Info("Waiting %s for load balancers to stop routing here", delay)
+		time.Sleep(delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownGracePeriod)
+	defer cancel()
+
+	// The HTTP server and the services are always stopped, last when the
+	// order leaves them out
+	steps := s.config.ShutdownOrder
+	for _, required := range []string{"http", "services"} {
+		if !slices.Contains(steps, required) {
+			steps = append(slices.Clone(steps), required)
+		}
+	}
+
+	var shutdownErr error
+	for _, step := range steps {
+		switch step {
+		case "http":
+			// Streams would otherwise hold connections open until the
+			// grace period runs out
+			if s.config.ShutdownStreams == "close" {
+				for _, closeStreams := range s.closeStreams {
+					closeStreams()
+				}
+			}
+			s.logger.Info("Stopping HTTP server...")
+			if err := s.server.Shutdown(ctx); err != nil {
+				shutdownErr = fmt.Errorf("error during shutdown: %w", err)
+			}
+		case "services":
+			s.logger.Info("Stopping services...")
+			if err := s.services.Stop(ctx); err != nil {
+				s.logger.Error("Error stopping services: %v", err)
+			}
+		default:
+			// A single service stopped ahead of the rest
+			err := s.services.StopService(ctx, step)
+			if err != nil && !errors.Is(err, services.ErrServiceNotRunning) {
+				s.logger.Error("Error stopping service %s: %v", step, err)
+			}
+		}
+	}
+	return shutdownErr
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+
+	"exampleserver/internal/handlers"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/logger"
+)
+
+// Names of the toggles in the settings store
+const (
+	toggleMaintenance   = "maintenance"
+	toggleDebugLogging  = "debug_logging"
+	toggleRateLimit     = "rate_limit_multiplier"
+	toggleMirrorPercent = "mirror_percent"
+)
+
+// maintenanceRetryAfter is the Retry-After of requests refused during
+// maintenance, in seconds
+const maintenanceRetryAfter = "60"
+
+// maintenancePaths are served during maintenance on top of priorityPaths,
+// so admins can sign in to end it
+var maintenancePaths = []string{"/api/login"}
+
+// debugLogger is implemented by loggers that report whether debug logging
+// is on
+type debugLogger interface {
+	DebugEnabled() bool
+}
+
+// loadToggles applies the toggles stored by an earlier run. They take
+// precedence over the environment and logger.yaml until changed again.
+func (s *Server) loadToggles(ctx context.Context) {
+	settings, err := s.store.Settings.List(ctx)
+	if err != nil {
+		s.logger.Error("Failed to load toggles, using the configured defaults: %v", err)
+		return
+	}
+	for _, setting := range settings {
+		var err error
+		switch setting.Name {
+		case toggleMaintenance:
+			var on bool
+			if err = json.Unmarshal(setting.Value, &on); err == nil {
+				s.maintenance.Store(on)
+			}
+		case toggleDebugLogging:
+			var on bool
+			if err = json.Unmarshal(setting.Value, &on); err == nil {
+				s.logger.SetDebug(on)
+			}
+		case toggleRateLimit:
+			var multiplier float64
+			if err = json.Unmarshal(setting.Value, &multiplier); err == nil && multiplier > 0 {
+				s.rateScale.Store(math.Float64bits(multiplier))
+			}
+		case toggleMirrorPercent:
+			var percent int
+			if err = json.Unmarshal(setting.Value, &percent); err == nil && s.mirror != nil {
+				s.mirror.percent.Store(int64(percent))
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			s.logger.Warn("Ignoring the stored %s toggle %s: %v", setting.Name, setting.Value, err)
+			continue
+		}
+		s.logger.Info("Toggle %s is %s, as set by %s at %s", setting.Name, setting.Value, setting.UpdatedBy, setting.UpdatedAt.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// Toggles returns the current toggles
+func (s *Server) Toggles() handlers.ToggleSettings {
+	toggles := handlers.ToggleSettings{
+		Maintenance:         s.maintenance.Load(),
+		RateLimitMultiplier: s.rateLimitMultiplier(),
+	}
+	if l, ok := s.logger.(debugLogger); ok {
+		toggles.DebugLogging = l.DebugEnabled()
+	}
+	if s.mirror != nil {
+		toggles.MirrorPercent = int(s.mirror.percent.Load())
+	}
+	return toggles
+}
+
+// SetToggles stores and applies the toggles of update, recording each in
+// the audit log. A toggle that fails to be stored isn't applied, and stops
+// the ones after it.
+func (s *Server) SetToggles(ctx context.Context, update handlers.ToggleSettingsUpdate, actor string) (handlers.ToggleSettings, error) {
+	s.togglesMu.Lock()
+	defer s.togglesMu.Unlock()
+
+	before := s.Toggles()
+	var err error
+	if update.Maintenance != nil && err == nil {
+		err = s.setToggle(ctx, toggleMaintenance, before.Maintenance, *update.Maintenance, actor, func() {
+			s.maintenance.Store(*update.Maintenance)
+		})
+	}
+	if update.DebugLogging != nil && err == nil {
+		err = s.setToggle(ctx, toggleDebugLogging, before.DebugLogging, *update.DebugLogging, actor, func() {
+			s.logger.SetDebug(*update.DebugLogging)
+		})
+	}
+	if update.RateLimitMultiplier != nil && err == nil {
+		err = s.setToggle(ctx, toggleRateLimit, before.RateLimitMultiplier, *update.RateLimitMultiplier, actor, func() {
+			s.rateScale.Store(math.Float64bits(*update.RateLimitMultiplier))
+		})
+	}
+	if update.MirrorPercent != nil && s.mirror != nil && err == nil {
+		err = s.setToggle(ctx, toggleMirrorPercent, before.MirrorPercent, *update.MirrorPercent, actor, func() {
+			s.mirror.percent.Store(int64(*update.MirrorPercent))
+		})
+	}
+	return s.Toggles(), err
+}
+
+// setToggle stores a toggle, applies it and, if it changed, records the
+// change in the audit log and, at WARN with audit=true, the log
+func (s *Server) setToggle(ctx context.Context, name string, from, to interface{}, actor string, apply func()) error {
+	value, err := json.Marshal(to)
+	if err != nil {
+		return err
+	}
+	if _, err := s.store.Settings.Put(ctx, store.Setting{Name: name, Value: value, UpdatedBy: actor}); err != nil {
+		return err
+	}
+	apply()
+	if from == to {
+		return nil
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{"from": from, "to": to})
+	if _, err := s.store.Audit.Record(ctx, store.AuditEntry{Actor: actor, Action: "toggle", Target: name, Details: details}); err != nil {
+		logger.ErrorCtx(ctx, "Failed to record the change of toggle %s in the audit log: %v", name, err)
+	}
+	logger.Ctx(ctx).WithFields(map[string]interface{}{
+		"audit": true, "actor": actor, "setting": name, "from": from, "to": to,
+	}).Warn("Toggle %s changed from %v to %v by %s", name, from, to, actor)
+	return nil
+}
+
+// Mirroring reports whether requests are copied to a mirror upstream
+func (s *Server) Mirroring() bool {
+	return s.mirror != nil
+}
+
+// rateLimitMultiplier scales the ROUTE_CONFIG rate limits, 1 until changed
+func (s *Server) rateLimitMultiplier() float64 {
+	if bits := s.rateScale.Load(); bits != 0 {
+		return math.Float64frombits(bits)
+	}
+	return 1
+}
+
+// inMaintenance answers 503 with Retry-After to requests other than those
+// to priority paths while maintenance mode is on
+func (s *Server) inMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.maintenance.Load() || priority(r.URL.Path, s.config.ShedExemptPaths) || maintenanceExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		httperr.Write(w, r, http.StatusServiceUnavailable, "Down for maintenance, retry later")
+	})
+}
+
+func maintenanceExempt(path string) bool {
+	for _, prefix := range maintenancePaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
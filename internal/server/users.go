@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/store"
+)
+
+// validateSession rejects tokens of users that no longer exist, have been
+// disabled or have had their sessions revoked, and refreshes the roles from
+// the user store so role changes apply immediately
+func (s *Server) validateSession(r *http.Request, claims *auth.Claims) error {
+	user, err := s.store.Users.Get(r.Context(), claims.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return auth.ErrRevokedSession
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled || user.SessionVersion != claims.SessionVersion {
+		return auth.ErrRevokedSession
+	}
+	claims.Roles = user.Roles
+	claims.Tenants = user.Tenants
+	return nil
+}
+
+// bootstrapAdmin creates the configured admin user if it doesn't exist yet,
+// so a fresh store can be operated through the admin API
+func (s *Server) bootstrapAdmin(ctx context.Context) error {
+	if s.config.AdminPassword == "" {
+		return nil
+	}
+	_, err := s.store.Users.GetByUsername(ctx, s.config.AdminUsername)
+	if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	hash, err := s.passwords.Hash(s.config.AdminPassword)
+	if err != nil {
+		return err
+	}
+	if _, err := s.store.Users.Create(ctx, store.User{
+		Username:     s.config.AdminUsername,
+		Roles:        []string{auth.RoleAdmin},
+		PasswordHash: hash,
+	}); err != nil {
+		return err
+	}
+	s.logger.Info("Created admin user %s", s.config.AdminUsername)
+	return nil
+}
+
+// oauthProviders returns the social login providers that have a client
+// configured
+func (s *Server) oauthProviders() []*auth.OAuthProvider {
+	callback := func(provider string) string {
+		return s.config.OAuthRedirectBaseURL + "/api/auth/" + provider + "/callback"
+	}
+	var providers []*auth.OAuthProvider
+	if s.config.OAuthGitHubClientID != "" {
+		providers = append(providers, auth.GitHubProvider(s.config.OAuthGitHubClientID, s.config.OAuthGitHubClientSecret, callback("github")))
+	}
+	if s.config.OAuthGoogleClientID != "" {
+		providers = append(providers, auth.GoogleProvider(s.config.OAuthGoogleClientID, s.config.OAuthGoogleClientSecret, callback("google")))
+	}
+	return providers
+}
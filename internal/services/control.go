@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// find returns the managed service with the given name
+func (m *Manager) find(name string) (*managedService, error) {
+	for _, ms := range m.services {
+		if ms.service.Name() == name {
+			return ms, nil
+		}
+	}
+	return nil, ErrServiceNotFound
+}
+
+// StopService stops a single service and waits for it to finish. The
+// service stays stopped until StartService is called; it is not restarted
+// by the restart policy.
+func (m *Manager) StopService(ctx context.Context, name string) error {
+	ms, err := m.find(name)
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	cancel, done := ms.cancel, ms.done
+	running := done != nil && ms.state != StateStopped && ms.state != StateFailed
+	if running {
+		ms.stopRequested = true
+	}
+	ms.mu.Unlock()
+	if !running {
+		return ErrServiceNotRunning
+	}
+
+	m.logger.Info("Stopping service %s", name)
+	stopErr := ms.service.Stop(ctx)
+	cancel()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for %s to stop: %w", name, ctx.Err())
+	}
+	if stopErr != nil {
+		return fmt.Errorf("stopping %s: %w", name, stopErr)
+	}
+	return nil
+}
+
+// StartService starts a stopped or failed service, resetting its restart
+// count. Of concurrent calls for the same service only the first starts it;
+// the others return ErrServiceRunning.
+func (m *Manager) StartService(name string) error {
+	if m.rootContext() == nil {
+		return ErrNotStarted
+	}
+	if m.isStopping() {
+		return fmt.Errorf("service manager is shutting down")
+	}
+	ms, err := m.find(name)
+	if err != nil {
+		return err
+	}
+
+	// Checked and marked starting in one critical section, so a second
+	// call can't launch the service again
+	ms.mu.Lock()
+	if ms.state != StateStopped && ms.state != StateFailed {
+		ms.mu.Unlock()
+		return ErrServiceRunning
+	}
+	done := ms.done
+	ms.restarts = 0
+	ms.state = StateStarting
+	ms.since = time.Now()
+	ms.mu.Unlock()
+
+	// Make sure the previous run loop has fully exited
+	if done != nil {
+		<-done
+	}
+
+	m.launch(ms)
+	return nil
+}
+
+// RestartService stops a service if it is running and starts it again
+func (m *Manager) RestartService(ctx context.Context, name string) error {
+	if err := m.StopService(ctx, name); err != nil && err != ErrServiceNotRunning {
+		return err
+	}
+	return m.StartService(name)
+}
@@ -0,0 +1,12 @@
+package services
+
+import "errors"
+
+var (
+	ErrServiceNotFound   = errors.New("service not found")
+	ErrServiceRunning    = errors.New("service already running")
+	ErrServiceNotRunning = errors.New("service not running")
+	ErrNotStarted        = errors.New("service manager not started")
+	ErrQueueFull         = errors.New("task queue full")
+	ErrPoolStopped       = errors.New("worker pool stopped")
+)
@@ -0,0 +1,58 @@
+package services
+
+import "sync"
+
+// hooks holds lifecycle callbacks registered on a Manager
+type hooks struct {
+	mu      sync.RWMutex
+	onStart []func(name string)
+	onStop  []func(name string)
+	onError []func(name string, err error)
+}
+
+// OnStart registers a hook called each time a service is started, including
+// restarts
+func (m *Manager) OnStart(hook func(name string)) {
+	m.hooks.mu.Lock()
+	defer m.hooks.mu.Unlock()
+	m.hooks.onStart = append(m.hooks.onStart, hook)
+}
+
+// OnStop registers a hook called when a service has stopped for good, either
+// cleanly or after exhausting its restarts
+func (m *Manager) OnStop(hook func(name string)) {
+	m.hooks.mu.Lock()
+	defer m.hooks.mu.Unlock()
+	m.hooks.onStop = append(m.hooks.onStop, hook)
+}
+
+// OnError registers a hook called when a service's Start returns an error
+func (m *Manager) OnError(hook func(name string, err error)) {
+	m.hooks.mu.Lock()
+	defer m.hooks.mu.Unlock()
+	m.hooks.onError = append(m.hooks.onError, hook)
+}
+
+func (m *Manager) fireStart(name string) {
+	m.hooks.mu.RLock()
+	defer m.hooks.mu.RUnlock()
+	for _, hook := range m.hooks.onStart {
+		hook(name)
+	}
+}
+
+func (m *Manager) fireStop(name string) {
+	m.hooks.mu.RLock()
+	defer m.hooks.mu.RUnlock()
+	for _, hook := range m.hooks.onStop {
+		hook(name)
+	}
+}
+
+func (m *Manager) fireError(name string, err error) {
+	m.hooks.mu.RLock()
+	defer m.hooks.mu.RUnlock()
+	for _, hook := range m.hooks.onError {
+		hook(name, err)
+	}
+}
@@ -2,38 +2,393 @@ package services
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
 	"sync"
+	"time"
+
+	"exampleserver/pkg/logger"
 )
 
+// managedService tracks the lifecycle of a single service
+type managedService struct {
+	service  Service
+	deps     []string
+	mu       sync.Mutex
+	state    State
+	since    time.Time
+	lastErr  error
+	restarts int
+
+	// Set while a run goroutine exists for the service
+	cancel        context.CancelFunc
+	done          chan struct{}
+	stopRequested bool
+}
+
+func (ms *managedService) setState(state State, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.state = state
+	ms.since = time.Now()
+	if err != nil {
+		ms.lastErr = err
+	}
+}
+
+// advance moves the service from one state to another, unless it has
+// already moved on
+func (ms *managedService) advance(from, to State) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.state == from {
+		ms.state = to
+		ms.since = time.Now()
+	}
+}
+
+func (ms *managedService) status() Status {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	status := Status{
+		Name:     ms.service.Name(),
+		State:    ms.state,
+		Since:    ms.since,
+		Restarts: ms.restarts,
+	}
+	if ms.lastErr != nil {
+		status.LastError = ms.lastErr.Error()
+	}
+	return status
+}
+
+// DefaultReadyTimeout is how long Start waits for a service to be ready
+// unless changed with SetReadyTimeout
+const DefaultReadyTimeout = 30 * time.Second
+
 // Manager handles multiple background services
 type Manager struct {
-	services []Service
-	wg       sync.WaitGroup
+	mu           sync.Mutex
+	ctx          context.Context // root context passed to Start, guarded by mu
+	services     []*managedService
+	order        []*managedService // start order, resolved by Start
+	policy       RestartPolicy
+	readyTimeout time.Duration
+	stopping     chan struct{}
+	hooks        hooks
+	wg           sync.WaitGroup
+	logger       logger.LoggerInterface
 }
 
-func NewManager() *Manager {
+func NewManager(logger logger.LoggerInterface) *Manager {
 	return &Manager{
-		services: make([]Service, 0),
+		services:     make([]*managedService, 0),
+		policy:       DefaultRestartPolicy(),
+		readyTimeout: DefaultReadyTimeout,
+		stopping:     make(chan struct{}),
+		logger:       logger,
 	}
 }
 
-// AddService adds a service to be managed
-func (m *Manager) AddService(service Service) {
-	m.services = append(m.services, service)
+// SetRestartPolicy changes how failing services are restarted
+func (m *Manager) SetRestartPolicy(policy RestartPolicy) {
+	m.policy = policy
+}
+
+// SetReadyTimeout changes how long Start waits for a service implementing
+// ReadyNotifier to be ready
+func (m *Manager) SetReadyTimeout(timeout time.Duration) {
+	m.readyTimeout = timeout
+}
+
+// AddService adds a service to be managed. Services named in dependsOn are
+// started before it and stopped after it.
+func (m *Manager) AddService(service Service, dependsOn ...string) {
+	m.services = append(m.services, &managedService{
+		service: service,
+		deps:    dependsOn,
+		state:   StateStopped,
+		since:   time.Now(),
+	})
 }
 
-// Start starts all services
-func (m *Manager) Start(ctx context.Context) {
-	for _, service := range m.services {
-		m.wg.Add(1)
-		go func(s Service) {
-			defer m.wg.Done()
-			if err := s.Start(ctx); err != nil && err != context.Canceled {
-				log.Printf("service error: %v", err)
+// Start starts all services in dependency order. A service is only started
+// once its dependencies are running and, if they implement ReadyNotifier,
+// ready. It fails if a service isn't ready within the ready timeout or
+// stops before it is, leaving the services started so far for the caller
+// to stop.
+func (m *Manager) Start(ctx context.Context) error {
+	order, err := m.resolveOrder()
+	if err != nil {
+		return err
+	}
+	m.order = order
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	for _, ms := range order {
+		m.launch(ms)
+
+		if notifier, ok := ms.service.(ReadyNotifier); ok {
+			if err := m.waitReady(ctx, ms, notifier); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// waitReady waits for a launched service to be ready
+func (m *Manager) waitReady(ctx context.Context, ms *managedService, notifier ReadyNotifier) error {
+	ms.mu.Lock()
+	done := ms.done
+	ms.mu.Unlock()
+	timer := time.NewTimer(m.readyTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-notifier.Ready():
+		return nil
+	case <-done:
+		return fmt.Errorf("service %s stopped before it was ready: %s", ms.service.Name(), ms.status().LastError)
+	case <-timer.C:
+		return fmt.Errorf("service %s wasn't ready within %s", ms.service.Name(), m.readyTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// launch starts the run loop of a service in its own goroutine with a
+// context that can be cancelled independently of the other services
+func (m *Manager) launch(ms *managedService) {
+	ctx, cancel := context.WithCancel(m.rootContext())
+	done := make(chan struct{})
+
+	ms.mu.Lock()
+	ms.cancel = cancel
+	ms.done = done
+	ms.stopRequested = false
+	ms.state = StateStarting
+	ms.since = time.Now()
+	ms.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(done)
+		defer cancel()
+		m.run(ctx, ms)
+	}()
+}
+
+// rootContext returns the context passed to Start, nil before Start
+func (m *Manager) rootContext() context.Context {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ctx
+}
+
+// resolveOrder sorts services so that every service comes after its
+// dependencies, keeping registration order where there is a choice
+func (m *Manager) resolveOrder() ([]*managedService, error) {
+	byName := make(map[string]*managedService, len(m.services))
+	for _, ms := range m.services {
+		name := ms.service.Name()
+		if _, exists := byName[name]; exists {
+			return nil, fmt.Errorf("duplicate service name %q", name)
+		}
+		byName[name] = ms
+	}
+	for _, ms := range m.services {
+		for _, dep := range ms.deps {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("service %q depends on unknown service %q", ms.service.Name(), dep)
+			}
+		}
+	}
+
+	order := make([]*managedService, 0, len(m.services))
+	visited := make(map[string]bool, len(m.services))
+	visiting := make(map[string]bool)
+
+	var visit func(ms *managedService) error
+	visit = func(ms *managedService) error {
+		name := ms.service.Name()
+		if visited[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("dependency cycle involving service %q", name)
+		}
+		visiting[name] = true
+		for _, dep := range ms.deps {
+			if err := visit(byName[dep]); err != nil {
+				return err
 			}
-		}(service)
+		}
+		visiting[name] = false
+		visited[name] = true
+		order = append(order, ms)
+		return nil
+	}
+
+	for _, ms := range m.services {
+		if err := visit(ms); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// run starts a service and restarts it according to the restart policy
+// until it returns cleanly, the manager stops or it runs out of restarts
+func (m *Manager) run(ctx context.Context, ms *managedService) {
+	name := ms.service.Name()
+	defer m.fireStop(name)
+
+	for {
+		m.logger.Info("Starting service %s", name)
+		ms.setState(StateStarting, nil)
+		m.fireStart(name)
+
+		// A service is running once it is ready, or straight away when it
+		// doesn't say
+		attemptDone := make(chan struct{})
+		if notifier, ok := ms.service.(ReadyNotifier); ok {
+			go func() {
+				select {
+				case <-notifier.Ready():
+					ms.advance(StateStarting, StateRunning)
+				case <-attemptDone:
+				}
+			}()
+		} else {
+			ms.setState(StateRunning, nil)
+		}
+
+		err := callSafely(func() error { return ms.service.Start(ctx) })
+		close(attemptDone)
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			m.logger.WithFields(panicErr.Fields("service", name)).Error("Service %s panicked: %v", name, panicErr.Value)
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			m.fireError(name, err)
+		}
+		if err == nil || errors.Is(err, context.Canceled) || m.isStopping() || ms.isStopRequested() {
+			ms.setState(StateStopped, nil)
+			return
+		}
+
+		ms.mu.Lock()
+		attempt := ms.restarts + 1
+		ms.mu.Unlock()
+		if attempt > m.policy.MaxRestarts {
+			m.logger.Error("Service %s failed: %v", name, err)
+			ms.setState(StateFailed, err)
+			return
+		}
+
+		delay := m.policy.delay(attempt)
+		m.logger.Error("Service %s error: %v (restart %d/%d in %s)", name, err, attempt, m.policy.MaxRestarts, delay)
+		ms.setState(StateRestarting, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			ms.setState(StateStopped, nil)
+			return
+		case <-m.stopping:
+			ms.setState(StateStopped, nil)
+			return
+		}
+
+		ms.mu.Lock()
+		ms.restarts++
+		ms.mu.Unlock()
+	}
+}
+
+func (ms *managedService) isStopRequested() bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.stopRequested
+}
+
+func (m *Manager) isStopping() bool {
+	select {
+	case <-m.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Status returns the state of every managed service in registration order
+func (m *Manager) Status() []Status {
+	statuses := make([]Status, 0, len(m.services))
+	for _, ms := range m.services {
+		statuses = append(statuses, ms.status())
+	}
+	return statuses
+}
+
+// Running returns an error unless every named service is running. A service
+// waiting to be restarted after failing is reported as crash-looping.
+func (m *Manager) Running(names ...string) error {
+	for _, name := range names {
+		ms, err := m.find(name)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		status := ms.status()
+		switch status.State {
+		case StateRunning:
+		case StateRestarting:
+			return fmt.Errorf("service %s is crash-looping after %d restarts: %s", name, status.Restarts, status.LastError)
+		case StateFailed:
+			return fmt.Errorf("service %s failed: %s", name, status.LastError)
+		default:
+			return fmt.Errorf("service %s is %s", name, status.State)
+		}
+	}
+	return nil
+}
+
+// Stop stops all services in reverse dependency order and waits for them to
+// finish, giving up when ctx is done
+func (m *Manager) Stop(ctx context.Context) error {
+	if !m.isStopping() {
+		close(m.stopping)
+	}
+
+	order := m.order
+	if order == nil {
+		order = m.services
+	}
+
+	var errs []error
+	for i := len(order) - 1; i >= 0; i-- {
+		service := order[i].service
+		m.logger.Info("Stopping service %s", service.Name())
+		if err := service.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s: %w", service.Name(), err))
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("waiting for services: %w", ctx.Err()))
 	}
+	return errors.Join(errs...)
 }
 
 // Wait waits for all services to complete
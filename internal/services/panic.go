@@ -0,0 +1,37 @@
+package services
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"exampleserver/pkg/logger"
+)
+
+// PanicError is returned in place of a service, job or task error when it
+// panics
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Fields returns the log fields reporting the panic, so that it is logged
+// as a panic report carrying its stack, with kind naming what panicked
+func (e *PanicError) Fields(kind, name string) map[string]interface{} {
+	fields := logger.PanicFields(e.Value, e.Stack)
+	fields[kind] = name
+	return fields
+}
+
+// callSafely runs fn, converting a panic into a *PanicError
+func callSafely(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"exampleserver/pkg/logger"
+)
+
+const (
+	// defaultJobTimeout applies to jobs registered without a timeout
+	defaultJobTimeout = 5 * time.Minute
+	// jobHistory is the number of results kept per job
+	jobHistory = 10
+)
+
+// Job is a unit of work run by the Scheduler
+type Job struct {
+	Name     string
+	Schedule string        // cron expression, see ParseSchedule
+	Timeout  time.Duration // per-run deadline, defaults to five minutes
+	Run      func(ctx context.Context) error
+}
+
+// JobResult records a single execution of a job
+type JobResult struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Summary  string        `json:"summary,omitempty"` // set by the job with ReportJob
+	Skipped  bool          `json:"skipped,omitempty"` // previous run still in progress
+}
+
+// JobStatus reports a job's schedule and recent results
+type JobStatus struct {
+	Name     string      `json:"name"`
+	Schedule string      `json:"schedule"`
+	Running  bool        `json:"running"`
+	NextRun  time.Time   `json:"next_run"`
+	History  []JobResult `json:"history"`
+}
+
+type scheduledJob struct {
+	job      Job
+	schedule Schedule
+	next     time.Time
+	running  bool
+	history  []JobResult
+}
+
+// Scheduler is a service that runs registered jobs on cron schedules. A job
+// is never run concurrently with itself: if it's still running when it is
+// due again, that run is skipped.
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    map[string]*scheduledJob
+	wake    chan struct{}
+	running sync.WaitGroup
+	cancel  context.CancelFunc
+	done    chan struct{}
+	logger  logger.LoggerInterface
+}
+
+func NewScheduler(logger logger.LoggerInterface) *Scheduler {
+	return &Scheduler{
+		jobs:   make(map[string]*scheduledJob),
+		wake:   make(chan struct{}, 1),
+		logger: logger,
+	}
+}
+
+// AddJob registers a job. Jobs can be added while the scheduler is running.
+func (s *Scheduler) AddJob(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("job needs a name and a run function")
+	}
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultJobTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("job %q already registered", job.Name)
+	}
+	s.jobs[job.Name] = &scheduledJob{
+		job:      job,
+		schedule: schedule,
+		next:     schedule.Next(time.Now()),
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Jobs returns the status of all registered jobs, sorted by name
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, sj := range s.jobs {
+		statuses = append(statuses, JobStatus{
+			Name:     sj.job.Name,
+			Schedule: sj.job.Schedule,
+			Running:  sj.running,
+			NextRun:  sj.next,
+			History:  append([]JobResult(nil), sj.history...),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Name identifies the service to the service manager
+func (s *Scheduler) Name() string {
+	return "scheduler"
+}
+
+func (s *Scheduler) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer close(done)
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.done = done
+	s.mu.Unlock()
+	defer cancel()
+
+	for {
+		timer := time.NewTimer(s.untilNext())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-s.wake:
+			timer.Stop()
+		case now := <-timer.C:
+			s.runDue(ctx, now)
+		}
+	}
+}
+
+// Stop stops scheduling new runs and waits for running jobs to finish
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	finished := make(chan struct{})
+	go func() {
+		<-done
+		s.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// untilNext returns the delay until the earliest due job
+func (s *Scheduler) untilNext() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, sj := range s.jobs {
+		if next.IsZero() || sj.next.Before(next) {
+			next = sj.next
+		}
+	}
+	if next.IsZero() {
+		return time.Hour // nothing scheduled, wait for AddJob
+	}
+	return time.Until(next)
+}
+
+// runDue starts every job that is due at now
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sj := range s.jobs {
+		if sj.next.After(now) {
+			continue
+		}
+		sj.next = sj.schedule.Next(now)
+
+		if sj.running {
+			s.logger.Warn("Job %s is still running, skipping this run", sj.job.Name)
+			sj.record(JobResult{Start: now, Skipped: true})
+			continue
+		}
+
+		sj.running = true
+		s.running.Add(1)
+		go s.execute(ctx, sj)
+	}
+}
+
+// execute runs a single job with its timeout and records the result
+func (s *Scheduler) execute(ctx context.Context, sj *scheduledJob) {
+	defer s.running.Done()
+
+	jobCtx, cancel := context.WithTimeout(ctx, sj.job.Timeout)
+	defer cancel()
+
+	report := &jobReport{}
+	jobCtx = context.WithValue(jobCtx, jobReportKey{}, report)
+
+	start := time.Now()
+	err := callSafely(func() error { return sj.job.Run(jobCtx) })
+	result := JobResult{Start: start, Duration: time.Since(start), Summary: report.get()}
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		s.logger.WithFields(panicErr.Fields("job", sj.job.Name)).Error("Job %s panicked: %v", sj.job.Name, panicErr.Value)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		s.logger.Error("Job %s failed after %s: %v", sj.job.Name, result.Duration, err)
+	} else if result.Summary != "" {
+		s.logger.Info("Job %s completed in %s: %s", sj.job.Name, result.Duration, result.Summary)
+	} else {
+		s.logger.Info("Job %s completed in %s", sj.job.Name, result.Duration)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sj.running = false
+	sj.record(result)
+}
+
+func (sj *scheduledJob) record(result JobResult) {
+	sj.history = append(sj.history, result)
+	if len(sj.history) > jobHistory {
+		sj.history = sj.history[len(sj.history)-jobHistory:]
+	}
+}
+
+type jobReportKey struct{}
+
+// jobReport carries the summary a job reports about its run
+type jobReport struct {
+	mu      sync.Mutex
+	summary string
+}
+
+func (r *jobReport) get() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.summary
+}
+
+// ReportJob records a short summary of what the current run did, such as
+// the number of records removed, shown with the run's result in the job
+// history. ctx must be the context passed to the job; outside a job the
+// call does nothing.
+func ReportJob(ctx context.Context, format string, args ...interface{}) {
+	report, ok := ctx.Value(jobReportKey{}).(*jobReport)
+	if !ok {
+		return
+	}
+	report.mu.Lock()
+	report.summary = fmt.Sprintf(format, args...)
+	report.mu.Unlock()
+}
@@ -4,5 +4,18 @@ import "context"
 
 // Service represents a background service that can be started and stopped
 type Service interface {
+	// Name identifies the service in logs and admin endpoints
+	Name() string
+	// Start runs the service until ctx is cancelled or Stop is called
 	Start(context.Context) error
+	// Stop asks the service to flush its state and return from Start. It
+	// should give up once ctx is done.
+	Stop(context.Context) error
+}
+
+// ReadyNotifier is implemented by services that need time after Start is
+// called before dependent services can use them
+type ReadyNotifier interface {
+	// Ready is closed once the service is ready
+	Ready() <-chan struct{}
 }
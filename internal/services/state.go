@@ -0,0 +1,53 @@
+package services
+
+import "time"
+
+// State is the lifecycle state of a managed service
+type State string
+
+const (
+	StateStarting   State = "starting"
+	StateRunning    State = "running"
+	StateRestarting State = "restarting"
+	StateFailed     State = "failed"
+	StateStopped    State = "stopped"
+)
+
+// Status reports the state of a managed service
+type Status struct {
+	Name      string    `json:"name"`
+	State     State     `json:"state"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"last_error,omitempty"`
+	Restarts  int       `json:"restarts"`
+}
+
+// RestartPolicy controls how the manager reacts to a service whose Start
+// returns an error
+type RestartPolicy struct {
+	MaxRestarts int           // give up and mark the service failed after this many restarts
+	Backoff     time.Duration // delay before the first restart, doubled on each attempt
+	MaxBackoff  time.Duration // upper bound for the restart delay
+}
+
+// DefaultRestartPolicy restarts a failing service up to five times with
+// exponential backoff starting at one second
+func DefaultRestartPolicy() RestartPolicy {
+	return RestartPolicy{
+		MaxRestarts: 5,
+		Backoff:     time.Second,
+		MaxBackoff:  30 * time.Second,
+	}
+}
+
+// delay returns the backoff before the given restart attempt (1-based)
+func (p RestartPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"exampleserver/pkg/logger"
+)
+
+// defaultTaskTimeout applies to tasks enqueued without a timeout
+const defaultTaskTimeout = time.Minute
+
+// Task is a unit of background work executed by a WorkerPool
+type Task struct {
+	Name    string
+	Run     func(ctx context.Context) error
+	Retries int           // additional attempts after a failure
+	Timeout time.Duration // deadline per attempt, defaults to one minute
+	// OnCancel, when set, is called if the pool stops before the task has
+	// run, or between its attempts
+	OnCancel func()
+}
+
+// PoolStats reports a worker pool's queue and task counters
+type PoolStats struct {
+	Workers   int    `json:"workers"`
+	Queued    int    `json:"queued"`
+	Capacity  int    `json:"capacity"`
+	Active    int64  `json:"active"`
+	Completed uint64 `json:"completed"`
+	Failed    uint64 `json:"failed"`
+	Retried   uint64 `json:"retried"`
+	// Rejected counts the tasks refused because the queue was full
+	Rejected uint64 `json:"rejected"`
+	// Cancelled counts the tasks the pool stopped before running
+	Cancelled uint64 `json:"cancelled"`
+}
+
+// WorkerPool is a service running queued tasks on a fixed number of workers.
+// Handlers should enqueue background work here rather than spawning
+// goroutines of their own.
+type WorkerPool struct {
+	name      string
+	workers   int
+	queueSize int
+
+	mu      sync.RWMutex
+	queue   chan Task
+	closed  bool
+	stopped chan struct{} // closed when Start returns
+
+	active    atomic.Int64
+	completed atomic.Uint64
+	failed    atomic.Uint64
+	retried   atomic.Uint64
+	rejected  atomic.Uint64
+	cancelled atomic.Uint64
+
+	logger logger.LoggerInterface
+}
+
+func NewWorkerPool(name string, workers, queueSize int, logger logger.LoggerInterface) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	return &WorkerPool{
+		name:      name,
+		workers:   workers,
+		queueSize: queueSize,
+		queue:     make(chan Task, queueSize),
+		logger:    logger,
+	}
+}
+
+// Enqueue adds a task to the queue without blocking. It fails with
+// ErrQueueFull when the queue is at capacity and ErrPoolStopped once the
+// pool is shutting down.
+func (p *WorkerPool) Enqueue(task Task) error {
+	if task.Run == nil {
+		return fmt.Errorf("task needs a run function")
+	}
+	if task.Timeout <= 0 {
+		task.Timeout = defaultTaskTimeout
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolStopped
+	}
+
+	select {
+	case p.queue <- task:
+		return nil
+	default:
+		p.rejected.Add(1)
+		return ErrQueueFull
+	}
+}
+
+// Stats returns the current queue length and task counters
+func (p *WorkerPool) Stats() PoolStats {
+	p.mu.RLock()
+	queued := len(p.queue)
+	p.mu.RUnlock()
+
+	return PoolStats{
+		Workers:   p.workers,
+		Queued:    queued,
+		Capacity:  p.queueSize,
+		Active:    p.active.Load(),
+		Completed: p.completed.Load(),
+		Failed:    p.failed.Load(),
+		Retried:   p.retried.Load(),
+		Rejected:  p.rejected.Load(),
+		Cancelled: p.cancelled.Load(),
+	}
+}
+
+// Collect reports the pool stats as metrics for the stats service
+func (p *WorkerPool) Collect(ctx context.Context) (map[string]float64, error) {
+	stats := p.Stats()
+	return map[string]float64{
+		"queued":    float64(stats.Queued),
+		"active":    float64(stats.Active),
+		"completed": float64(stats.Completed),
+		"failed":    float64(stats.Failed),
+		"retried":   float64(stats.Retried),
+		"rejected":  float64(stats.Rejected),
+		"cancelled": float64(stats.Cancelled),
+	}, nil
+}
+
+// Name identifies the service to the service manager
+func (p *WorkerPool) Name() string {
+	return p.name
+}
+
+// Start runs the workers until ctx is cancelled or Stop has drained the
+// queue. Tasks still queued when ctx is cancelled are cancelled.
+func (p *WorkerPool) Start(ctx context.Context) error {
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	p.mu.Lock()
+	if p.closed {
+		// Restarted after Stop
+		p.queue = make(chan Task, p.queueSize)
+		p.closed = false
+	}
+	queue := p.queue
+	p.stopped = stopped
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx, queue)
+		}()
+	}
+	wg.Wait()
+
+	// Nothing runs what is left, so refuse new tasks and cancel the rest
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	for task := range queue {
+		p.cancel(task)
+	}
+	return ctx.Err()
+}
+
+// Stop stops accepting tasks and waits for the workers to drain the queue.
+// Tasks still queued when ctx is done are cancelled once the pool's context
+// is, and Stop returns an error saying how many are left.
+func (p *WorkerPool) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	queued := len(p.queue)
+	stopped := p.stopped
+	p.mu.Unlock()
+	if stopped == nil {
+		return nil
+	}
+	if queued > 0 {
+		p.logger.Info("Worker pool %s draining %d queued tasks", p.name, queued)
+	}
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		p.mu.RLock()
+		queued = len(p.queue)
+		p.mu.RUnlock()
+		return fmt.Errorf("worker pool %s still had %d queued tasks: %w", p.name, queued, ctx.Err())
+	}
+}
+
+// cancel counts and logs a task the pool won't run and tells its submitter
+func (p *WorkerPool) cancel(task Task) {
+	p.cancelled.Add(1)
+	p.logger.Warn("Task %s cancelled, worker pool %s stopped", task.Name, p.name)
+	if task.OnCancel != nil {
+		task.OnCancel()
+	}
+}
+
+func (p *WorkerPool) work(ctx context.Context, queue <-chan Task) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task, ok := <-queue:
+			if !ok {
+				return
+			}
+			if ctx.Err() != nil {
+				// Picked up as the pool was cancelled
+				p.cancel(task)
+				return
+			}
+			p.active.Add(1)
+			p.execute(ctx, task)
+			p.active.Add(-1)
+		}
+	}
+}
+
+// execute runs a task, retrying with a linear backoff on failure
+func (p *WorkerPool) execute(ctx context.Context, task Task) {
+	var err error
+	for attempt := 0; attempt <= task.Retries; attempt++ {
+		if attempt > 0 {
+			p.retried.Add(1)
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				p.cancel(task)
+				return
+			}
+		}
+
+		taskCtx, cancel := context.WithTimeout(ctx, task.Timeout)
+		err = callSafely(func() error { return task.Run(taskCtx) })
+		cancel()
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			p.logger.WithFields(panicErr.Fields("task", task.Name)).Error("Task %s panicked: %v", task.Name, panicErr.Value)
+		}
+		if err == nil {
+			p.completed.Add(1)
+			return
+		}
+		p.logger.Warn("Task %s attempt %d/%d failed: %v", task.Name, attempt+1, task.Retries+1, err)
+	}
+
+	p.failed.Add(1)
+	p.logger.Error("Task %s failed: %v", task.Name, err)
+}
@@ -0,0 +1,186 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultClearRatio is the fraction of the threshold a metric has to fall back
+// below before a firing alert resolves, so values hovering around the
+// threshold don't flap
+const defaultClearRatio = 0.9
+
+// AlertRule raises a log entry when a stats metric exceeds a threshold
+type AlertRule struct {
+	Metric    string  // metric name as returned by Stats.Values
+	Threshold float64 // fire when the metric goes above this value
+	Clear     float64 // resolve when the metric drops below this value
+	Level     string  // WARN or ERROR
+}
+
+// Alert is an alert rule or SLO burn rate alert firing or resolving, as
+// handed to the functions registered with OnAlert
+type Alert struct {
+	Name    string // the rule's metric, or the SLO's route and objective
+	Level   string // WARN or ERROR when firing, INFO when resolved
+	Message string
+	Firing  bool
+	Time    time.Time
+}
+
+type alertState struct {
+	rule   AlertRule
+	firing bool
+}
+
+type alerts struct {
+	mu    sync.Mutex
+	rules []*alertState
+}
+
+// ParseAlertRules parses a comma separated list of rules in the form
+// metric>threshold[:level], e.g. "goroutines>5000,heap_alloc>1GB:error".
+// Thresholds accept KB, MB and GB suffixes, and a % suffix for ratios.
+func ParseAlertRules(spec string) ([]AlertRule, error) {
+	var rules []AlertRule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		level := "WARN"
+		if i := strings.LastIndex(part, ":"); i >= 0 {
+			level = strings.ToUpper(strings.TrimSpace(part[i+1:]))
+			part = part[:i]
+		}
+		if level != "WARN" && level != "ERROR" {
+			return nil, fmt.Errorf("invalid alert level %q: must be warn or error", level)
+		}
+
+		metric, value, ok := strings.Cut(part, ">")
+		if !ok {
+			return nil, fmt.Errorf("invalid alert rule %q: expected metric>threshold", part)
+		}
+		threshold, err := parseThreshold(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert rule %q: %w", part, err)
+		}
+
+		rules = append(rules, AlertRule{
+			Metric:    strings.TrimSpace(metric),
+			Threshold: threshold,
+			Clear:     threshold * defaultClearRatio,
+			Level:     level,
+		})
+	}
+	return rules, nil
+}
+
+func parseThreshold(value string) (float64, error) {
+	if strings.HasSuffix(value, "%") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid threshold %q", value)
+		}
+		return v / 100, nil
+	}
+
+	multiplier := 1.0
+	upper := strings.ToUpper(value)
+	for suffix, m := range map[string]float64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(upper, suffix) {
+			multiplier = m
+			value = value[:len(value)-len(suffix)]
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid threshold %q", value)
+	}
+	return v * multiplier, nil
+}
+
+// AddAlertRule registers a rule to be evaluated against every sample
+func (s *StatsService) AddAlertRule(rule AlertRule) {
+	if rule.Clear == 0 {
+		rule.Clear = rule.Threshold * defaultClearRatio
+	}
+	if rule.Level == "" {
+		rule.Level = "WARN"
+	}
+
+	s.alerts.mu.Lock()
+	defer s.alerts.mu.Unlock()
+	s.alerts.rules = append(s.alerts.rules, &alertState{rule: rule})
+}
+
+// OnAlert registers a function called whenever an alert fires or resolves.
+// It is called from the sampling loop, so it mustn't block.
+func (s *StatsService) OnAlert(handler func(Alert)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alertHandlers = append(s.alertHandlers, handler)
+}
+
+// logAlert logs an alert at its level and hands it to the alert handlers
+func (s *StatsService) logAlert(alert Alert) {
+	switch alert.Level {
+	case "ERROR":
+		s.logger.Error("%s", alert.Message)
+	case "WARN":
+		s.logger.Warn("%s", alert.Message)
+	default:
+		s.logger.Info("%s", alert.Message)
+	}
+
+	s.mu.RLock()
+	handlers := s.alertHandlers
+	s.mu.RUnlock()
+	for _, handler := range handlers {
+		handler(alert)
+	}
+}
+
+// evaluateAlerts checks all rules against a sample, logging when an alert
+// fires or resolves
+func (s *StatsService) evaluateAlerts(stats Stats) {
+	s.alerts.mu.Lock()
+	defer s.alerts.mu.Unlock()
+
+	if len(s.alerts.rules) == 0 {
+		return
+	}
+
+	values := stats.Values()
+	for _, state := range s.alerts.rules {
+		value, ok := values[state.rule.Metric]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case !state.firing && value > state.rule.Threshold:
+			state.firing = true
+			s.logAlert(Alert{
+				Name:    state.rule.Metric,
+				Level:   state.rule.Level,
+				Message: fmt.Sprintf("[Alert] %s is %v, above threshold %v", state.rule.Metric, value, state.rule.Threshold),
+				Firing:  true,
+				Time:    stats.Timestamp,
+			})
+		case state.firing && value < state.rule.Clear:
+			state.firing = false
+			s.logAlert(Alert{
+				Name:    state.rule.Metric,
+				Level:   "INFO",
+				Message: fmt.Sprintf("[Alert] %s recovered at %v", state.rule.Metric, value),
+				Time:    stats.Timestamp,
+			})
+		}
+	}
+}
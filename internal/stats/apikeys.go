@@ -0,0 +1,234 @@
+package stats
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// keyUsageDays is how many daily rollups are kept per API key
+const keyUsageDays = 30
+
+// KeyUsageDay rolls up one UTC day of an API key's requests
+type KeyUsageDay struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	requestCounts
+	ErrorRate float64 `json:"error_rate"`
+	// Endpoints counts requests per route, as "METHOD /path/{template}"
+	Endpoints map[string]uint64 `json:"endpoints"`
+}
+
+// KeyUsage is the request history of an API key, oldest day first
+type KeyUsage struct {
+	KeyID string `json:"key_id"`
+	requestCounts
+	ErrorRate float64       `json:"error_rate"`
+	LastUsed  *time.Time    `json:"last_used,omitempty"`
+	Days      []KeyUsageDay `json:"days"`
+}
+
+type keyUsage struct {
+	days     map[string]*KeyUsageDay
+	lastUsed time.Time
+}
+
+// KeyUsageCount counts the requests made with an API key to one route on
+// one UTC day, the unit usage is saved and loaded in
+type KeyUsageCount struct {
+	KeyID string
+	Date  string // YYYY-MM-DD
+	Route string
+	requestCounts
+	LastUsed time.Time
+}
+
+type keyUsageCountID struct {
+	keyID, date, route string
+}
+
+// KeyUsageTracker counts requests made with each API key per day, with the
+// endpoints used and 4xx/5xx responses, for the last 30 days. It keeps the
+// counts not yet saved apart, for a store to take with Unsaved.
+type KeyUsageTracker struct {
+	mu      sync.Mutex
+	keys    map[string]*keyUsage
+	unsaved map[keyUsageCountID]*KeyUsageCount
+	now     func() time.Time
+}
+
+func NewKeyUsageTracker() *KeyUsageTracker {
+	return &KeyUsageTracker{
+		keys:    make(map[string]*keyUsage),
+		unsaved: make(map[keyUsageCountID]*KeyUsageCount),
+		now:     time.Now,
+	}
+}
+
+// Record counts a completed request made with the key identified by keyID
+func (t *KeyUsageTracker) Record(keyID, route string, status int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now().UTC()
+	count := KeyUsageCount{KeyID: keyID, Date: now.Format(time.DateOnly), Route: route, LastUsed: now}
+	count.Requests = 1
+	switch {
+	case status >= 500:
+		count.ServerErrors = 1
+	case status >= 400:
+		count.ClientErrors = 1
+	}
+	t.add(count)
+	t.addUnsaved(count)
+}
+
+// Unsaved returns the counts recorded since the last call, for a store to
+// add to those it keeps; counts it fails to save are handed back with
+// Restore
+func (t *KeyUsageTracker) Unsaved() []KeyUsageCount {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make([]KeyUsageCount, 0, len(t.unsaved))
+	for _, count := range t.unsaved {
+		counts = append(counts, *count)
+	}
+	t.unsaved = make(map[keyUsageCountID]*KeyUsageCount)
+	return counts
+}
+
+// Restore hands back counts from Unsaved that couldn't be saved, to be
+// returned by the next call
+func (t *KeyUsageTracker) Restore(counts []KeyUsageCount) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, count := range counts {
+		t.addUnsaved(count)
+	}
+}
+
+// Load adds counts saved by an earlier run to those recorded, leaving out
+// days older than the 30 kept
+func (t *KeyUsageTracker) Load(counts []KeyUsageCount) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, count := range counts {
+		t.add(count)
+	}
+}
+
+// Oldest is the first day of the usage kept
+func (t *KeyUsageTracker) Oldest() string {
+	return t.now().UTC().AddDate(0, 0, -keyUsageDays+1).Format(time.DateOnly)
+}
+
+// add adds count to its key's day, forgetting days that fell out of the
+// retention
+func (t *KeyUsageTracker) add(count KeyUsageCount) {
+	oldest := t.Oldest()
+	if count.Date < oldest {
+		return
+	}
+	usage, ok := t.keys[count.KeyID]
+	if !ok {
+		usage = &keyUsage{days: make(map[string]*KeyUsageDay)}
+		t.keys[count.KeyID] = usage
+	}
+	if count.LastUsed.After(usage.lastUsed) {
+		usage.lastUsed = count.LastUsed
+	}
+
+	day, ok := usage.days[count.Date]
+	if !ok {
+		day = &KeyUsageDay{Date: count.Date, Endpoints: make(map[string]uint64)}
+		usage.days[count.Date] = day
+		for date := range usage.days {
+			if date < oldest {
+				delete(usage.days, date)
+			}
+		}
+	}
+	day.Requests += count.Requests
+	day.ClientErrors += count.ClientErrors
+	day.ServerErrors += count.ServerErrors
+	day.Endpoints[count.Route] += count.Requests
+}
+
+func (t *KeyUsageTracker) addUnsaved(count KeyUsageCount) {
+	id := keyUsageCountID{keyID: count.KeyID, date: count.Date, route: count.Route}
+	unsaved, ok := t.unsaved[id]
+	if !ok {
+		copied := count
+		t.unsaved[id] = &copied
+		return
+	}
+	unsaved.Requests += count.Requests
+	unsaved.ClientErrors += count.ClientErrors
+	unsaved.ServerErrors += count.ServerErrors
+	if count.LastUsed.After(unsaved.LastUsed) {
+		unsaved.LastUsed = count.LastUsed
+	}
+}
+
+// Usage returns the daily rollups of the key identified by keyID. Keys that
+// haven't been used have no days.
+func (t *KeyUsageTracker) Usage(keyID string) KeyUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := KeyUsage{KeyID: keyID, Days: []KeyUsageDay{}}
+	usage, ok := t.keys[keyID]
+	if !ok {
+		return result
+	}
+	lastUsed := usage.lastUsed
+	result.LastUsed = &lastUsed
+	oldest := t.Oldest()
+	for _, day := range usage.days {
+		if day.Date < oldest {
+			continue
+		}
+		copied := *day
+		copied.Endpoints = make(map[string]uint64, len(day.Endpoints))
+		for route, n := range day.Endpoints {
+			copied.Endpoints[route] = n
+		}
+		copied.ErrorRate = errorRate(day.requestCounts)
+		result.Days = append(result.Days, copied)
+
+		result.Requests += day.Requests
+		result.ClientErrors += day.ClientErrors
+		result.ServerErrors += day.ServerErrors
+	}
+	sort.Slice(result.Days, func(i, j int) bool { return result.Days[i].Date < result.Days[j].Date })
+	result.ErrorRate = errorRate(result.requestCounts)
+	return result
+}
+
+func errorRate(counts requestCounts) float64 {
+	if counts.Requests == 0 {
+		return 0
+	}
+	return float64(counts.ClientErrors+counts.ServerErrors) / float64(counts.Requests)
+}
+
+// Collect reports each key's requests, errors and error rate so far today,
+// as <key id>.requests and so on
+func (t *KeyUsageTracker) Collect(ctx context.Context) (map[string]float64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	today := t.now().UTC().Format(time.DateOnly)
+	values := make(map[string]float64)
+	for keyID, usage := range t.keys {
+		var counts requestCounts
+		if day, ok := usage.days[today]; ok {
+			counts = day.requestCounts
+		}
+		values[keyID+".requests"] = float64(counts.Requests)
+		values[keyID+".client_errors"] = float64(counts.ClientErrors)
+		values[keyID+".server_errors"] = float64(counts.ServerErrors)
+		values[keyID+".error_rate"] = errorRate(counts)
+	}
+	return values, nil
+}
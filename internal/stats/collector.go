@@ -4,60 +4,232 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"exampleserver/internal/version"
 	"exampleserver/pkg/logger"
 )
 
 type Stats struct {
 	Timestamp    time.Time
+	Uptime       time.Duration
+	Build        version.Info
 	NumGoroutine int
 	MemStats     runtime.MemStats
+	RSS          uint64 // resident set size in bytes, 0 where unknown
+	Runtime      RuntimeStats
+	Latency      map[string]LatencySummary // request latency per route over the last interval
+	// Durations are the request durations per route since startup
+	Durations map[string]DurationHistogram
+	Metrics   map[string]float64 // values from registered collectors
+	// Counters names the values of Metrics that only grow
+	Counters map[string]bool
+	// Histograms are the histograms of registered collectors, such as
+	// those made with NewHistogram, since startup
+	Histograms map[string]HistogramSnapshot
+}
+
+// cumulativeValues are the values of every sample that only grow
+var cumulativeValues = map[string]bool{"total_alloc": true, "num_gc": true}
+
+// Counter reports whether the value name only grows, like a count of
+// events since startup, rather than going up and down
+func (s Stats) Counter(name string) bool {
+	return cumulativeValues[name] || s.Counters[name]
+}
+
+// Values returns the sample as named metrics, including those from
+// registered collectors
+func (s Stats) Values() map[string]float64 {
+	values := map[string]float64{
+		"uptime_seconds":             s.Uptime.Seconds(),
+		"process_start_time_seconds": float64(s.Build.StartTime.Unix()),
+
+		"goroutines":  float64(s.NumGoroutine),
+		"rss":         float64(s.RSS),
+		"heap_alloc":  float64(s.MemStats.HeapAlloc),
+		"heap_inuse":  float64(s.MemStats.HeapInuse),
+		"total_alloc": float64(s.MemStats.TotalAlloc),
+		"sys":         float64(s.MemStats.Sys),
+		"num_gc":      float64(s.MemStats.NumGC),
+
+		"gc_pause_p50_seconds":      s.Runtime.GCPauseP50.Seconds(),
+		"gc_pause_p99_seconds":      s.Runtime.GCPauseP99.Seconds(),
+		"gc_pause_max_seconds":      s.Runtime.GCPauseMax.Seconds(),
+		"gc_cpu_fraction":           s.Runtime.GCCPUFraction,
+		"sched_latency_p50_seconds": s.Runtime.SchedLatencyP50.Seconds(),
+		"sched_latency_p99_seconds": s.Runtime.SchedLatencyP99.Seconds(),
+	}
+	for name, value := range s.Metrics {
+		values[name] = value
+	}
+	return values
 }
 
 type StatsService struct {
-	interval time.Duration
-	stats    chan Stats
-	logger   logger.LoggerInterface
+	mu              sync.RWMutex
+	interval        time.Duration
+	intervalChanged chan struct{} // signals the loop to reread interval
+	subscribers     *subscribers
+	alerts          alerts
+	alertHandlers   []func(Alert)
+	registry        *registry
+	runtime         *runtimeSampler
+	requests        *RequestTracker
+	slos            *SLOTracker
+	keys            *KeyUsageTracker
+	watchdog        *goroutineWatchdog
+	memory          *memoryWatchdog
+	latest          *Stats
+	history         []snapshot // earlier samples to compare against, oldest first
+	cancel          context.CancelFunc
+	done            chan struct{}
+	logger          logger.LoggerInterface
 }
 
 func NewStatsService(interval time.Duration, logger logger.LoggerInterface) *StatsService {
-	return &StatsService{
-		interval: interval,
-		stats:    make(chan Stats, 100),
-		logger:   logger,
+	s := &StatsService{
+		interval:        interval,
+		intervalChanged: make(chan struct{}, 1),
+		subscribers:     newSubscribers(),
+		registry:        newRegistry(),
+		runtime:         newRuntimeSampler(),
+		requests:        NewRequestTracker(),
+		slos:            NewSLOTracker(),
+		keys:            NewKeyUsageTracker(),
+		logger:          logger,
 	}
+
+	// Application metrics ride along with every sample
+	s.registry.collectors["app"] = appMetrics
+	s.registry.collectors["requests"] = s.requests
+	s.registry.collectors["apikeys"] = s.keys
+
+	return s
+}
+
+// Latest returns the most recent sample, if one has been taken
+func (s *StatsService) Latest() (Stats, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.latest == nil {
+		return Stats{}, false
+	}
+	return *s.latest, true
+}
+
+// Requests returns the tracker recording per-route request outcomes
+func (s *StatsService) Requests() *RequestTracker {
+	return s.requests
+}
+
+// SLOs returns the tracker of the routes' service level objectives
+func (s *StatsService) SLOs() *SLOTracker {
+	return s.slos
+}
+
+// KeyUsage returns the tracker recording requests per API key
+func (s *StatsService) KeyUsage() *KeyUsageTracker {
+	return s.keys
+}
+
+// Name identifies the service to the service manager
+func (s *StatsService) Name() string {
+	return "stats"
 }
 
 func (s *StatsService) Start(ctx context.Context) error {
-	ticker := time.NewTicker(s.interval)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer close(done)
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.done = done
+	s.mu.Unlock()
+	defer cancel()
+	s.openSubscribers()
+
+	ticker := time.NewTicker(s.Interval())
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			close(s.stats)
+			s.closeSubscribers()
 			return ctx.Err()
+		case <-s.intervalChanged:
+			interval := s.Interval()
+			ticker.Reset(interval)
+			s.logger.Info("[Stats] Collection interval set to %s", interval)
 		case <-ticker.C:
-			stats := Stats{
-				Timestamp:    time.Now(),
-				NumGoroutine: runtime.NumGoroutine(),
-			}
-			runtime.ReadMemStats(&stats.MemStats)
+			stats := s.collect(ctx)
 
 			// Log the stats
 			s.logStats(stats)
 
-			// Try to send stats, but don't block if channel is full
-			select {
-			case s.stats <- stats:
-			default:
-				s.logger.Error("stats channel full, dropping metrics")
-			}
+			// Check alert rules and watchdogs
+			s.evaluateAlerts(stats)
+			s.evaluateSLOs()
+			s.checkGoroutines(stats)
+			s.checkMemory(stats)
+
+			// Keep the sample for the stats endpoints, and its runtime
+			// values for comparisons, and fan it out to subscribers
+			s.mu.Lock()
+			s.latest = &stats
+			s.remember(stats)
+			s.mu.Unlock()
+			s.publish(stats)
 		}
 	}
 }
 
+// Stop ends collection and waits for Start to return
+func (s *StatsService) Stop(ctx context.Context) error {
+	s.mu.RLock()
+	cancel, done := s.cancel, s.done
+	s.mu.RUnlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		s.logger.Info("[Stats] Collection stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// collect takes a single sample of runtime and collector metrics
+func (s *StatsService) collect(ctx context.Context) Stats {
+	stats := Stats{
+		Timestamp:    time.Now(),
+		Uptime:       version.Uptime(),
+		Build:        version.Get(),
+		NumGoroutine: runtime.NumGoroutine(),
+	}
+	runtime.ReadMemStats(&stats.MemStats)
+	stats.RSS = readRSS()
+	stats.Runtime.GCCPUFraction = stats.MemStats.GCCPUFraction
+	s.runtime.read(&stats.Runtime)
+	stats.Latency = s.requests.rotateLatency()
+	stats.Durations = s.requests.Durations()
+
+	// Registered collectors get until the next tick to report
+	collectCtx, cancel := context.WithTimeout(ctx, s.Interval())
+	defer cancel()
+	stats.Metrics, stats.Counters, stats.Histograms = s.runCollectors(collectCtx)
+
+	return stats
+}
+
 func (s *StatsService) logStats(stats Stats) {
 	memStats := stats.MemStats
 	s.logger.Info(
@@ -69,6 +241,29 @@ func (s *StatsService) logStats(stats Stats) {
 		s.formatBytes(memStats.Sys),
 		memStats.NumGC,
 	)
+	s.logger.Info(
+		"[Stats] GC: {PauseP50: %s, PauseP99: %s, PauseMax: %s, CPUFraction: %.4f}, Scheduler: {LatencyP50: %s, LatencyP99: %s}",
+		stats.Runtime.GCPauseP50,
+		stats.Runtime.GCPauseP99,
+		stats.Runtime.GCPauseMax,
+		stats.Runtime.GCCPUFraction,
+		stats.Runtime.SchedLatencyP50,
+		stats.Runtime.SchedLatencyP99,
+	)
+
+	if len(stats.Metrics) == 0 {
+		return
+	}
+	names := make([]string, 0, len(stats.Metrics))
+	for name := range stats.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %v", name, stats.Metrics[name]))
+	}
+	s.logger.Info("[Stats] Collectors: {%s}", strings.Join(parts, ", "))
 }
 
 func (s *StatsService) formatBytes(bytes uint64) string {
@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ConnTracker counts http.Server connections by state. Assign its ConnState
+// method to http.Server.ConnState and register it as a collector.
+type ConnTracker struct {
+	mu     sync.Mutex
+	states map[net.Conn]http.ConnState
+	total  uint64
+}
+
+func NewConnTracker() *ConnTracker {
+	return &ConnTracker{
+		states: make(map[net.Conn]http.ConnState),
+	}
+}
+
+// ConnState is an http.Server.ConnState hook
+func (t *ConnTracker) ConnState(conn net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch state {
+	case http.StateNew:
+		t.total++
+		t.states[conn] = state
+	case http.StateClosed, http.StateHijacked:
+		delete(t.states, conn)
+	default:
+		t.states[conn] = state
+	}
+}
+
+// Open returns the number of connections not yet closed
+func (t *ConnTracker) Open() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.states)
+}
+
+func (t *ConnTracker) Collect(ctx context.Context) (map[string]float64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	values := map[string]float64{
+		"conns_new":    0,
+		"conns_active": 0,
+		"conns_idle":   0,
+		"conns_open":   float64(len(t.states)),
+		"conns_total":  float64(t.total),
+	}
+	for _, state := range t.states {
+		values["conns_"+state.String()]++
+	}
+	return values, nil
+}
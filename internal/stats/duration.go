@@ -0,0 +1,39 @@
+package stats
+
+import (
+	"sort"
+	"time"
+)
+
+// RequestDurationBuckets are the upper bounds, in seconds, of the request
+// duration histogram buckets exported to Prometheus: Prometheus' defaults,
+// from 5ms to 10s
+var RequestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DurationHistogram counts the requests of a route by duration since the
+// route was first seen. Unlike LatencySummary it is never reset, so
+// Prometheus can compute rates and quantiles over any range from it.
+type DurationHistogram struct {
+	// Buckets counts the requests that took at most the bound of
+	// RequestDurationBuckets at the same index, cumulatively
+	Buckets []uint64
+	Count   uint64
+	Sum     time.Duration
+}
+
+func newDurationHistogram() *DurationHistogram {
+	return &DurationHistogram{Buckets: make([]uint64, len(RequestDurationBuckets))}
+}
+
+func (h *DurationHistogram) record(duration time.Duration) {
+	seconds := duration.Seconds()
+	for i := sort.SearchFloat64s(RequestDurationBuckets, seconds); i < len(h.Buckets); i++ {
+		h.Buckets[i]++
+	}
+	h.Count++
+	h.Sum += duration
+}
+
+func (h *DurationHistogram) copy() DurationHistogram {
+	return DurationHistogram{Buckets: append([]uint64(nil), h.Buckets...), Count: h.Count, Sum: h.Sum}
+}
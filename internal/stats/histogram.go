@@ -0,0 +1,125 @@
+package stats
+
+import (
+	"math/bits"
+	"time"
+)
+
+const (
+	// latencySubBuckets is the number of linear sub-buckets per power of two,
+	// giving roughly 6% relative error on recorded values
+	latencySubBuckets = 16
+	// latencyMaxShift caps recorded values at about 2^36µs (19 hours)
+	latencyMaxShift = 31
+	latencyBuckets  = (latencyMaxShift + 2) * latencySubBuckets
+)
+
+// LatencyHistogram is an HDR-style log-linear histogram of durations with
+// microsecond resolution. It is not safe for concurrent use.
+type LatencyHistogram struct {
+	counts [latencyBuckets]uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// LatencySummary holds the percentiles of a latency histogram
+type LatencySummary struct {
+	Count uint64        `json:"count"`
+	Sum   time.Duration `json:"sum"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// Record adds a single duration to the histogram
+func (h *LatencyHistogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[latencyIndex(uint64(d/time.Microsecond))]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Merge adds all values recorded in other to h
+func (h *LatencyHistogram) Merge(other *LatencyHistogram) {
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.count += other.count
+	h.sum += other.sum
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// Quantile returns the value below which the fraction q of recorded
+// durations fall. The result is the upper bound of the matching bucket.
+func (h *LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	target := uint64(q * float64(h.count))
+	if target < 1 {
+		target = 1
+	}
+	var cumulative uint64
+	for i, c := range h.counts {
+		cumulative += c
+		if cumulative >= target {
+			upper := time.Duration(latencyUpperBound(i)) * time.Microsecond
+			if upper > h.max {
+				return h.max
+			}
+			return upper
+		}
+	}
+	return h.max
+}
+
+// Summary returns the count, mean and main percentiles
+func (h *LatencyHistogram) Summary() LatencySummary {
+	summary := LatencySummary{
+		Count: h.count,
+		Sum:   h.sum,
+		P50:   h.Quantile(0.5),
+		P90:   h.Quantile(0.9),
+		P99:   h.Quantile(0.99),
+		Max:   h.max,
+	}
+	if h.count > 0 {
+		summary.Mean = h.sum / time.Duration(h.count)
+	}
+	return summary
+}
+
+// latencyIndex maps a value to its bucket. Values below latencySubBuckets*2
+// get a bucket each; above that every power of two is split into
+// latencySubBuckets linear buckets.
+func latencyIndex(v uint64) int {
+	if v < 2*latencySubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - 5
+	if shift > latencyMaxShift {
+		return latencyBuckets - 1
+	}
+	return (shift+1)*latencySubBuckets + int(v>>shift) - latencySubBuckets
+}
+
+// latencyUpperBound returns the largest value that maps to bucket i
+func latencyUpperBound(i int) uint64 {
+	if i < 2*latencySubBuckets {
+		return uint64(i)
+	}
+	shift := i/latencySubBuckets - 1
+	mantissa := uint64(i%latencySubBuckets + latencySubBuckets)
+	return (mantissa+1)<<shift - 1
+}
@@ -0,0 +1,108 @@
+package stats
+
+import "time"
+
+const (
+	// historyRetention is how far back samples can be compared against
+	historyRetention = 24 * time.Hour
+	// historySize caps the samples kept, which at short intervals cover
+	// less than historyRetention
+	historySize = 1440
+)
+
+// snapshot is the part of a sample kept to compare later ones against
+type snapshot struct {
+	at     time.Time
+	values map[string]float64
+}
+
+// MetricDelta is how a metric changed between two samples
+type MetricDelta struct {
+	From   float64 `json:"from"`
+	To     float64 `json:"to"`
+	Change float64 `json:"change"`
+	// PerMinute is the change averaged over the time between the samples
+	PerMinute float64 `json:"per_minute"`
+}
+
+// StatsDiff compares the latest sample with an earlier one
+type StatsDiff struct {
+	From    time.Time              `json:"from"`
+	To      time.Time              `json:"to"`
+	Elapsed string                 `json:"elapsed"`
+	Metrics map[string]MetricDelta `json:"metrics"`
+}
+
+// takeSnapshot keeps the runtime values that tell whether memory,
+// goroutines or GC activity are growing
+func takeSnapshot(stats Stats) snapshot {
+	m := stats.MemStats
+	return snapshot{
+		at: stats.Timestamp,
+		values: map[string]float64{
+			"goroutines":             float64(stats.NumGoroutine),
+			"rss":                    float64(stats.RSS),
+			"heap_alloc":             float64(m.HeapAlloc),
+			"heap_inuse":             float64(m.HeapInuse),
+			"heap_objects":           float64(m.HeapObjects),
+			"sys":                    float64(m.Sys),
+			"total_alloc":            float64(m.TotalAlloc),
+			"num_gc":                 float64(m.NumGC),
+			"gc_pause_total_seconds": time.Duration(m.PauseTotalNs).Seconds(),
+		},
+	}
+}
+
+// remember adds a sample to the history, forgetting those too old to be
+// compared against; s.mu must be held
+func (s *StatsService) remember(stats Stats) {
+	s.history = append(s.history, takeSnapshot(stats))
+	drop := 0
+	if len(s.history) > historySize {
+		drop = len(s.history) - historySize
+	}
+	for drop < len(s.history)-1 && stats.Timestamp.Sub(s.history[drop].at) > historyRetention {
+		drop++
+	}
+	s.history = s.history[drop:]
+}
+
+// Diff compares the latest sample with the newest one taken at least ago
+// before it. It returns false when no sample is that old yet, along with
+// how far back the samples kept go.
+func (s *StatsService) Diff(ago time.Duration) (StatsDiff, time.Duration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.history) == 0 {
+		return StatsDiff{}, 0, false
+	}
+
+	latest := s.history[len(s.history)-1]
+	kept := latest.at.Sub(s.history[0].at)
+	var from *snapshot
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if latest.at.Sub(s.history[i].at) >= ago {
+			from = &s.history[i]
+			break
+		}
+	}
+	if from == nil {
+		return StatsDiff{}, kept, false
+	}
+
+	elapsed := latest.at.Sub(from.at)
+	diff := StatsDiff{
+		From:    from.at,
+		To:      latest.at,
+		Elapsed: elapsed.Round(time.Second).String(),
+		Metrics: make(map[string]MetricDelta, len(latest.values)),
+	}
+	for name, to := range latest.values {
+		delta := MetricDelta{From: from.values[name], To: to, Change: to - from.values[name]}
+		if elapsed > 0 {
+			delta.PerMinute = delta.Change / elapsed.Minutes()
+		}
+		diff.Metrics[name] = delta
+	}
+	return diff, kept, true
+}
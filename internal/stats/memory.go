@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var memoryActions = NewCounter("memory_actions")
+
+// MemoryAction is a protective action the memory watchdog takes while the
+// process is over its memory limits
+type MemoryAction struct {
+	Name string
+	Run  func() error
+	// Undo, when set, reverts the action once memory is back under the
+	// limits
+	Undo func()
+}
+
+// memoryWatchdog takes protective actions, one per interval and in order,
+// while RSS or the heap is over its limit, rather than waiting to be
+// OOM-killed mid-request
+type memoryWatchdog struct {
+	rssLimit  uint64 // bytes, 0 for none
+	heapLimit uint64
+	actions   []MemoryAction
+	taken     int // actions taken since memory went over the limits
+}
+
+// WatchMemory enables the memory watchdog with limits in bytes; a zero
+// limit is not checked. Each interval over a limit takes the next of the
+// actions, and those taken are undone once memory is back under the limits.
+func (s *StatsService) WatchMemory(rssLimit, heapLimit uint64, actions []MemoryAction) {
+	if (rssLimit == 0 && heapLimit == 0) || len(actions) == 0 {
+		s.memory = nil
+		return
+	}
+	s.memory = &memoryWatchdog{
+		rssLimit:  rssLimit,
+		heapLimit: heapLimit,
+		actions:   actions,
+	}
+}
+
+// checkMemory feeds a sample to the memory watchdog
+func (s *StatsService) checkMemory(stats Stats) {
+	w := s.memory
+	if w == nil {
+		return
+	}
+
+	var over string
+	switch {
+	case w.rssLimit > 0 && stats.RSS > w.rssLimit:
+		over = fmt.Sprintf("RSS %s over the limit of %s", s.formatBytes(stats.RSS), s.formatBytes(w.rssLimit))
+	case w.heapLimit > 0 && stats.MemStats.HeapAlloc > w.heapLimit:
+		over = fmt.Sprintf("heap %s over the limit of %s", s.formatBytes(stats.MemStats.HeapAlloc), s.formatBytes(w.heapLimit))
+	}
+
+	if over == "" {
+		if w.taken == 0 {
+			return
+		}
+		s.logger.Info("[Stats] Memory back under its limits, undoing protective actions")
+		for i := w.taken - 1; i >= 0; i-- {
+			if undo := w.actions[i].Undo; undo != nil {
+				undo()
+			}
+		}
+		w.taken = 0
+		return
+	}
+
+	if w.taken == len(w.actions) {
+		return
+	}
+	action := w.actions[w.taken]
+	w.taken++
+	memoryActions.Inc()
+	s.logger.Warn("[Stats] Memory watchdog: %s, taking action %s", over, action.Name)
+	if err := action.Run(); err != nil {
+		s.logger.Error("[Stats] Memory watchdog action %s failed: %v", action.Name, err)
+	}
+}
+
+// readRSS returns the resident set size of the process from /proc, or zero
+// on other platforms
+func readRSS() uint64 {
+	if runtime.GOOS != "linux" {
+		return 0
+	}
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * uint64(os.Getpagesize())
+}
@@ -0,0 +1,238 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// appMetrics holds the application metrics registered via NewCounter,
+// NewGauge and NewHistogram. It's reported by every StatsService as the "app"
+// collector.
+var appMetrics = &metricSet{metrics: make(map[string]metric)}
+
+type metric interface {
+	collect(name string, values map[string]float64)
+}
+
+type metricSet struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// register returns the metric already registered under name, or stores and
+// returns m. It panics if name is in use by a metric of another type.
+func (m *metricSet) register(name string, create func() metric) metric {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.metrics[name]
+	if !ok {
+		existing = create()
+		m.metrics[name] = existing
+		return existing
+	}
+	if fmt.Sprintf("%T", existing) != fmt.Sprintf("%T", create()) {
+		panic(fmt.Sprintf("stats: metric %q already registered as a different type", name))
+	}
+	return existing
+}
+
+func (m *metricSet) Collect(ctx context.Context) (map[string]float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	values := make(map[string]float64)
+	for name, metric := range m.metrics {
+		metric.collect(name, values)
+	}
+	return values, nil
+}
+
+// Counters names the registered counters
+func (m *metricSet) Counters() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for name, metric := range m.metrics {
+		if _, ok := metric.(*Counter); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Histograms returns a snapshot of every registered histogram
+func (m *metricSet) Histograms() map[string]HistogramSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	histograms := make(map[string]HistogramSnapshot)
+	for name, metric := range m.metrics {
+		if h, ok := metric.(*Histogram); ok {
+			histograms[name] = h.Snapshot()
+		}
+	}
+	return histograms
+}
+
+// Counter is a monotonically increasing application metric
+type Counter struct {
+	value atomic.Uint64
+}
+
+// NewCounter returns the counter registered under name, creating it if needed
+func NewCounter(name string) *Counter {
+	return appMetrics.register(name, func() metric { return &Counter{} }).(*Counter)
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+// Value returns the current count
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+func (c *Counter) collect(name string, values map[string]float64) {
+	values[name] = float64(c.Value())
+}
+
+// Gauge is an application metric that can go up and down
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// NewGauge returns the gauge registered under name, creating it if needed
+func NewGauge(name string) *Gauge {
+	return appMetrics.register(name, func() metric { return &Gauge{} }).(*Gauge)
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Add adds delta (which may be negative) to the gauge
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Value returns the current gauge value
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func (g *Gauge) collect(name string, values map[string]float64) {
+	values[name] = g.Value()
+}
+
+// DefaultBuckets are the bucket upper bounds of a histogram made without
+// any: Prometheus' defaults, suited to durations in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observed values into buckets since startup, for
+// Prometheus, and summarizes those of each stats interval
+type Histogram struct {
+	mu      sync.Mutex
+	bounds  []float64
+	buckets []uint64 // cumulative, per bound
+	count   uint64
+	sum     float64
+
+	// The current interval
+	intervalCount uint64
+	intervalSum   float64
+	min           float64
+	max           float64
+}
+
+// HistogramSnapshot is a histogram's buckets, count and sum since startup
+type HistogramSnapshot struct {
+	// Bounds are the upper bounds of the buckets, ascending
+	Bounds []float64
+	// Buckets counts the values of at most the bound at the same index,
+	// cumulatively
+	Buckets []uint64
+	Count   uint64
+	Sum     float64
+}
+
+// NewHistogram returns the histogram registered under name, creating it if
+// needed with the given bucket upper bounds, or DefaultBuckets if there are
+// none. The bounds of a histogram already registered are kept.
+func NewHistogram(name string, buckets ...float64) *Histogram {
+	return appMetrics.register(name, func() metric {
+		bounds := DefaultBuckets
+		if len(buckets) > 0 {
+			bounds = append([]float64(nil), buckets...)
+			sort.Float64s(bounds)
+		}
+		return &Histogram{bounds: bounds, buckets: make([]uint64, len(bounds))}
+	}).(*Histogram)
+}
+
+// Observe records a single value
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := sort.SearchFloat64s(h.bounds, v); i < len(h.buckets); i++ {
+		h.buckets[i]++
+	}
+	h.count++
+	h.sum += v
+
+	if h.intervalCount == 0 || v < h.min {
+		h.min = v
+	}
+	if h.intervalCount == 0 || v > h.max {
+		h.max = v
+	}
+	h.intervalCount++
+	h.intervalSum += v
+}
+
+// Snapshot returns the histogram's buckets, count and sum
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return HistogramSnapshot{
+		Bounds:  h.bounds,
+		Buckets: append([]uint64(nil), h.buckets...),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+}
+
+// collect reports the interval's mean, min and max and resets them for the
+// next interval. The count and sum since startup are exported with the
+// buckets, see Histograms.
+func (h *Histogram) collect(name string, values map[string]float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.intervalCount > 0 {
+		values[name+".mean"] = h.intervalSum / float64(h.intervalCount)
+		values[name+".min"] = h.min
+		values[name+".max"] = h.max
+	}
+	h.intervalCount, h.intervalSum, h.min, h.max = 0, 0, 0, 0
+}
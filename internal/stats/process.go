@@ -0,0 +1,81 @@
+package stats
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ProcessCollector reports open file descriptors and TCP connections of the
+// current process. It reads /proc and reports nothing on other platforms.
+type ProcessCollector struct{}
+
+func NewProcessCollector() *ProcessCollector {
+	return &ProcessCollector{}
+}
+
+func (p *ProcessCollector) Collect(ctx context.Context) (map[string]float64, error) {
+	if runtime.GOOS != "linux" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return nil, err
+	}
+
+	// Socket descriptors link to "socket:[inode]"
+	sockets := make(map[string]bool)
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join("/proc/self/fd", entry.Name()))
+		if err != nil {
+			continue // closed since ReadDir
+		}
+		if strings.HasPrefix(target, "socket:[") {
+			sockets[strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")] = true
+		}
+	}
+
+	established, listening := 0, 0
+	for _, table := range []string{"/proc/self/net/tcp", "/proc/self/net/tcp6"} {
+		e, l := countTCP(table, sockets)
+		established += e
+		listening += l
+	}
+
+	return map[string]float64{
+		"open_fds":        float64(len(entries)),
+		"open_sockets":    float64(len(sockets)),
+		"tcp_established": float64(established),
+		"tcp_listen":      float64(listening),
+	}, nil
+}
+
+// countTCP counts established and listening connections in a /proc/net/tcp
+// table that belong to one of the given socket inodes
+func countTCP(path string, inodes map[string]bool) (established, listening int) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // skip header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || !inodes[fields[9]] {
+			continue
+		}
+		switch fields[3] {
+		case "01":
+			established++
+		case "0A":
+			listening++
+		}
+	}
+	return established, listening
+}
@@ -0,0 +1,112 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// metricPrefix namespaces all exported metric names
+const metricPrefix = "exampleserver_"
+
+// WritePrometheus writes a sample in the Prometheus text exposition format.
+// Every value from Stats.Values becomes a counter if it only grows and a
+// gauge otherwise, build metadata is exported as labels of a build_info
+// gauge, request durations are written as a histogram per route and
+// collectors' histograms as histograms, all with cumulative buckets, and the
+// latency percentiles of the last interval as
+// gauges.
+func WritePrometheus(w io.Writer, stats Stats) error {
+	bw := bufio.NewWriter(w)
+
+	values := stats.Values()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		metric := metricPrefix + sanitizeMetricName(name)
+		kind := "gauge"
+		if stats.Counter(name) {
+			kind = "counter"
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n%s %v\n", metric, kind, metric, values[name])
+	}
+
+	build := metricPrefix + "build_info"
+	fmt.Fprintf(bw, "# TYPE %s gauge\n%s{version=%q,commit=%q,build_date=%q,go_version=%q} 1\n",
+		build, build, stats.Build.Version, stats.Build.Commit, stats.Build.BuildDate, stats.Build.GoVersion)
+
+	routes := make([]string, 0, len(stats.Durations))
+	for route := range stats.Durations {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	if len(routes) > 0 {
+		metric := metricPrefix + "http_request_duration_seconds"
+		fmt.Fprintf(bw, "# TYPE %s histogram\n", metric)
+		for _, route := range routes {
+			hist := stats.Durations[route]
+			label := fmt.Sprintf("route=%q", route)
+			for i, bound := range RequestDurationBuckets {
+				fmt.Fprintf(bw, "%s_bucket{%s,le=\"%v\"} %d\n", metric, label, bound, hist.Buckets[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket{%s,le=\"+Inf\"} %d\n", metric, label, hist.Count)
+			fmt.Fprintf(bw, "%s_sum{%s} %v\n", metric, label, hist.Sum.Seconds())
+			fmt.Fprintf(bw, "%s_count{%s} %d\n", metric, label, hist.Count)
+		}
+	}
+
+	names = names[:0]
+	for name := range stats.Histograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hist := stats.Histograms[name]
+		metric := metricPrefix + sanitizeMetricName(name)
+		fmt.Fprintf(bw, "# TYPE %s histogram\n", metric)
+		for i, bound := range hist.Bounds {
+			fmt.Fprintf(bw, "%s_bucket{le=\"%v\"} %d\n", metric, bound, hist.Buckets[i])
+		}
+		fmt.Fprintf(bw, "%s_bucket{le=\"+Inf\"} %d\n", metric, hist.Count)
+		fmt.Fprintf(bw, "%s_sum %v\n", metric, hist.Sum)
+		fmt.Fprintf(bw, "%s_count %d\n", metric, hist.Count)
+	}
+
+	routes = routes[:0]
+	for route := range stats.Latency {
+		if route != AllRoutes {
+			routes = append(routes, route)
+		}
+	}
+	sort.Strings(routes)
+	if len(routes) > 0 {
+		metric := metricPrefix + "http_request_interval_latency_seconds"
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", metric)
+		for _, route := range routes {
+			summary := stats.Latency[route]
+			label := fmt.Sprintf("route=%q", route)
+			fmt.Fprintf(bw, "%s{%s,quantile=\"0.5\"} %v\n", metric, label, summary.P50.Seconds())
+			fmt.Fprintf(bw, "%s{%s,quantile=\"0.9\"} %v\n", metric, label, summary.P90.Seconds())
+			fmt.Fprintf(bw, "%s{%s,quantile=\"0.99\"} %v\n", metric, label, summary.P99.Seconds())
+		}
+	}
+
+	return bw.Flush()
+}
+
+// sanitizeMetricName maps a stats value name to a valid Prometheus name
+func sanitizeMetricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
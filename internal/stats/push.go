@@ -0,0 +1,124 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"exampleserver/pkg/logger"
+)
+
+// pushTimeout bounds a single push so a slow gateway can't hold up the next
+const pushTimeout = 10 * time.Second
+
+var metricsPushFailed = NewCounter("metrics_push_failed")
+
+// Pusher is a service pushing every stats sample to a Prometheus
+// Pushgateway, for deployments that are too short-lived or firewalled to be
+// scraped. Each push replaces the metrics of the group job/instance.
+type Pusher struct {
+	service *StatsService
+	url     string
+	client  *http.Client
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	logger logger.LoggerInterface
+}
+
+// NewPusher creates a pusher of service's samples to the Pushgateway at
+// gatewayURL, grouped under job and instance
+func NewPusher(service *StatsService, gatewayURL, job, instance string, logger logger.LoggerInterface) *Pusher {
+	return &Pusher{
+		service: service,
+		url:     strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job) + "/instance/" + url.PathEscape(instance),
+		client:  &http.Client{Timeout: pushTimeout},
+		logger:  logger,
+	}
+}
+
+// Name identifies the service to the service manager
+func (p *Pusher) Name() string {
+	return "stats-push"
+}
+
+// Start pushes each sample as it is taken until ctx is cancelled, Stop is
+// called or the stats service stops
+func (p *Pusher) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	defer close(done)
+
+	p.mu.Lock()
+	p.cancel = cancel
+	p.done = done
+	p.mu.Unlock()
+	defer cancel()
+
+	samples := p.service.Subscribe()
+	defer p.service.Unsubscribe(samples)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sample, ok := <-samples:
+			if !ok {
+				return nil
+			}
+			if err := p.push(ctx, sample); err != nil && ctx.Err() == nil {
+				metricsPushFailed.Inc()
+				p.logger.Error("[Stats] Failed to push metrics to %s: %v", p.url, err)
+			}
+		}
+	}
+}
+
+// Stop ends pushing. The gateway keeps the last sample pushed.
+func (p *Pusher) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// push sends a sample in the same format /metrics serves
+func (p *Pusher) push(ctx context.Context, sample Stats) error {
+	var body bytes.Buffer
+	if err := WritePrometheus(&body, sample); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Collector gathers a set of named metrics on every stats interval
+type Collector interface {
+	Collect(ctx context.Context) (map[string]float64, error)
+}
+
+// CounterCollector is implemented by collectors some of whose values only
+// grow, so they are exported as Prometheus counters rather than gauges
+type CounterCollector interface {
+	Collector
+	// Counters names those values, as keys of what Collect returns
+	Counters() []string
+}
+
+// HistogramCollector is implemented by collectors that also keep
+// histograms, exported to Prometheus with their buckets
+type HistogramCollector interface {
+	Collector
+	// Histograms returns a snapshot of each histogram by name
+	Histograms() map[string]HistogramSnapshot
+}
+
+// CollectorFunc adapts an ordinary function to the Collector interface
+type CollectorFunc func(ctx context.Context) (map[string]float64, error)
+
+func (f CollectorFunc) Collect(ctx context.Context) (map[string]float64, error) {
+	return f(ctx)
+}
+
+type registry struct {
+	mu         sync.RWMutex
+	collectors map[string]Collector
+	disabled   map[string]bool
+}
+
+func newRegistry() *registry {
+	return &registry{
+		collectors: make(map[string]Collector),
+		disabled:   make(map[string]bool),
+	}
+}
+
+// RegisterCollector adds a collector whose metrics are included in every
+// sample, prefixed with the collector name (e.g. "queue.depth")
+func (s *StatsService) RegisterCollector(name string, collector Collector) error {
+	s.registry.mu.Lock()
+	defer s.registry.mu.Unlock()
+
+	if _, exists := s.registry.collectors[name]; exists {
+		return fmt.Errorf("collector %q already registered", name)
+	}
+	s.registry.collectors[name] = collector
+	return nil
+}
+
+// UnregisterCollector removes a previously registered collector
+func (s *StatsService) UnregisterCollector(name string) {
+	s.registry.mu.Lock()
+	defer s.registry.mu.Unlock()
+	delete(s.registry.collectors, name)
+	delete(s.registry.disabled, name)
+}
+
+// Collectors returns the names of all registered collectors
+func (s *StatsService) Collectors() []string {
+	s.registry.mu.RLock()
+	defer s.registry.mu.RUnlock()
+
+	names := make([]string, 0, len(s.registry.collectors))
+	for name := range s.registry.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runCollectors calls every registered collector and merges the results,
+// with the names of the values that are counters and the collectors'
+// histograms. A failing collector is logged and skipped so it can't break
+// the sample.
+func (s *StatsService) runCollectors(ctx context.Context) (map[string]float64, map[string]bool, map[string]HistogramSnapshot) {
+	s.registry.mu.RLock()
+	collectors := make(map[string]Collector, len(s.registry.collectors))
+	for name, c := range s.registry.collectors {
+		if !s.registry.disabled[name] {
+			collectors[name] = c
+		}
+	}
+	s.registry.mu.RUnlock()
+
+	metrics := make(map[string]float64)
+	counters := make(map[string]bool)
+	histograms := make(map[string]HistogramSnapshot)
+	for name, collector := range collectors {
+		values, err := collector.Collect(ctx)
+		if err != nil {
+			s.logger.Error("stats collector %s failed: %v", name, err)
+			continue
+		}
+		for key, value := range values {
+			metrics[name+"."+key] = value
+		}
+		if c, ok := collector.(CounterCollector); ok {
+			for _, key := range c.Counters() {
+				counters[name+"."+key] = true
+			}
+		}
+		if c, ok := collector.(HistogramCollector); ok {
+			for key, hist := range c.Histograms() {
+				histograms[name+"."+key] = hist
+			}
+		}
+	}
+	return metrics, counters, histograms
+}
@@ -0,0 +1,234 @@
+package stats
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// requestBucket is the granularity of the sliding windows
+	requestBucket = time.Minute
+	// requestBuckets is the number of buckets kept per route, i.e. the
+	// longest window that can be queried
+	requestBuckets = 60
+)
+
+type requestCounts struct {
+	Requests     uint64 `json:"requests"`
+	ClientErrors uint64 `json:"client_errors"`
+	ServerErrors uint64 `json:"server_errors"`
+}
+
+type requestBucketCounts struct {
+	start int64 // bucket start in unix minutes
+	requestCounts
+}
+
+// RouteErrors summarizes a route's requests over a window
+type RouteErrors struct {
+	Route string `json:"route"`
+	requestCounts
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// RequestTracker counts requests and 4xx/5xx responses per route over
+// sliding windows
+type RequestTracker struct {
+	mu        sync.Mutex
+	routes    map[string]*[requestBuckets]requestBucketCounts
+	latency   map[string]*LatencyHistogram // current interval, per route
+	last      map[string]LatencySummary    // previous interval, per route
+	durations map[string]*DurationHistogram
+	now       func() time.Time
+}
+
+func NewRequestTracker() *RequestTracker {
+	return &RequestTracker{
+		routes:    make(map[string]*[requestBuckets]requestBucketCounts),
+		latency:   make(map[string]*LatencyHistogram),
+		last:      make(map[string]LatencySummary),
+		durations: make(map[string]*DurationHistogram),
+		now:       time.Now,
+	}
+}
+
+// Record counts a completed request for route
+func (t *RequestTracker) Record(route string, status int, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buckets, ok := t.routes[route]
+	if !ok {
+		buckets = &[requestBuckets]requestBucketCounts{}
+		t.routes[route] = buckets
+	}
+
+	start := t.now().Unix() / int64(requestBucket.Seconds())
+	bucket := &buckets[start%requestBuckets]
+	if bucket.start != start {
+		*bucket = requestBucketCounts{start: start}
+	}
+
+	hist, ok := t.latency[route]
+	if !ok {
+		hist = &LatencyHistogram{}
+		t.latency[route] = hist
+	}
+	hist.Record(duration)
+	durations, ok := t.durations[route]
+	if !ok {
+		durations = newDurationHistogram()
+		t.durations[route] = durations
+	}
+	durations.record(duration)
+
+	bucket.Requests++
+	switch {
+	case status >= 500:
+		bucket.ServerErrors++
+	case status >= 400:
+		bucket.ClientErrors++
+	}
+}
+
+// Errors returns per-route counts over the given window, worst offenders
+// first. Windows are rounded up to whole minutes and capped at one hour.
+func (t *RequestTracker) Errors(window time.Duration) []RouteErrors {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := int64((window + requestBucket - 1) / requestBucket)
+	if n < 1 {
+		n = 1
+	}
+	if n > requestBuckets {
+		n = requestBuckets
+	}
+	oldest := t.now().Unix()/int64(requestBucket.Seconds()) - n + 1
+
+	var result []RouteErrors
+	for route, buckets := range t.routes {
+		summary := RouteErrors{Route: route}
+		for _, bucket := range buckets {
+			if bucket.start < oldest {
+				continue
+			}
+			summary.Requests += bucket.Requests
+			summary.ClientErrors += bucket.ClientErrors
+			summary.ServerErrors += bucket.ServerErrors
+		}
+		if summary.Requests == 0 {
+			continue
+		}
+		summary.ErrorRate = float64(summary.ClientErrors+summary.ServerErrors) / float64(summary.Requests)
+		result = append(result, summary)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ServerErrors != result[j].ServerErrors {
+			return result[i].ServerErrors > result[j].ServerErrors
+		}
+		if result[i].ErrorRate != result[j].ErrorRate {
+			return result[i].ErrorRate > result[j].ErrorRate
+		}
+		return result[i].Route < result[j].Route
+	})
+	return result
+}
+
+// Vacuum forgets routes with no requests in the longest window, along with
+// their latency summaries and duration histograms, and returns how many were removed. It is run by
+// the scheduler so routes that stop receiving traffic, such as those of
+// removed endpoints or probes of unknown paths, don't accumulate.
+func (t *RequestTracker) Vacuum() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	oldest := t.now().Unix()/int64(requestBucket.Seconds()) - requestBuckets + 1
+	removed := 0
+	for route, buckets := range t.routes {
+		stale := true
+		for _, bucket := range buckets {
+			if bucket.start >= oldest && bucket.Requests > 0 {
+				stale = false
+				break
+			}
+		}
+		if !stale {
+			continue
+		}
+		delete(t.routes, route)
+		delete(t.latency, route)
+		delete(t.last, route)
+		delete(t.durations, route)
+		removed++
+	}
+	return removed
+}
+
+// AllRoutes is the key of the combined latency summary across all routes
+const AllRoutes = "*"
+
+// rotateLatency closes the current interval, returning latency summaries per
+// route plus the combined summary under AllRoutes
+func (t *RequestTracker) rotateLatency() map[string]LatencySummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summaries := make(map[string]LatencySummary, len(t.latency)+1)
+	var all LatencyHistogram
+	for route, hist := range t.latency {
+		summaries[route] = hist.Summary()
+		all.Merge(hist)
+	}
+	summaries[AllRoutes] = all.Summary()
+
+	t.latency = make(map[string]*LatencyHistogram)
+	t.last = summaries
+	return summaries
+}
+
+// Durations returns a copy of the duration histogram of every route
+func (t *RequestTracker) Durations() map[string]DurationHistogram {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	durations := make(map[string]DurationHistogram, len(t.durations))
+	for route, hist := range t.durations {
+		durations[route] = hist.copy()
+	}
+	return durations
+}
+
+// Latency returns the latency summary of route over the previous stats
+// interval; AllRoutes combines every route
+func (t *RequestTracker) Latency(route string) LatencySummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last[route]
+}
+
+// Collect reports totals and the overall error rate over the last minute
+func (t *RequestTracker) Collect(ctx context.Context) (map[string]float64, error) {
+	var total, errors uint64
+	for _, route := range t.Errors(requestBucket) {
+		total += route.Requests
+		errors += route.ClientErrors + route.ServerErrors
+	}
+
+	values := map[string]float64{
+		"total":      float64(total),
+		"errors":     float64(errors),
+		"error_rate": 0,
+	}
+	if total > 0 {
+		values["error_rate"] = float64(errors) / float64(total)
+	}
+
+	all := t.Latency(AllRoutes)
+	values["latency_p50_seconds"] = all.P50.Seconds()
+	values["latency_p90_seconds"] = all.P90.Seconds()
+	values["latency_p99_seconds"] = all.P99.Seconds()
+	return values, nil
+}
@@ -0,0 +1,102 @@
+package stats
+
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+const (
+	gcPausesMetric     = "/sched/pauses/total/gc:seconds"
+	schedLatencyMetric = "/sched/latencies:seconds"
+)
+
+// RuntimeStats holds GC and scheduler metrics from runtime/metrics. Pause and
+// latency percentiles cover only the interval since the previous sample.
+type RuntimeStats struct {
+	GCPauseP50      time.Duration
+	GCPauseP99      time.Duration
+	GCPauseMax      time.Duration
+	GCCPUFraction   float64
+	SchedLatencyP50 time.Duration
+	SchedLatencyP99 time.Duration
+}
+
+// runtimeSampler reads runtime/metrics histograms and keeps the previous
+// counts so each sample reports the distribution for its own interval
+type runtimeSampler struct {
+	samples []metrics.Sample
+	prev    map[string][]uint64
+}
+
+func newRuntimeSampler() *runtimeSampler {
+	return &runtimeSampler{
+		samples: []metrics.Sample{
+			{Name: gcPausesMetric},
+			{Name: schedLatencyMetric},
+		},
+		prev: make(map[string][]uint64),
+	}
+}
+
+// read fills in the histogram based fields of stats
+func (r *runtimeSampler) read(stats *RuntimeStats) {
+	metrics.Read(r.samples)
+
+	for _, sample := range r.samples {
+		if sample.Value.Kind() != metrics.KindFloat64Histogram {
+			continue
+		}
+		hist := sample.Value.Float64Histogram()
+		delta := r.delta(sample.Name, hist.Counts)
+
+		switch sample.Name {
+		case gcPausesMetric:
+			stats.GCPauseP50 = quantile(delta, hist.Buckets, 0.5)
+			stats.GCPauseP99 = quantile(delta, hist.Buckets, 0.99)
+			stats.GCPauseMax = quantile(delta, hist.Buckets, 1)
+		case schedLatencyMetric:
+			stats.SchedLatencyP50 = quantile(delta, hist.Buckets, 0.5)
+			stats.SchedLatencyP99 = quantile(delta, hist.Buckets, 0.99)
+		}
+	}
+}
+
+// delta returns the bucket counts accumulated since the previous read
+func (r *runtimeSampler) delta(name string, counts []uint64) []uint64 {
+	prev := r.prev[name]
+	delta := make([]uint64, len(counts))
+	for i, c := range counts {
+		delta[i] = c
+		if i < len(prev) {
+			delta[i] -= prev[i]
+		}
+	}
+	r.prev[name] = append(prev[:0], counts...)
+	return delta
+}
+
+// quantile returns the upper bound of the bucket containing quantile q
+func quantile(counts []uint64, buckets []float64, q float64) time.Duration {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(q * float64(total)))
+	var cumulative uint64
+	for i, c := range counts {
+		cumulative += c
+		if cumulative >= target {
+			bound := buckets[i+1]
+			if math.IsInf(bound, 1) {
+				bound = buckets[i]
+			}
+			return time.Duration(bound * float64(time.Second))
+		}
+	}
+	return 0
+}
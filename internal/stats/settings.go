@@ -0,0 +1,69 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+)
+
+// Settings describes the runtime-adjustable behaviour of the stats service
+type Settings struct {
+	Interval   time.Duration
+	Collectors map[string]bool // collector name -> enabled
+}
+
+// Interval returns the current collection interval
+func (s *StatsService) Interval() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.interval
+}
+
+// SetInterval changes the collection interval. A running service picks up
+// the new interval immediately.
+func (s *StatsService) SetInterval(interval time.Duration) error {
+	if interval < time.Second {
+		return fmt.Errorf("interval must be at least 1s")
+	}
+
+	s.mu.Lock()
+	s.interval = interval
+	s.mu.Unlock()
+
+	// A signal already pending makes the loop read the new interval too
+	select {
+	case s.intervalChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetCollectorEnabled enables or disables a registered collector
+func (s *StatsService) SetCollectorEnabled(name string, enabled bool) error {
+	s.registry.mu.Lock()
+	defer s.registry.mu.Unlock()
+
+	if _, ok := s.registry.collectors[name]; !ok {
+		return fmt.Errorf("collector %q not registered", name)
+	}
+	if enabled {
+		delete(s.registry.disabled, name)
+	} else {
+		s.registry.disabled[name] = true
+	}
+	return nil
+}
+
+// Settings returns the current interval and collector states
+func (s *StatsService) Settings() Settings {
+	s.registry.mu.RLock()
+	defer s.registry.mu.RUnlock()
+
+	settings := Settings{
+		Interval:   s.Interval(),
+		Collectors: make(map[string]bool, len(s.registry.collectors)),
+	}
+	for name := range s.registry.collectors {
+		settings.Collectors[name] = !s.registry.disabled[name]
+	}
+	return settings
+}
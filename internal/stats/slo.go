@@ -0,0 +1,274 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sloMinutes is the number of minute buckets kept per route for burn rates,
+// covering the longest burn rate window
+const sloMinutes = 6 * 60
+
+// Burn rate alerts, after the multi-window alerts of the Google SRE
+// workbook: an alert fires when the error budget burns faster than the
+// rate over both its long and its short window, the short one making it
+// resolve soon after the burn stops
+var sloAlerts = []struct {
+	name        string
+	level       string
+	rate        float64
+	long, short time.Duration
+}{
+	{name: "fast-burn", level: "ERROR", rate: 14.4, long: time.Hour, short: 5 * time.Minute},
+	{name: "slow-burn", level: "WARN", rate: 6, long: 6 * time.Hour, short: 30 * time.Minute},
+}
+
+// sloBurnWindows are the windows burn rates are reported over
+var sloBurnWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+// SLO is a route's service level objective. Targets are percentages; a zero
+// target is not tracked.
+type SLO struct {
+	Availability  float64 // of requests answered without a 5xx
+	LatencyTarget float64 // of requests answered within Latency
+	Latency       time.Duration
+	Window        time.Duration // error budget period, in whole hours
+}
+
+// SLOStatus reports a route's objectives
+type SLOStatus struct {
+	Route      string            `json:"route"`
+	Window     string            `json:"window"`
+	Objectives []ObjectiveStatus `json:"objectives"`
+}
+
+// ObjectiveStatus reports the compliance and error budget of an objective
+// over the SLO window, and how fast the budget is burning
+type ObjectiveStatus struct {
+	Name      string  `json:"name"` // availability or latency
+	Target    float64 `json:"target"`
+	Threshold string  `json:"threshold,omitempty"` // latency objectives
+	Requests  uint64  `json:"requests"`
+	Bad       uint64  `json:"bad"`
+	// SLI is the percentage of good requests, 100 without requests
+	SLI float64 `json:"sli"`
+	// BudgetRemaining is the fraction of the error budget left, negative
+	// once it is overspent
+	BudgetRemaining float64 `json:"budget_remaining"`
+	// BurnRates are how many times faster than sustainable the budget
+	// burns, per window
+	BurnRates map[string]float64 `json:"burn_rates"`
+	// Alert is the burn rate alert firing, if any
+	Alert string `json:"alert,omitempty"`
+}
+
+type sloBucket struct {
+	start int64 // bucket start in unix minutes or hours
+	total uint64
+	// errors are 5xx responses, slow those taking longer than the latency
+	// threshold
+	errors, slow uint64
+}
+
+type sloRoute struct {
+	slo     SLO
+	minutes [sloMinutes]sloBucket
+	hours   []sloBucket
+	alerts  map[string]string // firing alert per objective
+}
+
+// SLOTracker tracks the service level objectives of routes
+type SLOTracker struct {
+	mu     sync.Mutex
+	routes map[string]*sloRoute
+	now    func() time.Time
+}
+
+func NewSLOTracker() *SLOTracker {
+	return &SLOTracker{routes: make(map[string]*sloRoute), now: time.Now}
+}
+
+// Track starts tracking slo for route, named by method and path template.
+// Tracking a route again replaces its objective and history.
+func (t *SLOTracker) Track(route string, slo SLO) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes[route] = &sloRoute{
+		slo:    slo,
+		hours:  make([]sloBucket, int(slo.Window/time.Hour)),
+		alerts: make(map[string]string),
+	}
+}
+
+// Record counts a completed request against the route's objective, if it
+// has one
+func (t *SLOTracker) Record(route string, status int, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.routes[route]
+	if !ok {
+		return
+	}
+
+	now := t.now()
+	minute := now.Unix() / 60
+	hour := minute / 60
+	for _, b := range []*sloBucket{bucketAt(r.minutes[:], minute), bucketAt(r.hours, hour)} {
+		b.total++
+		if status >= 500 {
+			b.errors++
+		}
+		if r.slo.Latency > 0 && duration > r.slo.Latency {
+			b.slow++
+		}
+	}
+}
+
+// bucketAt returns the bucket for start in the ring, clearing it if it
+// holds an older period
+func bucketAt(ring []sloBucket, start int64) *sloBucket {
+	b := &ring[start%int64(len(ring))]
+	if b.start != start {
+		*b = sloBucket{start: start}
+	}
+	return b
+}
+
+// sumBuckets adds up the buckets of the ring in the n periods up to and including
+// current
+func sumBuckets(ring []sloBucket, current int64, n int64) sloBucket {
+	var total sloBucket
+	for _, b := range ring {
+		if b.start > current-n && b.start <= current {
+			total.total += b.total
+			total.errors += b.errors
+			total.slow += b.slow
+		}
+	}
+	return total
+}
+
+// objective is one of a route's objectives: its name, target percentage
+// and how to count its bad requests
+type objective struct {
+	name   string
+	target float64
+	bad    func(sloBucket) uint64
+}
+
+func (r *sloRoute) objectives() []objective {
+	var objectives []objective
+	if r.slo.Availability > 0 {
+		objectives = append(objectives, objective{"availability", r.slo.Availability, func(b sloBucket) uint64 { return b.errors }})
+	}
+	if r.slo.LatencyTarget > 0 {
+		objectives = append(objectives, objective{"latency", r.slo.LatencyTarget, func(b sloBucket) uint64 { return b.slow }})
+	}
+	return objectives
+}
+
+// burnRate is how many times faster than the budget allows bad requests
+// came in over the window
+func (r *sloRoute) burnRate(o objective, now time.Time, window time.Duration) float64 {
+	b := sumBuckets(r.minutes[:], now.Unix()/60, int64(window/time.Minute))
+	if b.total == 0 {
+		return 0
+	}
+	return float64(o.bad(b)) / float64(b.total) / (1 - o.target/100)
+}
+
+func (r *sloRoute) status(route string, now time.Time) SLOStatus {
+	status := SLOStatus{Route: route, Window: formatWindow(r.slo.Window)}
+	window := sumBuckets(r.hours, now.Unix()/3600, int64(len(r.hours)))
+	for _, o := range r.objectives() {
+		s := ObjectiveStatus{
+			Name:            o.name,
+			Target:          o.target,
+			Requests:        window.total,
+			Bad:             o.bad(window),
+			SLI:             100,
+			BudgetRemaining: 1,
+			BurnRates:       make(map[string]float64, len(sloBurnWindows)),
+			Alert:           r.alerts[o.name],
+		}
+		if o.name == "latency" {
+			s.Threshold = r.slo.Latency.String()
+		}
+		if s.Requests > 0 {
+			badRatio := float64(s.Bad) / float64(s.Requests)
+			s.SLI = 100 * (1 - badRatio)
+			s.BudgetRemaining = 1 - badRatio/(1-o.target/100)
+		}
+		for _, w := range sloBurnWindows {
+			s.BurnRates[formatWindow(w)] = r.burnRate(o, now, w)
+		}
+		status.Objectives = append(status.Objectives, s)
+	}
+	return status
+}
+
+// Status reports every tracked route's objectives, by route
+func (t *SLOTracker) Status() []SLOStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	result := make([]SLOStatus, 0, len(t.routes))
+	for route, r := range t.routes {
+		result = append(result, r.status(route, now))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Route < result[j].Route })
+	return result
+}
+
+// evaluateSLOs checks the burn rate alerts of every objective, logging when
+// one fires or resolves
+func (s *StatsService) evaluateSLOs() {
+	t := s.slos
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for route, r := range t.routes {
+		for _, o := range r.objectives() {
+			firing := ""
+			for _, alert := range sloAlerts {
+				long, short := r.burnRate(o, now, alert.long), r.burnRate(o, now, alert.short)
+				if long <= alert.rate || short <= alert.rate {
+					continue
+				}
+				firing = alert.name
+				if r.alerts[o.name] != firing {
+					s.logAlert(Alert{
+						Name:  route + " " + o.name,
+						Level: alert.level,
+						Message: fmt.Sprintf("[SLO] %s %s error budget burning %.1fx over %s and %.1fx over %s, above %vx (target %v%% over %s)",
+							route, o.name, long, formatWindow(alert.long), short, formatWindow(alert.short), alert.rate, o.target, formatWindow(r.slo.Window)),
+						Firing: true,
+						Time:   now,
+					})
+				}
+				break
+			}
+			if firing == "" && r.alerts[o.name] != "" {
+				s.logAlert(Alert{
+					Name:    route + " " + o.name,
+					Level:   "INFO",
+					Message: fmt.Sprintf("[SLO] %s %s error budget burn rate recovered", route, o.name),
+					Time:    now,
+				})
+			}
+			r.alerts[o.name] = firing
+		}
+	}
+}
+
+// formatWindow names a burn rate window, e.g. 5m or 6h
+func formatWindow(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
@@ -0,0 +1,88 @@
+package stats
+
+import "sync"
+
+// subscriberBuffer is the number of samples buffered per subscriber before
+// new samples start being dropped for that subscriber
+const subscriberBuffer = 16
+
+// subscriber is a single consumer of stats samples
+type subscriber struct {
+	ch      chan Stats
+	dropped uint64
+}
+
+// subscribers fans samples out to any number of consumers
+type subscribers struct {
+	mu     sync.Mutex
+	subs   map[<-chan Stats]*subscriber
+	closed bool
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{
+		subs: make(map[<-chan Stats]*subscriber),
+	}
+}
+
+// Subscribe returns a channel that receives every new stats sample. The
+// channel is closed when the service stops or Unsubscribe is called. Slow
+// consumers don't block collection: samples are dropped for a subscriber
+// whose buffer is full.
+func (s *StatsService) Subscribe() <-chan Stats {
+	s.subscribers.mu.Lock()
+	defer s.subscribers.mu.Unlock()
+
+	sub := &subscriber{ch: make(chan Stats, subscriberBuffer)}
+	if s.subscribers.closed {
+		close(sub.ch)
+		return sub.ch
+	}
+	s.subscribers.subs[sub.ch] = sub
+	return sub.ch
+}
+
+// Unsubscribe stops delivery to a channel returned by Subscribe and closes it
+func (s *StatsService) Unsubscribe(ch <-chan Stats) {
+	s.subscribers.mu.Lock()
+	defer s.subscribers.mu.Unlock()
+
+	if sub, ok := s.subscribers.subs[ch]; ok {
+		delete(s.subscribers.subs, ch)
+		close(sub.ch)
+	}
+}
+
+// publish delivers a sample to all subscribers without blocking
+func (s *StatsService) publish(stats Stats) {
+	s.subscribers.mu.Lock()
+	defer s.subscribers.mu.Unlock()
+
+	for _, sub := range s.subscribers.subs {
+		select {
+		case sub.ch <- stats:
+		default:
+			sub.dropped++
+			s.logger.Warn("stats subscriber too slow, dropped %d samples so far", sub.dropped)
+		}
+	}
+}
+
+// closeSubscribers closes all subscriber channels and rejects new subscriptions
+func (s *StatsService) closeSubscribers() {
+	s.subscribers.mu.Lock()
+	defer s.subscribers.mu.Unlock()
+
+	for ch, sub := range s.subscribers.subs {
+		delete(s.subscribers.subs, ch)
+		close(sub.ch)
+	}
+	s.subscribers.closed = true
+}
+
+// openSubscribers accepts subscriptions again after the service restarts
+func (s *StatsService) openSubscribers() {
+	s.subscribers.mu.Lock()
+	defer s.subscribers.mu.Unlock()
+	s.subscribers.closed = false
+}
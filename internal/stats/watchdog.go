@@ -0,0 +1,148 @@
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+// goroutineSummaryTop is the number of stacks included in the growth warning
+const goroutineSummaryTop = 5
+
+// goroutineWatchdog detects goroutine counts that keep growing sample after
+// sample, which usually means goroutines are leaking
+type goroutineWatchdog struct {
+	intervals int
+	dumpDir   string
+	last      int
+	growing   int
+}
+
+// WatchGoroutines enables the goroutine growth watchdog. A warning is logged
+// when the goroutine count has grown for the given number of consecutive
+// intervals. If dumpDir is set, the full goroutine profile is written there
+// as well.
+func (s *StatsService) WatchGoroutines(intervals int, dumpDir string) {
+	if intervals <= 0 {
+		s.watchdog = nil
+		return
+	}
+	s.watchdog = &goroutineWatchdog{
+		intervals: intervals,
+		dumpDir:   dumpDir,
+	}
+}
+
+// checkGoroutines feeds a sample to the watchdog
+func (s *StatsService) checkGoroutines(stats Stats) {
+	w := s.watchdog
+	if w == nil {
+		return
+	}
+
+	if w.last > 0 && stats.NumGoroutine > w.last {
+		w.growing++
+	} else {
+		w.growing = 0
+	}
+	start := w.last
+	w.last = stats.NumGoroutine
+
+	if w.growing < w.intervals {
+		return
+	}
+	w.growing = 0
+
+	summary, err := goroutineSummary()
+	if err != nil {
+		s.logger.Error("failed to capture goroutine profile: %v", err)
+	}
+	s.logger.Warn(
+		"[Stats] Goroutines grew for %d consecutive intervals (now %d, was %d). Top stacks: %s",
+		w.intervals, stats.NumGoroutine, start, summary,
+	)
+
+	if w.dumpDir != "" {
+		path, err := dumpGoroutines(w.dumpDir, stats.Timestamp)
+		if err != nil {
+			s.logger.Error("failed to dump goroutine profile: %v", err)
+			return
+		}
+		s.logger.Warn("[Stats] Goroutine profile written to %s", path)
+	}
+}
+
+// goroutineSummary returns the most common goroutine stacks with their counts
+func goroutineSummary() (string, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return "", err
+	}
+
+	type stack struct {
+		count int
+		frame string
+	}
+	var stacks []stack
+
+	// Profile records start with "<count> @ <pcs>" followed by "#" frame lines
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var count int
+		if _, err := fmt.Sscanf(line, "%d @", &count); err == nil {
+			stacks = append(stacks, stack{count: count})
+			continue
+		}
+		if len(stacks) == 0 || stacks[len(stacks)-1].frame != "" || !strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Use the first frame outside the runtime, which is where the
+		// goroutine is actually parked
+		fields := strings.Fields(line)
+		if len(fields) < 3 || isRuntimeFrame(fields[2]) {
+			continue
+		}
+		frame, _, _ := strings.Cut(fields[2], "+")
+		stacks[len(stacks)-1].frame = frame
+	}
+
+	sort.Slice(stacks, func(i, j int) bool { return stacks[i].count > stacks[j].count })
+	if len(stacks) > goroutineSummaryTop {
+		stacks = stacks[:goroutineSummaryTop]
+	}
+	parts := make([]string, 0, len(stacks))
+	for _, s := range stacks {
+		parts = append(parts, fmt.Sprintf("%d x %s", s.count, s.frame))
+	}
+	return strings.Join(parts, "; "), nil
+}
+
+func isRuntimeFrame(frame string) bool {
+	return strings.HasPrefix(frame, "runtime.") || strings.HasPrefix(frame, "internal/") ||
+		strings.HasPrefix(frame, "sync.")
+}
+
+// dumpGoroutines writes the full goroutine profile into dir
+func dumpGoroutines(dir string, at time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "goroutines-"+at.Format("20060102-150405")+".txt")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if err := pprof.Lookup("goroutine").WriteTo(file, 2); err != nil {
+		return "", err
+	}
+	return path, nil
+}
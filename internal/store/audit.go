@@ -0,0 +1,28 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records an administrative change: who made it, what it did
+// and to what. Details describes the change as JSON, such as the old and
+// new values of a setting.
+type AuditEntry struct {
+	ID        string          `json:"id"`
+	Actor     string          `json:"actor,omitempty"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditRepository persists the audit log
+type AuditRepository interface {
+	// Record appends an entry, assigning its ID and time
+	Record(ctx context.Context, entry AuditEntry) (AuditEntry, error)
+	// List returns up to limit entries, newest first, of one target unless
+	// target is empty
+	List(ctx context.Context, target string, limit int) ([]AuditEntry, error)
+}
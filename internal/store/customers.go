@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"exampleserver/pkg/protobuf"
+)
+
+type Customer struct {
+	ID        string     `json:"id" xml:"id"`
+	Name      string     `json:"name" xml:"name"`
+	Email     string     `json:"email,omitempty" xml:"email,omitempty"`
+	CreatedAt time.Time  `json:"created_at" xml:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" xml:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" xml:"deleted_at,omitempty"`
+	// Version counts the changes to the customer, starting at 1
+	Version int `json:"-" xml:"-"`
+}
+
+// MarshalProtobuf encodes the customer as the Customer message of
+// pkg/protobuf/exampleserver.proto
+func (c Customer) MarshalProtobuf(e *protobuf.Encoder) {
+	e.String(1, c.ID)
+	e.String(2, c.Name)
+	e.String(3, c.Email)
+	e.Time(4, c.CreatedAt)
+	e.Time(5, c.UpdatedAt)
+	if c.DeletedAt != nil {
+		e.Time(6, *c.DeletedAt)
+	}
+}
+
+// CustomerRepository persists customers. Implementations return ErrNotFound
+// for unknown IDs and ErrConflict when an email is already in use.
+//
+// Deletes are soft: deleted customers are hidden from List and Get but can
+// be restored. Every write is recorded in the customer's history along with
+// the actor from the context (see WithActor).
+type CustomerRepository interface {
+	// List returns all customers that haven't been deleted, oldest first
+	List(ctx context.Context) ([]Customer, error)
+	Get(ctx context.Context, id string) (Customer, error)
+	// Create stores a new customer, assigning its ID and timestamps
+	Create(ctx context.Context, customer Customer) (Customer, error)
+	// Update replaces the name and email of an existing customer. With a
+	// Version set, only a customer still at that version is updated:
+	// ErrModified is returned otherwise.
+	Update(ctx context.Context, customer Customer) (Customer, error)
+	// Delete marks a customer as deleted. A version other than 0 makes the
+	// delete conditional like Update.
+	Delete(ctx context.Context, id string, version int) error
+	// Restore undoes a deletion
+	Restore(ctx context.Context, id string) (Customer, error)
+	// History returns the changes made to a customer, oldest first
+	History(ctx context.Context, id string) ([]Change, error)
+	// Search returns up to limit live customers matching every term in
+	// query, best matches first. Terms match word prefixes.
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+}
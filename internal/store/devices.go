@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Device is a browser or app a user chose to stay logged in on at login. It
+// holds the hash of a long-lived device token that is exchanged for access
+// tokens; the token itself is never stored.
+type Device struct {
+	ID     string `json:"id" xml:"id"`
+	UserID string `json:"-" xml:"-"`
+	// Name is the User-Agent of the login
+	Name      string `json:"name" xml:"name"`
+	IP        string `json:"ip" xml:"ip"`
+	TokenHash string `json:"-" xml:"-"`
+	// SessionVersion is the user's session version at login; the device is
+	// revoked with the user's other sessions
+	SessionVersion int       `json:"-" xml:"-"`
+	CreatedAt      time.Time `json:"created_at" xml:"created_at"`
+	LastUsedAt     time.Time `json:"last_used_at" xml:"last_used_at"`
+	ExpiresAt      time.Time `json:"expires_at" xml:"expires_at"`
+}
+
+// DeviceRepository persists devices. Implementations return ErrNotFound for
+// unknown devices.
+type DeviceRepository interface {
+	// ListByUser returns the user's devices, oldest first
+	ListByUser(ctx context.Context, userID string) ([]Device, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (Device, error)
+	// Create stores a new device, assigning its ID and creation time
+	Create(ctx context.Context, device Device) (Device, error)
+	// Touch records a use of the device from ip
+	Touch(ctx context.Context, id, ip string, at time.Time) error
+	// Delete removes a device of the user
+	Delete(ctx context.Context, userID, id string) error
+	// DeleteExpired removes devices that expired before t and returns how
+	// many there were
+	DeleteExpired(ctx context.Context, t time.Time) (int, error)
+}
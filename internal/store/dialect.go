@@ -0,0 +1,57 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// dialect captures the differences between the supported SQL databases
+type dialect struct {
+	name       string
+	driverName string
+	// numbered placeholders ($1, $2) instead of ?
+	numbered bool
+}
+
+var sqliteDialect = dialect{
+	name:       "sqlite",
+	driverName: "sqlite",
+}
+
+var postgresDialect = dialect{
+	name:       "postgres",
+	driverName: "pgx",
+	numbered:   true,
+}
+
+// rebind converts ? placeholders to the dialect's placeholder style
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func (d dialect) isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	if state, ok := err.(interface{ SQLState() string }); ok {
+		return state.SQLState() == "23505"
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
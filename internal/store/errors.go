@@ -0,0 +1,11 @@
+package store
+
+import "errors"
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	// ErrModified is returned by conditional writes when the record has
+	// changed since the version they were based on
+	ErrModified = errors.New("modified")
+)
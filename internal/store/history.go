@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Change actions recorded in a customer's history
+const (
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionDeleted  = "deleted"
+	ActionRestored = "restored"
+)
+
+// Change is an entry in a customer's history. Before and After are
+// snapshots of the customer around the change; Before is nil on creation
+// and After is nil on deletion.
+type Change struct {
+	ID         string    `json:"id" xml:"id"`
+	CustomerID string    `json:"customer_id" xml:"customer_id"`
+	Action     string    `json:"action" xml:"action"`
+	Actor      string    `json:"actor,omitempty" xml:"actor,omitempty"`
+	Before     *Customer `json:"before,omitempty" xml:"before,omitempty"`
+	After      *Customer `json:"after,omitempty" xml:"after,omitempty"`
+	Time       time.Time `json:"time" xml:"time"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx naming who is making changes, recorded in
+// the history of any customer written with it
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or ""
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
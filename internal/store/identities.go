@@ -0,0 +1,24 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Identity links an account at a social login provider to a user
+type Identity struct {
+	Provider string `json:"provider"`
+	// Subject is the provider's ID of the account
+	Subject   string    `json:"subject"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IdentityRepository persists identities. Implementations return
+// ErrNotFound for unknown identities and ErrConflict when the provider
+// account is already linked.
+type IdentityRepository interface {
+	Get(ctx context.Context, provider, subject string) (Identity, error)
+	// Create links an identity, setting its creation time
+	Create(ctx context.Context, identity Identity) (Identity, error)
+}
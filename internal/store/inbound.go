@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// InboundEvent is an event received from a webhook source. DeliveryID is
+// the sender's ID of the event and Digest the SHA-256 of its body, each
+// unique per source, so a retried delivery is recognized, as is a replay
+// under another delivery ID where the ID isn't signed.
+type InboundEvent struct {
+	ID           string          `json:"id"`
+	Source       string          `json:"source"`
+	DeliveryID   string          `json:"delivery_id"`
+	Digest       string          `json:"-"`
+	Type         string          `json:"type"`
+	Payload      json.RawMessage `json:"payload"`
+	ReceivedAt   time.Time       `json:"received_at"`
+	DispatchedAt *time.Time      `json:"dispatched_at,omitempty"`
+}
+
+// InboundRepository persists received webhook events
+type InboundRepository interface {
+	// Record stores a received event, assigning its ID and receipt time.
+	// When the source already sent an event with the same delivery ID or
+	// digest it returns the stored event with ErrConflict.
+	Record(ctx context.Context, event InboundEvent) (InboundEvent, error)
+	// MarkDispatched records that the event was handed to the event bus
+	MarkDispatched(ctx context.Context, id string) error
+	// List returns up to limit events, newest first, of one source unless
+	// source is empty
+	List(ctx context.Context, source string, limit int) ([]InboundEvent, error)
+	// Purge deletes events received before the given time and returns how
+	// many were removed
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
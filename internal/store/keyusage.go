@@ -0,0 +1,29 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// KeyUsage counts the requests made with an API key, by its key ID, to one
+// route on one UTC day
+type KeyUsage struct {
+	KeyID        string
+	Date         string // YYYY-MM-DD
+	Route        string
+	Requests     uint64
+	ClientErrors uint64
+	ServerErrors uint64
+	LastUsed     time.Time
+}
+
+// KeyUsageRepository keeps the API key usage counts across restarts
+type KeyUsageRepository interface {
+	// Add adds the counts of usage to those kept for the same key, date and
+	// route, keeping the latest LastUsed
+	Add(ctx context.Context, usage []KeyUsage) error
+	// List returns the counts of since, a YYYY-MM-DD date, and later days
+	List(ctx context.Context, since string) ([]KeyUsage, error)
+	// Prune deletes the counts of days before a YYYY-MM-DD date
+	Prune(ctx context.Context, before string) error
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCustomers is an in-memory CustomerRepository and Outbox, useful for
+// development and tests
+type MemoryCustomers struct {
+	mu           sync.RWMutex
+	customers    map[string]Customer
+	history      map[string][]Change
+	outbox       []memoryOutboxEvent
+	nextID       int
+	nextChangeID int
+	nextEventID  int
+}
+
+func NewMemoryCustomers() *MemoryCustomers {
+	return &MemoryCustomers{
+		customers:    make(map[string]Customer),
+		history:      make(map[string][]Change),
+		nextID:       1,
+		nextChangeID: 1,
+		nextEventID:  1,
+	}
+}
+
+func (m *MemoryCustomers) List(ctx context.Context) ([]Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	customers := make([]Customer, 0, len(m.customers))
+	for _, customer := range m.customers {
+		if customer.DeletedAt == nil {
+			customers = append(customers, customer)
+		}
+	}
+	sort.Slice(customers, func(i, j int) bool {
+		a, _ := strconv.Atoi(customers[i].ID)
+		b, _ := strconv.Atoi(customers[j].ID)
+		return a < b
+	})
+	return customers, nil
+}
+
+func (m *MemoryCustomers) Get(ctx context.Context, id string) (Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	customer, ok := m.customers[id]
+	if !ok || customer.DeletedAt != nil {
+		return Customer{}, ErrNotFound
+	}
+	return customer, nil
+}
+
+func (m *MemoryCustomers) Create(ctx context.Context, customer Customer) (Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(customer.Email, "") {
+		return Customer{}, ErrConflict
+	}
+	now := time.Now().UTC()
+	customer.ID = strconv.Itoa(m.nextID)
+	customer.CreatedAt = now
+	customer.UpdatedAt = now
+	customer.DeletedAt = nil
+	customer.Version = 1
+	m.nextID++
+	m.customers[customer.ID] = customer
+	m.record(ctx, customer.ID, ActionCreated, nil, &customer)
+	return customer, nil
+}
+
+func (m *MemoryCustomers) Update(ctx context.Context, customer Customer) (Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.customers[customer.ID]
+	if !ok || existing.DeletedAt != nil {
+		return Customer{}, ErrNotFound
+	}
+	if customer.Version != 0 && customer.Version != existing.Version {
+		return Customer{}, ErrModified
+	}
+	if m.emailTaken(customer.Email, customer.ID) {
+		return Customer{}, ErrConflict
+	}
+	before := existing
+	existing.Name = customer.Name
+	existing.Email = customer.Email
+	existing.UpdatedAt = time.Now().UTC()
+	existing.Version++
+	m.customers[customer.ID] = existing
+	m.record(ctx, customer.ID, ActionUpdated, &before, &existing)
+	return existing, nil
+}
+
+func (m *MemoryCustomers) Delete(ctx context.Context, id string, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	customer, ok := m.customers[id]
+	if !ok || customer.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if version != 0 && version != customer.Version {
+		return ErrModified
+	}
+	before := customer
+	now := time.Now().UTC()
+	customer.DeletedAt = &now
+	customer.Version++
+	m.customers[id] = customer
+	m.record(ctx, id, ActionDeleted, &before, nil)
+	return nil
+}
+
+func (m *MemoryCustomers) Restore(ctx context.Context, id string) (Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	customer, ok := m.customers[id]
+	if !ok || customer.DeletedAt == nil {
+		return Customer{}, ErrNotFound
+	}
+	if m.emailTaken(customer.Email, id) {
+		return Customer{}, ErrConflict
+	}
+	customer.DeletedAt = nil
+	customer.UpdatedAt = time.Now().UTC()
+	customer.Version++
+	m.customers[id] = customer
+	m.record(ctx, id, ActionRestored, nil, &customer)
+	return customer, nil
+}
+
+func (m *MemoryCustomers) History(ctx context.Context, id string) ([]Change, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	changes, ok := m.history[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]Change(nil), changes...), nil
+}
+
+// record appends to a customer's history and queues the matching outbox
+// event. The caller must hold m.mu.
+func (m *MemoryCustomers) record(ctx context.Context, id, action string, before, after *Customer) {
+	change := Change{
+		ID:         strconv.Itoa(m.nextChangeID),
+		CustomerID: id,
+		Action:     action,
+		Actor:      ActorFromContext(ctx),
+		Time:       time.Now().UTC(),
+	}
+	m.nextChangeID++
+	if before != nil {
+		snapshot := *before
+		change.Before = &snapshot
+	}
+	if after != nil {
+		snapshot := *after
+		change.After = &snapshot
+	}
+	m.history[id] = append(m.history[id], change)
+
+	// Snapshots always encode, so the event cannot fail to build
+	event, _ := outboxEvent(id, action, after)
+	event.ID = strconv.Itoa(m.nextEventID)
+	m.nextEventID++
+	m.outbox = append(m.outbox, memoryOutboxEvent{OutboxEvent: event, availableAt: event.CreatedAt})
+}
+
+// emailTaken reports whether another live customer already uses email. The
+// caller must hold m.mu.
+func (m *MemoryCustomers) emailTaken(email, exceptID string) bool {
+	if email == "" {
+		return false
+	}
+	for id, customer := range m.customers {
+		if id != exceptID && customer.DeletedAt == nil && strings.EqualFold(customer.Email, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryAudit is an in-memory AuditRepository
+type MemoryAudit struct {
+	mu      sync.RWMutex
+	entries []AuditEntry // oldest first
+	nextID  int
+}
+
+func NewMemoryAudit() *MemoryAudit {
+	return &MemoryAudit{nextID: 1}
+}
+
+func (m *MemoryAudit) Record(ctx context.Context, entry AuditEntry) (AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.ID = strconv.Itoa(m.nextID)
+	m.nextID++
+	entry.CreatedAt = time.Now().UTC()
+	m.entries = append(m.entries, entry)
+	return entry, nil
+}
+
+func (m *MemoryAudit) List(ctx context.Context, target string, limit int) ([]AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]AuditEntry, 0)
+	for i := len(m.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if target == "" || m.entries[i].Target == target {
+			entries = append(entries, m.entries[i])
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryDevices is an in-memory DeviceRepository
+type MemoryDevices struct {
+	mu      sync.RWMutex
+	devices map[string]Device
+	nextID  int
+}
+
+func NewMemoryDevices() *MemoryDevices {
+	return &MemoryDevices{
+		devices: make(map[string]Device),
+		nextID:  1,
+	}
+}
+
+func (m *MemoryDevices) ListByUser(ctx context.Context, userID string) ([]Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	devices := make([]Device, 0)
+	for _, device := range m.devices {
+		if device.UserID == userID {
+			devices = append(devices, device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		a, _ := strconv.Atoi(devices[i].ID)
+		b, _ := strconv.Atoi(devices[j].ID)
+		return a < b
+	})
+	return devices, nil
+}
+
+func (m *MemoryDevices) GetByTokenHash(ctx context.Context, tokenHash string) (Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, device := range m.devices {
+		if device.TokenHash == tokenHash {
+			return device, nil
+		}
+	}
+	return Device{}, ErrNotFound
+}
+
+func (m *MemoryDevices) Create(ctx context.Context, device Device) (Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device.ID = strconv.Itoa(m.nextID)
+	device.CreatedAt = time.Now().UTC()
+	if device.LastUsedAt.IsZero() {
+		device.LastUsedAt = device.CreatedAt
+	}
+	m.nextID++
+	m.devices[device.ID] = device
+	return device, nil
+}
+
+func (m *MemoryDevices) Touch(ctx context.Context, id, ip string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device, ok := m.devices[id]
+	if !ok {
+		return ErrNotFound
+	}
+	device.IP = ip
+	device.LastUsedAt = at.UTC()
+	m.devices[id] = device
+	return nil
+}
+
+func (m *MemoryDevices) Delete(ctx context.Context, userID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if device, ok := m.devices[id]; !ok || device.UserID != userID {
+		return ErrNotFound
+	}
+	delete(m.devices, id)
+	return nil
+}
+
+func (m *MemoryDevices) DeleteExpired(ctx context.Context, t time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, device := range m.devices {
+		if device.ExpiresAt.Before(t) {
+			delete(m.devices, id)
+			n++
+		}
+	}
+	return n, nil
+}
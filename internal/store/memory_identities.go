@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryIdentities is an in-memory IdentityRepository
+type MemoryIdentities struct {
+	mu         sync.RWMutex
+	identities map[[2]string]Identity // by provider and subject
+}
+
+func NewMemoryIdentities() *MemoryIdentities {
+	return &MemoryIdentities{identities: make(map[[2]string]Identity)}
+}
+
+func (m *MemoryIdentities) Get(ctx context.Context, provider, subject string) (Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	identity, ok := m.identities[[2]string{provider, subject}]
+	if !ok {
+		return Identity{}, ErrNotFound
+	}
+	return identity, nil
+}
+
+func (m *MemoryIdentities) Create(ctx context.Context, identity Identity) (Identity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := [2]string{identity.Provider, identity.Subject}
+	if _, ok := m.identities[key]; ok {
+		return Identity{}, ErrConflict
+	}
+	identity.CreatedAt = time.Now().UTC()
+	m.identities[key] = identity
+	return identity, nil
+}
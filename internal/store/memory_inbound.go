@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryInbound is an in-memory InboundRepository
+type MemoryInbound struct {
+	mu     sync.RWMutex
+	events []InboundEvent // oldest first
+	nextID int
+}
+
+func NewMemoryInbound() *MemoryInbound {
+	return &MemoryInbound{nextID: 1}
+}
+
+func (m *MemoryInbound) Record(ctx context.Context, event InboundEvent) (InboundEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.events {
+		if existing.Source == event.Source && (existing.DeliveryID == event.DeliveryID || (event.Digest != "" && existing.Digest == event.Digest)) {
+			return existing, ErrConflict
+		}
+	}
+	event.ID = strconv.Itoa(m.nextID)
+	m.nextID++
+	event.ReceivedAt = time.Now().UTC()
+	event.DispatchedAt = nil
+	m.events = append(m.events, event)
+	return event, nil
+}
+
+func (m *MemoryInbound) MarkDispatched(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.events {
+		if m.events[i].ID == id {
+			now := time.Now().UTC()
+			m.events[i].DispatchedAt = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryInbound) List(ctx context.Context, source string, limit int) ([]InboundEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := make([]InboundEvent, 0)
+	for i := len(m.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if source == "" || m.events[i].Source == source {
+			events = append(events, m.events[i])
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryInbound) Purge(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.events[:0]
+	for _, event := range m.events {
+		if !event.ReceivedAt.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	n := len(m.events) - len(kept)
+	m.events = kept
+	return n, nil
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+type keyUsageID struct {
+	keyID, date, route string
+}
+
+// MemoryKeyUsage is an in-memory KeyUsageRepository. Counts last until the
+// process exits.
+type MemoryKeyUsage struct {
+	mu    sync.RWMutex
+	usage map[keyUsageID]KeyUsage
+}
+
+func NewMemoryKeyUsage() *MemoryKeyUsage {
+	return &MemoryKeyUsage{usage: make(map[keyUsageID]KeyUsage)}
+}
+
+func (m *MemoryKeyUsage) Add(ctx context.Context, usage []KeyUsage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range usage {
+		id := keyUsageID{keyID: u.KeyID, date: u.Date, route: u.Route}
+		kept, ok := m.usage[id]
+		if ok {
+			u.Requests += kept.Requests
+			u.ClientErrors += kept.ClientErrors
+			u.ServerErrors += kept.ServerErrors
+			if kept.LastUsed.After(u.LastUsed) {
+				u.LastUsed = kept.LastUsed
+			}
+		}
+		m.usage[id] = u
+	}
+	return nil
+}
+
+func (m *MemoryKeyUsage) List(ctx context.Context, since string) ([]KeyUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	usage := make([]KeyUsage, 0, len(m.usage))
+	for _, u := range m.usage {
+		if u.Date >= since {
+			usage = append(usage, u)
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].KeyID != usage[j].KeyID {
+			return usage[i].KeyID < usage[j].KeyID
+		}
+		if usage[i].Date != usage[j].Date {
+			return usage[i].Date < usage[j].Date
+		}
+		return usage[i].Route < usage[j].Route
+	})
+	return usage, nil
+}
+
+func (m *MemoryKeyUsage) Prune(ctx context.Context, before string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id := range m.usage {
+		if id.date < before {
+			delete(m.usage, id)
+		}
+	}
+	return nil
+}
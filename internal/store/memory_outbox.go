@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+type memoryOutboxEvent struct {
+	OutboxEvent
+	availableAt time.Time
+	deliveredAt *time.Time
+	failedAt    *time.Time
+}
+
+func (m *MemoryCustomers) Pending(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	events := make([]OutboxEvent, 0)
+	undelivered := map[string]bool{} // keys with an earlier undelivered event
+	for _, event := range m.outbox {
+		if len(events) == limit {
+			break
+		}
+		if event.deliveredAt != nil || event.failedAt != nil {
+			continue
+		}
+		if !event.availableAt.After(now) && !undelivered[event.Key] {
+			events = append(events, event.OutboxEvent)
+		}
+		if event.Key != "" {
+			undelivered[event.Key] = true
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryCustomers) MarkDelivered(ctx context.Context, id string) error {
+	return m.updateEvent(id, func(event *memoryOutboxEvent) {
+		now := time.Now().UTC()
+		event.deliveredAt = &now
+		event.Attempts++
+		event.LastError = ""
+	})
+}
+
+func (m *MemoryCustomers) MarkFailed(ctx context.Context, id, reason string, retryAt time.Time) error {
+	return m.updateEvent(id, func(event *memoryOutboxEvent) {
+		event.availableAt = retryAt
+		event.Attempts++
+		event.LastError = reason
+	})
+}
+
+func (m *MemoryCustomers) MarkDead(ctx context.Context, id, reason string) error {
+	return m.updateEvent(id, func(event *memoryOutboxEvent) {
+		now := time.Now().UTC()
+		event.failedAt = &now
+		event.Attempts++
+		event.LastError = reason
+	})
+}
+
+func (m *MemoryCustomers) Purge(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.outbox[:0]
+	for _, event := range m.outbox {
+		done := event.deliveredAt
+		if done == nil {
+			done = event.failedAt
+		}
+		if done == nil || !done.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	purged := len(m.outbox) - len(kept)
+	m.outbox = kept
+	return purged, nil
+}
+
+// updateEvent applies fn to the outbox event with the given ID
+func (m *MemoryCustomers) updateEvent(id string, fn func(*memoryOutboxEvent)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.outbox {
+		if m.outbox[i].ID == id {
+			fn(&m.outbox[i])
+			return nil
+		}
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemorySettings is an in-memory SettingsRepository. Settings last until
+// the process exits.
+type MemorySettings struct {
+	mu       sync.RWMutex
+	settings map[string]Setting
+}
+
+func NewMemorySettings() *MemorySettings {
+	return &MemorySettings{settings: make(map[string]Setting)}
+}
+
+func (m *MemorySettings) List(ctx context.Context) ([]Setting, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	settings := make([]Setting, 0, len(m.settings))
+	for _, setting := range m.settings {
+		settings = append(settings, setting)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	return settings, nil
+}
+
+func (m *MemorySettings) Put(ctx context.Context, setting Setting) (Setting, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	setting.UpdatedAt = time.Now().UTC()
+	m.settings[setting.Name] = setting
+	return setting, nil
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryUsers is an in-memory UserRepository
+type MemoryUsers struct {
+	mu     sync.RWMutex
+	users  map[string]User
+	nextID int
+}
+
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{
+		users:  make(map[string]User),
+		nextID: 1,
+	}
+}
+
+func (m *MemoryUsers) List(ctx context.Context) ([]User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, copyUser(user))
+	}
+	sort.Slice(users, func(i, j int) bool {
+		a, _ := strconv.Atoi(users[i].ID)
+		b, _ := strconv.Atoi(users[j].ID)
+		return a < b
+	})
+	return users, nil
+}
+
+func (m *MemoryUsers) Get(ctx context.Context, id string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (m *MemoryUsers) GetByUsername(ctx context.Context, username string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if strings.EqualFold(user.Username, username) {
+			return copyUser(user), nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (m *MemoryUsers) Create(ctx context.Context, user User) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.usernameTaken(user.Username, "") {
+		return User{}, ErrConflict
+	}
+	now := time.Now().UTC()
+	user.ID = strconv.Itoa(m.nextID)
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	m.nextID++
+	m.users[user.ID] = copyUser(user)
+	return user, nil
+}
+
+func (m *MemoryUsers) Update(ctx context.Context, user User) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.users[user.ID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	if m.usernameTaken(user.Username, user.ID) {
+		return User{}, ErrConflict
+	}
+	user.CreatedAt = existing.CreatedAt
+	user.UpdatedAt = time.Now().UTC()
+	m.users[user.ID] = copyUser(user)
+	return user, nil
+}
+
+func (m *MemoryUsers) ReplacePasswordHash(ctx context.Context, id, oldHash, newHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || user.PasswordHash != oldHash {
+		return ErrNotFound
+	}
+	user.PasswordHash = newHash
+	m.users[id] = user
+	return nil
+}
+
+// Delete removes the user. Devices and identities are kept in their own
+// repositories; those of a deleted user no longer resolve to a user.
+func (m *MemoryUsers) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.users, id)
+	return nil
+}
+
+// usernameTaken reports whether another user has the username. The caller
+// must hold m.mu.
+func (m *MemoryUsers) usernameTaken(username, exceptID string) bool {
+	for id, user := range m.users {
+		if id != exceptID && strings.EqualFold(user.Username, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyUser returns user with its own roles and tenants slices
+func copyUser(user User) User {
+	user.Roles = append([]string{}, user.Roles...)
+	if user.Tenants != nil {
+		user.Tenants = append([]string{}, user.Tenants...)
+	}
+	return user
+}
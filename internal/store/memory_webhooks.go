@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryWebhooks is an in-memory WebhookRepository. Subscriptions last
+// until the process exits.
+type MemoryWebhooks struct {
+	mu            sync.RWMutex
+	subscriptions map[string]WebhookSubscription
+	nextID        int
+}
+
+func NewMemoryWebhooks() *MemoryWebhooks {
+	return &MemoryWebhooks{
+		subscriptions: make(map[string]WebhookSubscription),
+		nextID:        1,
+	}
+}
+
+func (m *MemoryWebhooks) List(ctx context.Context) ([]WebhookSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subs := make([]WebhookSubscription, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		sub.Events = append([]string(nil), sub.Events...)
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		a, _ := strconv.Atoi(subs[i].ID)
+		b, _ := strconv.Atoi(subs[j].ID)
+		return a < b
+	})
+	return subs, nil
+}
+
+func (m *MemoryWebhooks) Create(ctx context.Context, sub WebhookSubscription) (WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub.ID = strconv.Itoa(m.nextID)
+	sub.CreatedAt = time.Now().UTC()
+	sub.Events = append([]string(nil), sub.Events...)
+	m.nextID++
+	m.subscriptions[sub.ID] = sub
+	return sub, nil
+}
+
+func (m *MemoryWebhooks) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.subscriptions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.subscriptions, id)
+	return nil
+}
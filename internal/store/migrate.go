@@ -0,0 +1,287 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationFiles holds the schema of each dialect as numbered pairs of
+// files in migrations/<dialect>/: NNNN_name.up.sql applies a change and
+// NNNN_name.down.sql reverts it
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrPendingMigrations is returned by Open when the schema is behind the
+// binary and pending migrations aren't applied automatically
+var ErrPendingMigrations = errors.New("pending migrations")
+
+// Migration is a numbered change of the schema. AppliedAt is nil for
+// migrations not applied yet.
+type Migration struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+
+	up, down string
+}
+
+// loadMigrations reads the migrations of d, which must be numbered from 1
+// without gaps, each with an up and a down file
+func loadMigrations(d dialect) ([]Migration, error) {
+	dir := "migrations/" + d.name
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s migrations: %w", d.name, err)
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s must be named NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		switch {
+		case m.Version != i+1:
+			return nil, fmt.Errorf("%s migration %d is missing", d.name, i+1)
+		case m.up == "" || m.down == "":
+			return nil, fmt.Errorf("%s migration %d needs both an up and a down file", d.name, m.Version)
+		}
+	}
+	return migrations, nil
+}
+
+// migrate applies the pending migrations of the store opened as db, unless
+// they are applied manually, in which case it fails while any are pending
+func migrate(ctx context.Context, db *sql.DB, d dialect, manual bool) error {
+	m, err := newMigrator(ctx, db, d)
+	if err != nil {
+		return err
+	}
+	if !manual {
+		_, err = m.Up(ctx, 0)
+		return err
+	}
+	pending, err := m.Pending(ctx)
+	if err == nil && len(pending) > 0 {
+		err = fmt.Errorf("%w: %d to apply with \"server migrate up\"", ErrPendingMigrations, len(pending))
+	}
+	return err
+}
+
+// Migrator applies and reverts the migrations of a SQL store
+type Migrator struct {
+	db         *sql.DB
+	d          dialect
+	migrations []Migration
+}
+
+// NewMigrator connects to the configured SQL backend without migrating it.
+// The memory backend has no schema to migrate.
+func NewMigrator(ctx context.Context, cfg Config) (*Migrator, error) {
+	db, d, err := openDB(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMigrator(ctx, db, d)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func newMigrator(ctx context.Context, db *sql.DB, d dialect) (*Migrator, error) {
+	migrations, err := loadMigrations(d)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+	return &Migrator{db: db, d: d, migrations: migrations}, nil
+}
+
+// Close releases the database connections
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// Status lists the migrations of the binary, with when each was applied.
+// Versions applied by a newer binary are listed too, without a name.
+func (m *Migrator) Status(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]Migration, len(m.migrations))
+	copy(status, m.migrations)
+	for i := range status {
+		if at, ok := applied[status[i].Version]; ok {
+			status[i].AppliedAt = &at
+		}
+	}
+	var newer []int
+	for version := range applied {
+		if version > len(m.migrations) {
+			newer = append(newer, version)
+		}
+	}
+	sort.Ints(newer)
+	for _, version := range newer {
+		at := applied[version]
+		status = append(status, Migration{Version: version, AppliedAt: &at})
+	}
+	return status, nil
+}
+
+// Pending returns the migrations after the schema's current version
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	current, err := m.version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current >= len(m.migrations) {
+		return nil, nil
+	}
+	return m.migrations[current:], nil
+}
+
+// Up applies up to steps pending migrations, or all of them when steps is
+// 0, and returns those applied. Each migration runs in its own
+// transaction.
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+	var done []Migration
+	for _, migration := range pending {
+		err := m.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, migration.up); err != nil {
+				return fmt.Errorf("migration %d failed: %w", migration.Version, err)
+			}
+			if _, err := tx.ExecContext(ctx, m.d.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), migration.Version, time.Now().UTC()); err != nil {
+				return fmt.Errorf("error recording migration %d: %w", migration.Version, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the latest steps migrations, newest first, and returns those
+// reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	for ; steps > 0; steps-- {
+		current, err := m.version(ctx)
+		if err != nil {
+			return done, err
+		}
+		switch {
+		case current == 0:
+			return done, nil
+		case current > len(m.migrations):
+			return done, fmt.Errorf("migration %d was applied by a newer binary and can't be reverted by this one", current)
+		}
+		migration := m.migrations[current-1]
+		err = m.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, migration.down); err != nil {
+				return fmt.Errorf("reverting migration %d failed: %w", migration.Version, err)
+			}
+			if _, err := tx.ExecContext(ctx, m.d.rebind(`DELETE FROM schema_migrations WHERE version = ?`), migration.Version); err != nil {
+				return fmt.Errorf("error recording the revert of migration %d: %w", migration.Version, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// version returns the latest applied migration, 0 for an empty schema
+func (m *Migrator) version(ctx context.Context) (int, error) {
+	var current int
+	if err := m.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return 0, fmt.Errorf("error reading schema version: %w", err)
+	}
+	return current, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,4 @@
+DROP TABLE customer_history;
+DROP INDEX customers_email;
+ALTER TABLE customers DROP COLUMN deleted_at;
+CREATE UNIQUE INDEX customers_email ON customers (lower(email)) WHERE email <> '';
@@ -0,0 +1,14 @@
+-- Soft deletes and change history
+ALTER TABLE customers ADD COLUMN deleted_at TIMESTAMPTZ;
+DROP INDEX customers_email;
+CREATE UNIQUE INDEX customers_email ON customers (lower(email)) WHERE email <> '' AND deleted_at IS NULL;
+CREATE TABLE customer_history (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    customer_id BIGINT NOT NULL REFERENCES customers (id),
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    before_data JSONB,
+    after_data JSONB,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX customer_history_customer ON customer_history (customer_id, id);
@@ -0,0 +1,2 @@
+DROP INDEX customers_search;
+ALTER TABLE customers DROP COLUMN search;
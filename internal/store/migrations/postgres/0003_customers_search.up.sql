@@ -0,0 +1,4 @@
+-- Full-text search
+ALTER TABLE customers ADD COLUMN search tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', name || ' ' || email)) STORED;
+CREATE INDEX customers_search ON customers USING GIN (search);
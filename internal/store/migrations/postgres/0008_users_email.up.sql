@@ -0,0 +1,2 @@
+-- Email addresses of users, for password resets and notifications
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- Events received from inbound webhook sources
+CREATE TABLE inbound_webhooks (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    source TEXT NOT NULL,
+    delivery_id TEXT NOT NULL,
+    event_type TEXT NOT NULL DEFAULT '',
+    payload JSONB NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL,
+    dispatched_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX inbound_webhooks_delivery ON inbound_webhooks (source, delivery_id);
+CREATE INDEX inbound_webhooks_received ON inbound_webhooks (received_at);
@@ -0,0 +1,11 @@
+-- Administrative changes: who changed what, and how
+CREATE TABLE audit_log (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    actor TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    target TEXT NOT NULL DEFAULT '',
+    details JSONB,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX audit_log_created ON audit_log (created_at);
+CREATE INDEX audit_log_target ON audit_log (target, id);
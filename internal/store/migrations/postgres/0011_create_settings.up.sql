@@ -0,0 +1,7 @@
+-- Runtime settings changed through the admin API, kept across restarts
+CREATE TABLE settings (
+    name TEXT PRIMARY KEY,
+    value JSONB NOT NULL,
+    updated_by TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,4 @@
+-- SHA-256 of the body of inbound webhooks, so a replay under another
+-- delivery ID is recognized too
+ALTER TABLE inbound_webhooks ADD COLUMN digest TEXT;
+CREATE UNIQUE INDEX inbound_webhooks_digest ON inbound_webhooks (source, digest);
@@ -0,0 +1,3 @@
+-- Counts the changes to a customer, for updates conditional on the
+-- version a client last read
+ALTER TABLE customers ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
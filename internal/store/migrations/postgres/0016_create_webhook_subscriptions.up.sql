@@ -0,0 +1,8 @@
+-- Subscriptions to outbound webhooks for domain events
+CREATE TABLE webhook_subscriptions (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    url TEXT NOT NULL,
+    events TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,3 @@
+-- When the relay gave up on an event after OUTBOX_MAX_ATTEMPTS attempts;
+-- failed events are no longer pending and don't hold back their key
+ALTER TABLE outbox ADD COLUMN failed_at TIMESTAMPTZ;
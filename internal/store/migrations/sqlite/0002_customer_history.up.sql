@@ -0,0 +1,14 @@
+-- Soft deletes and change history
+ALTER TABLE customers ADD COLUMN deleted_at TIMESTAMP;
+DROP INDEX customers_email;
+CREATE UNIQUE INDEX customers_email ON customers (lower(email)) WHERE email <> '' AND deleted_at IS NULL;
+CREATE TABLE customer_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    before_data TEXT,
+    after_data TEXT,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX customer_history_customer ON customer_history (customer_id, id);
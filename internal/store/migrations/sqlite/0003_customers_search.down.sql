@@ -0,0 +1,4 @@
+DROP TRIGGER customers_fts_insert;
+DROP TRIGGER customers_fts_update;
+DROP TRIGGER customers_fts_delete;
+DROP TABLE customers_fts;
@@ -0,0 +1,13 @@
+-- Full-text search index kept in sync by triggers
+CREATE VIRTUAL TABLE customers_fts USING fts5(name, email, content='customers', content_rowid='id');
+CREATE TRIGGER customers_fts_insert AFTER INSERT ON customers BEGIN
+    INSERT INTO customers_fts (rowid, name, email) VALUES (new.id, new.name, new.email);
+END;
+CREATE TRIGGER customers_fts_update AFTER UPDATE OF name, email ON customers BEGIN
+    INSERT INTO customers_fts (customers_fts, rowid, name, email) VALUES ('delete', old.id, old.name, old.email);
+    INSERT INTO customers_fts (rowid, name, email) VALUES (new.id, new.name, new.email);
+END;
+CREATE TRIGGER customers_fts_delete AFTER DELETE ON customers BEGIN
+    INSERT INTO customers_fts (customers_fts, rowid, name, email) VALUES ('delete', old.id, old.name, old.email);
+END;
+INSERT INTO customers_fts (customers_fts) VALUES ('rebuild');
@@ -0,0 +1,14 @@
+-- Remembered devices of users
+CREATE TABLE devices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    name TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    token_hash TEXT NOT NULL,
+    session_version INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE UNIQUE INDEX devices_token ON devices (token_hash);
+CREATE INDEX devices_user ON devices (user_id, id);
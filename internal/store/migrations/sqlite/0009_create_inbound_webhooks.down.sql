@@ -0,0 +1 @@
+DROP TABLE inbound_webhooks;
@@ -0,0 +1,12 @@
+-- Events received from inbound webhook sources
+CREATE TABLE inbound_webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    source TEXT NOT NULL,
+    delivery_id TEXT NOT NULL,
+    event_type TEXT NOT NULL DEFAULT '',
+    payload TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    dispatched_at TIMESTAMP
+);
+CREATE UNIQUE INDEX inbound_webhooks_delivery ON inbound_webhooks (source, delivery_id);
+CREATE INDEX inbound_webhooks_received ON inbound_webhooks (received_at);
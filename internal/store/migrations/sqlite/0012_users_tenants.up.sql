@@ -0,0 +1,2 @@
+-- Tenants a user acts for in authorization policy decisions
+ALTER TABLE users ADD COLUMN tenants TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP INDEX inbound_webhooks_digest;
+ALTER TABLE inbound_webhooks DROP COLUMN digest;
@@ -0,0 +1,12 @@
+-- Requests made with each API key per UTC day and route, flushed from the
+-- usage tracker so the 30 days reported survive restarts
+CREATE TABLE key_usage (
+    key_id TEXT NOT NULL,
+    date TEXT NOT NULL,
+    route TEXT NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    client_errors BIGINT NOT NULL DEFAULT 0,
+    server_errors BIGINT NOT NULL DEFAULT 0,
+    last_used TIMESTAMP NOT NULL,
+    PRIMARY KEY (key_id, date, route)
+);
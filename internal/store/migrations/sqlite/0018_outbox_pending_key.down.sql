@@ -0,0 +1 @@
+DROP INDEX outbox_pending_key;
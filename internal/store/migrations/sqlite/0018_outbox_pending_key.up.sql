@@ -0,0 +1,3 @@
+-- Lets Pending find the earlier undelivered events of a key without scanning
+-- the delivered ones kept for OUTBOX_RETENTION
+CREATE INDEX outbox_pending_key ON outbox (event_key, id) WHERE delivered_at IS NULL AND failed_at IS NULL;
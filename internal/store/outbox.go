@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent is a domain event recorded in the same transaction as the
+// write that caused it. It stays in the outbox until a relay has delivered
+// it, so a failure after the write commits cannot lose the event.
+type OutboxEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"` // customer.created, customer.updated, ...
+	Key       string          `json:"key"`  // customer ID; orders events of the same customer
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+}
+
+// Outbox holds domain events until they have been delivered
+type Outbox interface {
+	// Pending returns up to limit undelivered events that are due, oldest
+	// first, leaving out failed ones. An event is held back while an
+	// earlier event with the same key is undelivered and hasn't failed, so
+	// events of a key are delivered in order.
+	Pending(ctx context.Context, limit int) ([]OutboxEvent, error)
+	// MarkDelivered removes an event from the pending set
+	MarkDelivered(ctx context.Context, id string) error
+	// MarkFailed records a failed delivery and postpones the event until
+	// retryAt
+	MarkFailed(ctx context.Context, id, reason string, retryAt time.Time) error
+	// MarkDead records a last failed delivery and gives up on the event:
+	// it is no longer pending and no longer holds back its key
+	MarkDead(ctx context.Context, id, reason string) error
+	// Purge deletes events delivered, or given up on, before the given time
+	// and returns how many were removed
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+// outboxEvent builds the event for a customer change: the customer after
+// the change, or just its ID when it was deleted
+func outboxEvent(id, action string, after *Customer) (OutboxEvent, error) {
+	var data interface{} = map[string]string{"id": id}
+	if after != nil {
+		data = after
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return OutboxEvent{}, err
+	}
+	return OutboxEvent{
+		Type:      "customer." + action,
+		Key:       id,
+		Payload:   payload,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
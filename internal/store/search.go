@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Snippet markers are replaced with <mark> tags after the rest of the
+// snippet has been HTML-escaped
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// SearchResult is a customer matching a search, with its relevance (higher
+// is better) and an HTML snippet highlighting the matched terms
+type SearchResult struct {
+	Customer Customer `json:"customer" xml:"customer"`
+	Rank     float64  `json:"rank" xml:"rank"`
+	Snippet  string   `json:"snippet" xml:"snippet"`
+}
+
+// searchTerms splits a query into lower-case words, dropping punctuation so
+// user input can't inject query syntax
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// highlight escapes a snippet containing markStart/markEnd markers and
+// turns the markers into <mark> tags
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, markStart, "<mark>")
+	return strings.ReplaceAll(snippet, markEnd, "</mark>")
+}
+
+// Search matches terms against the start of words in the name and email
+func (m *MemoryCustomers) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	customers, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SearchResult, 0)
+	for _, customer := range customers {
+		text := strings.TrimSpace(customer.Name + " " + customer.Email)
+		snippet, hits, ok := markTerms(text, terms)
+		if !ok {
+			continue
+		}
+		results = append(results, SearchResult{
+			Customer: customer,
+			Rank:     float64(hits) / float64(len(searchTerms(text))),
+			Snippet:  highlight(snippet),
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Rank > results[j].Rank
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// markTerms wraps the words of text starting with any of terms in markers.
+// ok is false unless every term matched a word.
+func markTerms(text string, terms []string) (marked string, hits int, ok bool) {
+	matched := make(map[string]bool, len(terms))
+	var b strings.Builder
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		hit := false
+		for _, term := range terms {
+			if strings.HasPrefix(strings.ToLower(w), term) {
+				matched[term] = true
+				hit = true
+			}
+		}
+		if hit {
+			hits++
+			b.WriteString(markStart + w + markEnd)
+		} else {
+			b.WriteString(w)
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String(), hits, len(matched) == len(terms)
+}
+
+func (r *sqlCustomers) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	var statement, match string
+	switch r.dialect.name {
+	case "postgres":
+		// Prefix-match every term: alice:* & smith:*
+		match = strings.Join(terms, ":* & ") + ":*"
+		statement = `SELECT ` + customerColumns + `, ts_rank(search, q) AS rank,
+				ts_headline('simple', name || ' ' || email, q, 'StartSel="` + markStart + `", StopSel="` + markEnd + `", HighlightAll=true')
+			FROM customers, to_tsquery('simple', ?) q
+			WHERE search @@ q AND deleted_at IS NULL
+			ORDER BY rank DESC, id LIMIT ?`
+	default:
+		// Quote every term so FTS5 operators are taken literally: "alice"* "smith"*
+		match = `"` + strings.Join(terms, `"* "`) + `"*`
+		statement = `SELECT c.id, c.name, c.email, c.created_at, c.updated_at, c.deleted_at, -bm25(customers_fts) AS rank,
+				snippet(customers_fts, -1, '` + markStart + `', '` + markEnd + `', '…', 16)
+			FROM customers_fts JOIN customers c ON c.id = customers_fts.rowid
+			WHERE customers_fts MATCH ? AND c.deleted_at IS NULL
+			ORDER BY rank DESC, c.id LIMIT ?`
+	}
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.rebind(statement), match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]SearchResult, 0)
+	for rows.Next() {
+		var result SearchResult
+		var snippet string
+		result.Customer, err = scanCustomer(extraColumns{rows, []any{&result.Rank, &snippet}})
+		if err != nil {
+			return nil, err
+		}
+		result.Snippet = highlight(snippet)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// extraColumns scans a row holding a customer followed by more columns
+type extraColumns struct {
+	row   rowScanner
+	extra []any
+}
+
+func (e extraColumns) Scan(dest ...any) error {
+	return e.row.Scan(append(dest, e.extra...)...)
+}
@@ -0,0 +1,25 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Setting is a runtime setting changed through the admin API, kept so it
+// survives restarts. Value is its JSON encoding.
+type Setting struct {
+	Name      string          `json:"name"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedBy string          `json:"updated_by,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// SettingsRepository persists runtime settings
+type SettingsRepository interface {
+	// List returns every stored setting, ordered by name
+	List(ctx context.Context) ([]Setting, error)
+	// Put stores a setting, replacing any with the same name, and sets its
+	// update time
+	Put(ctx context.Context, setting Setting) (Setting, error)
+}
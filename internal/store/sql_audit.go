@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+const auditColumns = `id, actor, action, target, details, created_at`
+
+// sqlAudit is an AuditRepository backed by the audit_log table
+type sqlAudit struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSQLAudit(db *sql.DB, d dialect) *sqlAudit {
+	return &sqlAudit{db: db, dialect: d}
+}
+
+func scanAudit(row rowScanner) (AuditEntry, error) {
+	var entry AuditEntry
+	var id int64
+	var details sql.NullString
+	if err := row.Scan(&id, &entry.Actor, &entry.Action, &entry.Target, &details, &entry.CreatedAt); err != nil {
+		return AuditEntry{}, err
+	}
+	entry.ID = strconv.FormatInt(id, 10)
+	if details.Valid {
+		entry.Details = []byte(details.String)
+	}
+	return entry, nil
+}
+
+func (r *sqlAudit) Record(ctx context.Context, entry AuditEntry) (AuditEntry, error) {
+	var details interface{}
+	if len(entry.Details) > 0 {
+		details = string(entry.Details)
+	}
+	return scanAudit(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`INSERT INTO audit_log (actor, action, target, details, created_at)
+		VALUES (?, ?, ?, ?, ?) RETURNING `+auditColumns),
+		entry.Actor, entry.Action, entry.Target, details, time.Now().UTC()))
+}
+
+func (r *sqlAudit) List(ctx context.Context, target string, limit int) ([]AuditEntry, error) {
+	rows, err := r.db.QueryContext(ctx, r.dialect.rebind(
+		`SELECT `+auditColumns+` FROM audit_log WHERE ? = '' OR target = ? ORDER BY id DESC LIMIT ?`),
+		target, target, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]AuditEntry, 0)
+	for rows.Next() {
+		entry, err := scanAudit(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
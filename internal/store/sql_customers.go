@@ -0,0 +1,296 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// sqlCustomers is a CustomerRepository backed by SQLite or Postgres
+type sqlCustomers struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSQLCustomers(db *sql.DB, d dialect) *sqlCustomers {
+	return &sqlCustomers{db: db, dialect: d}
+}
+
+const customerColumns = `id, name, email, created_at, updated_at, deleted_at, version`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func scanCustomer(row rowScanner) (Customer, error) {
+	var c Customer
+	var id int64
+	var deletedAt sql.NullTime
+	if err := row.Scan(&id, &c.Name, &c.Email, &c.CreatedAt, &c.UpdatedAt, &deletedAt, &c.Version); err != nil {
+		return Customer{}, err
+	}
+	c.ID = strconv.FormatInt(id, 10)
+	if deletedAt.Valid {
+		c.DeletedAt = &deletedAt.Time
+	}
+	return c, nil
+}
+
+func (r *sqlCustomers) List(ctx context.Context) ([]Customer, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+customerColumns+` FROM customers WHERE deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	customers := make([]Customer, 0)
+	for rows.Next() {
+		c, err := scanCustomer(rows)
+		if err != nil {
+			return nil, err
+		}
+		customers = append(customers, c)
+	}
+	return customers, rows.Err()
+}
+
+func (r *sqlCustomers) Get(ctx context.Context, id string) (Customer, error) {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return Customer{}, ErrNotFound
+	}
+	return r.get(ctx, r.db, key, false)
+}
+
+// get loads a customer that is live, or deleted when deleted is true
+func (r *sqlCustomers) get(ctx context.Context, q querier, key int64, deleted bool) (Customer, error) {
+	condition := `deleted_at IS NULL`
+	if deleted {
+		condition = `deleted_at IS NOT NULL`
+	}
+	c, err := scanCustomer(q.QueryRowContext(ctx,
+		r.dialect.rebind(`SELECT `+customerColumns+` FROM customers WHERE id = ? AND `+condition), key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Customer{}, ErrNotFound
+	}
+	return c, err
+}
+
+func (r *sqlCustomers) Create(ctx context.Context, customer Customer) (Customer, error) {
+	var c Customer
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+		var err error
+		c, err = scanCustomer(tx.QueryRowContext(ctx,
+			r.dialect.rebind(`INSERT INTO customers (name, email, created_at, updated_at) VALUES (?, ?, ?, ?) RETURNING `+customerColumns),
+			customer.Name, customer.Email, now, now))
+		if err != nil {
+			return err
+		}
+		return r.record(ctx, tx, c.ID, ActionCreated, nil, &c)
+	})
+	return c, err
+}
+
+func (r *sqlCustomers) Update(ctx context.Context, customer Customer) (Customer, error) {
+	key, err := strconv.ParseInt(customer.ID, 10, 64)
+	if err != nil {
+		return Customer{}, ErrNotFound
+	}
+
+	var c Customer
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := r.get(ctx, tx, key, false)
+		if err != nil {
+			return err
+		}
+		// The version is checked again by the update itself, in case of a
+		// concurrent write since the read
+		c, err = scanCustomer(tx.QueryRowContext(ctx,
+			r.dialect.rebind(`UPDATE customers SET name = ?, email = ?, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?) RETURNING `+customerColumns),
+			customer.Name, customer.Email, time.Now().UTC(), key, customer.Version, customer.Version))
+		if errors.Is(err, sql.ErrNoRows) {
+			return missingOrModified(customer.Version)
+		}
+		if err != nil {
+			return err
+		}
+		return r.record(ctx, tx, c.ID, ActionUpdated, &before, &c)
+	})
+	return c, err
+}
+
+func (r *sqlCustomers) Delete(ctx context.Context, id string, version int) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := r.get(ctx, tx, key, false)
+		if err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx,
+			r.dialect.rebind(`UPDATE customers SET deleted_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)`),
+			time.Now().UTC(), key, version, version)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return missingOrModified(version)
+		}
+		return r.record(ctx, tx, id, ActionDeleted, &before, nil)
+	})
+}
+
+func (r *sqlCustomers) Restore(ctx context.Context, id string) (Customer, error) {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return Customer{}, ErrNotFound
+	}
+
+	var c Customer
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		c, err = scanCustomer(tx.QueryRowContext(ctx,
+			r.dialect.rebind(`UPDATE customers SET deleted_at = NULL, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL RETURNING `+customerColumns),
+			time.Now().UTC(), key))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return r.record(ctx, tx, id, ActionRestored, nil, &c)
+	})
+	return c, err
+}
+
+func (r *sqlCustomers) History(ctx context.Context, id string) ([]Change, error) {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.rebind(
+		`SELECT id, action, actor, before_data, after_data, created_at FROM customer_history WHERE customer_id = ? ORDER BY id`), key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]Change, 0)
+	for rows.Next() {
+		var change Change
+		var changeID int64
+		var before, after sql.NullString
+		if err := rows.Scan(&changeID, &change.Action, &change.Actor, &before, &after, &change.Time); err != nil {
+			return nil, err
+		}
+		change.ID = strconv.FormatInt(changeID, 10)
+		change.CustomerID = id
+		if change.Before, err = decodeSnapshot(before); err != nil {
+			return nil, err
+		}
+		if change.After, err = decodeSnapshot(after); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, ErrNotFound
+	}
+	return changes, nil
+}
+
+// record adds a history entry and queues the matching outbox event within
+// the write's transaction
+func (r *sqlCustomers) record(ctx context.Context, tx *sql.Tx, id, action string, before, after *Customer) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return err
+	}
+	beforeData, err := encodeSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterData, err := encodeSnapshot(after)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, r.dialect.rebind(
+		`INSERT INTO customer_history (customer_id, action, actor, before_data, after_data, created_at) VALUES (?, ?, ?, ?, ?, ?)`),
+		key, action, ActorFromContext(ctx), beforeData, afterData, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	event, err := outboxEvent(id, action, after)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, r.dialect.rebind(
+		`INSERT INTO outbox (event_type, event_key, payload, created_at, available_at) VALUES (?, ?, ?, ?, ?)`),
+		event.Type, event.Key, string(event.Payload), event.CreatedAt, event.CreatedAt)
+	return err
+}
+
+// missingOrModified is the error of a write, conditional on version unless
+// it is 0, that matched no row after the customer was read
+func missingOrModified(version int) error {
+	if version == 0 {
+		return ErrNotFound
+	}
+	return ErrModified
+}
+
+// inTx runs fn in a transaction, committing if it succeeds and mapping
+// unique violations to ErrConflict
+func (r *sqlCustomers) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		if r.dialect.isUniqueViolation(err) {
+			return ErrConflict
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+func encodeSnapshot(c *Customer) (any, error) {
+	if c == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func decodeSnapshot(data sql.NullString) (*Customer, error) {
+	if !data.Valid {
+		return nil, nil
+	}
+	var c Customer
+	if err := json.Unmarshal([]byte(data.String), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
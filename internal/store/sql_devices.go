@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// sqlDevices is a DeviceRepository backed by SQLite or Postgres
+type sqlDevices struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSQLDevices(db *sql.DB, d dialect) *sqlDevices {
+	return &sqlDevices{db: db, dialect: d}
+}
+
+const deviceColumns = `id, user_id, name, ip, token_hash, session_version, created_at, last_used_at, expires_at`
+
+func scanDevice(row rowScanner) (Device, error) {
+	var d Device
+	var id, userID int64
+	if err := row.Scan(&id, &userID, &d.Name, &d.IP, &d.TokenHash, &d.SessionVersion,
+		&d.CreatedAt, &d.LastUsedAt, &d.ExpiresAt); err != nil {
+		return Device{}, err
+	}
+	d.ID = strconv.FormatInt(id, 10)
+	d.UserID = strconv.FormatInt(userID, 10)
+	return d, nil
+}
+
+func (r *sqlDevices) ListByUser(ctx context.Context, userID string) ([]Device, error) {
+	key, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return []Device{}, nil
+	}
+	rows, err := r.db.QueryContext(ctx, r.dialect.rebind(`SELECT `+deviceColumns+` FROM devices WHERE user_id = ? ORDER BY id`), key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := make([]Device, 0)
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+func (r *sqlDevices) GetByTokenHash(ctx context.Context, tokenHash string) (Device, error) {
+	d, err := scanDevice(r.db.QueryRowContext(ctx,
+		r.dialect.rebind(`SELECT `+deviceColumns+` FROM devices WHERE token_hash = ?`), tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Device{}, ErrNotFound
+	}
+	return d, err
+}
+
+func (r *sqlDevices) Create(ctx context.Context, device Device) (Device, error) {
+	userID, err := strconv.ParseInt(device.UserID, 10, 64)
+	if err != nil {
+		return Device{}, ErrNotFound
+	}
+	now := time.Now().UTC()
+	if device.LastUsedAt.IsZero() {
+		device.LastUsedAt = now
+	}
+	return scanDevice(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`INSERT INTO devices (user_id, name, ip, token_hash, session_version, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING `+deviceColumns),
+		userID, device.Name, device.IP, device.TokenHash, device.SessionVersion, now, device.LastUsedAt.UTC(), device.ExpiresAt.UTC()))
+}
+
+func (r *sqlDevices) Touch(ctx context.Context, id, ip string, at time.Time) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	return r.exec(ctx, `UPDATE devices SET ip = ?, last_used_at = ? WHERE id = ?`, ip, at.UTC(), key)
+}
+
+func (r *sqlDevices) Delete(ctx context.Context, userID, id string) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	user, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	return r.exec(ctx, `DELETE FROM devices WHERE id = ? AND user_id = ?`, key, user)
+}
+
+func (r *sqlDevices) DeleteExpired(ctx context.Context, t time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, r.dialect.rebind(`DELETE FROM devices WHERE expires_at < ?`), t.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// exec runs a statement on a single device, returning ErrNotFound if there
+// is no such device
+func (r *sqlDevices) exec(ctx context.Context, query string, args ...any) error {
+	result, err := r.db.ExecContext(ctx, r.dialect.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// sqlIdentities is an IdentityRepository backed by SQLite or Postgres
+type sqlIdentities struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSQLIdentities(db *sql.DB, d dialect) *sqlIdentities {
+	return &sqlIdentities{db: db, dialect: d}
+}
+
+const identityColumns = `provider, subject, user_id, created_at`
+
+func (r *sqlIdentities) Get(ctx context.Context, provider, subject string) (Identity, error) {
+	return r.one(r.db.QueryRowContext(ctx,
+		r.dialect.rebind(`SELECT `+identityColumns+` FROM identities WHERE provider = ? AND subject = ?`), provider, subject))
+}
+
+func (r *sqlIdentities) Create(ctx context.Context, identity Identity) (Identity, error) {
+	userID, err := strconv.ParseInt(identity.UserID, 10, 64)
+	if err != nil {
+		return Identity{}, ErrNotFound
+	}
+	return r.one(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`INSERT INTO identities (provider, subject, user_id, created_at) VALUES (?, ?, ?, ?) RETURNING `+identityColumns),
+		identity.Provider, identity.Subject, userID, time.Now().UTC()))
+}
+
+// one scans a single identity, mapping missing rows and linked accounts to
+// the repository errors
+func (r *sqlIdentities) one(row *sql.Row) (Identity, error) {
+	var identity Identity
+	var userID int64
+	err := row.Scan(&identity.Provider, &identity.Subject, &userID, &identity.CreatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Identity{}, ErrNotFound
+	case r.dialect.isUniqueViolation(err):
+		return Identity{}, ErrConflict
+	case err != nil:
+		return Identity{}, err
+	}
+	identity.UserID = strconv.FormatInt(userID, 10)
+	return identity, nil
+}
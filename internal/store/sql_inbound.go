@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+const inboundColumns = `id, source, delivery_id, event_type, payload, received_at, dispatched_at`
+
+// sqlInbound is an InboundRepository backed by the inbound_webhooks table
+type sqlInbound struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSQLInbound(db *sql.DB, d dialect) *sqlInbound {
+	return &sqlInbound{db: db, dialect: d}
+}
+
+func scanInbound(row rowScanner) (InboundEvent, error) {
+	var event InboundEvent
+	var id int64
+	var payload string
+	var dispatched sql.NullTime
+	if err := row.Scan(&id, &event.Source, &event.DeliveryID, &event.Type, &payload, &event.ReceivedAt, &dispatched); err != nil {
+		return InboundEvent{}, err
+	}
+	event.ID = strconv.FormatInt(id, 10)
+	event.Payload = []byte(payload)
+	if dispatched.Valid {
+		event.DispatchedAt = &dispatched.Time
+	}
+	return event, nil
+}
+
+func (r *sqlInbound) Record(ctx context.Context, event InboundEvent) (InboundEvent, error) {
+	recorded, err := scanInbound(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`INSERT INTO inbound_webhooks (source, delivery_id, digest, event_type, payload, received_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING `+inboundColumns),
+		event.Source, event.DeliveryID, event.Digest, event.Type, string(event.Payload), time.Now().UTC()))
+	if !r.dialect.isUniqueViolation(err) {
+		return recorded, err
+	}
+
+	existing, err := scanInbound(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`SELECT `+inboundColumns+` FROM inbound_webhooks WHERE source = ? AND (delivery_id = ? OR digest = ?)
+		ORDER BY id LIMIT 1`),
+		event.Source, event.DeliveryID, event.Digest))
+	if err != nil {
+		return InboundEvent{}, err
+	}
+	return existing, ErrConflict
+}
+
+func (r *sqlInbound) MarkDispatched(ctx context.Context, id string) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.db.ExecContext(ctx, r.dialect.rebind(
+		`UPDATE inbound_webhooks SET dispatched_at = ? WHERE id = ?`), time.Now().UTC(), key)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlInbound) List(ctx context.Context, source string, limit int) ([]InboundEvent, error) {
+	rows, err := r.db.QueryContext(ctx, r.dialect.rebind(
+		`SELECT `+inboundColumns+` FROM inbound_webhooks WHERE ? = '' OR source = ? ORDER BY id DESC LIMIT ?`),
+		source, source, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]InboundEvent, 0)
+	for rows.Next() {
+		event, err := scanInbound(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *sqlInbound) Purge(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, r.dialect.rebind(
+		`DELETE FROM inbound_webhooks WHERE received_at < ?`), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
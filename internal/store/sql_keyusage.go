@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// sqlKeyUsage is a KeyUsageRepository backed by the key_usage table
+type sqlKeyUsage struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSQLKeyUsage(db *sql.DB, d dialect) *sqlKeyUsage {
+	return &sqlKeyUsage{db: db, dialect: d}
+}
+
+// Add upserts every count in one transaction, so a failed flush adds
+// nothing and can be retried whole
+func (r *sqlKeyUsage) Add(ctx context.Context, usage []KeyUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, r.dialect.rebind(
+		`INSERT INTO key_usage (key_id, date, route, requests, client_errors, server_errors, last_used)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key_id, date, route) DO UPDATE SET
+			requests = key_usage.requests + excluded.requests,
+			client_errors = key_usage.client_errors + excluded.client_errors,
+			server_errors = key_usage.server_errors + excluded.server_errors,
+			last_used = CASE WHEN excluded.last_used > key_usage.last_used THEN excluded.last_used ELSE key_usage.last_used END`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, u := range usage {
+		if _, err := stmt.ExecContext(ctx, u.KeyID, u.Date, u.Route,
+			int64(u.Requests), int64(u.ClientErrors), int64(u.ServerErrors), u.LastUsed.UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlKeyUsage) List(ctx context.Context, since string) ([]KeyUsage, error) {
+	rows, err := r.db.QueryContext(ctx, r.dialect.rebind(
+		`SELECT key_id, date, route, requests, client_errors, server_errors, last_used
+		FROM key_usage WHERE date >= ? ORDER BY key_id, date, route`), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make([]KeyUsage, 0)
+	for rows.Next() {
+		var u KeyUsage
+		var requests, clientErrors, serverErrors int64
+		if err := rows.Scan(&u.KeyID, &u.Date, &u.Route, &requests, &clientErrors, &serverErrors, &u.LastUsed); err != nil {
+			return nil, err
+		}
+		u.Requests, u.ClientErrors, u.ServerErrors = uint64(requests), uint64(clientErrors), uint64(serverErrors)
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+func (r *sqlKeyUsage) Prune(ctx context.Context, before string) error {
+	_, err := r.db.ExecContext(ctx, r.dialect.rebind(`DELETE FROM key_usage WHERE date < ?`), before)
+	return err
+}
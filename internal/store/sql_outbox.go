@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// sqlOutbox is an Outbox backed by the outbox table that the customer
+// repository writes to
+type sqlOutbox struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSQLOutbox(db *sql.DB, d dialect) *sqlOutbox {
+	return &sqlOutbox{db: db, dialect: d}
+}
+
+func (o *sqlOutbox) Pending(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	rows, err := o.db.QueryContext(ctx, o.dialect.rebind(
+		`SELECT id, event_type, event_key, payload, created_at, attempts, last_error FROM outbox
+		WHERE delivered_at IS NULL AND failed_at IS NULL AND available_at <= ?
+		AND NOT EXISTS (SELECT 1 FROM outbox earlier WHERE earlier.event_key = outbox.event_key
+			AND earlier.event_key <> '' AND earlier.id < outbox.id
+			AND earlier.delivered_at IS NULL AND earlier.failed_at IS NULL)
+		ORDER BY id LIMIT ?`), time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]OutboxEvent, 0)
+	for rows.Next() {
+		var event OutboxEvent
+		var id int64
+		var payload string
+		if err := rows.Scan(&id, &event.Type, &event.Key, &payload, &event.CreatedAt, &event.Attempts, &event.LastError); err != nil {
+			return nil, err
+		}
+		event.ID = strconv.FormatInt(id, 10)
+		event.Payload = []byte(payload)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (o *sqlOutbox) MarkDelivered(ctx context.Context, id string) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	return o.exec(ctx, `UPDATE outbox SET delivered_at = ?, attempts = attempts + 1, last_error = '' WHERE id = ?`,
+		time.Now().UTC(), key)
+}
+
+func (o *sqlOutbox) MarkFailed(ctx context.Context, id, reason string, retryAt time.Time) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	return o.exec(ctx, `UPDATE outbox SET available_at = ?, attempts = attempts + 1, last_error = ? WHERE id = ?`,
+		retryAt.UTC(), reason, key)
+}
+
+func (o *sqlOutbox) MarkDead(ctx context.Context, id, reason string) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	return o.exec(ctx, `UPDATE outbox SET failed_at = ?, attempts = attempts + 1, last_error = ? WHERE id = ?`,
+		time.Now().UTC(), reason, key)
+}
+
+func (o *sqlOutbox) Purge(ctx context.Context, before time.Time) (int, error) {
+	result, err := o.db.ExecContext(ctx, o.dialect.rebind(
+		`DELETE FROM outbox WHERE delivered_at < ? OR failed_at < ?`), before.UTC(), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// exec runs an update of a single event, returning ErrNotFound if there is
+// no such event
+func (o *sqlOutbox) exec(ctx context.Context, query string, args ...any) error {
+	result, err := o.db.ExecContext(ctx, o.dialect.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
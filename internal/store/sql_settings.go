@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// sqlSettings is a SettingsRepository backed by the settings table
+type sqlSettings struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSQLSettings(db *sql.DB, d dialect) *sqlSettings {
+	return &sqlSettings{db: db, dialect: d}
+}
+
+func (r *sqlSettings) List(ctx context.Context) ([]Setting, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT name, value, updated_by, updated_at FROM settings ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make([]Setting, 0)
+	for rows.Next() {
+		var setting Setting
+		var value string
+		if err := rows.Scan(&setting.Name, &value, &setting.UpdatedBy, &setting.UpdatedAt); err != nil {
+			return nil, err
+		}
+		setting.Value = []byte(value)
+		settings = append(settings, setting)
+	}
+	return settings, rows.Err()
+}
+
+func (r *sqlSettings) Put(ctx context.Context, setting Setting) (Setting, error) {
+	setting.UpdatedAt = time.Now().UTC()
+	_, err := r.db.ExecContext(ctx, r.dialect.rebind(
+		`INSERT INTO settings (name, value, updated_by, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value, updated_by = excluded.updated_by, updated_at = excluded.updated_at`),
+		setting.Name, string(setting.Value), setting.UpdatedBy, setting.UpdatedAt)
+	if err != nil {
+		return Setting{}, err
+	}
+	return setting, nil
+}
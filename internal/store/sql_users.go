@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlUsers is a UserRepository backed by SQLite or Postgres
+type sqlUsers struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSQLUsers(db *sql.DB, d dialect) *sqlUsers {
+	return &sqlUsers{db: db, dialect: d}
+}
+
+const userColumns = `id, username, roles, disabled, must_reset_password, password_hash, session_version, created_at, updated_at, email, tenants`
+
+func scanUser(row rowScanner) (User, error) {
+	var u User
+	var id int64
+	var roles, tenants string
+	if err := row.Scan(&id, &u.Username, &roles, &u.Disabled, &u.MustResetPassword, &u.PasswordHash,
+		&u.SessionVersion, &u.CreatedAt, &u.UpdatedAt, &u.Email, &tenants); err != nil {
+		return User{}, err
+	}
+	u.ID = strconv.FormatInt(id, 10)
+	u.Roles = splitRoles(roles)
+	if tenants != "" {
+		u.Tenants = splitRoles(tenants)
+	}
+	return u, nil
+}
+
+func (r *sqlUsers) List(ctx context.Context) ([]User, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (r *sqlUsers) Get(ctx context.Context, id string) (User, error) {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return User{}, ErrNotFound
+	}
+	return r.one(r.db.QueryRowContext(ctx, r.dialect.rebind(`SELECT `+userColumns+` FROM users WHERE id = ?`), key))
+}
+
+func (r *sqlUsers) GetByUsername(ctx context.Context, username string) (User, error) {
+	return r.one(r.db.QueryRowContext(ctx,
+		r.dialect.rebind(`SELECT `+userColumns+` FROM users WHERE lower(username) = lower(?)`), username))
+}
+
+func (r *sqlUsers) Create(ctx context.Context, user User) (User, error) {
+	now := time.Now().UTC()
+	return r.one(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`INSERT INTO users (username, roles, disabled, must_reset_password, password_hash, session_version, created_at, updated_at, email, tenants)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING `+userColumns),
+		user.Username, joinRoles(user.Roles), user.Disabled, user.MustResetPassword, user.PasswordHash,
+		user.SessionVersion, now, now, user.Email, joinRoles(user.Tenants)))
+}
+
+func (r *sqlUsers) Update(ctx context.Context, user User) (User, error) {
+	key, err := strconv.ParseInt(user.ID, 10, 64)
+	if err != nil {
+		return User{}, ErrNotFound
+	}
+	return r.one(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`UPDATE users SET username = ?, roles = ?, disabled = ?, must_reset_password = ?, password_hash = ?,
+		session_version = ?, updated_at = ?, email = ?, tenants = ? WHERE id = ? RETURNING `+userColumns),
+		user.Username, joinRoles(user.Roles), user.Disabled, user.MustResetPassword, user.PasswordHash,
+		user.SessionVersion, time.Now().UTC(), user.Email, joinRoles(user.Tenants), key))
+}
+
+func (r *sqlUsers) ReplacePasswordHash(ctx context.Context, id, oldHash, newHash string) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.db.ExecContext(ctx, r.dialect.rebind(
+		`UPDATE users SET password_hash = ? WHERE id = ? AND password_hash = ?`), newHash, key, oldHash)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlUsers) Delete(ctx context.Context, id string) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"devices", "identities"} {
+		if _, err := tx.ExecContext(ctx, r.dialect.rebind(`DELETE FROM `+table+` WHERE user_id = ?`), key); err != nil {
+			return err
+		}
+	}
+	result, err := tx.ExecContext(ctx, r.dialect.rebind(`DELETE FROM users WHERE id = ?`), key)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// one scans a single user, mapping missing rows and duplicate usernames to
+// the repository errors
+func (r *sqlUsers) one(row *sql.Row) (User, error) {
+	u, err := scanUser(row)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return User{}, ErrNotFound
+	case r.dialect.isUniqueViolation(err):
+		return User{}, ErrConflict
+	}
+	return u, err
+}
+
+// Roles and tenants are stored as comma separated lists
+func joinRoles(roles []string) string {
+	return strings.Join(roles, ",")
+}
+
+func splitRoles(roles string) []string {
+	if roles == "" {
+		return []string{}
+	}
+	return strings.Split(roles, ",")
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlWebhooks is a WebhookRepository backed by SQLite or Postgres. The
+// event types are stored comma separated.
+type sqlWebhooks struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSQLWebhooks(db *sql.DB, d dialect) *sqlWebhooks {
+	return &sqlWebhooks{db: db, dialect: d}
+}
+
+const webhookColumns = `id, url, events, secret, created_at`
+
+func scanWebhook(row rowScanner) (WebhookSubscription, error) {
+	var sub WebhookSubscription
+	var id int64
+	var events string
+	if err := row.Scan(&id, &sub.URL, &events, &sub.Secret, &sub.CreatedAt); err != nil {
+		return WebhookSubscription{}, err
+	}
+	sub.ID = strconv.FormatInt(id, 10)
+	sub.Events = strings.Split(events, ",")
+	return sub, nil
+}
+
+func (r *sqlWebhooks) List(ctx context.Context) ([]WebhookSubscription, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := make([]WebhookSubscription, 0)
+	for rows.Next() {
+		sub, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (r *sqlWebhooks) Create(ctx context.Context, sub WebhookSubscription) (WebhookSubscription, error) {
+	return scanWebhook(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`INSERT INTO webhook_subscriptions (url, events, secret, created_at)
+		VALUES (?, ?, ?, ?) RETURNING `+webhookColumns),
+		sub.URL, strings.Join(sub.Events, ","), sub.Secret, time.Now().UTC()))
+}
+
+func (r *sqlWebhooks) Delete(ctx context.Context, id string) error {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.db.ExecContext(ctx, r.dialect.rebind(`DELETE FROM webhook_subscriptions WHERE id = ?`), key)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config selects and tunes the storage backend
+type Config struct {
+	Driver          string // memory, sqlite or postgres
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// Don't apply pending migrations on Open, which fails instead while
+	// any are pending
+	ManualMigrations bool
+}
+
+// Store bundles the repositories of the selected backend
+type Store struct {
+	Customers CustomerRepository
+	// Outbox holds the events of customer writes until they are delivered
+	Outbox Outbox
+	Users  UserRepository
+	// Devices holds the remembered devices of users
+	Devices DeviceRepository
+	// Identities links social login accounts to users
+	Identities IdentityRepository
+	// Inbound holds the events received from webhook sources
+	Inbound InboundRepository
+	// Settings holds the runtime settings changed through the admin API
+	Settings SettingsRepository
+	// Audit records administrative changes
+	Audit AuditRepository
+	// KeyUsage keeps the request counts of API keys
+	KeyUsage KeyUsageRepository
+	// Webhooks holds the subscriptions to outbound webhooks
+	Webhooks WebhookRepository
+
+	db *sql.DB // nil for the memory backend
+}
+
+// Open connects to the configured backend, applies pending migrations and
+// returns the repositories
+func Open(ctx context.Context, cfg Config) (*Store, error) {
+	if cfg.Driver == "" || cfg.Driver == "memory" {
+		// Seed the memory backend with example data
+		customers := NewMemoryCustomers()
+		for _, name := range []string{"John Doe", "Jane Smith"} {
+			customers.Create(ctx, Customer{Name: name})
+		}
+		return &Store{
+			Customers:  customers,
+			Outbox:     customers,
+			Users:      NewMemoryUsers(),
+			Devices:    NewMemoryDevices(),
+			Identities: NewMemoryIdentities(),
+			Inbound:    NewMemoryInbound(),
+			Settings:   NewMemorySettings(),
+			Audit:      NewMemoryAudit(),
+			KeyUsage:   NewMemoryKeyUsage(),
+			Webhooks:   NewMemoryWebhooks(),
+		}, nil
+	}
+
+	db, d, err := openDB(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(ctx, db, d, cfg.ManualMigrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating %s store: %w", cfg.Driver, err)
+	}
+
+	return &Store{
+		Customers:  newSQLCustomers(db, d),
+		Outbox:     newSQLOutbox(db, d),
+		Users:      newSQLUsers(db, d),
+		Devices:    newSQLDevices(db, d),
+		Identities: newSQLIdentities(db, d),
+		Inbound:    newSQLInbound(db, d),
+		Settings:   newSQLSettings(db, d),
+		Audit:      newSQLAudit(db, d),
+		KeyUsage:   newSQLKeyUsage(db, d),
+		Webhooks:   newSQLWebhooks(db, d),
+		db:         db,
+	}, nil
+}
+
+// openDB connects to the configured SQL backend
+func openDB(ctx context.Context, cfg Config) (*sql.DB, dialect, error) {
+	var d dialect
+	switch cfg.Driver {
+	case "sqlite":
+		d = sqliteDialect
+	case "postgres":
+		d = postgresDialect
+	case "", "memory":
+		return nil, d, errors.New("the memory store has no schema")
+	default:
+		return nil, d, fmt.Errorf("unknown store driver %q: must be memory, sqlite or postgres", cfg.Driver)
+	}
+
+	db, err := sql.Open(d.driverName, cfg.DSN)
+	if err != nil {
+		return nil, d, fmt.Errorf("error opening %s store: %w", cfg.Driver, err)
+	}
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, d, fmt.Errorf("error connecting to %s store: %w", cfg.Driver, err)
+	}
+	return db, d, nil
+}
+
+// Ping checks that the database can be reached. The memory backend always
+// can.
+func (s *Store) Ping(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.PingContext(ctx)
+}
+
+// Close releases the database connections
+func (s *Store) Close() error {
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// User is an account that can log in. PasswordHash is never serialized.
+type User struct {
+	ID       string   `json:"id" xml:"id"`
+	Username string   `json:"username" xml:"username"`
+	Email    string   `json:"email,omitempty" xml:"email,omitempty"`
+	Roles    []string `json:"roles" xml:"roles>role"`
+	// Tenants are the tenants the user may act for, see auth.TenantHeader
+	Tenants  []string `json:"tenants,omitempty" xml:"tenants>tenant,omitempty"`
+	Disabled bool     `json:"disabled" xml:"disabled"`
+	// MustResetPassword blocks logins until the user sets a new password
+	MustResetPassword bool   `json:"must_reset_password" xml:"must_reset_password"`
+	PasswordHash      string `json:"-" xml:"-"`
+	// SessionVersion is embedded in issued tokens; incrementing it revokes
+	// every existing session
+	SessionVersion int       `json:"-" xml:"-"`
+	CreatedAt      time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" xml:"updated_at"`
+}
+
+// UserRepository persists users. Implementations return ErrNotFound for
+// unknown users and ErrConflict when a username is already taken.
+// Usernames are matched case-insensitively.
+type UserRepository interface {
+	// List returns all users, oldest first
+	List(ctx context.Context) ([]User, error)
+	Get(ctx context.Context, id string) (User, error)
+	GetByUsername(ctx context.Context, username string) (User, error)
+	// Create stores a new user, assigning its ID and timestamps
+	Create(ctx context.Context, user User) (User, error)
+	// Update replaces every field of an existing user except its ID and
+	// creation time
+	Update(ctx context.Context, user User) (User, error)
+	// ReplacePasswordHash sets only the password hash of a user, and only
+	// while it is still oldHash, returning ErrNotFound otherwise
+	ReplacePasswordHash(ctx context.Context, id, oldHash, newHash string) error
+	// Delete removes a user along with its remembered devices and linked
+	// identities
+	Delete(ctx context.Context, id string) error
+}
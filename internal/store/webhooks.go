@@ -0,0 +1,27 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// WebhookSubscription registers a URL for domain events, kept so deliveries
+// resume after a restart. Secret signs the deliveries, so it is stored as
+// given rather than hashed.
+type WebhookSubscription struct {
+	ID        string
+	URL       string
+	Events    []string
+	Secret    string
+	CreatedAt time.Time
+}
+
+// WebhookRepository persists webhook subscriptions. Implementations return
+// ErrNotFound for unknown subscriptions.
+type WebhookRepository interface {
+	// List returns every subscription, oldest first
+	List(ctx context.Context) ([]WebhookSubscription, error)
+	// Create stores a new subscription, assigning its ID and creation time
+	Create(ctx context.Context, sub WebhookSubscription) (WebhookSubscription, error)
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,247 @@
+// Package tasks runs long requests in the background on the worker pool and
+// tracks their progress so clients can poll for the outcome
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"exampleserver/internal/services"
+)
+
+// Task states
+const (
+	StatePending   = "pending"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	// StateCancelled is a task the worker pool stopped before it ran
+	StateCancelled = "cancelled"
+)
+
+// defaultTimeout bounds a task run when Submit isn't given a timeout
+const defaultTimeout = 30 * time.Minute
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	// errCancelled finishes a task the worker pool won't run
+	errCancelled = errors.New("cancelled: the server stopped before the task ran")
+)
+
+// Task reports the state of a background operation. Result holds the
+// outcome of a successful task and Location, when set, the URL of the
+// resource it produced.
+type Task struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Owner      string      `json:"-"`
+	State      string      `json:"state"`
+	Done       int         `json:"done"`
+	Total      int         `json:"total,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	Location   string      `json:"location,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+// Progress lets a running task report how far it has got
+type Progress struct {
+	tracker *Tracker
+	id      string
+}
+
+// Set records that done of total units of work are complete
+func (p *Progress) Set(done, total int) {
+	p.tracker.update(p.id, func(t *Task) {
+		t.Done, t.Total = done, total
+	})
+}
+
+// SetLocation records the URL of the resource the task produces
+func (p *Progress) SetLocation(location string) {
+	p.tracker.update(p.id, func(t *Task) {
+		t.Location = location
+	})
+}
+
+// Func is the work of a task. The returned value becomes the task's result.
+type Func func(ctx context.Context, progress *Progress) (interface{}, error)
+
+// Tracker queues tasks on a worker pool and keeps their status until they
+// have been finished for the retention period
+type Tracker struct {
+	mu        sync.RWMutex
+	tasks     map[string]*Task
+	workers   *services.WorkerPool
+	retention time.Duration
+	onFinish  []func(Task)
+}
+
+func NewTracker(workers *services.WorkerPool, retention time.Duration) *Tracker {
+	return &Tracker{
+		tasks:     make(map[string]*Task),
+		workers:   workers,
+		retention: retention,
+	}
+}
+
+// Submit queues fn as a task of the given type on behalf of owner and
+// returns its initial status. If the worker pool can't accept the task, it
+// is marked failed, so its status doesn't stay pending, and returned with
+// the error. A timeout of zero uses the default of 30 minutes.
+func (t *Tracker) Submit(taskType, owner string, timeout time.Duration, fn Func) (Task, error) {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	task := &Task{
+		ID:        randomID(),
+		Type:      taskType,
+		Owner:     owner,
+		State:     StatePending,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	t.mu.Lock()
+	t.tasks[task.ID] = task
+	t.mu.Unlock()
+
+	err := t.workers.Enqueue(services.Task{
+		Name:    taskType + " task " + task.ID,
+		Timeout: timeout,
+		Run: func(ctx context.Context) error {
+			return t.run(ctx, task.ID, fn)
+		},
+		OnCancel: func() {
+			t.finish(task.ID, nil, errCancelled)
+		},
+	})
+	if err != nil {
+		t.finish(task.ID, nil, fmt.Errorf("rejected: %w", err))
+		rejected, _ := t.Get(task.ID)
+		return rejected, err
+	}
+	return *task, nil
+}
+
+// run executes fn and records its outcome. A panic fails the task before
+// the worker pool recovers it.
+func (t *Tracker) run(ctx context.Context, id string, fn Func) error {
+	t.update(id, func(task *Task) {
+		now := time.Now().UTC()
+		task.State = StateRunning
+		task.StartedAt = &now
+	})
+	defer func() {
+		if p := recover(); p != nil {
+			t.finish(id, nil, fmt.Errorf("task panicked: %v", p))
+			panic(p)
+		}
+	}()
+
+	result, err := fn(ctx, &Progress{tracker: t, id: id})
+	t.finish(id, result, err)
+	return err
+}
+
+func (t *Tracker) finish(id string, result interface{}, err error) {
+	t.update(id, func(task *Task) {
+		now := time.Now().UTC()
+		task.FinishedAt = &now
+		if err != nil {
+			task.State = StateFailed
+			if errors.Is(err, errCancelled) {
+				task.State = StateCancelled
+			}
+			task.Error = err.Error()
+			return
+		}
+		task.State = StateSucceeded
+		task.Result = result
+	})
+
+	task, err := t.Get(id)
+	if err != nil {
+		return
+	}
+	t.mu.RLock()
+	hooks := t.onFinish
+	t.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(task)
+	}
+}
+
+// OnFinish registers fn to be called with the final status of every task,
+// such as to invalidate caches a task has written behind
+func (t *Tracker) OnFinish(fn func(Task)) {
+	t.mu.Lock()
+	t.onFinish = append(t.onFinish, fn)
+	t.mu.Unlock()
+}
+
+// Get returns the status of a task
+func (t *Tracker) Get(id string) (Task, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	task, ok := t.tasks[id]
+	if !ok {
+		return Task{}, ErrTaskNotFound
+	}
+	return *task, nil
+}
+
+// List returns the tasks of owner, or of everyone when owner is "", newest
+// first
+func (t *Tracker) List(owner string) []Task {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	tasks := make([]Task, 0, len(t.tasks))
+	for _, task := range t.tasks {
+		if owner == "" || task.Owner == owner {
+			tasks = append(tasks, *task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.After(tasks[j].CreatedAt)
+	})
+	return tasks
+}
+
+// Sweep forgets tasks finished longer ago than the retention period. It is
+// run by the scheduler.
+func (t *Tracker) Sweep(ctx context.Context) error {
+	cutoff := time.Now().Add(-t.retention)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, task := range t.tasks {
+		if task.FinishedAt != nil && task.FinishedAt.Before(cutoff) {
+			delete(t.tasks, id)
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) update(id string, fn func(*Task)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if task, ok := t.tasks[id]; ok {
+		fn(task)
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
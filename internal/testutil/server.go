@@ -0,0 +1,343 @@
+// Package testutil runs the full server in-process for feature tests, on an
+// ephemeral port with the memory store, so tests exercise the same routes,
+// middleware and services as production without their own bootstrap.
+//
+// Every server has an admin user, a user without roles and an API key:
+//
+//	srv := testutil.NewServer(t)
+//	req := srv.NewRequest(http.MethodPost, "/api/customers", map[string]string{"name": "Ada"})
+//	var customer store.Customer
+//	srv.DoJSON(srv.AsUser(req, testutil.UserUsername), http.StatusCreated, &customer)
+//
+// The memory store starts with its two example customers.
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"exampleserver/internal/auth"
+	"exampleserver/internal/server"
+	"exampleserver/internal/services"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/client"
+	"exampleserver/pkg/config"
+	"exampleserver/pkg/logger"
+)
+
+// Credentials of the pre-seeded users and API key
+const (
+	AdminUsername = "admin"
+	AdminPassword = "admin-password"
+	UserUsername  = "user"
+	UserPassword  = "user-password"
+	APIKey        = "test-api-key"
+	// APIKeySubject is who requests with APIKey authenticate as
+	APIKeySubject = "test"
+)
+
+// User is a user created before the server starts
+type User struct {
+	Username string
+	Password string
+	Roles    []string
+}
+
+// Option changes how a test server is set up
+type Option func(*options)
+
+type options struct {
+	configure []func(*config.Config)
+	users     []User
+}
+
+// WithConfig changes the configuration before the server is created, for
+// tests of features that are off by default
+func WithConfig(fn func(cfg *config.Config)) Option {
+	return func(o *options) { o.configure = append(o.configure, fn) }
+}
+
+// WithUser creates another user, who signs in with password
+func WithUser(username, password string, roles ...string) Option {
+	return func(o *options) {
+		o.users = append(o.users, User{Username: username, Password: password, Roles: roles})
+	}
+}
+
+// Server is a running server with the Store it serves, stopped when the
+// test finishes
+type Server struct {
+	// URL is the base URL of the server, such as http://127.0.0.1:41234
+	URL    string
+	Config *config.Config
+	Store  *store.Store
+	Server *server.Server
+
+	t      testing.TB
+	http   *http.Client
+	users  map[string]User
+	mu     sync.Mutex
+	tokens map[string]string // by username
+}
+
+// NewServer starts a server for t. Configuration comes from the
+// environment as for "server serve", except that the store is in memory,
+// logs are written to a temporary directory, and the users and API key
+// above are set up.
+func NewServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	o := options{users: []User{
+		{Username: UserUsername, Password: UserPassword},
+	}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	logFile, err := initLogger()
+	if err != nil {
+		t.Fatalf("testutil: logger: %v", err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("testutil: config: %v", err)
+	}
+	cfg.StoreDriver = "memory"
+	cfg.LogDir = filepath.Dir(logFile)
+	cfg.LogFile = logFile
+	cfg.APIKeys = map[string]string{APIKey: APIKeySubject}
+	cfg.APIKeyRoles = map[string][]string{APIKeySubject: {auth.RoleAdmin}}
+	cfg.AdminUsername = AdminUsername
+	cfg.AdminPassword = AdminPassword
+	cfg.ShutdownDrainDelay = 0
+	for _, configure := range o.configure {
+		configure(cfg)
+	}
+
+	ctx := context.Background()
+	st, err := store.Open(ctx, store.Config{Driver: cfg.StoreDriver})
+	if err != nil {
+		t.Fatalf("testutil: store: %v", err)
+	}
+	passwords := auth.NewPasswordHasher(cfg.PasswordHash, auth.Argon2Params{
+		Memory:  uint32(cfg.Argon2Memory),
+		Time:    uint32(cfg.Argon2Time),
+		Threads: uint8(cfg.Argon2Parallelism),
+	})
+	users := map[string]User{AdminUsername: {Username: AdminUsername, Password: AdminPassword, Roles: []string{auth.RoleAdmin}}}
+	for _, user := range o.users {
+		hash, err := passwords.Hash(user.Password)
+		if err != nil {
+			t.Fatalf("testutil: hashing the password of %s: %v", user.Username, err)
+		}
+		if _, err := st.Users.Create(ctx, store.User{Username: user.Username, Roles: user.Roles, PasswordHash: hash}); err != nil {
+			t.Fatalf("testutil: creating user %s: %v", user.Username, err)
+		}
+		users[user.Username] = user
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("testutil: listen: %v", err)
+	}
+	srv, err := server.New(cfg, logger.Default(), services.NewManager(logger.Default()), st)
+	if err != nil {
+		ln.Close()
+		st.Close()
+		t.Fatalf("testutil: server: %v", err)
+	}
+	serveCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(serveCtx, ln) }()
+
+	s := &Server{
+		URL:    "http://" + ln.Addr().String(),
+		Config: cfg,
+		Store:  st,
+		Server: srv,
+		t:      t,
+		http:   &http.Client{Timeout: 30 * time.Second},
+		users:  users,
+		tokens: make(map[string]string),
+	}
+	t.Cleanup(func() {
+		stop()
+		if err := <-done; err != nil {
+			t.Errorf("testutil: server: %v", err)
+		}
+		st.Close()
+	})
+	return s
+}
+
+// logFile is where the servers of a test binary log, set up once since the
+// logger is process-wide
+var (
+	logOnce sync.Once
+	logFile string
+	logErr  error
+)
+
+func initLogger() (string, error) {
+	logOnce.Do(func() {
+		var dir string
+		if dir, logErr = os.MkdirTemp("", "exampleserver-test-"); logErr != nil {
+			return
+		}
+		logFile = filepath.Join(dir, "app.log")
+		configPath := filepath.Join(dir, "logger.yaml")
+		if logErr = os.WriteFile(configPath, []byte(fmt.Sprintf("log_file: %q\n", logFile)), 0o600); logErr != nil {
+			return
+		}
+		logErr = logger.Initialize(configPath)
+	})
+	return logFile, logErr
+}
+
+// NewRequest returns a request to path, such as /api/customers, with body
+// encoded as JSON unless it is nil, a []byte or an io.Reader
+func (s *Server) NewRequest(method, path string, body interface{}) *http.Request {
+	s.t.Helper()
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatalf("testutil: encoding request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		s.t.Fatalf("testutil: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req
+}
+
+// Do sends req, failing the test if there is no response. The response body
+// is closed when the test finishes if the caller doesn't.
+func (s *Server) Do(req *http.Request) *http.Response {
+	s.t.Helper()
+	resp, err := s.http.Do(req)
+	if err != nil {
+		s.t.Fatalf("testutil: %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	s.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// DoJSON sends req and decodes the JSON response into out, unless it is
+// nil, failing the test unless the response has status want
+func (s *Server) DoJSON(req *http.Request, want int, out interface{}) *http.Response {
+	s.t.Helper()
+	resp := s.Do(req)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatalf("testutil: reading response to %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	if resp.StatusCode != want {
+		s.t.Fatalf("testutil: %s %s answered %d, want %d: %s", req.Method, req.URL.Path, resp.StatusCode, want, body)
+	}
+	if out != nil {
+		if err := json.Unmarshal(body, out); err != nil {
+			s.t.Fatalf("testutil: decoding response to %s %s: %v", req.Method, req.URL.Path, err)
+		}
+	}
+	return resp
+}
+
+// AsAPIKey authenticates req with the API key, which has the admin role
+func (s *Server) AsAPIKey(req *http.Request) *http.Request {
+	req.Header.Set("X-API-Key", APIKey)
+	return req
+}
+
+// AsUser authenticates req with a token of a pre-seeded user, signing in
+// the first time
+func (s *Server) AsUser(req *http.Request, username string) *http.Request {
+	s.t.Helper()
+	req.Header.Set("Authorization", "Bearer "+s.Token(username))
+	return req
+}
+
+// AsAdmin authenticates req with a token of the admin user
+func (s *Server) AsAdmin(req *http.Request) *http.Request {
+	s.t.Helper()
+	return s.AsUser(req, AdminUsername)
+}
+
+// Token returns a JWT token of a pre-seeded user, signing in the first time
+func (s *Server) Token(username string) string {
+	s.t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token, ok := s.tokens[username]; ok {
+		return token
+	}
+	user, ok := s.users[username]
+	if !ok {
+		s.t.Fatalf("testutil: no user %s", username)
+	}
+	resp, err := s.Client().Login(context.Background(), user.Username, user.Password, false)
+	if err != nil {
+		s.t.Fatalf("testutil: signing in as %s: %v", username, err)
+	}
+	s.tokens[username] = resp.Token
+	return resp.Token
+}
+
+// Client returns an API client of the server without credentials, or with
+// those of opts such as client.WithAPIKey(testutil.APIKey). Retries are
+// off, so tests see the first response.
+func (s *Server) Client(opts ...client.Option) *client.Client {
+	s.t.Helper()
+	opts = append([]client.Option{client.WithHTTPClient(s.http), client.WithRetries(0, 0, 0)}, opts...)
+	c, err := client.New(s.URL, opts...)
+	if err != nil {
+		s.t.Fatalf("testutil: %v", err)
+	}
+	return c
+}
+
+// UserClient returns an API client signed in as a pre-seeded user
+func (s *Server) UserClient(username string) *client.Client {
+	s.t.Helper()
+	user, ok := s.users[username]
+	if !ok {
+		s.t.Fatalf("testutil: no user %s", username)
+	}
+	return s.Client(client.WithCredentials(user.Username, user.Password))
+}
+
+// WaitFor polls cond every 10ms until it holds, failing the test after
+// timeout. It is for effects of background services, such as tasks and
+// webhooks.
+func (s *Server) WaitFor(timeout time.Duration, cond func() bool) {
+	s.t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("testutil: condition not met within %s", timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
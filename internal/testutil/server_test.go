@@ -0,0 +1,25 @@
+package testutil_test
+
+import (
+	"net/http"
+	"testing"
+
+	"exampleserver/internal/handlers"
+	"exampleserver/internal/testutil"
+)
+
+// TestNewServer starts a server, makes authenticated requests and leaves
+// the shutdown to the test's cleanup, which fails the test if the server
+// doesn't stop cleanly
+func TestNewServer(t *testing.T) {
+	srv := testutil.NewServer(t)
+
+	var customers handlers.CustomersResponse
+	srv.DoJSON(srv.AsAPIKey(srv.NewRequest(http.MethodGet, "/api/customers", nil)), http.StatusOK, &customers)
+	if len(customers.Customers) == 0 {
+		t.Errorf("GET /api/customers with the API key listed no customers, want the example customers")
+	}
+
+	srv.DoJSON(srv.AsUser(srv.NewRequest(http.MethodGet, "/api/customers", nil), testutil.UserUsername), http.StatusOK, nil)
+	srv.DoJSON(srv.NewRequest(http.MethodGet, "/api/customers", nil), http.StatusUnauthorized, nil)
+}
@@ -0,0 +1,46 @@
+// Package version holds build metadata injected at link time, e.g.
+//
+//	go build -ldflags "-X exampleserver/internal/version.Version=1.2.0 \
+//	    -X exampleserver/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	    -X exampleserver/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import (
+	"runtime"
+	"time"
+)
+
+// Set via -ldflags at build time
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// startTime is when the process started
+var startTime = time.Now()
+
+// Info describes the running binary
+type Info struct {
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit"`
+	BuildDate string    `json:"build_date"`
+	GoVersion string    `json:"go_version"`
+	StartTime time.Time `json:"start_time"`
+}
+
+// Get returns the build info of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		StartTime: startTime,
+	}
+}
+
+// Uptime returns how long the process has been running
+func Uptime() time.Duration {
+	return time.Since(startTime)
+}
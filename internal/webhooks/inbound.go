@@ -0,0 +1,291 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"exampleserver/internal/events"
+	"exampleserver/internal/store"
+	"exampleserver/pkg/logger"
+)
+
+// Signature schemes of inbound webhook sources
+const (
+	// SchemeStandard is the scheme this server signs its own webhooks
+	// with: X-Webhook-Signature over "timestamp.body"
+	SchemeStandard = "standard"
+	// SchemeGitHub verifies X-Hub-Signature-256. GitHub sends no
+	// timestamp and doesn't sign the delivery ID, so replays are caught by
+	// the digest of the body.
+	SchemeGitHub = "github"
+	// SchemeStripe verifies the v1 signatures of Stripe-Signature
+	SchemeStripe = "stripe"
+)
+
+// Schemes lists the supported signature schemes
+var Schemes = []string{SchemeStandard, SchemeGitHub, SchemeStripe}
+
+var (
+	ErrUnknownSource    = errors.New("unknown webhook source")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleTimestamp   = errors.New("webhook timestamp outside the tolerance")
+	ErrMissingDelivery  = errors.New("webhook has no delivery ID")
+)
+
+// Source is a sender of inbound webhooks and the secret it signs them with
+type Source struct {
+	Name   string
+	Scheme string
+	Secret string
+}
+
+// Receipt is the outcome of a received webhook. Duplicate is set when the
+// source had already sent the event, such as on a retry or a replay.
+type Receipt struct {
+	Event     store.InboundEvent
+	Duplicate bool
+}
+
+// Receiver verifies inbound webhooks, records them and publishes them on
+// the event bus as webhook.<source>.<type>
+type Receiver struct {
+	sources   map[string]Source
+	tolerance time.Duration
+	repo      store.InboundRepository
+	bus       *events.Bus
+
+	received   atomic.Uint64
+	rejected   atomic.Uint64
+	duplicates atomic.Uint64
+	failed     atomic.Uint64
+
+	logger logger.LoggerInterface
+}
+
+func NewReceiver(sources []Source, tolerance time.Duration, repo store.InboundRepository, bus *events.Bus, logger logger.LoggerInterface) *Receiver {
+	byName := make(map[string]Source, len(sources))
+	for _, source := range sources {
+		byName[source.Name] = source
+	}
+	return &Receiver{
+		sources:   byName,
+		tolerance: tolerance,
+		repo:      repo,
+		bus:       bus,
+		logger:    logger,
+	}
+}
+
+// Sources returns the names of the registered sources, sorted
+func (r *Receiver) Sources() []string {
+	names := make([]string, 0, len(r.sources))
+	for name := range r.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Receive verifies a webhook from the named source, records it and
+// publishes it. A duplicate, with the delivery ID or body of an event
+// already received from the source, that was already published isn't
+// published again. When publishing fails the event stays recorded but undispatched,
+// and the error is returned so the sender retries.
+func (r *Receiver) Receive(ctx context.Context, name string, header http.Header, body []byte) (Receipt, error) {
+	source, ok := r.sources[name]
+	if !ok {
+		return Receipt{}, ErrUnknownSource
+	}
+
+	deliveryID, eventType, err := r.verify(source, header, body, time.Now())
+	if err != nil {
+		r.rejected.Add(1)
+		r.logger.Warn("[Webhooks] Rejected inbound webhook from %s: %v", name, err)
+		return Receipt{}, err
+	}
+
+	digest := sha256.Sum256(body)
+	event, err := r.repo.Record(ctx, store.InboundEvent{
+		Source:     name,
+		DeliveryID: deliveryID,
+		Digest:     hex.EncodeToString(digest[:]),
+		Type:       eventType,
+		Payload:    payload(body),
+	})
+	receipt := Receipt{Event: event}
+	switch {
+	case errors.Is(err, store.ErrConflict):
+		r.duplicates.Add(1)
+		receipt.Duplicate = true
+		if event.DispatchedAt != nil {
+			r.logger.Debug("[Webhooks] Ignored repeated %s delivery %s", name, deliveryID)
+			return receipt, nil
+		}
+	case err != nil:
+		return Receipt{}, fmt.Errorf("failed to record webhook: %w", err)
+	default:
+		r.received.Add(1)
+	}
+
+	if err := r.dispatch(ctx, &receipt.Event); err != nil {
+		r.failed.Add(1)
+		return receipt, err
+	}
+	return receipt, nil
+}
+
+func (r *Receiver) dispatch(ctx context.Context, event *store.InboundEvent) error {
+	err := r.bus.Publish(events.Event{
+		ID:     event.ID,
+		Type:   "webhook." + event.Source + "." + event.Type,
+		Source: event.Source,
+		Time:   event.ReceivedAt,
+		Data:   event.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.repo.MarkDispatched(ctx, event.ID); err != nil {
+		// The event was published, so a repeat delivery publishes it again;
+		// handlers ignore repeats by event ID
+		r.logger.Error("[Webhooks] Failed to mark %s event %s dispatched: %v", event.Source, event.ID, err)
+		return nil
+	}
+	now := time.Now().UTC()
+	event.DispatchedAt = &now
+	return nil
+}
+
+// Purge deletes received events older than retention
+func (r *Receiver) Purge(ctx context.Context, retention time.Duration) error {
+	removed, err := r.repo.Purge(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		r.logger.Info("[Webhooks] Purged %d inbound webhook events", removed)
+	}
+	return nil
+}
+
+// Collect reports the inbound webhook counters for the stats service
+func (r *Receiver) Collect(ctx context.Context) (map[string]float64, error) {
+	return map[string]float64{
+		"received":   float64(r.received.Load()),
+		"rejected":   float64(r.rejected.Load()),
+		"duplicates": float64(r.duplicates.Load()),
+		"failed":     float64(r.failed.Load()),
+	}, nil
+}
+
+// verify checks the signature and timestamp of a webhook and returns its
+// delivery ID and event type
+func (r *Receiver) verify(source Source, header http.Header, body []byte, now time.Time) (string, string, error) {
+	switch source.Scheme {
+	case SchemeGitHub:
+		signature, _ := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+		if !validSignature(source.Secret, signature, body) {
+			return "", "", ErrInvalidSignature
+		}
+		return required(header.Get("X-GitHub-Delivery"), header.Get("X-GitHub-Event"))
+
+	case SchemeStripe:
+		var timestamp string
+		var signatures []string
+		for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				signatures = append(signatures, value)
+			}
+		}
+		if err := r.checkTimestamp(timestamp, now); err != nil {
+			return "", "", err
+		}
+		valid := false
+		for _, signature := range signatures {
+			if validSignature(source.Secret, signature, []byte(timestamp+"."), body) {
+				valid = true
+			}
+		}
+		if !valid {
+			return "", "", ErrInvalidSignature
+		}
+		var event struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+		}
+		json.Unmarshal(body, &event)
+		return required(event.ID, event.Type)
+
+	default:
+		timestamp := header.Get("X-Webhook-Timestamp")
+		if err := r.checkTimestamp(timestamp, now); err != nil {
+			return "", "", err
+		}
+		signature, _ := strings.CutPrefix(header.Get("X-Webhook-Signature"), "sha256=")
+		if !validSignature(source.Secret, signature, []byte(timestamp+"."), body) {
+			return "", "", ErrInvalidSignature
+		}
+		return required(header.Get("X-Webhook-ID"), header.Get("X-Webhook-Event"))
+	}
+}
+
+func (r *Receiver) checkTimestamp(timestamp string, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > r.tolerance || age < -r.tolerance {
+		return ErrStaleTimestamp
+	}
+	return nil
+}
+
+// validSignature compares a hex HMAC-SHA256 signature with the one of the
+// concatenated parts in constant time
+func validSignature(secret, signature string, parts ...[]byte) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func required(deliveryID, eventType string) (string, string, error) {
+	if deliveryID == "" {
+		return "", "", ErrMissingDelivery
+	}
+	if eventType == "" {
+		eventType = "unknown"
+	}
+	return deliveryID, strings.ToLower(eventType), nil
+}
+
+// payload returns body as JSON, wrapping anything else, such as a form
+// encoded body, in a JSON string
+func payload(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	wrapped, _ := json.Marshal(string(body))
+	return wrapped
+}
@@ -0,0 +1,105 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// reservedNets are non-public ranges the net.IP methods don't cover
+var reservedNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // "this network"
+		"100.64.0.0/10", // carrier-grade NAT, and some clouds' metadata
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // benchmarking
+		"64:ff9b::/96",  // NAT64, which can reach private IPv4 addresses
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// publicIP reports whether ip is a public unicast address, the only kind
+// deliveries go to unless private ones are allowed. Loopback, private,
+// link-local (such as the 169.254.169.254 metadata endpoint), multicast and
+// unspecified addresses are refused.
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkURL checks that raw is an absolute http or https URL and, unless
+// allowPrivate, that its host only resolves to public addresses
+func checkURL(ctx context.Context, raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url must not contain credentials")
+	}
+	if allowPrivate {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("url host %s can't be resolved", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return fmt.Errorf("url host %s resolves to %s, which is not a public address", u.Hostname(), addr.IP)
+		}
+	}
+	return nil
+}
+
+// newDialer returns the dialer deliveries and reachability checks connect
+// with. Unless allowPrivate, it refuses to connect to addresses that aren't
+// public, which also covers redirects and hosts that resolve differently at
+// delivery than when they were checked.
+func newDialer(allowPrivate bool) *net.Dialer {
+	dialer := &net.Dialer{Timeout: deliveryTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("refusing to deliver to %s, which is not a public address", host)
+			}
+			return nil
+		}
+	}
+	return dialer
+}
+
+// newClient returns the client deliveries are posted with, connecting with
+// dialer. Proxies from the environment aren't used, as they would connect on
+// the client's behalf.
+func newClient(dialer *net.Dialer) *http.Client {
+	return &http.Client{
+		Timeout: deliveryTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
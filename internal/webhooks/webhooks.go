@@ -0,0 +1,461 @@
+// Package webhooks delivers signed domain events to subscribed URLs
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"exampleserver/internal/store"
+	"exampleserver/pkg/logger"
+)
+
+// Event types published by the server
+const (
+	CustomerCreated  = "customer.created"
+	CustomerUpdated  = "customer.updated"
+	CustomerDeleted  = "customer.deleted"
+	CustomerRestored = "customer.restored"
+)
+
+// EventTypes lists the events subscriptions can register for
+var EventTypes = []string{CustomerCreated, CustomerUpdated, CustomerDeleted, CustomerRestored}
+
+const (
+	deliveryTimeout  = 10 * time.Second
+	deliveryLogLimit = 50
+	// maxAccepted bounds the events whose accepting subscriptions are
+	// remembered, forgetting the oldest beyond it
+	maxAccepted = 10000
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	// ErrInvalidSubscription wraps the reasons Subscribe refuses a
+	// subscription
+	ErrInvalidSubscription = errors.New("invalid webhook subscription")
+)
+
+// Subscription registers a URL for a set of event types. "*" subscribes to
+// every event.
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"` // only returned on creation
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Event is the JSON body delivered to subscribers
+type Event struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Delivery records a single delivery attempt
+type Delivery struct {
+	EventID    string        `json:"event_id"`
+	EventType  string        `json:"event_type"`
+	Attempt    int           `json:"attempt"`
+	Time       time.Time     `json:"time"`
+	Duration   time.Duration `json:"duration"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+type subscription struct {
+	Subscription
+	deliveries []Delivery
+}
+
+// Dispatcher holds subscriptions, kept in the store, and delivers the events
+// the outbox relay hands it
+type Dispatcher struct {
+	mu            sync.RWMutex
+	subscriptions map[string]*subscription
+	repo          store.WebhookRepository
+	// allowPrivate lets subscriptions deliver to loopback, private and
+	// link-local addresses, for development
+	allowPrivate bool
+	// accepted holds the subscriptions that have accepted an event passed
+	// to Deliver that others haven't yet, so retries skip them, for up to
+	// maxAccepted events in the order they were added. It is kept in memory
+	// only, so after a restart retries go to every subscription again.
+	accepted      map[string]map[string]bool
+	acceptedOrder []string
+
+	dialer *net.Dialer
+	client *http.Client
+	logger logger.LoggerInterface
+}
+
+// NewDispatcher returns a dispatcher keeping its subscriptions in repo.
+// Unless allowPrivate, subscriptions may only deliver to public addresses.
+func NewDispatcher(repo store.WebhookRepository, allowPrivate bool, logger logger.LoggerInterface) *Dispatcher {
+	dialer := newDialer(allowPrivate)
+	return &Dispatcher{
+		subscriptions: make(map[string]*subscription),
+		repo:          repo,
+		allowPrivate:  allowPrivate,
+		accepted:      make(map[string]map[string]bool),
+		dialer:        dialer,
+		client:        newClient(dialer),
+		logger:        logger,
+	}
+}
+
+// Load reads the stored subscriptions, replacing those held
+func (d *Dispatcher) Load(ctx context.Context) error {
+	stored, err := d.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+	subscriptions := make(map[string]*subscription, len(stored))
+	for _, sub := range stored {
+		subscriptions[sub.ID] = &subscription{Subscription: Subscription{
+			ID:        sub.ID,
+			URL:       sub.URL,
+			Events:    sub.Events,
+			Secret:    sub.Secret,
+			CreatedAt: sub.CreatedAt,
+		}}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subscriptions = subscriptions
+	return nil
+}
+
+// Subscribe validates, stores and registers a subscription, generating a
+// secret if none is given. The returned copy includes the secret. A
+// subscription that isn't valid is refused with an error wrapping
+// ErrInvalidSubscription.
+func (d *Dispatcher) Subscribe(ctx context.Context, sub Subscription) (Subscription, error) {
+	if err := checkURL(ctx, sub.URL, d.allowPrivate); err != nil {
+		return Subscription{}, fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+	if len(sub.Events) == 0 {
+		return Subscription{}, fmt.Errorf("%w: at least one event type is required", ErrInvalidSubscription)
+	}
+	for _, event := range sub.Events {
+		if event != "*" && !knownEvent(event) {
+			return Subscription{}, fmt.Errorf("%w: unknown event type %q", ErrInvalidSubscription, event)
+		}
+	}
+	if sub.Secret == "" {
+		sub.Secret = randomHex(32)
+	}
+
+	stored, err := d.repo.Create(ctx, store.WebhookSubscription{URL: sub.URL, Events: sub.Events, Secret: sub.Secret})
+	if err != nil {
+		return Subscription{}, fmt.Errorf("failed to store webhook subscription: %w", err)
+	}
+	sub.ID = stored.ID
+	sub.CreatedAt = stored.CreatedAt
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subscriptions[sub.ID] = &subscription{Subscription: sub}
+	return sub, nil
+}
+
+// Unsubscribe removes a subscription from the store and the dispatcher
+func (d *Dispatcher) Unsubscribe(ctx context.Context, id string) error {
+	err := d.repo.Delete(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.subscriptions, id)
+	return nil
+}
+
+// Subscriptions returns all subscriptions without their secrets
+func (d *Dispatcher) Subscriptions() []Subscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	subs := make([]Subscription, 0, len(d.subscriptions))
+	for _, sub := range d.subscriptions {
+		s := sub.Subscription
+		s.Secret = ""
+		subs = append(subs, s)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		a, _ := strconv.Atoi(subs[i].ID)
+		b, _ := strconv.Atoi(subs[j].ID)
+		return a < b
+	})
+	return subs
+}
+
+// CheckReachable dials the host of every subscription's URL and reports
+// those that can't be reached, refusing the addresses deliveries refuse
+func (d *Dispatcher) CheckReachable(ctx context.Context) error {
+	hosts := map[string]bool{}
+	for _, sub := range d.Subscriptions() {
+		u, err := url.Parse(sub.URL)
+		if err != nil {
+			continue
+		}
+		port := u.Port()
+		if port == "" {
+			port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+		}
+		hosts[net.JoinHostPort(u.Hostname(), port)] = true
+	}
+
+	var unreachable []string
+	for host := range hosts {
+		conn, err := d.dialer.DialContext(ctx, "tcp", host)
+		if err != nil {
+			unreachable = append(unreachable, host)
+			continue
+		}
+		conn.Close()
+	}
+	if len(unreachable) > 0 {
+		sort.Strings(unreachable)
+		return fmt.Errorf("unreachable: %s", strings.Join(unreachable, ", "))
+	}
+	return nil
+}
+
+// Deliveries returns the recent delivery attempts for a subscription, most
+// recent first
+func (d *Dispatcher) Deliveries(id string) ([]Delivery, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	sub, ok := d.subscriptions[id]
+	if !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+	deliveries := make([]Delivery, len(sub.deliveries))
+	for i, delivery := range sub.deliveries {
+		deliveries[len(deliveries)-1-i] = delivery
+	}
+	return deliveries, nil
+}
+
+// Deliver posts an event to every matching subscription and returns once
+// they have all answered, with an error unless all accepted it. attempt
+// numbers the call in the delivery log. Subscriptions that accept an event
+// are skipped when it is delivered again, until all have.
+func (d *Dispatcher) Deliver(ctx context.Context, event Event, attempt int) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+
+	d.mu.RLock()
+	accepted := d.accepted[event.ID]
+	d.mu.RUnlock()
+
+	targets := d.targets(event.Type)
+	var wg sync.WaitGroup
+	errs := make(chan error, len(targets))
+	var mu sync.Mutex
+	var done []string
+	for _, sub := range targets {
+		if accepted[sub.ID] {
+			continue
+		}
+		sub := sub
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+			defer cancel()
+			if err := d.deliver(ctx, sub, event, body, attempt); err != nil {
+				errs <- fmt.Errorf("subscription %s: %w", sub.ID, err)
+				return
+			}
+			mu.Lock()
+			done = append(done, sub.ID)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var failed []error
+	for err := range errs {
+		failed = append(failed, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(failed) == 0 {
+		delete(d.accepted, event.ID)
+		return nil
+	}
+	if d.accepted[event.ID] == nil {
+		d.accepted[event.ID] = map[string]bool{}
+		d.acceptedOrder = append(d.acceptedOrder, event.ID)
+		d.trimAccepted()
+	}
+	for _, id := range done {
+		d.accepted[event.ID][id] = true
+	}
+	return errors.Join(failed...)
+}
+
+// Forget drops what Deliver remembers of an event, for an event that won't
+// be delivered again
+func (d *Dispatcher) Forget(eventID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.accepted, eventID)
+}
+
+// trimAccepted forgets the oldest events beyond maxAccepted, and drops the
+// IDs of events already forgotten from the order; d.mu must be held
+func (d *Dispatcher) trimAccepted() {
+	if len(d.acceptedOrder) <= 2*maxAccepted {
+		for len(d.accepted) > maxAccepted {
+			delete(d.accepted, d.acceptedOrder[0])
+			d.acceptedOrder = d.acceptedOrder[1:]
+		}
+		return
+	}
+	kept := make([]string, 0, len(d.accepted))
+	seen := make(map[string]bool, len(d.accepted))
+	for _, id := range d.acceptedOrder {
+		if d.accepted[id] != nil && !seen[id] {
+			seen[id] = true
+			kept = append(kept, id)
+		}
+	}
+	d.acceptedOrder = kept
+	d.trimAccepted()
+}
+
+// targets returns the subscriptions to an event type
+func (d *Dispatcher) targets(eventType string) []Subscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var targets []Subscription
+	for _, sub := range d.subscriptions {
+		if sub.matches(eventType) {
+			targets = append(targets, sub.Subscription)
+		}
+	}
+	return targets
+}
+
+// deliver posts the event to the subscription URL and records the attempt
+func (d *Dispatcher) deliver(ctx context.Context, sub Subscription, event Event, body []byte, attempt int) error {
+	start := time.Now()
+	delivery := Delivery{
+		EventID:   event.ID,
+		EventType: event.Type,
+		Attempt:   attempt,
+		Time:      start.UTC(),
+	}
+
+	err := d.post(ctx, sub, event, body, &delivery)
+	delivery.Duration = time.Since(start)
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	d.record(sub.ID, delivery)
+	return err
+}
+
+func (d *Dispatcher) post(ctx context.Context, sub Subscription, event Event, body []byte, delivery *Delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", event.ID)
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(sub.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook request failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// record appends to the subscription's delivery log, keeping the most recent
+// entries
+func (d *Dispatcher) record(id string, delivery Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sub, ok := d.subscriptions[id]
+	if !ok {
+		return
+	}
+	sub.deliveries = append(sub.deliveries, delivery)
+	if len(sub.deliveries) > deliveryLogLimit {
+		sub.deliveries = sub.deliveries[len(sub.deliveries)-deliveryLogLimit:]
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.body" with secret, as sent
+// in the X-Webhook-Signature header
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *subscription) matches(eventType string) bool {
+	for _, event := range s.Events {
+		if event == "*" || event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func knownEvent(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LoginResponse is a signed-in session. DeviceToken is set for remembered
+// logins and exchanged for new tokens with DeviceLogin.
+type LoginResponse struct {
+	Token       string `json:"token"`
+	DeviceToken string `json:"device_token,omitempty"`
+}
+
+// Login signs in with a username and password. Clients made with
+// WithCredentials sign in by themselves; Login is for callers managing the
+// token, passed to another client with WithToken.
+func (c *Client) Login(ctx context.Context, username, password string, rememberMe bool) (LoginResponse, error) {
+	return c.login(ctx, username, password, rememberMe)
+}
+
+func (c *Client) login(ctx context.Context, username, password string, rememberMe bool) (LoginResponse, error) {
+	var resp LoginResponse
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/login",
+		body: map[string]interface{}{
+			"username":    username,
+			"password":    password,
+			"remember_me": rememberMe,
+		},
+		header: http.Header{"Idempotency-Key": {idempotencyKey()}},
+		public: true,
+	}, &resp)
+	return resp, err
+}
+
+// DeviceLogin exchanges the device token of a remembered login for a new
+// JWT token
+func (c *Client) DeviceLogin(ctx context.Context, deviceToken string) (LoginResponse, error) {
+	var resp LoginResponse
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/login/device",
+		body:   map[string]string{"device_token": deviceToken},
+		public: true,
+	}, &resp)
+	return resp, err
+}
+
+// tokenExpiry reads the exp claim of a JWT token without verifying it, to
+// know when to renew it. It returns the zero time if there is none.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
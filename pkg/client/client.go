@@ -0,0 +1,418 @@
+// Package client is a typed Go client of the server's API, for services and
+// tests that integrate with it. It signs in with an API key, a fixed token
+// or a username and password, renewing tokens as they expire, and retries
+// requests that fail with network errors, 429 or 502-504 responses when
+// it's safe to.
+//
+// Responses are read as plain JSON, so servers sending customers in an
+// envelope (RESPONSE_ENVELOPE=jsonapi or hal) aren't supported.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the retry policy, see WithRetries
+const (
+	defaultRetries    = 3
+	defaultMinBackoff = 200 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+)
+
+// Client calls the API of one server. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	userAgent  string
+
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	apiKey string
+	tokens *tokenSource
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithAPIKey authenticates requests with an API key
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithToken authenticates requests with a JWT token obtained elsewhere. The
+// client can't renew it; once it expires requests fail with 401.
+func WithToken(token string) Option {
+	return func(c *Client) { c.tokens = &tokenSource{token: token} }
+}
+
+// WithCredentials signs in as username when a token is first needed, and
+// again whenever the token is about to expire or is rejected
+func WithCredentials(username, password string) Option {
+	return func(c *Client) { c.tokens = &tokenSource{username: username, password: password} }
+}
+
+// WithRetries retries failed requests up to retries times, waiting an
+// exponential backoff between minBackoff and maxBackoff, or as long as a
+// Retry-After header asks. 0 retries turns retrying off.
+func WithRetries(retries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithUserAgent sets the User-Agent header of requests
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// New returns a client of the server at baseURL, such as
+// http://localhost:8080
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("client: base URL %q must be http or https", baseURL)
+	}
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		userAgent:  "exampleserver-client",
+		retries:    defaultRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Error is a failed API call, with the problem details the server sent
+type Error struct {
+	StatusCode int    `json:"status"`
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Detail     string `json:"detail,omitempty"`
+	Instance   string `json:"instance,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// StatusCode returns the HTTP status of err if it is an *Error, or 0
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool { return StatusCode(err) == http.StatusNotFound }
+
+// IsConflict reports whether err is a 409 response, such as for an email
+// already in use
+func IsConflict(err error) bool { return StatusCode(err) == http.StatusConflict }
+
+// IsPreconditionFailed reports whether err is a 412 response to a change
+// based on a stale ETag
+func IsPreconditionFailed(err error) bool {
+	return StatusCode(err) == http.StatusPreconditionFailed
+}
+
+// request is one API call
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	header http.Header
+	// public requests are sent without credentials, such as logins
+	public bool
+}
+
+// do sends req, retrying it when safe, and decodes a successful JSON
+// response into out unless it is nil. Failures are returned as *Error.
+func (c *Client) do(ctx context.Context, req request, out interface{}) (http.Header, error) {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := decodeJSON(resp, out); err != nil {
+			return nil, err
+		}
+	}
+	return resp.Header, nil
+}
+
+// send sends req until it succeeds, fails for good or runs out of retries,
+// returning the successful response with its body unread
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, fmt.Errorf("client: error encoding request: %w", err)
+		}
+	}
+	retryable := retrySafe(req)
+	reauthenticated := false
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.sendOnce(ctx, req, body)
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || !retryable || attempt >= c.retries {
+				return nil, err
+			}
+		case resp.StatusCode < 300:
+			return resp, nil
+		case resp.StatusCode == http.StatusUnauthorized && !req.public && c.tokens.renewable() && !reauthenticated:
+			// The token may have been revoked; sign in again once
+			drain(resp)
+			c.tokens.invalidate()
+			reauthenticated = true
+			attempt--
+			continue
+		case retryable && attempt < c.retries && retryStatus(resp.StatusCode):
+			wait = retryAfter(resp.Header.Get("Retry-After"))
+			drain(resp)
+		default:
+			defer resp.Body.Close()
+			return nil, readError(resp)
+		}
+
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, req request, body []byte) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += req.path
+	u.RawQuery = req.query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if httpReq.Header.Get("Accept") == "" {
+		httpReq.Header.Set("Accept", "application/json")
+	}
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if !req.public {
+		if err := c.authenticate(ctx, httpReq); err != nil {
+			return nil, err
+		}
+	}
+	return c.httpClient.Do(httpReq)
+}
+
+// authenticate adds the client's credentials to req
+func (c *Client) authenticate(ctx context.Context, req *http.Request) error {
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+		return nil
+	}
+	if c.tokens == nil {
+		return nil
+	}
+	token, err := c.tokens.get(ctx, c)
+	if err != nil {
+		return fmt.Errorf("client: error signing in: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// backoff is the wait before retry attempt+1
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.minBackoff << attempt
+	if wait <= 0 || wait > c.maxBackoff {
+		wait = c.maxBackoff
+	}
+	return wait
+}
+
+// retrySafe reports whether req can be sent again without repeating its
+// effect: reads, idempotent methods, and POSTs with an Idempotency-Key the
+// server replays
+func retrySafe(req request) bool {
+	switch req.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.header.Get("Idempotency-Key") != ""
+}
+
+func retryStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given in seconds
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(header))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// idempotencyKey returns a random key letting a POST be retried safely
+func idempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func decodeJSON(resp *http.Response, out interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return fmt.Errorf("client: unexpected response media type %q", mediaType)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("client: error decoding response: %w", err)
+	}
+	return nil
+}
+
+// readError turns a failed response into an *Error, filling in what the
+// server left out when it didn't send problem details
+func readError(resp *http.Response) error {
+	apiErr := &Error{}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	json.Unmarshal(body, apiErr)
+	apiErr.StatusCode = resp.StatusCode
+	if apiErr.Title == "" {
+		apiErr.Title = http.StatusText(resp.StatusCode)
+	}
+	if apiErr.Detail == "" && apiErr.Type == "" {
+		apiErr.Detail = strings.TrimSpace(string(body))
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	return apiErr
+}
+
+// drain discards the rest of a response so its connection can be reused
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// tokenSource holds the JWT token of a client, signing in for a new one
+// when it is missing or about to expire
+type tokenSource struct {
+	mu          sync.Mutex
+	username    string
+	password    string
+	token       string
+	deviceToken string
+	expires     time.Time
+}
+
+// renewBefore is how long before expiry a token is renewed
+const renewBefore = 30 * time.Second
+
+func (t *tokenSource) renewable() bool {
+	return t != nil && t.username != ""
+}
+
+func (t *tokenSource) get(ctx context.Context, c *Client) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.renewable() || (t.token != "" && (t.expires.IsZero() || time.Until(t.expires) > renewBefore)) {
+		return t.token, nil
+	}
+
+	var resp LoginResponse
+	var err error
+	if t.deviceToken != "" {
+		// The device token of the last login spares sending the password
+		if resp, err = c.DeviceLogin(ctx, t.deviceToken); err != nil && StatusCode(err) != http.StatusUnauthorized {
+			return "", err
+		}
+		if err != nil {
+			t.deviceToken = ""
+		}
+	}
+	if resp.Token == "" {
+		if resp, err = c.login(ctx, t.username, t.password, true); err != nil {
+			return "", err
+		}
+	}
+	t.token = resp.Token
+	if resp.DeviceToken != "" {
+		t.deviceToken = resp.DeviceToken
+	}
+	t.expires = tokenExpiry(resp.Token)
+	return t.token, nil
+}
+
+// invalidate drops the token so the next request signs in again
+func (t *tokenSource) invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = ""
+}
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Customer is a customer record. ETag is the version it was read at, sent
+// with ReplaceCustomer and DeleteCustomer so they fail with 412 if the
+// customer has changed since.
+type Customer struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	ETag      string     `json:"-"`
+}
+
+// CustomerInput is the data of a new or replaced customer
+type CustomerInput struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// CustomerPatch changes the fields that are set and leaves the others
+type CustomerPatch struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
+}
+
+// ListOptions pages through a list. A zero Limit lists everything.
+type ListOptions struct {
+	Limit  int
+	Offset int
+}
+
+// SearchResult is a customer matching a search, with its rank and the
+// matching part of its name or email
+type SearchResult struct {
+	Customer Customer `json:"customer"`
+	Rank     float64  `json:"rank"`
+	Snippet  string   `json:"snippet"`
+}
+
+// CustomerChange is one change in a customer's history. Before is nil for
+// the creation and After for the deletion.
+type CustomerChange struct {
+	ID         string    `json:"id"`
+	CustomerID string    `json:"customer_id"`
+	Action     string    `json:"action"`
+	Actor      string    `json:"actor,omitempty"`
+	Before     *Customer `json:"before,omitempty"`
+	After      *Customer `json:"after,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// CustomerImportResult is the result of an import task
+type CustomerImportResult struct {
+	Created int `json:"created"`
+	Failed  []struct {
+		Index int    `json:"index"`
+		Error string `json:"error"`
+	} `json:"failed"`
+}
+
+// Customers lists customers
+func (c *Client) Customers(ctx context.Context, opts ListOptions) ([]Customer, error) {
+	query := url.Values{}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		query.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	var resp struct {
+		Customers []Customer `json:"customers"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/api/customers", query: query}, &resp)
+	return resp.Customers, err
+}
+
+// Customer gets a customer by ID
+func (c *Client) Customer(ctx context.Context, id string) (Customer, error) {
+	return c.customer(ctx, request{method: http.MethodGet, path: customerPath(id)})
+}
+
+// CreateCustomer creates a customer. Retries are sent with the same
+// Idempotency-Key, so they can't create it twice.
+func (c *Client) CreateCustomer(ctx context.Context, in CustomerInput) (Customer, error) {
+	return c.customer(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/customers",
+		body:   in,
+		header: http.Header{"Idempotency-Key": {idempotencyKey()}},
+	})
+}
+
+// ReplaceCustomer replaces the name and email of customer, failing with
+// 412 if it has changed since it was read with the ETag it carries
+func (c *Client) ReplaceCustomer(ctx context.Context, customer Customer) (Customer, error) {
+	return c.customer(ctx, request{
+		method: http.MethodPut,
+		path:   customerPath(customer.ID),
+		body:   CustomerInput{Name: customer.Name, Email: customer.Email},
+		header: ifMatch(customer.ETag),
+	})
+}
+
+// PatchCustomer changes some fields of a customer
+func (c *Client) PatchCustomer(ctx context.Context, id string, patch CustomerPatch) (Customer, error) {
+	return c.customer(ctx, request{method: http.MethodPatch, path: customerPath(id), body: patch})
+}
+
+// DeleteCustomer deletes a customer. Pass the ETag it was read at to fail
+// with 412 if it has changed since, or "" to delete it regardless.
+func (c *Client) DeleteCustomer(ctx context.Context, id, etag string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: customerPath(id), header: ifMatch(etag)}, nil)
+	return err
+}
+
+// RestoreCustomer brings back a deleted customer
+func (c *Client) RestoreCustomer(ctx context.Context, id string) (Customer, error) {
+	return c.customer(ctx, request{method: http.MethodPost, path: customerPath(id) + "/restore"})
+}
+
+// SearchCustomers finds customers whose name or email has words starting
+// with those of query, best first. A zero limit gets the server's default.
+func (c *Client) SearchCustomers(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	params := url.Values{"q": {query}}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	var resp struct {
+		Results []SearchResult `json:"results"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/api/customers/search", query: params}, &resp)
+	return resp.Results, err
+}
+
+// CustomerHistory lists the changes made to a customer, oldest first
+func (c *Client) CustomerHistory(ctx context.Context, id string) ([]CustomerChange, error) {
+	var resp struct {
+		Changes []CustomerChange `json:"changes"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: customerPath(id) + "/history"}, &resp)
+	return resp.Changes, err
+}
+
+// ImportCustomers queues the creation of customers in bulk. Wait for the
+// returned task with WaitTask and decode its CustomerImportResult with
+// Task.DecodeResult.
+func (c *Client) ImportCustomers(ctx context.Context, customers []CustomerInput) (Task, error) {
+	var task Task
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/customers/import",
+		body:   map[string][]CustomerInput{"customers": customers},
+	}, &task)
+	return task, err
+}
+
+func (c *Client) customer(ctx context.Context, req request) (Customer, error) {
+	var customer Customer
+	header, err := c.do(ctx, req, &customer)
+	if err != nil {
+		return Customer{}, err
+	}
+	customer.ETag = header.Get("ETag")
+	return customer, nil
+}
+
+func customerPath(id string) string {
+	return "/api/customers/" + url.PathEscape(id)
+}
+
+func ifMatch(etag string) http.Header {
+	if etag == "" {
+		return nil
+	}
+	return http.Header{"If-Match": {etag}}
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// LogQuery selects log lines. LastMinutes overrides From and To; with
+// nothing set the server returns the last 100 lines.
+type LogQuery struct {
+	From        time.Time
+	To          time.Time
+	LastLines   int
+	LastMinutes int
+}
+
+// LogSummaryQuery selects the entries of a log summary. Zero values get the
+// server's defaults: the 24 hours up to now, grouped by level, with the top
+// 5 messages of each bucket.
+type LogSummaryQuery struct {
+	From    time.Time
+	To      time.Time
+	GroupBy string // level, hour or source
+	Top     int
+}
+
+// LogSummary counts the log entries between From and To by level, hour or
+// source
+type LogSummary struct {
+	From    time.Time   `json:"from"`
+	To      time.Time   `json:"to"`
+	GroupBy string      `json:"group_by"`
+	Total   int         `json:"total"`
+	Buckets []LogBucket `json:"buckets"`
+}
+
+// LogBucket counts the entries of one level, hour or source, with the
+// messages logged most often
+type LogBucket struct {
+	Key         string         `json:"key"`
+	Count       int            `json:"count"`
+	Levels      map[string]int `json:"levels,omitempty"`
+	TopMessages []struct {
+		Message string `json:"message"`
+		Count   int    `json:"count"`
+		Example string `json:"example"`
+	} `json:"top_messages"`
+}
+
+// Logs returns log lines as the server wrote them, oldest first
+func (c *Client) Logs(ctx context.Context, q LogQuery) ([]string, error) {
+	query := url.Values{"format": {"json"}}
+	if !q.From.IsZero() {
+		query.Set("from_time", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		query.Set("to_time", q.To.Format(time.RFC3339))
+	}
+	if q.LastLines > 0 {
+		query.Set("last_lines", strconv.Itoa(q.LastLines))
+	}
+	if q.LastMinutes > 0 {
+		query.Set("last_minutes", strconv.Itoa(q.LastMinutes))
+	}
+	var resp struct {
+		Lines []string `json:"lines"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/api/logging/log", query: query}, &resp)
+	return resp.Lines, err
+}
+
+// LogSummary counts the log entries of a period
+func (c *Client) LogSummary(ctx context.Context, q LogSummaryQuery) (LogSummary, error) {
+	query := url.Values{}
+	if !q.From.IsZero() {
+		query.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		query.Set("to", q.To.Format(time.RFC3339))
+	}
+	if q.GroupBy != "" {
+		query.Set("group_by", q.GroupBy)
+	}
+	if q.Top > 0 {
+		query.Set("top", strconv.Itoa(q.Top))
+	}
+	var summary LogSummary
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/api/logging/summary", query: query}, &summary)
+	return summary, err
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsSample is one sample of the server's runtime and application
+// metrics
+type StatsSample struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Metrics   map[string]float64 `json:"metrics"`
+}
+
+// BuildInfo describes the server binary
+type BuildInfo struct {
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit"`
+	BuildDate string    `json:"build_date"`
+	GoVersion string    `json:"go_version"`
+	StartTime time.Time `json:"start_time"`
+}
+
+// RouteLatency is the latency of one route, in milliseconds
+type RouteLatency struct {
+	Route string  `json:"route"`
+	Count uint64  `json:"count"`
+	Mean  float64 `json:"mean_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// Stats is the latest stats sample with per-route latencies
+type Stats struct {
+	StatsSample
+	Uptime  string         `json:"uptime"`
+	Build   BuildInfo      `json:"build"`
+	Latency []RouteLatency `json:"latency"`
+}
+
+// RouteErrors counts the error responses of one route over a window
+type RouteErrors struct {
+	Route        string  `json:"route"`
+	Requests     uint64  `json:"requests"`
+	ClientErrors uint64  `json:"client_errors"`
+	ServerErrors uint64  `json:"server_errors"`
+	ErrorRate    float64 `json:"error_rate"`
+}
+
+// Stats gets the latest stats sample. It fails with 503 until the first
+// sample is collected.
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/api/stats"}, &stats)
+	return stats, err
+}
+
+// StatsErrors lists the routes with the most error responses over window,
+// worst first. Zero values get the server's defaults of 5 minutes and 10
+// routes.
+func (c *Client) StatsErrors(ctx context.Context, window time.Duration, limit int) ([]RouteErrors, error) {
+	query := url.Values{}
+	if window > 0 {
+		query.Set("window", window.String())
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var resp struct {
+		Routes []RouteErrors `json:"routes"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/api/stats/errors", query: query}, &resp)
+	return resp.Routes, err
+}
+
+// StreamStats calls fn with each stats sample the server streams until ctx
+// is done, fn returns an error or the server shuts down, which ends the
+// stream with a nil error. Use an HTTP client without a Timeout, which
+// would cut the stream short.
+func (c *Client) StreamStats(ctx context.Context, fn func(StatsSample) error) error {
+	resp, err := c.send(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/stats/stream",
+		header: http.Header{"Accept": {"text/event-stream"}},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Server-sent events are blocks of "field: value" lines ending with a
+	// blank line
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	var event string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			}
+			continue
+		}
+
+		switch event {
+		case "stats":
+			var sample StatsSample
+			if err := json.Unmarshal([]byte(data.String()), &sample); err != nil {
+				return fmt.Errorf("client: error decoding stats sample: %w", err)
+			}
+			if err := fn(sample); err != nil {
+				return err
+			}
+		case "shutdown":
+			return nil
+		}
+		event = ""
+		data.Reset()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
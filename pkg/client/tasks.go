@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// States of a background task
+const (
+	TaskPending   = "pending"
+	TaskRunning   = "running"
+	TaskSucceeded = "succeeded"
+	TaskFailed    = "failed"
+)
+
+// Task is a background task started by a request answered with 202, such
+// as a customer import
+type Task struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	State      string          `json:"state"`
+	Done       int             `json:"done"`
+	Total      int             `json:"total,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Location   string          `json:"location,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the task has succeeded or failed
+func (t Task) Finished() bool {
+	return t.State == TaskSucceeded || t.State == TaskFailed
+}
+
+// DecodeResult decodes the result of a succeeded task into v
+func (t Task) DecodeResult(v interface{}) error {
+	if len(t.Result) == 0 {
+		return errors.New("client: task has no result")
+	}
+	return json.Unmarshal(t.Result, v)
+}
+
+// Task gets the progress, result or error of a background task
+func (c *Client) Task(ctx context.Context, id string) (Task, error) {
+	var task Task
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/api/tasks/" + url.PathEscape(id)}, &task)
+	return task, err
+}
+
+// WaitTask polls a task every interval until it finishes or ctx is done,
+// returning it as it finished. A failed task is returned with a nil error;
+// check its State.
+func (c *Client) WaitTask(ctx context.Context, id string, interval time.Duration) (Task, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		task, err := c.Task(ctx, id)
+		if err != nil || task.Finished() {
+			return task, err
+		}
+		select {
+		case <-ctx.Done():
+			return task, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -12,11 +14,79 @@ import (
 
 type Config struct {
 	// Server
-	Port string
+	Port        string
+	SwaggerHost string
+
+	// Language of error messages for requests without Accept-Language
+	DefaultLanguage string
+
+	// Envelope of resources in JSON responses: none, jsonapi or hal
+	ResponseEnvelope string
 
 	// Auth
 	JWTSecret []byte
-	APIKeys   []string
+	APIKeys   map[string]string // key -> subject
+	// Roles and tenants of the subjects of API_KEYS; keys have none unless
+	// listed
+	APIKeyRoles   map[string][]string // subject -> roles
+	APIKeyTenants map[string][]string // subject -> tenants
+	// Key of signed download links; defaults to JWTSecret
+	SignedURLSecret []byte
+
+	// JWE encryption of issued tokens; no algorithm leaves them signed only
+	JWTEncryptionAlg string
+	JWTEncryptionKey string // base64
+
+	// Admin user created at startup when it doesn't exist
+	AdminUsername string
+	AdminPassword string
+
+	// Password hashing: bcrypt or argon2id, with the Argon2id memory in KiB
+	PasswordHash      string
+	Argon2Memory      int
+	Argon2Time        int
+	Argon2Parallelism int
+
+	// Authorization policy beyond role checks: none, casbin (model and
+	// policy files) or opa (decision URL of an OPA sidecar)
+	AuthzPolicy  string
+	CasbinModel  string
+	CasbinPolicy string
+	OPAURL       string
+
+	// Bearer token identity providers use for the SCIM endpoints, which are
+	// disabled without one
+	SCIMToken string
+
+	// Public URL of the server, for links sent out of band such as password
+	// reset links
+	PublicURL string
+
+	// Social login. Providers without a client ID are disabled. Callbacks
+	// are OAuthRedirectBaseURL/api/auth/{provider}/callback.
+	OAuthGitHubClientID     string
+	OAuthGitHubClientSecret string
+	OAuthGoogleClientID     string
+	OAuthGoogleClientSecret string
+	OAuthRedirectBaseURL    string
+	OAuthSuccessURL         string
+
+	// Device tokens of logins with remember_me are valid this long
+	DeviceTokenTTL time.Duration
+
+	// Idempotency-Key responses are replayed for this long
+	IdempotencyTTL time.Duration
+
+	// Most requests POST /api/batch runs at once
+	BatchMaxRequests int
+
+	// Expose POST /api/admin/seed, which fills the stores with fake data.
+	// Development only.
+	SeedAPI bool
+
+	// DevMode accepts the gtest development API key, as an admin, when
+	// API_KEYS is empty. Never on in production.
+	DevMode bool
 
 	// Logging
 	LogDir        string
@@ -32,7 +102,163 @@ type Config struct {
 	DatadogEnv     string
 
 	// Stats
-	StatsInterval time.Duration
+	StatsInterval            time.Duration
+	StatsAlertRules          string
+	GoroutineGrowthIntervals int
+	GoroutineDumpDir         string
+	// Memory watchdog limits in megabytes, zero for none, and the actions
+	// it takes in turn while memory is over them: gc, drop-caches, unready
+	// or restart
+	MemoryRSSLimit  int
+	MemoryHeapLimit int
+	MemoryActions   []string
+	// TraceMaxDuration and TraceMaxSize, in megabytes, cap execution traces
+	// started through the admin API
+	TraceMaxDuration time.Duration
+	TraceMaxSize     int
+	// Samples are pushed to this Prometheus Pushgateway, if set, grouped
+	// by job and instance
+	StatsPushURL      string
+	StatsPushJob      string
+	StatsPushInstance string
+
+	// Background workers
+	Workers     int
+	WorkerQueue int
+	// Finished async tasks are reported for this long
+	TaskRetention time.Duration
+
+	// Storage
+	StoreDriver          string
+	StoreDSN             string
+	StoreMaxOpenConns    int
+	StoreMaxIdleConns    int
+	StoreConnMaxLifetime time.Duration
+	// Apply pending migrations on startup; otherwise "server migrate up"
+	// has to, and the server won't start while any are pending
+	StoreAutoMigrate bool
+
+	// Response cache
+	CacheDriver   string
+	CacheSize     int
+	CacheTTL      time.Duration
+	CacheRedisURL string
+
+	// Event outbox
+	OutboxInterval     time.Duration
+	OutboxRetention    time.Duration
+	OutboxMaxAttempts  int
+	OutboxKafkaBrokers []string
+	OutboxKafkaTopic   string
+
+	// Message queue consumer
+	QueueDriver      string // none, nats or rabbitmq
+	QueueURL         string
+	QueueGroup       string
+	QueueConcurrency int
+	QueueMaxAttempts int
+	QueueRetryDelay  time.Duration
+
+	// MQTT bridge
+	MQTTBroker        string
+	MQTTClientID      string
+	MQTTUsername      string
+	MQTTPassword      string
+	MQTTTLSCA         string
+	MQTTTLSCert       string
+	MQTTTLSKey        string
+	MQTTQoS           int
+	MQTTSubscribe     []string // topic filters logged unless an application handles them
+	MQTTTopicPrefix   string
+	MQTTPublishEvents bool
+	MQTTLogLevels     []string
+
+	// Server-rendered pages
+	PagesTemplateDir string // templates overriding or adding to the embedded ones
+
+	// Outbound webhooks may deliver to loopback, private and link-local
+	// addresses, for development
+	WebhookAllowPrivate bool
+
+	// Inbound webhooks
+	InboundWebhooks         string // name:scheme:secret entries, see InboundWebhookSources
+	InboundWebhookTolerance time.Duration
+	InboundWebhookRetention time.Duration
+
+	// Email
+	MailDriver       string // none, smtp or ses
+	MailFrom         string
+	MailTemplateDir  string // templates overriding or adding to the built-in ones
+	MailAlertTo      []string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	SMTPTLS          string // starttls, tls or none
+	MailSESRegion    string
+	MailSESEndpoint  string
+	MailSESAccessKey string
+	MailSESSecretKey string
+	MailSESToken     string
+
+	// Log maintenance
+	LogArchiveBucket    string
+	LogArchiveStore     string // s3 or gcs
+	LogArchivePrefix    string
+	LogArchiveRegion    string
+	LogArchiveEndpoint  string
+	LogArchiveAfter     time.Duration
+	LogArchiveAccessKey string
+	LogArchiveSecretKey string
+	LogArchiveToken     string
+	// Service account key file for a gcs archive; Application Default
+	// Credentials when empty
+	LogArchiveGCSCredentials string
+
+	// Traffic mirroring
+	MirrorURL     string // upstream receiving copies of requests; off when empty
+	MirrorPercent int
+	MirrorTimeout time.Duration
+	// MirrorWrites mirrors requests of every method, not just GET and HEAD
+	MirrorWrites bool
+
+	// Load shedding; a zero threshold is not checked
+	ShedMaxInFlight int
+	ShedMaxLatency  time.Duration // p99 of the previous stats interval
+	ShedRetryAfter  time.Duration
+	ShedExemptPaths []string // path prefixes served under overload besides health and admin
+
+	// Concurrency limits, zero for unlimited. Requests over a limit wait
+	// for up to ConcurrencyQueueTimeout.
+	ConcurrencyLimit        int
+	ConcurrencyRouteLimits  string // prefix=limit pairs, see RouteConcurrencyLimits
+	ConcurrencyQueueTimeout time.Duration
+
+	// RouteConfig is the YAML file of per-route overrides, see
+	// RouteOverrides
+	RouteConfig string
+
+	// Shutdown. The grace period bounds the steps of ShutdownOrder; the
+	// drain delay comes before it.
+	ShutdownGracePeriod time.Duration
+	ShutdownDrainDelay  time.Duration
+	ShutdownStreams     string   // close or wait
+	ShutdownOrder       []string // http, services or service names
+	ShutdownRestart     string   // exec or exit
+
+	// Dependency health checks run every HealthCheckInterval, each for up
+	// to HealthCheckTimeout unless HealthCheckTimeouts says otherwise.
+	// Readiness fails while a dependency in HealthCritical is unhealthy.
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	HealthCheckTimeouts string // name=seconds pairs, see DependencyTimeouts
+	HealthCritical      []string
+	// Readiness fails unless the background services in ServicesCritical
+	// are running
+	ServicesCritical []string
+	// ServicesReadyTimeout bounds the wait at startup for a service to be
+	// ready before those depending on it start
+	ServicesReadyTimeout time.Duration
 }
 
 func Load() (*Config, error) {
@@ -58,9 +284,52 @@ func Load() (*Config, error) {
 	}
 
 	return &Config{
-		Port:      getEnvDefault("PORT", "8080"),
-		JWTSecret: []byte(getEnvDefault("JWT_SECRET", "your-secret-key")),
-		APIKeys:   getAPIKeys(),
+		Port:          getEnvDefault("PORT", "8080"),
+		SwaggerHost:   os.Getenv("SWAGGER_HOST"),
+		JWTSecret:     []byte(getEnvDefault("JWT_SECRET", defaultJWTSecret)),
+		APIKeys:       getAPIKeys(),
+		APIKeyRoles:   getSubjectLists("API_KEY_ROLES"),
+		APIKeyTenants: getSubjectLists("API_KEY_TENANTS"),
+		DevMode:       getEnvBoolDefault("DEV_MODE", false),
+
+		SignedURLSecret: []byte(os.Getenv("SIGNED_URL_SECRET")),
+
+		JWTEncryptionAlg: os.Getenv("JWT_ENCRYPTION_ALG"),
+		JWTEncryptionKey: os.Getenv("JWT_ENCRYPTION_KEY"),
+
+		DefaultLanguage: getEnvDefault("DEFAULT_LANGUAGE", "en"),
+
+		ResponseEnvelope: getEnvDefault("RESPONSE_ENVELOPE", "none"),
+
+		AdminUsername: getEnvDefault("ADMIN_USERNAME", "admin"),
+		AdminPassword: os.Getenv("ADMIN_PASSWORD"),
+
+		PasswordHash:      getEnvDefault("PASSWORD_HASH", "bcrypt"),
+		Argon2Memory:      getEnvIntDefault("ARGON2_MEMORY", 65536), // 64 MiB
+		Argon2Time:        getEnvIntDefault("ARGON2_TIME", 3),
+		Argon2Parallelism: getEnvIntDefault("ARGON2_PARALLELISM", 4),
+
+		AuthzPolicy:  getEnvDefault("AUTHZ_POLICY", "none"),
+		CasbinModel:  getEnvDefault("CASBIN_MODEL", "config/casbin/model.conf"),
+		CasbinPolicy: getEnvDefault("CASBIN_POLICY", "config/casbin/policy.csv"),
+		OPAURL:       getEnvDefault("OPA_URL", "http://localhost:8181/v1/data/exampleserver/allow"),
+
+		SCIMToken: os.Getenv("SCIM_TOKEN"),
+
+		PublicURL: strings.TrimSuffix(getEnvDefault("PUBLIC_URL", "http://localhost:"+getEnvDefault("PORT", "8080")), "/"),
+
+		OAuthGitHubClientID:     os.Getenv("OAUTH_GITHUB_CLIENT_ID"),
+		OAuthGitHubClientSecret: os.Getenv("OAUTH_GITHUB_CLIENT_SECRET"),
+		OAuthGoogleClientID:     os.Getenv("OAUTH_GOOGLE_CLIENT_ID"),
+		OAuthGoogleClientSecret: os.Getenv("OAUTH_GOOGLE_CLIENT_SECRET"),
+		OAuthRedirectBaseURL:    strings.TrimSuffix(getEnvDefault("OAUTH_REDIRECT_BASE_URL", "http://localhost:"+getEnvDefault("PORT", "8080")), "/"),
+		OAuthSuccessURL:         os.Getenv("OAUTH_SUCCESS_URL"),
+
+		DeviceTokenTTL: time.Duration(getEnvIntDefault("DEVICE_TOKEN_TTL", 2592000)) * time.Second,
+		IdempotencyTTL: time.Duration(getEnvIntDefault("IDEMPOTENCY_TTL", 86400)) * time.Second,
+
+		BatchMaxRequests: getEnvIntDefault("BATCH_MAX_REQUESTS", 20),
+		SeedAPI:          getEnvBoolDefault("SEED_API", false),
 
 		// Logging
 		LogDir:        logDir,
@@ -76,10 +345,217 @@ func Load() (*Config, error) {
 		DatadogEnv:     getEnvDefault("DD_ENV", "development"),
 
 		// Stats
-		StatsInterval: time.Duration(getEnvIntDefault("STATS_INTERVAL", 60)) * time.Second,
+		StatsInterval:            time.Duration(getEnvIntDefault("STATS_INTERVAL", 60)) * time.Second,
+		StatsAlertRules:          os.Getenv("STATS_ALERTS"),
+		GoroutineGrowthIntervals: getEnvIntDefault("GOROUTINE_GROWTH_INTERVALS", 5), // 0 disables the watchdog
+		GoroutineDumpDir:         os.Getenv("GOROUTINE_DUMP_DIR"),
+		MemoryRSSLimit:           getEnvIntDefault("MEMORY_RSS_LIMIT", 0),
+		MemoryHeapLimit:          getEnvIntDefault("MEMORY_HEAP_LIMIT", 0),
+		MemoryActions:            getEnvListDefault("MEMORY_ACTIONS", "gc,drop-caches,unready"),
+		TraceMaxDuration:         time.Duration(getEnvIntDefault("TRACE_MAX_DURATION", 60)) * time.Second,
+		TraceMaxSize:             getEnvIntDefault("TRACE_MAX_SIZE", 64),
+		StatsPushURL:             os.Getenv("STATS_PUSH_URL"),
+		StatsPushJob:             getEnvDefault("STATS_PUSH_JOB", "exampleserver"),
+		StatsPushInstance:        getEnvDefault("STATS_PUSH_INSTANCE", hostname()),
+
+		// Background workers
+		Workers:     getEnvIntDefault("WORKERS", runtime.NumCPU()),
+		WorkerQueue: getEnvIntDefault("WORKER_QUEUE", 1000),
+
+		TaskRetention: time.Duration(getEnvIntDefault("TASK_RETENTION", 3600)) * time.Second,
+
+		// Storage
+		StoreDriver:          getEnvDefault("STORE_DRIVER", "memory"),
+		StoreDSN:             os.Getenv("STORE_DSN"),
+		StoreMaxOpenConns:    getEnvIntDefault("STORE_MAX_OPEN_CONNS", 10),
+		StoreMaxIdleConns:    getEnvIntDefault("STORE_MAX_IDLE_CONNS", 5),
+		StoreConnMaxLifetime: time.Duration(getEnvIntDefault("STORE_CONN_MAX_LIFETIME", 300)) * time.Second,
+		StoreAutoMigrate:     getEnvBoolDefault("STORE_AUTO_MIGRATE", true),
+
+		// Response cache
+		CacheDriver:   getEnvDefault("CACHE_DRIVER", "memory"),
+		CacheSize:     getEnvIntDefault("CACHE_SIZE", 1000),
+		CacheTTL:      time.Duration(getEnvIntDefault("CACHE_TTL", 30)) * time.Second,
+		CacheRedisURL: getEnvDefault("CACHE_REDIS_URL", "redis://localhost:6379/0"),
+
+		// Event outbox
+		OutboxInterval:     time.Duration(getEnvIntDefault("OUTBOX_INTERVAL", 1000)) * time.Millisecond,
+		OutboxRetention:    time.Duration(getEnvIntDefault("OUTBOX_RETENTION", 604800)) * time.Second,
+		OutboxMaxAttempts:  getEnvIntDefault("OUTBOX_MAX_ATTEMPTS", 20),
+		OutboxKafkaBrokers: getEnvList("OUTBOX_KAFKA_BROKERS"),
+		OutboxKafkaTopic:   getEnvDefault("OUTBOX_KAFKA_TOPIC", "customer-events"),
+
+		// Message queue consumer
+		QueueDriver:      getEnvDefault("QUEUE_DRIVER", "none"),
+		QueueURL:         os.Getenv("QUEUE_URL"),
+		QueueGroup:       getEnvDefault("QUEUE_GROUP", "exampleserver"),
+		QueueConcurrency: getEnvIntDefault("QUEUE_CONCURRENCY", 4),
+		QueueMaxAttempts: getEnvIntDefault("QUEUE_MAX_ATTEMPTS", 5),
+		QueueRetryDelay:  time.Duration(getEnvIntDefault("QUEUE_RETRY_DELAY", 1000)) * time.Millisecond,
+
+		// MQTT bridge
+		MQTTBroker:        os.Getenv("MQTT_BROKER"),
+		MQTTClientID:      getEnvDefault("MQTT_CLIENT_ID", "exampleserver-"+hostname()),
+		MQTTUsername:      os.Getenv("MQTT_USERNAME"),
+		MQTTPassword:      os.Getenv("MQTT_PASSWORD"),
+		MQTTTLSCA:         os.Getenv("MQTT_TLS_CA"),
+		MQTTTLSCert:       os.Getenv("MQTT_TLS_CERT"),
+		MQTTTLSKey:        os.Getenv("MQTT_TLS_KEY"),
+		MQTTQoS:           getEnvIntDefault("MQTT_QOS", 1),
+		MQTTSubscribe:     getEnvList("MQTT_SUBSCRIBE"),
+		MQTTTopicPrefix:   getEnvDefault("MQTT_TOPIC_PREFIX", "exampleserver"),
+		MQTTPublishEvents: getEnvBoolDefault("MQTT_PUBLISH_EVENTS", true),
+		MQTTLogLevels:     getEnvList("MQTT_LOG_LEVELS"),
+
+		// Server-rendered pages
+		PagesTemplateDir: os.Getenv("PAGES_TEMPLATE_DIR"),
+
+		WebhookAllowPrivate: getEnvBoolDefault("WEBHOOK_ALLOW_PRIVATE", false),
+
+		// Inbound webhooks
+		InboundWebhooks:         os.Getenv("INBOUND_WEBHOOK_SOURCES"),
+		InboundWebhookTolerance: time.Duration(getEnvIntDefault("INBOUND_WEBHOOK_TOLERANCE", 300)) * time.Second,
+		InboundWebhookRetention: time.Duration(getEnvIntDefault("INBOUND_WEBHOOK_RETENTION", 604800)) * time.Second,
+
+		// Email
+		MailDriver:       getEnvDefault("MAIL_DRIVER", "none"),
+		MailFrom:         os.Getenv("MAIL_FROM"),
+		MailTemplateDir:  os.Getenv("MAIL_TEMPLATE_DIR"),
+		MailAlertTo:      getEnvList("MAIL_ALERT_TO"),
+		SMTPHost:         os.Getenv("SMTP_HOST"),
+		SMTPPort:         getEnvIntDefault("SMTP_PORT", 587),
+		SMTPUsername:     os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:     os.Getenv("SMTP_PASSWORD"),
+		SMTPTLS:          getEnvDefault("SMTP_TLS", "starttls"),
+		MailSESRegion:    getEnvDefault("MAIL_SES_REGION", "us-east-1"),
+		MailSESEndpoint:  os.Getenv("MAIL_SES_ENDPOINT"),
+		MailSESAccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		MailSESSecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		MailSESToken:     os.Getenv("AWS_SESSION_TOKEN"),
+
+		// Log maintenance
+		LogArchiveBucket:         os.Getenv("LOG_ARCHIVE_BUCKET"),
+		LogArchiveStore:          getEnvDefault("LOG_ARCHIVE_STORE", "s3"),
+		LogArchivePrefix:         getEnvDefault("LOG_ARCHIVE_PREFIX", "logs"),
+		LogArchiveRegion:         getEnvDefault("LOG_ARCHIVE_REGION", "us-east-1"),
+		LogArchiveEndpoint:       os.Getenv("LOG_ARCHIVE_ENDPOINT"),
+		LogArchiveAfter:          time.Duration(getEnvIntDefault("LOG_ARCHIVE_AFTER", 86400)) * time.Second,
+		LogArchiveAccessKey:      os.Getenv("AWS_ACCESS_KEY_ID"),
+		LogArchiveSecretKey:      os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		LogArchiveToken:          os.Getenv("AWS_SESSION_TOKEN"),
+		LogArchiveGCSCredentials: os.Getenv("LOG_ARCHIVE_GCS_CREDENTIALS"),
+
+		// Traffic mirroring
+		MirrorURL:     os.Getenv("MIRROR_URL"),
+		MirrorPercent: getEnvIntDefault("MIRROR_PERCENT", 100),
+		MirrorTimeout: time.Duration(getEnvIntDefault("MIRROR_TIMEOUT", 5)) * time.Second,
+		MirrorWrites:  getEnvBoolDefault("MIRROR_WRITES", false),
+
+		// Load shedding
+		ShedMaxInFlight: getEnvIntDefault("SHED_MAX_IN_FLIGHT", 0),
+		ShedMaxLatency:  time.Duration(getEnvIntDefault("SHED_MAX_LATENCY", 0)) * time.Millisecond,
+		ShedRetryAfter:  time.Duration(getEnvIntDefault("SHED_RETRY_AFTER", 5)) * time.Second,
+		ShedExemptPaths: getEnvList("SHED_EXEMPT_PATHS"),
+
+		// Concurrency limits
+		ConcurrencyLimit:        getEnvIntDefault("CONCURRENCY_LIMIT", 0),
+		ConcurrencyRouteLimits:  getEnvDefault("CONCURRENCY_ROUTE_LIMITS", "/api/logging/=4"),
+		ConcurrencyQueueTimeout: time.Duration(getEnvIntDefault("CONCURRENCY_QUEUE_TIMEOUT", 1000)) * time.Millisecond,
+
+		// Per-route overrides
+		RouteConfig: getEnvDefault("ROUTE_CONFIG", "config/routes.yaml"),
+
+		// Shutdown
+		ShutdownGracePeriod: time.Duration(getEnvIntDefault("SHUTDOWN_GRACE_PERIOD", 30)) * time.Second,
+		ShutdownDrainDelay:  time.Duration(getEnvIntDefault("SHUTDOWN_DRAIN_DELAY", 0)) * time.Second,
+		ShutdownStreams:     getEnvDefault("SHUTDOWN_STREAMS", "close"),
+		ShutdownOrder:       getEnvListDefault("SHUTDOWN_ORDER", "http,services"),
+		ShutdownRestart:     getEnvDefault("SHUTDOWN_RESTART", "exec"),
+
+		// Dependency health
+		HealthCheckInterval:  time.Duration(getEnvIntDefault("HEALTH_CHECK_INTERVAL", 15)) * time.Second,
+		HealthCheckTimeout:   time.Duration(getEnvIntDefault("HEALTH_CHECK_TIMEOUT", 5)) * time.Second,
+		HealthCheckTimeouts:  os.Getenv("HEALTH_CHECK_TIMEOUTS"),
+		HealthCritical:       getEnvListDefault("HEALTH_CRITICAL", "database"),
+		ServicesCritical:     getEnvListDefault("SERVICES_CRITICAL", "scheduler,workers,outbox"),
+		ServicesReadyTimeout: time.Duration(getEnvIntDefault("SERVICES_READY_TIMEOUT", 30)) * time.Second,
 	}, nil
 }
 
+// RouteConcurrencyLimits parses CONCURRENCY_ROUTE_LIMITS, comma separated
+// path prefixes with the number of their requests that may run at once,
+// e.g. /api/logging/=4,/api/customers/import=2
+func (c *Config) RouteConcurrencyLimits() (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, entry := range strings.Split(c.ConcurrencyRouteLimits, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		prefix, value, ok := strings.Cut(entry, "=")
+		limit, err := strconv.Atoi(value)
+		if !ok || !strings.HasPrefix(prefix, "/") || err != nil || limit < 1 {
+			return nil, fmt.Errorf("CONCURRENCY_ROUTE_LIMITS entry %q must be a path prefix and a positive limit, e.g. /api/logging/=4", entry)
+		}
+		limits[prefix] = limit
+	}
+	return limits, nil
+}
+
+// InboundWebhookSource is a sender of inbound webhooks, its signature
+// scheme and the secret it signs with
+type InboundWebhookSource struct {
+	Name   string
+	Scheme string
+	Secret string
+}
+
+// InboundWebhookSources parses INBOUND_WEBHOOK_SOURCES, comma separated
+// source names with their signature scheme (standard, github or stripe)
+// and shared secret, e.g. billing:stripe:whsec_abc,ci:github:s3cret
+func (c *Config) InboundWebhookSources() ([]InboundWebhookSource, error) {
+	var sources []InboundWebhookSource
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(c.InboundWebhooks, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" || strings.ContainsAny(parts[0], "/.") {
+			return nil, fmt.Errorf("INBOUND_WEBHOOK_SOURCES entry %q must be a name, a scheme and a secret, e.g. billing:stripe:whsec_abc", entry)
+		}
+		switch parts[1] {
+		case "standard", "github", "stripe":
+		default:
+			return nil, fmt.Errorf("INBOUND_WEBHOOK_SOURCES scheme %q of %s must be standard, github or stripe", parts[1], parts[0])
+		}
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("INBOUND_WEBHOOK_SOURCES lists %s more than once", parts[0])
+		}
+		seen[parts[0]] = true
+		sources = append(sources, InboundWebhookSource{Name: parts[0], Scheme: parts[1], Secret: parts[2]})
+	}
+	return sources, nil
+}
+
+// DependencyTimeouts parses HEALTH_CHECK_TIMEOUTS, comma separated
+// dependency names with the seconds their checks may take, e.g.
+// database=2,object-storage=10
+func (c *Config) DependencyTimeouts() (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(c.HealthCheckTimeouts, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		seconds, err := strconv.Atoi(value)
+		if !ok || name == "" || err != nil || seconds < 1 {
+			return nil, fmt.Errorf("HEALTH_CHECK_TIMEOUTS entry %q must be a dependency and a positive number of seconds, e.g. database=2", entry)
+		}
+		timeouts[name] = time.Duration(seconds) * time.Second
+	}
+	return timeouts, nil
+}
+
 func getEnvDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -105,10 +581,62 @@ func getEnvBoolDefault(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
-func getAPIKeys() []string {
-	apiKeys := os.Getenv("API_KEYS")
-	if apiKeys == "" {
-		return []string{"default-dev-key"}
+// getEnvList splits a comma separated variable, ignoring empty items
+func getEnvList(key string) []string {
+	return splitList(os.Getenv(key))
+}
+
+// getEnvListDefault is getEnvList with the comma separated defaultValue
+// used when key is unset or empty
+func getEnvListDefault(key, defaultValue string) []string {
+	return splitList(getEnvDefault(key, defaultValue))
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// hostname is the machine's host name, or "localhost" when it is unknown
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "localhost"
+	}
+	return name
+}
+
+// getAPIKeys parses API_KEYS, a comma separated list of keys, each
+// optionally prefixed with the subject it authenticates as (subject=key)
+func getAPIKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, entry := range getEnvList("API_KEYS") {
+		subject, key, ok := strings.Cut(entry, "=")
+		if !ok {
+			subject, key = "api-key", entry
+		}
+		keys[key] = subject
+	}
+	return keys
+}
+
+// getSubjectLists parses a comma separated list of subject=value+value
+// entries, such as API_KEY_ROLES giving the subjects of API_KEYS their roles
+func getSubjectLists(key string) map[string][]string {
+	lists := make(map[string][]string)
+	for _, entry := range getEnvList(key) {
+		subject, list, _ := strings.Cut(entry, "=")
+		subject = strings.TrimSpace(subject)
+		for _, value := range strings.Split(list, "+") {
+			if value = strings.TrimSpace(value); value != "" {
+				lists[subject] = append(lists[subject], value)
+			}
+		}
 	}
-	return filepath.SplitList(apiKeys)
+	return lists
 }
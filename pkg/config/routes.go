@@ -0,0 +1,110 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RouteOverride tunes the routes matching Path or Prefix, see
+// RouteOverrides. Settings left out keep the route's defaults.
+type RouteOverride struct {
+	// Path is a route template such as /api/customers/{id}; Prefix
+	// selects every route whose template starts with it instead
+	Path   string `yaml:"path"`
+	Prefix string `yaml:"prefix"`
+	// Methods are the methods overridden, all when empty
+	Methods []string `yaml:"methods"`
+	// Timeout bounds the request's context and the time to write the
+	// response, replacing the server's 15 second write timeout
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxBodyBytes caps the size of request bodies
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// RateLimit is how many requests a second each caller may make to the
+	// route, in bursts of up to Burst
+	RateLimit float64 `yaml:"rate_limit"`
+	Burst     int     `yaml:"burst"`
+	// Roles are required of the caller on top of authentication, all of
+	// them
+	Roles []string `yaml:"roles"`
+	// CacheTTL replaces CACHE_TTL for routes served from the response
+	// cache; zero stops them being cached
+	CacheTTL *time.Duration `yaml:"cache_ttl"`
+	// SLO is the service level objective tracked for each route matched
+	SLO *SLO `yaml:"slo"`
+}
+
+// SLO is a route's availability and/or latency objective over a rolling
+// window
+type SLO struct {
+	// Availability is the percentage of requests to answer without a 5xx
+	Availability float64 `yaml:"availability"`
+	// LatencyTarget is the percentage of requests to answer within Latency
+	Latency       time.Duration `yaml:"latency"`
+	LatencyTarget float64       `yaml:"latency_target"`
+	// Window is the period the error budget covers, 30 days by default
+	Window time.Duration `yaml:"window"`
+}
+
+// defaultSLOWindow is the error budget period of SLOs that don't set one
+const defaultSLOWindow = 30 * 24 * time.Hour
+
+// maxSLOWindow bounds the per-route history kept for SLOs
+const maxSLOWindow = 90 * 24 * time.Hour
+
+// routesFile is the layout of ROUTE_CONFIG
+type routesFile struct {
+	Routes []RouteOverride `yaml:"routes"`
+}
+
+// RouteOverrides reads the per-route overrides in the ROUTE_CONFIG file.
+// There are none when the file doesn't exist.
+func (c *Config) RouteOverrides() ([]RouteOverride, error) {
+	data, err := os.ReadFile(c.RouteConfig)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ROUTE_CONFIG: %w", err)
+	}
+	var file routesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("ROUTE_CONFIG %s: %w", c.RouteConfig, err)
+	}
+	for i, route := range file.Routes {
+		name := route.Path + route.Prefix
+		switch {
+		case (route.Path == "") == (route.Prefix == ""):
+			return nil, fmt.Errorf("ROUTE_CONFIG route %d must have either a path or a prefix", i+1)
+		case !strings.HasPrefix(name, "/"):
+			return nil, fmt.Errorf("ROUTE_CONFIG route %q must start with /", name)
+		case route.Timeout < 0 || route.MaxBodyBytes < 0 || route.RateLimit < 0 || route.Burst < 0:
+			return nil, fmt.Errorf("ROUTE_CONFIG route %q: timeout, max_body_bytes, rate_limit and burst must not be negative", name)
+		case route.CacheTTL != nil && *route.CacheTTL < 0:
+			return nil, fmt.Errorf("ROUTE_CONFIG route %q: cache_ttl must not be negative", name)
+		}
+		if slo := route.SLO; slo != nil {
+			if slo.Window == 0 {
+				slo.Window = defaultSLOWindow
+			}
+			switch {
+			case slo.Availability == 0 && slo.LatencyTarget == 0:
+				return nil, fmt.Errorf("ROUTE_CONFIG route %q: slo needs an availability or latency_target", name)
+			case slo.Availability < 0 || slo.Availability >= 100 || slo.LatencyTarget < 0 || slo.LatencyTarget >= 100:
+				return nil, fmt.Errorf("ROUTE_CONFIG route %q: slo availability and latency_target must be percentages below 100", name)
+			case (slo.LatencyTarget > 0) != (slo.Latency > 0):
+				return nil, fmt.Errorf("ROUTE_CONFIG route %q: slo latency and latency_target go together", name)
+			case slo.Window < time.Hour || slo.Window > maxSLOWindow || slo.Window%time.Hour != 0:
+				return nil, fmt.Errorf("ROUTE_CONFIG route %q: slo window must be whole hours between 1h and %s", name, maxSLOWindow)
+			}
+		}
+		for j, method := range route.Methods {
+			file.Routes[i].Methods[j] = strings.ToUpper(method)
+		}
+	}
+	return file.Routes, nil
+}
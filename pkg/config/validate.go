@@ -0,0 +1,368 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"exampleserver/pkg/i18n"
+)
+
+// defaultJWTSecret is used when JWT_SECRET is not set
+const defaultJWTSecret = "your-secret-key"
+
+// DevAPIKey is the development API key, only allowed with DEV_MODE
+const DevAPIKey = "gtest"
+
+// minSCIMTokenLength keeps the SCIM bearer token from being guessable
+const minSCIMTokenLength = 32
+
+// Validate reports settings that would stop the server from starting or
+// leave a feature broken
+func (c *Config) Validate() error {
+	var problems []error
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Errorf("PORT %q is not a valid port", c.Port))
+	}
+
+	if _, err := i18n.Match(c.DefaultLanguage); err != nil {
+		problems = append(problems, fmt.Errorf("DEFAULT_LANGUAGE: %w", err))
+	}
+	switch c.ResponseEnvelope {
+	case "none", "jsonapi", "hal":
+	default:
+		problems = append(problems, fmt.Errorf("RESPONSE_ENVELOPE %q must be none, jsonapi or hal", c.ResponseEnvelope))
+	}
+
+	if c.SCIMToken != "" && len(c.SCIMToken) < minSCIMTokenLength {
+		problems = append(problems, fmt.Errorf("SCIM_TOKEN must be at least %d characters", minSCIMTokenLength))
+	}
+
+	for provider, id := range map[string][2]string{
+		"GITHUB": {c.OAuthGitHubClientID, c.OAuthGitHubClientSecret},
+		"GOOGLE": {c.OAuthGoogleClientID, c.OAuthGoogleClientSecret},
+	} {
+		if id[0] != "" && id[1] == "" {
+			problems = append(problems, fmt.Errorf("OAUTH_%s_CLIENT_SECRET is required with OAUTH_%s_CLIENT_ID", provider, provider))
+		}
+	}
+	if c.OAuthGitHubClientID != "" || c.OAuthGoogleClientID != "" {
+		if u, err := url.Parse(c.OAuthRedirectBaseURL); err != nil || u.Host == "" {
+			problems = append(problems, fmt.Errorf("OAUTH_REDIRECT_BASE_URL %q is not a valid URL", c.OAuthRedirectBaseURL))
+		}
+		if c.OAuthSuccessURL != "" {
+			if u, err := url.Parse(c.OAuthSuccessURL); err != nil || u.Host == "" {
+				problems = append(problems, fmt.Errorf("OAUTH_SUCCESS_URL %q is not a valid URL", c.OAuthSuccessURL))
+			}
+		}
+	}
+
+	switch c.PasswordHash {
+	case "bcrypt":
+	case "argon2id":
+		if c.Argon2Time < 1 {
+			problems = append(problems, errors.New("ARGON2_TIME must be at least 1"))
+		}
+		if c.Argon2Parallelism < 1 || c.Argon2Parallelism > 255 {
+			problems = append(problems, errors.New("ARGON2_PARALLELISM must be between 1 and 255"))
+		} else if c.Argon2Memory < 8*c.Argon2Parallelism {
+			problems = append(problems, errors.New("ARGON2_MEMORY must be at least 8 KiB per ARGON2_PARALLELISM"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("PASSWORD_HASH %q must be bcrypt or argon2id", c.PasswordHash))
+	}
+
+	switch c.AuthzPolicy {
+	case "none":
+	case "casbin":
+		for name, path := range map[string]string{"CASBIN_MODEL": c.CasbinModel, "CASBIN_POLICY": c.CasbinPolicy} {
+			if _, err := os.Stat(path); err != nil {
+				problems = append(problems, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	case "opa":
+		if u, err := url.Parse(c.OPAURL); err != nil || u.Host == "" {
+			problems = append(problems, fmt.Errorf("OPA_URL %q is not a valid URL", c.OPAURL))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("AUTHZ_POLICY %q must be none, casbin or opa", c.AuthzPolicy))
+	}
+
+	switch c.StoreDriver {
+	case "memory":
+	case "sqlite", "postgres":
+		if c.StoreDSN == "" {
+			problems = append(problems, fmt.Errorf("STORE_DSN is required for the %s store", c.StoreDriver))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("STORE_DRIVER %q must be memory, sqlite or postgres", c.StoreDriver))
+	}
+
+	switch c.CacheDriver {
+	case "memory", "none":
+	case "redis":
+		if _, err := url.Parse(c.CacheRedisURL); err != nil {
+			problems = append(problems, fmt.Errorf("CACHE_REDIS_URL is invalid: %w", err))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("CACHE_DRIVER %q must be memory, redis or none", c.CacheDriver))
+	}
+
+	if c.Workers < 1 {
+		problems = append(problems, errors.New("WORKERS must be at least 1"))
+	}
+	if c.WorkerQueue < 1 {
+		problems = append(problems, errors.New("WORKER_QUEUE must be at least 1"))
+	}
+	if c.BatchMaxRequests < 1 {
+		problems = append(problems, errors.New("BATCH_MAX_REQUESTS must be at least 1"))
+	}
+	if c.OutboxMaxAttempts < 1 {
+		problems = append(problems, errors.New("OUTBOX_MAX_ATTEMPTS must be at least 1"))
+	}
+	for name, d := range map[string]time.Duration{
+		"STATS_INTERVAL":         c.StatsInterval,
+		"IDEMPOTENCY_TTL":        c.IdempotencyTTL,
+		"DEVICE_TOKEN_TTL":       c.DeviceTokenTTL,
+		"TASK_RETENTION":         c.TaskRetention,
+		"OUTBOX_INTERVAL":        c.OutboxInterval,
+		"OUTBOX_RETENTION":       c.OutboxRetention,
+		"SERVICES_READY_TIMEOUT": c.ServicesReadyTimeout,
+	} {
+		if d <= 0 {
+			problems = append(problems, fmt.Errorf("%s must be positive", name))
+		}
+	}
+	switch c.QueueDriver {
+	case "none":
+	case "nats", "rabbitmq":
+		if c.QueueURL == "" {
+			problems = append(problems, fmt.Errorf("QUEUE_URL is required for the %s queue", c.QueueDriver))
+		}
+		if c.QueueGroup == "" {
+			problems = append(problems, errors.New("QUEUE_GROUP must not be empty"))
+		}
+		if c.QueueConcurrency < 1 || c.QueueMaxAttempts < 1 {
+			problems = append(problems, errors.New("QUEUE_CONCURRENCY and QUEUE_MAX_ATTEMPTS must be at least 1"))
+		}
+		if c.QueueRetryDelay < 0 {
+			problems = append(problems, errors.New("QUEUE_RETRY_DELAY must not be negative"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("QUEUE_DRIVER %q must be none, nats or rabbitmq", c.QueueDriver))
+	}
+	if c.MQTTBroker != "" {
+		if u, err := url.Parse(c.MQTTBroker); err != nil || u.Host == "" {
+			problems = append(problems, fmt.Errorf("MQTT_BROKER %q is not a valid URL", c.MQTTBroker))
+		} else {
+			switch u.Scheme {
+			case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+			default:
+				problems = append(problems, fmt.Errorf("MQTT_BROKER %q must use tcp, mqtt, ssl, tls, mqtts, ws or wss", c.MQTTBroker))
+			}
+		}
+		if c.MQTTQoS < 0 || c.MQTTQoS > 2 {
+			problems = append(problems, errors.New("MQTT_QOS must be 0, 1 or 2"))
+		}
+		if (c.MQTTTLSCert == "") != (c.MQTTTLSKey == "") {
+			problems = append(problems, errors.New("MQTT_TLS_CERT and MQTT_TLS_KEY must be set together"))
+		}
+		for _, level := range c.MQTTLogLevels {
+			switch strings.ToUpper(level) {
+			case "DEBUG", "INFO", "WARN", "ERROR", "FATAL":
+			default:
+				problems = append(problems, fmt.Errorf("MQTT_LOG_LEVELS %q must be DEBUG, INFO, WARN, ERROR or FATAL", level))
+			}
+		}
+	}
+	if c.PagesTemplateDir != "" {
+		if info, err := os.Stat(c.PagesTemplateDir); err != nil {
+			problems = append(problems, fmt.Errorf("PAGES_TEMPLATE_DIR: %w", err))
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Errorf("PAGES_TEMPLATE_DIR %q is not a directory", c.PagesTemplateDir))
+		}
+	}
+	switch c.MailDriver {
+	case "none":
+	case "smtp", "ses":
+		if _, err := mail.ParseAddress(c.MailFrom); err != nil {
+			problems = append(problems, fmt.Errorf("MAIL_FROM %q must be an email address", c.MailFrom))
+		}
+		if c.MailDriver == "smtp" {
+			if c.SMTPHost == "" {
+				problems = append(problems, errors.New("SMTP_HOST is required for the smtp mail driver"))
+			}
+			if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+				problems = append(problems, fmt.Errorf("SMTP_PORT %d must be between 1 and 65535", c.SMTPPort))
+			}
+			switch c.SMTPTLS {
+			case "starttls", "tls", "none":
+			default:
+				problems = append(problems, fmt.Errorf("SMTP_TLS %q must be starttls, tls or none", c.SMTPTLS))
+			}
+		} else {
+			if c.MailSESAccessKey == "" || c.MailSESSecretKey == "" {
+				problems = append(problems, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required to send email with SES"))
+			}
+			if c.MailSESEndpoint != "" {
+				if u, err := url.Parse(c.MailSESEndpoint); err != nil || u.Host == "" {
+					problems = append(problems, fmt.Errorf("MAIL_SES_ENDPOINT %q is not a valid URL", c.MailSESEndpoint))
+				}
+			}
+		}
+		for _, to := range c.MailAlertTo {
+			if _, err := mail.ParseAddress(to); err != nil {
+				problems = append(problems, fmt.Errorf("MAIL_ALERT_TO %q must be an email address", to))
+			}
+		}
+		if c.MailTemplateDir != "" {
+			if info, err := os.Stat(c.MailTemplateDir); err != nil {
+				problems = append(problems, fmt.Errorf("MAIL_TEMPLATE_DIR: %w", err))
+			} else if !info.IsDir() {
+				problems = append(problems, fmt.Errorf("MAIL_TEMPLATE_DIR %q is not a directory", c.MailTemplateDir))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Errorf("MAIL_DRIVER %q must be none, smtp or ses", c.MailDriver))
+	}
+	if c.LogArchiveBucket != "" {
+		switch c.LogArchiveStore {
+		case "s3":
+			if c.LogArchiveAccessKey == "" || c.LogArchiveSecretKey == "" {
+				problems = append(problems, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required to archive logs"))
+			}
+		case "gcs":
+		default:
+			problems = append(problems, fmt.Errorf("LOG_ARCHIVE_STORE %q must be s3 or gcs", c.LogArchiveStore))
+		}
+		if c.LogArchiveAfter < 0 {
+			problems = append(problems, errors.New("LOG_ARCHIVE_AFTER must not be negative"))
+		}
+		if c.LogArchiveEndpoint != "" {
+			if u, err := url.Parse(c.LogArchiveEndpoint); err != nil || u.Host == "" {
+				problems = append(problems, fmt.Errorf("LOG_ARCHIVE_ENDPOINT %q is not a valid URL", c.LogArchiveEndpoint))
+			}
+		}
+	}
+	if c.MirrorURL != "" {
+		if u, err := url.Parse(c.MirrorURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, fmt.Errorf("MIRROR_URL %q is not a valid http(s) URL", c.MirrorURL))
+		}
+		if c.MirrorPercent < 0 || c.MirrorPercent > 100 {
+			problems = append(problems, errors.New("MIRROR_PERCENT must be between 0 and 100"))
+		}
+		if c.MirrorTimeout <= 0 {
+			problems = append(problems, errors.New("MIRROR_TIMEOUT must be positive"))
+		}
+	}
+	if c.ShedMaxInFlight < 0 || c.ShedMaxLatency < 0 {
+		problems = append(problems, errors.New("SHED_MAX_IN_FLIGHT and SHED_MAX_LATENCY must not be negative"))
+	}
+	if c.ShedRetryAfter < time.Second {
+		problems = append(problems, errors.New("SHED_RETRY_AFTER must be at least 1 second"))
+	}
+	if c.ConcurrencyLimit < 0 {
+		problems = append(problems, errors.New("CONCURRENCY_LIMIT must not be negative"))
+	}
+	if _, err := c.RouteConcurrencyLimits(); err != nil {
+		problems = append(problems, err)
+	}
+	if c.HealthCheckInterval <= 0 || c.HealthCheckTimeout <= 0 {
+		problems = append(problems, errors.New("HEALTH_CHECK_INTERVAL and HEALTH_CHECK_TIMEOUT must be positive"))
+	}
+	if _, err := c.DependencyTimeouts(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := c.InboundWebhookSources(); err != nil {
+		problems = append(problems, err)
+	}
+	if c.InboundWebhookTolerance <= 0 || c.InboundWebhookRetention <= 0 {
+		problems = append(problems, errors.New("INBOUND_WEBHOOK_TOLERANCE and INBOUND_WEBHOOK_RETENTION must be positive"))
+	}
+	if c.ConcurrencyQueueTimeout < 0 {
+		problems = append(problems, errors.New("CONCURRENCY_QUEUE_TIMEOUT must not be negative"))
+	}
+	if _, err := c.RouteOverrides(); err != nil {
+		problems = append(problems, err)
+	}
+	if c.MemoryRSSLimit < 0 || c.MemoryHeapLimit < 0 {
+		problems = append(problems, errors.New("MEMORY_RSS_LIMIT and MEMORY_HEAP_LIMIT must not be negative"))
+	}
+	for _, action := range c.MemoryActions {
+		switch action {
+		case "gc", "drop-caches", "unready", "restart":
+		default:
+			problems = append(problems, fmt.Errorf("MEMORY_ACTIONS %q must be gc, drop-caches, unready or restart", action))
+		}
+	}
+	if c.TraceMaxDuration <= 0 {
+		problems = append(problems, errors.New("TRACE_MAX_DURATION must be positive"))
+	}
+	if c.TraceMaxSize <= 0 {
+		problems = append(problems, errors.New("TRACE_MAX_SIZE must be positive"))
+	}
+	if c.StatsPushURL != "" {
+		if u, err := url.Parse(c.StatsPushURL); err != nil || u.Host == "" {
+			problems = append(problems, fmt.Errorf("STATS_PUSH_URL %q is not a valid URL", c.StatsPushURL))
+		}
+		if c.StatsPushJob == "" || c.StatsPushInstance == "" {
+			problems = append(problems, errors.New("STATS_PUSH_JOB and STATS_PUSH_INSTANCE must not be empty"))
+		}
+	}
+	if c.ShutdownGracePeriod <= 0 || c.ShutdownDrainDelay < 0 {
+		problems = append(problems, errors.New("SHUTDOWN_GRACE_PERIOD must be positive and SHUTDOWN_DRAIN_DELAY must not be negative"))
+	}
+	if c.ShutdownStreams != "close" && c.ShutdownStreams != "wait" {
+		problems = append(problems, fmt.Errorf("SHUTDOWN_STREAMS %q must be close or wait", c.ShutdownStreams))
+	}
+	if _, ok := c.APIKeys[DevAPIKey]; ok && !c.DevMode {
+		problems = append(problems, fmt.Errorf("API_KEYS contains the %s development key, which is only allowed with DEV_MODE", DevAPIKey))
+	}
+	subjects := map[string]bool{}
+	for _, subject := range c.APIKeys {
+		subjects[subject] = true
+	}
+	for name, lists := range map[string]map[string][]string{"API_KEY_ROLES": c.APIKeyRoles, "API_KEY_TENANTS": c.APIKeyTenants} {
+		for subject := range lists {
+			if !subjects[subject] {
+				problems = append(problems, fmt.Errorf("%s names %s, which has no key in API_KEYS", name, subject))
+			}
+		}
+	}
+	if c.ShutdownRestart != "exec" && c.ShutdownRestart != "exit" {
+		problems = append(problems, fmt.Errorf("SHUTDOWN_RESTART %q must be exec or exit", c.ShutdownRestart))
+	}
+	steps := map[string]int{}
+	for _, step := range c.ShutdownOrder {
+		steps[step]++
+	}
+	for step, n := range steps {
+		if n > 1 {
+			problems = append(problems, fmt.Errorf("SHUTDOWN_ORDER lists %s more than once", step))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// Warnings lists settings that work but are unsafe outside development
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if string(c.JWTSecret) == defaultJWTSecret {
+		warnings = append(warnings, "JWT_SECRET is not set; tokens are signed with the built-in development secret")
+	}
+	if c.DevMode {
+		warnings = append(warnings, "DEV_MODE is on; development shortcuts are enabled")
+		if len(c.APIKeys) == 0 {
+			warnings = append(warnings, "API_KEYS is not set; the gtest development key is accepted as an admin")
+		}
+	}
+	if c.SeedAPI {
+		warnings = append(warnings, "SEED_API is on; admins can fill the stores with fake data")
+	}
+	return warnings
+}
@@ -0,0 +1,77 @@
+// Package httperr renders errors as RFC 7807 problem details
+package httperr
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"exampleserver/pkg/i18n"
+	"exampleserver/pkg/requestid"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Write responds with a problem for status. Title defaults to the standard
+// status text. Detail is translated into the request's language when the
+// message catalogs have it.
+func Write(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	WriteProblem(w, r, Problem{Status: status, Detail: i18n.Translate(i18n.Locale(r), detail)})
+}
+
+// Writef responds with a problem for status whose detail is the translation
+// of format, formatted with args
+func Writef(w http.ResponseWriter, r *http.Request, status int, format string, args ...interface{}) {
+	WriteProblem(w, r, Problem{Status: status, Detail: i18n.Sprintf(i18n.Locale(r), format, args...)})
+}
+
+// WriteProblem responds with p, filling in the defaults for any fields the
+// caller left empty. The default title is translated; other fields are
+// written as given.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	lang := i18n.Locale(r)
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = i18n.Translate(lang, http.StatusText(p.Status))
+	}
+	if r != nil {
+		if p.Instance == "" {
+			p.Instance = r.URL.Path
+		}
+		if p.RequestID == "" {
+			p.RequestID = requestid.FromContext(r.Context())
+		}
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Language", lang.String())
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// NotFound is an http.Handler for unmatched routes
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Writef(w, r, http.StatusNotFound, "No route matches %s", r.URL.Path)
+}
+
+// MethodNotAllowed is an http.Handler for routes matched with the wrong method
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Writef(w, r, http.StatusMethodNotAllowed, "%s is not supported for %s", r.Method, r.URL.Path)
+}
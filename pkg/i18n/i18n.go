@@ -0,0 +1,122 @@
+// Package i18n translates user-facing messages into the language a client
+// asks for with Accept-Language. Messages are looked up by their English
+// text in catalogs embedded from locales/<tag>.json; anything missing from
+// a catalog is returned in English.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+var (
+	catalogs = map[language.Tag]map[string]string{}
+	// supported lists the available languages, English first so it wins
+	// when nothing else matches
+	supported = []language.Tag{language.English}
+	matcher   language.Matcher
+
+	mu          sync.RWMutex
+	defaultLang = language.English
+)
+
+func init() {
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".json")
+		tag := language.MustParse(name)
+		data, err := locales.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			panic(err)
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: locales/%s: %v", file.Name(), err))
+		}
+		catalogs[tag] = messages
+		supported = append(supported, tag)
+	}
+	matcher = language.NewMatcher(supported)
+}
+
+// Languages returns the languages messages can be translated into
+func Languages() []language.Tag {
+	return append([]language.Tag(nil), supported...)
+}
+
+// Match returns the supported language for a BCP 47 tag such as "de" or
+// "fr-CA", failing if there are no messages in that language
+func Match(lang string) (language.Tag, error) {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return language.Und, fmt.Errorf("invalid language %q: %w", lang, err)
+	}
+	_, index, confidence := matcher.Match(tag)
+	if confidence == language.No {
+		return language.Und, fmt.Errorf("no messages for language %q", lang)
+	}
+	return supported[index], nil
+}
+
+// SetDefault sets the language used for requests without an
+// Accept-Language header
+func SetDefault(lang string) error {
+	tag, err := Match(lang)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defaultLang = tag
+	mu.Unlock()
+	return nil
+}
+
+// Locale picks the supported language that best matches the request's
+// Accept-Language header, falling back to the default language
+func Locale(r *http.Request) language.Tag {
+	mu.RLock()
+	fallback := defaultLang
+	mu.RUnlock()
+	if r == nil {
+		return fallback
+	}
+	header := r.Header.Get("Accept-Language")
+	if header == "" {
+		return fallback
+	}
+	prefs, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(prefs) == 0 {
+		return fallback
+	}
+	_, index, confidence := matcher.Match(prefs...)
+	if confidence == language.No {
+		return fallback
+	}
+	return supported[index]
+}
+
+// Translate returns msg in lang, or msg itself when there is no translation
+func Translate(lang language.Tag, msg string) string {
+	if translated, ok := catalogs[lang][msg]; ok {
+		return translated
+	}
+	return msg
+}
+
+// Sprintf formats the translation of format in lang with args
+func Sprintf(lang language.Tag, format string, args ...interface{}) string {
+	return fmt.Sprintf(Translate(lang, format), args...)
+}
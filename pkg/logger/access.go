@@ -0,0 +1,309 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"exampleserver/pkg/requestid"
+)
+
+// accessFieldNames are the standard fields of an access log entry
+var accessFieldNames = []string{
+	"time", "method", "path", "query", "proto", "host", "status", "bytes", "duration_ms",
+	"remote_ip", "user_agent", "referer", "request_id",
+}
+
+// defaultExcludedHeaders are never logged, whatever the header settings
+var defaultExcludedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "Proxy-Authorization"}
+
+// AccessLogConfig is the access_log section of logger.yaml
+type AccessLogConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// File receives one JSON object per request, rotated like the log;
+	// stdout when empty
+	File string `yaml:"file"`
+	// Fields are the standard fields logged, all of them when empty
+	Fields []string `yaml:"fields"`
+	// RequestHeaders and ResponseHeaders name the headers logged; "*"
+	// logs all of them but those in ExcludeHeaders
+	RequestHeaders  []string `yaml:"request_headers"`
+	ResponseHeaders []string `yaml:"response_headers"`
+	// ExcludeHeaders are never logged, on top of credentials such as
+	// Authorization, Cookie and X-API-Key
+	ExcludeHeaders []string `yaml:"exclude_headers"`
+	// Claims are the claims of the caller logged, e.g. sub and roles
+	Claims []string `yaml:"claims"`
+	// Geo adds the IP version and whether the IP is private or loopback,
+	// plus the values of GeoHeaders set by a CDN or proxy
+	Geo        bool              `yaml:"geo"`
+	GeoHeaders map[string]string `yaml:"geo_headers"`
+	// TrustProxy takes remote_ip from X-Forwarded-For
+	TrustProxy bool `yaml:"trust_proxy"`
+}
+
+// AccessHook adds fields to the access log entry of a request once it has
+// been served
+type AccessHook func(r *http.Request, fields map[string]interface{})
+
+// AccessLogger writes a structured JSON entry per request, for log pipelines
+// to parse without a grok pattern
+type AccessLogger struct {
+	config   AccessLogConfig
+	fields   map[string]bool
+	excluded map[string]bool
+	claims   func(r *http.Request) map[string]interface{}
+	hooks    []AccessHook
+
+	mu     sync.Mutex
+	out    io.Writer
+	closer io.Closer
+}
+
+var access = &AccessLogger{}
+
+// Access returns the access logger configured by logger.yaml, disabled when
+// it has no access_log section
+func Access() *AccessLogger {
+	return access
+}
+
+// NewAccessLogger writes entries to file, or stdout when file is nil
+func NewAccessLogger(config AccessLogConfig, file io.WriteCloser) (*AccessLogger, error) {
+	a := &AccessLogger{config: config, fields: map[string]bool{}, excluded: map[string]bool{}, out: os.Stdout}
+	fields := config.Fields
+	if len(fields) == 0 {
+		fields = accessFieldNames
+	}
+	for _, field := range fields {
+		if !slices.Contains(accessFieldNames, field) {
+			return nil, fmt.Errorf("unknown access log field %q, use %s", field, strings.Join(accessFieldNames, ", "))
+		}
+		a.fields[field] = true
+	}
+	for _, name := range append(append([]string{}, defaultExcludedHeaders...), config.ExcludeHeaders...) {
+		a.excluded[http.CanonicalHeaderKey(name)] = true
+	}
+	if file != nil {
+		a.out, a.closer = file, file
+	}
+	return a, nil
+}
+
+// Enabled reports whether requests are logged
+func (a *AccessLogger) Enabled() bool {
+	return a.config.Enabled
+}
+
+// SetClaims sets how the claims of a request's caller are found, for the
+// claims named in the configuration
+func (a *AccessLogger) SetClaims(claims func(r *http.Request) map[string]interface{}) {
+	a.claims = claims
+}
+
+// AddHook adds fields to every entry. Hooks must be added before the
+// server starts.
+func (a *AccessLogger) AddHook(hook AccessHook) {
+	a.hooks = append(a.hooks, hook)
+}
+
+// Close closes the access log file
+func (a *AccessLogger) Close() error {
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+	return nil
+}
+
+type accessFieldsKey struct{}
+
+// AddAccessFields adds fields to the access log entry of the request ctx
+// belongs to, for handlers to record what they did, e.g. the ID of the
+// customer created. It does nothing outside a logged request.
+func AddAccessFields(ctx context.Context, fields map[string]interface{}) {
+	if extra, ok := ctx.Value(accessFieldsKey{}).(*accessFields); ok {
+		extra.mu.Lock()
+		for key, value := range fields {
+			extra.fields[key] = value
+		}
+		extra.mu.Unlock()
+	}
+}
+
+type accessFields struct {
+	mu     sync.Mutex
+	fields map[string]interface{}
+}
+
+// Middleware writes an entry for every request once it has been served
+func (a *AccessLogger) Middleware(next http.Handler) http.Handler {
+	if !a.config.Enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		extra := &accessFields{fields: map[string]interface{}{}}
+		rec := &accessRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessFieldsKey{}, extra)))
+
+		entry := a.entry(r, rec, start)
+		for _, hook := range a.hooks {
+			hook(r, entry)
+		}
+		extra.mu.Lock()
+		for key, value := range extra.fields {
+			entry[key] = value
+		}
+		extra.mu.Unlock()
+
+		line, err := json.Marshal(entry)
+		if err != nil {
+			Ctx(r.Context()).Error("Failed to encode access log entry: %v", err)
+			return
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.out.Write(append(line, '\n'))
+	})
+}
+
+// entry holds the configured fields of a served request
+func (a *AccessLogger) entry(r *http.Request, rec *accessRecorder, start time.Time) map[string]interface{} {
+	ip := clientIP(r, a.config.TrustProxy)
+	standard := map[string]interface{}{
+		"time":        start.UTC().Format(time.RFC3339Nano),
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"query":       r.URL.RawQuery,
+		"proto":       r.Proto,
+		"host":        r.Host,
+		"status":      rec.status,
+		"bytes":       rec.bytes,
+		"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+		"remote_ip":   ip,
+		"user_agent":  r.UserAgent(),
+		"referer":     r.Referer(),
+		"request_id":  requestid.FromContext(r.Context()),
+	}
+	entry := make(map[string]interface{}, len(a.fields))
+	for field := range a.fields {
+		if value, ok := standard[field]; ok {
+			entry[field] = value
+		}
+	}
+
+	if headers := a.headers(r.Header, a.config.RequestHeaders); len(headers) > 0 {
+		entry["request_headers"] = headers
+	}
+	if headers := a.headers(rec.Header(), a.config.ResponseHeaders); len(headers) > 0 {
+		entry["response_headers"] = headers
+	}
+	if len(a.config.Claims) > 0 && a.claims != nil {
+		if claims := a.claims(r); claims != nil {
+			logged := map[string]interface{}{}
+			for _, name := range a.config.Claims {
+				if value, ok := claims[name]; ok {
+					logged[name] = value
+				}
+			}
+			entry["claims"] = logged
+		}
+	}
+	if a.config.Geo {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			version := 6
+			if parsed.To4() != nil {
+				version = 4
+			}
+			entry["ip"] = map[string]interface{}{
+				"version":  version,
+				"private":  parsed.IsPrivate(),
+				"loopback": parsed.IsLoopback(),
+			}
+		}
+		geo := map[string]string{}
+		for field, header := range a.config.GeoHeaders {
+			if value := r.Header.Get(header); value != "" {
+				geo[field] = value
+			}
+		}
+		if len(geo) > 0 {
+			entry["geo"] = geo
+		}
+	}
+	return entry
+}
+
+// headers picks the named headers, or all of them for "*", leaving out the
+// excluded ones
+func (a *AccessLogger) headers(header http.Header, names []string) map[string]string {
+	picked := map[string]string{}
+	for _, name := range names {
+		if name == "*" {
+			for key, values := range header {
+				if !a.excluded[key] {
+					picked[key] = strings.Join(values, ", ")
+				}
+			}
+			continue
+		}
+		key := http.CanonicalHeaderKey(name)
+		if values := header.Values(key); len(values) > 0 && !a.excluded[key] {
+			picked[key] = strings.Join(values, ", ")
+		}
+	}
+	return picked
+}
+
+// clientIP is the caller's address, or the first hop of X-Forwarded-For
+// when the proxy in front of the server is trusted to set it
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// accessRecorder captures the status and size of a response
+type accessRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *accessRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *accessRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+func (r *accessRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *accessRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,161 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Backend names for LogConfig.Backend
+const (
+	BackendText    = "text"
+	BackendZap     = "zap"
+	BackendZerolog = "zerolog"
+)
+
+// Backend writes entries to the log file and stdout. Plugins and the HTTP
+// endpoints work the same whichever backend is used.
+type Backend interface {
+	Write(entry LogEntry) error
+	// Sync flushes anything the backend buffers
+	Sync() error
+}
+
+// NewBackend returns the named backend writing to w. The text backend,
+// also used when name is empty, writes "2006/01/02 15:04:05 [LEVEL] message
+// key=value" lines; zap and zerolog write one JSON object per line with the
+// keys time, level, message, source and line followed by the entry's fields,
+// those named like one of these keys prefixed with "fields.".
+func NewBackend(name string, w io.Writer) (Backend, error) {
+	switch name {
+	case "", BackendText:
+		return &textBackend{logger: log.New(w, "", log.LstdFlags)}, nil
+	case BackendZap:
+		return newZapBackend(w), nil
+	case BackendZerolog:
+		return &zerologBackend{logger: zerolog.New(zerolog.SyncWriter(w))}, nil
+	default:
+		return nil, fmt.Errorf("unknown log backend %q, use text, zap or zerolog", name)
+	}
+}
+
+// textBackend writes lines with the standard library's log package
+type textBackend struct {
+	logger *log.Logger
+}
+
+func (t *textBackend) Write(entry LogEntry) error {
+	if entry.Source != "" {
+		t.logger.Printf("[%s] %s:%d: %s%s", entry.Level, entry.Source, entry.Line, entry.Message, formatFields(entry.Fields))
+	} else {
+		t.logger.Printf("[%s] %s%s", entry.Level, entry.Message, formatFields(entry.Fields))
+	}
+	return nil
+}
+
+func (t *textBackend) Sync() error {
+	return nil
+}
+
+// zapLevel maps this package's levels to zap's. Entries are written to the
+// core directly, so FATAL doesn't make zap exit.
+var zapLevel = map[string]zapcore.Level{
+	"DEBUG": zapcore.DebugLevel,
+	"INFO":  zapcore.InfoLevel,
+	"WARN":  zapcore.WarnLevel,
+	"ERROR": zapcore.ErrorLevel,
+	"FATAL": zapcore.FatalLevel,
+}
+
+type zapBackend struct {
+	core zapcore.Core
+}
+
+func newZapBackend(w io.Writer) *zapBackend {
+	encoder := zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+		TimeKey:     "time",
+		LevelKey:    "level",
+		MessageKey:  "message",
+		LineEnding:  zapcore.DefaultLineEnding,
+		EncodeTime:  zapcore.RFC3339NanoTimeEncoder,
+		EncodeLevel: zapcore.CapitalLevelEncoder,
+	})
+	return &zapBackend{core: zapcore.NewCore(encoder, zapcore.Lock(zapcore.AddSync(w)), zapcore.DebugLevel)}
+}
+
+func (z *zapBackend) Write(entry LogEntry) error {
+	fields := make([]zapcore.Field, 0, len(entry.Fields)+2)
+	if entry.Source != "" {
+		fields = append(fields, zap.String("source", entry.Source), zap.Int("line", entry.Line))
+	}
+	for _, key := range sortedKeys(entry.Fields) {
+		fields = append(fields, zap.Any(jsonFieldKey(key), entry.Fields[key]))
+	}
+	return z.core.Write(zapcore.Entry{
+		Level:   zapLevel[entry.Level],
+		Time:    entry.Timestamp,
+		Message: entry.Message,
+	}, fields)
+}
+
+func (z *zapBackend) Sync() error {
+	return z.core.Sync()
+}
+
+type zerologBackend struct {
+	logger zerolog.Logger
+}
+
+func (z *zerologBackend) Write(entry LogEntry) error {
+	event := z.logger.Log().
+		Str("time", entry.Timestamp.Format(time.RFC3339Nano)).
+		Str("level", entry.Level)
+	if entry.Source != "" {
+		event = event.Str("source", entry.Source).Int("line", entry.Line)
+	}
+	fields := make(map[string]interface{}, len(entry.Fields))
+	for key, value := range entry.Fields {
+		fields[jsonFieldKey(key)] = value
+	}
+	event.Fields(fields).Msg(entry.Message)
+	return nil
+}
+
+func (z *zerologBackend) Sync() error {
+	return nil
+}
+
+// jsonKeys are the keys the zap and zerolog backends write an entry's own
+// values under
+var jsonKeys = []string{"time", "level", "message", "source", "line"}
+
+// jsonFieldPrefix prefixes the fields named like one of the jsonKeys, and
+// those already carrying the prefix, so a field can't replace or duplicate
+// the entry's own values. The native JSON of an entry nests all fields
+// under "fields" instead.
+const jsonFieldPrefix = "fields."
+
+// jsonFieldKey is the key the zap and zerolog backends write a field under
+func jsonFieldKey(key string) string {
+	if slices.Contains(jsonKeys, key) || strings.HasPrefix(key, jsonFieldPrefix) {
+		return jsonFieldPrefix + key
+	}
+	return key
+}
+
+func sortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,226 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	batchMinBackoff   = 500 * time.Millisecond
+	batchMaxBackoff   = 30 * time.Second
+	batchFlushOnClose = 5 * time.Second
+	// batchHighPriorityWait is how long a high-priority entry waits for
+	// room in a full queue
+	batchHighPriorityWait = time.Second
+)
+
+// sendFunc delivers a batch once. A failure worth retrying returns the delay
+// the receiver asked for, or zero; one that isn't returns a negative delay.
+type sendFunc func(ctx context.Context, batch []LogEntry) (retryAfter time.Duration, err error)
+
+// batcher queues entries for a plugin that ships them elsewhere and sends
+// them in batches from a background goroutine, so a slow or unavailable
+// receiver never blocks logging: when the queue is full new entries are
+// dropped and counted. Failed batches are retried with exponential backoff.
+type batcher struct {
+	name    string
+	size    int
+	wait    time.Duration
+	retries int
+	send    sendFunc
+	entries chan LogEntry
+	metrics pluginStats
+	cancel  context.CancelFunc
+	done    chan struct{}
+	once    sync.Once
+}
+
+// newBatcher sends batches of up to size entries at least every wait,
+// queueing up to buffer entries and retrying a failed batch retries times.
+// Zero values get defaults of 500 entries, one second, 10000 entries and
+// five retries.
+func newBatcher(name string, size int, wait time.Duration, buffer, retries int, send sendFunc) *batcher {
+	if size <= 0 {
+		size = 500
+	}
+	if wait <= 0 {
+		wait = time.Second
+	}
+	if buffer <= 0 {
+		buffer = 10000
+	}
+	if retries <= 0 {
+		retries = 5
+	}
+	return &batcher{
+		name:    name,
+		size:    size,
+		wait:    wait,
+		retries: retries,
+		send:    send,
+		entries: make(chan LogEntry, buffer),
+	}
+}
+
+func (b *batcher) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	b.done = make(chan struct{})
+	go b.run(ctx)
+}
+
+// enqueue queues the entry, dropping it when the queue is full, after up to
+// batchHighPriorityWait for a high-priority entry. Only the first drop is
+// reported so a backlog doesn't flood the log.
+func (b *batcher) enqueue(entry LogEntry) error {
+	b.metrics.handled.Add(1)
+	select {
+	case b.entries <- entry:
+		return nil
+	default:
+	}
+	if entry.Priority == PriorityHigh {
+		select {
+		case b.entries <- entry:
+			return nil
+		case <-time.After(batchHighPriorityWait):
+		}
+	}
+	if b.metrics.dropped.Add(1) == 1 {
+		return fmt.Errorf("%s queue full, dropping entries", b.name)
+	}
+	return nil
+}
+
+// Dropped returns the number of entries lost because the queue was full or
+// their batch could not be delivered
+func (b *batcher) Dropped() uint64 {
+	return b.metrics.dropped.Load() + b.metrics.failed.Load()
+}
+
+func (b *batcher) pluginName() string {
+	return b.name
+}
+
+func (b *batcher) stats() *pluginStats {
+	return &b.metrics
+}
+
+// timedSend sends a batch once, recording the attempt
+func (b *batcher) timedSend(ctx context.Context, batch []LogEntry) (time.Duration, error) {
+	start := time.Now()
+	retryAfter, err := b.send(ctx, batch)
+	b.metrics.send(len(batch), time.Since(start), err)
+	return retryAfter, err
+}
+
+// close sends what is still queued, waiting up to five seconds
+func (b *batcher) close() {
+	b.once.Do(func() {
+		if b.cancel == nil {
+			return
+		}
+		b.cancel()
+		<-b.done
+	})
+}
+
+// run collects queued entries into batches, sending each when it is full or
+// has waited long enough
+func (b *batcher) run(ctx context.Context) {
+	defer close(b.done)
+
+	batch := make([]LogEntry, 0, b.size)
+	ticker := time.NewTicker(b.wait)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry := <-b.entries:
+			batch = append(batch, entry)
+			if len(batch) >= b.size {
+				b.deliver(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				b.deliver(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ctx.Done():
+			b.drain(batch)
+			return
+		}
+	}
+}
+
+// drain sends the current batch and everything still queued once, without
+// retrying
+func (b *batcher) drain(batch []LogEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), batchFlushOnClose)
+	defer cancel()
+	for {
+		select {
+		case entry := <-b.entries:
+			batch = append(batch, entry)
+			if len(batch) < b.size {
+				continue
+			}
+		default:
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if _, err := b.timedSend(ctx, batch); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: dropping %d entries on close: %v\n", b.name, len(batch), err)
+			b.metrics.failed.Add(uint64(len(batch)))
+		}
+		batch = batch[:0]
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// deliver sends a batch, retrying with backoff until it is accepted, the
+// receiver rejects it outright or the retries run out
+func (b *batcher) deliver(ctx context.Context, batch []LogEntry) {
+	backoff := batchMinBackoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := b.timedSend(ctx, batch)
+		if err == nil {
+			return
+		}
+		if retryAfter < 0 || attempt >= b.retries {
+			fmt.Fprintf(os.Stderr, "%s: dropping %d entries: %v\n", b.name, len(batch), err)
+			b.metrics.failed.Add(uint64(len(batch)))
+			return
+		}
+		b.metrics.retried.Add(uint64(len(batch)))
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			// Closing: make one last attempt with whatever is queued
+			b.drain(batch)
+			return
+		}
+		backoff = min(backoff*2, batchMaxBackoff)
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds
+func retryAfter(header string) time.Duration {
+	var seconds int
+	if _, err := fmt.Sscanf(header, "%d", &seconds); err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,266 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultBodyMaxBytes = 4096
+	maxBodyMaxBytes     = 1 << 20
+)
+
+// defaultRedactFields are always redacted from logged bodies
+var defaultRedactFields = []string{
+	"password", "new_password", "current_password", "token", "device_token", "access_token",
+	"refresh_token", "client_secret", "secret", "api_key",
+}
+
+// BodyLoggingConfig is the body_logging section of logger.yaml
+type BodyLoggingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SampleRate is the fraction of matching requests logged, 1 when unset
+	SampleRate float64 `yaml:"sample_rate"`
+	// MaxBytes caps each logged body, 4096 when unset
+	MaxBytes int `yaml:"max_bytes"`
+	// Routes are the path prefixes logged; every route when empty
+	Routes []string `yaml:"routes"`
+	// RedactFields are JSON and form fields whose values are replaced, on
+	// top of password, token, secret and similar fields
+	RedactFields []string `yaml:"redact_fields"`
+	// RedactPatterns are regular expressions replaced wherever they match
+	RedactPatterns []string `yaml:"redact_patterns"`
+}
+
+// BodyLoggingSettings are the settings of body logging that can be changed
+// at runtime
+type BodyLoggingSettings struct {
+	Enabled    bool     `json:"enabled"`
+	SampleRate float64  `json:"sample_rate"`
+	MaxBytes   int      `json:"max_bytes"`
+	Routes     []string `json:"routes"`
+}
+
+// BodyLoggingUpdate changes the settings that are set
+type BodyLoggingUpdate struct {
+	Enabled    *bool     `json:"enabled,omitempty"`
+	SampleRate *float64  `json:"sample_rate,omitempty"`
+	MaxBytes   *int      `json:"max_bytes,omitempty"`
+	Routes     *[]string `json:"routes,omitempty"`
+}
+
+// BodyLogger logs the request and response bodies of a sample of requests
+// for diagnosing misbehaving clients, with secrets redacted
+type BodyLogger struct {
+	mu       sync.RWMutex
+	settings BodyLoggingSettings
+	redact   []*regexp.Regexp
+	replace  []string
+}
+
+var bodies = &BodyLogger{settings: BodyLoggingSettings{SampleRate: 1, MaxBytes: defaultBodyMaxBytes, Routes: []string{}}}
+
+// Bodies returns the body logger configured by logger.yaml, disabled when
+// it has no body_logging section
+func Bodies() *BodyLogger {
+	return bodies
+}
+
+// NewBodyLogger compiles the redaction rules of config
+func NewBodyLogger(config BodyLoggingConfig) (*BodyLogger, error) {
+	b := &BodyLogger{settings: BodyLoggingSettings{
+		Enabled:    config.Enabled,
+		SampleRate: config.SampleRate,
+		MaxBytes:   config.MaxBytes,
+		Routes:     append([]string{}, config.Routes...),
+	}}
+	if b.settings.SampleRate == 0 {
+		b.settings.SampleRate = 1
+	}
+	if b.settings.MaxBytes == 0 {
+		b.settings.MaxBytes = defaultBodyMaxBytes
+	}
+	if err := b.settings.validate(); err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(defaultRedactFields)+len(config.RedactFields))
+	for _, field := range append(append([]string{}, defaultRedactFields...), config.RedactFields...) {
+		fields = append(fields, regexp.QuoteMeta(field))
+	}
+	names := strings.Join(fields, "|")
+	b.redact = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)("(?:` + names + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`),
+		regexp.MustCompile(`(?i)((?:^|&)(?:` + names + `)=)[^&]*`),
+	}
+	b.replace = []string{`${1}"` + Redacted + `"`, "${1}" + Redacted}
+	for _, pattern := range config.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("body_logging redact pattern %q: %w", pattern, err)
+		}
+		b.redact = append(b.redact, re)
+		b.replace = append(b.replace, Redacted)
+	}
+	return b, nil
+}
+
+func (s BodyLoggingSettings) validate() error {
+	if s.SampleRate <= 0 || s.SampleRate > 1 {
+		return fmt.Errorf("sample_rate must be above 0 and at most 1")
+	}
+	if s.MaxBytes < 1 || s.MaxBytes > maxBodyMaxBytes {
+		return fmt.Errorf("max_bytes must be between 1 and %d", maxBodyMaxBytes)
+	}
+	return nil
+}
+
+// Settings returns the current settings
+func (b *BodyLogger) Settings() BodyLoggingSettings {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	settings := b.settings
+	settings.Routes = append([]string{}, b.settings.Routes...)
+	return settings
+}
+
+// Update applies update, leaving the settings unchanged when the result is
+// invalid
+func (b *BodyLogger) Update(update BodyLoggingUpdate) (BodyLoggingSettings, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	settings := b.settings
+	if update.Enabled != nil {
+		settings.Enabled = *update.Enabled
+	}
+	if update.SampleRate != nil {
+		settings.SampleRate = *update.SampleRate
+	}
+	if update.MaxBytes != nil {
+		settings.MaxBytes = *update.MaxBytes
+	}
+	if update.Routes != nil {
+		settings.Routes = append([]string{}, *update.Routes...)
+	}
+	if err := settings.validate(); err != nil {
+		return b.settings, err
+	}
+	b.settings = settings
+	return settings, nil
+}
+
+// Middleware logs the bodies of the sampled requests to the selected
+// routes. Only the part of the request body the handler reads is logged.
+func (b *BodyLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings, ok := b.sample(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		request := &bodyCapture{max: settings.MaxBytes}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, request), r.Body}
+		rec := &bodyRecorder{ResponseWriter: w, status: http.StatusOK, body: bodyCapture{max: settings.MaxBytes}}
+		next.ServeHTTP(rec, r)
+
+		Ctx(r.Context()).Info("HTTP bodies of %s %s %d: request=%q response=%q", r.Method, r.URL.Path, rec.status,
+			b.body(request, r.Header.Get("Content-Type")), b.body(&rec.body, rec.Header().Get("Content-Type")))
+	})
+}
+
+// sample returns the settings when r should be logged
+func (b *BodyLogger) sample(r *http.Request) (BodyLoggingSettings, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.settings.Enabled || rand.Float64() >= b.settings.SampleRate {
+		return BodyLoggingSettings{}, false
+	}
+	if len(b.settings.Routes) == 0 {
+		return b.settings, true
+	}
+	for _, prefix := range b.settings.Routes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return b.settings, true
+		}
+	}
+	return BodyLoggingSettings{}, false
+}
+
+// body is the redacted text of a captured body. Bodies that aren't text
+// are described by their size and type.
+func (b *BodyLogger) body(c *bodyCapture, contentType string) string {
+	if c.total == 0 {
+		return ""
+	}
+	if !textual(contentType) {
+		return fmt.Sprintf("[%d bytes of %s]", c.total, contentType)
+	}
+	text := c.buf.String()
+	for i, re := range b.redact {
+		text = re.ReplaceAllString(text, b.replace[i])
+	}
+	if more := c.total - c.buf.Len(); more > 0 {
+		text += fmt.Sprintf("...(%d more bytes)", more)
+	}
+	return text
+}
+
+func textual(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return contentType == "" || strings.HasPrefix(contentType, "text/") || strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml") || strings.Contains(contentType, "x-www-form-urlencoded")
+}
+
+// bodyCapture keeps the first max bytes written to it and counts the rest
+type bodyCapture struct {
+	buf   bytes.Buffer
+	max   int
+	total int
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	c.total += len(p)
+	if room := c.max - c.buf.Len(); room > 0 {
+		c.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// bodyRecorder captures the status and body written by a handler
+type bodyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bodyCapture
+}
+
+func (r *bodyRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *bodyRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *bodyRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *bodyRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
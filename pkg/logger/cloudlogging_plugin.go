@@ -0,0 +1,255 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// CloudLoggingConfig configures the Google Cloud Logging plugin in
+// logger.yaml. Credentials come from CredentialsFile when set, otherwise
+// from Application Default Credentials: GOOGLE_APPLICATION_CREDENTIALS, the
+// gcloud user credentials, or the metadata server on Google Cloud.
+type CloudLoggingConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	ProjectID       string `yaml:"project_id"`       // defaults to the credentials' or metadata server's project
+	LogID           string `yaml:"log_id"`           // default exampleserver
+	CredentialsFile string `yaml:"credentials_file"` // service account key file
+	// Resource overrides the detected monitored resource
+	Resource   *CloudLoggingResource `yaml:"resource"`
+	Labels     map[string]string     `yaml:"labels"` // attached to every entry
+	BatchSize  int                   `yaml:"batch_size"`
+	BatchWait  time.Duration         `yaml:"batch_wait"`
+	BufferSize int                   `yaml:"buffer_size"`
+	MaxRetries int                   `yaml:"max_retries"`
+	Filter     LogFilter             `yaml:"filter"`
+	// LevelMap overrides the severity of levels, e.g. WARN: NOTICE
+	LevelMap LevelMap `yaml:"level_map"`
+	// Delivery sets ordering and rate limiting
+	Delivery `yaml:",inline"`
+}
+
+// CloudLoggingResource is the monitored resource entries are attributed to
+type CloudLoggingResource struct {
+	Type   string            `yaml:"type" json:"type"`
+	Labels map[string]string `yaml:"labels" json:"labels,omitempty"`
+}
+
+const (
+	cloudLoggingWriteURL = "https://logging.googleapis.com/v2/entries:write"
+	cloudLoggingScope    = "https://www.googleapis.com/auth/logging.write"
+	cloudLoggingTimeout  = 10 * time.Second
+)
+
+// cloudLoggingSeverity maps this package's levels to Cloud Logging severities
+var cloudLoggingSeverity = map[string]string{
+	"DEBUG": "DEBUG",
+	"INFO":  "INFO",
+	"WARN":  "WARNING",
+	"ERROR": "ERROR",
+	"FATAL": "CRITICAL",
+}
+
+// cloudLoggingSeverities are the severities Cloud Logging accepts
+var cloudLoggingSeverities = []string{"DEFAULT", "DEBUG", "INFO", "NOTICE", "WARNING", "ERROR", "CRITICAL", "ALERT", "EMERGENCY"}
+
+// CloudLoggingPlugin writes log entries to Google Cloud Logging in batches,
+// see batcher. Entries carry their message and fields as a JSON payload and
+// are attributed to the GKE container or GCE instance the server runs on.
+type CloudLoggingPlugin struct {
+	config   CloudLoggingConfig
+	client   *http.Client
+	logName  string
+	resource CloudLoggingResource
+	*batcher
+}
+
+func NewCloudLoggingPlugin(config CloudLoggingConfig) *CloudLoggingPlugin {
+	if config.LogID == "" {
+		config.LogID = "exampleserver"
+	}
+	c := &CloudLoggingPlugin{config: config}
+	c.batcher = newBatcher("cloud logging", config.BatchSize, config.BatchWait, config.BufferSize, config.MaxRetries, c.send)
+	return c
+}
+
+// Initialize finds credentials, the project and the monitored resource
+func (c *CloudLoggingPlugin) Initialize() error {
+	if err := c.config.LevelMap.validate("cloud logging", cloudLoggingSeverities...); err != nil {
+		return err
+	}
+	if err := c.config.Filter.Compile(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cloudLoggingTimeout)
+	defer cancel()
+
+	var creds *google.Credentials
+	var err error
+	if c.config.CredentialsFile != "" {
+		var data []byte
+		if data, err = os.ReadFile(c.config.CredentialsFile); err != nil {
+			return fmt.Errorf("reading cloud logging credentials: %w", err)
+		}
+		creds, err = google.CredentialsFromJSON(ctx, data, cloudLoggingScope)
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, cloudLoggingScope)
+	}
+	if err != nil {
+		return fmt.Errorf("finding cloud logging credentials: %w", err)
+	}
+
+	project := c.config.ProjectID
+	if project == "" {
+		project = creds.ProjectID
+	}
+	if project == "" && metadata.OnGCE() {
+		project, _ = metadata.ProjectID()
+	}
+	if project == "" {
+		return fmt.Errorf("cloud logging project_id is required when it can't be detected")
+	}
+	if c.config.Resource != nil {
+		c.resource = *c.config.Resource
+	} else {
+		c.resource = detectResource(project)
+	}
+
+	// The token source refreshes on its own schedule, so it must not be tied
+	// to the initialization deadline
+	client := oauth2.NewClient(context.Background(), creds.TokenSource)
+	client.Timeout = cloudLoggingTimeout
+	c.client = client
+	c.logName = "projects/" + project + "/logs/" + c.config.LogID
+	c.start()
+	return nil
+}
+
+// Close writes what is still queued, waiting up to five seconds
+func (c *CloudLoggingPlugin) Close() error {
+	c.close()
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (c *CloudLoggingPlugin) ShouldHandle(entry LogEntry) bool {
+	return c.config.Filter.Matches(entry)
+}
+
+// Handle queues the entry, dropping it when the queue is full
+func (c *CloudLoggingPlugin) Handle(entry LogEntry) error {
+	return c.enqueue(entry)
+}
+
+// cloudLoggingEntry is a LogEntry in the entries.write request
+type cloudLoggingEntry struct {
+	Timestamp      string                 `json:"timestamp"`
+	Severity       string                 `json:"severity"`
+	JSONPayload    map[string]interface{} `json:"jsonPayload"`
+	SourceLocation *sourceLocation        `json:"sourceLocation,omitempty"`
+}
+
+type sourceLocation struct {
+	File string `json:"file"`
+	Line string `json:"line"`
+}
+
+// send writes a batch once, see sendFunc. Entries Cloud Logging rejects
+// individually are dropped without failing the rest of the batch.
+func (c *CloudLoggingPlugin) send(ctx context.Context, batch []LogEntry) (time.Duration, error) {
+	entries := make([]cloudLoggingEntry, len(batch))
+	for i, entry := range batch {
+		payload := make(map[string]interface{}, len(entry.Fields)+1)
+		for key, value := range entry.Fields {
+			payload[key] = value
+		}
+		payload["message"] = entry.Message
+
+		entries[i] = cloudLoggingEntry{
+			Timestamp:   entry.Timestamp.UTC().Format(time.RFC3339Nano),
+			Severity:    c.config.LevelMap.severity(entry.Level, cloudLoggingSeverity, "DEFAULT"),
+			JSONPayload: payload,
+		}
+		if entry.Source != "" {
+			entries[i].SourceLocation = &sourceLocation{File: entry.Source, Line: strconv.Itoa(entry.Line)}
+		}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"logName":        c.logName,
+		"resource":       c.resource,
+		"labels":         c.config.Labels,
+		"entries":        entries,
+		"partialSuccess": true,
+	})
+	if err != nil {
+		return -1, fmt.Errorf("encoding entries: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cloudLoggingWriteURL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return retryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("write failed with status %d", resp.StatusCode)
+	default:
+		return -1, fmt.Errorf("write rejected with status %d", resp.StatusCode)
+	}
+}
+
+// detectResource describes where the server runs: a GKE container, a GCE
+// instance, or the global resource elsewhere
+func detectResource(project string) CloudLoggingResource {
+	if !metadata.OnGCE() {
+		return CloudLoggingResource{Type: "global", Labels: map[string]string{"project_id": project}}
+	}
+
+	if cluster, _ := metadata.InstanceAttributeValue("cluster-name"); cluster != "" {
+		location, _ := metadata.InstanceAttributeValue("cluster-location")
+		namespace := os.Getenv("NAMESPACE")
+		if data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+			namespace = strings.TrimSpace(string(data))
+		}
+		pod, _ := os.Hostname()
+		return CloudLoggingResource{Type: "k8s_container", Labels: map[string]string{
+			"project_id":     project,
+			"location":       strings.TrimSpace(location),
+			"cluster_name":   strings.TrimSpace(cluster),
+			"namespace_name": namespace,
+			"pod_name":       pod,
+			"container_name": os.Getenv("CONTAINER_NAME"),
+		}}
+	}
+
+	instance, _ := metadata.InstanceID()
+	zone, _ := metadata.Zone()
+	return CloudLoggingResource{Type: "gce_instance", Labels: map[string]string{
+		"project_id":  project,
+		"instance_id": instance,
+		"zone":        zone,
+	}}
+}
@@ -2,9 +2,11 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
+	"gopkg.in/natefinch/lumberjack.v2"
 	"gopkg.in/yaml.v3"
 )
 
@@ -12,19 +14,55 @@ type LogConfig struct {
 	LogFile     string `yaml:"log_file"`
 	LogToStdout bool   `yaml:"log_to_stdout"`
 	Debug       bool   `yaml:"debug"`
-	Rotation    struct {
+	// Backend writes the log file and stdout: text (default), zap or zerolog
+	Backend  string `yaml:"backend"`
+	Rotation struct {
 		MaxSize    int  `yaml:"max_size"`    // maximum size in megabytes before rotating
 		MaxAge     int  `yaml:"max_age"`     // maximum number of days to retain old log files
 		MaxBackups int  `yaml:"max_backups"` // maximum number of old log files to retain
 		Compress   bool `yaml:"compress"`    // compress rotated files
 	} `yaml:"rotation"`
 	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Loki     *LokiConfig     `yaml:"loki"`
+	// CloudLogging ships entries to Google Cloud Logging
+	CloudLogging *CloudLoggingConfig `yaml:"cloud_logging"`
+	// Sentry reports errors to Sentry
+	Sentry *SentryConfig `yaml:"sentry"`
+	// Encryption encrypts the log file at rest
+	Encryption *EncryptionConfig `yaml:"encryption"`
+	// BodyLogging logs a sample of request and response bodies, see
+	// BodyLogger
+	BodyLogging *BodyLoggingConfig `yaml:"body_logging"`
+	// AccessLog writes a JSON entry per request, see AccessLogger
+	AccessLog *AccessLogConfig `yaml:"access_log"`
+	// CrashReports configures the reports of recovered panics, see
+	// PanicFields
+	CrashReports *CrashReportConfig `yaml:"crash_reports"`
+}
+
+// Delivery configures how entries are handed to a plugin. Every plugin's
+// section in logger.yaml takes these settings.
+type Delivery struct {
+	// StrictOrdering hands entries to the plugin one at a time in the order
+	// they were logged, see Ordered
+	StrictOrdering bool `yaml:"strict_ordering"`
+	// MaxEventsPerSecond limits the entries handed to the plugin, allowing
+	// bursts of Burst, see RateLimited. Zero is unlimited.
+	MaxEventsPerSecond float64 `yaml:"max_events_per_second"`
+	Burst              int     `yaml:"burst"`
 }
 
 type WebhookConfig struct {
+	// Name names the webhook in its metrics, by default the URL's host; two
+	// webhooks to the same host need one
+	Name   string    `yaml:"name"`
 	URL    string    `yaml:"url"`
 	APIKey string    `yaml:"api_key"`
 	Filter LogFilter `yaml:"filter"`
+	// LevelMap replaces the level of the entries posted
+	LevelMap LevelMap `yaml:"level_map"`
+	// Delivery sets ordering and rate limiting
+	Delivery `yaml:",inline"`
 }
 
 // DefaultConfig returns the default logging configuration
@@ -99,10 +137,75 @@ func Initialize(configPath string) error {
 				webhookConfig.APIKey,
 				webhookConfig.Filter,
 			)
-			if err = defaultLogger.AddPlugin(webhook); err != nil {
+			webhook.Name = webhookConfig.Name
+			webhook.LevelMap = webhookConfig.LevelMap
+			if err = defaultLogger.AddPlugin(webhookConfig.Delivery.wrap(webhook)); err != nil {
 				defaultLogger.Error("Failed to initialize webhook plugin: %v", err)
 			}
 		}
+
+		// Push to Loki if configured
+		if config.Loki != nil && config.Loki.URL != "" {
+			if err = defaultLogger.AddPlugin(config.Loki.Delivery.wrap(NewLokiPlugin(*config.Loki))); err != nil {
+				defaultLogger.Error("Failed to initialize Loki plugin: %v", err)
+			}
+		}
+
+		// Write to Google Cloud Logging if enabled
+		if config.CloudLogging != nil && config.CloudLogging.Enabled {
+			if err = defaultLogger.AddPlugin(config.CloudLogging.Delivery.wrap(NewCloudLoggingPlugin(*config.CloudLogging))); err != nil {
+				defaultLogger.Error("Failed to initialize Cloud Logging plugin: %v", err)
+			}
+		}
+
+		// Report errors to Sentry if configured
+		if config.Sentry != nil && config.Sentry.DSN != "" {
+			if err = defaultLogger.AddPlugin(config.Sentry.Delivery.wrap(NewSentryPlugin(*config.Sentry))); err != nil {
+				defaultLogger.Error("Failed to initialize Sentry plugin: %v", err)
+			}
+		}
+
+		// Access log entries go to their own file, rotated like the log
+		if config.AccessLog != nil && config.AccessLog.Enabled {
+			var file io.WriteCloser
+			if config.AccessLog.File != "" {
+				file = &lumberjack.Logger{
+					Filename:   config.AccessLog.File,
+					MaxSize:    config.Rotation.MaxSize,
+					MaxAge:     config.Rotation.MaxAge,
+					MaxBackups: config.Rotation.MaxBackups,
+					Compress:   config.Rotation.Compress,
+				}
+			}
+			var a *AccessLogger
+			if a, err = NewAccessLogger(*config.AccessLog, file); err != nil {
+				defaultLogger.Error("Failed to initialize access log: %v", err)
+			} else {
+				access = a
+			}
+		}
+
+		// Body logging starts as configured and can be changed at runtime
+		if config.BodyLogging != nil {
+			var b *BodyLogger
+			if b, err = NewBodyLogger(*config.BodyLogging); err != nil {
+				defaultLogger.Error("Failed to initialize body logging: %v", err)
+			} else {
+				bodies = b
+			}
+		}
 	})
 	return err
 }
+
+// wrap applies the delivery settings to plugin. The rate limit applies in
+// the order entries are delivered when strict ordering is on too.
+func (d Delivery) wrap(plugin LogPlugin) LogPlugin {
+	if d.MaxEventsPerSecond > 0 {
+		plugin = RateLimited(plugin, d.MaxEventsPerSecond, d.Burst)
+	}
+	if d.StrictOrdering {
+		plugin = Ordered(plugin)
+	}
+	return plugin
+}
@@ -0,0 +1,40 @@
+package logger
+
+import "context"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l, typically a logger with the
+// fields of a request such as its ID
+func NewContext(ctx context.Context, l LoggerInterface) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// Ctx returns the logger carried by ctx, or the default logger when it has
+// none
+func Ctx(ctx context.Context) LoggerInterface {
+	if l, ok := ctx.Value(contextKey{}).(LoggerInterface); ok {
+		return l
+	}
+	return Default()
+}
+
+// DebugCtx logs a debug message with the logger carried by ctx
+func DebugCtx(ctx context.Context, format string, args ...interface{}) {
+	Ctx(ctx).Debug(format, args...)
+}
+
+// InfoCtx logs an info message with the logger carried by ctx
+func InfoCtx(ctx context.Context, format string, args ...interface{}) {
+	Ctx(ctx).Info(format, args...)
+}
+
+// WarnCtx logs a warning message with the logger carried by ctx
+func WarnCtx(ctx context.Context, format string, args ...interface{}) {
+	Ctx(ctx).Warn(format, args...)
+}
+
+// ErrorCtx logs an error message with the logger carried by ctx
+func ErrorCtx(ctx context.Context, format string, args ...interface{}) {
+	Ctx(ctx).Error(format, args...)
+}
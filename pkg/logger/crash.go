@@ -0,0 +1,293 @@
+package logger
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PanicField is the entry field carrying the value a recovered panic was
+// called with. An entry logged with it and a StackField becomes a panic
+// report, see PanicFields.
+const PanicField = "panic"
+
+// PanicReportField is the field of a panic report entry carrying its
+// *PanicReport, for plugins to send in full
+const PanicReportField = "panic_report"
+
+// CrashReportField is the field of a panic report entry naming the file the
+// report was saved to
+const CrashReportField = "crash_report"
+
+// PriorityHigh is the priority of entries plugins must not lose, such as
+// panic reports. Logging waits up to highPriorityWait for plugins to take
+// them, and they get past rate limits and wait for room in a full queue.
+const PriorityHigh = "high"
+
+// RequestIDField is the entry field carrying the ID of the request an entry
+// was logged for
+const RequestIDField = "request_id"
+
+const (
+	defaultCrashReportsKept   = 50
+	defaultCrashRecentEntries = 100
+)
+
+// CrashReportConfig configures panic reports in logger.yaml
+type CrashReportConfig struct {
+	// Dir is where reports are saved, a JSON file each, by default
+	// crash-reports next to the log file
+	Dir string `yaml:"dir"`
+	// Keep is how many reports are kept, removing the oldest first,
+	// default 50
+	Keep int `yaml:"keep"`
+	// RecentEntries is how many of the entries logged before the panic a
+	// report includes, default 100
+	RecentEntries int `yaml:"recent_entries"`
+	// AllRequests includes the recent entries of other requests too. By
+	// default a report only has those of the panicking request, or those of
+	// no request when the panic wasn't in one, as reports are sent to
+	// plugins such as webhooks and Sentry.
+	AllRequests bool `yaml:"all_requests"`
+}
+
+// PanicReport describes a recovered panic
+type PanicReport struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Panic   string    `json:"panic"`
+	Stack   string    `json:"stack"`
+	// Goroutines is how many goroutines were running
+	Goroutines int `json:"goroutines"`
+	// Context holds the entry's other fields, such as the request ID,
+	// method and path of a panicking handler or the name of a service
+	Context map[string]any `json:"context,omitempty"`
+	// Build is the build info given to SetBuildInfo
+	Build any `json:"build,omitempty"`
+	// Recent are the entries logged before the panic, oldest first
+	Recent []LogEntry `json:"recent_entries"`
+}
+
+// PanicFields returns the fields to log a recovered panic with, turning
+// the entry into a panic report
+func PanicFields(value any, stack []byte) map[string]interface{} {
+	return map[string]interface{}{
+		PanicField: fmt.Sprint(value),
+		StackField: string(stack),
+	}
+}
+
+var (
+	buildInfoMu sync.RWMutex
+	buildInfo   any
+)
+
+// SetBuildInfo sets the build info included in panic reports
+func SetBuildInfo(info any) {
+	buildInfoMu.Lock()
+	defer buildInfoMu.Unlock()
+	buildInfo = info
+}
+
+// crashReporter builds and saves panic reports, keeping the latest entries
+// logged for them
+type crashReporter struct {
+	dir         string
+	keep        int
+	allRequests bool
+	cipher      cipher.AEAD // the log file's, to encrypt reports like it; may be nil
+
+	mu     sync.Mutex
+	recent []LogEntry // ring buffer, next is the oldest once full
+	next   int
+	full   bool
+	saveMu sync.Mutex
+}
+
+func newCrashReporter(config *CrashReportConfig, logFile string, aead cipher.AEAD) *crashReporter {
+	c := CrashReportConfig{}
+	if config != nil {
+		c = *config
+	}
+	if c.Dir == "" {
+		c.Dir = filepath.Join(filepath.Dir(logFile), "crash-reports")
+	}
+	if c.Keep <= 0 {
+		c.Keep = defaultCrashReportsKept
+	}
+	if c.RecentEntries <= 0 {
+		c.RecentEntries = defaultCrashRecentEntries
+	}
+	return &crashReporter{
+		dir:         c.Dir,
+		keep:        c.Keep,
+		allRequests: c.AllRequests,
+		cipher:      aead,
+		recent:      make([]LogEntry, c.RecentEntries),
+	}
+}
+
+// remember adds an entry to the ring buffer, without its stack or report
+// to keep the buffer small
+func (c *crashReporter) remember(entry LogEntry) {
+	if _, ok := entry.Fields[StackField]; ok {
+		entry.Fields = withoutFields(entry.Fields, StackField, PanicReportField)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recent[c.next] = entry
+	c.next = (c.next + 1) % len(c.recent)
+	c.full = c.full || c.next == 0
+}
+
+// snapshot returns the buffered entries, oldest first, keeping only those
+// of the request requestID (none when empty) unless reports include all
+// requests
+func (c *crashReporter) snapshot(requestID string) []LogEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var entries []LogEntry
+	if !c.full {
+		entries = append(entries, c.recent[:c.next]...)
+	} else {
+		entries = append(append(entries, c.recent[c.next:]...), c.recent[:c.next]...)
+	}
+	if c.allRequests {
+		return entries
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if id, _ := entry.Fields[RequestIDField].(string); id == requestID {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// report turns an entry logged with PanicFields into a high-priority entry
+// carrying a PanicReport, saving the report to the crash reports directory
+func (c *crashReporter) report(entry LogEntry, writeError func(format string, args ...interface{})) LogEntry {
+	buildInfoMu.RLock()
+	build := buildInfo
+	buildInfoMu.RUnlock()
+	requestID, _ := entry.Fields[RequestIDField].(string)
+
+	report := &PanicReport{
+		ID:         newReportID(),
+		Time:       entry.Timestamp.UTC(),
+		Message:    entry.Message,
+		Panic:      fmt.Sprint(entry.Fields[PanicField]),
+		Goroutines: runtime.NumGoroutine(),
+		Context:    withoutFields(entry.Fields, PanicField, StackField),
+		Build:      build,
+		Recent:     c.snapshot(requestID),
+	}
+	report.Stack, _ = entry.Fields[StackField].(string)
+	if len(report.Context) == 0 {
+		report.Context = nil
+	}
+
+	fields := make(map[string]any, len(entry.Fields)+2)
+	for key, value := range entry.Fields {
+		fields[key] = value
+	}
+	fields[PanicReportField] = report
+	path, err := c.save(report)
+	if err != nil {
+		writeError("Failed to save crash report %s: %v", report.ID, err)
+	} else {
+		fields[CrashReportField] = path
+	}
+	entry.Fields = fields
+	entry.Priority = PriorityHigh
+	return entry
+}
+
+// save writes report to the crash reports directory, encrypted like the log
+// file if that is, and removes the oldest reports beyond the number kept
+func (c *crashReporter) save(report *PanicReport) (string, error) {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	var data []byte
+	if c.cipher != nil {
+		// Sealed as a single line, for DecryptLine to read back
+		plain, err := json.Marshal(report)
+		if err != nil {
+			return "", err
+		}
+		line, err := sealLine(c.cipher, plain)
+		if err != nil {
+			return "", err
+		}
+		data = []byte(line)
+	} else {
+		var err error
+		if data, err = json.MarshalIndent(report, "", "  "); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(c.dir, report.Time.Format("20060102T150405.000Z")+"-"+report.ID+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return "", err
+	}
+
+	names, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return path, nil
+	}
+	sort.Strings(names)
+	for len(names) > c.keep {
+		os.Remove(names[0])
+		names = names[1:]
+	}
+	return path, nil
+}
+
+// erase redacts pattern from the saved reports, which hold the entries
+// logged before each panic
+func (c *crashReporter) erase(report *ErasureReport, pattern *regexp.Regexp) error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	names, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := report.erase(name, pattern, c.cipher); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutFields returns a copy of fields without keys
+func withoutFields(fields map[string]any, keys ...string) map[string]any {
+	copied := make(map[string]any, len(fields))
+	for key, value := range fields {
+		copied[key] = value
+	}
+	for _, key := range keys {
+		delete(copied, key)
+	}
+	return copied
+}
+
+func newReportID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// EncryptionConfig configures encryption of the log file at rest in
+// logger.yaml. The key is 32 random bytes, base64 encoded, read from
+// KeyFile or else from the LOG_ENCRYPTION_KEY environment variable.
+type EncryptionConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	KeyFile string `yaml:"key_file"`
+}
+
+// encryptedPrefix marks a log line sealed with AES-256-GCM. The rest of the
+// line is the base64 encoded nonce followed by the ciphertext.
+const encryptedPrefix = "enc:v1:"
+
+// newFileCipher loads the configured key
+func newFileCipher(config EncryptionConfig) (cipher.AEAD, error) {
+	encoded := os.Getenv("LOG_ENCRYPTION_KEY")
+	if config.KeyFile != "" {
+		data, err := os.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading log encryption key: %w", err)
+		}
+		encoded = string(data)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("log encryption key must be 32 bytes, base64 encoded")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptingWriter seals each line written to it separately, so the file
+// can be rotated, compressed and read back at any line boundary
+type encryptingWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	mu   sync.Mutex
+}
+
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if len(line) == 0 {
+			continue
+		}
+		sealed, err := sealLine(e.aead, line)
+		if err != nil {
+			return 0, err
+		}
+		out.WriteString(sealed)
+		out.WriteByte('\n')
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// sealLine encrypts a line, without its newline, under a fresh random nonce
+func sealLine(aead cipher.AEAD, line []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(line)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, line, nil)), nil
+}
+
+// defaultCipher is the default logger's file cipher, nil when there is no
+// default logger or its file isn't encrypted
+func defaultCipher() cipher.AEAD {
+	if defaultLogger == nil {
+		return nil
+	}
+	return defaultLogger.cipher
+}
+
+// Encrypted reports whether the default logger's file is encrypted at rest
+func Encrypted() bool {
+	return defaultCipher() != nil
+}
+
+// DecryptLine returns an encrypted log line in plain text, with the default
+// logger's key. Lines that aren't encrypted, or can't be decrypted with the
+// key, are returned unchanged.
+func DecryptLine(line string) string {
+	return decryptLine(defaultCipher(), line)
+}
+
+// decryptLine returns line in plain text if aead can open it, and unchanged
+// otherwise
+func decryptLine(aead cipher.AEAD, line string) string {
+	sealed, ok := strings.CutPrefix(line, encryptedPrefix)
+	if !ok || aead == nil {
+		return line
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return line
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return line
+	}
+	return string(plain)
+}
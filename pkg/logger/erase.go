@@ -0,0 +1,233 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted replaces erased identifiers in the log
+const Redacted = "[REDACTED]"
+
+// MinErasureIdentifier is the shortest identifier Erase accepts, so a typo
+// can't redact most of the log
+const MinErasureIdentifier = 3
+
+// maxErasureReportEntries bounds the entries listed in an ErasureReport
+const maxErasureReportEntries = 1000
+
+// ErasureReport describes what Erase redacted. Affected lists the first
+// redacted entries, up to 1000; Truncated is set when there were more.
+// @Description Entries redacted from the log files
+type ErasureReport struct {
+	Entries     int           `json:"entries"`
+	Occurrences int           `json:"occurrences"`
+	Files       []ErasedFile  `json:"files"`
+	Affected    []ErasedEntry `json:"affected"`
+	Truncated   bool          `json:"truncated,omitempty"`
+}
+
+// ErasedFile counts the entries redacted in one log file
+type ErasedFile struct {
+	File    string `json:"file"`
+	Entries int    `json:"entries"`
+}
+
+// ErasedEntry locates a redacted entry by file and line number
+type ErasedEntry struct {
+	File      string    `json:"file"`
+	Line      int       `json:"line"`
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+}
+
+// lockedWriter serializes writes to the log file so Erase can hold them
+// while it replaces the file
+type lockedWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (f *lockedWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.w.Write(p)
+}
+
+// Erase redacts identifiers from the default logger's files
+func Erase(identifiers []string, progress func(done, total int)) (ErasureReport, error) {
+	if defaultLogger == nil {
+		return ErasureReport{}, fmt.Errorf("logger not initialized")
+	}
+	return defaultLogger.Erase(identifiers, progress)
+}
+
+// Erase replaces every occurrence of the identifiers, matched ignoring case,
+// with Redacted in the log file, its rotated backups and the saved crash
+// reports, decrypting and re-encrypting encrypted lines. Files are
+// rewritten only when they contain an identifier. progress is called with
+// the files done out of the total.
+//
+// Writes wait until every file is rewritten, so the log can't rotate and
+// rename or remove a backup while it is being replaced.
+func (l *Logger) Erase(identifiers []string, progress func(done, total int)) (ErasureReport, error) {
+	pattern, err := erasurePattern(identifiers)
+	if err != nil {
+		return ErasureReport{}, err
+	}
+
+	l.file.mu.Lock()
+	defer l.file.mu.Unlock()
+	files, err := LogFiles(l.logFile, time.Time{})
+	if err != nil {
+		return ErasureReport{}, err
+	}
+	total := len(files) + 1
+
+	report := ErasureReport{Files: []ErasedFile{}, Affected: []ErasedEntry{}}
+	for i, file := range files {
+		if file == l.logFile {
+			// The next write reopens the file once it is replaced
+			l.writer.Close()
+		}
+		if err := report.erase(file, pattern, l.cipher); err != nil {
+			return report, err
+		}
+		progress(i+1, total)
+	}
+	if err := l.crash.erase(&report, pattern); err != nil {
+		return report, err
+	}
+	progress(total, total)
+	return report, nil
+}
+
+// erasurePattern matches any of the identifiers, ignoring case
+func erasurePattern(identifiers []string) (*regexp.Regexp, error) {
+	if len(identifiers) == 0 {
+		return nil, fmt.Errorf("no identifiers to erase")
+	}
+	quoted := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		if len(strings.TrimSpace(identifier)) < MinErasureIdentifier {
+			return nil, fmt.Errorf("identifiers must be at least %d characters", MinErasureIdentifier)
+		}
+		quoted[i] = regexp.QuoteMeta(strings.TrimSpace(identifier))
+	}
+	return regexp.Compile("(?i)" + strings.Join(quoted, "|"))
+}
+
+// erase rewrites path with pattern redacted, through a temporary file in the
+// same directory that replaces it only once it is complete. Lines sealed
+// with aead are opened to be redacted and sealed again.
+func (report *ErasureReport) erase(path string, pattern *regexp.Regexp, aead cipher.AEAD) error {
+	in, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	compressed := strings.HasSuffix(path, ".gz")
+	var r io.Reader = in
+	if compressed {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".erase-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	var out io.Writer = tmp
+	var gz *gzip.Writer
+	if compressed {
+		gz = gzip.NewWriter(tmp)
+		out = gz
+	}
+	w := bufio.NewWriter(out)
+
+	entries := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLine)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		plain := decryptLine(aead, line)
+		matches := len(pattern.FindAllStringIndex(plain, -1))
+		if matches > 0 {
+			encrypted := plain != line
+			redacted := pattern.ReplaceAllLiteralString(plain, Redacted)
+			line = redacted
+			if encrypted {
+				if line, err = sealLine(aead, []byte(redacted)); err != nil {
+					return err
+				}
+			}
+			entries++
+			report.record(filepath.Base(path), lineNum, redacted, matches)
+		}
+		w.WriteString(line)
+		w.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+	}
+	if entries == 0 {
+		return nil
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Chmod(info.Mode()); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing %s: %w", filepath.Base(path), err)
+	}
+	report.Files = append(report.Files, ErasedFile{File: filepath.Base(path), Entries: entries})
+	return nil
+}
+
+func (report *ErasureReport) record(file string, line int, redacted string, occurrences int) {
+	report.Entries++
+	report.Occurrences += occurrences
+	if len(report.Affected) == maxErasureReportEntries {
+		report.Truncated = true
+		return
+	}
+	affected := ErasedEntry{File: file, Line: line}
+	if entry, ok := parseLogLine(redacted); ok {
+		affected.Timestamp = entry.Timestamp
+		affected.Level = entry.Level
+	}
+	report.Affected = append(report.Affected, affected)
+}
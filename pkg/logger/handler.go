@@ -9,11 +9,13 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"strings"
 	"time"
+
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/xlsx"
 )
 
 // DebugSettings represents the request body for setting debug mode
@@ -58,6 +60,8 @@ type LogResponse struct {
 // HTTPHandler manages HTTP endpoints for log operations
 type HTTPHandler struct {
 	logger LoggerInterface
+	// canDecrypt reports whether a caller may read an encrypted log
+	canDecrypt func(r *http.Request) bool
 }
 
 // NewHTTPHandler creates a new logging handler
@@ -67,6 +71,23 @@ func NewHTTPHandler(logger LoggerInterface) *HTTPHandler {
 	}
 }
 
+// SetDecryptAccess sets who may read the log when it is encrypted at rest.
+// Without it, or when it returns false, the endpoints answer 403 Forbidden
+// rather than serve ciphertext.
+func (h *HTTPHandler) SetDecryptAccess(fn func(r *http.Request) bool) {
+	h.canDecrypt = fn
+}
+
+// readable writes a 403 and returns false when the log is encrypted and the
+// caller may not decrypt it
+func (h *HTTPHandler) readable(w http.ResponseWriter, r *http.Request) bool {
+	if !Encrypted() || (h.canDecrypt != nil && h.canDecrypt(r)) {
+		return true
+	}
+	httperr.Write(w, r, http.StatusForbidden, "Not allowed to read the encrypted log")
+	return false
+}
+
 // SetDebug handles requests to change debug logging state
 // @Summary Set debug logging mode
 // @Description Enable or disable debug logging
@@ -83,13 +104,13 @@ func NewHTTPHandler(logger LoggerInterface) *HTTPHandler {
 // @Router /api/loggersettings/debug [post]
 func (h *HTTPHandler) SetDebug(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httperr.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var settings DebugSettings
 	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
@@ -100,6 +121,55 @@ func (h *HTTPHandler) SetDebug(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(settings)
 }
 
+// GetBodyLogging handles requests for the body logging settings
+// @Summary Get body logging settings
+// @Description Whether request and response bodies are logged, for which routes and how many
+// @Tags logger
+// @Produce json
+// @Success 200 {object} BodyLoggingSettings
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/loggersettings/bodies [get]
+func (h *HTTPHandler) GetBodyLogging(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Bodies().Settings())
+}
+
+// SetBodyLogging handles requests to change the body logging settings
+// @Summary Change body logging settings
+// @Description Turn sampled body logging on or off, or change its sample rate, size cap or routes. Omitted settings are unchanged.
+// @Tags logger
+// @Accept json
+// @Produce json
+// @Param settings body BodyLoggingUpdate true "Body logging settings"
+// @Success 200 {object} BodyLoggingSettings
+// @Failure 400 {string} string "Invalid body logging settings"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/loggersettings/bodies [post]
+func (h *HTTPHandler) SetBodyLogging(w http.ResponseWriter, r *http.Request) {
+	var update BodyLoggingUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	settings, err := Bodies().Update(update)
+	if err != nil {
+		httperr.Writef(w, r, http.StatusBadRequest, "Invalid body logging settings: %v", err)
+		return
+	}
+	InfoCtx(r.Context(), "Body logging set to enabled=%v sample_rate=%v max_bytes=%d routes=%v",
+		settings.Enabled, settings.SampleRate, settings.MaxBytes, settings.Routes)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
 // GetLogs handles requests to retrieve log entries
 // @Summary Retrieve log entries
 // @Description Get filtered log entries with various output formats
@@ -114,6 +184,7 @@ func (h *HTTPHandler) SetDebug(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} LogResponse
 // @Failure 400 {string} string "Invalid parameters"
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Not allowed to read the encrypted log"
 // @Failure 405 {string} string "Method not allowed"
 // @Failure 500 {string} string "Internal server error"
 // @Security ApiKeyAuth
@@ -129,7 +200,7 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 		if fromTimeStr != "" {
 			fromTime, err := time.Parse(time.RFC3339, fromTimeStr)
 			if err != nil {
-				http.Error(w, "Invalid from_time format. Use RFC3339", http.StatusBadRequest)
+				httperr.Write(w, r, http.StatusBadRequest, "Invalid from_time format. Use RFC3339")
 				return
 			}
 			req.FromTime = &fromTime
@@ -139,7 +210,7 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 		if toTimeStr != "" {
 			toTime, err := time.Parse(time.RFC3339, toTimeStr)
 			if err != nil {
-				http.Error(w, "Invalid to_time format. Use RFC3339", http.StatusBadRequest)
+				httperr.Write(w, r, http.StatusBadRequest, "Invalid to_time format. Use RFC3339")
 				return
 			}
 			req.ToTime = &toTime
@@ -149,7 +220,7 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 		if lastLinesStr != "" {
 			var lastLines int
 			if _, err := fmt.Sscanf(lastLinesStr, "%d", &lastLines); err != nil {
-				http.Error(w, "Invalid last_lines format. Must be a number", http.StatusBadRequest)
+				httperr.Write(w, r, http.StatusBadRequest, "Invalid last_lines format. Must be a number")
 				return
 			}
 			req.LastLines = &lastLines
@@ -159,7 +230,7 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 		if lastMinutesStr != "" {
 			var lastMinutes int
 			if _, err := fmt.Sscanf(lastMinutesStr, "%d", &lastMinutes); err != nil {
-				http.Error(w, "Invalid last_minutes format. Must be a number", http.StatusBadRequest)
+				httperr.Write(w, r, http.StatusBadRequest, "Invalid last_minutes format. Must be a number")
 				return
 			}
 			req.LastMinutes = &lastMinutes
@@ -169,12 +240,12 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 
 	case http.MethodPost:
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid request body")
 			return
 		}
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httperr.Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -186,7 +257,7 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 		case "json", "jsonpretty", "csv", "text":
 			// Valid format
 		default:
-			http.Error(w, "Invalid format. Must be one of: json, jsonpretty, csv, text", http.StatusBadRequest)
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid format. Must be one of: json, jsonpretty, csv, text")
 			return
 		}
 	}
@@ -211,30 +282,35 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 		req.FromTime = &fromTime
 	}
 
+	if !h.readable(w, r) {
+		return
+	}
+
 	// Get the log file path from the logger
 	logFile := h.logger.GetLogFile()
 	if logFile == "" {
-		http.Error(w, "Log file path not available", http.StatusInternalServerError)
+		httperr.Write(w, r, http.StatusInternalServerError, "Log file path not available")
 		return
 	}
 
 	// Open and read the log file
 	file, err := os.Open(logFile)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to open log file: %v", err), http.StatusInternalServerError)
+		httperr.Writef(w, r, http.StatusInternalServerError, "Failed to open log file: %v", err)
 		return
 	}
 	defer file.Close()
 
 	var lines []string
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLine)
 
 	// If we only need last N lines and no time filtering is requested
 	if req.LastLines != nil && req.FromTime == nil {
 		// Use a circular buffer to keep last N lines
 		buffer := make([]string, 0, *req.LastLines)
 		for scanner.Scan() {
-			buffer = append(buffer, scanner.Text())
+			buffer = append(buffer, DecryptLine(scanner.Text()))
 			if len(buffer) > *req.LastLines {
 				buffer = buffer[1:]
 			}
@@ -243,7 +319,7 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 	} else {
 		// Time-based filtering
 		for scanner.Scan() {
-			line := scanner.Text()
+			line := DecryptLine(scanner.Text())
 			timestamp, err := extractTimestamp(line)
 			if err != nil {
 				continue // Skip lines without valid timestamp
@@ -262,7 +338,7 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if scanner.Err() != nil {
-		http.Error(w, fmt.Sprintf("Error reading log file: %v", scanner.Err()), http.StatusInternalServerError)
+		httperr.Writef(w, r, http.StatusInternalServerError, "Error reading log file: %v", scanner.Err())
 		return
 	}
 
@@ -286,6 +362,10 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 		writer.Write([]string{"Timestamp", "Level", "Message"})
 		// Write log entries
 		for _, line := range lines {
+			if entry, ok := parseJSONLine(line); ok {
+				writer.Write([]string{entry.Timestamp.Format("2006/01/02 15:04:05"), entry.Level, entry.Message + formatFields(entry.Fields)})
+				continue
+			}
 			parts := strings.SplitN(line, " ", 4)
 			if len(parts) >= 4 {
 				timestamp := parts[0] + " " + parts[1]
@@ -304,11 +384,130 @@ func (h *HTTPHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetSummary handles requests to summarize the log
+// @Summary Summarize log entries
+// @Description Count entries and their most frequent messages per level, hour or source, including rotated log files
+// @Tags logger
+// @Produce json
+// @Param from query string false "Start time (RFC3339), default 24 hours before to" Format(date-time)
+// @Param to query string false "End time (RFC3339), default now" Format(date-time)
+// @Param group_by query string false "Bucket entries by" Enums(level,hour,source) default(level)
+// @Param top query integer false "Most frequent messages per bucket" minimum(1) maximum(100) default(5)
+// @Success 200 {object} LogSummary
+// @Failure 400 {string} string "Invalid parameters"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Not allowed to read the encrypted log"
+// @Failure 500 {string} string "Internal server error"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/logging/summary [get]
+func (h *HTTPHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	to := time.Now()
+	if toStr := query.Get("to"); toStr != "" {
+		var err error
+		if to, err = time.Parse(time.RFC3339, toStr); err != nil {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid to format. Use RFC3339")
+			return
+		}
+	}
+	from := to.Add(-24 * time.Hour)
+	if fromStr := query.Get("from"); fromStr != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, fromStr); err != nil {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid from format. Use RFC3339")
+			return
+		}
+	}
+	if from.After(to) {
+		httperr.Write(w, r, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+
+	groupBy := query.Get("group_by")
+	switch groupBy {
+	case "":
+		groupBy = GroupByLevel
+	case GroupByLevel, GroupByHour, GroupBySource:
+	default:
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid group_by. Must be one of: level, hour, source")
+		return
+	}
+
+	format := query.Get("format")
+	switch format {
+	case "", "json", "xlsx":
+	default:
+		httperr.Write(w, r, http.StatusBadRequest, "Invalid format. Must be json or xlsx")
+		return
+	}
+
+	top := 5
+	if topStr := query.Get("top"); topStr != "" {
+		if _, err := fmt.Sscanf(topStr, "%d", &top); err != nil || top < 1 || top > 100 {
+			httperr.Write(w, r, http.StatusBadRequest, "Invalid top. Must be a number from 1 to 100")
+			return
+		}
+	}
+
+	if !h.readable(w, r) {
+		return
+	}
+	logFile := h.logger.GetLogFile()
+	if logFile == "" {
+		httperr.Write(w, r, http.StatusInternalServerError, "Log file path not available")
+		return
+	}
+	summary, err := Summarize(logFile, from, to, groupBy, top)
+	if err != nil {
+		httperr.Writef(w, r, http.StatusInternalServerError, "Error reading log file: %v", err)
+		return
+	}
+
+	if format == "xlsx" {
+		w.Header().Set("Content-Type", xlsx.MediaType)
+		w.Header().Set("Content-Disposition", `attachment; filename="log-summary-`+from.UTC().Format("20060102-1504")+`.xlsx"`)
+		if err := WriteSummaryXLSX(w, summary); err != nil {
+			h.logger.Error("Failed to write log summary workbook: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// GetPlugins handles requests for the delivery metrics of the log plugins
+// @Summary Log plugin metrics
+// @Description Delivery counters and latency of each log plugin, so failing log forwarding is visible
+// @Tags logger
+// @Produce json
+// @Success 200 {array} PluginMetrics
+// @Failure 401 {string} string "Unauthorized"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/logging/plugins [get]
+func (h *HTTPHandler) GetPlugins(w http.ResponseWriter, r *http.Request) {
+	metrics := []PluginMetrics{}
+	if l, ok := h.logger.(interface{ PluginMetrics() []PluginMetrics }); ok {
+		metrics = l.PluginMetrics()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
+
 // extractTimestamp attempts to parse the timestamp from a log line
 func extractTimestamp(line string) (time.Time, error) {
 	// Example log lines:
 	// "2024/03/09 10:32:30 [INFO] Starting server..."
 	// "10:32:30 [INFO] Starting server..."
+	// {"time":"2024-03-09T10:32:30.123Z","level":"INFO","message":"Starting server..."}
+	if strings.HasPrefix(line, "{") {
+		if entry, ok := parseJSONLine(line); ok {
+			return entry.Timestamp, nil
+		}
+		return time.Time{}, fmt.Errorf("invalid JSON log line")
+	}
 	parts := strings.SplitN(line, " ", 3)
 	if len(parts) < 2 {
 		return time.Time{}, fmt.Errorf("invalid log line format")
@@ -332,14 +531,3 @@ func extractTimestamp(line string) (time.Time, error) {
 
 	return time.Time{}, fmt.Errorf("invalid timestamp format: must be either '2006/01/02 15:04:05' or '15:04:05'")
 }
-
-func (h *HTTPHandler) PutWebook(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("PutWebook")
-	fmt.Println(r.Method)
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-		return
-	}
-	fmt.Println("Body", string(body))
-}
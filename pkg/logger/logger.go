@@ -1,12 +1,14 @@
 package logger
 
 import (
+	"crypto/cipher"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,11 +35,14 @@ type LoggerInterface interface {
 
 // Logger is the main logger
 type Logger struct {
-	logger  *log.Logger
+	backend Backend
 	debug   bool
 	logFile string
 	writer  *lumberjack.Logger
+	file    *lockedWriter
 	plugins []LogPlugin
+	crash   *crashReporter
+	cipher  cipher.AEAD // seals lines of the file; nil when it isn't encrypted
 	mu      sync.RWMutex
 }
 
@@ -99,21 +104,63 @@ func New(config *LogConfig) (*Logger, error) {
 	}
 	writers = append(writers, rotator)
 
+	// Encrypt the file, but not stdout, if configured
+	var aead cipher.AEAD
+	if config.Encryption != nil && config.Encryption.Enabled {
+		var err error
+		if aead, err = newFileCipher(*config.Encryption); err != nil {
+			return nil, err
+		}
+		writers[0] = &encryptingWriter{w: rotator, aead: aead}
+	}
+	file := &lockedWriter{w: writers[0]}
+	writers[0] = file
+
 	// Add stdout if configured
 	if config.LogToStdout {
 		writers = append(writers, os.Stdout)
 	}
 
+	backend, err := NewBackend(config.Backend, io.MultiWriter(writers...))
+	if err != nil {
+		return nil, err
+	}
+
 	return &Logger{
-		logger:  log.New(io.MultiWriter(writers...), "", log.LstdFlags),
+		backend: backend,
 		debug:   config.Debug,
 		logFile: config.LogFile,
 		writer:  rotator,
+		file:    file,
+		crash:   newCrashReporter(config.CrashReports, config.LogFile, aead),
+		cipher:  aead,
 	}, nil
 }
 
-// Close ensures any buffered logs are written and files are properly closed
+// Close closes the default logger and the access log, if they were
+// initialized
+func Close() error {
+	if defaultLogger == nil {
+		return nil
+	}
+	access.Close()
+	return defaultLogger.Close()
+}
+
+// Close ensures any buffered logs are written and files are properly closed.
+// Plugins are closed first so they can deliver what they have queued.
 func (l *Logger) Close() error {
+	l.mu.Lock()
+	plugins := l.plugins
+	l.plugins = nil
+	l.mu.Unlock()
+	for _, plugin := range plugins {
+		if err := plugin.Close(); err != nil {
+			l.writeError("Plugin close error: %v", err)
+		}
+	}
+	l.backend.Sync()
+
 	if l.writer != nil {
 		return l.writer.Close()
 	}
@@ -125,6 +172,15 @@ func (l *Logger) AddPlugin(plugin LogPlugin) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if m, ok := statsOf(plugin); ok {
+		// Plugins are told apart in their metrics by name
+		name := metricName.ReplaceAllString(m.pluginName(), "_")
+		for _, added := range l.plugins {
+			if a, ok := statsOf(added); ok && metricName.ReplaceAllString(a.pluginName(), "_") == name {
+				return fmt.Errorf("plugin %s would share its metrics with plugin %s; give webhooks to the same host a name", m.pluginName(), a.pluginName())
+			}
+		}
+	}
 	if err := plugin.Initialize(); err != nil {
 		return fmt.Errorf("failed to initialize plugin: %w", err)
 	}
@@ -152,20 +208,18 @@ func (l *Logger) RemovePlugin(plugin LogPlugin) error {
 }
 
 // Modify logWithSource to handle plugins
-func (l *Logger) logWithSource(level, format string, args ...interface{}) {
+func (l *Logger) logWithSource(level string, fields map[string]interface{}, format string, args ...interface{}) {
 	msg := fmt.Sprintf(format, args...)
 
+	// Every entry records where it was logged, for the sources filters and
+	// the summary's group_by=source
 	var source string
-	var line int
-	if level == "DEBUG" && l.debug {
-		_, file, lineNum, ok := runtime.Caller(2)
-		if ok {
-			if rel, err := filepath.Rel(os.Getenv("PWD"), file); err == nil {
-				file = rel
-			}
-			source = file
-			line = lineNum
+	file, line, ok := callerSource()
+	if ok {
+		if rel, err := filepath.Rel(os.Getenv("PWD"), file); err == nil {
+			file = rel
 		}
+		source = file
 	}
 
 	// Create log entry
@@ -175,6 +229,13 @@ func (l *Logger) logWithSource(level, format string, args ...interface{}) {
 		Message:   msg,
 		Source:    source,
 		Line:      line,
+		Fields:    fields,
+	}
+
+	// A recovered panic becomes a report, delivered with high priority
+	_, recovered := fields[PanicField]
+	if recovered && l.crash != nil {
+		entry = l.crash.report(entry, l.writeError)
 	}
 
 	// Handle plugins
@@ -182,58 +243,204 @@ func (l *Logger) logWithSource(level, format string, args ...interface{}) {
 	plugins := l.plugins
 	l.mu.RUnlock()
 
+	var handing sync.WaitGroup
 	for _, plugin := range plugins {
 		fmt.Println("Checking plugins")
 		if plugin.ShouldHandle(entry) {
 			fmt.Println("Plugin should handle - So lets go")
-			go func(p LogPlugin, e LogEntry) {
+			handle := func(p LogPlugin, e LogEntry) {
 				if err := p.Handle(e); err != nil {
-					l.logger.Printf("[ERROR] Plugin error: %v", err)
+					l.writeError("Plugin error: %v", err)
 				}
-			}(plugin, entry)
+			}
+			// The process exits after a fatal entry, so plugins must have
+			// it before Fatal closes them. A panic report may come just
+			// before a crash, but a slow plugin mustn't hold up the
+			// panicking request, so it is handed over in the background
+			// and waited for a while. Ordered plugins queue other entries
+			// themselves and must get them in the order they were logged.
+			_, ordered := plugin.(*orderedPlugin)
+			switch {
+			case level == "FATAL":
+				handle(plugin, entry)
+			case entry.Priority == PriorityHigh:
+				handing.Add(1)
+				go func(p LogPlugin) {
+					defer handing.Done()
+					handle(p, entry)
+				}(plugin)
+			case ordered:
+				handle(plugin, entry)
+			default:
+				go handle(plugin, entry)
+			}
+		}
+	}
+	if entry.Priority == PriorityHigh && !waitTimeout(&handing, highPriorityWait) {
+		l.writeError("Plugins are still taking a %s entry after %s, not waiting for them", entry.Priority, highPriorityWait)
+	}
+
+	// Log to standard outputs, the report only by where it was saved
+	if entry.Priority == PriorityHigh {
+		entry.Fields = withoutFields(entry.Fields, PanicReportField)
+	}
+	l.backend.Write(entry)
+	if l.crash != nil {
+		l.crash.remember(entry)
+	}
+}
+
+// highPriorityWait bounds how long logging a high-priority entry waits for
+// plugins to take it
+const highPriorityWait = time.Second
+
+// waitTimeout waits for wg for up to timeout, reporting whether it finished
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// writeError writes an error about the logger itself, bypassing plugins
+func (l *Logger) writeError(format string, args ...interface{}) {
+	l.backend.Write(LogEntry{Timestamp: time.Now(), Level: "ERROR", Message: fmt.Sprintf(format, args...)})
+}
+
+// packagePath is this package's import path, to recognise its own frames
+var packagePath = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+	slash := strings.LastIndex(name, "/")
+	return name[:slash+1+strings.Index(name[slash+1:], ".")]
+}()
+
+// callerSource finds the file and line of the first call from outside this
+// package, so entries logged through the package functions, fieldLogger or
+// the Ctx helpers all point at the code that logged them
+func callerSource() (string, int, bool) {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, packagePath+".") {
+			return frame.File, frame.Line, frame.File != ""
+		}
+		if !more {
+			return "", 0, false
 		}
 	}
+}
 
-	// Log to standard outputs
-	if source != "" {
-		l.logger.Printf("[%s] %s:%d: %s", level, source, line, msg)
-	} else {
-		l.logger.Printf("[%s] %s", level, msg)
+// formatFields renders fields as sorted " key=value" pairs for a log line,
+// quoting values that would otherwise be ambiguous or span lines
+func formatFields(fields map[string]interface{}) string {
+	var b strings.Builder
+	for _, key := range sortedKeys(fields) {
+		value := fmt.Sprint(fields[key])
+		if value == "" || strings.ContainsAny(value, " \"=\n\t") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, value)
 	}
+	return b.String()
 }
 
 func (l *Logger) Debug(format string, args ...interface{}) {
 	if !l.debug {
 		return
 	}
-	l.logWithSource("DEBUG", format, args...)
+	l.logWithSource("DEBUG", nil, format, args...)
 }
 
 func (l *Logger) Info(format string, args ...interface{}) {
-	l.logWithSource("INFO", format, args...)
+	l.logWithSource("INFO", nil, format, args...)
 }
 
 func (l *Logger) Warn(format string, args ...interface{}) {
-	l.logWithSource("WARN", format, args...)
+	l.logWithSource("WARN", nil, format, args...)
 }
 
 func (l *Logger) Error(format string, args ...interface{}) {
-	l.logWithSource("ERROR", format, args...)
+	l.logWithSource("ERROR", nil, format, args...)
 }
 
+// Fatal logs the message, closes the logger so plugins deliver what they
+// have queued, and exits
 func (l *Logger) Fatal(format string, args ...interface{}) {
-	l.logWithSource("FATAL", format, args...)
+	l.logWithSource("FATAL", nil, format, args...)
+	l.Close()
 	os.Exit(1)
 }
 
+// WithFields returns a logger that attaches fields to every entry it logs
 func (l *Logger) WithFields(fields map[string]interface{}) LoggerInterface {
-	return l // Fields not supported in basic logger
+	return (&fieldLogger{Logger: l}).WithFields(fields)
 }
 
 func (l *Logger) SetDebug(enabled bool) {
 	l.debug = enabled
 }
 
+// DebugEnabled reports whether debug messages are logged
+func (l *Logger) DebugEnabled() bool {
+	return l.debug
+}
+
 func (l *Logger) GetLogFile() string {
 	return l.logFile
 }
+
+// fieldLogger is a Logger that attaches a fixed set of fields to its entries.
+// The fields are copied so callers may reuse the map they passed.
+type fieldLogger struct {
+	*Logger
+	fields map[string]interface{}
+}
+
+func (f *fieldLogger) Debug(format string, args ...interface{}) {
+	if !f.debug {
+		return
+	}
+	f.logWithSource("DEBUG", f.fields, format, args...)
+}
+
+func (f *fieldLogger) Info(format string, args ...interface{}) {
+	f.logWithSource("INFO", f.fields, format, args...)
+}
+
+func (f *fieldLogger) Warn(format string, args ...interface{}) {
+	f.logWithSource("WARN", f.fields, format, args...)
+}
+
+func (f *fieldLogger) Error(format string, args ...interface{}) {
+	f.logWithSource("ERROR", f.fields, format, args...)
+}
+
+func (f *fieldLogger) Fatal(format string, args ...interface{}) {
+	f.logWithSource("FATAL", f.fields, format, args...)
+	f.Close()
+	os.Exit(1)
+}
+
+// WithFields returns a logger with fields added to this one's, replacing
+// any with the same name
+func (f *fieldLogger) WithFields(fields map[string]interface{}) LoggerInterface {
+	merged := make(map[string]interface{}, len(f.fields)+len(fields))
+	for key, value := range f.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &fieldLogger{Logger: f.Logger, fields: merged}
+}
@@ -0,0 +1,208 @@
+// Package loggertest provides a capture logger and a recording plugin for
+// testing code that logs through the logger package, without writing files.
+//
+//	log := loggertest.New()
+//	svc := mypkg.New(log)
+//	svc.Run()
+//	entry := loggertest.AssertLogged(t, log, "ERROR", "connection refused")
+//	loggertest.AssertField(t, entry, "attempt", 3)
+package loggertest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"exampleserver/pkg/logger"
+)
+
+// Logger is a logger.LoggerInterface that keeps its entries in memory.
+// Loggers returned by WithFields share the entries of the one they came
+// from. Debug entries are kept unless SetDebug(false) is called, and Fatal
+// records its entry without exiting.
+type Logger struct {
+	*capture
+	fields map[string]interface{}
+}
+
+type capture struct {
+	mu      sync.Mutex
+	entries []logger.LogEntry
+	debug   bool
+	plugins []logger.LogPlugin
+}
+
+// New returns an empty capture logger
+func New() *Logger {
+	return &Logger{capture: &capture{debug: true}}
+}
+
+func (l *Logger) Debug(format string, args ...interface{}) {
+	l.log("DEBUG", format, args...)
+}
+
+func (l *Logger) Info(format string, args ...interface{}) {
+	l.log("INFO", format, args...)
+}
+
+func (l *Logger) Warn(format string, args ...interface{}) {
+	l.log("WARN", format, args...)
+}
+
+func (l *Logger) Error(format string, args ...interface{}) {
+	l.log("ERROR", format, args...)
+}
+
+func (l *Logger) Fatal(format string, args ...interface{}) {
+	l.log("FATAL", format, args...)
+}
+
+// WithFields returns a logger with fields added to this one's, replacing
+// any with the same name
+func (l *Logger) WithFields(fields map[string]interface{}) logger.LoggerInterface {
+	merged := make(map[string]interface{}, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &Logger{capture: l.capture, fields: merged}
+}
+
+func (l *Logger) SetDebug(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.debug = enabled
+}
+
+// GetLogFile returns an empty path; nothing is written to disk
+func (l *Logger) GetLogFile() string {
+	return ""
+}
+
+// AddPlugin adds a plugin, which is handed matching entries synchronously
+// as they are logged
+func (l *Logger) AddPlugin(plugin logger.LogPlugin) error {
+	if err := plugin.Initialize(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.plugins = append(l.plugins, plugin)
+	return nil
+}
+
+func (l *Logger) log(level, format string, args ...interface{}) {
+	entry := logger.LogEntry{
+		Timestamp: time.Now(),
+		Level:     level,
+		Message:   fmt.Sprintf(format, args...),
+		Fields:    l.fields,
+	}
+
+	l.mu.Lock()
+	if level == "DEBUG" && !l.debug {
+		l.mu.Unlock()
+		return
+	}
+	l.entries = append(l.entries, entry)
+	plugins := l.plugins
+	l.mu.Unlock()
+
+	for _, plugin := range plugins {
+		if plugin.ShouldHandle(entry) {
+			plugin.Handle(entry)
+		}
+	}
+}
+
+// Entries returns the entries logged so far, oldest first
+func (l *Logger) Entries() []logger.LogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]logger.LogEntry(nil), l.entries...)
+}
+
+// Filter returns the entries matching filter, oldest first
+func (l *Logger) Filter(filter logger.LogFilter) []logger.LogEntry {
+	var matched []logger.LogEntry
+	for _, entry := range l.Entries() {
+		if filter.Matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+// Find returns the first entry at level whose message contains substr. An
+// empty level matches any level.
+func (l *Logger) Find(level, substr string) (logger.LogEntry, bool) {
+	return find(l.Entries(), level, substr)
+}
+
+// Reset forgets the entries logged so far
+func (l *Logger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
+
+func find(entries []logger.LogEntry, level, substr string) (logger.LogEntry, bool) {
+	for _, entry := range entries {
+		if (level == "" || strings.EqualFold(entry.Level, level)) && strings.Contains(entry.Message, substr) {
+			return entry, true
+		}
+	}
+	return logger.LogEntry{}, false
+}
+
+// AssertLogged fails the test unless l logged an entry at level whose
+// message contains substr, and returns the first such entry
+func AssertLogged(t testing.TB, l *Logger, level, substr string) logger.LogEntry {
+	t.Helper()
+	entry, ok := l.Find(level, substr)
+	if !ok {
+		t.Errorf("no %s entry containing %q was logged; got:\n%s", level, substr, describe(l.Entries()))
+	}
+	return entry
+}
+
+// AssertNotLogged fails the test if l logged an entry at level whose
+// message contains substr
+func AssertNotLogged(t testing.TB, l *Logger, level, substr string) {
+	t.Helper()
+	if entry, ok := l.Find(level, substr); ok {
+		t.Errorf("unexpected %s entry: %s", entry.Level, entry.Message)
+	}
+}
+
+// AssertField fails the test unless entry has the field key set to want,
+// compared with reflect.DeepEqual so slices and maps can be asserted too.
+// Types must match: a field set to an int64 isn't 3, but int64(3).
+func AssertField(t testing.TB, entry logger.LogEntry, key string, want interface{}) {
+	t.Helper()
+	got, ok := entry.Fields[key]
+	if !ok {
+		t.Errorf("entry %q has no field %s", entry.Message, key)
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entry %q has %s=%v (%T), want %v (%T)", entry.Message, key, got, got, want, want)
+	}
+}
+
+// describe lists entries for a failure message
+func describe(entries []logger.LogEntry) string {
+	if len(entries) == 0 {
+		return "  (nothing)"
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "  [%s] %s\n", entry.Level, entry.Message)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,106 @@
+package loggertest
+
+import (
+	"sync"
+	"time"
+
+	"exampleserver/pkg/logger"
+)
+
+// Recorder is a logger.LogPlugin that keeps the entries it is handed. It
+// works with the package's Logger as well as a real logger.Logger, which
+// hands entries to plugins in the background; use Wait before asserting on
+// those. Create recorders with NewRecorder.
+type Recorder struct {
+	// Filter selects the entries the recorder handles; empty handles all
+	Filter logger.LogFilter
+	// Err, when set, is returned by Handle after recording the entry, to
+	// test how the logger deals with failing plugins
+	Err error
+
+	mu          sync.Mutex
+	entries     []logger.LogEntry
+	initialized bool
+	closed      bool
+	handled     chan struct{}
+}
+
+// NewRecorder returns a recorder handling the entries matching filter
+func NewRecorder(filter logger.LogFilter) *Recorder {
+	return &Recorder{Filter: filter, handled: make(chan struct{}, 1)}
+}
+
+func (r *Recorder) Initialize() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.initialized = true
+	return r.Filter.Compile()
+}
+
+func (r *Recorder) ShouldHandle(entry logger.LogEntry) bool {
+	return r.Filter.Matches(entry)
+}
+
+func (r *Recorder) Handle(entry logger.LogEntry) error {
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	err := r.Err
+	r.mu.Unlock()
+
+	select {
+	case r.handled <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+// Entries returns the entries handled so far, in the order they arrived
+func (r *Recorder) Entries() []logger.LogEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]logger.LogEntry(nil), r.entries...)
+}
+
+// Find returns the first entry handled at level whose message contains
+// substr. An empty level matches any level.
+func (r *Recorder) Find(level, substr string) (logger.LogEntry, bool) {
+	return find(r.Entries(), level, substr)
+}
+
+// Wait waits up to timeout for the recorder to have handled n entries and
+// reports whether it has
+func (r *Recorder) Wait(n int, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		if len(r.Entries()) >= n {
+			return true
+		}
+		select {
+		case <-r.handled:
+		case <-deadline.C:
+			return len(r.Entries()) >= n
+		}
+	}
+}
+
+// Initialized reports whether Initialize was called
+func (r *Recorder) Initialized() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.initialized
+}
+
+// Closed reports whether Close was called
+func (r *Recorder) Closed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
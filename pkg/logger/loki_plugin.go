@@ -0,0 +1,205 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LokiConfig configures the Loki push plugin in logger.yaml
+type LokiConfig struct {
+	URL      string `yaml:"url"`       // base URL, e.g. http://localhost:3100
+	TenantID string `yaml:"tenant_id"` // sent as X-Scope-OrgID for multi-tenant Loki
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Labels are attached to every stream, e.g. service: exampleserver
+	Labels map[string]string `yaml:"labels"`
+	// EntryLabels adds labels taken from each entry: level and/or source
+	EntryLabels []string      `yaml:"entry_labels"`
+	BatchSize   int           `yaml:"batch_size"`  // entries per push, default 500
+	BatchWait   time.Duration `yaml:"batch_wait"`  // longest an entry waits to be pushed, default 1s
+	BufferSize  int           `yaml:"buffer_size"` // entries queued before new ones are dropped, default 10000
+	MaxRetries  int           `yaml:"max_retries"` // attempts per batch after the first, default 5
+	Filter      LogFilter     `yaml:"filter"`
+	// LevelMap sets the level label of each level, by default the level in
+	// lower case
+	LevelMap LevelMap `yaml:"level_map"`
+	// Delivery sets ordering and rate limiting
+	Delivery `yaml:",inline"`
+}
+
+const (
+	lokiPushPath       = "/loki/api/v1/push"
+	lokiRequestTimeout = 10 * time.Second
+)
+
+// LokiPlugin pushes log entries to Grafana Loki in batches, see batcher.
+// Rate limited pushes are retried after the Retry-After delay.
+type LokiPlugin struct {
+	config LokiConfig
+	client *http.Client
+	*batcher
+}
+
+func NewLokiPlugin(config LokiConfig) *LokiPlugin {
+	l := &LokiPlugin{
+		config: config,
+		client: &http.Client{Timeout: lokiRequestTimeout},
+	}
+	l.batcher = newBatcher("loki", config.BatchSize, config.BatchWait, config.BufferSize, config.MaxRetries, l.send)
+	return l
+}
+
+func (l *LokiPlugin) Initialize() error {
+	if l.config.URL == "" {
+		return fmt.Errorf("loki URL is required")
+	}
+	for _, label := range l.config.EntryLabels {
+		if label != "level" && label != "source" {
+			return fmt.Errorf("unknown loki entry label %q, use level or source", label)
+		}
+	}
+	if err := l.config.LevelMap.validate("loki"); err != nil {
+		return err
+	}
+	if err := l.config.Filter.Compile(); err != nil {
+		return err
+	}
+	l.start()
+	return nil
+}
+
+// Close pushes what is still queued, waiting up to five seconds
+func (l *LokiPlugin) Close() error {
+	l.close()
+	l.client.CloseIdleConnections()
+	return nil
+}
+
+func (l *LokiPlugin) ShouldHandle(entry LogEntry) bool {
+	return l.config.Filter.Matches(entry)
+}
+
+// Handle queues the entry, dropping it when the queue is full
+func (l *LokiPlugin) Handle(entry LogEntry) error {
+	return l.enqueue(entry)
+}
+
+// lokiStream is a set of entries sharing labels in a push request
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// send pushes a batch once, see sendFunc
+func (l *LokiPlugin) send(ctx context.Context, batch []LogEntry) (time.Duration, error) {
+	body, err := json.Marshal(map[string]interface{}{"streams": l.streams(batch)})
+	if err != nil {
+		return -1, fmt.Errorf("encoding push: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(l.config.URL, "/")+lokiPushPath, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.config.TenantID)
+	}
+	if l.config.Username != "" {
+		req.SetBasicAuth(l.config.Username, l.config.Password)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return retryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("push failed with status %d", resp.StatusCode)
+	default:
+		return -1, fmt.Errorf("push rejected with status %d", resp.StatusCode)
+	}
+}
+
+// streams groups a batch by label set, each stream in timestamp order
+func (l *LokiPlugin) streams(batch []LogEntry) []lokiStream {
+	byLabels := make(map[string]*lokiStream)
+	var order []string
+	for _, entry := range batch {
+		labels := make(map[string]string, len(l.config.Labels)+len(l.config.EntryLabels))
+		for name, value := range l.config.Labels {
+			labels[name] = value
+		}
+		for _, name := range l.config.EntryLabels {
+			switch name {
+			case "level":
+				labels["level"] = l.config.LevelMap.severity(entry.Level, nil, strings.ToLower(entry.Level))
+			case "source":
+				if entry.Source != "" {
+					labels["source"] = entry.Source
+				}
+			}
+		}
+
+		key := labelKey(labels)
+		stream, ok := byLabels[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			byLabels[key] = stream
+			order = append(order, key)
+		}
+		stream.Values = append(stream.Values, [2]string{
+			strconv.FormatInt(entry.Timestamp.UnixNano(), 10),
+			lokiLine(entry),
+		})
+	}
+
+	streams := make([]lokiStream, 0, len(order))
+	for _, key := range order {
+		stream := byLabels[key]
+		sort.SliceStable(stream.Values, func(i, j int) bool {
+			a, _ := strconv.ParseInt(stream.Values[i][0], 10, 64)
+			b, _ := strconv.ParseInt(stream.Values[j][0], 10, 64)
+			return a < b
+		})
+		streams = append(streams, *stream)
+	}
+	return streams
+}
+
+// labelKey is a canonical string for a label set
+func labelKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + "=" + strconv.Quote(labels[name]) + ",")
+	}
+	return b.String()
+}
+
+// lokiLine formats an entry as its log line: the message, prefixed with the
+// source location when known, then any fields as sorted key=value pairs
+func lokiLine(entry LogEntry) string {
+	var b strings.Builder
+	if entry.Source != "" {
+		fmt.Fprintf(&b, "%s:%d: ", entry.Source, entry.Line)
+	}
+	b.WriteString(entry.Message)
+	b.WriteString(formatFields(entry.Fields))
+	return b.String()
+}
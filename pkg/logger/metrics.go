@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PluginMetrics counts what a plugin did with the entries it was handed
+// since the server started
+// @Description Delivery counters of a log plugin
+type PluginMetrics struct {
+	// Name identifies the plugin, e.g. loki or webhook:alerts.example.com
+	Name string `json:"name"`
+	// Handled entries were handed to the plugin
+	Handled uint64 `json:"handled"`
+	// Delivered entries were accepted by the receiver
+	Delivered uint64 `json:"delivered"`
+	// Retried counts entries sent again after a failed attempt
+	Retried uint64 `json:"retried"`
+	// Failed entries were given up on after the receiver failed or
+	// rejected them
+	Failed uint64 `json:"failed"`
+	// Dropped entries were never sent, because the queue was full or the
+	// plugin's rate limit was exceeded
+	Dropped uint64 `json:"dropped"`
+	// Sends counts delivery attempts; latencies are per attempt
+	Sends        uint64  `json:"sends"`
+	LatencyAvgMs float64 `json:"latency_avg_ms"`
+	LatencyMaxMs float64 `json:"latency_max_ms"`
+}
+
+// pluginStats records a plugin's PluginMetrics
+type pluginStats struct {
+	handled    atomic.Uint64
+	delivered  atomic.Uint64
+	retried    atomic.Uint64
+	failed     atomic.Uint64
+	dropped    atomic.Uint64
+	mu         sync.Mutex
+	sends      uint64
+	latency    time.Duration
+	maxLatency time.Duration
+}
+
+// send records an attempt to deliver n entries that took latency. The
+// caller counts a failed attempt's entries as retried or failed.
+func (s *pluginStats) send(n int, latency time.Duration, err error) {
+	s.mu.Lock()
+	s.sends++
+	s.latency += latency
+	s.maxLatency = max(s.maxLatency, latency)
+	s.mu.Unlock()
+	if err == nil {
+		s.delivered.Add(uint64(n))
+	}
+}
+
+func (s *pluginStats) metrics(name string) PluginMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := PluginMetrics{
+		Name:         name,
+		Handled:      s.handled.Load(),
+		Delivered:    s.delivered.Load(),
+		Retried:      s.retried.Load(),
+		Failed:       s.failed.Load(),
+		Dropped:      s.dropped.Load(),
+		Sends:        s.sends,
+		LatencyMaxMs: float64(s.maxLatency) / float64(time.Millisecond),
+	}
+	if s.sends > 0 {
+		m.LatencyAvgMs = float64(s.latency) / float64(s.sends) / float64(time.Millisecond)
+	}
+	return m
+}
+
+// meteredPlugin is a plugin keeping PluginMetrics
+type meteredPlugin interface {
+	LogPlugin
+	pluginName() string
+	stats() *pluginStats
+}
+
+// unwrapper is a plugin wrapping another, such as Ordered
+type unwrapper interface {
+	Unwrap() LogPlugin
+}
+
+// statsOf finds the stats of plugin, looking through wrappers
+func statsOf(plugin LogPlugin) (meteredPlugin, bool) {
+	for {
+		if m, ok := plugin.(meteredPlugin); ok {
+			return m, true
+		}
+		w, ok := plugin.(unwrapper)
+		if !ok {
+			return nil, false
+		}
+		plugin = w.Unwrap()
+	}
+}
+
+// PluginMetrics returns the metrics of the logger's plugins, in the order
+// they were added. Plugins that don't keep metrics are left out.
+func (l *Logger) PluginMetrics() []PluginMetrics {
+	l.mu.RLock()
+	plugins := l.plugins
+	l.mu.RUnlock()
+
+	metrics := make([]PluginMetrics, 0, len(plugins))
+	for _, plugin := range plugins {
+		if m, ok := statsOf(plugin); ok {
+			metrics = append(metrics, m.stats().metrics(m.pluginName()))
+		}
+	}
+	return metrics
+}
+
+// metricName makes a plugin name usable in a metric name
+var metricName = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// pluginCounters are the PluginMetrics that only grow
+var pluginCounters = []string{"handled", "delivered", "retried", "failed", "dropped", "sends"}
+
+// Collect flattens the plugin metrics for the stats service, as
+// <plugin>.<counter>, e.g. loki.delivered. AddPlugin refuses plugins that
+// would share a name here.
+func (l *Logger) Collect(ctx context.Context) (map[string]float64, error) {
+	values := make(map[string]float64)
+	for _, m := range l.PluginMetrics() {
+		name := metricName.ReplaceAllString(m.Name, "_")
+		values[name+".handled"] = float64(m.Handled)
+		values[name+".delivered"] = float64(m.Delivered)
+		values[name+".retried"] = float64(m.Retried)
+		values[name+".failed"] = float64(m.Failed)
+		values[name+".dropped"] = float64(m.Dropped)
+		values[name+".sends"] = float64(m.Sends)
+		values[name+".latency_avg_seconds"] = m.LatencyAvgMs / 1000
+		values[name+".latency_max_seconds"] = m.LatencyMaxMs / 1000
+	}
+	return values, nil
+}
+
+// Counters names the values of Collect that only grow, for the stats
+// service to export them as counters
+func (l *Logger) Counters() []string {
+	var counters []string
+	for _, m := range l.PluginMetrics() {
+		name := metricName.ReplaceAllString(m.Name, "_")
+		for _, counter := range pluginCounters {
+			counters = append(counters, name+"."+counter)
+		}
+	}
+	return counters
+}
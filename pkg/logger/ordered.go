@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+)
+
+// orderedQueueSize is how many entries an ordered plugin queues before
+// logging waits for it
+const orderedQueueSize = 10000
+
+// orderedPlugin hands entries to a plugin one at a time, in the order they
+// were logged, from a single goroutine. Logger calls its Handle inline
+// rather than from a goroutine per entry, so a full queue slows logging down
+// instead of dropping or reordering entries.
+type orderedPlugin struct {
+	plugin  LogPlugin
+	entries chan LogEntry
+	done    chan struct{}
+	mu      sync.RWMutex
+	closed  bool
+	errMu   sync.Mutex
+	err     error
+}
+
+// Ordered wraps plugin so it is handed entries strictly in the order they
+// were logged, for receivers that rebuild state from the sequence of
+// entries. Throughput is bounded by how fast the plugin handles entries.
+func Ordered(plugin LogPlugin) LogPlugin {
+	return &orderedPlugin{
+		plugin:  plugin,
+		entries: make(chan LogEntry, orderedQueueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+func (o *orderedPlugin) Initialize() error {
+	if err := o.plugin.Initialize(); err != nil {
+		return err
+	}
+	go o.run()
+	return nil
+}
+
+func (o *orderedPlugin) ShouldHandle(entry LogEntry) bool {
+	return o.plugin.ShouldHandle(entry)
+}
+
+// Handle queues the entry, waiting while the queue is full. It returns the
+// last error the plugin returned since the previous call.
+func (o *orderedPlugin) Handle(entry LogEntry) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.closed {
+		return fmt.Errorf("plugin closed")
+	}
+	o.entries <- entry
+
+	o.errMu.Lock()
+	defer o.errMu.Unlock()
+	err := o.err
+	o.err = nil
+	return err
+}
+
+// Close hands the plugin what is still queued, then closes it
+func (o *orderedPlugin) Close() error {
+	o.mu.Lock()
+	if !o.closed {
+		o.closed = true
+		close(o.entries)
+	}
+	o.mu.Unlock()
+	<-o.done
+	return o.plugin.Close()
+}
+
+// Unwrap returns the wrapped plugin
+func (o *orderedPlugin) Unwrap() LogPlugin {
+	return o.plugin
+}
+
+func (o *orderedPlugin) run() {
+	defer close(o.done)
+	for entry := range o.entries {
+		if err := o.plugin.Handle(entry); err != nil {
+			o.errMu.Lock()
+			o.err = err
+			o.errMu.Unlock()
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package logger
 
-import "time"
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
 
 // LogEntry represents a structured log entry
 type LogEntry struct {
@@ -10,16 +16,259 @@ type LogEntry struct {
 	Source    string         `json:"source,omitempty"`
 	Line      int            `json:"line,omitempty"`
 	Fields    map[string]any `json:"fields,omitempty"`
+	// Priority is PriorityHigh for entries plugins must not lose
+	Priority string `json:"priority,omitempty"`
+}
+
+// StackField is the entry field carrying the goroutine stack of a recovered
+// panic, as returned by runtime/debug.Stack
+const StackField = "stack"
+
+// Levels are the levels entries are logged at, least severe first
+var Levels = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
+// LevelMap maps this package's levels to the severities of a downstream
+// system, e.g. WARN: NOTICE for syslog or ERROR: P2 for PagerDuty. Plugins
+// send their own default severity for levels the map leaves out.
+type LevelMap map[string]string
+
+// severity returns the severity level maps to, else defaults' or fallback
+func (m LevelMap) severity(level string, defaults map[string]string, fallback string) string {
+	level = strings.ToUpper(level)
+	if severity, ok := m[level]; ok {
+		return severity
+	}
+	if severity, ok := defaults[level]; ok {
+		return severity
+	}
+	return fallback
+}
+
+// validate checks that m maps known levels, to severities in allowed when
+// the downstream system only accepts some
+func (m LevelMap) validate(plugin string, allowed ...string) error {
+	for level, severity := range m {
+		known := false
+		for _, l := range Levels {
+			known = known || level == l
+		}
+		if !known {
+			return fmt.Errorf("%s level_map: unknown level %q, use one of %s", plugin, level, strings.Join(Levels, ", "))
+		}
+		if len(allowed) == 0 {
+			continue
+		}
+		valid := false
+		for _, a := range allowed {
+			valid = valid || severity == a
+		}
+		if !valid {
+			return fmt.Errorf("%s level_map: invalid severity %q for %s, use one of %s", plugin, severity, level, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
 }
 
 // LogFilter defines criteria for filtering log entries
 type LogFilter struct {
-	Levels     []string          `json:"levels,omitempty"`      // Filter by log levels (INFO, DEBUG, etc)
-	Sources    []string          `json:"sources,omitempty"`     // Filter by source files
-	Contains   []string          `json:"contains,omitempty"`    // Messages must contain these strings
-	StartTime  *time.Time        `json:"start_time,omitempty"`  // Only entries after this time
-	EndTime    *time.Time        `json:"end_time,omitempty"`    // Only entries before this time
-	FieldMatch map[string]string `json:"field_match,omitempty"` // Match specific field values
+	Levels     []string          `json:"levels,omitempty"`                         // Filter by log levels (INFO, DEBUG, etc)
+	Sources    []string          `json:"sources,omitempty"`                        // Filter by source files, by glob or name
+	Contains   []string          `json:"contains,omitempty"`                       // Messages must contain these strings
+	StartTime  *time.Time        `json:"start_time,omitempty"`                     // Only entries after this time
+	EndTime    *time.Time        `json:"end_time,omitempty"`                       // Only entries before this time
+	FieldMatch map[string]string `json:"field_match,omitempty" yaml:"field_match"` // Match specific field values, or regular expressions written as /pattern/
+	// MessageRegex is a regular expression the message must match
+	MessageRegex string `json:"message_regex,omitempty" yaml:"message_regex"`
+
+	// Exclusions are applied after the criteria above, so an entry matching
+	// any of them is rejected even when it matches everything else
+	ExcludeLevels  []string `json:"exclude_levels,omitempty" yaml:"exclude_levels"`   // Reject these levels
+	NotContains    []string `json:"not_contains,omitempty" yaml:"not_contains"`       // Reject messages containing any of these strings
+	ExcludeSources []string `json:"exclude_sources,omitempty" yaml:"exclude_sources"` // Reject these source files, by glob or name
+
+	compiled *compiledFilter
+}
+
+// compiledFilter holds the regular expressions of a LogFilter
+type compiledFilter struct {
+	message *regexp.Regexp
+	fields  map[string]*regexp.Regexp
+}
+
+// Compile compiles the filter's regular expressions once, so Matches doesn't
+// compile them for every entry. Plugins call it from Initialize.
+func (f *LogFilter) Compile() error {
+	compiled, err := f.compile()
+	if err != nil {
+		return err
+	}
+	f.compiled = compiled
+	return nil
+}
+
+func (f LogFilter) compile() (*compiledFilter, error) {
+	compiled := &compiledFilter{}
+	if f.MessageRegex != "" {
+		re, err := regexp.Compile(f.MessageRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter message_regex: %w", err)
+		}
+		compiled.message = re
+	}
+	for _, pattern := range append(append([]string(nil), f.Sources...), f.ExcludeSources...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid filter source pattern %q: %w", pattern, err)
+		}
+	}
+	for key, value := range f.FieldMatch {
+		pattern, ok := fieldPattern(value)
+		if !ok {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter field_match for %s: %w", key, err)
+		}
+		if compiled.fields == nil {
+			compiled.fields = make(map[string]*regexp.Regexp)
+		}
+		compiled.fields[key] = re
+	}
+	return compiled, nil
+}
+
+// sourceMatches reports whether the source file of an entry matches a
+// Sources pattern. A glob such as internal/auth/* or *_test.go is matched
+// against the trailing path elements of the source, the base name when the
+// pattern has no slash. A plain name must equal the source's trailing path
+// elements, a directory in its path or its file name without .go, so auth
+// matches internal/auth/jwt.go but not internal/author.go.
+func sourceMatches(pattern, source string) bool {
+	if source == "" {
+		return false
+	}
+	elements := strings.Split(source, "/")
+	if strings.ContainsAny(pattern, "*?[") {
+		n := strings.Count(pattern, "/") + 1
+		if n > len(elements) {
+			return false
+		}
+		matched, _ := path.Match(pattern, strings.Join(elements[len(elements)-n:], "/"))
+		return matched
+	}
+	if source == pattern || strings.HasSuffix(source, "/"+pattern) {
+		return true
+	}
+	for _, element := range elements[:len(elements)-1] {
+		if element == pattern {
+			return true
+		}
+	}
+	return strings.TrimSuffix(elements[len(elements)-1], ".go") == pattern
+}
+
+// fieldPattern returns the regular expression of a FieldMatch value written
+// as /pattern/
+func fieldPattern(value string) (string, bool) {
+	if len(value) < 2 || !strings.HasPrefix(value, "/") || !strings.HasSuffix(value, "/") {
+		return "", false
+	}
+	return value[1 : len(value)-1], true
+}
+
+// Matches reports whether entry passes every criterion of the filter. An
+// empty filter matches everything, and one with an invalid regular
+// expression nothing.
+func (f LogFilter) Matches(entry LogEntry) bool {
+	compiled := f.compiled
+	if compiled == nil {
+		var err error
+		if compiled, err = f.compile(); err != nil {
+			return false
+		}
+	}
+
+	// Check levels
+	if len(f.Levels) > 0 {
+		levelMatch := false
+		for _, level := range f.Levels {
+			if strings.EqualFold(entry.Level, level) {
+				levelMatch = true
+				break
+			}
+		}
+		if !levelMatch {
+			return false
+		}
+	}
+
+	// Check sources
+	if len(f.Sources) > 0 {
+		sourceMatch := false
+		for _, source := range f.Sources {
+			if sourceMatches(source, entry.Source) {
+				sourceMatch = true
+				break
+			}
+		}
+		if !sourceMatch {
+			return false
+		}
+	}
+
+	// Check contains
+	for _, substr := range f.Contains {
+		if !strings.Contains(entry.Message, substr) {
+			return false
+		}
+	}
+
+	// Check time range
+	if f.StartTime != nil && entry.Timestamp.Before(*f.StartTime) {
+		return false
+	}
+	if f.EndTime != nil && entry.Timestamp.After(*f.EndTime) {
+		return false
+	}
+
+	// Check message pattern
+	if compiled.message != nil && !compiled.message.MatchString(entry.Message) {
+		return false
+	}
+
+	// Check field matches
+	for key, value := range f.FieldMatch {
+		fieldValue, ok := entry.Fields[key]
+		if !ok {
+			return false
+		}
+		if re, ok := compiled.fields[key]; ok {
+			if !re.MatchString(fmt.Sprint(fieldValue)) {
+				return false
+			}
+		} else if fieldValue != value {
+			return false
+		}
+	}
+
+	// Check exclusions
+	for _, level := range f.ExcludeLevels {
+		if strings.EqualFold(entry.Level, level) {
+			return false
+		}
+	}
+	for _, substr := range f.NotContains {
+		if strings.Contains(entry.Message, substr) {
+			return false
+		}
+	}
+	for _, source := range f.ExcludeSources {
+		if sourceMatches(source, entry.Source) {
+			return false
+		}
+	}
+
+	return true
 }
 
 // LogPlugin defines the interface for log handlers
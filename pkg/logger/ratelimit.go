@@ -0,0 +1,147 @@
+package logger
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// suppressedNoticeInterval is how often a rate limited plugin is told how
+// many entries it was not handed
+const suppressedNoticeInterval = 10 * time.Second
+
+// SuppressedField is the field of a suppression notice counting the entries
+// suppressed since the last notice
+const SuppressedField = "suppressed"
+
+// rateLimitedPlugin hands a plugin at most perSecond entries a second on
+// average, in bursts of up to burst, and drops the rest. FATAL and
+// high-priority entries are always handed over. Every ten seconds in which
+// entries were dropped the plugin is handed a WARN entry saying how many, so
+// the receiver knows it missed some.
+type rateLimitedPlugin struct {
+	plugin     LogPlugin
+	perSecond  float64
+	burst      float64
+	mu         sync.Mutex
+	tokens     float64
+	last       time.Time
+	suppressed int
+	stop       chan struct{}
+	done       chan struct{}
+	once       sync.Once
+}
+
+// RateLimited wraps plugin so it is handed at most perSecond entries a
+// second, allowing bursts of up to burst entries, to protect receivers such
+// as paid alerting services from log storms. A burst below one defaults to
+// perSecond rounded up.
+func RateLimited(plugin LogPlugin, perSecond float64, burst int) LogPlugin {
+	if burst < 1 {
+		burst = int(math.Ceil(perSecond))
+	}
+	return &rateLimitedPlugin{
+		plugin:    plugin,
+		perSecond: perSecond,
+		burst:     float64(burst),
+		tokens:    float64(burst),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+func (r *rateLimitedPlugin) Initialize() error {
+	if r.perSecond <= 0 {
+		return fmt.Errorf("max_events_per_second must be positive")
+	}
+	if err := r.plugin.Initialize(); err != nil {
+		return err
+	}
+	r.last = time.Now()
+	go r.run()
+	return nil
+}
+
+func (r *rateLimitedPlugin) ShouldHandle(entry LogEntry) bool {
+	return r.plugin.ShouldHandle(entry)
+}
+
+// Handle hands the entry to the plugin if the rate allows it
+func (r *rateLimitedPlugin) Handle(entry LogEntry) error {
+	if entry.Level != "FATAL" && entry.Priority != PriorityHigh && !r.allow(time.Now()) {
+		return nil
+	}
+	return r.plugin.Handle(entry)
+}
+
+// Close sends the last suppression notice, then closes the plugin
+func (r *rateLimitedPlugin) Close() error {
+	r.once.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+	return r.plugin.Close()
+}
+
+// Unwrap returns the wrapped plugin
+func (r *rateLimitedPlugin) Unwrap() LogPlugin {
+	return r.plugin
+}
+
+// allow takes a token from the bucket, refilled at perSecond, or counts the
+// entry as suppressed when it is empty
+func (r *rateLimitedPlugin) allow(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = math.Min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.perSecond)
+	r.last = now
+	if r.tokens < 1 {
+		r.suppressed++
+		if m, ok := statsOf(r.plugin); ok {
+			m.stats().handled.Add(1)
+			m.stats().dropped.Add(1)
+		}
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+func (r *rateLimitedPlugin) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(suppressedNoticeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.notify()
+		case <-r.stop:
+			r.notify()
+			return
+		}
+	}
+}
+
+// notify hands the plugin a notice of the entries suppressed since the last
+// one, if there were any
+func (r *rateLimitedPlugin) notify() {
+	r.mu.Lock()
+	suppressed := r.suppressed
+	r.suppressed = 0
+	r.mu.Unlock()
+	if suppressed == 0 {
+		return
+	}
+
+	notice := LogEntry{
+		Timestamp: time.Now(),
+		Level:     "WARN",
+		Message:   fmt.Sprintf("%d events suppressed by the rate limit of %g per second", suppressed, r.perSecond),
+		Fields:    map[string]interface{}{SuppressedField: suppressed},
+	}
+	if err := r.plugin.Handle(notice); err != nil {
+		fmt.Fprintf(os.Stderr, "rate limit: failed to deliver suppression notice: %v\n", err)
+	}
+}
@@ -0,0 +1,440 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SentryConfig configures the Sentry error reporting plugin in logger.yaml.
+// Release and environment fall back to SENTRY_RELEASE and
+// SENTRY_ENVIRONMENT, as with Sentry's own SDKs.
+type SentryConfig struct {
+	DSN         string            `yaml:"dsn"` // https://<key>@<host>/<project>
+	Environment string            `yaml:"environment"`
+	Release     string            `yaml:"release"`
+	ServerName  string            `yaml:"server_name"` // defaults to the hostname
+	Tags        map[string]string `yaml:"tags"`        // attached to every event
+	// LevelMap overrides the event level of levels, e.g. WARN: error
+	LevelMap LevelMap `yaml:"level_map"`
+	// DedupeWindow is how long repeats of an event are counted rather than
+	// sent, default 1m
+	DedupeWindow time.Duration `yaml:"dedupe_window"`
+	BufferSize   int           `yaml:"buffer_size"`
+	MaxRetries   int           `yaml:"max_retries"`
+	// Filter selects the entries reported, by default ERROR and FATAL
+	Filter LogFilter `yaml:"filter"`
+	// Delivery sets ordering and rate limiting
+	Delivery `yaml:",inline"`
+}
+
+const (
+	sentryClient          = "exampleserver/1.0"
+	sentryRequestTimeout  = 10 * time.Second
+	sentryMaxFingerprints = 10000
+)
+
+// sentryLevel maps this package's levels to Sentry event levels
+var sentryLevel = map[string]string{
+	"DEBUG": "debug",
+	"INFO":  "info",
+	"WARN":  "warning",
+	"ERROR": "error",
+	"FATAL": "fatal",
+}
+
+// sentryLevels are the event levels Sentry accepts
+var sentryLevels = []string{"debug", "info", "warning", "error", "fatal"}
+
+// SentryPlugin reports log entries to Sentry as events, one per request via
+// the envelope endpoint, queued and retried by a batcher. An entry carrying
+// a StackField becomes an exception with that stack trace. Events are
+// grouped by a fingerprint of the message with numbers and IDs masked, or of
+// the panicking function, and repeats of a fingerprint within the dedupe
+// window are counted into the next event rather than sent.
+type SentryPlugin struct {
+	config   SentryConfig
+	client   *http.Client
+	endpoint string
+	auth     string
+	dsn      string
+	mu       sync.Mutex
+	seen     map[string]*sentryRepeat
+	*batcher
+}
+
+// sentryRepeat tracks the events sent for a fingerprint
+type sentryRepeat struct {
+	sent       time.Time
+	suppressed int
+}
+
+func NewSentryPlugin(config SentryConfig) *SentryPlugin {
+	if config.Release == "" {
+		config.Release = os.Getenv("SENTRY_RELEASE")
+	}
+	if config.Environment == "" {
+		config.Environment = os.Getenv("SENTRY_ENVIRONMENT")
+	}
+	if config.ServerName == "" {
+		config.ServerName, _ = os.Hostname()
+	}
+	if config.DedupeWindow <= 0 {
+		config.DedupeWindow = time.Minute
+	}
+	if len(config.Filter.Levels) == 0 {
+		config.Filter.Levels = []string{"ERROR", "FATAL"}
+	}
+	s := &SentryPlugin{
+		config: config,
+		client: &http.Client{Timeout: sentryRequestTimeout},
+		seen:   make(map[string]*sentryRepeat),
+	}
+	// Sentry takes one event per envelope, so batches are single entries
+	s.batcher = newBatcher("sentry", 1, 0, config.BufferSize, config.MaxRetries, s.send)
+	return s
+}
+
+// Initialize parses the DSN into the envelope endpoint and auth header
+func (s *SentryPlugin) Initialize() error {
+	if err := s.config.LevelMap.validate("sentry", sentryLevels...); err != nil {
+		return err
+	}
+	if err := s.config.Filter.Compile(); err != nil {
+		return err
+	}
+
+	dsn, err := url.Parse(s.config.DSN)
+	if err != nil || dsn.Host == "" || dsn.User == nil || dsn.User.Username() == "" {
+		return fmt.Errorf("invalid sentry DSN, expected https://<key>@<host>/<project>")
+	}
+	path := strings.TrimSuffix(dsn.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return fmt.Errorf("sentry DSN has no project ID")
+	}
+
+	s.endpoint = dsn.Scheme + "://" + dsn.Host + path[:slash] + "/api/" + project + "/envelope/"
+	s.auth = fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", sentryClient, dsn.User.Username())
+	if secret, ok := dsn.User.Password(); ok {
+		s.auth += ", sentry_secret=" + secret
+	}
+	s.dsn = s.config.DSN
+	s.start()
+	return nil
+}
+
+// Close sends what is still queued, waiting up to five seconds
+func (s *SentryPlugin) Close() error {
+	s.close()
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *SentryPlugin) ShouldHandle(entry LogEntry) bool {
+	return s.config.Filter.Matches(entry)
+}
+
+// Handle queues the entry unless its fingerprint was sent within the dedupe
+// window, in which case it is only counted
+func (s *SentryPlugin) Handle(entry LogEntry) error {
+	suppressed, ok := s.admit(sentryFingerprint(entry), entry.Timestamp)
+	if !ok {
+		return nil
+	}
+	if suppressed > 0 {
+		fields := make(map[string]any, len(entry.Fields)+1)
+		for key, value := range entry.Fields {
+			fields[key] = value
+		}
+		fields["duplicates_suppressed"] = suppressed
+		entry.Fields = fields
+	}
+	return s.enqueue(entry)
+}
+
+// admit reports whether an event with fingerprint should be sent at now,
+// and how many repeats were suppressed since the last one was
+func (s *SentryPlugin) admit(fingerprint string, now time.Time) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repeat, ok := s.seen[fingerprint]
+	if ok && now.Sub(repeat.sent) < s.config.DedupeWindow {
+		repeat.suppressed++
+		return 0, false
+	}
+	if !ok {
+		// Forget fingerprints whose window has passed before growing further
+		if len(s.seen) >= sentryMaxFingerprints {
+			for key, r := range s.seen {
+				if now.Sub(r.sent) >= s.config.DedupeWindow {
+					delete(s.seen, key)
+				}
+			}
+		}
+		repeat = &sentryRepeat{}
+		s.seen[fingerprint] = repeat
+	}
+	suppressed := repeat.suppressed
+	repeat.sent, repeat.suppressed = now, 0
+	return suppressed, true
+}
+
+// sentryEvent is the subset of the Sentry event payload the plugin sends
+type sentryEvent struct {
+	EventID     string             `json:"event_id"`
+	Timestamp   string             `json:"timestamp"`
+	Level       string             `json:"level"`
+	Logger      string             `json:"logger"`
+	Platform    string             `json:"platform"`
+	LogEntry    map[string]string  `json:"logentry"`
+	Release     string             `json:"release,omitempty"`
+	Environment string             `json:"environment,omitempty"`
+	ServerName  string             `json:"server_name,omitempty"`
+	Tags        map[string]string  `json:"tags,omitempty"`
+	Extra       map[string]any     `json:"extra,omitempty"`
+	Fingerprint []string           `json:"fingerprint"`
+	Exception   *sentryExceptions  `json:"exception,omitempty"`
+	Breadcrumbs *sentryBreadcrumbs `json:"breadcrumbs,omitempty"`
+}
+
+// sentryBreadcrumbs are the entries logged before a panic report
+type sentryBreadcrumbs struct {
+	Values []sentryBreadcrumb `json:"values"`
+}
+
+type sentryBreadcrumb struct {
+	Timestamp string `json:"timestamp"`
+	Category  string `json:"category"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string           `json:"type"`
+	Value      string           `json:"value"`
+	Stacktrace sentryStacktrace `json:"stacktrace"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// send posts an entry's event once, see sendFunc
+func (s *SentryPlugin) send(ctx context.Context, batch []LogEntry) (time.Duration, error) {
+	for _, entry := range batch {
+		retry, err := s.post(ctx, s.event(entry))
+		if err != nil {
+			return retry, err
+		}
+	}
+	return 0, nil
+}
+
+func (s *SentryPlugin) post(ctx context.Context, event sentryEvent) (time.Duration, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return -1, fmt.Errorf("encoding event: %w", err)
+	}
+	header, _ := json.Marshal(map[string]string{
+		"event_id": event.EventID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339Nano),
+		"dsn":      s.dsn,
+	})
+	var body bytes.Buffer
+	body.Write(header)
+	fmt.Fprintf(&body, "\n{\"type\":\"event\",\"length\":%d}\n", len(payload))
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return retryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("event failed with status %d", resp.StatusCode)
+	default:
+		return -1, fmt.Errorf("event rejected with status %d", resp.StatusCode)
+	}
+}
+
+// event converts an entry to a Sentry event. Fields other than the stack
+// become extra data, and the recent entries of a panic report breadcrumbs.
+func (s *SentryPlugin) event(entry LogEntry) sentryEvent {
+	event := sentryEvent{
+		EventID:     sentryEventID(),
+		Timestamp:   entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		Level:       s.config.LevelMap.severity(entry.Level, sentryLevel, "error"),
+		Logger:      "exampleserver",
+		Platform:    "go",
+		LogEntry:    map[string]string{"formatted": entry.Message},
+		Release:     s.config.Release,
+		Environment: s.config.Environment,
+		ServerName:  s.config.ServerName,
+		Tags:        s.config.Tags,
+		Fingerprint: []string{sentryFingerprint(entry)},
+	}
+	if entry.Source != "" {
+		event.Tags = make(map[string]string, len(s.config.Tags)+1)
+		for name, value := range s.config.Tags {
+			event.Tags[name] = value
+		}
+		event.Tags["source"] = entry.Source + ":" + strconv.Itoa(entry.Line)
+	}
+
+	for key, value := range entry.Fields {
+		if key == StackField || key == PanicReportField {
+			continue
+		}
+		if event.Extra == nil {
+			event.Extra = make(map[string]any, len(entry.Fields))
+		}
+		event.Extra[key] = value
+	}
+	if stack, ok := entry.Fields[StackField].(string); ok {
+		event.Exception = &sentryExceptions{Values: []sentryException{{
+			Type:       "panic",
+			Value:      entry.Message,
+			Stacktrace: sentryStacktrace{Frames: parseStack(stack)},
+		}}}
+	}
+	if report, ok := entry.Fields[PanicReportField].(*PanicReport); ok {
+		event.Extra["panic_report_id"] = report.ID
+		event.Extra["goroutines"] = report.Goroutines
+		if report.Build != nil {
+			event.Extra["build"] = report.Build
+		}
+		crumbs := make([]sentryBreadcrumb, 0, len(report.Recent))
+		for _, recent := range report.Recent {
+			crumbs = append(crumbs, sentryBreadcrumb{
+				Timestamp: recent.Timestamp.UTC().Format(time.RFC3339Nano),
+				Category:  "log",
+				Level:     s.config.LevelMap.severity(recent.Level, sentryLevel, "info"),
+				Message:   recent.Message,
+			})
+		}
+		event.Breadcrumbs = &sentryBreadcrumbs{Values: crumbs}
+	}
+	return event
+}
+
+// maskVariable matches the parts of a message that vary between otherwise
+// identical errors: hex IDs, UUIDs and numbers
+var maskVariable = regexp.MustCompile(`[0-9a-fA-F]{8,}(-[0-9a-fA-F]{4,})*|\d+`)
+
+// sentryFingerprint groups entries reporting the same problem: panics by the
+// function that panicked, other entries by level and their message with
+// variable parts masked
+func sentryFingerprint(entry LogEntry) string {
+	key := strings.ToUpper(entry.Level) + " " + maskVariable.ReplaceAllString(entry.Message, "#")
+	if stack, ok := entry.Fields[StackField].(string); ok {
+		// The newest frame of our own code, past runtime frames such as
+		// runtime.sigpanic
+		frames := parseStack(stack)
+		for i := len(frames) - 1; i >= 0; i-- {
+			if frames[i].InApp || i == 0 {
+				key = "panic " + frames[i].Function
+				break
+			}
+		}
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// parseStack converts a goroutine stack from runtime/debug.Stack into Sentry
+// frames, oldest call first. Frames from the recovery, up to the call to
+// panic, are dropped when present.
+func parseStack(stack string) []sentryFrame {
+	lines := strings.Split(strings.TrimSpace(stack), "\n")
+	var frames []sentryFrame
+	for i := 1; i+1 < len(lines); i += 2 {
+		function := strings.TrimPrefix(lines[i], "created by ")
+		if in := strings.Index(function, " in goroutine "); in >= 0 {
+			function = function[:in]
+		}
+		if open := strings.LastIndex(function, "("); open > 0 && strings.HasSuffix(function, ")") {
+			function = function[:open]
+		}
+		location := strings.TrimSpace(lines[i+1])
+		if space := strings.Index(location, " +0x"); space >= 0 {
+			location = location[:space]
+		}
+		file, line := location, 0
+		if colon := strings.LastIndex(location, ":"); colon >= 0 {
+			file = location[:colon]
+			line, _ = strconv.Atoi(location[colon+1:])
+		}
+
+		if function == "panic" {
+			frames = frames[:0]
+			continue
+		}
+		frames = append(frames, sentryFrame{
+			Function: function,
+			Module:   stackModule(function),
+			AbsPath:  file,
+			Lineno:   line,
+			InApp:    strings.HasPrefix(function, "exampleserver/") || strings.HasPrefix(function, "main."),
+		})
+	}
+
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// stackModule returns the package of a qualified function name such as
+// exampleserver/internal/server.(*Server).recoverPanics.func1
+func stackModule(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return ""
+}
+
+func sentryEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,335 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"exampleserver/pkg/xlsx"
+)
+
+// Summary groupings
+const (
+	GroupByLevel  = "level"
+	GroupByHour   = "hour"
+	GroupBySource = "source"
+)
+
+// maxSummaryMessage bounds the messages in a summary, which include any
+// fields of the entry
+const maxSummaryMessage = 300
+
+// maxLogLine bounds a log line read back from disk; entries carrying a stack
+// run to several kilobytes
+const maxLogLine = 1024 * 1024
+
+// LogSummary counts the entries logged between From and To
+// @Description Entry counts and most frequent messages per bucket
+type LogSummary struct {
+	From    time.Time       `json:"from"`
+	To      time.Time       `json:"to"`
+	GroupBy string          `json:"group_by"`
+	Total   int             `json:"total"`
+	Buckets []SummaryBucket `json:"buckets"`
+}
+
+// SummaryBucket counts the entries of one level, hour or source. Levels
+// breaks the count down by level unless the summary is grouped by level.
+type SummaryBucket struct {
+	Key         string         `json:"key"`
+	Count       int            `json:"count"`
+	Levels      map[string]int `json:"levels,omitempty"`
+	TopMessages []MessageCount `json:"top_messages"`
+}
+
+// MessageCount is how often a message was logged. Message has numbers and
+// IDs masked with # so repeats of the same message are counted together;
+// Example is the most recent of them as logged.
+type MessageCount struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+	Example string `json:"example"`
+}
+
+// levelOrder sorts level buckets by severity
+var levelOrder = map[string]int{"DEBUG": 0, "INFO": 1, "WARN": 2, "ERROR": 3, "FATAL": 4}
+
+// Summarize reads the entries logged to logFile and its rotated backups
+// between from and to and groups them by groupBy, keeping the top most
+// frequent messages of each bucket
+func Summarize(logFile string, from, to time.Time, groupBy string, top int) (LogSummary, error) {
+	summary := LogSummary{From: from, To: to, GroupBy: groupBy, Buckets: []SummaryBucket{}}
+	type bucket struct {
+		SummaryBucket
+		messages map[string]*MessageCount
+	}
+	buckets := make(map[string]*bucket)
+
+	files, err := LogFiles(logFile, from)
+	if err != nil {
+		return summary, err
+	}
+	for _, file := range files {
+		err := ScanLogFile(file, func(entry LogEntry) {
+			if entry.Timestamp.Before(from) || entry.Timestamp.After(to) {
+				return
+			}
+			var key string
+			switch groupBy {
+			case GroupByLevel:
+				key = entry.Level
+			case GroupByHour:
+				key = entry.Timestamp.Truncate(time.Hour).Format(time.RFC3339)
+			case GroupBySource:
+				key = entry.Source
+				if key == "" {
+					key = "unknown"
+				}
+			}
+
+			b, ok := buckets[key]
+			if !ok {
+				b = &bucket{SummaryBucket: SummaryBucket{Key: key}, messages: make(map[string]*MessageCount)}
+				buckets[key] = b
+			}
+			b.Count++
+			summary.Total++
+			if groupBy != GroupByLevel {
+				if b.Levels == nil {
+					b.Levels = make(map[string]int)
+				}
+				b.Levels[entry.Level]++
+			}
+
+			template := truncate(maskVariable.ReplaceAllString(entry.Message, "#"))
+			message, ok := b.messages[template]
+			if !ok {
+				message = &MessageCount{Message: template}
+				b.messages[template] = message
+			}
+			message.Count++
+			message.Example = truncate(entry.Message)
+		})
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	for _, b := range buckets {
+		b.TopMessages = make([]MessageCount, 0, len(b.messages))
+		for _, message := range b.messages {
+			b.TopMessages = append(b.TopMessages, *message)
+		}
+		sort.Slice(b.TopMessages, func(i, j int) bool {
+			if b.TopMessages[i].Count != b.TopMessages[j].Count {
+				return b.TopMessages[i].Count > b.TopMessages[j].Count
+			}
+			return b.TopMessages[i].Message < b.TopMessages[j].Message
+		})
+		if len(b.TopMessages) > top {
+			b.TopMessages = b.TopMessages[:top]
+		}
+		summary.Buckets = append(summary.Buckets, b.SummaryBucket)
+	}
+
+	sort.Slice(summary.Buckets, func(i, j int) bool {
+		a, b := summary.Buckets[i], summary.Buckets[j]
+		switch groupBy {
+		case GroupByLevel:
+			return levelOrder[a.Key] < levelOrder[b.Key]
+		case GroupBySource:
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+		}
+		return a.Key < b.Key
+	})
+	return summary, nil
+}
+
+// WriteSummaryXLSX writes summary as an Excel workbook: a sheet with a
+// row per bucket and its count, broken down by level unless grouped by
+// level, and a sheet with the top messages of each bucket
+func WriteSummaryXLSX(w io.Writer, summary LogSummary) error {
+	var levels []string
+	if summary.GroupBy != GroupByLevel {
+		seen := make(map[string]bool)
+		for _, bucket := range summary.Buckets {
+			for level := range bucket.Levels {
+				if !seen[level] {
+					seen[level] = true
+					levels = append(levels, level)
+				}
+			}
+		}
+		sort.Slice(levels, func(i, j int) bool { return levelOrder[levels[i]] < levelOrder[levels[j]] })
+	}
+	// Hours are dates, so that the sheet can chart and filter them
+	key := func(bucket SummaryBucket) interface{} {
+		if summary.GroupBy == GroupByHour {
+			if hour, err := time.Parse(time.RFC3339, bucket.Key); err == nil {
+				return hour
+			}
+		}
+		return bucket.Key
+	}
+	keyName := strings.ToUpper(summary.GroupBy[:1]) + summary.GroupBy[1:]
+
+	book := xlsx.NewWriter(w)
+	book.Sheet("Summary", append([]string{keyName, "Count"}, levels...)...)
+	for _, bucket := range summary.Buckets {
+		row := []interface{}{key(bucket), bucket.Count}
+		for _, level := range levels {
+			row = append(row, bucket.Levels[level])
+		}
+		book.Row(row...)
+	}
+	book.Row("Total", summary.Total)
+
+	book.Sheet("Top messages", keyName, "Message", "Count", "Example")
+	for _, bucket := range summary.Buckets {
+		for _, message := range bucket.TopMessages {
+			book.Row(key(bucket), message.Message, message.Count, message.Example)
+		}
+	}
+	return book.Close()
+}
+
+// LogFiles lists those of logFile's lumberjack backups, named
+// <name>-<rotation time><ext> and optionally gzipped, rotated after from,
+// oldest first, followed by logFile itself
+func LogFiles(logFile string, from time.Time) ([]string, error) {
+	ext := filepath.Ext(logFile)
+	prefix := strings.TrimSuffix(filepath.Base(logFile), ext) + "-"
+	entries, err := os.ReadDir(filepath.Dir(logFile))
+	if err != nil {
+		return nil, fmt.Errorf("listing log files: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp, ok := strings.CutPrefix(strings.TrimSuffix(name, ".gz"), prefix)
+		if !ok || !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		rotated, err := time.Parse("2006-01-02T15-04-05.000", strings.TrimSuffix(stamp, ext))
+		if err != nil || rotated.Before(from) {
+			continue
+		}
+		files = append(files, filepath.Join(filepath.Dir(logFile), name))
+	}
+	return append(files, logFile), nil
+}
+
+// ScanLogFile calls fn with each entry read back from a log file written by
+// Logger, gunzipping backups and decrypting encrypted lines. Fields stay part
+// of the message.
+func ScanLogFile(path string, fn func(LogEntry)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLine)
+	for scanner.Scan() {
+		if entry, ok := parseLogLine(scanner.Text()); ok {
+			fn(entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// logLine matches a line written by Logger: the local timestamp, the level,
+// the source location of debug entries and the message with its fields
+var logLine = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[([A-Z]+)\] (?:(\S+\.go):(\d+): )?(.*)$`)
+
+// parseLogLine reads an entry back from a line written by any backend
+func parseLogLine(line string) (LogEntry, bool) {
+	line = DecryptLine(line)
+	if strings.HasPrefix(line, "{") {
+		return parseJSONLine(line)
+	}
+	m := logLine.FindStringSubmatch(line)
+	if m == nil {
+		return LogEntry{}, false
+	}
+	timestamp, err := time.ParseInLocation("2006/01/02 15:04:05", m[1], time.Local)
+	if err != nil {
+		return LogEntry{}, false
+	}
+	entry := LogEntry{Timestamp: timestamp, Level: m[2], Source: m[3], Message: m[5]}
+	fmt.Sscan(m[4], &entry.Line)
+	return entry, true
+}
+
+// truncate shortens a message to maxSummaryMessage bytes, on a rune boundary
+func truncate(message string) string {
+	if len(message) <= maxSummaryMessage {
+		return message
+	}
+	cut := maxSummaryMessage
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	return message[:cut] + "..."
+}
+
+// parseJSONLine reads an entry back from a line written by the zap or
+// zerolog backend. Keys other than those of the entry become its fields,
+// without the prefix of those named like the entry's keys.
+func parseJSONLine(line string) (LogEntry, bool) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return LogEntry{}, false
+	}
+	stamp, _ := fields["time"].(string)
+	timestamp, err := time.Parse(time.RFC3339Nano, stamp)
+	if err != nil {
+		return LogEntry{}, false
+	}
+	entry := LogEntry{Timestamp: timestamp}
+	entry.Level, _ = fields["level"].(string)
+	entry.Message, _ = fields["message"].(string)
+	entry.Source, _ = fields["source"].(string)
+	if line, ok := fields["line"].(float64); ok {
+		entry.Line = int(line)
+	}
+	for _, key := range jsonKeys {
+		delete(fields, key)
+	}
+	if len(fields) > 0 {
+		entry.Fields = make(map[string]interface{}, len(fields))
+		for key, value := range fields {
+			entry.Fields[strings.TrimPrefix(key, jsonFieldPrefix)] = value
+		}
+	}
+	return entry, true
+}
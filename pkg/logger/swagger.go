@@ -1,7 +1,7 @@
 /*
 Package logger provides logging functionality with HTTP endpoints for configuration and log retrieval.
 
-The Swagger/OpenAPI documentation for this package describes two main endpoints:
+The Swagger/OpenAPI documentation for this package describes three main endpoints:
 
 	/api/loggersettings/debug (POST)
 	    Enables or disables debug logging mode. Requires authentication.
@@ -25,6 +25,23 @@ The Swagger/OpenAPI documentation for this package describes two main endpoints:
 	            "format": "csv"
 	        }
 
+	/api/logging/summary (GET)
+	    Counts entries and their most frequent messages per level, hour or
+	    source between from and to, reading rotated log files too.
+	    Requires authentication.
+	    Example request:
+	        GET /api/logging/summary?from=2024-03-10T02:00:00Z&to=2024-03-10T04:00:00Z&group_by=hour
+	    With format=xlsx the summary is downloaded as an Excel workbook.
+
+	/api/logging/plugins (GET)
+	    Counts the entries each plugin was handed, delivered, retried, failed
+	    and dropped, with the latency of its delivery attempts. Requires
+	    authentication.
+
+	When the log file is encrypted at rest, both endpoints decrypt it for
+	callers allowed by HTTPHandler.SetDecryptAccess and answer 403 Forbidden
+	to anyone else.
+
 Authentication:
 The endpoints support three authentication methods:
   - Bearer token (JWT)
@@ -62,7 +79,11 @@ The endpoints can be tested using curl:
 */
 package logger
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"exampleserver/pkg/xlsx"
+)
 
 // SwaggerDefinition contains the OpenAPI/Swagger paths and schemas for the logger endpoints
 type SwaggerDefinition struct {
@@ -224,6 +245,125 @@ func GetSwagger() *SwaggerDefinition {
 					"responses": getLogResponseDefinition(),
 				},
 			},
+			"/api/logging/summary": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary": "Summarize log entries",
+					"tags":    []string{"Logging"},
+					"security": []map[string]interface{}{
+						{"bearerAuth": []string{}},
+						{"apiKeyHeader": []string{}},
+						{"apiKeyQuery": []string{}},
+					},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "from",
+							"in":          "query",
+							"description": "Start time (RFC3339), default 24 hours before to",
+							"schema": map[string]interface{}{
+								"type":   "string",
+								"format": "date-time",
+							},
+						},
+						{
+							"name":        "to",
+							"in":          "query",
+							"description": "End time (RFC3339), default now",
+							"schema": map[string]interface{}{
+								"type":   "string",
+								"format": "date-time",
+							},
+						},
+						{
+							"name":        "group_by",
+							"in":          "query",
+							"description": "Bucket entries by level, hour or source",
+							"schema": map[string]interface{}{
+								"type":    "string",
+								"enum":    []string{GroupByLevel, GroupByHour, GroupBySource},
+								"default": GroupByLevel,
+							},
+						},
+						{
+							"name":        "top",
+							"in":          "query",
+							"description": "Most frequent messages per bucket",
+							"schema": map[string]interface{}{
+								"type":    "integer",
+								"minimum": 1,
+								"maximum": 100,
+								"default": 5,
+							},
+						},
+						{
+							"name":        "format",
+							"in":          "query",
+							"description": "json, or xlsx for an Excel workbook of the buckets and their top messages",
+							"schema": map[string]interface{}{
+								"type":    "string",
+								"enum":    []string{"json", "xlsx"},
+								"default": "json",
+							},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Entry counts and top messages per bucket",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/LogSummary",
+									},
+								},
+								xlsx.MediaType: map[string]interface{}{
+									"schema": map[string]interface{}{
+										"type":   "string",
+										"format": "binary",
+									},
+								},
+							},
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid parameters",
+						},
+						"401": map[string]interface{}{
+							"description": "Unauthorized - Invalid or missing authentication",
+						},
+						"403": map[string]interface{}{
+							"description": "The log is encrypted and the caller is not an admin",
+						},
+						"500": map[string]interface{}{
+							"description": "Internal server error",
+						},
+					},
+				},
+			},
+			"/api/logging/plugins": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary": "Delivery counters and latency of the log plugins",
+					"tags":    []string{"Logging"},
+					"security": []map[string]interface{}{
+						{"bearerAuth": []string{}},
+						{"apiKeyHeader": []string{}},
+						{"apiKeyQuery": []string{}},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Metrics per plugin, in the order the plugins were added",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"type":  "array",
+										"items": map[string]interface{}{"$ref": "#/components/schemas/PluginMetrics"},
+									},
+								},
+							},
+						},
+						"401": map[string]interface{}{
+							"description": "Unauthorized - Invalid or missing authentication",
+						},
+					},
+				},
+			},
 		},
 		Components: map[string]interface{}{
 			"schemas": map[string]interface{}{
@@ -249,6 +389,55 @@ func GetSwagger() *SwaggerDefinition {
 						},
 					},
 				},
+				"PluginMetrics": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":           map[string]interface{}{"type": "string", "description": "Plugin, e.g. loki or webhook:<host>"},
+						"handled":        map[string]interface{}{"type": "integer", "description": "Entries handed to the plugin"},
+						"delivered":      map[string]interface{}{"type": "integer", "description": "Entries accepted by the receiver"},
+						"retried":        map[string]interface{}{"type": "integer", "description": "Entries sent again after a failed attempt"},
+						"failed":         map[string]interface{}{"type": "integer", "description": "Entries given up on after failed attempts"},
+						"dropped":        map[string]interface{}{"type": "integer", "description": "Entries never sent: queue full or rate limited"},
+						"sends":          map[string]interface{}{"type": "integer", "description": "Delivery attempts"},
+						"latency_avg_ms": map[string]interface{}{"type": "number"},
+						"latency_max_ms": map[string]interface{}{"type": "number"},
+					},
+				},
+				"LogSummary": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"from":     map[string]interface{}{"type": "string", "format": "date-time"},
+						"to":       map[string]interface{}{"type": "string", "format": "date-time"},
+						"group_by": map[string]interface{}{"type": "string"},
+						"total":    map[string]interface{}{"type": "integer"},
+						"buckets": map[string]interface{}{
+							"type": "array",
+							"items": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"key":   map[string]interface{}{"type": "string", "description": "Level, start of the hour, or source file"},
+									"count": map[string]interface{}{"type": "integer"},
+									"levels": map[string]interface{}{
+										"type":                 "object",
+										"additionalProperties": map[string]interface{}{"type": "integer"},
+										"description":          "Count per level, when not grouped by level",
+									},
+									"top_messages": map[string]interface{}{
+										"type": "array",
+										"items": map[string]interface{}{
+											"type": "object",
+											"properties": map[string]interface{}{
+												"message": map[string]interface{}{"type": "string", "description": "Message with numbers and IDs masked as #"},
+												"count":   map[string]interface{}{"type": "integer"},
+												"example": map[string]interface{}{"type": "string", "description": "Most recent message as logged"},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
 			},
 		},
 	}
@@ -283,6 +472,9 @@ func getLogResponseDefinition() map[string]interface{} {
 		"401": map[string]interface{}{
 			"description": "Unauthorized - Invalid or missing authentication",
 		},
+		"403": map[string]interface{}{
+			"description": "The log is encrypted and the caller is not an admin",
+		},
 		"405": map[string]interface{}{
 			"description": "Method not allowed",
 		},
@@ -5,15 +5,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
+	"net/url"
+	"time"
 )
 
-// WebhookPlugin forwards log entries to a webhook URL
+// WebhookPlugin forwards log entries to a webhook URL. LevelMap, when set,
+// replaces the level of the entries posted. Name, when set, replaces the
+// host the webhook is named by in its metrics.
 type WebhookPlugin struct {
-	URL    string    `json:"url"`
-	APIKey string    `json:"api_key"`
-	Filter LogFilter `json:"filter"`
-	client *http.Client
+	Name     string    `json:"name,omitempty"`
+	URL      string    `json:"url"`
+	APIKey   string    `json:"api_key"`
+	Filter   LogFilter `json:"filter"`
+	LevelMap LevelMap  `json:"level_map,omitempty"`
+	client   *http.Client
+	metrics  pluginStats
 }
 
 func NewWebhookPlugin(url, apiKey string, filter LogFilter) *WebhookPlugin {
@@ -30,7 +36,10 @@ func (w *WebhookPlugin) Initialize() error {
 	if w.URL == "" {
 		return fmt.Errorf("webhook URL is required")
 	}
-	return nil
+	if err := w.Filter.Compile(); err != nil {
+		return err
+	}
+	return w.LevelMap.validate("webhook")
 }
 
 func (w *WebhookPlugin) Close() error {
@@ -39,67 +48,42 @@ func (w *WebhookPlugin) Close() error {
 }
 
 func (w *WebhookPlugin) ShouldHandle(entry LogEntry) bool {
-	// Check levels
 	fmt.Println("Checking levels", entry.Level, entry.Message)
-	if len(w.Filter.Levels) > 0 {
-		levelMatch := false
-		for _, level := range w.Filter.Levels {
-			if strings.EqualFold(entry.Level, level) {
-				fmt.Println("WebhookPlugin ShouldHandle: Level match", level)
-				levelMatch = true
-				break
-			}
-		}
-		if !levelMatch {
-			return false
-		}
-	}
-
-	// Check sources
-	if len(w.Filter.Sources) > 0 {
-		sourceMatch := false
-		for _, source := range w.Filter.Sources {
-			if strings.Contains(entry.Source, source) {
-				sourceMatch = true
-				break
-			}
-		}
-		if !sourceMatch {
-			return false
-		}
-	}
+	return w.Filter.Matches(entry)
+}
 
-	// Check contains
-	if len(w.Filter.Contains) > 0 {
-		for _, substr := range w.Filter.Contains {
-			if !strings.Contains(entry.Message, substr) {
-				return false
-			}
-		}
+func (w *WebhookPlugin) Handle(entry LogEntry) error {
+	fmt.Println("Handling webhook", entry.Level, entry.Message)
+	w.metrics.handled.Add(1)
+	start := time.Now()
+	err := w.post(entry)
+	w.metrics.send(1, time.Since(start), err)
+	if err != nil {
+		w.metrics.failed.Add(1)
 	}
+	return err
+}
 
-	// Check time range
-	if w.Filter.StartTime != nil && entry.Timestamp.Before(*w.Filter.StartTime) {
-		return false
+// pluginName names the webhook by its Name or its host, leaving out any
+// credentials in the URL
+func (w *WebhookPlugin) pluginName() string {
+	if w.Name != "" {
+		return "webhook:" + w.Name
 	}
-	if w.Filter.EndTime != nil && entry.Timestamp.After(*w.Filter.EndTime) {
-		return false
-	}
-
-	// Check field matches
-	if len(w.Filter.FieldMatch) > 0 {
-		for key, value := range w.Filter.FieldMatch {
-			if fieldValue, ok := entry.Fields[key]; !ok || fieldValue != value {
-				return false
-			}
-		}
+	if u, err := url.Parse(w.URL); err == nil && u.Host != "" {
+		return "webhook:" + u.Host
 	}
+	return "webhook"
+}
 
-	return true
+func (w *WebhookPlugin) stats() *pluginStats {
+	return &w.metrics
 }
 
-func (w *WebhookPlugin) Handle(entry LogEntry) error {
-	fmt.Println("Handling webhook", entry.Level, entry.Message)
+// post sends the entry once
+func (w *WebhookPlugin) post(entry LogEntry) error {
+	entry.Level = w.LevelMap.severity(entry.Level, nil, entry.Level)
+
 	// Convert entry to JSON
 	payload, err := json.Marshal(entry)
 	if err != nil {
@@ -0,0 +1,148 @@
+// Package mail sends email through SMTP or Amazon SES. Messages are written
+// directly or rendered from templates, and sent right away or queued for
+// background delivery, with every result logged and counted.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"exampleserver/pkg/logger"
+)
+
+// Message is an email to send. HTML, when set, is sent as an alternative to
+// Text.
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender delivers messages to a mail service
+type Sender interface {
+	Name() string
+	// Send delivers msg from the address from, returning once the service
+	// has accepted it
+	Send(ctx context.Context, from string, msg Message) error
+}
+
+// EnqueueFunc runs a delivery in the background, such as on a worker pool,
+// retrying it as the queue sees fit. It fails when the queue is full.
+type EnqueueFunc func(name string, run func(ctx context.Context) error) error
+
+// Mailer sends messages from one address through a sender
+type Mailer struct {
+	sender    Sender
+	from      string
+	templates *Templates
+	enqueue   EnqueueFunc
+
+	sent    atomic.Uint64
+	failed  atomic.Uint64
+	queued  atomic.Uint64
+	dropped atomic.Uint64
+
+	logger logger.LoggerInterface
+}
+
+// NewMailer returns a mailer sending from the address from, rendering
+// templates from templates and queueing deliveries with enqueue
+func NewMailer(sender Sender, from string, templates *Templates, enqueue EnqueueFunc, logger logger.LoggerInterface) *Mailer {
+	return &Mailer{
+		sender:    sender,
+		from:      from,
+		templates: templates,
+		enqueue:   enqueue,
+		logger:    logger,
+	}
+}
+
+// Send delivers a message right away, logging and counting the result
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	if err := validate(m.from, msg); err != nil {
+		m.failed.Add(1)
+		return err
+	}
+
+	start := time.Now()
+	err := m.sender.Send(ctx, m.from, msg)
+	to := strings.Join(msg.To, ", ")
+	if err != nil {
+		m.failed.Add(1)
+		m.logger.Error("[Mail] Failed to send %q to %s via %s: %v", msg.Subject, to, m.sender.Name(), err)
+		return err
+	}
+	m.sent.Add(1)
+	m.logger.Info("[Mail] Sent %q to %s via %s in %s", msg.Subject, to, m.sender.Name(), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// Queue delivers a message in the background. It fails and counts the
+// message as dropped when the queue is full.
+func (m *Mailer) Queue(msg Message) error {
+	if err := validate(m.from, msg); err != nil {
+		m.failed.Add(1)
+		return err
+	}
+	if err := m.enqueue("mail", func(ctx context.Context) error { return m.Send(ctx, msg) }); err != nil {
+		m.dropped.Add(1)
+		m.logger.Error("[Mail] Failed to queue %q to %s: %v", msg.Subject, strings.Join(msg.To, ", "), err)
+		return err
+	}
+	m.queued.Add(1)
+	return nil
+}
+
+// QueueTemplate renders the named template with data and queues it for the
+// recipients
+func (m *Mailer) QueueTemplate(to []string, name string, data interface{}) error {
+	msg, err := m.templates.Render(name, data)
+	if err != nil {
+		m.failed.Add(1)
+		return err
+	}
+	msg.To = to
+	return m.Queue(msg)
+}
+
+// Collect reports the delivery counters for the stats service
+func (m *Mailer) Collect(ctx context.Context) (map[string]float64, error) {
+	return map[string]float64{
+		"sent":    float64(m.sent.Load()),
+		"failed":  float64(m.failed.Load()),
+		"queued":  float64(m.queued.Load()),
+		"dropped": float64(m.dropped.Load()),
+	}, nil
+}
+
+// validate rejects messages without recipients and addresses or subjects
+// that would inject headers
+func validate(from string, msg Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("message has no recipients")
+	}
+	for _, address := range append([]string{from}, msg.To...) {
+		if _, err := netmail.ParseAddress(address); err != nil || strings.ContainsAny(address, "\r\n") {
+			return fmt.Errorf("invalid address %q", address)
+		}
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return errors.New("subject must be a single line")
+	}
+	return nil
+}
+
+// address returns the bare address of a validated address that may carry a
+// display name, as in "Example <noreply@example.com>"
+func address(s string) string {
+	if parsed, err := netmail.ParseAddress(s); err == nil {
+		return parsed.Address
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"exampleserver/pkg/sigv4"
+)
+
+// SESConfig locates the Amazon SES API and the credentials to call it.
+// Endpoint replaces the regional endpoint, such as for a local stand-in.
+type SESConfig struct {
+	Region       string
+	Endpoint     string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// SES sends raw messages with the SES v2 SendEmail API, signing requests
+// with AWS Signature Version 4
+type SES struct {
+	config SESConfig
+	client *http.Client
+}
+
+func NewSES(config SESConfig) *SES {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &SES{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *SES) Name() string {
+	return "ses"
+}
+
+func (s *SES) Send(ctx context.Context, from string, msg Message) error {
+	raw, err := build(from, msg)
+	if err != nil {
+		return err
+	}
+	to := make([]string, len(msg.To))
+	for i, recipient := range msg.To {
+		to[i] = address(recipient)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"FromEmailAddress": address(from),
+		"Destination":      map[string]interface{}{"ToAddresses": to},
+		"Content":          map[string]interface{}{"Raw": map[string]interface{}{"Data": raw}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint()+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.signer().Sign(req, sigv4.Hash(body), time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("ses send email: %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func (s *SES) endpoint() string {
+	if s.config.Endpoint != "" {
+		return strings.TrimSuffix(s.config.Endpoint, "/")
+	}
+	return "https://email." + s.config.Region + ".amazonaws.com"
+}
+
+func (s *SES) signer() sigv4.Signer {
+	return sigv4.Signer{
+		Service:      "ses",
+		Region:       s.config.Region,
+		AccessKey:    s.config.AccessKey,
+		SecretKey:    s.config.SecretKey,
+		SessionToken: s.config.SessionToken,
+	}
+}
@@ -0,0 +1,103 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPConfig locates an SMTP server and the credentials to send through it
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// TLS is "starttls" to upgrade the connection, and fail when the server
+	// can't, "tls" to connect over TLS (usually port 465) or "none"
+	TLS string
+}
+
+// SMTP sends messages through an SMTP server, one connection per message
+type SMTP struct {
+	config SMTPConfig
+	dialer net.Dialer
+}
+
+func NewSMTP(config SMTPConfig) *SMTP {
+	return &SMTP{config: config, dialer: net.Dialer{Timeout: 10 * time.Second}}
+}
+
+func (s *SMTP) Name() string {
+	return "smtp"
+}
+
+// Send delivers msg, giving up when ctx is done or after a minute
+func (s *SMTP) Send(ctx context.Context, from string, msg Message) error {
+	body, err := build(from, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	tlsConfig := &tls.Config{ServerName: s.config.Host, MinVersion: tls.VersionTLS12}
+	conn, err := s.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if s.config.TLS == "tls" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Minute)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.config.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("server doesn't support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if s.config.Username != "" {
+		// PlainAuth refuses to send the password over an unencrypted
+		// connection to anything but localhost
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := client.Mail(address(from)); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(address(to)); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
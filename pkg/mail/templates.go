@@ -0,0 +1,134 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*.tmpl
+var builtin embed.FS
+
+// Templates renders messages from templates named after their files, less
+// the .tmpl extension. Each file defines a "subject" and a "text" template,
+// and optionally an "html" one, escaped as HTML:
+//
+//	{{define "subject"}}Reset your password{{end}}
+//	{{define "text"}}Hello {{.Username}}, ...{{end}}
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// DefaultTemplates returns the templates built into the server
+func DefaultTemplates() *Templates {
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+	files, err := fs.Glob(builtin, "templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		data, err := builtin.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		if err := t.add(file, string(data)); err != nil {
+			panic(err)
+		}
+	}
+	return t
+}
+
+// LoadTemplates returns the built-in templates together with the .tmpl
+// files in dir, which replace built-ins of the same name. An empty dir
+// loads the built-ins alone.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := DefaultTemplates()
+	if dir == "" {
+		return t, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.add(file, string(data)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// add parses a template file, requiring the subject and text templates
+func (t *Templates) add(file, data string) error {
+	name := strings.TrimSuffix(filepath.Base(file), ".tmpl")
+	text, err := texttemplate.New(name).Option("missingkey=error").Parse(data)
+	if err != nil {
+		return fmt.Errorf("mail template %s: %w", file, err)
+	}
+	for _, required := range []string{"subject", "text"} {
+		if text.Lookup(required) == nil {
+			return fmt.Errorf("mail template %s: no %q template defined", file, required)
+		}
+	}
+	t.text[name] = text
+	delete(t.html, name)
+	if text.Lookup("html") != nil {
+		html, err := htmltemplate.New(name).Option("missingkey=error").Parse(data)
+		if err != nil {
+			return fmt.Errorf("mail template %s: %w", file, err)
+		}
+		t.html[name] = html
+	}
+	return nil
+}
+
+// Names returns the names of the templates, sorted
+func (t *Templates) Names() []string {
+	names := make([]string, 0, len(t.text))
+	for name := range t.text {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render executes the named template with data into a message without
+// recipients
+func (t *Templates) Render(name string, data interface{}) (Message, error) {
+	text, ok := t.text[name]
+	if !ok {
+		return Message{}, fmt.Errorf("no mail template %q", name)
+	}
+	var subject, body, html bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.ExecuteTemplate(&body, "text", data); err != nil {
+		return Message{}, err
+	}
+	if tmpl, ok := t.html[name]; ok {
+		if err := tmpl.ExecuteTemplate(&html, "html", data); err != nil {
+			return Message{}, err
+		}
+	}
+	return Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+		HTML:    strings.TrimSpace(html.String()),
+	}, nil
+}
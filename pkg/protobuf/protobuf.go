@@ -0,0 +1,248 @@
+// Package protobuf reads and writes the protocol buffers wire format for
+// types that describe their own fields, so API types can be sent as
+// protobuf without generated code. The schema the types follow is in
+// exampleserver.proto, next to this file.
+//
+// Like proto3, fields holding their zero value are left out, and unknown
+// fields are skipped when decoding.
+//
+// go generate writes the protoc-gen-go types of the schema to package pb,
+// for clients and for checking this encoding against
+// google.golang.org/protobuf. It needs protoc and protoc-gen-go on the PATH;
+// the server itself doesn't depend on the generated code.
+package protobuf
+
+//go:generate protoc --go_out=../.. --go_opt=module=exampleserver exampleserver.proto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// MediaType is the media type of protobuf messages. Streams of messages
+// use the same type, each message preceded by its length as a varint.
+const MediaType = "application/x-protobuf"
+
+// ErrInvalid is returned for data that isn't a valid protobuf encoding
+var ErrInvalid = errors.New("protobuf: invalid encoding")
+
+// Marshaler is implemented by types with a protobuf encoding
+type Marshaler interface {
+	MarshalProtobuf(e *Encoder)
+}
+
+// Unmarshaler is implemented by types that can be decoded from protobuf
+type Unmarshaler interface {
+	UnmarshalProtobuf(data []byte) error
+}
+
+// Wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Encoder appends the fields of a message
+type Encoder struct {
+	buf []byte
+}
+
+// Marshal returns the encoding of m
+func Marshal(m Marshaler) []byte {
+	var e Encoder
+	m.MarshalProtobuf(&e)
+	return e.buf
+}
+
+// WriteDelimited writes m preceded by its length, as a message of a stream
+func WriteDelimited(w io.Writer, m Marshaler) error {
+	data := Marshal(m)
+	buf := binary.AppendUvarint(make([]byte, 0, len(data)+binary.MaxVarintLen32), uint64(len(data)))
+	_, err := w.Write(append(buf, data...))
+	return err
+}
+
+func (e *Encoder) tag(field, wire int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wire))
+}
+
+// Uint64 appends a uint64 field, also used for uint32 fields
+func (e *Encoder) Uint64(field int, v uint64) {
+	if v != 0 {
+		e.tag(field, wireVarint)
+		e.buf = binary.AppendUvarint(e.buf, v)
+	}
+}
+
+// Int64 appends an int64 field, also used for int32 fields
+func (e *Encoder) Int64(field int, v int64) {
+	e.Uint64(field, uint64(v))
+}
+
+// Bool appends a bool field
+func (e *Encoder) Bool(field int, v bool) {
+	if v {
+		e.Uint64(field, 1)
+	}
+}
+
+// Double appends a double field
+func (e *Encoder) Double(field int, v float64) {
+	if v != 0 || math.Signbit(v) {
+		e.tag(field, wireFixed64)
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+	}
+}
+
+// String appends a string field
+func (e *Encoder) String(field int, v string) {
+	if v != "" {
+		e.tag(field, wireBytes)
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+		e.buf = append(e.buf, v...)
+	}
+}
+
+// Bytes appends a bytes field
+func (e *Encoder) Bytes(field int, v []byte) {
+	if len(v) > 0 {
+		e.tag(field, wireBytes)
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+		e.buf = append(e.buf, v...)
+	}
+}
+
+// Message appends m as an embedded message, or one element of a repeated
+// message field. Unlike scalars, an empty message is still written.
+func (e *Encoder) Message(field int, m Marshaler) {
+	data := Marshal(m)
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(data)))
+	e.buf = append(e.buf, data...)
+}
+
+// Time appends t as a google.protobuf.Timestamp, unless it is zero
+func (e *Encoder) Time(field int, t time.Time) {
+	if !t.IsZero() {
+		e.Message(field, timestamp(t))
+	}
+}
+
+// DoubleMap appends a map<string, double> field, as the repeated entries
+// the wire format has for maps, in the order of their keys
+func (e *Encoder) DoubleMap(field int, m map[string]float64) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e.Message(field, doubleEntry{key, m[key]})
+	}
+}
+
+type timestamp time.Time
+
+func (t timestamp) MarshalProtobuf(e *Encoder) {
+	e.Int64(1, time.Time(t).Unix())
+	e.Int64(2, int64(time.Time(t).Nanosecond()))
+}
+
+type doubleEntry struct {
+	key   string
+	value float64
+}
+
+func (d doubleEntry) MarshalProtobuf(e *Encoder) {
+	e.String(1, d.key)
+	e.Double(2, d.value)
+}
+
+// Field is a field read from a message
+type Field struct {
+	Number int
+	wire   int
+	varint uint64
+	data   []byte
+}
+
+// Fields calls fn with each field of the message data, in the order they
+// were written. Repeated fields come once per element.
+func Fields(data []byte, fn func(f Field) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 || key>>3 == 0 || key>>3 > math.MaxInt32 {
+			return ErrInvalid
+		}
+		data = data[n:]
+		f := Field{Number: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			if f.varint, n = binary.Uvarint(data); n <= 0 {
+				return ErrInvalid
+			}
+		case wireFixed64:
+			if n = 8; len(data) < n {
+				return ErrInvalid
+			}
+			f.varint = binary.LittleEndian.Uint64(data)
+		case wireFixed32:
+			if n = 4; len(data) < n {
+				return ErrInvalid
+			}
+			f.varint = uint64(binary.LittleEndian.Uint32(data))
+		case wireBytes:
+			length, m := binary.Uvarint(data)
+			if m <= 0 || length > uint64(len(data)-m) {
+				return ErrInvalid
+			}
+			f.data = data[m : m+int(length)]
+			n = m + int(length)
+		default:
+			return fmt.Errorf("%w: unsupported wire type %d", ErrInvalid, f.wire)
+		}
+		data = data[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unmarshal decodes data into m
+func Unmarshal(data []byte, m Unmarshaler) error {
+	return m.UnmarshalProtobuf(data)
+}
+
+// Uint64 returns the value of a uint64 or uint32 field
+func (f Field) Uint64() uint64 { return f.varint }
+
+// Int64 returns the value of an int64 or int32 field
+func (f Field) Int64() int64 { return int64(f.varint) }
+
+// Bool returns the value of a bool field
+func (f Field) Bool() bool { return f.varint != 0 }
+
+// Double returns the value of a double field
+func (f Field) Double() float64 { return math.Float64frombits(f.varint) }
+
+// String returns the value of a string field
+func (f Field) String() string { return string(f.data) }
+
+// Bytes returns the value of a bytes field, sharing the message's memory
+func (f Field) Bytes() []byte { return f.data }
+
+// Message decodes an embedded message field into m
+func (f Field) Message(m Unmarshaler) error {
+	if f.wire != wireBytes {
+		return fmt.Errorf("%w: field %d is not a message", ErrInvalid, f.Number)
+	}
+	return m.UnmarshalProtobuf(f.data)
+}
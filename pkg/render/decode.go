@@ -0,0 +1,57 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+
+	"exampleserver/pkg/protobuf"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ErrUnsupportedMediaType is returned by Decode for a body in a media type
+// the value can't be read from
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Decode reads the request body into v according to its Content-Type:
+// MessagePack with the json tags of v, protobuf when v implements
+// protobuf.Unmarshaler, and JSON otherwise. Unknown fields are rejected in
+// JSON and MessagePack, and skipped in protobuf as its clients expect.
+func Decode(r *http.Request, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/msgpack", "application/x-msgpack":
+		decoder := msgpack.NewDecoder(r.Body)
+		decoder.SetCustomStructTag("json")
+		decoder.DisallowUnknownFields(true)
+		return decoder.Decode(v)
+	case protobuf.MediaType, "application/protobuf":
+		m, ok := v.(protobuf.Unmarshaler)
+		if !ok {
+			return ErrUnsupportedMediaType
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		return protobuf.Unmarshal(data, m)
+	default:
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(v)
+	}
+}
+
+// DecodeTypes lists the media types a request body of v's type can be sent
+// in, for documentation
+func DecodeTypes(v interface{}) []string {
+	types := []string{"application/json", "application/msgpack"}
+	if _, ok := reflect.New(reflect.TypeOf(v)).Interface().(protobuf.Unmarshaler); ok {
+		types = append(types, protobuf.MediaType)
+	}
+	return types
+}
@@ -0,0 +1,380 @@
+package render
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"exampleserver/pkg/protobuf"
+	"exampleserver/pkg/xlsx"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// JSON encodes values with encoding/json
+type JSON struct{}
+
+func (JSON) MediaType() string { return "application/json" }
+
+func (JSON) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// XML encodes values with encoding/xml using their xml tags. Values whose
+// type has no XMLName field are wrapped in an element named after the type
+// in snake case, e.g. <customer>. Type defaults to application/xml.
+type XML struct {
+	Type string
+}
+
+func (x XML) MediaType() string {
+	if x.Type == "" {
+		return "application/xml"
+	}
+	return x.Type
+}
+
+func (XML) Encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && t.Kind() == reflect.Struct {
+		if _, ok := t.FieldByName("XMLName"); !ok {
+			if err := enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: snakeCase(t.Name())}}); err != nil {
+				return err
+			}
+			return finishXML(w, enc)
+		}
+	}
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return finishXML(w, enc)
+}
+
+// finishXML flushes enc and ends the document with a newline, as the JSON
+// encoder does
+func finishXML(w io.Writer, enc *xml.Encoder) error {
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// MessagePack encodes values with their json tags as MessagePack. Type
+// defaults to application/msgpack.
+type MessagePack struct {
+	Type string
+}
+
+func (m MessagePack) MediaType() string {
+	if m.Type == "" {
+		return "application/msgpack"
+	}
+	return m.Type
+}
+
+func (MessagePack) Encode(w io.Writer, v interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+// Protobuf encodes values that have a protobuf schema, implementing
+// protobuf.Marshaler. Type defaults to application/x-protobuf.
+type Protobuf struct {
+	Type string
+}
+
+func (p Protobuf) MediaType() string {
+	if p.Type == "" {
+		return protobuf.MediaType
+	}
+	return p.Type
+}
+
+func (Protobuf) CanEncode(v interface{}) bool {
+	_, ok := v.(protobuf.Marshaler)
+	return ok
+}
+
+func (Protobuf) Encode(w io.Writer, v interface{}) error {
+	m, ok := v.(protobuf.Marshaler)
+	if !ok {
+		return fmt.Errorf("protobuf: cannot encode %T", v)
+	}
+	_, err := w.Write(protobuf.Marshal(m))
+	return err
+}
+
+// CSV writes a header row of column names from json tags followed by a row
+// per record. A slice is written as one record per element, a struct with a
+// single slice field (such as a list response) as one record per element of
+// that slice, and any other struct as a single record. Nested structs are
+// flattened into dotted columns, e.g. customer.name.
+type CSV struct{}
+
+func (CSV) MediaType() string { return "text/csv" }
+
+func (CSV) Encode(w io.Writer, v interface{}) error {
+	records := csvRecords(reflect.ValueOf(v))
+	if !records.IsValid() {
+		return fmt.Errorf("csv: cannot encode %T", v)
+	}
+
+	elem := records.Type().Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return fmt.Errorf("csv: cannot encode records of %s", elem)
+	}
+	var columns []csvColumn
+	csvColumns(elem, "", nil, &columns)
+
+	writer := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.name
+	}
+	writer.Write(header)
+	for i := 0; i < records.Len(); i++ {
+		record := records.Index(i)
+		row := make([]string, len(columns))
+		for j, col := range columns {
+			row[j] = csvValue(record, col.index)
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvRecords returns the slice of records to write for v: v itself when it
+// is a slice, a lone struct field that is a slice, or v as a one element
+// slice
+func csvRecords(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return v
+	case reflect.Struct:
+		var slices []reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.IsExported() && field.Type.Kind() == reflect.Slice && jsonName(field) != "-" {
+				slices = append(slices, v.Field(i))
+			}
+		}
+		if len(slices) == 1 {
+			return slices[0]
+		}
+		one := reflect.MakeSlice(reflect.SliceOf(v.Type()), 1, 1)
+		one.Index(0).Set(v)
+		return one
+	}
+	return reflect.Value{}
+}
+
+type csvColumn struct {
+	name  string
+	index []int // field path from the record
+}
+
+var textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// csvColumns lists the columns of struct type t, descending into nested
+// structs that don't marshal themselves as text
+func csvColumns(t reflect.Type, prefix string, index []int, columns *[]csvColumn) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := jsonName(field)
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		path := append(append([]int{}, index...), i)
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && !reflect.PointerTo(ft).Implements(textMarshaler) {
+			csvColumns(ft, prefix+name+".", path, columns)
+			continue
+		}
+		*columns = append(*columns, csvColumn{name: prefix + name, index: path})
+	}
+}
+
+// csvValue formats the field at index within record, or "" when a pointer
+// on the way is nil
+func csvValue(record reflect.Value, index []int) string {
+	v, ok := fieldValue(record, index)
+	if !ok {
+		return ""
+	}
+
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case encoding.TextMarshaler:
+		text, err := value.MarshalText()
+		if err != nil {
+			return ""
+		}
+		return string(text)
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(parts, ";")
+	case reflect.Map:
+		data, _ := json.Marshal(v.Interface())
+		return string(data)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// fieldValue returns the field at index within record, following
+// pointers and interfaces, or false when one on the way is nil
+func fieldValue(record reflect.Value, index []int) (reflect.Value, bool) {
+	v := record
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+// XLSX encodes values as an Excel workbook of one sheet, with the same
+// rows and columns as CSV but typed cells: numbers, booleans and dates
+// stay what they are.
+type XLSX struct{}
+
+func (XLSX) MediaType() string { return xlsx.MediaType }
+
+func (XLSX) Encode(w io.Writer, v interface{}) error {
+	records := csvRecords(reflect.ValueOf(v))
+	if !records.IsValid() {
+		return fmt.Errorf("xlsx: cannot encode %T", v)
+	}
+	elem := records.Type().Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return fmt.Errorf("xlsx: cannot encode records of %s", elem)
+	}
+	var columns []csvColumn
+	csvColumns(elem, "", nil, &columns)
+
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.name
+	}
+	book := xlsx.NewWriter(w)
+	book.Sheet(sheetTitle(reflect.TypeOf(v)), header...)
+	row := make([]interface{}, len(columns))
+	for i := 0; i < records.Len(); i++ {
+		record := records.Index(i)
+		for j, col := range columns {
+			row[j] = xlsxValue(record, col.index)
+		}
+		book.Row(row...)
+	}
+	return book.Close()
+}
+
+// xlsxValue returns the field at index within record as the value of a
+// typed cell, or nil when a pointer on the way is nil
+func xlsxValue(record reflect.Value, index []int) interface{} {
+	v, ok := fieldValue(record, index)
+	if !ok {
+		return nil
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t
+	}
+	if _, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return csvValue(record, index)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return csvValue(record, index)
+}
+
+// sheetTitle names the sheet of a value after its type, e.g. Customers
+// for CustomersResponse
+func sheetTitle(t reflect.Type) string {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Name() == "" {
+		return "Sheet1"
+	}
+	return strings.TrimSuffix(t.Name(), "Response")
+}
+
+// jsonName returns the name a field has in JSON
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// snakeCase turns a Go type name such as CustomerImportResult into
+// customer_import_result
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
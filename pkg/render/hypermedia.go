@@ -0,0 +1,235 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Resource describes a value as a hypermedia resource. Attributes is the
+// value itself, encoded as JSON without its id. Links and Related map link
+// relations, such as self, to URLs.
+type Resource struct {
+	Type       string
+	ID         string
+	Attributes interface{}
+	Links      map[string]string
+	Related    map[string]string
+}
+
+// Document describes a response as a single resource or a collection of
+// resources of one type, with the links and metadata of the document, such
+// as those for paging through the collection
+type Document struct {
+	Resource   *Resource
+	Collection []Resource
+	Type       string // of the collection's resources
+	Links      map[string]string
+	Meta       map[string]interface{}
+}
+
+// Hypermedia pairs a response with its description as a document. The
+// envelope encoders render the document; every other encoder renders the
+// value as it is.
+type Hypermedia struct {
+	Value    interface{}
+	Document Document
+}
+
+// WithLinks returns v described by doc for the envelope encoders
+func WithLinks(v interface{}, doc Document) Hypermedia {
+	return Hypermedia{Value: v, Document: doc}
+}
+
+// Envelope is an encoder of hypermedia documents
+type Envelope interface {
+	Encoder
+	EncodeDocument(w io.Writer, doc Document) error
+}
+
+var envelope Envelope // replaces JSON for Hypermedia responses, see SetEnvelope
+
+// SetEnvelope selects the envelope rendering Hypermedia responses to
+// requests for plain JSON: "jsonapi", "hal", or "none" (or empty) to keep
+// plain JSON. Either envelope can be asked for by its media type anyway.
+func SetEnvelope(name string) error {
+	var enc Envelope
+	switch name {
+	case "", "none":
+	case "jsonapi":
+		enc = JSONAPI{}
+	case "hal":
+		enc = HAL{}
+	default:
+		return fmt.Errorf("unknown response envelope %q", name)
+	}
+	mu.Lock()
+	envelope = enc
+	mu.Unlock()
+	return nil
+}
+
+// encodeHypermedia encodes h with enc, or with the configured envelope
+// when enc is plain JSON, and returns the encoder used
+func encodeHypermedia(w io.Writer, enc Encoder, h Hypermedia) (Encoder, error) {
+	if _, ok := enc.(JSON); ok {
+		mu.RLock()
+		if envelope != nil {
+			enc = envelope
+		}
+		mu.RUnlock()
+	}
+	if env, ok := enc.(Envelope); ok {
+		return enc, env.EncodeDocument(w, h.Document)
+	}
+	return enc, enc.Encode(w, h.Value)
+}
+
+// JSONAPI encodes documents as JSON:API (https://jsonapi.org). Other
+// values are sent as the meta of an otherwise empty document.
+type JSONAPI struct{}
+
+func (JSONAPI) MediaType() string { return "application/vnd.api+json" }
+
+func (JSONAPI) Encode(w io.Writer, v interface{}) error {
+	return encodeJSON(w, map[string]interface{}{
+		"jsonapi": jsonAPIVersion,
+		"meta":    v,
+	})
+}
+
+var jsonAPIVersion = map[string]string{"version": "1.1"}
+
+func (j JSONAPI) EncodeDocument(w io.Writer, doc Document) error {
+	out := map[string]interface{}{"jsonapi": jsonAPIVersion}
+	if doc.Resource != nil {
+		resource, err := j.resource(*doc.Resource)
+		if err != nil {
+			return err
+		}
+		out["data"] = resource
+	} else {
+		data := make([]interface{}, len(doc.Collection))
+		for i, r := range doc.Collection {
+			resource, err := j.resource(r)
+			if err != nil {
+				return err
+			}
+			data[i] = resource
+		}
+		out["data"] = data
+	}
+	if len(doc.Links) > 0 {
+		out["links"] = doc.Links
+	}
+	if len(doc.Meta) > 0 {
+		out["meta"] = doc.Meta
+	}
+	return encodeJSON(w, out)
+}
+
+func (JSONAPI) resource(r Resource) (map[string]interface{}, error) {
+	attributes, err := attributesOf(r.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	resource := map[string]interface{}{
+		"type":       r.Type,
+		"id":         r.ID,
+		"attributes": attributes,
+	}
+	if len(r.Links) > 0 {
+		resource["links"] = r.Links
+	}
+	if len(r.Related) > 0 {
+		relationships := make(map[string]interface{}, len(r.Related))
+		for name, href := range r.Related {
+			relationships[name] = map[string]interface{}{"links": map[string]string{"related": href}}
+		}
+		resource["relationships"] = relationships
+	}
+	return resource, nil
+}
+
+// HAL encodes documents as HAL (application/hal+json), with links under
+// _links and the resources of a collection under _embedded. Other values
+// are sent as plain JSON.
+type HAL struct{}
+
+func (HAL) MediaType() string { return "application/hal+json" }
+
+func (HAL) Encode(w io.Writer, v interface{}) error {
+	return encodeJSON(w, v)
+}
+
+func (h HAL) EncodeDocument(w io.Writer, doc Document) error {
+	if doc.Resource != nil {
+		resource, err := h.resource(*doc.Resource)
+		if err != nil {
+			return err
+		}
+		return encodeJSON(w, resource)
+	}
+
+	embedded := make([]interface{}, len(doc.Collection))
+	for i, r := range doc.Collection {
+		resource, err := h.resource(r)
+		if err != nil {
+			return err
+		}
+		embedded[i] = resource
+	}
+	out := make(map[string]interface{}, len(doc.Meta)+2)
+	for name, value := range doc.Meta {
+		out[name] = value
+	}
+	out["_links"] = halLinks(doc.Links, nil)
+	out["_embedded"] = map[string]interface{}{doc.Type: embedded}
+	return encodeJSON(w, out)
+}
+
+func (HAL) resource(r Resource) (map[string]interface{}, error) {
+	attributes, err := attributesOf(r.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	resource := make(map[string]interface{}, len(attributes)+2)
+	for name, value := range attributes {
+		resource[name] = value
+	}
+	resource["id"] = r.ID
+	resource["_links"] = halLinks(r.Links, r.Related)
+	return resource, nil
+}
+
+// halLinks turns link relations into HAL link objects
+func halLinks(sets ...map[string]string) map[string]interface{} {
+	links := make(map[string]interface{})
+	for _, set := range sets {
+		for rel, href := range set {
+			links[rel] = map[string]string{"href": href}
+		}
+	}
+	return links
+}
+
+// attributesOf returns the JSON fields of v, other than its id
+func attributesOf(v interface{}) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &attributes); err != nil {
+		return nil, fmt.Errorf("attributes of %T must encode as a JSON object", v)
+	}
+	delete(attributes, "id")
+	return attributes, nil
+}
+
+// encodeJSON encodes v without escaping the & of query strings in links
+func encodeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
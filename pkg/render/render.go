@@ -0,0 +1,270 @@
+// Package render encodes API responses in the media type a client asks for
+// with the Accept header. JSON, XML, CSV, MessagePack, protobuf and xlsx
+// encoders are registered by default, along with the JSON:API and HAL
+// envelopes for Hypermedia responses; applications can register their own.
+// Decode reads request bodies in JSON, MessagePack or protobuf.
+package render
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"exampleserver/pkg/httperr"
+	"exampleserver/pkg/protobuf"
+	"exampleserver/pkg/xlsx"
+)
+
+// ErrNotAcceptable is returned by Negotiate when no registered encoder
+// produces a media type the client accepts
+var ErrNotAcceptable = errors.New("no acceptable media type")
+
+// Encoder writes values in a single media type
+type Encoder interface {
+	MediaType() string
+	Encode(w io.Writer, v interface{}) error
+}
+
+// Selective is implemented by encoders that can encode only some values,
+// such as protobuf, which needs a schema. Negotiation passes them over for
+// the others.
+type Selective interface {
+	Encoder
+	CanEncode(v interface{}) bool
+}
+
+var (
+	mu       sync.RWMutex
+	encoders []Encoder // in order of preference, JSON first
+)
+
+func init() {
+	Register(JSON{})
+	Register(XML{})
+	Register(CSV{})
+	Register(MessagePack{})
+	Register(Protobuf{})
+	Register(XLSX{})
+	Register(JSONAPI{})
+	Register(HAL{})
+	// Aliases still used by older clients, and the newer registered name
+	// of protobuf
+	Register(XML{Type: "text/xml"})
+	Register(MessagePack{Type: "application/x-msgpack"})
+	Register(Protobuf{Type: "application/protobuf"})
+}
+
+// Register adds an encoder, replacing any registered for the same media
+// type. Encoders registered later are preferred less when a client accepts
+// several types equally.
+func Register(enc Encoder) {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, existing := range encoders {
+		if existing.MediaType() == enc.MediaType() {
+			encoders[i] = enc
+			return
+		}
+	}
+	encoders = append(encoders, enc)
+}
+
+// MediaTypes lists the media types that can be negotiated
+func MediaTypes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	types := make([]string, len(encoders))
+	for i, enc := range encoders {
+		types[i] = enc.MediaType()
+	}
+	return types
+}
+
+// MediaTypesFor lists the media types v can be negotiated in
+func MediaTypesFor(v interface{}) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var types []string
+	for _, enc := range encoders {
+		if canEncode(enc, v) {
+			types = append(types, enc.MediaType())
+		}
+	}
+	return types
+}
+
+func canEncode(enc Encoder, v interface{}) bool {
+	if h, ok := v.(Hypermedia); ok {
+		v = h.Value
+	}
+	selective, ok := enc.(Selective)
+	return !ok || selective.CanEncode(v)
+}
+
+// acceptRange is a media range from an Accept header
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// formats maps values of the format query parameter, for links that can't
+// set Accept, to the media types they stand for
+var formats = map[string]string{
+	"json":     "application/json",
+	"xml":      "application/xml",
+	"csv":      "text/csv",
+	"msgpack":  "application/msgpack",
+	"protobuf": protobuf.MediaType,
+	"xlsx":     xlsx.MediaType,
+	"jsonapi":  "application/vnd.api+json",
+	"hal":      "application/hal+json",
+}
+
+// Negotiate picks the encoder for the request's format query parameter,
+// such as format=xlsx, or else its Accept header. Requests with neither
+// get JSON.
+func Negotiate(r *http.Request) (Encoder, error) {
+	return negotiate(r, func(Encoder) bool { return true })
+}
+
+// negotiate picks the encoder for r among those usable allows
+func negotiate(r *http.Request, usable func(Encoder) bool) (Encoder, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if format := r.URL.Query().Get("format"); format != "" {
+		for _, enc := range encoders {
+			if enc.MediaType() == formats[format] && usable(enc) {
+				return enc, nil
+			}
+		}
+		return nil, ErrNotAcceptable
+	}
+
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return encoders[0], nil
+	}
+
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	// More specific ranges take precedence over wildcards at equal quality
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return specificity(ranges[i].mediaType) > specificity(ranges[j].mediaType)
+	})
+
+	for _, ar := range ranges {
+		if ar.q <= 0 {
+			continue
+		}
+		for _, enc := range encoders {
+			if matches(ar.mediaType, enc.MediaType()) && !refused(ranges, enc.MediaType()) && usable(enc) {
+				return enc, nil
+			}
+		}
+	}
+	return nil, ErrNotAcceptable
+}
+
+func specificity(mediaType string) int {
+	switch {
+	case mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaType, "/*"):
+		return 1
+	}
+	return 2
+}
+
+func matches(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(mediaRange, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+// refused reports whether the client explicitly excluded mediaType with
+// q=0, such as with "*/*, text/csv;q=0"
+func refused(ranges []acceptRange, mediaType string) bool {
+	for _, ar := range ranges {
+		if ar.mediaType == mediaType && ar.q <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Marshal encodes v with the encoder negotiated for r. Hypermedia values
+// are encoded with the configured envelope in place of plain JSON, see
+// SetEnvelope.
+func Marshal(r *http.Request, v interface{}) ([]byte, Encoder, error) {
+	enc, err := negotiate(r, func(enc Encoder) bool { return canEncode(enc, v) })
+	if err != nil {
+		return nil, nil, err
+	}
+	var buf bytes.Buffer
+	if h, ok := v.(Hypermedia); ok {
+		enc, err = encodeHypermedia(&buf, enc, h)
+	} else {
+		err = enc.Encode(&buf, v)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), enc, nil
+}
+
+// Write responds with v encoded for the request's Accept header, or with a
+// 406 problem if no encoder is acceptable
+func Write(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	body, enc, err := Marshal(r, v)
+	if !WriteError(w, r, err) {
+		return
+	}
+	SetHeaders(w, enc)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// WriteError responds to a failed Marshal. It returns true when err is nil
+// and the caller should carry on writing the response.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrNotAcceptable):
+		httperr.Writef(w, r, http.StatusNotAcceptable, "Supported media types are %s", strings.Join(MediaTypes(), ", "))
+	default:
+		httperr.Write(w, r, http.StatusInternalServerError, "Error encoding response")
+	}
+	return false
+}
+
+// SetHeaders sets the Content-Type of enc and marks the response as
+// varying with Accept
+func SetHeaders(w http.ResponseWriter, enc Encoder) {
+	w.Header().Set("Content-Type", enc.MediaType())
+	w.Header().Add("Vary", "Accept")
+}
@@ -0,0 +1,288 @@
+// Package xlsx writes Excel workbooks (Office Open XML spreadsheets) row
+// by row, so large tables are streamed rather than built in memory. Cells
+// are typed by their Go value: numbers and booleans stay numbers and
+// booleans, times become dates, and everything else text.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MediaType is the media type of xlsx workbooks
+const MediaType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Styles of styles.xml, by index
+const (
+	styleDefault = iota
+	styleHeader  // bold
+	styleDate    // yyyy-mm-dd hh:mm:ss
+)
+
+// excelEpoch is day zero of Excel's 1900 date system, allowing for its
+// fictitious 29 February 1900
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Writer writes a workbook of one or more sheets. Errors are sticky: once
+// a write fails the rest are skipped and Close returns the error.
+type Writer struct {
+	zip    *zip.Writer
+	sheet  io.Writer
+	sheets []string
+	row    int
+	err    error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zip: zip.NewWriter(w)}
+}
+
+// Sheet starts a new sheet named name, with header as its first row in
+// bold, frozen so it stays in view while scrolling. A sheet without a
+// header has no frozen row.
+func (w *Writer) Sheet(name string, header ...string) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.endSheet()
+	w.sheets = append(w.sheets, sheetName(name, len(w.sheets)+1))
+	w.row = 0
+	w.sheet, w.err = w.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheets)))
+	if w.err != nil {
+		return w.err
+	}
+
+	w.write(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(header) > 0 {
+		w.write(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	w.write(`<sheetData>`)
+	if len(header) > 0 {
+		cells := make([]interface{}, len(header))
+		for i, name := range header {
+			cells[i] = name
+		}
+		w.writeRow(cells, styleHeader)
+	}
+	return w.err
+}
+
+// Row appends a row of cells to the current sheet, starting one named
+// Sheet1 if none was started
+func (w *Writer) Row(cells ...interface{}) error {
+	if w.err == nil && w.sheet == nil {
+		w.Sheet("")
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.writeRow(cells, styleDefault)
+	return w.err
+}
+
+// Close finishes the workbook. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err == nil && w.sheet == nil {
+		w.Sheet("")
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.endSheet()
+
+	var contentTypes, workbook, rels strings.Builder
+	for i, name := range w.sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	stylesID := len(w.sheets) + 1
+
+	w.file("[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`+
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`+
+		`<Default Extension="xml" ContentType="application/xml"/>`+
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`+
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`+
+		contentTypes.String()+`</Types>`)
+	w.file("_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>`+
+		`</Relationships>`)
+	w.file("xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`+
+		`<sheets>`+workbook.String()+`</sheets></workbook>`)
+	w.file("xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+
+		rels.String()+
+		fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, stylesID)+
+		`</Relationships>`)
+	w.file("xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`+
+		`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd\ hh:mm:ss"/></numFmts>`+
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>`+
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>`+
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`+
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`+
+		`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`+
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>`+
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>`+
+		`</styleSheet>`)
+	if w.err != nil {
+		return w.err
+	}
+	return w.zip.Close()
+}
+
+func (w *Writer) endSheet() {
+	if w.sheet != nil {
+		w.write(`</sheetData></worksheet>`)
+		w.sheet = nil
+	}
+}
+
+func (w *Writer) file(name, content string) {
+	if w.err != nil {
+		return
+	}
+	var f io.Writer
+	if f, w.err = w.zip.Create(name); w.err == nil {
+		_, w.err = io.WriteString(f, xml.Header+content)
+	}
+}
+
+func (w *Writer) write(s string) {
+	if w.err == nil {
+		_, w.err = io.WriteString(w.sheet, s)
+	}
+}
+
+func (w *Writer) writeRow(cells []interface{}, style int) {
+	w.row++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, w.row)
+	for i, value := range cells {
+		ref := column(i) + strconv.Itoa(w.row)
+		cell(&b, ref, value, style)
+	}
+	b.WriteString(`</row>`)
+	w.write(b.String())
+}
+
+// cell writes the cell at ref holding value, typed by its Go type
+func cell(b *strings.Builder, ref string, value interface{}, style int) {
+	attrs := `r="` + ref + `"`
+	if style != styleDefault {
+		attrs += ` s="` + strconv.Itoa(style) + `"`
+	}
+	var number float64
+	switch v := value.(type) {
+	case nil:
+		return
+	case bool:
+		if v {
+			fmt.Fprintf(b, `<c %s t="b"><v>1</v></c>`, attrs)
+		} else {
+			fmt.Fprintf(b, `<c %s t="b"><v>0</v></c>`, attrs)
+		}
+		return
+	case time.Time:
+		if v.IsZero() {
+			return
+		}
+		if style == styleDefault {
+			attrs += ` s="` + strconv.Itoa(styleDate) + `"`
+		}
+		// Excel dates have no time zone, so they are written in UTC
+		days := v.UTC().Sub(excelEpoch).Hours() / 24
+		fmt.Fprintf(b, `<c %s><v>%s</v></c>`, attrs, strconv.FormatFloat(days, 'f', -1, 64))
+		return
+	case int:
+		number = float64(v)
+	case int8:
+		number = float64(v)
+	case int16:
+		number = float64(v)
+	case int32:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	case uint:
+		number = float64(v)
+	case uint8:
+		number = float64(v)
+	case uint16:
+		number = float64(v)
+	case uint32:
+		number = float64(v)
+	case uint64:
+		number = float64(v)
+	case float32:
+		number = float64(v)
+	case float64:
+		number = v
+	case string:
+		inline(b, attrs, v)
+		return
+	default:
+		inline(b, attrs, fmt.Sprint(v))
+		return
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		inline(b, attrs, strconv.FormatFloat(number, 'f', -1, 64))
+		return
+	}
+	fmt.Fprintf(b, `<c %s><v>%s</v></c>`, attrs, strconv.FormatFloat(number, 'f', -1, 64))
+}
+
+func inline(b *strings.Builder, attrs, text string) {
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(b, `<c %s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, attrs, escape(text))
+}
+
+// column returns the letters of the zero based column i: A, B, ... Z, AA
+func column(i int) string {
+	var letters []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		letters = append([]byte{byte('A' + (i-1)%26)}, letters...)
+	}
+	return string(letters)
+}
+
+// sheetName makes name a valid sheet name: at most 31 characters, none of
+// : \ / ? * [ ], and not empty
+func sheetName(name string, n int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name == "" {
+		return "Sheet" + strconv.Itoa(n)
+	}
+	return name
+}
+
+// escape escapes text for XML, dropping the control characters XML 1.0
+// can't hold
+func escape(text string) string {
+	var b strings.Builder
+	clean := strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, text)
+	if err := xml.EscapeText(&b, []byte(clean)); err != nil {
+		return ""
+	}
+	return b.String()
+}